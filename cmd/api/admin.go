@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// The listUsersHandler returns a page of users. They can be narrowed down with ?search= (part
+// of the name or email address), ?activated=true|false, ?deactivated=true|false and ?role=.
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.UserFilters
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Search = app.readString(qs, "search", "")
+	if qs.Get("activated") != "" {
+		activated := app.readBool(qs, "activated", false, v)
+		input.Activated = &activated
+	}
+	if qs.Get("deactivated") != "" {
+		deactivated := app.readBool(qs, "deactivated", false, v)
+		input.Deactivated = &deactivated
+	}
+	input.Role = app.readString(qs, "role", "")
+	v.Check(input.Role == "" || validator.In(input.Role, data.AccountRoles...), "role", "invalid role")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.models.Users.GetAll(r.Context(), input.UserFilters, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showUserHandler returns a user along with their roles and a summary of the tasks they
+// have created.
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	counts, err := app.models.Stats.GetTaskCounts(r.Context(), user.ID, app.now())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "roles": roles, "task_counts": counts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deactivateUserHandler locks a user out: requireActivatedUser() turns away deactivated
+// accounts, and their authentication tokens are revoked as well. The user can't undo it
+// by activating their account again, see activateUserHandler().
+func (app *application) deactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+	if user.ID == app.contextGetUser(r).ID {
+		app.errorResponse(w, r, http.StatusConflict, "you can't deactivate your own account")
+		return
+	}
+
+	if !app.setUserDeactivated(w, r, user, true) {
+		return
+	}
+	// JWT access tokens can't be revoked, but they are short-lived and can't be
+	// refreshed once the refresh tokens are gone.
+	for _, scope := range []string{data.ScopeAuthentications, data.ScopeRefresh} {
+		err := app.models.Tokens.DeleteAllForUser(r.Context(), scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The reactivateUserHandler lets a deactivated user back in. It doesn't activate an
+// account whose email address was never confirmed.
+func (app *application) reactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.setUserDeactivated(w, r, user, false) {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The expireUserTokensHandler revokes every token that gives access to a user's data, so
+// that they have to log in again and any calendar subscriptions stop working.
+func (app *application) expireUserTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	for _, scope := range []string{data.ScopeAuthentications, data.ScopeRefresh, data.ScopeCalendar} {
+		err := app.models.Tokens.DeleteAllForUser(r.Context(), scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"message": "tokens successfully expired"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The setUserDeactivated() helper saves a change to whether a user is deactivated and
+// records it in the audit log. It sends the error response itself and returns false if the
+// change can't be saved.
+func (app *application) setUserDeactivated(w http.ResponseWriter, r *http.Request, user *data.User, deactivated bool) bool {
+	if user.Deactivated == deactivated {
+		return true
+	}
+
+	before := *user
+	user.Deactivated = deactivated
+	err := app.models.Users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+	app.recordAudit(app.contextGetUser(r).ID, data.AuditUser, user.ID, data.AuditUpdate, &before, user)
+	return true
+}
+
+// The readUser() helper fetches the user named by the :id URL parameter.
+func (app *application) readUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	user, err := app.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/scan"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// maxAttachmentBytes is the largest file that can be attached to a task.
+const maxAttachmentBytes = 10 << 20
+
+// attachmentScanners are the values of -attachments-scanner.
+var attachmentScanners = []string{"none", "clamav", "http"}
+
+// The newAttachmentScanner() function returns the scanner that attachments have to pass:
+// the check for programs and scripts, followed by the virus scanner chosen with
+// -attachments-scanner, if any.
+func newAttachmentScanner(cfg config) scan.Scanner {
+	switch cfg.attachments.scanner {
+	case "clamav":
+		return scan.All(scan.Executables{}, scan.NewClamAV(cfg.attachments.clamavAddr, cfg.attachments.scanTimeout))
+	case "http":
+		return scan.All(scan.Executables{}, scan.NewHTTP(cfg.attachments.scannerURL, cfg.attachments.scanTimeout))
+	default:
+		return scan.Executables{}
+	}
+}
+
+// The createAttachmentHandler() attaches a file to a task. The file is sent either as the
+// request body, named by ?filename=, or as the "file" field of a multipart form. Its type
+// is worked out from its content rather than taken from the client. The attachment is
+// quarantined until it has been scanned, which starts straight away in the background.
+func (app *application) createAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	content, filename, ok := app.readUpload(w, r, maxAttachmentBytes)
+	if !ok {
+		return
+	}
+
+	attachment := &data.Attachment{
+		TaskID:      &task.ID,
+		UserID:      app.contextGetUser(r).ID,
+		Filename:    filename,
+		ContentType: http.DetectContentType(content),
+		Size:        int64(len(content)),
+	}
+
+	v := validator.New()
+	if data.ValidateAttachment(v, attachment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := app.models.Attachments.Insert(r.Context(), attachment, content)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The scan gets a copy, so that it doesn't change the attachment while the response
+	// is being written.
+	scanned := *attachment
+	app.background(func() {
+		app.scanAttachment(&scanned, content)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tasks/%d/attachments/%d", task.ID, attachment.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"attachment": attachment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	attachments, err := app.models.Attachments.GetAllForTask(r.Context(), task.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"attachments": attachments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := app.readAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"attachment": attachment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The downloadAttachmentHandler() sends the content of an attachment that has passed its
+// scan, as a download rather than to be shown in the browser.
+func (app *application) downloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := app.readAttachment(w, r)
+	if !ok {
+		return
+	}
+	if attachment.ScanStatus != data.ScanClean {
+		app.attachmentQuarantinedResponse(w, r, attachment)
+		return
+	}
+
+	content, err := app.models.Attachments.GetContent(r.Context(), attachment.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, "", time.Time(attachment.CreatedAt), bytes.NewReader(content))
+}
+
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := app.readAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Attachments.Delete(r.Context(), attachment.ID, *attachment.TaskID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "attachment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readAttachment() helper fetches the attachment identified by the :attachment_id URL
+// parameter on the task identified by :id, sending an error response and returning false
+// on failure.
+func (app *application) readAttachment(w http.ResponseWriter, r *http.Request) (*data.Attachment, bool) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := app.readNamedIDParam(r, "attachment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	attachment, err := app.models.Attachments.Get(r.Context(), id, task.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return attachment, true
+}
+
+// The readUpload() helper reads a file of at most maxBytes, sent either as the request
+// body or as the "file" field of a multipart form, along with its name: the one given in
+// the form, or else ?filename=. If anything goes wrong it sends the error response itself
+// and returns false.
+func (app *application) readUpload(w http.ResponseWriter, r *http.Request, maxBytes int64) ([]byte, string, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	var file io.Reader = r.Body
+	filename := r.URL.Query().Get("filename")
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err := r.ParseMultipartForm(maxBytes)
+		if err != nil {
+			app.uploadReadError(w, r, err, maxBytes)
+			return nil, "", false
+		}
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New(`the form must contain a "file" field`))
+			return nil, "", false
+		}
+		defer f.Close()
+		file = f
+		filename = header.Filename
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		app.uploadReadError(w, r, err, maxBytes)
+		return nil, "", false
+	}
+	return content, filename, true
+}
+
+// The uploadReadError() helper responds to an error reading an uploaded file.
+func (app *application) uploadReadError(w http.ResponseWriter, r *http.Request, err error, maxBytes int64) {
+	var maxBytesError *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesError):
+		app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytes))
+	default:
+		app.badRequestResponse(w, r, err)
+	}
+}
+
+// The scanAttachment() method runs a quarantined attachment through the scanners and
+// records the result. If the attachment can't be scanned, for example because the virus
+// scanner is down, it stays quarantined, and the attachment scanner job tries again later.
+func (app *application) scanAttachment(attachment *data.Attachment, content []byte) {
+	properties := map[string]string{"attachment_id": strconv.FormatInt(attachment.ID, 10)}
+
+	result, err := app.scanner.Scan(context.Background(), content)
+	if err != nil {
+		app.logger.PrintError(err, properties)
+		return
+	}
+	attachment.ScanStatus = data.ScanClean
+	if !result.Clean {
+		attachment.ScanStatus = data.ScanRejected
+		attachment.ScanReason = result.Reason
+		properties["reason"] = result.Reason
+		app.logger.PrintInfo("attachment rejected", properties)
+	}
+
+	// The attachment may have been deleted in the meantime, or scanned by the job.
+	err = app.models.Attachments.SetScanResult(context.Background(), attachment)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.logger.PrintError(err, properties)
+	}
+}
+
+// The startAttachmentScanner() method starts a background job which scans the attachments
+// that are still quarantined because they couldn't be scanned when they were uploaded,
+// such as when the virus scanner was down or the server stopped in the middle of a scan.
+func (app *application) startAttachmentScanner() {
+	app.backgroundTicker("attachment_scans", app.config.attachments.scanInterval, func() {
+		err := app.scanPendingAttachments()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+func (app *application) scanPendingAttachments() error {
+	// The attachments uploaded since the last run are still being scanned, most likely.
+	before := app.now().Add(-app.config.attachments.scanInterval)
+	attachments, err := app.models.Attachments.GetPending(context.Background(), before, 20)
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		select {
+		case <-app.done:
+			return nil
+		default:
+		}
+
+		content, err := app.models.Attachments.GetContent(context.Background(), attachment.ID)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+		app.scanAttachment(attachment, content)
+	}
+	return nil
+}
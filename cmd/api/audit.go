@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// The recordAudit() helper adds an entry to the audit log. actorID is the user who made the
+// change, or 0 for changes made by the system. before and after are the record as it was
+// and as it is now, nil for a record that was created or deleted; updates that didn't
+// change any fields are not recorded. Like webhook deliveries, the entry is saved in the
+// background and failures are only logged, since the change itself has already been made.
+func (app *application) recordAudit(actorID int64, entityType string, entityID int64, action string, before, after interface{}) {
+	logProperties := map[string]string{"entity_type": entityType, "entity_id": strconv.FormatInt(entityID, 10)}
+
+	// The changes are worked out straight away, before the caller can modify the records.
+	changes, err := data.AuditChanges(before, after)
+	if err != nil {
+		app.logger.PrintError(err, logProperties)
+		return
+	}
+	if action == data.AuditUpdate && len(changes) == 0 {
+		return
+	}
+
+	entry := &data.AuditEntry{
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Changes:    changes,
+	}
+	if actorID > 0 {
+		entry.ActorID = &actorID
+	}
+
+	app.background(func() {
+		err := app.models.Audit.Insert(context.Background(), entry)
+		if err != nil {
+			app.logger.PrintError(err, logProperties)
+		}
+	})
+}
+
+// The recordTaskUpdate() helper audits a change to a task made by actorID. before is a
+// copy of the task taken before it was modified.
+func (app *application) recordTaskUpdate(actorID int64, before data.Task, task *data.Task) {
+	app.recordAudit(actorID, data.AuditTask, task.ID, data.AuditUpdate, &before, task)
+}
+
+// The taskActivityHandler returns the audit entries of one of the user's tasks, newest
+// first.
+func (app *application) taskActivityHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"created_at", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	filters := data.AuditFilters{EntityType: data.AuditTask, EntityID: task.ID}
+	entries, metadata, err := app.models.Audit.GetAll(r.Context(), filters, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"activity": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listAuditHandler returns the audit log of every user. It needs the audit:read
+// permission, which is only granted to administrators. The feed can be narrowed down with
+// the entity_type, entity_id and actor_id parameters.
+func (app *application) listAuditHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.AuditFilters
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.AuditFilters.EntityType = app.readString(qs, "entity_type", "")
+	input.AuditFilters.EntityID = int64(app.readInt(qs, "entity_id", 0, v))
+	input.AuditFilters.ActorID = int64(app.readInt(qs, "actor_id", 0, v))
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"created_at", "-created_at"}
+
+	if input.AuditFilters.EntityType != "" {
+		v.Check(validator.In(input.AuditFilters.EntityType, data.AuditEntityTypes...), "entity_type", "must be one of "+strings.Join(data.AuditEntityTypes, ", "))
+	}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Audit.GetAll(r.Context(), input.AuditFilters, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
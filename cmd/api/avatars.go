@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/avatar"
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// maxAvatarBytes is the largest image that can be uploaded as an avatar.
+const maxAvatarBytes = 5 << 20
+
+// The uploadAvatarHandler() sets the current user's avatar. The image is sent either as
+// the request body or as the "file" field of a multipart form, and is cropped to a square
+// and stored in each of the standard sizes, as attachments of the user's.
+func (app *application) uploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	upload, _, ok := app.readUpload(w, r, maxAvatarBytes)
+	if !ok {
+		return
+	}
+
+	images, err := avatar.Resize(upload)
+	if err != nil {
+		v := validator.New()
+		switch {
+		case errors.Is(err, avatar.ErrUnsupportedFormat):
+			v.AddError("file", "must be a PNG, JPEG or GIF image")
+		case errors.Is(err, avatar.ErrTooLarge):
+			v.AddError("file", fmt.Sprintf("must not be more than %d pixels wide or high", avatar.MaxDimension))
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	before, err := app.currentAvatarURL(r, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	updatedAt, err := app.models.Avatars.Save(r.Context(), user.ID, images)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	url := data.AvatarURL(user.ID, updatedAt)
+	app.recordAudit(user.ID, data.AuditUser, user.ID, data.AuditUpdate, envelope{"avatar_url": before}, envelope{"avatar_url": &url})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"avatar_url": url, "sizes": avatar.Sizes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteAvatarHandler() removes the current user's avatar.
+func (app *application) deleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	before, err := app.currentAvatarURL(r, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Avatars.Delete(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.recordAudit(user.ID, data.AuditUser, user.ID, data.AuditUpdate, envelope{"avatar_url": before}, envelope{"avatar_url": nil})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "avatar successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showAvatarHandler() serves a user's avatar as a PNG image, in the size given by
+// ?size=. Avatars are shown next to comments and workspace members, so like the images on
+// any other page they can be fetched without authenticating. Their URLs change whenever
+// the avatar does, so they can be cached for a long time.
+func (app *application) showAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	size := app.readInt(r.URL.Query(), "size", avatar.DefaultSize, v)
+	v.Check(avatar.IsSize(size), "size", fmt.Sprintf(validator.MsgOneOf, avatarSizeList()))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	image, err := app.models.Avatars.Get(r.Context(), id, size)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, "", time.Time(image.UpdatedAt), bytes.NewReader(image.Image))
+}
+
+// The currentAvatarURL() helper returns the URL of a user's avatar, or nil if they have
+// none, for the audit log.
+func (app *application) currentAvatarURL(r *http.Request, userID int64) (*string, error) {
+	image, err := app.models.Avatars.Get(r.Context(), userID, avatar.DefaultSize)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	url := data.AvatarURL(userID, time.Time(image.UpdatedAt))
+	return &url, nil
+}
+
+// avatarSizeList returns avatar.Sizes for validation messages, like "32, 64, 128, 256".
+func avatarSizeList() string {
+	sizes := make([]string, len(avatar.Sizes))
+	for i, size := range avatar.Sizes {
+		sizes[i] = strconv.Itoa(size)
+	}
+	return strings.Join(sizes, ", ")
+}
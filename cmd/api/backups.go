@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// maxBackupBytes limits the size of a backup accepted by POST /v1/import.
+const maxBackupBytes = 20 << 20
+
+// The exportBackupHandler returns a full dump of the workspace's data, which can be restored on
+// this or another instance with POST /v1/import.
+func (app *application) exportBackupHandler(w http.ResponseWriter, r *http.Request) {
+	backup, err := app.models.Backups.Export(r.Context(), app.contextGetWorkspace(r).WorkspaceID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", `attachment; filename="backup.json"`)
+
+	// The file is what POST /v1/import reads, so it is the same whichever API version it
+	// is downloaded from.
+	err = app.writeJSONBody(w, http.StatusOK, envelope{"backup": backup}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The importBackupHandler restores a backup produced by GET /v1/export. The whole backup
+// is validated up front and then restored in a single transaction; records that already
+// exist are skipped, so importing the same backup twice is harmless.
+func (app *application) importBackupHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Backup *data.Backup `json:"backup"`
+	}
+	err := app.readJSONLimit(w, r, &input, maxBackupBytes)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if validateBackup(v, input.Backup); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	summary, err := app.models.Backups.Import(r.Context(), app.contextGetWorkspace(r).WorkspaceID, app.contextGetUser(r).ID, input.Backup)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"imported": summary}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateBackup runs the usual validation rules over every record in a backup. Errors are
+// keyed by the record's position, e.g. "tasks[3].title".
+func validateBackup(v *validator.Validator, backup *data.Backup) {
+	if backup == nil {
+		v.AddError("backup", "must be provided")
+		return
+	}
+	v.Check(backup.Version == data.BackupVersion, "backup.version", fmt.Sprintf("must be %d", data.BackupVersion))
+
+	for i, category := range backup.Categories {
+		check := validator.New()
+		data.ValidateCategory(check, &data.Category{Name: category.Name, Description: category.Description})
+		addPrefixedErrors(v, fmt.Sprintf("categories[%d]", i), check)
+	}
+	for i, tag := range backup.Tags {
+		check := validator.New()
+		data.ValidateTag(check, &data.Tag{Name: tag.Name})
+		addPrefixedErrors(v, fmt.Sprintf("tags[%d]", i), check)
+	}
+	categories := make(map[string]bool, len(backup.Categories))
+	parents := make(map[int64]*int64, len(backup.Categories))
+	for _, category := range backup.Categories {
+		categories[category.Name] = true
+		parents[category.ID] = category.ParentID
+	}
+	// Follow each category's parents; coming back to the category means a cycle.
+	for i, category := range backup.Categories {
+		parentID := category.ParentID
+		for steps := 0; parentID != nil && steps < len(backup.Categories); steps++ {
+			if *parentID == category.ID {
+				v.AddError(fmt.Sprintf("categories[%d].parent_id", i), "must not make the category its own ancestor")
+				break
+			}
+			parentID = parents[*parentID]
+		}
+	}
+	for i, task := range backup.Tasks {
+		var dueDate data.CustomTime
+		if task.DueDate != nil {
+			dueDate = data.CustomTime(*task.DueDate)
+		}
+		check := validator.New()
+		check.Check(categories[task.Category], "category", "must be one of the backup's categories")
+		data.ValidateTask(check, &data.Task{
+			Title:       task.Title,
+			Description: task.Description,
+			DueDate:     dueDate,
+			Priority:    task.Priority,
+			Status:      task.Status,
+			Category:    task.Category,
+			Recurrence:  task.Recurrence,
+		})
+		addPrefixedErrors(v, fmt.Sprintf("tasks[%d]", i), check)
+	}
+	for i, comment := range backup.Comments {
+		check := validator.New()
+		data.ValidateComment(check, &data.Comment{Body: comment.Body})
+		addPrefixedErrors(v, fmt.Sprintf("comments[%d]", i), check)
+	}
+}
+
+// addPrefixedErrors copies the errors from check into v, prefixing each key.
+func addPrefixedErrors(v *validator.Validator, prefix string, check *validator.Validator) {
+	for key, message := range check.Errors {
+		v.AddError(prefix+"."+key, message)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// maxBulkOperations limits how much work a single bulk request can ask for.
+const maxBulkOperations = 100
+
+// errBulkRollback is returned from the transaction function when at least one
+// operation failed, so that none of the changes are kept.
+var errBulkRollback = errors.New("bulk operation rolled back")
+
+// bulkOperation is one entry of the "operations" array accepted by POST /v1/tasks/bulk.
+type bulkOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id"`
+	Version *int32          `json:"version"`
+	Status  data.TaskStatus `json:"status"`
+	Task    taskInput       `json:"task"`
+}
+
+// bulkResult reports the outcome of a single operation, in the same order as the request.
+type bulkResult struct {
+	Index  int         `json:"index"`
+	Op     string      `json:"op"`
+	Status int         `json:"status"`
+	Task   *data.Task  `json:"task,omitempty"`
+	Error  interface{} `json:"error,omitempty"`
+
+	// previousStatus is the task's status before an update, used to tell whether the
+	// operation completed it.
+	previousStatus data.TaskStatus
+	// previous is the task as it was before an update or delete, for the audit log.
+	previous *data.Task
+}
+
+// The bulkTasksHandler() applies a batch of create/update/delete/status operations to the
+// current workspace's tasks inside a single database transaction. Either every operation
+// succeeds and the changes are committed, or nothing is changed and the per-item results
+// explain which operations failed.
+func (app *application) bulkTasksHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Operations []bulkOperation `json:"operations"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if validateBulkOperations(v, input.Operations); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results, committed, err := app.runBulk(r.Context(), app.contextGetUser(r), app.contextGetWorkspace(r).WorkspaceID, input.Operations)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !committed {
+		status = http.StatusUnprocessableEntity
+	}
+	err = app.writeJSON(w, status, envelope{"committed": committed, "results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func validateBulkOperations(v *validator.Validator, ops []bulkOperation) {
+	v.Check(len(ops) > 0, "operations", "must contain at least one operation")
+	v.Check(len(ops) <= maxBulkOperations, "operations", fmt.Sprintf("must not contain more than %d operations", maxBulkOperations))
+	validator.Field(v, "operations", ops, validator.Each(validator.Nested(func(v *validator.Validator, op bulkOperation) {
+		validator.Field(v, "op", op.Op, validator.OneOf[string]("create", "update", "delete", "status"))
+	})))
+}
+
+// The runBulk() method applies a batch of operations for a user to the tasks of a
+// workspace inside a single transaction and announces the changes if they were committed. It is shared by the bulk
+// endpoint and the WebSocket sync channel. Due dates are read and returned in the user's time zone.
+func (app *application) runBulk(ctx context.Context, user *data.User, workspaceID int64, ops []bulkOperation) ([]bulkResult, bool, error) {
+	userID := user.ID
+	loc := app.userLocation(user)
+	results := make([]bulkResult, len(ops))
+
+	err := app.models.Tasks.InTx(ctx, func(tx data.TaskTx) error {
+		failed := false
+		for i, op := range ops {
+			result, err := app.runBulkOperation(ctx, tx, userID, workspaceID, loc, op)
+			if err != nil {
+				return err
+			}
+			result.Index = i
+			result.Op = op.Op
+			results[i] = result
+			if result.Error != nil {
+				failed = true
+			}
+		}
+		if failed {
+			return errBulkRollback
+		}
+		return nil
+	})
+
+	committed := true
+	switch {
+	case errors.Is(err, errBulkRollback):
+		committed = false
+	case err != nil:
+		return nil, false, err
+	default:
+		app.publishBulkEvents(userID, workspaceID, ops, results)
+	}
+	for i := range results {
+		results[i].Task = app.localTask(user, results[i].Task)
+	}
+	return results, committed, nil
+}
+
+// The runBulkOperation() method applies a single operation. Problems with the operation
+// itself (validation failures, missing tasks, version conflicts) are reported in the
+// result; only unexpected errors are returned, which aborts the whole batch.
+func (app *application) runBulkOperation(ctx context.Context, tx data.TaskTx, userID, workspaceID int64, loc *time.Location, op bulkOperation) (bulkResult, error) {
+	if op.Op == "create" {
+		task := &data.Task{UserID: userID, WorkspaceID: workspaceID}
+		op.Task.apply(task, loc)
+
+		v := validator.New()
+		err := app.validateTask(ctx, v, task)
+		if err != nil {
+			return bulkResult{}, err
+		}
+		if !v.Valid() {
+			return bulkResult{Status: http.StatusUnprocessableEntity, Error: v.Errors}, nil
+		}
+		err = tx.Insert(task)
+		if err != nil {
+			return bulkResult{}, err
+		}
+		return bulkResult{Status: http.StatusCreated, Task: task}, nil
+	}
+
+	if op.Op == "delete" {
+		task, err := tx.GetForWorkspace(op.ID, workspaceID)
+		if err == nil {
+			err = tx.DeleteForWorkspace(op.ID, workspaceID)
+		}
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				return bulkResult{Status: http.StatusNotFound, Error: "the requested resource could not be found"}, nil
+			}
+			return bulkResult{}, err
+		}
+		return bulkResult{Status: http.StatusOK, previous: task}, nil
+	}
+
+	// What's left are "update" and "status", which both modify an existing task.
+	task, err := tx.GetForWorkspace(op.ID, workspaceID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return bulkResult{Status: http.StatusNotFound, Error: "the requested resource could not be found"}, nil
+		}
+		return bulkResult{}, err
+	}
+	// Offline clients send the version they last saw, so that edits made in the
+	// meantime are reported as conflicts rather than silently overwritten.
+	if op.Version != nil && *op.Version != task.Version {
+		return bulkResult{Status: http.StatusConflict, Error: "unable to update the record due to an edit conflict, please try again"}, nil
+	}
+
+	before := *task
+	previousStatus := task.Status
+	if op.Op == "status" {
+		task.Status = op.Status
+	} else {
+		op.Task.apply(task, loc)
+	}
+
+	v := validator.New()
+	err = app.validateTask(ctx, v, task)
+	if err != nil {
+		return bulkResult{}, err
+	}
+	if !v.Valid() {
+		return bulkResult{Status: http.StatusUnprocessableEntity, Error: v.Errors}, nil
+	}
+	err = data.CheckStatusTransition(previousStatus, task.Status)
+	if err == nil {
+		err = tx.CheckBlockers(task, previousStatus)
+	}
+	if err != nil {
+		var transitionErr *data.TransitionError
+		if errors.As(err, &transitionErr) {
+			return bulkResult{Status: http.StatusConflict, Error: err.Error()}, nil
+		}
+		return bulkResult{}, err
+	}
+	err = tx.Update(task)
+	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			return bulkResult{Status: http.StatusConflict, Error: "unable to update the record due to an edit conflict, please try again"}, nil
+		}
+		return bulkResult{}, err
+	}
+	return bulkResult{Status: http.StatusOK, Task: task, previousStatus: previousStatus, previous: &before}, nil
+}
+
+// The publishBulkEvents() method announces the changes made by a committed bulk request,
+// and records them in the audit log.
+func (app *application) publishBulkEvents(userID, workspaceID int64, ops []bulkOperation, results []bulkResult) {
+	for i, result := range results {
+		switch ops[i].Op {
+		case "create":
+			app.publishTaskEvent(workspaceID, data.EventTaskCreated, result.Task)
+			app.recordAudit(userID, data.AuditTask, result.Task.ID, data.AuditCreate, nil, result.Task)
+		case "delete":
+			app.publishTaskEvent(workspaceID, data.EventTaskDeleted, map[string]int64{"id": ops[i].ID})
+			app.recordAudit(userID, data.AuditTask, ops[i].ID, data.AuditDelete, result.previous, nil)
+		default:
+			app.publishTaskUpdate(result.Task, result.previousStatus)
+			app.recordTaskUpdate(userID, *result.previous, result.Task)
+		}
+	}
+}
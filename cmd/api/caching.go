@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// cacheControl is the Cache-Control header of the responses sent by writeResponse(). They
+// depend on who is asking, so shared caches must not keep them, and clients must check
+// with us before reusing them, which the ETag and Last-Modified headers make cheap.
+const cacheControl = "private, no-cache"
+
+// The setLastModified() helper sets the Last-Modified header of a response to when the
+// resource it sends was last changed, so that writeResponse() can answer
+// If-Modified-Since. Handlers call it before writeResponse().
+func setLastModified(w http.ResponseWriter, t time.Time) {
+	w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+// bodyETag returns the ETag of a response body. It is weak, since compressResponses() may
+// send the same representation compressed.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`W/"%x"`, sum[:16])
+}
+
+// The writeCacheable() helper sends a response body like writeJSONBody() does. Successful
+// GET responses also get an ETag computed from the body and the Cache-Control header, and
+// are replaced by 304 Not Modified if the request's If-None-Match or If-Modified-Since
+// shows that the client already has them.
+func writeCacheable(w http.ResponseWriter, r *http.Request, status int, contentType string, body []byte, headers http.Header) {
+	// The headers are added after the Content-Type, so that they can override it.
+	w.Header().Set("Content-Type", contentType)
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	if r.Method == http.MethodGet && status == http.StatusOK {
+		etag := bodyETag(body)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", cacheControl)
+		if notModified(r, etag, w.Header().Get("Last-Modified")) {
+			w.Header().Del("Content-Type")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// notModified reports whether the client's copy of a response is still current, following
+// RFC 9110: If-None-Match is checked against the ETag if the request has one, and only
+// otherwise If-Modified-Since against the Last-Modified time, to the second.
+func notModified(r *http.Request, etag, lastModified string) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return header == "*" || etagListed(header, etag[len("W/"):])
+	}
+
+	header := r.Header.Get("If-Modified-Since")
+	if header == "" || lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
@@ -0,0 +1,655 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/zarinakolybaeva/DoMake/internal/caldav"
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/ical"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// The WebDAV methods used by CalDAV clients, which net/http has no constants for.
+const (
+	methodPropfind = "PROPFIND"
+	methodReport   = "REPORT"
+)
+
+// The CalDAV server is laid out as one principal, the current user, whose calendar home
+// holds a calendar of to-dos for each workspace they are a member of. Each task is a
+// calendar object named after its ID, e.g. /caldav/calendars/3/task-42.ics.
+const (
+	caldavRoot      = "/caldav/"
+	caldavPrincipal = "/caldav/principal/"
+	caldavHome      = "/caldav/calendars/"
+)
+
+// caldavCompliance is sent in the DAV header, telling clients that this is a CalDAV
+// server.
+const caldavCompliance = "1, 3, calendar-access"
+
+// basicAuthChallenge asks CalDAV clients for the user's email address and an API key.
+const basicAuthChallenge = `Basic realm="Taskninja CalDAV", charset="UTF-8"`
+
+// maxCalendarObjectBytes is the largest calendar object that can be PUT.
+const maxCalendarObjectBytes = 1 << 20
+
+func caldavCalendarPath(workspaceID int64) string {
+	return caldavHome + strconv.FormatInt(workspaceID, 10) + "/"
+}
+
+func caldavObjectPath(task *data.Task) string {
+	return fmt.Sprintf("%stask-%d.ics", caldavCalendarPath(task.WorkspaceID), task.ID)
+}
+
+// caldavETag identifies a version of a task, so that clients can tell when it has
+// changed and send it back in If-Match when they change it themselves.
+func caldavETag(task *data.Task) string {
+	return fmt.Sprintf(`"%d-%d"`, task.ID, task.Version)
+}
+
+// parseCalDAVObject returns the ID of the task in a calendar object name such as
+// task-42.ics.
+func parseCalDAVObject(name string) (int64, bool) {
+	name, ok := strings.CutPrefix(name, "task-")
+	if !ok {
+		return 0, false
+	}
+	name, ok = strings.CutSuffix(name, ".ics")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(name, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// The caldav() middleware guards the CalDAV routes. Calendar apps only send credentials
+// once they have been asked for them, so anonymous requests get a Basic challenge along
+// with their 401; the rest is requirePermission() as usual.
+func (app *application) caldav(permission string, next http.HandlerFunc) http.HandlerFunc {
+	protected := app.requirePermission(permission, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("DAV", caldavCompliance)
+		if app.contextGetUser(r).IsAnonymous() {
+			w.Header().Set("WWW-Authenticate", basicAuthChallenge)
+		}
+		protected(w, r)
+	}
+}
+
+// The caldavWorkspace() middleware is requireWorkspaceRole() for the CalDAV routes, where
+// the workspace is the calendar named in the path.
+func (app *application) caldavWorkspace(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspaceID, err := app.readNamedIDParam(r, "workspace")
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		member, ok := app.checkWorkspaceRole(w, r, workspaceID, role)
+		if !ok {
+			return
+		}
+		next.ServeHTTP(w, app.contextSetWorkspace(r, member))
+	}
+}
+
+// The caldavOptionsHandler() answers OPTIONS requests, which clients send to find out
+// whether the server speaks CalDAV. It needs no authentication.
+func (app *application) caldavOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", caldavCompliance)
+	w.Header().Set("Allow", "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT")
+	w.WriteHeader(http.StatusOK)
+}
+
+// The caldavWellKnownHandler() points clients that were only given the server's address
+// at the CalDAV root, as RFC 6764 describes.
+func (app *application) caldavWellKnownHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, caldavRoot, http.StatusMovedPermanently)
+}
+
+// The caldavRootHandler() answers a PROPFIND of the CalDAV root, where clients look for
+// the current user's principal.
+func (app *application) caldavRootHandler(w http.ResponseWriter, r *http.Request) {
+	propfind, ok := app.readPropfind(w, r)
+	if !ok {
+		return
+	}
+
+	resp := caldav.Response{Href: caldavRoot}
+	resp.Select([]caldav.Prop{
+		caldav.Elements(caldav.DAV("resourcetype"), caldav.DAV("collection")),
+		caldav.Href(caldav.DAV("current-user-principal"), caldavPrincipal),
+	}, propfind)
+	app.writeMultistatus(w, r, []caldav.Response{resp})
+}
+
+// The caldavPrincipalHandler() answers a PROPFIND of the current user's principal, which
+// tells clients where their calendars are.
+func (app *application) caldavPrincipalHandler(w http.ResponseWriter, r *http.Request) {
+	propfind, ok := app.readPropfind(w, r)
+	if !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+	resp := caldav.Response{Href: caldavPrincipal}
+	resp.Select([]caldav.Prop{
+		caldav.Elements(caldav.DAV("resourcetype"), caldav.DAV("principal")),
+		caldav.Text(caldav.DAV("displayname"), user.Name),
+		caldav.Href(caldav.DAV("current-user-principal"), caldavPrincipal),
+		caldav.Href(caldav.DAV("principal-URL"), caldavPrincipal),
+		caldav.Href(caldav.CalDAV("calendar-home-set"), caldavHome),
+		caldav.Href(caldav.CalDAV("calendar-user-address-set"), "mailto:"+user.Email),
+	}, propfind)
+	app.writeMultistatus(w, r, []caldav.Response{resp})
+}
+
+// The caldavHomeHandler() answers a PROPFIND of the current user's calendar home. With
+// Depth: 1 it lists their calendars, one for each of their workspaces.
+func (app *application) caldavHomeHandler(w http.ResponseWriter, r *http.Request) {
+	propfind, ok := app.readPropfind(w, r)
+	if !ok {
+		return
+	}
+
+	resp := caldav.Response{Href: caldavHome}
+	resp.Select([]caldav.Prop{
+		caldav.Elements(caldav.DAV("resourcetype"), caldav.DAV("collection")),
+		caldav.Href(caldav.DAV("current-user-principal"), caldavPrincipal),
+	}, propfind)
+	responses := []caldav.Response{resp}
+
+	if r.Header.Get("Depth") != "0" {
+		user := app.contextGetUser(r)
+		workspaces, err := app.models.Workspaces.GetAllForUser(r.Context(), user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		tasks, err := app.models.Tasks.GetAllForCalendar(r.Context(), user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		canWrite, err := app.canWriteTasks(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		for _, workspace := range workspaces {
+			resp := caldav.Response{Href: caldavCalendarPath(workspace.ID)}
+			writable := canWrite && data.RoleAllows(workspace.Role, data.RoleMember)
+			resp.Select(calendarCollectionProps(workspace, tasksInWorkspace(tasks, workspace.ID), writable), propfind)
+			responses = append(responses, resp)
+		}
+	}
+	app.writeMultistatus(w, r, responses)
+}
+
+// The caldavCalendarHandler() answers a PROPFIND of one calendar. With Depth: 1 it also
+// lists the calendar's objects, which is how most clients find out which tasks have
+// changed.
+func (app *application) caldavCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	propfind, ok := app.readPropfind(w, r)
+	if !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+	workspace, err := app.models.Workspaces.GetForUser(r.Context(), app.contextGetWorkspace(r).WorkspaceID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	tasks, err := app.calendarTasks(r.Context(), user.ID, workspace.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	canWrite, err := app.canWriteTasks(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	resp := caldav.Response{Href: caldavCalendarPath(workspace.ID)}
+	resp.Select(calendarCollectionProps(workspace, tasks, canWrite && data.RoleAllows(workspace.Role, data.RoleMember)), propfind)
+	responses := []caldav.Response{resp}
+
+	if r.Header.Get("Depth") != "0" {
+		for _, task := range tasks {
+			responses = append(responses, app.calendarObjectResponse(task, propfind))
+		}
+	}
+	app.writeMultistatus(w, r, responses)
+}
+
+// The caldavReportHandler() answers calendar-query and calendar-multiget REPORTs on a
+// calendar. A calendar-query returns every to-do in the calendar, since it has nothing
+// else; a calendar-multiget returns the objects asked for, and a 404 for ones that don't
+// exist (any more).
+func (app *application) caldavReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := caldav.ReadReport(r.Body)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	workspaceID := app.contextGetWorkspace(r).WorkspaceID
+	tasks, err := app.calendarTasks(r.Context(), user.ID, workspaceID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	propfind := &caldav.Propfind{AllProp: len(report.Props) == 0, Props: report.Props}
+	responses := []caldav.Response{}
+
+	switch report.Name {
+	case caldav.CalDAV("calendar-query"):
+		// The calendar only holds to-dos, so a query for events finds nothing.
+		if len(report.Components) > 1 && report.Components[1] != "VTODO" {
+			break
+		}
+		for _, task := range tasks {
+			responses = append(responses, app.calendarObjectResponse(task, propfind))
+		}
+	case caldav.CalDAV("calendar-multiget"):
+		byPath := make(map[string]*data.Task, len(tasks))
+		for _, task := range tasks {
+			byPath[caldavObjectPath(task)] = task
+		}
+		for _, href := range report.Hrefs {
+			// Clients may send full URLs as well as paths.
+			target := href
+			if u, err := url.Parse(href); err == nil {
+				target = u.Path
+			}
+			task, ok := byPath[target]
+			if !ok {
+				responses = append(responses, caldav.Response{Href: href, Status: http.StatusNotFound})
+				continue
+			}
+			resp := app.calendarObjectResponse(task, propfind)
+			resp.Href = href
+			responses = append(responses, resp)
+		}
+	default:
+		app.errorResponse(w, r, http.StatusForbidden, "only calendar-query and calendar-multiget reports are supported")
+		return
+	}
+	app.writeMultistatus(w, r, responses)
+}
+
+// The caldavObjectPropfindHandler() answers a PROPFIND of a single calendar object.
+func (app *application) caldavObjectPropfindHandler(w http.ResponseWriter, r *http.Request) {
+	propfind, ok := app.readPropfind(w, r)
+	if !ok {
+		return
+	}
+	task, ok := app.readCalendarObject(w, r)
+	if !ok {
+		return
+	}
+	app.writeMultistatus(w, r, []caldav.Response{app.calendarObjectResponse(task, propfind)})
+}
+
+// The caldavGetHandler() returns a task as an iCalendar object holding one VTODO.
+func (app *application) caldavGetHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readCalendarObject(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("ETag", caldavETag(task))
+	_, err := w.Write([]byte(app.calendarObject(task)))
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// The caldavPutHandler() updates a task from a VTODO changed in a calendar app: its title,
+// description, due date, priority and status. Categories and recurrence are left as they
+// are. Clients send the ETag they last saw in If-Match, so a task that has been changed
+// elsewhere since then isn't overwritten; they get a 412 Precondition Failed, fetch the
+// task again and apply their change to it. New tasks can't be created this way, because
+// a calendar object has no room for most of what a task needs, such as its category.
+func (app *application) caldavPutHandler(w http.ResponseWriter, r *http.Request) {
+	task, err := app.findCalendarObject(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusForbidden, "tasks can't be created over CalDAV, create them with POST /v1/tasks")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !caldavPreconditionsMet(r, caldavETag(task)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	cal, err := ical.Parse(http.MaxBytesReader(w, r.Body, maxCalendarObjectBytes))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	todo := cal.Component("VTODO")
+	if cal.Name != "VCALENDAR" || todo == nil {
+		app.badRequestResponse(w, r, errors.New("the calendar object must hold a VTODO"))
+		return
+	}
+	if uid := todo.Prop("UID"); uid == nil || uid.Value != calendarUID(task) {
+		app.badRequestResponse(w, r, errors.New("the UID of the VTODO doesn't match the task"))
+		return
+	}
+
+	previousStatus := task.Status
+	before := *task
+	err = applyCalendarTodo(task, todo, app.userLocation(app.contextGetUser(r)))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	err = app.validateTask(r.Context(), v, task)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if !app.checkStatusChange(w, r, task, previousStatus) {
+		return
+	}
+
+	err = app.models.Tasks.Update(r.Context(), task)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.publishTaskUpdate(task, previousStatus)
+	app.recordTaskUpdate(app.contextGetUser(r).ID, before, task)
+
+	w.Header().Set("ETag", caldavETag(task))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// The caldavDeleteHandler() deletes a task that was deleted in a calendar app, unless it
+// has changed since the version named in If-Match.
+func (app *application) caldavDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readCalendarObject(w, r)
+	if !ok {
+		return
+	}
+	if !caldavPreconditionsMet(r, caldavETag(task)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	err := app.models.Tasks.DeleteForWorkspace(r.Context(), task.ID, task.WorkspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.publishTaskEvent(task.WorkspaceID, data.EventTaskDeleted, map[string]int64{"id": task.ID})
+	app.recordAudit(app.contextGetUser(r).ID, data.AuditTask, task.ID, data.AuditDelete, task, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// The readPropfind() helper reads the body of a PROPFIND request, sending a 400 Bad
+// Request and returning false if it isn't valid.
+func (app *application) readPropfind(w http.ResponseWriter, r *http.Request) (*caldav.Propfind, bool) {
+	propfind, err := caldav.ReadPropfind(r.Body)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+	return propfind, true
+}
+
+// The writeMultistatus() helper sends a 207 Multi-Status response.
+func (app *application) writeMultistatus(w http.ResponseWriter, r *http.Request, responses []caldav.Response) {
+	err := caldav.WriteMultistatus(w, responses)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// The findCalendarObject() helper fetches the task named in the path of a calendar
+// object, from the calendar's workspace. Archived tasks aren't in the calendar, so they
+// are reported as ErrRecordNotFound, as are names that aren't task objects.
+func (app *application) findCalendarObject(r *http.Request) (*data.Task, error) {
+	id, ok := parseCalDAVObject(httprouter.ParamsFromContext(r.Context()).ByName("object"))
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+	task, err := app.models.Tasks.GetForWorkspace(r.Context(), id, app.contextGetWorkspace(r).WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Archived {
+		return nil, data.ErrRecordNotFound
+	}
+	return task, nil
+}
+
+// The readCalendarObject() helper is findCalendarObject() for handlers that send a 404 Not
+// Found for a missing task.
+func (app *application) readCalendarObject(w http.ResponseWriter, r *http.Request) (*data.Task, bool) {
+	task, err := app.findCalendarObject(r)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return task, true
+}
+
+// The calendarTasks() helper returns the tasks in the calendar of one workspace.
+func (app *application) calendarTasks(ctx context.Context, userID, workspaceID int64) ([]*data.Task, error) {
+	tasks, err := app.models.Tasks.GetAllForCalendar(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return tasksInWorkspace(tasks, workspaceID), nil
+}
+
+func tasksInWorkspace(tasks []*data.Task, workspaceID int64) []*data.Task {
+	filtered := []*data.Task{}
+	for _, task := range tasks {
+		if task.WorkspaceID == workspaceID {
+			filtered = append(filtered, task)
+		}
+	}
+	return filtered
+}
+
+// The canWriteTasks() helper reports whether the request may change tasks at all, going
+// by the user's and the API key's permissions. Whether it may in a given workspace also
+// depends on the user's role there.
+func (app *application) canWriteTasks(r *http.Request) (bool, error) {
+	if key := app.contextGetAPIKey(r); key != nil && !key.Permissions.Include("tasks:write") {
+		return false, nil
+	}
+	permissions, err := app.models.Permissions.GetAllForUser(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		return false, err
+	}
+	return permissions.Include("tasks:write"), nil
+}
+
+// calendarCollectionProps returns the properties of a workspace's calendar. Clients
+// compare the getctag to the one they saw last to tell whether anything in the calendar
+// has changed; it is a hash of the IDs and versions of the tasks in it.
+func calendarCollectionProps(workspace *data.Workspace, tasks []*data.Task, writable bool) []caldav.Prop {
+	hash := sha256.New()
+	for _, task := range tasks {
+		fmt.Fprintf(hash, "%d-%d,", task.ID, task.Version)
+	}
+
+	privileges := "<d:privilege><d:read/></d:privilege>"
+	if writable {
+		privileges += "<d:privilege><d:write-content/></d:privilege><d:privilege><d:unbind/></d:privilege>"
+	}
+
+	return []caldav.Prop{
+		caldav.Elements(caldav.DAV("resourcetype"), caldav.DAV("collection"), caldav.CalDAV("calendar")),
+		caldav.Text(caldav.DAV("displayname"), workspace.Name),
+		caldav.Href(caldav.DAV("current-user-principal"), caldavPrincipal),
+		caldav.Raw(caldav.DAV("current-user-privilege-set"), privileges),
+		caldav.Raw(caldav.CalDAV("supported-calendar-component-set"), `<c:comp name="VTODO"/>`),
+		caldav.Raw(caldav.DAV("supported-report-set"),
+			"<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>"+
+				"<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>"),
+		caldav.Text(xml.Name{Space: caldav.NamespaceCalendarServer, Local: "getctag"}, hex.EncodeToString(hash.Sum(nil)[:16])),
+	}
+}
+
+// The calendarObjectResponse() helper returns the properties of a task's calendar object.
+// Its calendar-data is only included when it is asked for by name, as RFC 4791 requires.
+func (app *application) calendarObjectResponse(task *data.Task, propfind *caldav.Propfind) caldav.Response {
+	props := []caldav.Prop{
+		caldav.Elements(caldav.DAV("resourcetype")),
+		caldav.Text(caldav.DAV("getetag"), caldavETag(task)),
+		caldav.Text(caldav.DAV("getcontenttype"), "text/calendar; charset=utf-8; component=vtodo"),
+	}
+	if !propfind.AllProp {
+		for _, name := range propfind.Props {
+			if name == caldav.CalDAV("calendar-data") {
+				props = append(props, caldav.Text(name, app.calendarObject(task)))
+				break
+			}
+		}
+	}
+
+	resp := caldav.Response{Href: caldavObjectPath(task)}
+	resp.Select(props, propfind)
+	return resp
+}
+
+// The calendarObject() helper renders a task as a VCALENDAR holding its VTODO.
+func (app *application) calendarObject(task *data.Task) string {
+	var b strings.Builder
+	cal := ical.NewWriter(&b)
+	beginCalendar(cal)
+	writeCalendarTask(cal, task, "todo", app.now())
+	cal.End("VCALENDAR")
+	// Writing to a strings.Builder can't fail.
+	_ = cal.Flush()
+	return b.String()
+}
+
+// caldavPreconditionsMet checks the If-Match and If-None-Match headers of a request
+// against the ETag of the task it is for.
+func caldavPreconditionsMet(r *http.Request, etag string) bool {
+	if header := r.Header.Get("If-Match"); header != "" && header != "*" && !etagListed(header, etag) {
+		return false
+	}
+	if header := r.Header.Get("If-None-Match"); header != "" && (header == "*" || etagListed(header, etag)) {
+		return false
+	}
+	return true
+}
+
+// etagListed reports whether a comma-separated list of ETags, as sent in If-Match,
+// includes etag. Weak ETags match too.
+func etagListed(list, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// applyCalendarTodo copies what a calendar app can change from a VTODO onto a task, the
+// reverse of writeCalendarTask(). A missing DUE clears the due date; other missing
+// properties leave the task's own, since a task can't be without them. A due date without
+// a time is midnight in the user's time zone.
+func applyCalendarTodo(task *data.Task, todo *ical.Component, loc *time.Location) error {
+	if p := todo.Prop("SUMMARY"); p != nil {
+		task.Title = ical.UnescapeText(p.Value)
+	}
+
+	if p := todo.Prop("DESCRIPTION"); p != nil {
+		task.Description = ical.UnescapeText(p.Value)
+	}
+
+	task.DueDate = data.CustomTime{}
+	if p := todo.Prop("DUE"); p != nil {
+		due, _, err := ical.ParseTime(p, loc)
+		if err != nil {
+			return fmt.Errorf("invalid DUE: %s", p.Value)
+		}
+		task.DueDate = data.CustomTime(due)
+	}
+
+	if p := todo.Prop("PRIORITY"); p != nil {
+		priority, err := strconv.Atoi(p.Value)
+		if err != nil || priority < 0 || priority > 9 {
+			return fmt.Errorf("invalid PRIORITY: %s", p.Value)
+		}
+		switch {
+		case priority == 0:
+			// 0 means the priority is undefined.
+		case priority <= 4:
+			task.Priority = data.PriorityHigh
+		case priority == 5:
+			task.Priority = data.PriorityMedium
+		default:
+			task.Priority = data.PriorityLow
+		}
+	}
+
+	status := ""
+	if p := todo.Prop("STATUS"); p != nil {
+		status = strings.ToUpper(p.Value)
+	} else if todo.Prop("COMPLETED") != nil {
+		// Some clients only set the time a to-do was completed.
+		status = "COMPLETED"
+	}
+	switch status {
+	case "NEEDS-ACTION":
+		task.Status = data.StatusTodo
+	case "IN-PROCESS":
+		task.Status = data.StatusInProgress
+	case "COMPLETED":
+		task.Status = data.StatusCompleted
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/ical"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// calendarTokenTTL is how long a calendar feed token stays valid. Calendar apps keep
+// polling a subscription URL indefinitely, so it is effectively permanent until rotated.
+const calendarTokenTTL = 10 * 365 * 24 * time.Hour
+
+// The createCalendarTokenHandler() issues a new feed token for the current user and
+// returns the subscription URL. Any previous token stops working.
+func (app *application) createCalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopeCalendar, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token, err := app.models.Tokens.New(r.Context(), user.ID, calendarTokenTTL, data.ScopeCalendar)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The token is only stored hashed, so this is the only time the URL can be shown.
+	err = app.writeJSON(w, http.StatusCreated, envelope{"calendar_token": token, "url": "/v1/tasks/calendar.ics?token=" + token.Plaintext}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteCalendarTokenHandler() revokes the current user's feed token.
+func (app *application) deleteCalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopeCalendar, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "calendar token successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The calendarFeedHandler() renders the user's tasks as an iCalendar feed. Calendar apps
+// can't send an Authorization header, so the user is identified by the feed token in the
+// ?token= parameter instead. By default each task is a VTODO; ?kind=event renders them as
+// VEVENTs at their due time instead, for apps (like Google Calendar) that ignore to-dos.
+func (app *application) calendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	token := qs.Get("token")
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+	user, err := app.models.Users.GetForToken(r.Context(), data.ScopeCalendar, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	kind := app.readString(qs, "kind", "todo")
+	v.Check(validator.In(kind, "todo", "event"), "kind", "must be todo or event")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tasks, err := app.models.Tasks.GetAllForCalendar(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="tasks.ics"`)
+
+	now := app.now()
+	cal := ical.NewWriter(w)
+	beginCalendar(cal)
+	cal.Text("X-WR-CALNAME", user.Name+"'s tasks")
+	for _, task := range tasks {
+		// An event needs a time to be shown at, which a task without a due date lacks.
+		if kind == "event" && task.DueDate.IsZero() {
+			continue
+		}
+		writeCalendarTask(cal, task, kind, now)
+	}
+	cal.End("VCALENDAR")
+
+	err = cal.Flush()
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// beginCalendar starts a VCALENDAR, with the properties every calendar object needs.
+func beginCalendar(cal *ical.Writer) {
+	cal.Begin("VCALENDAR")
+	cal.Prop("VERSION", "2.0")
+	cal.Prop("PRODID", "-//Taskninja//DoMake "+version+"//EN")
+	cal.Prop("CALSCALE", "GREGORIAN")
+}
+
+func writeCalendarTask(cal *ical.Writer, task *data.Task, kind string, now time.Time) {
+	component := "VTODO"
+	if kind == "event" {
+		component = "VEVENT"
+	}
+	due := time.Time(task.DueDate)
+
+	cal.Begin(component)
+	cal.Prop("UID", calendarUID(task))
+	cal.Time("DTSTAMP", now)
+	cal.Time("CREATED", time.Time(task.CreatedAt))
+	cal.Text("SUMMARY", task.Title)
+	if task.Description != "" {
+		cal.Text("DESCRIPTION", task.Description)
+	}
+	if task.Category != "" {
+		cal.Text("CATEGORIES", task.Category)
+	}
+	cal.Prop("PRIORITY", calendarPriority(task.Priority))
+	if component == "VTODO" {
+		if !due.IsZero() {
+			cal.Time("DUE", due)
+		}
+		cal.Prop("STATUS", calendarTodoStatus(task.Status))
+	} else {
+		// Events need a start; show the task as a short block ending at its due time.
+		cal.Time("DTSTART", due.Add(-30*time.Minute))
+		cal.Time("DTEND", due)
+		cal.Prop("TRANSP", "TRANSPARENT")
+	}
+	if task.Recurrence != "" {
+		cal.Prop("RRULE", strings.ToUpper(task.Recurrence))
+	}
+	cal.End(component)
+}
+
+// calendarUID returns the UID of a task's VTODO or VEVENT, which stays the same for as
+// long as the task exists.
+func calendarUID(task *data.Task) string {
+	return fmt.Sprintf("task-%d@domake", task.ID)
+}
+
+// calendarPriority maps a task priority to the iCalendar scale, where 1 is the highest.
+func calendarPriority(priority data.TaskPriority) string {
+	switch priority {
+	case data.PriorityHigh:
+		return "1"
+	case data.PriorityMedium:
+		return "5"
+	case data.PriorityLow:
+		return "9"
+	default:
+		return "0"
+	}
+}
+
+func calendarTodoStatus(status data.TaskStatus) string {
+	switch status {
+	case data.StatusInProgress:
+		return "IN-PROCESS"
+	case data.StatusCompleted:
+		return "COMPLETED"
+	default:
+		return "NEEDS-ACTION"
+	}
+}
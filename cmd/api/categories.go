@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/zarinakolybaeva/DoMake/internal/data"
 	"github.com/zarinakolybaeva/DoMake/internal/validator"
@@ -13,6 +15,7 @@ func (app *application) createCategoryHandler(w http.ResponseWriter, r *http.Req
 	var input struct {
 		Name        string `json:"name"`
 		Description string `json:"description"`
+		ParentID    *int64 `json:"parent_id"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -21,6 +24,8 @@ func (app *application) createCategoryHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	category := &data.Category{
+		WorkspaceID: app.contextGetWorkspace(r).WorkspaceID,
+		ParentID:    input.ParentID,
 		Name:        input.Name,
 		Description: input.Description,
 	}
@@ -30,13 +35,24 @@ func (app *application) createCategoryHandler(w http.ResponseWriter, r *http.Req
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	if !app.checkCategoryParent(w, r, v, category.WorkspaceID, category.ParentID) {
+		return
+	}
 
-	err = app.models.Categories.Insert(category)
+	err = app.models.Categories.Insert(r.Context(), category)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateCategory):
+			v.AddError("name", "a category with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
+	app.recordAudit(app.contextGetUser(r).ID, data.AuditCategory, category.ID, data.AuditCreate, nil, category)
+
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/categories/%d", category.ID))
 
@@ -53,7 +69,7 @@ func (app *application) showCategoryHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	category, err := app.models.Categories.Get(id)
+	category, err := app.models.Categories.Get(r.Context(), id, app.contextGetWorkspace(r).WorkspaceID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -64,7 +80,8 @@ func (app *application) showCategoryHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"category": category}, nil)
+	setLastModified(w, time.Time(category.UpdatedAt))
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"category": category}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -79,7 +96,7 @@ func (app *application) updateCategoryHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	// Retrieve the category record from the database.
-	category, err := app.models.Categories.Get(id)
+	category, err := app.models.Categories.Get(r.Context(), id, app.contextGetWorkspace(r).WorkspaceID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -103,7 +120,9 @@ func (app *application) updateCategoryHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// Update the category record with the new values if provided.
+	// Update the category record with the new values if provided, keeping a copy of the
+	// old record for the audit log.
+	before := *category
 	if input.Name != nil {
 		category.Name = *input.Name
 	}
@@ -119,12 +138,22 @@ func (app *application) updateCategoryHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	// Update the category record in the database.
-	err = app.models.Categories.Update(category)
+	err = app.models.Categories.Update(r.Context(), category)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateCategory):
+			v.AddError("name", "a category with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
+	app.recordAudit(app.contextGetUser(r).ID, data.AuditCategory, category.ID, data.AuditUpdate, &before, category)
+
 	// Write the updated category record in the response.
 	err = app.writeJSON(w, http.StatusOK, envelope{"category": category}, nil)
 	if err != nil {
@@ -140,18 +169,69 @@ func (app *application) deleteCategoryHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = app.models.Categories.Delete(id)
+	// The strategy parameter says what happens to the category's tasks: by default the
+	// deletion is refused while there are any, see data.CategoryModel.Delete().
+	v := validator.New()
+	qs := r.URL.Query()
+	strategy := app.readString(qs, "strategy", data.DeleteBlock)
+	target := app.readInt(qs, "reassign_to", 0, v)
+	v.Check(validator.In(strategy, data.DeleteStrategies...), "strategy", "must be one of "+strings.Join(data.DeleteStrategies, ", "))
+	if strategy == data.DeleteReassign {
+		v.Check(target > 0, "reassign_to", "must be provided when strategy is reassign")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Fetch the category first, so that the audit log can record what was deleted.
+	userID := app.contextGetUser(r).ID
+	workspaceID := app.contextGetWorkspace(r).WorkspaceID
+	category, err := app.models.Categories.Get(r.Context(), id, workspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	deletion, err := app.models.Categories.Delete(r.Context(), id, workspaceID, strategy, int64(target))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrCategoryInUse):
+			app.errorResponse(w, r, http.StatusConflict, "the category still has tasks, delete it with strategy=cascade or strategy=reassign")
+		case errors.Is(err, data.ErrInvalidReassignTarget):
+			v.AddError("reassign_to", "must be another one of your categories")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "category successfully deleted"}, nil)
+	app.recordAudit(userID, data.AuditCategory, category.ID, data.AuditDelete, category, nil)
+	for _, taskID := range deletion.DeletedTaskIDs {
+		app.publishTaskEvent(workspaceID, data.EventTaskDeleted, map[string]int64{"id": taskID})
+		app.recordAudit(userID, data.AuditTask, taskID, data.AuditDelete, nil, nil)
+	}
+	for _, task := range deletion.ReassignedTasks {
+		app.publishTaskUpdate(task, task.Status)
+		before := *task
+		before.CategoryID = category.ID
+		before.Category = category.Name
+		app.recordTaskUpdate(userID, before, task)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"message":          "category successfully deleted",
+		"tasks_deleted":    len(deletion.DeletedTaskIDs),
+		"tasks_reassigned": len(deletion.ReassignedTasks),
+	}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -189,6 +269,107 @@ func (app *application) listCategoriesHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Retrieve the current user's categories along with their task counts.
+	categories, metadata, err := app.models.Categories.GetAll(r.Context(), app.contextGetWorkspace(r).WorkspaceID, input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"categories": categories, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
 
+// The moveCategoryHandler puts a category under another one, or back at the top level
+// when parent_id is null.
+func (app *application) moveCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
 
+	userID := app.contextGetUser(r).ID
+	workspaceID := app.contextGetWorkspace(r).WorkspaceID
+	category, err := app.models.Categories.Get(r.Context(), id, workspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		ParentID *int64 `json:"parent_id"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if !app.checkCategoryParent(w, r, v, workspaceID, input.ParentID) {
+		return
+	}
+
+	before := *category
+	err = app.models.Categories.Move(r.Context(), category, input.ParentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrCategoryCycle):
+			v.AddError("parent_id", "must not be the category itself or one of its subcategories")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.recordAudit(userID, data.AuditCategory, category.ID, data.AuditUpdate, &before, category)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"category": category}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The categoryTreeHandler returns all of the workspace's categories nested under their parents.
+func (app *application) categoryTreeHandler(w http.ResponseWriter, r *http.Request) {
+	tree, err := app.models.Categories.GetTree(r.Context(), app.contextGetWorkspace(r).WorkspaceID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"categories": tree}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The checkCategoryParent() helper makes sure that a requested parent category belongs to
+// the workspace. It sends a 422 response and returns false if it doesn't.
+func (app *application) checkCategoryParent(w http.ResponseWriter, r *http.Request, v *validator.Validator, workspaceID int64, parentID *int64) bool {
+	if parentID == nil {
+		return true
+	}
+	_, err := app.models.Categories.Get(r.Context(), *parentID, workspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("parent_id", "must be one of your categories")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+	return true
 }
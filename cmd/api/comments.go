@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Body     string `json:"body"`
+		ParentID *int64 `json:"parent_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment := &data.Comment{
+		TaskID:   task.ID,
+		UserID:   app.contextGetUser(r).ID,
+		ParentID: input.ParentID,
+		Body:     input.Body,
+	}
+
+	v := validator.New()
+	data.ValidateComment(v, comment)
+
+	// A reply must point at a comment on the same task.
+	var parent *data.Comment
+	if input.ParentID != nil {
+		parent, err = app.models.Comments.Get(r.Context(), *input.ParentID, task.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("parent_id", "must refer to a comment on the same task")
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Comments.Insert(r.Context(), comment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.notifyComment(app.contextGetUser(r), task, parent, comment)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tasks/%d/comments/%d", task.ID, comment.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"comment": comment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The notifyComment() helper lets the owner of a task know that someone commented on it,
+// and the author of the comment being replied to that someone replied. Nobody is notified
+// of their own comments, or twice about the same one.
+func (app *application) notifyComment(author *data.User, task *data.Task, parent, comment *data.Comment) {
+	notified := map[int64]bool{author.ID: true}
+	if parent != nil && !notified[parent.UserID] {
+		notified[parent.UserID] = true
+		app.notify(&data.Notification{
+			UserID:    parent.UserID,
+			Kind:      data.NotificationReply,
+			Message:   fmt.Sprintf("%s replied to your comment on %q", author.Name, task.Title),
+			TaskID:    &task.ID,
+			CommentID: &comment.ID,
+		})
+	}
+	if !notified[task.UserID] {
+		app.notify(&data.Notification{
+			UserID:    task.UserID,
+			Kind:      data.NotificationComment,
+			Message:   fmt.Sprintf("%s commented on %q", author.Name, task.Title),
+			TaskID:    &task.ID,
+			CommentID: &comment.ID,
+		})
+	}
+}
+
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	comments, metadata, ok := app.readComments(w, r, task)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"comments": comments, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readComments() helper fetches the page of a task's comments asked for in the query
+// string, rendering their bodies as HTML too with ?render=html. It is shared with the
+// public view of shared tasks. If anything goes wrong it sends the error response itself
+// and returns false.
+func (app *application) readComments(w http.ResponseWriter, r *http.Request, task *data.Task) ([]*data.Comment, data.Metadata, bool) {
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	render := app.readRender(qs, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "created_at")
+	input.Filters.SortSafelist = []string{"id", "created_at", "-id", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, data.Metadata{}, false
+	}
+
+	comments, metadata, err := app.models.Comments.GetAllForTask(r.Context(), task.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, data.Metadata{}, false
+	}
+	if render {
+		for _, comment := range comments {
+			comment.RenderBody()
+		}
+	}
+	return comments, metadata, true
+}
+
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readAuthoredComment(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Body *string `json:"body"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Nothing to change, so don't record an empty edit.
+	if input.Body == nil || *input.Body == comment.Body {
+		err = app.writeJSON(w, http.StatusOK, envelope{"comment": comment}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	previousBody := comment.Body
+	comment.Body = *input.Body
+
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Comments.Update(r.Context(), comment, previousBody)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"comment": comment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readAuthoredComment(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Comments.Delete(r.Context(), comment.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "comment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showCommentHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readComment(w, r)
+	if !ok {
+		return
+	}
+
+	v := validator.New()
+	render := app.readRender(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	edits, err := app.models.Comments.GetHistory(r.Context(), comment.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if render {
+		comment.RenderBody()
+		for i := range edits {
+			edits[i].RenderBody()
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"comment": comment, "history": edits}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readComment() helper fetches the comment identified by the :comment_id URL parameter
+// on the task identified by :id, sending an error response and returning false on failure.
+func (app *application) readComment(w http.ResponseWriter, r *http.Request) (*data.Comment, bool) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := app.readNamedIDParam(r, "comment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	comment, err := app.models.Comments.Get(r.Context(), id, task.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return comment, true
+}
+
+// The readAuthoredComment() helper works like readComment(), but additionally requires the
+// current user to be the author, since only authors may edit or delete their comments.
+func (app *application) readAuthoredComment(w http.ResponseWriter, r *http.Request) (*data.Comment, bool) {
+	comment, ok := app.readComment(w, r)
+	if !ok {
+		return nil, false
+	}
+	if comment.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponses(w, r)
+		return nil, false
+	}
+	return comment, true
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressibleTypes are the media types of the responses that compressResponses()
+// compresses: the JSON sent by most endpoints, and the other formats that writeResponse()
+// can produce instead of it.
+var compressibleTypes = []string{"application/json", "application/xml", "text/xml", "text/csv"}
+
+// brotliLevel is the quality responses are compressed with by brotli. The higher levels
+// compress a little better but take far longer, which only pays for content that is
+// compressed once and served many times.
+const brotliLevel = 4
+
+// encoder is what gzip and brotli writers have in common.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoders keep the writers for each content coding for reuse, since each one allocates a
+// sizable buffer.
+var encoders = map[string]*sync.Pool{
+	"br": {
+		New: func() interface{} {
+			return brotli.NewWriterLevel(io.Discard, brotliLevel)
+		},
+	},
+	"gzip": {
+		New: func() interface{} {
+			return gzip.NewWriter(io.Discard)
+		},
+	},
+}
+
+// The compressResponses() middleware compresses responses for clients that accept it,
+// with brotli or gzip, which makes a big difference to the large lists and exports sent
+// to mobile clients on slow links. Only the formats in compressibleTypes are compressed, and only once they are at
+// least -compression-min-size bytes long, since compressing a small response saves less
+// than it costs.
+func (app *application) compressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !app.config.compression.enabled || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		coding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if coding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, minSize: app.config.compression.minSize, coding: coding}
+		defer func() {
+			err := cw.close()
+			if err != nil {
+				app.logError(r, err)
+			}
+		}()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding returns the content coding to compress a response with, given the
+// request's Accept-Encoding header: "br" or "gzip", whichever has the higher quality, or
+// "" if neither is acceptable. A coding can be named or accepted through a wildcard, and
+// a quality given for the coding itself takes precedence over the wildcard's. Brotli wins
+// a tie, since it compresses JSON better.
+func negotiateEncoding(header string) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		quality := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				q, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					q = 0
+				}
+				quality = q
+			}
+		}
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+		qualities[coding] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, coding := range []string{"br", "gzip"} {
+		quality, ok := qualities[coding]
+		if !ok {
+			quality = qualities["*"]
+		}
+		if quality > bestQuality {
+			best, bestQuality = coding, quality
+		}
+	}
+	return best
+}
+
+// compressWriter compresses a response on its way to the client, with the content coding
+// given. Until minSize bytes have been written it holds the status and the body back, and
+// a response that ends before then is sent as it is. Responses of other types, or which are already encoded, are passed
+// through untouched as soon as their status is written.
+type compressWriter struct {
+	http.ResponseWriter
+	minSize int
+	coding  string
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status != 0 || cw.decided {
+		return
+	}
+	// Informational responses, such as 103 Early Hints, don't end the headers.
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+	if !cw.compressible() {
+		cw.passThrough()
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case cw.enc != nil:
+		return cw.enc.Write(b)
+	case cw.decided:
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf.Write(b)
+	if cw.buf.Len() < cw.minSize {
+		return len(b), nil
+	}
+	err := cw.startEncoding()
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush sends whatever has been written so far, compressed or not depending on how much
+// there is of it.
+func (cw *compressWriter) Flush() {
+	if cw.status != 0 && !cw.decided {
+		if cw.buf.Len() >= cw.minSize {
+			cw.startEncoding()
+		} else {
+			cw.passThrough()
+		}
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressible reports whether the response can be compressed, going by its status and
+// the headers set so far.
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	if cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, compressible := range compressibleTypes {
+		if mediaType == compressible {
+			return true
+		}
+	}
+	return false
+}
+
+// passThrough sends the response uncompressed, starting with anything held back so far.
+func (cw *compressWriter) passThrough() error {
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := cw.ResponseWriter.Write(cw.buf.Bytes())
+	cw.buf.Reset()
+	return err
+}
+
+// startEncoding sends the headers for a compressed response, followed by the compressed
+// form of anything held back so far.
+func (cw *compressWriter) startEncoding() error {
+	cw.decided = true
+	h := cw.Header()
+	h.Set("Content-Encoding", cw.coding)
+	// The length set by the handler, if any, is that of the uncompressed body.
+	h.Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	cw.enc = encoders[cw.coding].Get().(encoder)
+	cw.enc.Reset(cw.ResponseWriter)
+	_, err := cw.enc.Write(cw.buf.Bytes())
+	cw.buf.Reset()
+	return err
+}
+
+// close finishes the response once the handler has returned, sending a short response
+// that was held back or the end of the compressed stream.
+func (cw *compressWriter) close() error {
+	switch {
+	case cw.enc != nil:
+		err := cw.enc.Close()
+		encoders[cw.coding].Put(cw.enc)
+		cw.enc = nil
+		return err
+	case cw.status != 0 && !cw.decided:
+		return cw.passThrough()
+	}
+	return nil
+}
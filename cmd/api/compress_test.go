@@ -0,0 +1,89 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"x-gzip", "gzip"},
+		{"br", "br"},
+		{"gzip, deflate, br", "br"},
+		{"GZIP, BR", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br, gzip;q=0.9", "br"},
+		{"br;q=0, gzip", "gzip"},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.5, gzip", "gzip"},
+		{"*, br;q=0", "gzip"},
+		{"*;q=0", ""},
+		{"gzip;q=bad", ""},
+	}
+	for _, tt := range tests {
+		got := negotiateEncoding(tt.header)
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.compression.enabled = true
+	app.config.compression.minSize = 1024
+
+	body := `{"tasks": [` + strings.Repeat(`{"title": "Write the report"},`, 100) + `{}]}`
+	handler := app.compressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+
+	tests := []struct {
+		acceptEncoding string
+		want           string
+		decode         func(io.Reader) (io.Reader, error)
+	}{
+		{"", "", func(r io.Reader) (io.Reader, error) { return r, nil }},
+		{"gzip", "gzip", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"gzip, br", "br", func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/tasks", nil)
+		r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if got := w.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("%q: got Content-Encoding %q, want %q", tt.acceptEncoding, got, tt.want)
+			continue
+		}
+		if tt.want != "" && w.Body.Len() >= len(body) {
+			t.Errorf("%q: got %d bytes, want fewer than %d", tt.acceptEncoding, w.Body.Len(), len(body))
+		}
+		decoded, err := tt.decode(w.Body)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.acceptEncoding, err)
+		}
+		got, err := io.ReadAll(decoded)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.acceptEncoding, err)
+		}
+		if string(got) != body {
+			t.Errorf("%q: got body %q, want %q", tt.acceptEncoding, got, body)
+		}
+	}
+}
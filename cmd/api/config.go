@@ -0,0 +1,256 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/configfile"
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// envPrefix is the prefix of the environment variables which set flags: the flag
+// -db-max-open-conns is set by DOMAKE_DB_MAX_OPEN_CONNS, for example.
+const envPrefix = "DOMAKE_"
+
+// The applyConfigSources() function fills in the flags that weren't given on the command
+// line from the environment, and then from the settings file at path (if any). Flags take
+// precedence over environment variables, which take precedence over the file. It must be
+// called after flag.Parse().
+func applyConfigSources(path string) error {
+	var file map[string]string
+	if path != "" {
+		var err error
+		file, err = configfile.ParseFile(path)
+		if err != nil {
+			return err
+		}
+	}
+	for name := range file {
+		if flag.Lookup(name) == nil || name == "config" || name == "print-config" {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] {
+			return
+		}
+		if value, found := os.LookupEnv(envName(f.Name)); found {
+			if setErr := f.Value.Set(value); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %w", value, envName(f.Name), setErr)
+			}
+			return
+		}
+		if value, found := file[f.Name]; found {
+			if setErr := f.Value.Set(value); setErr != nil {
+				err = fmt.Errorf("%s: invalid value %q for %s: %w", path, value, f.Name, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// The envName() helper returns the environment variable for a flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// The validateConfig() function checks the merged configuration, so that mistakes are
+// reported at startup rather than when the setting is first used. Errors are keyed by
+// flag name.
+func validateConfig(v *validator.Validator, cfg config) {
+	v.Check(cfg.port > 0 && cfg.port <= 65535, "port", "must be between 1 and 65535")
+	if cfg.listen.addr != "" && cfg.listen.addr != listenSystemd {
+		path, ok := strings.CutPrefix(cfg.listen.addr, "unix:")
+		v.Check(ok && filepath.IsAbs(path), "listen", "must be unix:/path/to/socket or systemd")
+	}
+	_, err := parseTrustedProxies(cfg.listen.trustedProxies)
+	v.Check(err == nil, "trusted-proxies", "must be a list of IP addresses or CIDR ranges such as 10.0.0.0/8")
+	v.Check(validator.In(cfg.env, "development", "staging", "production"), "env", "must be one of development, staging or production")
+	v.Check(cfg.shutdownTimeout > 0, "shutdown-timeout", "must be greater than zero")
+	v.Check(validator.In(cfg.timeFormat, data.TimeFormats...), "time-format", "must be one of "+strings.Join(data.TimeFormats, ", "))
+
+	v.Check(validator.In(cfg.db.driver, data.Drivers...), "db-driver", "must be one of "+strings.Join(data.Drivers, ", "))
+	v.Check(cfg.db.dsn != "", "db-dsn", "must be provided")
+	v.Check(cfg.db.maxOpenConns >= 0, "db-max-open-conns", "must not be negative")
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", "must not be negative")
+	_, err = time.ParseDuration(cfg.db.maxIdleTime)
+	v.Check(err == nil, "db-max-idle-time", "must be a duration such as 15m")
+	v.Check(cfg.db.queryTimeout > 0, "db-query-timeout", "must be greater than zero")
+	v.Check(cfg.db.maxLifetime >= 0, "db-max-lifetime", "must not be negative")
+	v.Check(cfg.db.connectTimeout >= 0, "db-connect-timeout", "must not be negative")
+
+	v.Check(validator.In(cfg.limiter.backend, "memory", "redis"), "limiter-backend", "must be one of memory or redis")
+	if cfg.limiter.enabled {
+		v.Check(cfg.limiter.rps > 0, "limiter-rps", "must be greater than zero")
+		v.Check(cfg.limiter.burst > 0, "limiter-burst", "must be greater than zero")
+		v.Check(cfg.limiter.writeRPS > 0, "limiter-write-rps", "must be greater than zero")
+		v.Check(cfg.limiter.writeBurst > 0, "limiter-write-burst", "must be greater than zero")
+	}
+	v.Check(validator.In(cfg.cache.backend, "none", "memory", "redis"), "cache-backend", "must be one of none, memory or redis")
+	if cfg.cache.backend != "none" {
+		v.Check(cfg.cache.ttl > 0, "cache-ttl", "must be greater than zero")
+	}
+	if cfg.cache.backend == "memory" {
+		v.Check(cfg.cache.size > 0, "cache-size", "must be greater than zero")
+	}
+
+	v.Check(validator.In(cfg.mail.backend, mailBackends...), "mail-backend", "must be one of "+strings.Join(mailBackends, ", "))
+	switch cfg.mail.backend {
+	case "smtp":
+		if cfg.smtp.host != "" {
+			v.Check(cfg.smtp.port > 0 && cfg.smtp.port <= 65535, "smtp-port", "must be between 1 and 65535")
+		}
+	case "sendgrid":
+		v.Check(cfg.mail.sendgrid.apiKey != "", "sendgrid-api-key", "must be provided")
+	case "ses":
+		v.Check(cfg.mail.ses.region != "", "ses-region", "must be provided")
+		v.Check(cfg.mail.ses.accessKeyID != "", "ses-access-key-id", "must be provided")
+		v.Check(cfg.mail.ses.secretAccessKey != "", "ses-secret-access-key", "must be provided")
+	}
+	if cfg.mail.backend != "log" {
+		v.Check(cfg.mail.sender != "", "mail-sender", "must be provided")
+	}
+	v.Check(cfg.mail.interval > 0, "mail-interval", "must be greater than zero")
+	v.Check(cfg.filters.maxValues > 0, "filters-max-values", "must be greater than zero")
+	v.Check(cfg.filters.maxIDs > 0, "filters-max-ids", "must be greater than zero")
+	v.Check(cfg.search.similarity >= 0 && cfg.search.similarity <= 1, "search-similarity", "must be between 0 and 1")
+	v.Check(validator.In(cfg.search.engine, searchEngines...), "search-engine", "must be one of "+strings.Join(searchEngines, ", "))
+	if cfg.search.engine != "none" {
+		v.Check(cfg.search.url != "", "search-engine-url", "must be provided")
+		v.Check(cfg.search.index != "", "search-engine-index", "must be provided")
+	}
+	v.Check(cfg.compression.minSize >= 0, "compression-min-size", "must not be negative")
+	v.Check(cfg.security.hstsMaxAge >= 0, "hsts-max-age", "must not be negative")
+	v.Check(cfg.security.maxBodyBytes > 0, "max-body-bytes", "must be greater than zero")
+	v.Check(cfg.security.maxHeaderBytes > 0, "max-header-bytes", "must be greater than zero")
+	v.Check(cfg.security.maxHeaderCount > 0, "max-header-count", "must be greater than zero")
+
+	v.Check(cfg.recurrence.interval > 0, "recurrence-interval", "must be greater than zero")
+	v.Check(cfg.reminders.interval > 0, "reminders-interval", "must be greater than zero")
+	v.Check(cfg.digest.interval > 0, "digest-interval", "must be greater than zero")
+	v.Check(cfg.digest.hour >= 0 && cfg.digest.hour <= 23, "digest-hour", "must be between 0 and 23")
+	v.Check(cfg.webhooks.interval > 0, "webhooks-interval", "must be greater than zero")
+	v.Check(validator.In(cfg.attachments.scanner, attachmentScanners...), "attachments-scanner", "must be one of "+strings.Join(attachmentScanners, ", "))
+	switch cfg.attachments.scanner {
+	case "clamav":
+		v.Check(cfg.attachments.clamavAddr != "", "attachments-clamav-addr", "must be provided")
+	case "http":
+		u, err := url.Parse(cfg.attachments.scannerURL)
+		v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "attachments-scanner-url", "must be an http or https URL")
+	}
+	v.Check(cfg.attachments.scanTimeout > 0, "attachments-scan-timeout", "must be greater than zero")
+	v.Check(cfg.attachments.scanInterval > 0, "attachments-scan-interval", "must be greater than zero")
+	v.Check(cfg.idempotency.ttl > 0, "idempotency-ttl", "must be greater than zero")
+	if cfg.api.v1Sunset != "" {
+		_, err := time.Parse("2006-01-02", cfg.api.v1Sunset)
+		v.Check(err == nil, "v1-sunset", "must be a date such as 2027-06-30")
+	}
+
+	if cfg.login.enabled {
+		v.Check(cfg.login.maxFailures > 0, "login-max-failures", "must be greater than zero")
+		v.Check(cfg.login.ipMaxFailures > 0, "login-ip-max-failures", "must be greater than zero")
+		v.Check(cfg.login.lockout > 0, "login-lockout", "must be greater than zero")
+	}
+	if cfg.jwt.secret != "" {
+		v.Check(len(cfg.jwt.secret) >= 32, "jwt-secret", "must be at least 32 bytes long")
+		v.Check(cfg.jwt.accessTTL > 0, "jwt-access-ttl", "must be greater than zero")
+		v.Check(cfg.jwt.refreshTTL > cfg.jwt.accessTTL, "jwt-refresh-ttl", "must be longer than jwt-access-ttl")
+	}
+	v.Check(cfg.otel.sampleRatio >= 0 && cfg.otel.sampleRatio <= 1, "otel-sample-ratio", "must be between 0 and 1")
+
+	for _, origin := range cfg.cors.trustedOrigins {
+		u, err := url.Parse(origin)
+		valid := err == nil && u.Scheme != "" && u.Host != "" && u.Path == "" && u.RawQuery == ""
+		// A wildcard can only stand for the subdomains, at the start of the host.
+		valid = valid && !strings.Contains(strings.TrimPrefix(u.Host, "*."), "*")
+		v.Check(valid, "cors-trusted-origins", "must be a list of origins such as https://example.com or https://*.example.com")
+	}
+	for _, method := range cfg.cors.allowedMethods {
+		v.Check(corsTokenRX.MatchString(method) && method == strings.ToUpper(method), "cors-allowed-methods", "must be a list of methods such as GET POST")
+	}
+	for _, header := range cfg.cors.allowedHeaders {
+		v.Check(corsTokenRX.MatchString(header), "cors-allowed-headers", "must be a list of header names such as Authorization Content-Type")
+	}
+	v.Check(cfg.cors.maxAge >= 0, "cors-max-age", "must not be negative")
+
+	v.Check((cfg.tls.certFile == "") == (cfg.tls.keyFile == ""), "tls-key", "must be provided with tls-cert")
+	v.Check(cfg.tls.certFile == "" || len(cfg.tls.domains) == 0, "tls-domains", "must not be provided with tls-cert")
+	for _, domain := range cfg.tls.domains {
+		v.Check(tlsDomainRX.MatchString(domain), "tls-domains", "must be a list of domain names such as api.example.com")
+	}
+	if len(cfg.tls.domains) > 0 {
+		v.Check(cfg.tls.cacheDir != "", "tls-cache-dir", "must be provided")
+	}
+	v.Check(cfg.maintenance.retryAfter >= time.Second, "maintenance-retry-after", "must be at least 1s")
+	v.Check(cfg.tls.email == "" || validator.Matches(cfg.tls.email, validator.EmailRX), "tls-email", "must be a valid email address")
+	v.Check(cfg.tls.redirectPort >= 0 && cfg.tls.redirectPort <= 65535, "tls-redirect-port", "must be between 0 and 65535")
+	v.Check(cfg.tls.redirectPort != cfg.port, "tls-redirect-port", "must not be the same as port")
+	if cfg.tls.certFile == "" && len(cfg.tls.domains) == 0 {
+		v.Check(cfg.tls.redirectPort == 0, "tls-redirect-port", "must only be provided with tls-cert or tls-domains")
+	}
+}
+
+// The printConfig() function writes the value of every flag, in the settings file format,
+// with secrets redacted. The output can be used as a starting point for a settings file.
+func printConfig(w io.Writer, cfg config) {
+	var lines []string
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch f.Name {
+		case "config", "print-config":
+			return
+		case "cors-trusted-origins":
+			// Flags defined with flag.Func() don't keep their value.
+			value = strings.Join(cfg.cors.trustedOrigins, " ")
+		case "cors-allowed-methods":
+			value = strings.Join(cfg.cors.allowedMethods, " ")
+		case "cors-allowed-headers":
+			value = strings.Join(cfg.cors.allowedHeaders, " ")
+		case "tls-domains":
+			value = strings.Join(cfg.tls.domains, " ")
+		case "trusted-proxies":
+			value = strings.Join(cfg.listen.trustedProxies, " ")
+		case "listen-socket-mode":
+			value = fmt.Sprintf("%04o", cfg.listen.socketMode)
+		}
+		lines = append(lines, f.Name+": "+strconv.Quote(redactSetting(f.Name, value)))
+	})
+	sort.Strings(lines)
+	fmt.Fprintln(w, strings.Join(lines, "\n"))
+}
+
+// The redactSetting() helper hides secret values: passwords, API keys and any setting
+// with "secret" in its name, such as ses-secret-access-key. Passwords in the database DSN
+// are hidden, leaving the rest of it readable.
+func redactSetting(name, value string) string {
+	switch {
+	case value == "":
+		return ""
+	case name == "db-dsn":
+		// DSNs in the key=value form can't be picked apart, so they are hidden whole.
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" {
+			return "REDACTED"
+		}
+		return u.Redacted()
+	case strings.HasSuffix(name, "password"), strings.Contains(name, "secret"), strings.HasSuffix(name, "api-key"), name == "otel-headers":
+		return "REDACTED"
+	}
+	return value
+}
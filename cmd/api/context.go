@@ -33,3 +33,53 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// apiKeyContextKey is the key for the API key that authenticated the request, if any.
+const apiKeyContextKey = contextKey("api_key")
+
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// The contextGetAPIKey() retrieves the API key that authenticated the request. Unlike the
+// user it is optional, so it returns nil when the request didn't use one.
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+// sessionContextKey is the key for the ID of the session that the request's
+// authentication token belongs to.
+const sessionContextKey = contextKey("session")
+
+func (app *application) contextSetSession(r *http.Request, id int64) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// The contextGetSession() retrieves the current session's ID. It is 0 for requests that
+// weren't made with an authentication token.
+func (app *application) contextGetSession(r *http.Request) int64 {
+	id, _ := r.Context().Value(sessionContextKey).(int64)
+	return id
+}
+
+// workspaceContextKey is the key for the current user's membership of the workspace
+// that the request is for, see requireWorkspaceRole().
+const workspaceContextKey = contextKey("workspace")
+
+func (app *application) contextSetWorkspace(r *http.Request, member *data.Member) *http.Request {
+	ctx := context.WithValue(r.Context(), workspaceContextKey, member)
+	return r.WithContext(ctx)
+}
+
+// The contextGetWorkspace() retrieves the membership added by requireWorkspaceRole().
+// Like contextGetUser(), a missing value is a programming error, so it panics.
+func (app *application) contextGetWorkspace(r *http.Request) *data.Member {
+	member, ok := r.Context().Value(workspaceContextKey).(*data.Member)
+	if !ok {
+		panic("missing workspace value in request context")
+	}
+	return member
+}
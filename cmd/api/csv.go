@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// Define the limits for CSV imports.
+const (
+	maxImportBytes = 10 << 20
+	maxImportRows  = 1000
+)
+
+// taskCSVColumns are the columns written by the export, in order. The import understands
+// the same names, so an export can be imported again as it is.
+var taskCSVColumns = []string{"id", "title", "description", "due_date", "priority", "status", "category", "recurrence", "archived", "created_at"}
+
+// importFields are the task fields that an imported column can be mapped to.
+var importFields = []string{"title", "description", "due_date", "priority", "status", "category", "recurrence"}
+
+// The exportTasksHandler() streams all of the current user's tasks as a CSV file, or as a
+// JSON document with ?format=json.
+func (app *application) exportTasksHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	format := app.readString(r.URL.Query(), "format", "csv")
+	if v.Check(validator.In(format, "csv", "json"), "format", "must be csv or json"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if format == "json" {
+		app.exportTasksJSON(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="tasks.csv"`)
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(taskCSVColumns)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	err = app.models.Tasks.ForEachForWorkspace(r.Context(), app.contextGetWorkspace(r).WorkspaceID, func(task *data.Task) error {
+		task = app.localTask(user, task)
+		return cw.Write([]string{
+			strconv.FormatInt(task.ID, 10),
+			task.Title,
+			task.Description,
+			formatCSVTime(task.DueDate),
+			string(task.Priority),
+			string(task.Status),
+			task.Category,
+			task.Recurrence,
+			strconv.FormatBool(task.Archived),
+			time.Time(task.CreatedAt).Format(time.RFC3339),
+		})
+	})
+	if err == nil {
+		cw.Flush()
+		err = cw.Error()
+	}
+	// The status line has already been sent, so all we can do is log the problem; the
+	// client will see a truncated file.
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// formatCSVTime writes a time for the CSV export, leaving the cell empty if there is none,
+// as for a task without a due date.
+func formatCSVTime(t data.CustomTime) string {
+	if t.IsZero() {
+		return ""
+	}
+	return time.Time(t).Format(time.RFC3339)
+}
+
+// The exportTasksJSON() helper streams all of the current user's tasks as a JSON document,
+// writing each task as its row is read, so that a large export doesn't have to fit in memory.
+func (app *application) exportTasksJSON(w http.ResponseWriter, r *http.Request) {
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", `attachment; filename="tasks.json"`)
+	stream := app.newJSONStream(w, http.StatusOK, "tasks", headers)
+
+	user := app.contextGetUser(r)
+	err := app.models.Tasks.ForEachForWorkspace(r.Context(), app.contextGetWorkspace(r).WorkspaceID, func(task *data.Task) error {
+		return stream.write(app.localTask(user, task))
+	})
+	if err == nil {
+		err = stream.close(nil)
+	}
+	if err != nil {
+		// As with the CSV export, once the status line has been sent all we can do is log
+		// the problem.
+		if stream.started() {
+			app.logError(r, err)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importRowError reports the problems with one row of an import. Row is the line number
+// in the file, counting the header as line 1.
+type importRowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+// The importTasksHandler() creates tasks from an uploaded CSV file. The file is sent either
+// as the "file" field of a multipart form, or as the raw request body. Two further options
+// can be given as form fields or query string parameters:
+//
+//   - mapping: a JSON object from CSV column names to task fields, e.g.
+//     {"Name": "title", "Deadline": "due_date"}. Columns are otherwise matched by name,
+//     and columns that don't match any field are ignored.
+//   - mode: "atomic" (the default) imports nothing if any row is invalid, while
+//     "best_effort" imports the valid rows and reports the others.
+func (app *application) importTasksHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	var file io.Reader = r.Body
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err := r.ParseMultipartForm(maxImportBytes)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New(`the form must contain a "file" field`))
+			return
+		}
+		defer f.Close()
+		file = f
+	}
+
+	v := validator.New()
+	mode := r.FormValue("mode")
+	if mode == "" {
+		mode = "atomic"
+	}
+	v.Check(validator.In(mode, "atomic", "best_effort"), "mode", "must be atomic or best_effort")
+
+	mapping := map[string]string{}
+	if s := r.FormValue("mapping"); s != "" {
+		err := json.Unmarshal([]byte(s), &mapping)
+		if err != nil {
+			v.AddError("mapping", "must be a JSON object of column names to task fields")
+		}
+		for _, field := range mapping {
+			v.Check(validator.In(field, importFields...), "mapping", "must only map to "+strings.Join(importFields, ", "))
+		}
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	userID := user.ID
+	tasks, rowErrors, err := app.readImportCSV(r.Context(), file, mapping, userID, app.contextGetWorkspace(r).WorkspaceID, app.userLocation(user))
+	if err != nil {
+		var fileErr *importFileError
+		switch {
+		case errors.As(err, &fileErr):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// In atomic mode a single bad row stops the whole import before anything is written.
+	if mode == "atomic" && len(rowErrors) > 0 {
+		err = app.writeJSON(w, http.StatusUnprocessableEntity, envelope{"imported": 0, "errors": rowErrors}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tasks.InTx(r.Context(), func(tx data.TaskTx) error {
+		for _, task := range tasks {
+			err := tx.Insert(task)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, task := range tasks {
+		app.publishTaskEvent(task.WorkspaceID, data.EventTaskCreated, task)
+		app.recordAudit(userID, data.AuditTask, task.ID, data.AuditCreate, nil, task)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"imported": len(tasks), "errors": rowErrors}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importFileError describes a problem with an import file as a whole, as opposed to an
+// error reading the database while checking its rows.
+type importFileError struct {
+	err error
+}
+
+func (e *importFileError) Error() string {
+	return e.err.Error()
+}
+
+// The readImportCSV() method parses an import file into tasks ready to insert, along with
+// the validation errors of the rows that can't be imported. Due dates without an offset
+// are read in the time zone loc. An *importFileError is returned if the file itself can't
+// be read.
+func (app *application) readImportCSV(ctx context.Context, file io.Reader, mapping map[string]string, userID, workspaceID int64, loc *time.Location) ([]*data.Task, []importRowError, error) {
+	cr := csv.NewReader(file)
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, &importFileError{errors.New("the file is empty")}
+		}
+		return nil, nil, &importFileError{fmt.Errorf("the file is not valid CSV: %w", err)}
+	}
+	// Spreadsheets often save a byte order mark, which would end up in the first name.
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	// Work out which field each column holds.
+	columns := make([]string, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if field, ok := mapping[name]; ok {
+			columns[i] = field
+		} else if validator.In(strings.ToLower(name), importFields...) {
+			columns[i] = strings.ToLower(name)
+		}
+	}
+
+	tasks := []*data.Task{}
+	rowErrors := []importRowError{}
+	for row := 2; ; row++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, &importFileError{fmt.Errorf("the file is not valid CSV: %w", err)}
+		}
+		if row-1 > maxImportRows {
+			return nil, nil, &importFileError{fmt.Errorf("the file must not contain more than %d rows", maxImportRows)}
+		}
+
+		// Tasks without a status or priority column get the same defaults a
+		// client would most likely pick.
+		task := &data.Task{UserID: userID, WorkspaceID: workspaceID, Status: data.StatusTodo, Priority: data.PriorityMedium}
+		v := validator.New()
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if columns[i] == "" || value == "" {
+				continue
+			}
+			switch columns[i] {
+			case "title":
+				task.Title = value
+			case "description":
+				task.Description = value
+			case "due_date":
+				t, ok := app.parseTime(value, loc)
+				v.Check(ok, "due_date", "must be a date (2006-01-02) or RFC 3339 timestamp")
+				task.DueDate = data.CustomTime(t)
+			case "priority":
+				task.Priority = data.TaskPriority(strings.ToLower(value))
+			case "status":
+				task.Status = data.TaskStatus(strings.ToLower(value))
+			case "category":
+				task.Category = value
+			case "recurrence":
+				task.Recurrence = value
+			}
+		}
+		if v.Valid() {
+			err = app.validateTask(ctx, v, task)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if !v.Valid() {
+			rowErrors = append(rowErrors, importRowError{Row: row, Errors: v.Errors})
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rowErrors, nil
+}
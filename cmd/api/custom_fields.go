@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+func (app *application) listCustomFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	fields, err := app.models.CustomFields.GetAllForWorkspace(r.Context(), app.contextGetWorkspace(r).WorkspaceID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"custom_fields": fields}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string   `json:"name"`
+		Type    string   `json:"type"`
+		Options []string `json:"options"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	field := &data.CustomField{
+		WorkspaceID: app.contextGetWorkspace(r).WorkspaceID,
+		Name:        input.Name,
+		Type:        input.Type,
+		Options:     input.Options,
+	}
+
+	v := validator.New()
+	if data.ValidateCustomField(v, field); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.CustomFields.Insert(r.Context(), field)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCustomField):
+			v.AddError("name", "a custom field with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/custom-fields/%d", field.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"custom_field": field}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The updateCustomFieldHandler() changes the options of a select field. Options that tasks
+// still have as their value can't be removed.
+func (app *application) updateCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	field, err := app.models.CustomFields.Get(r.Context(), id, app.contextGetWorkspace(r).WorkspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Options []string `json:"options"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Options != nil {
+		field.Options = input.Options
+	}
+
+	v := validator.New()
+	if data.ValidateCustomField(v, field); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	inUse, err := app.models.CustomFields.ValuesInUse(r.Context(), field)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	for _, value := range inUse {
+		if !validator.In(value, field.Options...) {
+			v.AddError("options", "must include the options that tasks have: "+strings.Join(inUse, ", "))
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	err = app.models.CustomFields.Update(r.Context(), field)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"custom_field": field}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteCustomFieldHandler() deletes a custom field, and its values on the tasks.
+func (app *application) deleteCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.CustomFields.Delete(r.Context(), id, app.contextGetWorkspace(r).WorkspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "custom field successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readCustomFieldFilters() helper reads the ?custom.name=value parameters of a task
+// list, checking each against the workspace's custom field of that name. The workspace's
+// fields are only looked up if there are any such parameters. Problems with the
+// parameters are recorded in v; only database errors are returned.
+func (app *application) readCustomFieldFilters(ctx context.Context, qs url.Values, workspaceID int64, v *validator.Validator) ([]data.CustomFieldFilter, error) {
+	var names []string
+	for key := range qs {
+		if name, ok := strings.CutPrefix(key, "custom."); ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	// Sorted, so that the same filters always make the same query.
+	sort.Strings(names)
+
+	fields, err := app.models.CustomFields.GetAllForWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*data.CustomField, len(fields))
+	for _, field := range fields {
+		byName[field.Name] = field
+	}
+
+	filters := make([]data.CustomFieldFilter, 0, len(names))
+	for _, name := range names {
+		key := "custom." + name
+		field, ok := byName[name]
+		if !ok {
+			v.AddError(key, "must be one of the workspace's custom fields")
+			continue
+		}
+		value, ok := field.ParseValue(qs.Get(key))
+		if !ok {
+			v.AddError(key, field.ValueMessage())
+			continue
+		}
+		filters = append(filters, data.CustomFieldFilter{Name: name, Value: value})
+	}
+	return filters, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// The listTaskDependenciesHandler() returns both the tasks blocking a task and the tasks
+// it is blocking.
+func (app *application) listTaskDependenciesHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	blockers, err := app.models.Dependencies.GetBlockers(r.Context(), task.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	dependents, err := app.models.Dependencies.GetDependents(r.Context(), task.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"blockers": blockers, "dependents": dependents}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The addTaskBlockerHandler() declares that the task (:id) is blocked by another of the
+// user's tasks (:blocker_id).
+func (app *application) addTaskBlockerHandler(w http.ResponseWriter, r *http.Request) {
+	task, blocker, ok := app.readOwnedTaskAndBlocker(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Dependencies.Add(r.Context(), task.ID, blocker.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDependencyCycle):
+			v := validator.New()
+			v.AddError("blocker_id", "would create a dependency cycle")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"blocker": data.TaskRef{ID: blocker.ID, Title: blocker.Title, Status: blocker.Status}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeTaskBlockerHandler(w http.ResponseWriter, r *http.Request) {
+	task, blocker, ok := app.readOwnedTaskAndBlocker(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Dependencies.Remove(r.Context(), task.ID, blocker.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "blocker successfully removed from task"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readOwnedTaskAndBlocker() helper fetches the task (:id) and the blocking task
+// (:blocker_id) from the URL, both of which must belong to the current workspace.
+func (app *application) readOwnedTaskAndBlocker(w http.ResponseWriter, r *http.Request) (*data.Task, *data.Task, bool) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	blockerID, err := app.readNamedIDParam(r, "blocker_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	blocker, err := app.models.Tasks.GetForWorkspace(r.Context(), blockerID, app.contextGetWorkspace(r).WorkspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+	return task, blocker, true
+}
+
+// The checkStatusChange() helper applies the workflow rules to a status change made through
+// a regular update: the transition itself must be allowed, and a task can't be completed
+// while it is blocked by open tasks. It sends the error response itself and returns false
+// if the change is rejected.
+func (app *application) checkStatusChange(w http.ResponseWriter, r *http.Request, task *data.Task, from data.TaskStatus) bool {
+	err := data.CheckStatusTransition(from, task.Status)
+	if err == nil {
+		err = app.models.Dependencies.CheckBlockers(r.Context(), task, from)
+	}
+	if err != nil {
+		var transitionErr *data.TransitionError
+		switch {
+		case errors.As(err, &transitionErr):
+			app.invalidTransitionResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+)
+
+// digestItem is how a task is shown in the digest email.
+type digestItem struct {
+	ID       int64
+	Title    string
+	DueDate  string
+	Priority data.TaskPriority
+}
+
+// The startDigestScheduler() method starts a background job which sends the daily digest
+// email to every opted-in user once a day, after the hour of the day they have chosen in
+// their settings, or else the configured one, in their own time zone.
+func (app *application) startDigestScheduler() {
+	app.backgroundTicker("digests", app.config.digest.interval, func() {
+		err := app.sendDigests()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+func (app *application) sendDigests() error {
+	timezones, err := app.models.Digests.GetTimezones(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, timezone := range timezones {
+		err = app.sendDigestsIn(timezone)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The sendDigestsIn() method sends the digests of the users in one time zone, for whom
+// "today" and "this week" are counted from midnight in that zone. Users without a time
+// zone of their own are in the configured default one.
+func (app *application) sendDigestsIn(timezone string) error {
+	loc := app.zoneOrDefault(timezone)
+	now := app.clock().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	recipients, err := app.models.Digests.GetRecipients(context.Background(), timezone, day, now.Hour(), app.config.digest.hour, 50)
+	if err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		select {
+		case <-app.done:
+			return nil
+		default:
+		}
+
+		digest, err := app.models.Digests.Get(context.Background(), recipient.UserID, now, day)
+		if err != nil {
+			return err
+		}
+		// Users with nothing coming up don't get an empty email, but today still
+		// counts as done for them.
+		if !digest.Empty() {
+			err = app.sendDigest(recipient, digest)
+			if err != nil {
+				// Leave the digest unmarked so that it is tried again on the next run.
+				app.logger.PrintError(err, map[string]string{"user_id": strconv.FormatInt(recipient.UserID, 10)})
+				continue
+			}
+		}
+		err = app.models.Digests.MarkSent(context.Background(), recipient.UserID, day)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *application) sendDigest(recipient *data.DigestRecipient, digest *data.Digest) error {
+	loc := app.zoneOrDefault(recipient.Timezone)
+	tmplData := map[string]interface{}{
+		"name":        recipient.Name,
+		"overdue":     app.digestItems(digest.Overdue, loc),
+		"dueToday":    app.digestItems(digest.DueToday, loc),
+		"dueThisWeek": app.digestItems(digest.DueThisWeek, loc),
+	}
+	return app.sendMail(context.Background(), recipient.Email, "daily_digest.tmpl", tmplData)
+}
+
+func (app *application) digestItems(tasks []*data.Task, loc *time.Location) []digestItem {
+	items := make([]digestItem, len(tasks))
+	for i, task := range tasks {
+		items[i] = digestItem{
+			ID:       task.ID,
+			Title:    task.Title,
+			DueDate:  time.Time(task.DueDate).In(loc).Format("Mon, 02 Jan 15:04"),
+			Priority: task.Priority,
+		}
+	}
+	return items
+}
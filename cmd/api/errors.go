@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
 )
 
 // The logError() method is a generic helper for logging an error message.
@@ -14,14 +19,32 @@ func (app *application) logError(r *http.Request, err error) {
 	app.logger.PrintError(err, map[string]string{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
+		"trace_id":       traceID(r),
 	})
 }
 
 // The errorResponse() method is a generic helper for sending JSON-formatted error messages to the client with a given status code.
 // Note that we're using an interface{} type for the message parameter, rather than just a string type, as this gives us
 // more flexibility over the values that we can include in the response.
+//
+// Clients that accept application/problem+json get RFC 7807 problem details instead, as
+// do all /v2/ clients; see problemResponse().
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
+	message = app.translateMessage(w, r, message)
+	if apiVersion(w) == apiV2 {
+		app.problemResponse(w, r, status, message)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	if acceptsProblemDetails(r.Header.Get("Accept")) {
+		app.problemResponse(w, r, status, message)
+		return
+	}
 	env := envelope{"error": message}
+	// The trace ID lets a client's bug report be matched with our logs and traces.
+	if id := traceID(r); id != "" {
+		env["trace_id"] = id
+	}
 	// Write the response using the writeJSON() helper.
 	// If this happens to return an error then log it,
 	// and fall back to sending the client an empty response with a 500 Internal Server Error status code.
@@ -32,10 +55,77 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 	}
 }
 
+// The problemResponse() method sends an error as an RFC 7807 problem details object. The
+// type is always about:blank, as the status says all there is to say about the kind of
+// error. The message is the detail, except for failed validation, where the invalid
+// fields are listed in the errors extension as they are in the {"error": ...} envelope.
+func (app *application) problemResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
+	lang := app.language(r)
+	problem := envelope{
+		"type":     "about:blank",
+		"title":    app.messages.Translate(lang, http.StatusText(status)),
+		"status":   status,
+		"instance": requestPath(w, r),
+	}
+	switch m := message.(type) {
+	case map[string]string:
+		problem["detail"] = app.messages.Translate(lang, validator.MsgInvalidFields)
+		problem["errors"] = m
+	default:
+		problem["detail"] = fmt.Sprint(m)
+	}
+	if id := traceID(r); id != "" {
+		problem["trace_id"] = id
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Type", "application/problem+json")
+	err := app.writeJSONBody(w, status, problem, headers)
+	if err != nil {
+		app.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
+
+// The language() method returns the language to send messages to the client in: the
+// locale of an authenticated user who has set one, or else the one chosen with the
+// Accept-Language header. If the user's settings can't be read, the header is used.
+func (app *application) language(r *http.Request) string {
+	if user, ok := r.Context().Value(userContextKey).(*data.User); ok && !user.IsAnonymous() {
+		settings, err := app.models.Settings.Get(r.Context(), user.ID)
+		if err == nil && settings.Locale != "" {
+			return settings.Locale
+		}
+	}
+	return app.messages.Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// The translateMessage() method translates the message of an error response, a string or
+// the errors of a validator, into the client's language, which it announces in the
+// Content-Language header.
+func (app *application) translateMessage(w http.ResponseWriter, r *http.Request, message interface{}) interface{} {
+	lang := app.language(r)
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", lang)
+	switch m := message.(type) {
+	case string:
+		return app.messages.Translate(lang, m)
+	case map[string]string:
+		return app.messages.TranslateAll(lang, m)
+	default:
+		return message
+	}
+}
+
 // The serverErrorResponse() method will be used when our application encounters an unexpected problem at runtime.
 // It logs the detailed error message, then uses the errorResponse() helper to send a 500 Internal Server Error status code
 // and JSON response (containing a generic error message) to the client.
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	// When the client goes away, its queries are cancelled and fail. There is nobody
+	// left to respond to, and nothing for us to fix, so don't log it as an error.
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		return
+	}
 	app.logError(r, err)
 	message := "the server encountered a problem and could not process your request"
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
@@ -56,6 +146,11 @@ func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.
 }
 
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	// Bodies that aren't JSON at all are refused by readJSON() before they are decoded.
+	if errors.Is(err, errUnsupportedMediaType) {
+		app.errorResponse(w, r, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
@@ -69,6 +164,36 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// The preconditionFailedResponse() method sends a 412 Precondition Failed when a record has
+// changed since the client fetched the version named in its If-Match header.
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has changed since it was fetched, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// The invalidTransitionResponse() method sends a 409 Conflict naming the workflow rule that
+// a status change broke.
+func (app *application) invalidTransitionResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusConflict, err.Error())
+}
+
+// The attachmentQuarantinedResponse() method sends a 409 Conflict for an attachment that
+// can't be downloaded, because it is still waiting to be scanned or failed its scan.
+func (app *application) attachmentQuarantinedResponse(w http.ResponseWriter, r *http.Request, attachment *data.Attachment) {
+	message := "the attachment is still being scanned, please try again later"
+	if attachment.ScanStatus == data.ScanRejected {
+		message = "the attachment failed its scan and can't be downloaded"
+	}
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// The integrationDeliveryFailedResponse() method sends a 502 Bad Gateway with the error of
+// a chat service that didn't accept a message.
+func (app *application) integrationDeliveryFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	message := fmt.Sprintf("the message could not be delivered: %s", err)
+	app.errorResponse(w, r, http.StatusBadGateway, message)
+}
+
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
@@ -78,11 +203,23 @@ func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *htt
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
+func (app *application) twoFactorRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a two-factor code is required, send totp_code or recovery_code"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
 func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("WWW-Authenticate", "Bearer")
 	message := "invalid or missing authentication token"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
+func (app *application) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or revoked API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+func (app *application) apiKeyNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this resource can't be accessed with an API key, use an authentication token instead"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -91,6 +228,10 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 	message := "your user account must be activated to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+func (app *application) deactivatedAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account has been deactivated"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
 func (app *application) notPermittedResponses(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
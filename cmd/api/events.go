@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/events"
+)
+
+// The publishTaskEvent() helper announces a change to one of a workspace's tasks: it is
+// sent on the event bus to the open event streams of each of the workspace's members,
+// queued for their webhooks, and mirrored into the search engine. The members are looked
+// up as the event happens, so that users who have left the workspace stop hearing about
+// its tasks. Queueing runs in the background so that a slow database doesn't hold up the
+// response; the change itself has already been saved, so failures are only logged.
+func (app *application) publishTaskEvent(workspaceID int64, event string, task interface{}) {
+	occurredAt := app.now()
+	// Tasks are sent with is_overdue and due_in_seconds as of when the event happened.
+	if t, ok := task.(*data.Task); ok {
+		copied := *t
+		copied.SetDueStatus(occurredAt)
+		task = &copied
+	}
+	app.indexTask(event, task)
+
+	userIDs, err := app.models.Workspaces.GetMemberIDs(context.Background(), workspaceID)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"event": event, "workspace_id": strconv.FormatInt(workspaceID, 10)})
+		return
+	}
+	for _, userID := range userIDs {
+		app.events.Publish(events.Event{Type: event, UserID: userID, OccurredAt: occurredAt, Data: task})
+	}
+
+	app.background(func() {
+		payload, err := json.Marshal(map[string]interface{}{
+			"event":       event,
+			"occurred_at": occurredAt.Format(time.RFC3339),
+			"task":        task,
+		})
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"event": event})
+			return
+		}
+		for _, userID := range userIDs {
+			err = app.models.Webhooks.Enqueue(context.Background(), userID, event, payload)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"event": event, "user_id": strconv.FormatInt(userID, 10)})
+			}
+		}
+	})
+}
+
+// The publishTaskUpdate() helper announces that a task was changed, and also that it was
+// completed if its status has just become "completed".
+func (app *application) publishTaskUpdate(task *data.Task, previousStatus data.TaskStatus) {
+	app.publishTaskEvent(task.WorkspaceID, data.EventTaskUpdated, task)
+	if task.Status == data.StatusCompleted && previousStatus != data.StatusCompleted {
+		app.publishTaskEvent(task.WorkspaceID, data.EventTaskCompleted, task)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// fieldNameRX is what the names in a ?fields= parameter look like: the names of the JSON
+// fields of a resource.
+var fieldNameRX = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// fieldsWriter marks a response whose resources are cut down to the fields the client
+// asked for with ?fields=, so that writeJSON() and writeResponse(), which are only handed
+// the ResponseWriter, know to project them.
+type fieldsWriter struct {
+	http.ResponseWriter
+	fields []string
+}
+
+func (fw *fieldsWriter) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
+
+// The responseFields() helper returns the fields that a response's resources are cut down
+// to, or nil if they are sent whole.
+func responseFields(w http.ResponseWriter) []string {
+	for {
+		if fw, ok := w.(*fieldsWriter); ok {
+			return fw.fields
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+		w = u.Unwrap()
+	}
+}
+
+// The sparseFields() middleware lets clients ask for only some of the fields of the
+// resources an endpoint returns, as a comma-separated list such as
+// ?fields=id,title,due_date. Only the top-level fields of the resources can be picked;
+// names the resources don't have are ignored.
+func (app *application) sparseFields(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		qs := r.URL.Query()
+		if !qs.Has("fields") {
+			next(w, r)
+			return
+		}
+
+		v := validator.New()
+		fields := app.readCSV(qs, "fields", nil, app.config.filters.maxValues, v)
+		v.Check(len(fields) > 0, "fields", "must be provided")
+		for _, field := range fields {
+			if !fieldNameRX.MatchString(field) {
+				v.AddError("fields", "must be a comma-separated list of field names")
+				break
+			}
+		}
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		next(&fieldsWriter{ResponseWriter: w, fields: fields}, r)
+	}
+}
+
+// The projectEnvelope() helper cuts the resources in an envelope down to the fields the
+// client asked for, if it asked. Each member of the envelope holding an object or a list
+// of objects is projected; the pagination metadata, and error responses, are left whole.
+func projectEnvelope(w http.ResponseWriter, status int, env envelope) (envelope, error) {
+	fields := responseFields(w)
+	if fields == nil || status >= http.StatusMultipleChoices {
+		return env, nil
+	}
+
+	projected := make(envelope, len(env))
+	for key, value := range env {
+		if key == "metadata" {
+			projected[key] = value
+			continue
+		}
+		value, err := project(value, fields)
+		if err != nil {
+			return nil, err
+		}
+		projected[key] = value
+	}
+	return projected, nil
+}
+
+// The project() helper keeps only the given fields of an object, or of each object in a
+// list, in the order they are encoded in. Other values are returned as they are.
+func project(value interface{}, fields []string) (interface{}, error) {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	decoded, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch decoded := decoded.(type) {
+	case []orderedField:
+		return orderedJSON{projectObject(decoded, fields)}, nil
+	case []interface{}:
+		for i, item := range decoded {
+			if object, ok := item.([]orderedField); ok {
+				decoded[i] = projectObject(object, fields)
+			}
+		}
+		return orderedJSON{decoded}, nil
+	default:
+		return value, nil
+	}
+}
+
+func projectObject(object []orderedField, fields []string) []orderedField {
+	projected := []orderedField{}
+	for _, field := range object {
+		if validator.In(field.Name, fields...) {
+			projected = append(projected, field)
+		}
+	}
+	return projected
+}
+
+// orderedJSON encodes a value returned by decodeOrdered() back to JSON, keeping the order
+// of the fields.
+type orderedJSON struct {
+	value interface{}
+}
+
+func (o orderedJSON) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	err := writeOrderedJSON(&buf, o.value)
+	return buf.Bytes(), err
+}
+
+// The projectElement() helper is projectEnvelope() for the elements of a list streamed
+// with a jsonStream.
+func projectElement(w http.ResponseWriter, value interface{}) (interface{}, error) {
+	fields := responseFields(w)
+	if fields == nil {
+		return value, nil
+	}
+	return project(value, fields)
+}
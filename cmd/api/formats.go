@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Define the response formats supported by writeResponse().
+const (
+	formatJSON = "json"
+	formatXML  = "xml"
+	formatCSV  = "csv"
+)
+
+// responseFormats maps the media types we can produce to a response format. Where the
+// client accepts several of them equally, the one listed first wins.
+var responseFormats = []struct {
+	mediaType string
+	format    string
+}{
+	{"application/json", formatJSON},
+	{"application/xml", formatXML},
+	{"text/xml", formatXML},
+	{"text/csv", formatCSV},
+}
+
+// The writeResponse() helper is writeJSON() with content negotiation: depending on the
+// request's Accept header the envelope is sent as JSON, XML or CSV. All three formats are
+// produced from the JSON encoding of the envelope, so field names, time formats and
+// omitted fields are the same whichever one the client asks for. Requests without an
+// Accept header, or accepting none of the supported types, get JSON. The responses can be
+// cached and requested conditionally, see writeCacheable().
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	w.Header().Add("Vary", "Accept")
+
+	data, err := projectEnvelope(w, status, data)
+	if err != nil {
+		return err
+	}
+
+	format := negotiateFormat(r.Header.Get("Accept"))
+	if format == formatJSON {
+		js, err := encodeJSON(versionedBody(w, data))
+		if err != nil {
+			return err
+		}
+		writeCacheable(w, r, status, "application/json", js, headers)
+		return nil
+	}
+
+	js, err := json.Marshal(versionedBody(w, data))
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	value, err := decodeOrdered(dec)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	var contentType string
+	switch format {
+	case formatXML:
+		contentType = "application/xml; charset=utf-8"
+		err = encodeXML(&buf, value)
+	case formatCSV:
+		contentType = "text/csv; charset=utf-8"
+		err = encodeCSV(&buf, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	writeCacheable(w, r, status, contentType, buf.Bytes(), headers)
+	return nil
+}
+
+// negotiateFormat picks the response format for an Accept header, honouring quality
+// values and wildcards.
+func negotiateFormat(accept string) string {
+	if accept == "" {
+		return formatJSON
+	}
+
+	best, bestQ := formatJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil {
+				continue
+			}
+		}
+		for _, rf := range responseFormats {
+			if q > bestQ && mediaTypeMatches(mediaType, rf.mediaType) {
+				best, bestQ = rf.format, q
+				break
+			}
+		}
+	}
+	return best
+}
+
+// mediaTypeMatches reports whether a media range from an Accept header (which may be
+// "*/*" or "type/*") covers mediaType.
+func mediaTypeMatches(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(mediaRange, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
+
+// acceptsProblemDetails reports whether an Accept header names application/problem+json,
+// in which case errors are sent as problem details rather than in an envelope. Wildcards
+// don't count, so that existing clients keep getting the format they know.
+func acceptsProblemDetails(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != "application/problem+json" {
+			continue
+		}
+		if s, ok := params["q"]; ok {
+			q, err := strconv.ParseFloat(s, 64)
+			if err != nil || q <= 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// orderedField is a member of a JSON object. decodeOrdered() returns objects as a
+// []orderedField, rather than a map, so that fields keep the order of the struct they
+// were encoded from.
+type orderedField struct {
+	Name  string
+	Value interface{}
+}
+
+// decodeOrdered reads the next JSON value from dec. Objects are returned as
+// []orderedField, arrays as []interface{}, and scalars as the json.Decoder returns them.
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		fields := []orderedField{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, orderedField{Name: key.(string), Value: value})
+		}
+		_, err = dec.Token()
+		return fields, err
+	case json.Delim('['):
+		items := []interface{}{}
+		for dec.More() {
+			item, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err = dec.Token()
+		return items, err
+	default:
+		return token, nil
+	}
+}
+
+// encodeXML writes a decoded envelope as an XML document with a <response> root. Each
+// field becomes an element of the same name, and each array item an <item> element.
+func encodeXML(w io.Writer, value interface{}) error {
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	err := encodeXMLElement(enc, "response", value)
+	if err != nil {
+		return err
+	}
+	err = enc.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func encodeXMLElement(enc *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case []orderedField:
+		for _, field := range value {
+			err = encodeXMLElement(enc, field.Name, field.Value)
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			err = encodeXMLElement(enc, "item", item)
+			if err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		err = enc.EncodeToken(xml.CharData(scalarString(value)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// errNotTabular is returned by encodeCSV() for envelopes with no records to put in rows.
+var errNotTabular = errors.New("response has no records to encode as CSV")
+
+// encodeCSV writes the records in a decoded envelope as CSV: the first array found in the
+// envelope gives one row per item, or failing that, the first object gives a single row.
+// Other members of the envelope, such as pagination metadata, are left out. Nested
+// values are written as JSON.
+func encodeCSV(w io.Writer, value interface{}) error {
+	envelope, _ := value.([]orderedField)
+
+	var records []interface{}
+	for _, field := range envelope {
+		if items, ok := field.Value.([]interface{}); ok {
+			records = items
+			break
+		}
+	}
+	if records == nil {
+		for _, field := range envelope {
+			if _, ok := field.Value.([]orderedField); ok {
+				records = []interface{}{field.Value}
+				break
+			}
+		}
+	}
+	if records == nil {
+		return errNotTabular
+	}
+
+	// The columns are the union of the records' fields, in the order they first appear.
+	var columns []string
+	seen := make(map[string]bool)
+	for _, record := range records {
+		fields, _ := record.([]orderedField)
+		for _, field := range fields {
+			if !seen[field.Name] {
+				seen[field.Name] = true
+				columns = append(columns, field.Name)
+			}
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(columns)
+	if err != nil {
+		return err
+	}
+	row := make([]string, len(columns))
+	for _, record := range records {
+		fields, _ := record.([]orderedField)
+		for i, column := range columns {
+			row[i] = ""
+			for _, field := range fields {
+				if field.Name == column {
+					row[i], err = csvCell(field.Value)
+					if err != nil {
+						return err
+					}
+					break
+				}
+			}
+		}
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell formats a decoded value for a CSV cell.
+func csvCell(value interface{}) (string, error) {
+	switch value.(type) {
+	case []orderedField, []interface{}:
+		var buf bytes.Buffer
+		err := writeOrderedJSON(&buf, value)
+		return buf.String(), err
+	default:
+		return scalarString(value), nil
+	}
+}
+
+// writeOrderedJSON re-encodes a decoded value as compact JSON, keeping the field order.
+func writeOrderedJSON(buf *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case []orderedField:
+		buf.WriteByte('{')
+		for i, field := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(field.Name)
+			buf.Write(key)
+			buf.WriteByte(':')
+			err := writeOrderedJSON(buf, field.Value)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := writeOrderedJSON(buf, item)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		js, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		buf.Write(js)
+	}
+	return nil
+}
+
+// scalarString formats a JSON string, number, boolean or null as plain text.
+func scalarString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,1024 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/graphql"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// graphqlMaxDepth limits how deeply a GraphQL query can nest fields, so that a query like
+// tasks { category { tasks { category ... } } } can't ask for unbounded work.
+const graphqlMaxDepth = 8
+
+// graphqlStateKey is the key for the graphqlState of a GraphQL request.
+const graphqlStateKey = contextKey("graphql")
+
+// graphqlState is what the resolvers need to know about the request they are part of:
+// who made it, for which workspace, and the loaders that batch its queries. Loaders cache
+// what they load, so every request gets its own.
+type graphqlState struct {
+	r        *http.Request
+	user     *data.User
+	member   *data.Member
+	canWrite bool
+	// apiKey is set when the request was made with an API key, which can't manage the
+	// user's tags, see requireUser().
+	apiKey bool
+
+	categories    *graphql.Loader[int64, *data.Category]
+	categoryTasks *graphql.Loader[int64, []*data.Task]
+	taskTags      *graphql.Loader[int64, []*data.Tag]
+	users         *graphql.Loader[int64, *data.User]
+}
+
+func graphqlStateFrom(ctx context.Context) *graphqlState {
+	return ctx.Value(graphqlStateKey).(*graphqlState)
+}
+
+// The graphqlHandler() method returns the handler for POST /v1/graphql, which runs queries
+// and mutations against the schema. GraphQL reports errors in the response body, so the
+// status is 200 whenever the request could be read at all.
+func (app *application) graphqlHandler(schema *graphql.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req graphql.Request
+		err := app.readJSON(w, r, &req)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		v := validator.New()
+		if v.Check(req.Query != "", "query", "must be provided"); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		state, err := app.newGraphQLState(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		res := schema.Execute(context.WithValue(r.Context(), graphqlStateKey, state), req)
+
+		err = app.writeJSONBody(w, http.StatusOK, res, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// The newGraphQLState() method sets up the loaders for a request. The route only needs
+// read access, so whether mutations are allowed is worked out here, with the same checks
+// as the writer middleware in routes().
+func (app *application) newGraphQLState(r *http.Request) (*graphqlState, error) {
+	user := app.contextGetUser(r)
+	member := app.contextGetWorkspace(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+	canWrite := permissions.Include("tasks:write") && data.RoleAllows(member.Role, data.RoleMember)
+	key := app.contextGetAPIKey(r)
+	if key != nil && !key.Permissions.Include("tasks:write") {
+		canWrite = false
+	}
+
+	ctx := r.Context()
+	workspaceID := member.WorkspaceID
+	return &graphqlState{
+		r:        r,
+		user:     user,
+		member:   member,
+		canWrite: canWrite,
+		apiKey:   key != nil,
+		categories: graphql.NewLoader(ctx, func(ctx context.Context, ids []int64) (map[int64]*data.Category, error) {
+			return app.models.Categories.GetMany(ctx, workspaceID, ids)
+		}),
+		categoryTasks: graphql.NewLoader(ctx, func(ctx context.Context, ids []int64) (map[int64][]*data.Task, error) {
+			tasks, err := app.models.Tasks.GetForCategories(ctx, workspaceID, ids)
+			if err != nil {
+				return nil, err
+			}
+			byCategory := make(map[int64][]*data.Task, len(ids))
+			for _, id := range ids {
+				byCategory[id] = []*data.Task{}
+			}
+			for _, task := range tasks {
+				byCategory[task.CategoryID] = append(byCategory[task.CategoryID], task)
+			}
+			return byCategory, nil
+		}),
+		taskTags: graphql.NewLoader(ctx, func(ctx context.Context, ids []int64) (map[int64][]*data.Tag, error) {
+			tags, err := app.models.Tags.GetForTasks(ctx, ids, user.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				if tags[id] == nil {
+					tags[id] = []*data.Tag{}
+				}
+			}
+			return tags, nil
+		}),
+		users: graphql.NewLoader(ctx, app.models.Users.GetMany),
+	}, nil
+}
+
+// requireWrite reports an error for mutations that change the workspace's tasks and
+// categories when the user may only read them.
+func (s *graphqlState) requireWrite() error {
+	if !s.canWrite {
+		return graphqlError(http.StatusForbidden, "your user account doesn't have the necessary permissions to access this resource")
+	}
+	return nil
+}
+
+// requireUser reports an error for the fields backed by routes that refuse API keys,
+// like requireActivatedUser() does.
+func (s *graphqlState) requireUser() error {
+	if s.apiKey {
+		return graphqlError(http.StatusForbidden, "this resource can't be accessed with an API key, use an authentication token instead")
+	}
+	return nil
+}
+
+// graphqlError reports a failure with the status code and message that the REST endpoint
+// would have responded with, in the error's extensions. A map of validation errors, like
+// the ones failedValidationResponse() sends, is included as is.
+func graphqlError(status int, message interface{}) *graphql.Error {
+	err := &graphql.Error{Extensions: map[string]interface{}{"status": status}}
+	switch m := message.(type) {
+	case map[string]string:
+		err.Message = "failed validation"
+		err.Extensions["errors"] = m
+	default:
+		err.Message = fmt.Sprint(m)
+	}
+	return err
+}
+
+var errGraphQLNotFound = graphqlError(http.StatusNotFound, "the requested resource could not be found")
+
+// The presentGraphQLError() method is the schema's PresentError. Errors that resolvers
+// meant for the client are passed on; anything else is logged and reported as a generic
+// server error, like serverErrorResponse() does.
+func (app *application) presentGraphQLError(ctx context.Context, err error) *graphql.Error {
+	var gqlErr *graphql.Error
+	if errors.As(err, &gqlErr) {
+		return gqlErr
+	}
+	r := graphqlStateFrom(ctx).r
+	if !errors.Is(r.Context().Err(), context.Canceled) {
+		app.logError(r, err)
+	}
+	return graphqlError(http.StatusInternalServerError, "the server encountered a problem and could not process your request")
+}
+
+// graphqlID reads an ID argument. IDs are strings in GraphQL, but they are always numbers
+// here; anything else is 0, which finds nothing.
+func graphqlID(value interface{}) int64 {
+	s, _ := value.(string)
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// graphqlStrings converts a list argument of strings or enum values.
+func graphqlStrings(value interface{}) []string {
+	items, _ := value.([]interface{})
+	strs := make([]string, len(items))
+	for i, item := range items {
+		strs[i], _ = item.(string)
+	}
+	return strs
+}
+
+// graphqlDateTime is the DateTime scalar, in the same formats as the REST API's times.
+var graphqlDateTime = &graphql.Scalar{
+	Name:        "DateTime",
+	Description: "A time, written in RFC 3339 (or the legacy 2006-01-02 15:04:05 layout if the server is set to it), and read in either, or as a date.",
+	Serialize: func(value interface{}) (interface{}, error) {
+		switch t := value.(type) {
+		case data.CustomTime:
+			if t.IsZero() {
+				return nil, nil
+			}
+			return data.FormatTime(time.Time(t)), nil
+		case time.Time:
+			return data.FormatTime(t), nil
+		}
+		return nil, fmt.Errorf("DateTime cannot represent value: %v", value)
+	},
+	Parse: func(value interface{}) (interface{}, error) {
+		s, _ := value.(string)
+		t, err := data.ParseTime(s)
+		if err != nil {
+			return nil, errors.New("DateTime must be a string in RFC 3339, 2006-01-02 or 2006-01-02 15:04:05 format")
+		}
+		return data.CustomTime(t), nil
+	},
+}
+
+// The graphqlSchema() method builds the schema served at /v1/graphql. It exposes the same
+// data as the REST endpoints, with the same checks: tasks and categories come from the
+// request's workspace, tags and the current user from the request's user.
+func (app *application) graphqlSchema() *graphql.Schema {
+	taskStatus := graphql.NewEnum("TaskStatus", data.TaskStatuses...)
+	taskPriority := graphql.NewEnum("TaskPriority", data.TaskPriorities...)
+
+	// The object types refer to each other, so they are declared before their fields are
+	// filled in.
+	taskType := &graphql.Object{Name: "Task"}
+	categoryType := &graphql.Object{Name: "Category"}
+	tagType := &graphql.Object{Name: "Tag", Fields: map[string]*graphql.FieldDef{
+		"id":        {Type: graphql.NonNullOf(graphql.ID)},
+		"createdAt": {Type: graphql.NonNullOf(graphqlDateTime)},
+		"name":      {Type: graphql.NonNullOf(graphql.String)},
+		"version":   {Type: graphql.NonNullOf(graphql.Int)},
+	}}
+	userType := &graphql.Object{Name: "User", Fields: map[string]*graphql.FieldDef{
+		"id":        {Type: graphql.NonNullOf(graphql.ID)},
+		"createdAt": {Type: graphql.NonNullOf(graphqlDateTime)},
+		"name":      {Type: graphql.NonNullOf(graphql.String)},
+		"email":     {Type: graphql.NonNullOf(graphql.String)},
+		"activated": {Type: graphql.NonNullOf(graphql.Boolean)},
+	}}
+
+	taskType.Fields = map[string]*graphql.FieldDef{
+		"id":          {Type: graphql.NonNullOf(graphql.ID)},
+		"createdAt":   {Type: graphql.NonNullOf(graphqlDateTime)},
+		"completedAt": {Type: graphqlDateTime},
+		"title":       {Type: graphql.NonNullOf(graphql.String)},
+		"description": {Type: graphql.NonNullOf(graphql.String)},
+		"dueDate": {
+			Type:        graphqlDateTime,
+			Description: "The due date, in the user's time zone if they have set one.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return app.localTask(graphqlStateFrom(p.Context).user, p.Source.(*data.Task)).DueDate, nil
+			},
+		},
+		"estimateMinutes": {
+			Type:        graphql.Int,
+			Description: "How long the task is expected to take in all.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphqlOptionalInt(p.Source.(*data.Task).EstimateMinutes), nil
+			},
+		},
+		"remainingMinutes": {
+			Type:        graphql.Int,
+			Description: "How much of the estimate is left.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphqlOptionalInt(p.Source.(*data.Task).RemainingMinutes), nil
+			},
+		},
+		"startDate": {
+			Type:        graphqlDateTime,
+			Description: "When work on the task can start, in the user's time zone if they have set one.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return app.localTask(graphqlStateFrom(p.Context).user, p.Source.(*data.Task)).StartDate, nil
+			},
+		},
+		"isOverdue": {
+			Type:        graphql.NonNullOf(graphql.Boolean),
+			Description: "Whether the task is past its due date and not completed.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return app.localTask(graphqlStateFrom(p.Context).user, p.Source.(*data.Task)).IsOverdue, nil
+			},
+		},
+		"dueInSeconds": {
+			Type:        graphql.Int,
+			Description: "The seconds until the due date, negative once it has passed.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				seconds := app.localTask(graphqlStateFrom(p.Context).user, p.Source.(*data.Task)).DueInSeconds
+				if seconds == nil {
+					return nil, nil
+				}
+				return *seconds, nil
+			},
+		},
+		"priority":   {Type: graphql.NonNullOf(taskPriority)},
+		"status":     {Type: graphql.NonNullOf(taskStatus)},
+		"categoryId": {Type: graphql.NonNullOf(graphql.ID)},
+		"categoryName": {
+			Type: graphql.NonNullOf(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*data.Task).Category, nil
+			},
+		},
+		"category": {
+			Type: categoryType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphqlStateFrom(p.Context).categories.Load(p.Source.(*data.Task).CategoryID), nil
+			},
+		},
+		"tags": {
+			Type:        graphql.NonNullOf(graphql.ListOf(graphql.NonNullOf(tagType))),
+			Description: "The tags attached to the task, sorted by name.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphqlStateFrom(p.Context).taskTags.Load(p.Source.(*data.Task).ID), nil
+			},
+		},
+		"user": {
+			Type:        userType,
+			Description: "The user who created the task.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphqlStateFrom(p.Context).users.Load(p.Source.(*data.Task).UserID), nil
+			},
+		},
+		"recurrence": {Type: graphql.String},
+		"archived":   {Type: graphql.NonNullOf(graphql.Boolean)},
+		"position":   {Type: graphql.NonNullOf(graphql.Int)},
+		"version":    {Type: graphql.NonNullOf(graphql.Int)},
+		"snoozedUntil": {
+			Type:        graphqlDateTime,
+			Description: "Until when the task is left out of the default lists and not reminded about.",
+		},
+	}
+
+	categoryType.Fields = map[string]*graphql.FieldDef{
+		"id":          {Type: graphql.NonNullOf(graphql.ID)},
+		"createdAt":   {Type: graphql.NonNullOf(graphqlDateTime)},
+		"name":        {Type: graphql.NonNullOf(graphql.String)},
+		"description": {Type: graphql.NonNullOf(graphql.String)},
+		"parent": {
+			Type: categoryType,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				category := p.Source.(*data.Category)
+				if category.ParentID == nil {
+					return nil, nil
+				}
+				return graphqlStateFrom(p.Context).categories.Load(*category.ParentID), nil
+			},
+		},
+		"tasks": {
+			Type:        graphql.NonNullOf(graphql.ListOf(graphql.NonNullOf(taskType))),
+			Description: "The category's tasks that aren't archived, oldest first.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphqlStateFrom(p.Context).categoryTasks.Load(p.Source.(*data.Category).ID), nil
+			},
+		},
+		"version": {Type: graphql.NonNullOf(graphql.Int)},
+	}
+
+	return &graphql.Schema{
+		Query:        app.graphqlQuery(taskType, categoryType, tagType, userType, taskStatus, taskPriority),
+		Mutation:     app.graphqlMutation(taskType, categoryType, tagType, taskStatus, taskPriority),
+		MaxDepth:     graphqlMaxDepth,
+		PresentError: app.presentGraphQLError,
+	}
+}
+
+// graphqlPageArgs are the pagination arguments of list queries, with the same defaults as
+// the page, page_size and sort query string parameters.
+func graphqlPageArgs() map[string]*graphql.InputValue {
+	return map[string]*graphql.InputValue{
+		"page":     {Type: graphql.Int, Default: 1},
+		"pageSize": {Type: graphql.Int, Default: 20},
+		"sort":     {Type: graphql.String, Default: "id"},
+	}
+}
+
+func graphqlFilters(args map[string]interface{}, safelist ...string) data.Filters {
+	page, _ := args["page"].(int)
+	pageSize, _ := args["pageSize"].(int)
+	sort, _ := args["sort"].(string)
+	return data.Filters{Page: page, PageSize: pageSize, Sort: sort, SortSafelist: safelist}
+}
+
+func (app *application) graphqlQuery(taskType, categoryType, tagType, userType *graphql.Object, taskStatus, taskPriority *graphql.Enum) *graphql.Object {
+	metadataType := &graphql.Object{Name: "PageMetadata", Fields: map[string]*graphql.FieldDef{
+		"currentPage":  {Type: graphql.NonNullOf(graphql.Int)},
+		"pageSize":     {Type: graphql.NonNullOf(graphql.Int)},
+		"firstPage":    {Type: graphql.NonNullOf(graphql.Int)},
+		"lastPage":     {Type: graphql.NonNullOf(graphql.Int)},
+		"totalRecords": {Type: graphql.NonNullOf(graphql.Int)},
+	}}
+	taskPageType := &graphql.Object{Name: "TaskPage", Fields: map[string]*graphql.FieldDef{
+		"tasks":    {Type: graphql.NonNullOf(graphql.ListOf(graphql.NonNullOf(taskType)))},
+		"metadata": {Type: graphql.NonNullOf(metadataType)},
+	}}
+	taskFilterType := &graphql.InputObject{Name: "TaskFilter", Fields: map[string]*graphql.InputValue{
+		"title":           {Type: graphql.String},
+		"query":           {Type: graphql.String, Description: "Searches both title and description, like the q parameter."},
+		"tags":            {Type: graphql.ListOf(graphql.NonNullOf(graphql.String)), Description: "Only tasks carrying every one of these tags."},
+		"status":          {Type: graphql.ListOf(graphql.NonNullOf(taskStatus))},
+		"priority":        {Type: graphql.ListOf(graphql.NonNullOf(taskPriority))},
+		"category":        {Type: graphql.String},
+		"categoryId":      {Type: graphql.ID},
+		"includeArchived": {Type: graphql.Boolean},
+		"includeSnoozed":  {Type: graphql.Boolean},
+		"dueBefore":       {Type: graphqlDateTime},
+		"dueAfter":        {Type: graphqlDateTime},
+		"hasDueDate":      {Type: graphql.Boolean, Description: "Only tasks with (true) or without (false) a due date."},
+		"due":             {Type: graphql.String, Description: "One of overdue, today or this_week, like the due parameter."},
+		"completedBefore": {Type: graphqlDateTime},
+		"completedAfter":  {Type: graphqlDateTime},
+		"pinned":          {Type: graphql.Boolean, Description: "Only tasks the user has (true) or hasn't (false) pinned. Without it, pinned tasks come first."},
+		"available":       {Type: graphql.Boolean, Description: "Only tasks without a start date or whose start date has arrived."},
+		"scheduled":       {Type: graphql.Boolean, Description: "Only tasks whose start date is still to come."},
+	}}
+
+	tasksArgs := graphqlPageArgs()
+	tasksArgs["filter"] = &graphql.InputValue{Type: taskFilterType}
+	categoriesArgs := graphqlPageArgs()
+	categoriesArgs["name"] = &graphql.InputValue{Type: graphql.String}
+
+	return &graphql.Object{Name: "Query", Fields: map[string]*graphql.FieldDef{
+		"task": {
+			Type: taskType,
+			Args: map[string]*graphql.InputValue{"id": {Type: graphql.NonNullOf(graphql.ID)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				task, err := app.models.Tasks.GetForWorkspace(p.Context, graphqlID(p.Args["id"]), graphqlStateFrom(p.Context).member.WorkspaceID)
+				if errors.Is(err, data.ErrRecordNotFound) {
+					return nil, nil
+				}
+				return task, err
+			},
+		},
+		"tasks": {
+			Type:        graphql.NonNullOf(taskPageType),
+			Description: "A page of the workspace's tasks, filtered like GET /v1/tasks.",
+			Args:        tasksArgs,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				tf := data.TaskFilters{Similarity: app.config.search.similarity, UserID: graphqlStateFrom(p.Context).user.ID}
+				if filter, ok := p.Args["filter"].(map[string]interface{}); ok {
+					tf.Title, _ = filter["title"].(string)
+					tf.Query, _ = filter["query"].(string)
+					tf.Tags = graphqlStrings(filter["tags"])
+					tf.Statuses = graphqlStrings(filter["status"])
+					tf.Priorities = graphqlStrings(filter["priority"])
+					tf.Category, _ = filter["category"].(string)
+					if id, ok := filter["categoryId"]; ok {
+						tf.CategoryID = graphqlID(id)
+					}
+					tf.IncludeArchived, _ = filter["includeArchived"].(bool)
+					tf.IncludeSnoozed, _ = filter["includeSnoozed"].(bool)
+					loc := app.userLocation(graphqlStateFrom(p.Context).user)
+					if t, ok := filter["dueBefore"].(data.CustomTime); ok {
+						tf.DueBefore = time.Time(t.ResolveDate(loc))
+					}
+					if t, ok := filter["dueAfter"].(data.CustomTime); ok {
+						tf.DueAfter = time.Time(t.ResolveDate(loc))
+					}
+					if hasDueDate, ok := filter["hasDueDate"].(bool); ok {
+						tf.HasDueDate = &hasDueDate
+					}
+					tf.Due, _ = filter["due"].(string)
+					tf.Available, _ = filter["available"].(bool)
+					tf.Scheduled, _ = filter["scheduled"].(bool)
+					if pinned, ok := filter["pinned"].(bool); ok {
+						tf.Pinned = &pinned
+					}
+					if t, ok := filter["completedBefore"].(data.CustomTime); ok {
+						tf.CompletedBefore = time.Time(t.ResolveDate(loc))
+					}
+					if t, ok := filter["completedAfter"].(data.CustomTime); ok {
+						tf.CompletedAfter = time.Time(t.ResolveDate(loc))
+					}
+					tf.Now = app.clock().In(loc)
+					tf.Today = time.Date(tf.Now.Year(), tf.Now.Month(), tf.Now.Day(), 0, 0, 0, 0, loc)
+				}
+				filters := graphqlFilters(p.Args, data.TaskSorts...)
+
+				v := validator.New()
+				data.ValidateTaskFilters(v, tf)
+				if data.ValidateFilters(v, filters); !v.Valid() {
+					return nil, graphqlError(http.StatusUnprocessableEntity, v.Errors)
+				}
+
+				tasks, metadata, err := app.models.Tasks.GetAllForWorkspace(p.Context, graphqlStateFrom(p.Context).member.WorkspaceID, tf, filters)
+				if err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"tasks": tasks, "metadata": metadata}, nil
+			},
+		},
+		"category": {
+			Type: categoryType,
+			Args: map[string]*graphql.InputValue{"id": {Type: graphql.NonNullOf(graphql.ID)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphqlStateFrom(p.Context).categories.Load(graphqlID(p.Args["id"])), nil
+			},
+		},
+		"categories": {
+			Type:        graphql.NonNullOf(graphql.ListOf(graphql.NonNullOf(categoryType))),
+			Description: "A page of the workspace's categories, filtered like GET /v1/categories.",
+			Args:        categoriesArgs,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				name, _ := p.Args["name"].(string)
+				filters := graphqlFilters(p.Args, "id", "name", "-id", "-name")
+
+				v := validator.New()
+				if data.ValidateFilters(v, filters); !v.Valid() {
+					return nil, graphqlError(http.StatusUnprocessableEntity, v.Errors)
+				}
+
+				withCounts, _, err := app.models.Categories.GetAll(p.Context, graphqlStateFrom(p.Context).member.WorkspaceID, name, filters)
+				if err != nil {
+					return nil, err
+				}
+				categories := make([]*data.Category, len(withCounts))
+				for i, category := range withCounts {
+					categories[i] = category.Category
+				}
+				return categories, nil
+			},
+		},
+		"tags": {
+			Type:        graphql.NonNullOf(graphql.ListOf(graphql.NonNullOf(tagType))),
+			Description: "The current user's tags. Not available with an API key.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				state := graphqlStateFrom(p.Context)
+				if err := state.requireUser(); err != nil {
+					return nil, err
+				}
+				return app.models.Tags.GetAllForUser(p.Context, state.user.ID)
+			},
+		},
+		"me": {
+			Type: graphql.NonNullOf(userType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return graphqlStateFrom(p.Context).user, nil
+			},
+		},
+	}}
+}
+
+// graphqlTaskInput converts a TaskInput argument to the taskInput that the REST endpoints
+// decode, leaving out the fields that weren't given.
+func graphqlTaskInput(args map[string]interface{}) taskInput {
+	var input taskInput
+	if title, ok := args["title"].(string); ok {
+		input.Title = &title
+	}
+	if description, ok := args["description"].(string); ok {
+		input.Description = &description
+	}
+	// A dueDate of null removes the due date, which leaves the zero value.
+	if dueDate, ok := args["dueDate"]; ok {
+		input.DueDate.set = true
+		input.DueDate.time, _ = dueDate.(data.CustomTime)
+	}
+	if startDate, ok := args["startDate"]; ok {
+		input.StartDate.set = true
+		input.StartDate.time, _ = startDate.(data.CustomTime)
+	}
+	if priority, ok := args["priority"].(string); ok {
+		p := data.TaskPriority(priority)
+		input.Priority = &p
+	}
+	if status, ok := args["status"].(string); ok {
+		s := data.TaskStatus(status)
+		input.Status = &s
+	}
+	if id, ok := args["categoryId"]; ok {
+		categoryID := graphqlID(id)
+		input.CategoryID = &categoryID
+	}
+	if category, ok := args["category"].(string); ok {
+		input.Category = &category
+	}
+	if recurrence, ok := args["recurrence"].(string); ok {
+		input.Recurrence = &recurrence
+	}
+	// Like dueDate, an estimate of null removes it.
+	if estimate, ok := args["estimateMinutes"]; ok {
+		input.EstimateMinutes.set = true
+		if minutes, ok := estimate.(int); ok {
+			input.EstimateMinutes.value = &minutes
+		}
+	}
+	if remaining, ok := args["remainingMinutes"]; ok {
+		input.RemainingMinutes.set = true
+		if minutes, ok := remaining.(int); ok {
+			input.RemainingMinutes.value = &minutes
+		}
+	}
+	return input
+}
+
+// graphqlOptionalInt returns the number n points to, or nil for a null, which the Int
+// scalar can't serialize from a nil pointer.
+func graphqlOptionalInt(n *int) interface{} {
+	if n == nil {
+		return nil
+	}
+	return *n
+}
+
+// The graphqlBulk() method runs a single task operation through runBulk(), like the bulk
+// endpoint and the WebSocket sync do, so that it is validated, recorded and announced the
+// same way. A failed operation is reported with the status it has in a bulk response.
+func (app *application) graphqlBulk(ctx context.Context, op bulkOperation) (*data.Task, error) {
+	state := graphqlStateFrom(ctx)
+	if err := state.requireWrite(); err != nil {
+		return nil, err
+	}
+	results, _, err := app.runBulk(ctx, state.user, state.member.WorkspaceID, []bulkOperation{op})
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Error != nil {
+		return nil, graphqlError(results[0].Status, results[0].Error)
+	}
+	return results[0].Task, nil
+}
+
+func graphqlVersion(args map[string]interface{}) *int32 {
+	version, ok := args["version"].(int)
+	if !ok {
+		return nil
+	}
+	v := int32(version)
+	return &v
+}
+
+func (app *application) graphqlMutation(taskType, categoryType, tagType *graphql.Object, taskStatus, taskPriority *graphql.Enum) *graphql.Object {
+	taskInputType := &graphql.InputObject{Name: "TaskInput", Fields: map[string]*graphql.InputValue{
+		"title":       {Type: graphql.String},
+		"description": {Type: graphql.String},
+		"dueDate":     {Type: graphqlDateTime},
+		"startDate":   {Type: graphqlDateTime},
+		"priority":    {Type: taskPriority},
+		"status":      {Type: taskStatus},
+		"categoryId":  {Type: graphql.ID},
+		"category":    {Type: graphql.String, Description: "The name of the category, instead of categoryId."},
+		"recurrence":  {Type: graphql.String},
+
+		"estimateMinutes":  {Type: graphql.Int},
+		"remainingMinutes": {Type: graphql.Int},
+	}}
+	categoryInputType := &graphql.InputObject{Name: "CategoryInput", Fields: map[string]*graphql.InputValue{
+		"name":        {Type: graphql.String},
+		"description": {Type: graphql.String},
+	}}
+	categoryDeletionType := &graphql.Object{Name: "CategoryDeletion", Fields: map[string]*graphql.FieldDef{
+		"tasksDeleted":    {Type: graphql.NonNullOf(graphql.Int)},
+		"tasksReassigned": {Type: graphql.NonNullOf(graphql.Int)},
+	}}
+
+	return &graphql.Object{Name: "Mutation", Fields: map[string]*graphql.FieldDef{
+		"createTask": {
+			Type: taskType,
+			Args: map[string]*graphql.InputValue{"input": {Type: graphql.NonNullOf(taskInputType)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				input := graphqlTaskInput(p.Args["input"].(map[string]interface{}))
+				return app.graphqlBulk(p.Context, bulkOperation{Op: "create", Task: input})
+			},
+		},
+		"updateTask": {
+			Type:        taskType,
+			Description: "Changes the given fields of a task. If version is given, the update fails with a conflict when the task has changed since.",
+			Args: map[string]*graphql.InputValue{
+				"id":      {Type: graphql.NonNullOf(graphql.ID)},
+				"version": {Type: graphql.Int},
+				"input":   {Type: graphql.NonNullOf(taskInputType)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				input := graphqlTaskInput(p.Args["input"].(map[string]interface{}))
+				return app.graphqlBulk(p.Context, bulkOperation{Op: "update", ID: graphqlID(p.Args["id"]), Version: graphqlVersion(p.Args), Task: input})
+			},
+		},
+		"setTaskStatus": {
+			Type: taskType,
+			Args: map[string]*graphql.InputValue{
+				"id":      {Type: graphql.NonNullOf(graphql.ID)},
+				"version": {Type: graphql.Int},
+				"status":  {Type: graphql.NonNullOf(taskStatus)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				status := data.TaskStatus(p.Args["status"].(string))
+				return app.graphqlBulk(p.Context, bulkOperation{Op: "status", ID: graphqlID(p.Args["id"]), Version: graphqlVersion(p.Args), Status: status})
+			},
+		},
+		"deleteTask": {
+			Type:        graphql.ID,
+			Description: "Deletes a task, returning its ID.",
+			Args:        map[string]*graphql.InputValue{"id": {Type: graphql.NonNullOf(graphql.ID)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				id := graphqlID(p.Args["id"])
+				_, err := app.graphqlBulk(p.Context, bulkOperation{Op: "delete", ID: id})
+				if err != nil {
+					return nil, err
+				}
+				return id, nil
+			},
+		},
+		"createCategory": {
+			Type: categoryType,
+			Args: map[string]*graphql.InputValue{
+				"input":    {Type: graphql.NonNullOf(categoryInputType)},
+				"parentId": {Type: graphql.ID},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return app.graphqlCreateCategory(p)
+			},
+		},
+		"updateCategory": {
+			Type: categoryType,
+			Args: map[string]*graphql.InputValue{
+				"id":    {Type: graphql.NonNullOf(graphql.ID)},
+				"input": {Type: graphql.NonNullOf(categoryInputType)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return app.graphqlUpdateCategory(p)
+			},
+		},
+		"deleteCategory": {
+			Type:        categoryDeletionType,
+			Description: "Deletes a category. The strategy says what happens to its tasks, like the strategy parameter of DELETE /v1/category/{id}.",
+			Args: map[string]*graphql.InputValue{
+				"id":         {Type: graphql.NonNullOf(graphql.ID)},
+				"strategy":   {Type: graphql.String, Default: data.DeleteBlock},
+				"reassignTo": {Type: graphql.ID},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return app.graphqlDeleteCategory(p)
+			},
+		},
+		"createTag": {
+			Type:        tagType,
+			Description: "Creates a tag for the current user. Not available with an API key.",
+			Args:        map[string]*graphql.InputValue{"name": {Type: graphql.NonNullOf(graphql.String)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				state := graphqlStateFrom(p.Context)
+				if err := state.requireUser(); err != nil {
+					return nil, err
+				}
+				tag := &data.Tag{UserID: state.user.ID, Name: p.Args["name"].(string)}
+
+				v := validator.New()
+				if data.ValidateTag(v, tag); !v.Valid() {
+					return nil, graphqlError(http.StatusUnprocessableEntity, v.Errors)
+				}
+				err := app.models.Tags.Insert(p.Context, tag)
+				if err != nil {
+					switch {
+					case errors.Is(err, data.ErrDuplicateTag):
+						v.AddError("name", "a tag with this name already exists")
+						return nil, graphqlError(http.StatusUnprocessableEntity, v.Errors)
+					default:
+						return nil, err
+					}
+				}
+				return tag, nil
+			},
+		},
+		"deleteTag": {
+			Type:        graphql.ID,
+			Description: "Deletes one of the current user's tags, returning its ID. Not available with an API key.",
+			Args:        map[string]*graphql.InputValue{"id": {Type: graphql.NonNullOf(graphql.ID)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				state := graphqlStateFrom(p.Context)
+				if err := state.requireUser(); err != nil {
+					return nil, err
+				}
+				id := graphqlID(p.Args["id"])
+				err := app.models.Tags.Delete(p.Context, id, state.user.ID)
+				if err != nil {
+					switch {
+					case errors.Is(err, data.ErrRecordNotFound):
+						return nil, errGraphQLNotFound
+					default:
+						return nil, err
+					}
+				}
+				return id, nil
+			},
+		},
+		"addTagToTask": {
+			Type: taskType,
+			Args: map[string]*graphql.InputValue{
+				"taskId": {Type: graphql.NonNullOf(graphql.ID)},
+				"tagId":  {Type: graphql.NonNullOf(graphql.ID)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				task, tag, err := app.graphqlTaskAndTag(p)
+				if err != nil {
+					return nil, err
+				}
+				return task, app.models.Tags.AddToTask(p.Context, task.ID, tag.ID)
+			},
+		},
+		"removeTagFromTask": {
+			Type: taskType,
+			Args: map[string]*graphql.InputValue{
+				"taskId": {Type: graphql.NonNullOf(graphql.ID)},
+				"tagId":  {Type: graphql.NonNullOf(graphql.ID)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				task, tag, err := app.graphqlTaskAndTag(p)
+				if err != nil {
+					return nil, err
+				}
+				err = app.models.Tags.RemoveFromTask(p.Context, task.ID, tag.ID)
+				if err != nil {
+					switch {
+					case errors.Is(err, data.ErrRecordNotFound):
+						return nil, errGraphQLNotFound
+					default:
+						return nil, err
+					}
+				}
+				return task, nil
+			},
+		},
+	}}
+}
+
+// The graphqlTaskAndTag() method fetches the task and tag named by the taskId and tagId
+// arguments, like readOwnedTaskAndTag() does for the REST endpoints.
+func (app *application) graphqlTaskAndTag(p graphql.ResolveParams) (*data.Task, *data.Tag, error) {
+	state := graphqlStateFrom(p.Context)
+	if err := state.requireWrite(); err != nil {
+		return nil, nil, err
+	}
+	task, err := app.models.Tasks.GetForWorkspace(p.Context, graphqlID(p.Args["taskId"]), state.member.WorkspaceID)
+	if err == nil {
+		var tag *data.Tag
+		tag, err = app.models.Tags.Get(p.Context, graphqlID(p.Args["tagId"]), state.user.ID)
+		if err == nil {
+			return task, tag, nil
+		}
+	}
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		return nil, nil, errGraphQLNotFound
+	default:
+		return nil, nil, err
+	}
+}
+
+// The graphqlCreateCategory() method is createCategoryHandler() for GraphQL.
+func (app *application) graphqlCreateCategory(p graphql.ResolveParams) (interface{}, error) {
+	state := graphqlStateFrom(p.Context)
+	if err := state.requireWrite(); err != nil {
+		return nil, err
+	}
+
+	input := p.Args["input"].(map[string]interface{})
+	category := &data.Category{WorkspaceID: state.member.WorkspaceID}
+	category.Name, _ = input["name"].(string)
+	category.Description, _ = input["description"].(string)
+	if id, ok := p.Args["parentId"]; ok {
+		parentID := graphqlID(id)
+		category.ParentID = &parentID
+	}
+
+	v := validator.New()
+	if data.ValidateCategory(v, category); !v.Valid() {
+		return nil, graphqlError(http.StatusUnprocessableEntity, v.Errors)
+	}
+	if category.ParentID != nil {
+		_, err := app.models.Categories.Get(p.Context, *category.ParentID, category.WorkspaceID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("parent_id", "must be one of your categories")
+				return nil, graphqlError(http.StatusUnprocessableEntity, v.Errors)
+			default:
+				return nil, err
+			}
+		}
+	}
+
+	err := app.models.Categories.Insert(p.Context, category)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCategory):
+			v.AddError("name", "a category with this name already exists")
+			return nil, graphqlError(http.StatusUnprocessableEntity, v.Errors)
+		default:
+			return nil, err
+		}
+	}
+
+	app.recordAudit(state.user.ID, data.AuditCategory, category.ID, data.AuditCreate, nil, category)
+	return category, nil
+}
+
+// The graphqlUpdateCategory() method is updateCategoryHandler() for GraphQL.
+func (app *application) graphqlUpdateCategory(p graphql.ResolveParams) (interface{}, error) {
+	state := graphqlStateFrom(p.Context)
+	if err := state.requireWrite(); err != nil {
+		return nil, err
+	}
+
+	category, err := app.models.Categories.Get(p.Context, graphqlID(p.Args["id"]), state.member.WorkspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, errGraphQLNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	input := p.Args["input"].(map[string]interface{})
+	before := *category
+	if name, ok := input["name"].(string); ok {
+		category.Name = name
+	}
+	if description, ok := input["description"].(string); ok {
+		category.Description = description
+	}
+
+	v := validator.New()
+	if data.ValidateCategory(v, category); !v.Valid() {
+		return nil, graphqlError(http.StatusUnprocessableEntity, v.Errors)
+	}
+
+	err = app.models.Categories.Update(p.Context, category)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCategory):
+			v.AddError("name", "a category with this name already exists")
+			return nil, graphqlError(http.StatusUnprocessableEntity, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			return nil, graphqlError(http.StatusConflict, "unable to update the record due to an edit conflict, please try again")
+		default:
+			return nil, err
+		}
+	}
+
+	app.recordAudit(state.user.ID, data.AuditCategory, category.ID, data.AuditUpdate, &before, category)
+	return category, nil
+}
+
+// The graphqlDeleteCategory() method is deleteCategoryHandler() for GraphQL.
+func (app *application) graphqlDeleteCategory(p graphql.ResolveParams) (interface{}, error) {
+	state := graphqlStateFrom(p.Context)
+	if err := state.requireWrite(); err != nil {
+		return nil, err
+	}
+
+	strategy, _ := p.Args["strategy"].(string)
+	var target int64
+	if id, ok := p.Args["reassignTo"]; ok {
+		target = graphqlID(id)
+	}
+	v := validator.New()
+	v.Check(validator.In(strategy, data.DeleteStrategies...), "strategy", "must be one of "+strings.Join(data.DeleteStrategies, ", "))
+	if strategy == data.DeleteReassign {
+		v.Check(target > 0, "reassign_to", "must be provided when strategy is reassign")
+	}
+	if !v.Valid() {
+		return nil, graphqlError(http.StatusUnprocessableEntity, v.Errors)
+	}
+
+	userID := state.user.ID
+	workspaceID := state.member.WorkspaceID
+	category, err := app.models.Categories.Get(p.Context, graphqlID(p.Args["id"]), workspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, errGraphQLNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	deletion, err := app.models.Categories.Delete(p.Context, category.ID, workspaceID, strategy, target)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, errGraphQLNotFound
+		case errors.Is(err, data.ErrCategoryInUse):
+			return nil, graphqlError(http.StatusConflict, "the category still has tasks, delete it with strategy cascade or reassign")
+		case errors.Is(err, data.ErrInvalidReassignTarget):
+			v.AddError("reassign_to", "must be another one of your categories")
+			return nil, graphqlError(http.StatusUnprocessableEntity, v.Errors)
+		default:
+			return nil, err
+		}
+	}
+
+	app.recordAudit(userID, data.AuditCategory, category.ID, data.AuditDelete, category, nil)
+	for _, taskID := range deletion.DeletedTaskIDs {
+		app.publishTaskEvent(workspaceID, data.EventTaskDeleted, map[string]int64{"id": taskID})
+		app.recordAudit(userID, data.AuditTask, taskID, data.AuditDelete, nil, nil)
+	}
+	for _, task := range deletion.ReassignedTasks {
+		app.publishTaskUpdate(task, task.Status)
+		before := *task
+		before.CategoryID = category.ID
+		before.Category = category.Name
+		app.recordTaskUpdate(userID, before, task)
+	}
+
+	return map[string]interface{}{
+		"tasksDeleted":    len(deletion.DeletedTaskIDs),
+		"tasksReassigned": len(deletion.ReassignedTasks),
+	}, nil
+}
@@ -1,18 +1,140 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/mailer"
+	"github.com/zarinakolybaeva/DoMake/internal/redis"
+	"github.com/zarinakolybaeva/DoMake/internal/searchindex"
 )
 
+// probeTimeout is how long each dependency gets to answer a readiness check.
+const probeTimeout = 2 * time.Second
+
+// probe checks that one of the services the API depends on can be reached.
+type probe struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// The newProbes() function returns the readiness checks for the configured dependencies:
+// always the database, and SMTP, Redis and the search engine when they are in use.
+func newProbes(cfg config, db *sql.DB, m mailer.Mailer, limiterRedis, cacheRedis *redis.Client, searchIndex searchindex.Index) []probe {
+	probes := []probe{{name: "database", check: db.PingContext}}
+	if cfg.mail.backend == "smtp" && cfg.smtp.host != "" {
+		probes = append(probes, probe{name: "smtp", check: withContext(m.Ping)})
+	}
+	if limiterRedis != nil {
+		probes = append(probes, probe{name: "limiter_redis", check: withContext(limiterRedis.Ping)})
+	}
+	if cacheRedis != nil {
+		probes = append(probes, probe{name: "cache_redis", check: withContext(cacheRedis.Ping)})
+	}
+	if searchIndex != nil {
+		probes = append(probes, probe{name: "search_engine", check: searchIndex.Ping})
+	}
+	return probes
+}
+
+// The withContext() helper turns a check which can't be cancelled into one which gives up
+// when ctx is done. The check itself carries on in the background until its own timeout.
+func withContext(fn func() error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		result := make(chan error, 1)
+		go func() {
+			result <- fn()
+		}()
+		select {
+		case err := <-result:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
+	// The schema version is reported as null if it can't be read, e.g. because the
+	// database is down; the readiness check is the place to find out about that.
+	schema, err := app.models.Schema.Version(r.Context())
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.logError(r, err)
+	}
 	env := envelope{
 		"status": "available",
-		"system_info": map[string]string{
+		"system_info": map[string]interface{}{
 			"environment": app.config.env,
 			"version":     version,
+			"schema":      schema,
 		},
 	}
-	err := app.writeJSON(w, http.StatusOK, env, nil)
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The livenessHandler reports that the process is up and serving requests. It doesn't
+// look at any dependencies, so that an outage elsewhere doesn't get the API restarted.
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readinessHandler checks every dependency at the same time and reports the status and
+// latency of each. If any of them is down it responds with 503 Service Unavailable, so
+// that load balancers stop sending traffic here until it recovers.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	type checkResult struct {
+		Status    string  `json:"status"`
+		LatencyMS float64 `json:"latency_ms"`
+		Error     string  `json:"error,omitempty"`
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		ready  = true
+		checks = make(map[string]checkResult, len(app.probes))
+	)
+	for _, p := range app.probes {
+		wg.Add(1)
+		go func(p probe) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := p.check(ctx)
+			result := checkResult{Status: "up", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				result.Status = "down"
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			checks[p.name] = result
+			if err != nil {
+				ready = false
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	err := app.writeJSON(w, code, envelope{"status": status, "checks": checks}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"github.com/zarinakolybaeva/DoMake/internal/validator"
 	"io"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -17,37 +21,211 @@ import (
 // Retrieve the "id" URL parameter from the current request context, then convert it to an integer and return it.
 // If the operation isn't successful, return 0 and an error.
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// The readNamedIDParam() helper works like readIDParam(), but for routes with more than one
+// ID in the path (e.g. /v1/tasks/:id/subtasks/:subtask_id).
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
 
+// The dispatchIDParam() helper lets fixed path segments live next to an :id parameter.
+// httprouter doesn't allow registering both /v1/tasks/bulk and /v1/tasks/:id, so we register
+// only the :id route and pick the handler here: if the parameter matches one of the keys in
+// static, that handler runs, otherwise the request falls through to fallback.
+func (app *application) dispatchIDParam(static map[string]http.HandlerFunc, fallback http.HandlerFunc) http.HandlerFunc {
+	return app.dispatchParam("id", static, fallback)
+}
+
+// The dispatchParam() helper is dispatchIDParam() for a parameter with another name.
+func (app *application) dispatchParam(name string, static map[string]http.HandlerFunc, fallback http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		if handler, ok := static[params.ByName(name)]; ok {
+			handler(w, r)
+			return
+		}
+		fallback(w, r)
+	}
+}
+
 // Define an envelope type.
 type envelope map[string]interface{}
 
 // Change the data parameter to have the type envelope instead of interface{}.
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
+	data, err := projectEnvelope(w, status, data)
 	if err != nil {
 		return err
 	}
-	js = append(js, '\n')
+	return app.writeJSONBody(w, status, versionedBody(w, data), headers)
+}
+
+// The writeJSONBody() helper is writeJSON() for bodies that aren't envelopes, and so are
+// the same in every API version, such as GraphQL responses.
+func (app *application) writeJSONBody(w http.ResponseWriter, status int, body interface{}, headers http.Header) error {
+	js, err := encodeJSON(body)
+	if err != nil {
+		return err
+	}
+	// The headers are added after the Content-Type, so that they can override it.
+	w.Header().Set("Content-Type", "application/json")
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
-	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	w.Write(js)
 	return nil
 }
 
+// encodeJSON encodes a response body as writeJSON() sends it: indented with tabs, and
+// ending in a newline.
+func encodeJSON(body interface{}) ([]byte, error) {
+	js, err := json.MarshalIndent(body, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(js, '\n'), nil
+}
+
+// jsonStream writes an envelope holding a long list, such as a large page of tasks, without
+// holding the whole list in memory: each element is encoded and written as soon as it is
+// added. The output is laid out like writeJSON()'s, with the list under key and the fields
+// passed to close() after it. The status line is sent with the first element, after which
+// errors can no longer be reported to the client; see started().
+type jsonStream struct {
+	w       http.ResponseWriter
+	status  int
+	key     string
+	headers http.Header
+	count   int
+	opened  bool
+}
+
+// The newJSONStream() helper prepares a jsonStream for a response. Nothing is written until
+// the first element is added or the stream is closed.
+func (app *application) newJSONStream(w http.ResponseWriter, status int, key string, headers http.Header) *jsonStream {
+	return &jsonStream{w: w, status: status, key: key, headers: headers}
+}
+
+// started reports whether the status line has been sent, in which case an error response
+// can no longer be sent instead.
+func (s *jsonStream) started() bool {
+	return s.opened
+}
+
+func (s *jsonStream) open() error {
+	if s.opened {
+		return nil
+	}
+	s.opened = true
+	for key, value := range s.headers {
+		s.w.Header()[key] = value
+	}
+	s.w.Header().Set("Content-Type", "application/json")
+	s.w.WriteHeader(s.status)
+	key, err := json.Marshal(s.key)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "{\n\t%s: [", key)
+	return err
+}
+
+// write adds an element to the list.
+func (s *jsonStream) write(value interface{}) error {
+	value, err := projectElement(s.w, value)
+	if err != nil {
+		return err
+	}
+	js, err := json.MarshalIndent(value, "\t\t", "\t")
+	if err != nil {
+		return err
+	}
+	err = s.open()
+	if err != nil {
+		return err
+	}
+	separator := "\n\t\t"
+	if s.count > 0 {
+		separator = "," + separator
+	}
+	s.count++
+	_, err = io.WriteString(s.w, separator)
+	if err == nil {
+		_, err = s.w.Write(js)
+	}
+	return err
+}
+
+// close ends the list and writes the remaining fields of the envelope, which often depend on
+// the whole list (like the pagination metadata), sorted by name as writeJSON() does.
+func (s *jsonStream) close(trailer envelope) error {
+	err := s.open()
+	if err != nil {
+		return err
+	}
+	end := "]"
+	if s.count > 0 {
+		end = "\n\t]"
+	}
+	_, err = io.WriteString(s.w, end)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(trailer))
+	for key := range trailer {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		js, err := json.MarshalIndent(trailer[key], "\t", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(s.w, ",\n\t%s: %s", name, js)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(s.w, "\n}\n")
+	return err
+}
+
+// errUnsupportedMediaType is returned by readJSON() for bodies that aren't JSON, which
+// badRequestResponse() answers with 415 Unsupported Media Type.
+var errUnsupportedMediaType = errors.New("body must be JSON, sent with the Content-Type application/json")
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
-	// Use http.MaxBytesReader() to limit the size of the request body to 1MB.
-	maxBytes := 1_048_576
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	// Limit the size of the request body to 1MB.
+	return app.readJSONLimit(w, r, dst, 1_048_576)
+}
+
+// The readJSONLimit() helper is readJSON() with a custom body size limit, for the few
+// endpoints (such as restoring a backup) that accept larger documents.
+func (app *application) readJSONLimit(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) error {
+	// Refuse bodies of other types before reading them. Requests without a Content-Type
+	// are taken to be JSON.
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+			return errUnsupportedMediaType
+		}
+	}
+
+	// Use http.MaxBytesReader() to limit the size of the request body.
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 
 	// Initialize the json.Decoder, and call the DisallowUnknownFields() method on it before decoding.
 	// This means that if the JSON from the client now includes any field which cannot be mapped to the target destination,
@@ -83,7 +261,7 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
 			return fmt.Errorf("body contains unknown key %s", fieldName)
 
-		// If the request body exceeds 1MB in size the decode will now fail with the
+		// If the request body exceeds the limit the decode will now fail with the
 		// error "http: request body too large". There is an open issue about turning
 		// this into a distinct error type at https://github.com/golang/go/issues/30715.
 		case err.Error() == "http: request body too large":
@@ -121,15 +299,40 @@ func (app *application) readString(qs url.Values, key string, defaultValue strin
 
 // The readCSV() helper reads a string value from the query string and then splits it into a slice on the comma character.
 // If no matching key could be found, it returns the provided default value.
-func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
+// If the value contains more than max elements, then we record an error message naming the parameter in the provided
+// Validator instance and return the default value. Each caller picks the limit that suits its parameter.
+func (app *application) readCSV(qs url.Values, key string, defaultValue []string, max int, v *validator.Validator) []string {
 	// Extract the value from the query string.
 	csv := qs.Get(key)
 	// If no key exists (or the value is empty) then return the default value.
 	if csv == "" {
 		return defaultValue
 	}
-	// Otherwise parse the value into a []string slice and return it.
-	return strings.Split(csv, ",")
+	// Otherwise parse the value into a []string slice.
+	values := strings.Split(csv, ",")
+	// Reject oversized lists before they reach the database as an ANY($1) array.
+	if len(values) > max {
+		v.AddError(key, fmt.Sprintf("must not contain more than %d values", max))
+		return defaultValue
+	}
+	return values
+}
+
+// The readIDs() helper reads a comma-separated list of record IDs from the query string, e.g. ?ids=1,2,3, of at
+// most max IDs like readCSV(). If no matching key could be found, it returns an empty slice.
+// If any of the values isn't a valid ID, then we record an error message in the provided Validator instance.
+func (app *application) readIDs(qs url.Values, key string, max int, v *validator.Validator) []int64 {
+	values := app.readCSV(qs, key, []string{}, max, v)
+	ids := make([]int64, 0, len(values))
+	for _, value := range values {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id < 1 {
+			v.AddError(key, "must be a comma-separated list of IDs")
+			return []int64{}
+		}
+		ids = append(ids, id)
+	}
+	return ids
 }
 
 // The readInt() helper reads a string value from the query string and converts it to an integer before returning.
@@ -153,18 +356,126 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// The readBool() helper reads a string value from the query string and converts it to a boolean before returning.
+// If no matching key could be found it returns the provided default value.
+// If the value couldn't be converted to a boolean, then we record an error message in the provided Validator instance.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+// The readRender() helper reads the render query string parameter, with which clients ask
+// for the Markdown in task descriptions and comments to be sent rendered as HTML as well.
+// HTML is the only format there is; it reports whether it was asked for.
+func (app *application) readRender(qs url.Values, v *validator.Validator) bool {
+	render := qs.Get("render")
+	v.Check(render == "" || render == "html", "render", fmt.Sprintf(validator.MsgOneOf, "html"))
+	return render == "html"
+}
+
+// The readTime() helper reads a date or date-time value from the query string. It accepts
+// RFC 3339 timestamps, plain dates (2006-01-02) and the "2006-01-02 15:04:05" layout used by
+// data.CustomTime; values without an explicit offset are read in the time zone loc, which
+// is normally the user's. If the value can't be parsed, we record an error message in the
+// provided Validator instance.
+func (app *application) readTime(qs url.Values, key string, defaultValue time.Time, loc *time.Location, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	t, ok := app.parseTime(s, loc)
+	if !ok {
+		v.AddError(key, "must be a date (2006-01-02) or RFC 3339 timestamp")
+		return defaultValue
+	}
+	return t
+}
+
+// The parseTime() helper accepts an RFC 3339 timestamp, or a date with or without a
+// time of day ("2006-01-02 15:04:05" or "2006-01-02"), which is read in the time zone loc.
+func (app *application) parseTime(s string, loc *time.Location) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, true
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		t, err := time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
 func (app *application) background(fn func()) {
 	// Increment the WaitGroup counter.
 	app.wg.Add(1)
+	app.metrics.background.Inc()
 	// Launch the background goroutine.
 	go func() {
 		// Use defer to decrement the WaitGroup counter before the goroutine returns.
 		defer app.wg.Done()
+		defer app.metrics.background.Dec()
 		defer func() {
 			if err := recover(); err != nil {
+				app.metrics.backgroundPanic.Inc()
 				app.logger.PrintError(fmt.Errorf("%s", err), nil)
 			}
 		}()
 		fn()
 	}()
 }
+
+// The backgroundTicker() helper runs fn every interval in a background goroutine until
+// the application starts shutting down. Like background(), it is tracked by the
+// WaitGroup so that serve() waits for the current run to finish, and a panic in fn is
+// logged rather than taking down the whole process. The name labels the job's metrics.
+// Runs are skipped in maintenance mode.
+func (app *application) backgroundTicker(name string, interval time.Duration, fn func()) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-app.done:
+				return
+			case <-ticker.C:
+				if app.maintenance.enabled() {
+					continue
+				}
+				func() {
+					start := time.Now()
+					defer func() {
+						if err := recover(); err != nil {
+							app.metrics.jobPanics.Inc(name)
+							app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{"job": name})
+						}
+						app.metrics.jobRuns.Inc(name)
+						app.metrics.jobDuration.Observe(time.Since(start).Seconds(), name)
+					}()
+					fn()
+				}()
+			}
+		}
+	}()
+}
+
+// The clientIP() helper returns the IP address of the client that made the request,
+// without the port.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
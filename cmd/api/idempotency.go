@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/tracing"
+)
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key header we accept.
+const maxIdempotencyKeyLength = 255
+
+// The idempotent() middleware makes a POST endpoint safe to retry. When a request carries
+// an Idempotency-Key header, its response is stored, and a later request from the same
+// user with the same key gets that response back (with an Idempotent-Replayed header)
+// instead of running the handler again. Reusing a key for a different request is
+// rejected, as is a retry that arrives while the first request is still running.
+// Requests without the header are passed through unchanged.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		user := app.contextGetUser(r)
+		if key == "" || user.IsAnonymous() {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			app.badRequestResponse(w, r, fmt.Errorf("Idempotency-Key header must not be more than %d bytes long", maxIdempotencyKeyLength))
+			return
+		}
+
+		// Read the body so that it can be fingerprinted, then put it back for the handler.
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBackupBytes))
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBackupBytes))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.RequestURI())
+		// /v2/ requests are routed as /v1/ ones but get different responses, so a key
+		// used with one version can't be replayed for the other.
+		if apiVersion(w) == apiV2 {
+			fmt.Fprintf(hash, "v2\n")
+		}
+		// Likewise for the workspace: the same request against another workspace (through
+		// X-Workspace-ID) is a different request. Endpoints that aren't scoped to a
+		// workspace have none in the context.
+		if member, ok := r.Context().Value(workspaceContextKey).(*data.Member); ok {
+			fmt.Fprintf(hash, "workspace %d\n", member.WorkspaceID)
+		}
+		hash.Write(body)
+		requestHash := hash.Sum(nil)
+
+		stored, reserved, err := app.models.Idempotency.Reserve(r.Context(), user.ID, key, requestHash, app.config.idempotency.ttl)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.idempotencyConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !reserved {
+			switch {
+			case !bytes.Equal(stored.RequestHash, requestHash):
+				message := "the Idempotency-Key has already been used for a different request"
+				app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+			case !stored.Completed:
+				app.idempotencyConflictResponse(w, r)
+			default:
+				for name, values := range stored.Header {
+					// The middleware has already added most of the Vary values again.
+					if name == "Vary" {
+						for _, value := range values {
+							if !slices.Contains(w.Header().Values("Vary"), value) {
+								w.Header().Add("Vary", value)
+							}
+						}
+						continue
+					}
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(stored.StatusCode)
+				w.Write(stored.Body)
+			}
+			return
+		}
+
+		// If the handler panics or fails with a server error, release the key so that
+		// the client can try again, rather than replaying the failure.
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			err := app.models.Idempotency.Release(tracing.Detach(r.Context()), user.ID, key)
+			if err != nil {
+				app.logError(r, err)
+			}
+		}()
+
+		next(rec, r)
+
+		if rec.status >= http.StatusInternalServerError {
+			return
+		}
+		stored.StatusCode = rec.status
+		header := w.Header().Clone()
+		// The recorded body is the one the handler wrote, before compressResponses()
+		// compressed it. The headers describing the encoding are left out, so that a
+		// replay is compressed afresh (or not) for the client retrying it.
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+		stored.Header = header
+		stored.Body = rec.body.Bytes()
+		err = app.models.Idempotency.Complete(tracing.Detach(r.Context()), stored)
+		if err != nil {
+			// The response has already been sent, so just log the problem.
+			app.logError(r, err)
+			return
+		}
+		completed = true
+	}
+}
+
+// The startIdempotencyCleanup() method starts a background job which deletes expired
+// idempotency keys.
+func (app *application) startIdempotencyCleanup() {
+	app.backgroundTicker("idempotency_cleanup", time.Hour, func() {
+		err := app.models.Idempotency.DeleteExpired(context.Background())
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+func (app *application) idempotencyConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with this Idempotency-Key is still being processed, please try again later"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// responseRecorder passes a response through to the client while keeping a copy of its
+// status code and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
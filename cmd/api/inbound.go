@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// inboundTolerance is how far the timestamp of a request to an inbound integration may be
+// from the server's clock. The signatures of the requests received are kept for twice as
+// long, see startInboundCleanup(), so that any request still within it can be recognised
+// as a replay.
+const inboundTolerance = 5 * time.Minute
+
+// The headers of the requests to POST /v1/integrations/inbound/:provider. The signature
+// is the HMAC-SHA256 of the timestamp, a dot and the body, keyed with the integration's
+// secret, hex encoded after "sha256=" as in X-Webhook-Signature.
+const (
+	inboundIntegrationHeader = "X-Inbound-Integration"
+	inboundTimestampHeader   = "X-Inbound-Timestamp"
+	inboundSignatureHeader   = "X-Inbound-Signature"
+)
+
+func (app *application) listInboundIntegrationsHandler(w http.ResponseWriter, r *http.Request) {
+	integrations, err := app.models.Inbound.GetAllForUser(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"inbound_integrations": integrations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createInboundIntegrationHandler sets up an inbound integration that creates tasks
+// in a category of the workspace of the request, on behalf of the current user.
+func (app *application) createInboundIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Provider   string `json:"provider"`
+		CategoryID int64  `json:"category_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	integration := &data.InboundIntegration{
+		UserID:      app.contextGetUser(r).ID,
+		WorkspaceID: app.contextGetWorkspace(r).WorkspaceID,
+		CategoryID:  input.CategoryID,
+		Provider:    input.Provider,
+	}
+	v := validator.New()
+	if data.ValidateInboundIntegration(v, integration); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, err = app.models.Categories.Get(r.Context(), integration.CategoryID, integration.WorkspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("category_id", "must be one of your categories")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	integration.Secret, err = data.GenerateWebhookSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Inbound.Insert(r.Context(), integration)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// This is the only time the secret is sent back, so the client must store it now.
+	err = app.writeJSON(w, http.StatusCreated, envelope{
+		"inbound_integration": integration,
+		"secret":              integration.Secret,
+		"url":                 "/v1/integrations/inbound/" + integration.Provider,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteInboundIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readNamedIDParam(r, "name")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Inbound.Delete(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "inbound integration successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The receiveInboundHandler creates a task from a request pushed by another service, such
+// as an email gateway or a Zapier zap. The request isn't authenticated; it is signed with
+// the secret of the integration named in X-Inbound-Integration, see verifyInbound(), and
+// each signed request is only accepted once.
+func (app *application) receiveInboundHandler(w http.ResponseWriter, r *http.Request) {
+	provider := httprouter.ParamsFromContext(r.Context()).ByName("name")
+	if !validator.In(provider, data.InboundProviders...) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// The body is read whole for the signature, then decoded as usual. Its size is
+	// limited by limitRequests().
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	integration, signature, ok := app.verifyInbound(w, r, provider, body)
+	if !ok {
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	user, err := app.models.Users.Get(r.Context(), integration.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if user.Deactivated {
+		app.deactivatedAccountResponse(w, r)
+		return
+	}
+	if !user.Activated {
+		app.inactiveAccountResponse(w, r)
+		return
+	}
+	// The user may have lost write access to the workspace since setting up the
+	// integration.
+	member, err := app.models.Workspaces.GetMember(r.Context(), integration.WorkspaceID, user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if member == nil || !data.RoleAllows(member.Role, data.RoleMember) {
+		app.notPermittedResponses(w, r)
+		return
+	}
+
+	task, ok := app.readInboundTask(w, r, provider, user)
+	if !ok {
+		return
+	}
+	task.UserID = user.ID
+	task.WorkspaceID = integration.WorkspaceID
+	task.CategoryID = integration.CategoryID
+
+	v := validator.New()
+	err = app.validateTask(r.Context(), v, task)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Only requests that would create a task are remembered, so that the sender can fix
+	// and resend one that was refused.
+	fresh, err := app.models.Inbound.RecordDelivery(r.Context(), integration, signature)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !fresh {
+		app.errorResponse(w, r, http.StatusConflict, "this request has already been received")
+		return
+	}
+
+	err = app.models.Tasks.Insert(r.Context(), task)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.publishTaskEvent(task.WorkspaceID, data.EventTaskCreated, task)
+	app.recordAudit(task.UserID, data.AuditTask, task.ID, data.AuditCreate, nil, task)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tasks/%d", task.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"task": app.localTask(user, task)}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The verifyInbound() helper checks the signature of a request to an inbound integration
+// of the provider, and that its timestamp is within inboundTolerance of now. It returns
+// the integration and the signature, or sends a 401 Unauthorized and returns false.
+// Unknown integrations are refused like bad signatures, so that their IDs can't be probed.
+func (app *application) verifyInbound(w http.ResponseWriter, r *http.Request, provider string, body []byte) (*data.InboundIntegration, string, bool) {
+	id, err := strconv.ParseInt(r.Header.Get(inboundIntegrationHeader), 10, 64)
+	if err != nil {
+		app.invalidSignatureResponse(w, r)
+		return nil, "", false
+	}
+	timestamp := r.Header.Get(inboundTimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		app.invalidSignatureResponse(w, r)
+		return nil, "", false
+	}
+	if skew := app.now().Sub(time.Unix(seconds, 0)); skew > inboundTolerance || skew < -inboundTolerance {
+		app.errorResponse(w, r, http.StatusUnauthorized, fmt.Sprintf("%s must be within %d minutes of the current time", inboundTimestampHeader, int(inboundTolerance.Minutes())))
+		return nil, "", false
+	}
+	signature, ok := strings.CutPrefix(r.Header.Get(inboundSignatureHeader), "sha256=")
+	if !ok {
+		app.invalidSignatureResponse(w, r)
+		return nil, "", false
+	}
+	sum, err := hex.DecodeString(signature)
+	if err != nil {
+		app.invalidSignatureResponse(w, r)
+		return nil, "", false
+	}
+
+	integration, err := app.models.Inbound.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidSignatureResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, "", false
+	}
+
+	mac := hmac.New(sha256.New, []byte(integration.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(sum, mac.Sum(nil)) || integration.Provider != provider {
+		app.invalidSignatureResponse(w, r)
+		return nil, "", false
+	}
+	return integration, hex.EncodeToString(sum), true
+}
+
+// The readInboundTask() helper reads the task in the body of a request from the provider:
+// an email's subject and text, or a task much like the body of POST /v1/tasks. It sends
+// the error response itself and returns false if the body can't be read.
+func (app *application) readInboundTask(w http.ResponseWriter, r *http.Request, provider string, user *data.User) (*data.Task, bool) {
+	task := &data.Task{Status: data.StatusTodo, Priority: data.PriorityMedium}
+
+	switch provider {
+	case data.InboundEmail:
+		var input struct {
+			From    string `json:"from"`
+			Subject string `json:"subject"`
+			Text    string `json:"text"`
+		}
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return nil, false
+		}
+		task.Title = strings.TrimSpace(input.Subject)
+		task.Description = strings.TrimSpace(input.Text)
+		// Tasks need a description, which an email may not have.
+		if task.Description == "" && input.From != "" {
+			task.Description = "Sent by email from " + input.From
+		}
+	default:
+		var input struct {
+			Title       string            `json:"title"`
+			Description string            `json:"description"`
+			DueDate     data.CustomTime   `json:"due_date"`
+			Priority    data.TaskPriority `json:"priority"`
+		}
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return nil, false
+		}
+		task.Title = input.Title
+		task.Description = input.Description
+		task.DueDate = input.DueDate.ResolveDate(app.userLocation(user))
+		if input.Priority != "" {
+			task.Priority = input.Priority
+		}
+	}
+	return task, true
+}
+
+// The startInboundCleanup() method starts a background job which forgets the signatures
+// of inbound requests too old to be accepted again.
+func (app *application) startInboundCleanup() {
+	app.backgroundTicker("inbound_delivery_cleanup", time.Hour, func() {
+		err := app.models.Inbound.DeleteOldDeliveries(context.Background(), 2*inboundTolerance)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+func (app *application) invalidSignatureResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("invalid or missing %s signature", inboundSignatureHeader)
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
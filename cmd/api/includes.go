@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// taskIncludeNames lists the related resources that ?include= can embed in tasks. The
+// tasks in lists always embed their category, so include=category only changes GET
+// /v1/tasks/:id.
+var taskIncludeNames = []string{"category", "subtasks", "tags"}
+
+// The readInclude() helper reads ?include=, the comma-separated list of related resources
+// to embed in the tasks of a response, e.g. ?include=subtasks,tags. If any of them isn't
+// one of taskIncludeNames, we record an error message in the provided Validator instance.
+func (app *application) readInclude(qs url.Values, v *validator.Validator) map[string]bool {
+	include := make(map[string]bool)
+	for _, name := range app.readCSV(qs, "include", nil, len(taskIncludeNames), v) {
+		if !validator.In(name, taskIncludeNames...) {
+			v.AddError("include", fmt.Sprintf(validator.MsgOneOf, strings.Join(taskIncludeNames, ", ")))
+			break
+		}
+		include[name] = true
+	}
+	return include
+}
+
+// categoryFieldNames lists the fields of the category embedded in the tasks of lists that
+// ?category_fields= can pick, e.g. ?category_fields=id,name,description. Without it the
+// tasks carry defaultCategoryFields, to keep long lists small.
+var (
+	categoryFieldNames    = []string{"id", "created_at", "updated_at", "workspace_id", "parent_id", "name", "description", "version"}
+	defaultCategoryFields = []string{"id", "name"}
+)
+
+// The readCategoryFields() helper reads ?category_fields=. If any of the names isn't one of
+// categoryFieldNames, we record an error message in the provided Validator instance.
+func (app *application) readCategoryFields(qs url.Values, v *validator.Validator) []string {
+	fields := app.readCSV(qs, "category_fields", defaultCategoryFields, len(categoryFieldNames), v)
+	for _, name := range fields {
+		if !validator.In(name, categoryFieldNames...) {
+			v.AddError("category_fields", fmt.Sprintf(validator.MsgOneOf, strings.Join(categoryFieldNames, ", ")))
+			break
+		}
+	}
+	return fields
+}
+
+// categoryDetails is the category embedded in a task of a list, cut down to the fields
+// that readCategoryFields() returned, in the same way as ?fields= cuts down the task.
+type categoryDetails struct {
+	category *data.Category
+	fields   []string
+}
+
+func (c categoryDetails) MarshalJSON() ([]byte, error) {
+	projected, err := project(c.category, c.fields)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(projected)
+}
+
+// taskIncludes holds the related resources embedded in a task with ?include=subtasks and
+// ?include=tags. Each is left out of the task unless it was asked for.
+type taskIncludes struct {
+	Subtasks *[]*data.Subtask `json:"subtasks,omitempty"`
+	Tags     *[]*data.Tag     `json:"tags,omitempty"`
+}
+
+// The loadTaskIncludes() helper loads the subtasks and tags of a list of tasks as include
+// asks, with a single query each for the whole list rather than one per task. The tags are
+// the user's own. The result has an element for each of the tasks, in the same order.
+func (app *application) loadTaskIncludes(ctx context.Context, user *data.User, taskIDs []int64, include map[string]bool) ([]taskIncludes, error) {
+	includes := make([]taskIncludes, len(taskIDs))
+
+	if include["subtasks"] {
+		subtasks, err := app.models.Subtasks.GetForTasks(ctx, taskIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range taskIDs {
+			list := subtasks[id]
+			if list == nil {
+				list = []*data.Subtask{}
+			}
+			includes[i].Subtasks = &list
+		}
+	}
+
+	if include["tags"] {
+		tags, err := app.models.Tags.GetForTasks(ctx, taskIDs, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range taskIDs {
+			list := tags[id]
+			if list == nil {
+				list = []*data.Tag{}
+			}
+			includes[i].Tags = &list
+		}
+	}
+
+	return includes, nil
+}
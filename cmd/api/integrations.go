@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/zarinakolybaeva/DoMake/internal/chat"
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/i18n"
+	"github.com/zarinakolybaeva/DoMake/internal/tracing"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// chatNotificationKinds are the kinds of notifications which are also sent to the user's
+// chat integrations. Tasks have no assignees yet; assignment notifications will go out
+// the same way once they do.
+var chatNotificationKinds = map[string]bool{
+	data.NotificationReminder: true,
+}
+
+// integrationNames are the names of the chat services, as shown to users.
+var integrationNames = map[string]string{
+	data.IntegrationSlack:    "Slack",
+	data.IntegrationTelegram: "Telegram",
+}
+
+// integrationTestMessage is what POST /v1/integrations/:kind/test sends.
+const integrationTestMessage = "This is a test message from Taskninja. Your reminders will be sent here."
+
+func (app *application) listIntegrationsHandler(w http.ResponseWriter, r *http.Request) {
+	integrations, err := app.models.Integrations.GetAllForUser(r.Context(), app.contextGetUser(r).ID, false)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"integrations": integrations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The updateIntegrationHandler() sets up the current user's integration of the kind in
+// the path, or changes it. Fields left out keep their current values, so that it can be
+// turned off and on again without sending its credentials each time.
+func (app *application) updateIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := app.readIntegrationKind(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		WebhookURL *string `json:"webhook_url"`
+		BotToken   *string `json:"bot_token"`
+		ChatID     *string `json:"chat_id"`
+		Enabled    *bool   `json:"enabled"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	integration, err := app.models.Integrations.Get(r.Context(), user.ID, kind)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			integration = &data.Integration{UserID: user.ID, Kind: kind, Enabled: true}
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	status := http.StatusOK
+	if integration.ID == 0 {
+		status = http.StatusCreated
+	}
+
+	if input.WebhookURL != nil {
+		integration.WebhookURL = *input.WebhookURL
+	}
+	if input.BotToken != nil {
+		integration.BotToken = *input.BotToken
+	}
+	if input.ChatID != nil {
+		integration.ChatID = *input.ChatID
+	}
+	if input.Enabled != nil {
+		integration.Enabled = *input.Enabled
+	}
+
+	v := validator.New()
+	if data.ValidateIntegration(v, integration); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Integrations.Save(r.Context(), integration)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, status, envelope{"integration": integration}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := app.readIntegrationKind(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Integrations.Delete(r.Context(), app.contextGetUser(r).ID, kind)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "integration successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The testIntegrationHandler() sends a test message with one of the current user's
+// integrations straight away, even if it is turned off, so that they can check that it is
+// set up right. If the chat service doesn't accept the message, its error is sent back
+// with a 502 Bad Gateway, and kept on the integration like any other failed delivery.
+func (app *application) testIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	kind, ok := app.readIntegrationKind(w, r)
+	if !ok {
+		return
+	}
+
+	integration, err := app.models.Integrations.Get(r.Context(), app.contextGetUser(r).ID, kind)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	sendErr := app.sendChatMessage(r.Context(), integration, app.messages.Translate(app.language(r), integrationTestMessage))
+	_, err = app.models.Integrations.RecordDelivery(r.Context(), integration, sendErr)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if sendErr != nil {
+		app.integrationDeliveryFailedResponse(w, r, sendErr)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "test message sent", "integration": integration}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readIntegrationKind() helper reads the kind of integration from the path, sending a
+// 404 Not Found response and returning false if there is no such kind.
+func (app *application) readIntegrationKind(w http.ResponseWriter, r *http.Request) (string, bool) {
+	kind := httprouter.ParamsFromContext(r.Context()).ByName("kind")
+	if !validator.In(kind, data.IntegrationKinds...) {
+		app.notFoundResponse(w, r)
+		return "", false
+	}
+	return kind, true
+}
+
+// The sendToChats() helper sends a notification to each of its user's enabled chat
+// integrations, in their language. When an integration that was working starts to fail,
+// the user is told in the notification center; the error is kept on the integration
+// until a message gets through again.
+func (app *application) sendToChats(notification *data.Notification) {
+	ctx := context.Background()
+	logProperties := map[string]string{"kind": notification.Kind, "user_id": strconv.FormatInt(notification.UserID, 10)}
+
+	integrations, err := app.models.Integrations.GetAllForUser(ctx, notification.UserID, true)
+	if err != nil {
+		app.logger.PrintError(err, logProperties)
+		return
+	}
+	if len(integrations) == 0 {
+		return
+	}
+	text := app.messages.Translate(app.userLanguage(ctx, notification.UserID), notification.Message)
+
+	for _, integration := range integrations {
+		sendErr := app.sendChatMessage(ctx, integration, text)
+		startedFailing, err := app.models.Integrations.RecordDelivery(ctx, integration, sendErr)
+		if err != nil {
+			app.logger.PrintError(err, logProperties)
+			continue
+		}
+		if sendErr != nil {
+			app.logger.PrintError(sendErr, logProperties)
+		}
+		if !startedFailing {
+			continue
+		}
+
+		err = app.models.Notifications.Insert(ctx, &data.Notification{
+			UserID:  notification.UserID,
+			Kind:    data.NotificationIntegrationFailed,
+			Message: fmt.Sprintf("could not send notifications to %s: %s", integrationNames[integration.Kind], sendErr),
+		})
+		if err != nil {
+			app.logger.PrintError(err, logProperties)
+		}
+	}
+}
+
+// The sendChatMessage() helper sends a message with an integration, in a span of its own.
+func (app *application) sendChatMessage(ctx context.Context, integration *data.Integration, text string) error {
+	ctx, span := app.tracer.Start(ctx, "chat.send", tracing.KindClient)
+	defer span.End()
+	span.SetAttribute("chat.service", integration.Kind)
+
+	var sender chat.Sender
+	switch integration.Kind {
+	case data.IntegrationSlack:
+		sender = chat.NewSlack(integration.WebhookURL)
+	default:
+		sender = chat.NewTelegram(integration.BotToken, integration.ChatID)
+	}
+	err := sender.Send(ctx, text)
+	span.SetError(err)
+	return err
+}
+
+// The userLanguage() method returns the language a user has chosen for messages, or
+// English if they haven't chosen one or their settings can't be read.
+func (app *application) userLanguage(ctx context.Context, userID int64) string {
+	settings, err := app.models.Settings.Get(ctx, userID)
+	if err == nil && settings.Locale != "" {
+		return settings.Locale
+	}
+	return i18n.English
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenSystemd is the -listen value that serves on the socket passed by systemd.
+const listenSystemd = "systemd"
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation, after
+// stdin, stdout and stderr.
+const listenFDsStart = 3
+
+// The listen() method opens the listener the API is served on: TCP on -port by default,
+// the Unix socket at the path of -listen=unix:/path, or with -listen=systemd the socket
+// that systemd passed on activation.
+func (app *application) listen() (net.Listener, error) {
+	switch {
+	case app.config.listen.addr == listenSystemd:
+		return systemdListener()
+	case strings.HasPrefix(app.config.listen.addr, "unix:"):
+		return app.unixListener(strings.TrimPrefix(app.config.listen.addr, "unix:"))
+	default:
+		return net.Listen("tcp", fmt.Sprintf(":%d", app.config.port))
+	}
+}
+
+// The unixListener() method listens on the Unix socket at path, with the permissions of
+// -listen-socket-mode so that a reverse proxy running as another user can connect. A
+// socket left behind by a server that didn't stop cleanly is removed first, but nothing
+// else at path is. The socket is removed when the listener is closed.
+func (app *application) unixListener(path string) (net.Listener, error) {
+	info, err := os.Lstat(path)
+	switch {
+	case err == nil && info.Mode()&os.ModeSocket == 0:
+		return nil, fmt.Errorf("%s exists and isn't a socket", path)
+	case err == nil:
+		// Only remove the socket if no server is still listening on it.
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is created with the permissions allowed by the umask, so they are set
+	// afterwards.
+	if err := os.Chmod(path, app.config.listen.socketMode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// The systemdListener() helper returns the listening socket that systemd passes to the
+// services it starts on a connection to a socket unit, following sd_listen_fds(3). The
+// environment variables are cleared so that child processes don't take the socket too.
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("no socket was passed by systemd (LISTEN_PID isn't set to this process)")
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, errors.New("no socket was passed by systemd (LISTEN_FDS isn't set)")
+	}
+	if fds > 1 {
+		return nil, fmt.Errorf("systemd passed %d sockets, but only one can be served", fds)
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(listenFDsStart), "systemd socket")
+	defer f.Close()
+	// FileListener() duplicates the descriptor, so f can be closed.
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("using the socket passed by systemd: %w", err)
+	}
+	return ln, nil
+}
+
+// The parseTrustedProxies() helper parses the IP addresses and CIDR ranges of
+// -trusted-proxies into ranges, a single address being a range of one.
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// The realIP() middleware replaces the address of a request made by a trusted reverse
+// proxy with that of the client it was forwarded for, so that clientIP(), and with it the
+// per-IP rate limits and login throttling, tell the clients apart. Requests on a Unix
+// socket have no address of their own and always come from a local proxy, so they are
+// trusted whatever -trusted-proxies says. Requests from anyone else are left alone, since
+// their headers could be forged.
+func (app *application) realIP(next http.Handler) http.Handler {
+	// The ranges were checked by validateConfig().
+	proxies, _ := parseTrustedProxies(app.config.listen.trustedProxies)
+	trusted := func(addr netip.Addr) bool {
+		for _, prefix := range proxies {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, err := netip.ParseAddr(clientIP(r))
+		if err == nil && !trusted(peer.Unmap()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if addr := forwardedFor(r.Header, trusted); addr.IsValid() {
+			r.RemoteAddr = addr.String()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The forwardedFor() helper returns the address of the client that a request was
+// forwarded for. Each proxy appends the address it got the request from to
+// X-Forwarded-For, so the list is read from the right, skipping the trusted proxies: the
+// addresses further left were given by the client and can't be relied on. X-Real-IP is
+// used for proxies that only set that. The address is invalid if neither header has one.
+func forwardedFor(h http.Header, trusted func(netip.Addr) bool) netip.Addr {
+	var hops []string
+	for _, value := range h.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}
+		}
+		addr = addr.Unmap()
+		if i == 0 || !trusted(addr) {
+			return addr
+		}
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(h.Get("X-Real-IP")))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
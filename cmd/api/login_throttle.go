@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+)
+
+// The checkLoginThrottle() helper turns away sign ins for an account, or from a client IP,
+// that has failed too often recently. It runs before the password is checked, so a
+// blocked attempt costs nothing and reveals nothing. It sends the error response itself
+// and returns false if the sign in is blocked.
+func (app *application) checkLoginThrottle(w http.ResponseWriter, r *http.Request, email string) bool {
+	if !app.config.login.enabled {
+		return true
+	}
+
+	var until time.Time
+	for _, key := range [][2]string{{data.LoginByAccount, email}, {data.LoginByIP, clientIP(r)}} {
+		blockedUntil, err := app.models.LoginAttempts.BlockedUntil(r.Context(), key[0], key[1])
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return false
+		}
+		if blockedUntil.After(until) {
+			until = blockedUntil
+		}
+	}
+	if until.IsZero() {
+		return true
+	}
+
+	app.loginThrottledResponse(w, r, until)
+	return false
+}
+
+// The recordLoginFailure() helper counts a failed sign in against the account and the
+// client IP. Each failure for an account makes the next attempt wait longer (1s, 2s, 4s,
+// ...) until -login-max-failures is reached, when the account is locked for
+// -login-lockout and its owner is told by email. The client IP is only locked, after
+// -login-ip-max-failures, since many users can share one address. The user is nil when
+// there is no account with the email address; failures are still counted so that the
+// responses don't give away which addresses have accounts.
+func (app *application) recordLoginFailure(r *http.Request, email string, user *data.User) {
+	if !app.config.login.enabled {
+		return
+	}
+	now := app.now()
+	lockout := app.config.login.lockout
+	ip := clientIP(r)
+
+	failures, err := app.models.LoginAttempts.RecordFailure(r.Context(), data.LoginByAccount, email, lockout)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	switch {
+	case failures >= app.config.login.maxFailures:
+		err = app.models.LoginAttempts.Block(r.Context(), data.LoginByAccount, email, now.Add(lockout))
+		if err == nil && failures == app.config.login.maxFailures && user != nil {
+			app.sendAccountLockedEmail(r.Context(), user, failures, ip, now.Add(lockout))
+		}
+	case failures > 1:
+		delay := lockout
+		if failures < 32 {
+			delay = min(time.Second<<(failures-2), lockout)
+		}
+		err = app.models.LoginAttempts.Block(r.Context(), data.LoginByAccount, email, now.Add(delay))
+	}
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+
+	failures, err = app.models.LoginAttempts.RecordFailure(r.Context(), data.LoginByIP, ip, lockout)
+	if err == nil && failures >= app.config.login.ipMaxFailures {
+		err = app.models.LoginAttempts.Block(r.Context(), data.LoginByIP, ip, now.Add(lockout))
+	}
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
+
+// The resetLoginFailures() helper clears an account's failed sign ins once it has signed in
+// successfully. Failures from the client IP are left to run out, so that signing in to
+// one account can't be used to reset the count while guessing at others.
+func (app *application) resetLoginFailures(r *http.Request, email string) {
+	if !app.config.login.enabled {
+		return
+	}
+	err := app.models.LoginAttempts.Reset(r.Context(), data.LoginByAccount, email)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
+
+func (app *application) sendAccountLockedEmail(ctx context.Context, user *data.User, failures int, ip string, until time.Time) {
+	app.background(func() {
+		tmplData := map[string]interface{}{
+			"name":     user.Name,
+			"failures": failures,
+			"ip":       ip,
+			"until":    until.In(app.location).Format("2006-01-02 15:04 MST"),
+		}
+		err := app.sendMail(ctx, user.Email, "account_locked.tmpl", tmplData)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+// The startLoginAttemptCleanup() method starts a background job which deletes failed sign
+// in records that have run out.
+func (app *application) startLoginAttemptCleanup() {
+	app.backgroundTicker("login_attempt_cleanup", time.Hour, func() {
+		err := app.models.LoginAttempts.DeleteExpired(context.Background(), app.config.login.lockout)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+func (app *application) loginThrottledResponse(w http.ResponseWriter, r *http.Request, until time.Time) {
+	seconds := int(math.Ceil(until.Sub(app.now()).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	message := fmt.Sprintf("too many failed sign in attempts, please try again in %d seconds", seconds)
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
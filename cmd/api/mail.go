@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/jsonlog"
+	"github.com/zarinakolybaeva/DoMake/internal/mailer"
+	"github.com/zarinakolybaeva/DoMake/internal/tracing"
+)
+
+// mailBackends are the values of -mail-backend.
+var mailBackends = []string{"smtp", "sendgrid", "ses", "log"}
+
+// mailOutboxRetention is how long emails are kept in the outbox once they have been sent
+// or given up on.
+const mailOutboxRetention = 24 * time.Hour
+
+// The newMailBackend() function returns the mail backend chosen with -mail-backend.
+func newMailBackend(cfg config, logger *jsonlog.Logger) (mailer.Backend, error) {
+	switch cfg.mail.backend {
+	case "smtp":
+		return mailer.NewSMTP(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.mail.sender), nil
+	case "sendgrid":
+		return mailer.NewSendGrid(cfg.mail.sendgrid.apiKey, cfg.mail.sender)
+	case "ses":
+		return mailer.NewSES(cfg.mail.ses.region, cfg.mail.ses.accessKeyID, cfg.mail.ses.secretAccessKey, cfg.mail.sender), nil
+	case "log":
+		return mailer.NewLog(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q", cfg.mail.backend)
+	}
+}
+
+// The sendMail() helper renders an email from the given template and queues it in the
+// outbox, from which the mail dispatcher sends it. The email is queued even if ctx is
+// cancelled, since callers send mail in the background once their request is done.
+func (app *application) sendMail(ctx context.Context, recipient, templateFile string, tmplData interface{}) error {
+	msg, err := app.mailer.Render(recipient, templateFile, tmplData)
+	if err != nil {
+		return err
+	}
+	return app.models.Outbox.Enqueue(tracing.Detach(ctx), &data.OutboxMessage{
+		Recipient: msg.To,
+		Subject:   msg.Subject,
+		PlainBody: msg.PlainBody,
+		HTMLBody:  msg.HTMLBody,
+	})
+}
+
+// The startMailDispatcher() method starts a background job which sends the emails queued
+// in the outbox, retrying failed ones with the same backoff as webhook deliveries, and
+// one which removes them once they are done with.
+func (app *application) startMailDispatcher() {
+	app.backgroundTicker("mail", app.config.mail.interval, func() {
+		err := app.dispatchMail()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+	app.backgroundTicker("mail_outbox_cleanup", time.Hour, func() {
+		err := app.models.Outbox.DeleteFinished(context.Background(), mailOutboxRetention)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+func (app *application) dispatchMail() error {
+	messages, err := app.models.Outbox.GetDue(context.Background(), app.now(), 50)
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		select {
+		case <-app.done:
+			return nil
+		default:
+		}
+
+		sendErr := app.deliverMail(msg)
+		msg.LastError = ""
+		switch {
+		case sendErr == nil:
+			msg.Status = data.DeliverySucceeded
+		case msg.Attempts+1 >= data.MaxMailAttempts:
+			msg.Status = data.DeliveryFailed
+			msg.LastError = sendErr.Error()
+		default:
+			msg.Status = data.DeliveryPending
+			msg.LastError = sendErr.Error()
+			msg.NextAttemptAt = data.CustomTime(app.now().Add(webhookBackoff(msg.Attempts + 1)))
+		}
+
+		err = app.models.Outbox.RecordAttempt(context.Background(), msg)
+		if err != nil {
+			return err
+		}
+		if msg.Status == data.DeliveryFailed {
+			app.logger.PrintError(sendErr, map[string]string{"mail_outbox_id": strconv.FormatInt(msg.ID, 10)})
+		}
+	}
+	return nil
+}
+
+// deliverMail sends one email from the outbox with the mail backend, in a span of its own.
+func (app *application) deliverMail(msg *data.OutboxMessage) error {
+	ctx, span := app.tracer.Start(context.Background(), "mail.send", tracing.KindClient)
+	defer span.End()
+	span.SetAttribute("mail.backend", app.config.mail.backend)
+	span.SetAttribute("mail.attempt", msg.Attempts+1)
+
+	err := app.mailer.Send(ctx, &mailer.Message{
+		To:        msg.Recipient,
+		Subject:   msg.Subject,
+		PlainBody: msg.PlainBody,
+		HTMLBody:  msg.HTMLBody,
+	})
+	span.SetError(err)
+	return err
+}
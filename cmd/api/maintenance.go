@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// defaultMaintenanceMessage is the error message of the 503 responses sent in maintenance
+// mode, unless an admin gave one of their own.
+const defaultMaintenanceMessage = "the server is down for maintenance, please try again later"
+
+// maintenanceState is whether the API is in maintenance mode, as shown and changed at
+// /v1/admin/maintenance.
+type maintenanceState struct {
+	Enabled bool `json:"enabled"`
+	// Message replaces the default error message of the 503 responses.
+	Message string `json:"message,omitempty"`
+	// RetryAfter is how many seconds clients are told to wait, in Retry-After.
+	RetryAfter int `json:"retry_after_seconds"`
+	// Since is when maintenance mode was turned on.
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// maintenanceMode holds the maintenance state of the API. It is kept in -maintenance-file,
+// if set, so that a restart during the maintenance doesn't bring the API back up. Each instance
+// has its own file, unless they share it on a volume.
+type maintenanceMode struct {
+	mu    sync.RWMutex
+	state maintenanceState
+	file  string
+}
+
+// The newMaintenanceMode() function loads the maintenance state saved in the -maintenance-file,
+// if there is one. -maintenance turns maintenance mode on regardless.
+func newMaintenanceMode(cfg config, now time.Time) (*maintenanceMode, error) {
+	m := &maintenanceMode{
+		state: maintenanceState{RetryAfter: int(cfg.maintenance.retryAfter.Seconds())},
+		file:  cfg.maintenance.file,
+	}
+	if m.file != "" {
+		js, err := os.ReadFile(m.file)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(js, &m.state); err != nil {
+				return nil, fmt.Errorf("reading %s: %w", m.file, err)
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, err
+		}
+	}
+	if cfg.maintenance.enabled && !m.state.Enabled {
+		m.state.Enabled = true
+		m.state.Since = &now
+		if err := m.save(m.state); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// The get() method returns the current maintenance state.
+func (m *maintenanceMode) get() maintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// The enabled() method reports whether the API is in maintenance mode.
+func (m *maintenanceMode) enabled() bool {
+	return m.get().Enabled
+}
+
+// The set() method changes the maintenance state, saving it first so that the state in
+// effect is always the one a restart comes back to.
+func (m *maintenanceMode) set(state maintenanceState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.save(state); err != nil {
+		return err
+	}
+	m.state = state
+	return nil
+}
+
+// The save() method writes state to the file, if there is one. The file is replaced with
+// a rename, so that a crash can't leave it half written.
+func (m *maintenanceMode) save(state maintenanceState) error {
+	if m.file == "" {
+		return nil
+	}
+	js, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.file), filepath.Base(m.file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(js); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), m.file)
+}
+
+// The maintenanceExempt() helper reports whether the path is still served in maintenance
+// mode: the health checks and metrics, so that orchestrators and monitoring carry on, and
+// /v1/admin/maintenance, so that it can be turned off again. Admins need a token for that,
+// and theirs may expire during the maintenance, so logging in and refreshing tokens are
+// left open too.
+func maintenanceExempt(path string) bool {
+	return path == "/metrics" ||
+		path == "/v1/admin/maintenance" ||
+		path == "/v1/users/token" || path == "/v1/tokens/refresh" ||
+		path == "/v1/healthcheck" || strings.HasPrefix(path, "/v1/healthcheck/")
+}
+
+// The checkMaintenance() middleware turns away requests with a 503 Service Unavailable
+// while the API is in maintenance mode, apart from the exempt ones. The scheduled
+// background jobs are paused as well, see backgroundTicker().
+func (app *application) checkMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := app.maintenance.get()
+		if !state.Enabled || maintenanceExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		message := state.Message
+		if message == "" {
+			message = defaultMaintenanceMessage
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(state.RetryAfter))
+		app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+	})
+}
+
+// The showMaintenanceHandler returns the maintenance state.
+func (app *application) showMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"maintenance": app.maintenance.get()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The updateMaintenanceHandler turns maintenance mode on or off. The message and
+// Retry-After of the 503 responses can be changed along with it; a message that is left
+// out goes back to the default one.
+func (app *application) updateMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Enabled    *bool  `json:"enabled"`
+		Message    string `json:"message"`
+		RetryAfter *int   `json:"retry_after_seconds"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	state := app.maintenance.get()
+	v := validator.New()
+	v.Check(input.Enabled != nil, "enabled", "must be provided")
+	v.Check(len(input.Message) <= 500, "message", "must not be more than 500 bytes long")
+	if input.RetryAfter != nil {
+		validator.Field(v, "retry_after_seconds", *input.RetryAfter, validator.Range(1, 24*60*60))
+		state.RetryAfter = *input.RetryAfter
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	switch {
+	case *input.Enabled && !state.Enabled:
+		now := app.now()
+		state.Since = &now
+	case !*input.Enabled:
+		state.Since = nil
+	}
+	state.Enabled = *input.Enabled
+	state.Message = input.Message
+	err = app.maintenance.set(state)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.logger.PrintInfo("maintenance mode changed", map[string]string{
+		"enabled": strconv.FormatBool(state.Enabled),
+		"user_id": strconv.FormatInt(app.contextGetUser(r).ID, 10),
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"maintenance": state}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/zarinakolybaeva/DoMake/internal/metrics"
+)
+
+// appMetrics holds the metrics exposed on GET /metrics.
+type appMetrics struct {
+	registry        *metrics.Registry
+	requests        *metrics.Counter
+	requestDuration *metrics.Histogram
+	inFlight        *metrics.Gauge
+	rateLimited     *metrics.Counter
+	background      *metrics.Gauge
+	backgroundPanic *metrics.Counter
+	jobRuns         *metrics.Counter
+	jobPanics       *metrics.Counter
+	jobDuration     *metrics.Histogram
+}
+
+func newMetrics(db *sql.DB) *appMetrics {
+	reg := metrics.NewRegistry()
+	m := &appMetrics{
+		registry:        reg,
+		requests:        reg.NewCounter("http_requests_total", "Number of HTTP requests handled.", "method", "route", "status"),
+		requestDuration: reg.NewHistogram("http_request_duration_seconds", "Time taken to handle HTTP requests.", metrics.DefaultBuckets, "method", "route"),
+		inFlight:        reg.NewGauge("http_requests_in_flight", "Number of HTTP requests being handled."),
+		rateLimited:     reg.NewCounter("http_rate_limited_requests_total", "Number of requests turned away by the rate limiter.", "kind"),
+		background:      reg.NewGauge("background_tasks_running", "Number of one-off background tasks, such as sending emails, running."),
+		backgroundPanic: reg.NewCounter("background_task_panics_total", "Number of one-off background tasks which panicked."),
+		jobRuns:         reg.NewCounter("background_job_runs_total", "Number of runs of the scheduled background jobs.", "job"),
+		jobPanics:       reg.NewCounter("background_job_panics_total", "Number of runs of the scheduled background jobs which panicked.", "job"),
+		jobDuration:     reg.NewHistogram("background_job_duration_seconds", "Time taken by runs of the scheduled background jobs.", metrics.DefaultBuckets, "job"),
+	}
+
+	// The connection pool statistics are read from the pool when they are scraped.
+	stat := func(fn func(s sql.DBStats) float64) func() float64 {
+		return func() float64 { return fn(db.Stats()) }
+	}
+	reg.NewGaugeFunc("db_max_open_connections", "Maximum number of open database connections.", stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	reg.NewGaugeFunc("db_open_connections", "Number of open database connections.", stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	reg.NewGaugeFunc("db_in_use_connections", "Number of database connections in use.", stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	reg.NewGaugeFunc("db_idle_connections", "Number of idle database connections.", stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	reg.NewCounterFunc("db_wait_count_total", "Number of times a database connection had to be waited for.", stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	reg.NewCounterFunc("db_wait_duration_seconds_total", "Time spent waiting for database connections.", stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	reg.NewCounterFunc("db_max_idle_closed_total", "Number of database connections closed because of -db-max-idle-conns.", stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	reg.NewCounterFunc("db_max_idle_time_closed_total", "Number of database connections closed because of -db-max-idle-time.", stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }))
+	return m
+}
+
+// The metricsHandler exposes the metrics in the Prometheus text format.
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	err := app.metrics.registry.WritePrometheus(w)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
+
+// The recordMetrics() middleware counts and times every request, labelled with the route
+// it matched rather than its path, so that IDs don't each get a series of their own.
+func (app *application) recordMetrics(router *httprouter.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := routeLabel(router, r)
+
+		app.metrics.inFlight.Inc()
+		defer app.metrics.inFlight.Dec()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		app.metrics.requests.Inc(r.Method, route, strconv.Itoa(rec.status))
+		app.metrics.requestDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// routeLabel returns the pattern of the route that a request matches, such as
+// /v1/tasks/:id, by putting the parameter names back in place of their values. Requests
+// which don't match a route are all labelled "unmatched".
+func routeLabel(router *httprouter.Router, r *http.Request) string {
+	handle, params, _ := router.Lookup(r.Method, r.URL.Path)
+	if handle == nil {
+		return "unmatched"
+	}
+	segments := strings.Split(r.URL.Path, "/")
+	for i := 0; i < len(segments) && len(params) > 0; i++ {
+		if segments[i] == params[0].Value {
+			segments[i] = ":" + params[0].Key
+			params = params[1:]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// statusRecorder passes a response through to the client while keeping its status code.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
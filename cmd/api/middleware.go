@@ -4,13 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/zarinakolybaeva/DoMake/internal/data"
-	"github.com/zarinakolybaeva/DoMake/internal/validator"
-	"golang.org/x/time/rate"
-	"net"
+	"github.com/zarinakolybaeva/DoMake/internal/ratelimit"
+	"math"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
-	"sync"
-	"time"
 )
 
 func (app *application) recoverPanic(next http.Handler) http.Handler {
@@ -38,65 +37,83 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// The rateLimit() middleware limits how fast each client can make requests. Signed-in
+// users (and API keys) are limited per user, so that people sharing an IP address behind
+// a NAT don't use up each other's allowance; anonymous requests are limited per IP
+// address. Reads and writes have separate limits. It must run after authenticate(), which
+// charges the requests it refuses itself, see rateLimitFailedAuthentication().
 func (app *application) rateLimit(next http.Handler) http.Handler {
-	// Define a client struct to hold the rate limiter and last seen time for each
-	// client.
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
-	}
-	var (
-		mu sync.Mutex
-		// Update the map so the values are pointers to a client struct.
-		clients = make(map[string]*client)
-	)
-	// Launch a background goroutine which removes old entries from the clients map once
-	// every minute.
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			// Lock the mutex to prevent any rate limiter checks from happening while
-			// the cleanup is taking place.
-			mu.Lock()
-			// Loop through all clients. If they haven't been seen within the last three
-			// minutes, delete the corresponding entry from the map.
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
-			// Importantly, unlock the mutex when the cleanup is complete.
-			mu.Unlock()
-		}
-	}()
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Only carry out the check if rate limiting is enabled.
 		if app.config.limiter.enabled {
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			key := "ip:" + clientIP(r)
+			if user := app.contextGetUser(r); !user.IsAnonymous() {
+				key = "user:" + strconv.FormatInt(user.ID, 10)
+			}
+			kind, limit := app.requestLimit(r)
+			key += ":" + kind
+
+			result, err := app.limiter.Allow(key, limit)
 			if err != nil {
-				app.serverErrorResponse(w, r, err)
+				// If the limiter's backend is unavailable, let the request through
+				// rather than failing it.
+				app.logger.PrintError(err, map[string]string{"key": key})
+				next.ServeHTTP(w, r)
 				return
 			}
-			mu.Lock()
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{
-					// Use the requests-per-second and burst values from the config
-					// struct.
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
-				}
-			}
-			clients[ip].lastSeen = time.Now()
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
+
+			// X-RateLimit-Remaining is how many more requests can be made right away,
+			// and X-RateLimit-Reset how many seconds it takes until the full burst is
+			// available again.
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+				app.metrics.rateLimited.Inc(kind)
 				app.rateLimitExceededResponse(w, r)
 				return
 			}
-			mu.Unlock()
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// The requestLimit() helper returns the kind of the request, read or write, and the rate
+// limit for it, from the requests-per-second and burst values in the config struct.
+func (app *application) requestLimit(r *http.Request) (string, ratelimit.Limit) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, methodPropfind, methodReport:
+		return "read", ratelimit.Limit{Rate: app.config.limiter.rps, Burst: app.config.limiter.burst}
+	}
+	return "write", ratelimit.Limit{Rate: app.config.limiter.writeRPS, Burst: app.config.limiter.writeBurst}
+}
+
+// The rateLimitFailedAuthentication() helper charges a request whose credentials were
+// refused to its IP address, like the anonymous requests in rateLimit(). authenticate()
+// turns such requests away before rateLimit() runs, so without this tokens and API keys
+// could be guessed as fast as the server answers. It returns true, having sent a 429 Too
+// Many Requests response, if the IP address is over its limit.
+func (app *application) rateLimitFailedAuthentication(w http.ResponseWriter, r *http.Request) bool {
+	if !app.config.limiter.enabled {
+		return false
+	}
+	kind, limit := app.requestLimit(r)
+	key := "ip:" + clientIP(r) + ":" + kind
+	result, err := app.limiter.Allow(key, limit)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"key": key})
+		return false
+	}
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+		app.metrics.rateLimited.Inc(kind)
+		app.rateLimitExceededResponse(w, r)
+		return true
+	}
+	return false
+}
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Add the "Vary: Authorization" header to the response. This indicates to any
@@ -107,6 +124,51 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// return the empty string "" if there is no such header found.
 		authorizationHeader := r.Header.Get("Authorization")
 
+		// Scripts and integrations can authenticate with an API key instead of a
+		// bearer token. The key's permissions are added to the request context, and
+		// requirePermission() holds the request to them.
+		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" && authorizationHeader == "" {
+			w.Header().Add("Vary", "X-API-Key")
+			key, user, err := app.models.APIKeys.GetForKey(r.Context(), apiKey)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					if !app.rateLimitFailedAuthentication(w, r) {
+						app.invalidAPIKeyResponse(w, r)
+					}
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			r = app.contextSetAPIKey(app.contextSetUser(r, user), key)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// CalDAV clients can only send a username and password, so they authenticate
+		// with HTTP Basic: the user's email address and an API key as the password.
+		if email, apiKey, ok := r.BasicAuth(); ok {
+			key, user, err := app.models.APIKeys.GetForKey(r.Context(), apiKey)
+			if err == nil && !strings.EqualFold(user.Email, email) {
+				err = data.ErrRecordNotFound
+			}
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					if !app.rateLimitFailedAuthentication(w, r) {
+						w.Header().Set("WWW-Authenticate", basicAuthChallenge)
+						app.invalidAPIKeyResponse(w, r)
+					}
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			r = app.contextSetAPIKey(app.contextSetUser(r, user), key)
+			next.ServeHTTP(w, r)
+			return
+		}
 
 		// If there is no Authorization header found, use the contextSetUser() helper
 		// that we just made to add the AnonymousUser to the request context. Then we
@@ -124,37 +186,32 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// in a moment).
 		headerParts := strings.Split(authorizationHeader, " ")
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			app.invalidAuthenticationTokenResponse(w, r)
+			if !app.rateLimitFailedAuthentication(w, r) {
+				app.invalidAuthenticationTokenResponse(w, r)
+			}
 			return
 		}
 		// Extract the actual authentication token from the header parts.
 		token := headerParts[1]
-		// Validate the token to make sure it is in a sensible format.
-		v := validator.New()
-		// If the token isn't valid, use the invalidAuthenticationTokenResponse()
-		// helper to send a response, rather than the failedValidationResponse() helper
-		// that we'd normally use.
-		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
-			app.invalidAuthenticationTokenResponse(w, r)
-			return
-		}
 		// Retrieve the details of the user associated with the authentication token,
-		// again calling the invalidAuthenticationTokenResponse() helper if no
-		// matching record was found. IMPORTANT: Notice that we are using
-		// ScopeAuthentication as the first parameter here.
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentications, token)
+		// calling the invalidAuthenticationTokenResponse() helper if the token isn't
+		// valid. In JWT mode the JWT's session is checked too, so that revoked sessions
+		// and deactivated users are refused straight away.
+		user, sessionID, err := app.userForToken(r, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
-				app.invalidAuthenticationTokenResponse(w, r)
+				if !app.rateLimitFailedAuthentication(w, r) {
+					app.invalidAuthenticationTokenResponse(w, r)
+				}
 			default:
 				app.serverErrorResponse(w, r, err)
 			}
 			return
 		}
 		// Call the contextSetUser() helper to add the user information to the request
-		// context.
-		r = app.contextSetUser(r, user)
+		// context, along with the session the token belongs to.
+		r = app.contextSetSession(app.contextSetUser(r, user), sessionID)
 		// Call the next handler in the chain.
 		next.ServeHTTP(w, r)
 	})
@@ -173,12 +230,30 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 }
 
-// Checks that a user is both authenticated and activated.
+// Checks that a user is both authenticated and activated. API keys are turned away, since
+// they are only good for the endpoints guarded by requirePermission().
 func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetAPIKey(r) != nil {
+			app.apiKeyNotAllowedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return app.requireActivatedAccount(fn)
+}
+
+// The requireActivatedAccount() middleware is requireActivatedUser() without the API key
+// check, for middleware that checks API keys itself.
+func (app *application) requireActivatedAccount(next http.HandlerFunc) http.HandlerFunc {
 	// Rather than returning this http.HandlerFunc we assign it to the variable fn.
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
-		// Check that a user is activated.
+		// Check that a user is activated, and hasn't been deactivated by an admin since.
+		if user.Deactivated {
+			app.deactivatedAccountResponse(w, r)
+			return
+		}
 		if !user.Activated {
 			app.inactiveAccountResponse(w, r)
 			return
@@ -196,7 +271,7 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 		// Retrieve the user from the request context.
 		user := app.contextGetUser(r)
 		// Get the slice of permissions for the user.
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.models.Permissions.GetAllForUser(r.Context(), user.ID)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -207,41 +282,194 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 			app.notPermittedResponses(w, r)
 			return
 		}
+		// Requests made with an API key are also limited to the key's permissions.
+		if key := app.contextGetAPIKey(r); key != nil && !key.Permissions.Include(code) {
+			app.notPermittedResponses(w, r)
+			return
+		}
 		// Otherwise they have the required permission so we call the next handler in
 		// the chain.
 		next.ServeHTTP(w, r)
 	}
-	// Wrap this with the requireActivatedUser() middleware before returning it.
+	// Wrap this with the requireActivatedAccount() middleware before returning it.
+	return app.requireActivatedAccount(fn)
+}
+
+// The requireAdmin() middleware guards the admin user-management API. It is a shorthand for
+// requirePermission() with the "users:admin" permission, which comes with the admin role.
+func (app *application) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return app.requirePermission("users:admin", next)
+}
+
+// The requireRole() middleware checks that the user has been given the named account role,
+// for endpoints that go beyond what a bundle of permissions describes. Admins pass every
+// role check.
+func (app *application) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		roles, err := app.models.Roles.GetAllForUser(r.Context(), user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !roles.Include(role) && !roles.Include(data.RoleAdmin) {
+			app.notPermittedResponses(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
 	return app.requireActivatedUser(fn)
 }
 
+// The requireWorkspaceRole() middleware checks that the user is a member of the
+// workspace the request is for, with at least the given role, and adds the membership to
+// the request context. The workspace is chosen with the X-Workspace-ID header (or a
+// workspace_id query string parameter, for links and feeds that can't set headers);
+// requests without one use the user's personal workspace. It must run after
+// requireActivatedUser() or requirePermission().
+func (app *application) requireWorkspaceRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		raw := r.Header.Get("X-Workspace-ID")
+		if raw == "" {
+			raw = r.URL.Query().Get("workspace_id")
+		}
+
+		var workspaceID int64
+		var err error
+		if raw != "" {
+			workspaceID, err = strconv.ParseInt(raw, 10, 64)
+			if err != nil || workspaceID < 1 {
+				app.badRequestResponse(w, r, errors.New("invalid workspace id"))
+				return
+			}
+		} else {
+			workspaceID, err = app.models.Workspaces.GetPersonalID(r.Context(), user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		member, ok := app.checkWorkspaceRole(w, r, workspaceID, role)
+		if !ok {
+			return
+		}
+		next.ServeHTTP(w, app.contextSetWorkspace(r, member))
+	}
+}
+
+// The checkWorkspaceRole() helper fetches the current user's membership of a workspace and
+// checks that it has at least the given role. If not, it sends the error response itself
+// and returns false. Workspaces the user doesn't belong to are reported as missing rather
+// than forbidden, so that their IDs can't be probed.
+func (app *application) checkWorkspaceRole(w http.ResponseWriter, r *http.Request, workspaceID int64, role string) (*data.Member, bool) {
+	member, err := app.models.Workspaces.GetMember(r.Context(), workspaceID, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	if !data.RoleAllows(member.Role, role) {
+		app.notPermittedResponses(w, r)
+		return nil, false
+	}
+	return member, true
+}
+
+// Define the methods and request headers allowed in CORS requests unless
+// -cors-allowed-methods and -cors-allowed-headers say otherwise.
+var (
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", "Idempotency-Key", "X-Workspace-ID", "X-API-Key"}
+)
+
+// corsTokenRX is what methods and header names look like (the token rule of RFC 9110).
+var corsTokenRX = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// corsSubdomainRX is what the subdomain part of an origin matched by a wildcard, such as
+// the "app" of https://app.example.com for https://*.example.com, looks like.
+var corsSubdomainRX = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*$`)
+
+// The enableCORS() middleware lets browser clients on the trusted origins call the API.
+// Their requests get an Access-Control-Allow-Origin header naming the origin, and their
+// preflight requests are answered with the allowed methods and headers. Requests from
+// other origins get no CORS headers, so browsers won't let them read the responses, and
+// their preflight requests are refused.
 func (app *application) enableCORS(next http.Handler) http.Handler {
+	methods := strings.Join(app.config.cors.allowedMethods, ", ")
+	headers := strings.Join(app.config.cors.allowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(app.config.cors.maxAge.Seconds()))
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Origin")
 		// Add the "Vary: Access-Control-Request-Method" header.
 		w.Header().Add("Vary", "Access-Control-Request-Method")
 		origin := r.Header.Get("Origin")
-		if origin != "" {
-			for i := range app.config.cors.trustedOrigins {
-				if origin == app.config.cors.trustedOrigins[i] {
-					w.Header().Set("Access-Control-Allow-Origin", origin)
-					// Check if the request has the HTTP method OPTIONS and contains the
-					// "Access-Control-Request-Method" header. If it does, then we treat
-					// it as a preflight request.
-					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
-						// Set the necessary preflight response headers, as discussed
-						// previously.
-						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
-						// Write the headers along with a 200 OK status and return from
-						// the middleware with no further action.
-						w.WriteHeader(http.StatusOK)
-						return
-					}
-					break
-				}
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Check if the request has the HTTP method OPTIONS and contains the
+		// "Access-Control-Request-Method" header. If it does, then we treat
+		// it as a preflight request.
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !app.trustedOrigin(origin) {
+			if preflight {
+				app.errorResponse(w, r, http.StatusForbidden, "cross-origin requests aren't allowed from this origin")
+				return
 			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if app.config.cors.allowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		// Let browser clients read the rate limit headers.
+		w.Header().Set("Access-Control-Expose-Headers", "X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After")
+		if preflight {
+			// Set the necessary preflight response headers, and write them along
+			// with a 200 OK status without calling the next handler.
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			if app.config.cors.maxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusOK)
+			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// The trustedOrigin() helper reports whether an origin is one of -cors-trusted-origins. A
+// trusted origin with a wildcard, such as https://*.example.com, covers the subdomains of
+// example.com at any depth with the same scheme and port, but not example.com itself.
+func (app *application) trustedOrigin(origin string) bool {
+	for _, trusted := range app.config.cors.trustedOrigins {
+		if origin == trusted {
+			return true
+		}
+		scheme, domain, ok := strings.Cut(trusted, "://*.")
+		if !ok {
+			continue
+		}
+		rest, ok := strings.CutPrefix(origin, scheme+"://")
+		if !ok {
+			continue
+		}
+		subdomain, ok := strings.CutSuffix(rest, "."+domain)
+		if ok && corsSubdomainRX.MatchString(subdomain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/jsonlog"
+	"github.com/zarinakolybaeva/DoMake/migrations"
+)
+
+// The migrateUp() function applies the migrations embedded in the binary which haven't
+// been applied yet. It uses a connection pool of its own, because closing the migrator
+// closes the pool it was given. The version is kept in the schema_migrations table, as
+// with the migrate CLI, so the two can be used on the same database.
+func migrateUp(cfg config, logger *jsonlog.Logger) error {
+	db, err := data.Open(cfg.db.driver, cfg.db.dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := newMigrator(cfg.db.driver, db)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	before, err := schemaVersion(m)
+	if err != nil {
+		return err
+	}
+	err = m.Up()
+	switch {
+	case errors.Is(err, migrate.ErrNoChange):
+		logger.PrintInfo("database schema is up to date", map[string]string{"version": before})
+		return nil
+	case err != nil:
+		return fmt.Errorf("applying migrations: %w", err)
+	}
+
+	after, err := schemaVersion(m)
+	if err != nil {
+		return err
+	}
+	logger.PrintInfo("applied database migrations", map[string]string{"from": before, "to": after})
+	return nil
+}
+
+// The newMigrator() helper returns a migrator for the given database driver. SQLite has
+// migrations of its own, since its SQL differs from PostgreSQL's. They aren't wrapped in
+// a transaction, as those that rebuild a table have to turn foreign keys off first, which
+// can't be done inside one; such migrations begin and commit their own.
+func newMigrator(driverName string, db *sql.DB) (*migrate.Migrate, error) {
+	var (
+		src    source.Driver
+		driver database.Driver
+		err    error
+	)
+	switch driverName {
+	case data.DriverSQLite:
+		src, err = iofs.New(migrations.SQLiteFS, "sqlite")
+		if err != nil {
+			return nil, err
+		}
+		driver, err = sqlite3.WithInstance(db, &sqlite3.Config{NoTxWrap: true})
+	default:
+		src, err = iofs.New(migrations.FS, ".")
+		if err != nil {
+			return nil, err
+		}
+		driver, err = postgres.WithInstance(db, &postgres.Config{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewWithInstance("iofs", src, driverName, driver)
+}
+
+// The schemaVersion() helper returns the migrator's current version for logging, or
+// "none" on a fresh database. A dirty version is an error, as it needs fixing by hand.
+func schemaVersion(m *migrate.Migrate) (string, error) {
+	version, dirty, err := m.Version()
+	switch {
+	case errors.Is(err, migrate.ErrNilVersion):
+		return "none", nil
+	case err != nil:
+		return "", err
+	case dirty:
+		return "", fmt.Errorf("database schema version %d is dirty; fix it and force the version with the migrate CLI", version)
+	}
+	return strconv.FormatUint(uint64(version), 10), nil
+}
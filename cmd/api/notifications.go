@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// The notify() helper adds a notification to a user's notification center, and sends it
+// to their chat integrations if it is of a kind that goes there. Like audit entries it is
+// saved in the background, and failures are only logged, since whatever it is about has
+// already happened.
+func (app *application) notify(notification *data.Notification) {
+	app.background(func() {
+		err := app.models.Notifications.Insert(context.Background(), notification)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"kind": notification.Kind, "user_id": strconv.FormatInt(notification.UserID, 10)})
+		}
+		if chatNotificationKinds[notification.Kind] {
+			app.sendToChats(notification)
+		}
+	})
+}
+
+// The listNotificationsHandler() returns a page of the current user's notifications,
+// newest first, or only the unread ones with ?unread=true. The number of unread
+// notifications is always included, for the badge on the clients' notification bell.
+// Messages are sent in the user's language.
+func (app *application) listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Unread bool
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Unread = app.readBool(qs, "unread", false, v)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"id", "created_at", "-id", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	notifications, metadata, err := app.models.Notifications.GetAllForUser(r.Context(), user.ID, input.Unread, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	unreadCount, err := app.models.Notifications.CountUnread(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	lang := app.language(r)
+	for _, notification := range notifications {
+		notification.Message = app.messages.Translate(lang, notification.Message)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"notifications": notifications, "metadata": metadata, "unread_count": unreadCount}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The markNotificationReadHandler() marks one of the current user's notifications as
+// read. Marking a notification that was already read again leaves it as it was.
+func (app *application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	notification, err := app.models.Notifications.MarkRead(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	unreadCount, err := app.models.Notifications.CountUnread(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	notification.Message = app.messages.Translate(app.language(r), notification.Message)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"notification": notification, "unread_count": unreadCount}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The markAllNotificationsReadHandler() marks all of the current user's notifications as
+// read, and returns how many of them were unread.
+func (app *application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	marked, err := app.models.Notifications.MarkAllRead(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"marked": marked, "unread_count": 0}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
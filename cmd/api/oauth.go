@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/oauth"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// oauthStateTTL is how long a user has to finish signing in with a provider.
+const oauthStateTTL = 10 * time.Minute
+
+// oauthStateCookie holds the state of a sign in in the browser that started it, see
+// oauthLoginHandler.
+const oauthStateCookie = "oauth_state"
+
+// newOAuthProviders returns the identity providers that have client credentials
+// configured, keyed by the name used in their URLs.
+func newOAuthProviders(cfg config) map[string]*oauth.Provider {
+	providers := make(map[string]*oauth.Provider)
+	callback := func(name string) string {
+		return strings.TrimSuffix(cfg.oauth.redirectBase, "/") + "/v1/auth/" + name + "/callback"
+	}
+	if cfg.oauth.google.clientID != "" {
+		providers["google"] = oauth.Google(cfg.oauth.google.clientID, cfg.oauth.google.clientSecret, callback("google"))
+	}
+	if cfg.oauth.github.clientID != "" {
+		providers["github"] = oauth.GitHub(cfg.oauth.github.clientID, cfg.oauth.github.clientSecret, callback("github"))
+	}
+	return providers
+}
+
+// The oauthLoginHandler starts a sign in with an external provider by redirecting the
+// user to it. The provider sends them back to the oauthCallbackHandler. Browsers follow
+// the link without the user's token, so this only ever signs in; signed in users link a
+// provider account with the oauthLinkHandler instead.
+func (app *application) oauthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.readOAuthProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, ok := app.startOAuth(w, r, provider, 0)
+	if !ok {
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// The oauthLinkHandler starts linking a provider account to the current user. It returns
+// the URL to send the user's browser to, along with the state cookie, and the provider
+// sends them back to the oauthCallbackHandler as it does for a sign in.
+func (app *application) oauthLinkHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.readOAuthProvider(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, ok := app.startOAuth(w, r, provider, app.contextGetUser(r).ID)
+	if !ok {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"url": authURL}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The startOAuth() helper hands out the state for a sign in with a provider, which links
+// the provider account to the user with the ID linkUserID unless that is 0, and returns
+// the provider's URL to send the user to. The state is also kept in a cookie, so that the
+// callback only accepts it from the browser that was sent to the provider.
+func (app *application) startOAuth(w http.ResponseWriter, r *http.Request, provider *oauth.Provider, linkUserID int64) (string, bool) {
+	state, err := app.models.Identities.NewState(r.Context(), provider.Name, linkUserID, oauthStateTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return "", false
+	}
+	http.SetCookie(w, newOAuthStateCookie(provider, state, oauthStateTTL))
+	return provider.AuthCodeURL(state), true
+}
+
+// The oauthCallbackHandler finishes a sign in with an external provider and issues an
+// authentication token, just like POST /v1/users/token does. A provider account that
+// hasn't been seen before is linked to the user who started linking it, or else to a new
+// user, see linkOAuthIdentity().
+func (app *application) oauthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.readOAuthProvider(w, r)
+	if !ok {
+		return
+	}
+
+	qs := r.URL.Query()
+	if qs.Get("error") != "" {
+		app.errorResponse(w, r, http.StatusUnauthorized, "sign in with "+provider.Name+" failed: "+qs.Get("error"))
+		return
+	}
+
+	// The state must be one we handed out to this browser, so that nobody can make a
+	// user sign in to someone else's account by getting them to follow a callback link.
+	state := qs.Get("state")
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		app.invalidOAuthStateResponse(w, r)
+		return
+	}
+	http.SetCookie(w, newOAuthStateCookie(provider, "", 0))
+	linkUserID, ok, err := app.models.Identities.UseState(r.Context(), provider.Name, state)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.invalidOAuthStateResponse(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	accessToken, err := provider.Exchange(ctx, qs.Get("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, oauth.ErrExchange):
+			app.logger.PrintError(err, nil)
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	identity, err := provider.Identity(ctx, accessToken)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user, err := app.models.Identities.GetUser(r.Context(), provider.Name, identity.Subject)
+	if err != nil {
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		user, ok = app.linkOAuthIdentity(w, r, provider, identity, linkUserID)
+		if !ok {
+			return
+		}
+	} else if linkUserID != 0 && user.ID != linkUserID {
+		app.errorResponse(w, r, http.StatusConflict, "this "+provider.Name+" account is already linked to another user")
+		return
+	}
+
+	// Signing in with a provider can't ask for a second factor, so users who require one
+	// have to use their password.
+	settings, err := app.models.Settings.Get(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if settings.RequireTwoFactor {
+		app.errorResponse(w, r, http.StatusForbidden, "this account requires two-factor authentication, please sign in with your password")
+		return
+	}
+
+	tokens, err := app.newAuthenticationTokens(r, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	tokens["user"] = user
+
+	err = app.writeJSON(w, http.StatusCreated, tokens, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The linkOAuthIdentity() helper links a provider account that signed in for the first
+// time to a user. That is the user with the ID linkUserID, who started linking it, or
+// else a new user. A matching email address isn't enough to link the
+// account to an existing user: someone could otherwise sign up with a victim's address
+// before they do, and keep access to the account once the victim takes it over. Only
+// verified email addresses are trusted for new users, since anyone could claim an address
+// they don't own.
+func (app *application) linkOAuthIdentity(w http.ResponseWriter, r *http.Request, provider *oauth.Provider, identity *oauth.Identity, linkUserID int64) (*data.User, bool) {
+	var user *data.User
+	var err error
+	if linkUserID != 0 {
+		user, err = app.models.Users.Get(r.Context(), linkUserID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+	} else {
+		if identity.Email == "" || !identity.EmailVerified {
+			app.errorResponse(w, r, http.StatusForbidden, "your "+provider.Name+" account has no verified email address")
+			return nil, false
+		}
+		_, err = app.models.Users.GetByEmail(r.Context(), identity.Email)
+		switch {
+		case err == nil:
+			app.errorResponse(w, r, http.StatusConflict, "an account with this email address already exists, sign in to it and link your "+provider.Name+" account from there")
+			return nil, false
+		case !errors.Is(err, data.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return nil, false
+		}
+		var ok bool
+		user, ok = app.provisionOAuthUser(w, r, identity)
+		if !ok {
+			return nil, false
+		}
+	}
+
+	err = app.models.Identities.Insert(r.Context(), &data.Identity{
+		Provider: provider.Name,
+		Subject:  identity.Subject,
+		UserID:   user.ID,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// The provisionOAuthUser() helper creates a user for someone signing in with a provider
+// for the first time. The provider has verified their email address, so the account is
+// activated straight away. It gets a random password, which the user can replace with a
+// password reset if they want to sign in with one.
+func (app *application) provisionOAuthUser(w http.ResponseWriter, r *http.Request, identity *oauth.Identity) (*data.User, bool) {
+	user := &data.User{
+		Name:      identity.Name,
+		Email:     identity.Email,
+		Activated: true,
+	}
+	if user.Name == "" {
+		user.Name, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	random := make([]byte, 24)
+	_, err := rand.Read(random)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	err = user.Password.Set(hex.EncodeToString(random))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+	err = app.models.Users.Insert(r.Context(), user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	err = app.setUpNewUser(r.Context(), user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// The newOAuthStateCookie() helper returns the cookie that keeps the state of a sign in
+// with the provider for maxAge, or deletes it if maxAge is 0. It is only sent back to the
+// provider's callback.
+func newOAuthStateCookie(provider *oauth.Provider, state string, maxAge time.Duration) *http.Cookie {
+	seconds := int(maxAge / time.Second)
+	if seconds == 0 {
+		seconds = -1
+	}
+	path := "/"
+	if callback, err := url.Parse(provider.RedirectURL); err == nil && callback.Path != "" {
+		path = callback.Path
+	}
+	return &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     path,
+		MaxAge:   seconds,
+		Secure:   strings.HasPrefix(provider.RedirectURL, "https://"),
+		HttpOnly: true,
+		// Lax, rather than Strict, so that the cookie is sent with the redirect back from
+		// the provider's site.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (app *application) invalidOAuthStateResponse(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid or expired sign in state, please start again")
+}
+
+// The readOAuthProvider() helper looks up the provider named by the :provider URL
+// parameter. Providers without client credentials configured don't exist as far as
+// clients are concerned.
+func (app *application) readOAuthProvider(w http.ResponseWriter, r *http.Request) (*oauth.Provider, bool) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("provider")
+	provider, ok := app.oauth[name]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	return provider, true
+}
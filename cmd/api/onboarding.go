@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+)
+
+// inboxCategory is the category new users' welcome tasks are filed in.
+var inboxCategory = data.Category{
+	Name:        "Inbox",
+	Description: "Tasks that haven't been sorted into a category yet.",
+}
+
+// welcomeTasks are given to new users, so that clients have something to show on their
+// first run. They are in the order they are shown on the board.
+var welcomeTasks = []data.Task{
+	{
+		Title:       "Welcome to DoMake",
+		Description: "This is your **Inbox**. New tasks can go here until you sort them into categories of your own.",
+		Priority:    data.PriorityHigh,
+		Status:      data.StatusTodo,
+	},
+	{
+		Title:       "Create your first task",
+		Description: "Give it a title, a due date and a priority. Tasks without a due date are kept for *someday*.",
+		Priority:    data.PriorityMedium,
+		Status:      data.StatusTodo,
+	},
+	{
+		Title:       "Invite your team",
+		Description: "Create a workspace and invite people to it to share its tasks. This one stays personal.",
+		Priority:    data.PriorityLow,
+		Status:      data.StatusTodo,
+	},
+}
+
+// The seedNewUser() helper gives a newly activated user an Inbox category in their
+// personal workspace, holding the welcome tasks, unless that is turned off with
+// -onboarding-seed=false. Either all of them are created or none are. A workspace that
+// already has categories has been set up, whether by an earlier call or by the user, and
+// is left alone, so that the welcome tasks are never given twice.
+func (app *application) seedNewUser(ctx context.Context, user *data.User) error {
+	if !app.config.onboarding.seed {
+		return nil
+	}
+	workspaceID, err := app.models.Workspaces.GetPersonalID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	existing, err := app.models.Categories.GetTree(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return nil
+	}
+
+	category := inboxCategory
+	category.WorkspaceID = workspaceID
+	tasks := make([]*data.Task, len(welcomeTasks))
+	err = app.models.Tasks.InTx(ctx, func(tx data.TaskTx) error {
+		err := tx.InsertCategory(&category)
+		if err != nil {
+			return err
+		}
+		for i := range welcomeTasks {
+			task := welcomeTasks[i]
+			task.CategoryID = category.ID
+			task.Category = category.Name
+			task.UserID = user.ID
+			task.WorkspaceID = workspaceID
+			err = tx.Insert(&task)
+			if err != nil {
+				return err
+			}
+			tasks[i] = &task
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	app.recordAudit(user.ID, data.AuditCategory, category.ID, data.AuditCreate, nil, &category)
+	for _, task := range tasks {
+		app.publishTaskEvent(task.WorkspaceID, data.EventTaskCreated, task)
+		app.recordAudit(user.ID, data.AuditTask, task.ID, data.AuditCreate, nil, task)
+	}
+	return nil
+}
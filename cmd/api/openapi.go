@@ -0,0 +1,1253 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/openapi"
+)
+
+// openAPIDocument and openAPIDocumentV2 are the JSON encodings of the API's OpenAPI
+// documents for /v1/ and /v2/. The documents only depend on the code, so each is built
+// the first time it is asked for and kept.
+var (
+	openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+		s := newAPISpec()
+		s.deprecateV1()
+		return json.MarshalIndent(s.Document, "", "\t")
+	})
+	openAPIDocumentV2 = sync.OnceValues(func() ([]byte, error) {
+		s := newAPISpec()
+		s.convertToV2()
+		return json.MarshalIndent(s.Document, "", "\t")
+	})
+)
+
+// The openAPIHandler() serves the OpenAPI document describing every endpoint, from which
+// clients can be generated. Each API version has its own document.
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	document := openAPIDocument
+	if apiVersion(w) == apiV2 {
+		document = openAPIDocumentV2
+	}
+	js, err := document()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(js)
+}
+
+// docsPage is the Swagger UI page served by docsHandler(). The UI itself is loaded from a
+// CDN, so that it needn't be vendored here.
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>Taskninja API</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+	<script>
+		window.onload = function () {
+			window.ui = SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"});
+		};
+	</script>
+</body>
+</html>
+`
+
+// The docsHandler() serves Swagger UI for browsing and trying out the OpenAPI document.
+// It is only routed when -docs-ui is set.
+func (app *application) docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", docsCSP)
+	w.Write([]byte(docsPage))
+}
+
+// apiSpec builds the OpenAPI document. Its helpers add the parameters and responses that
+// follow from the middleware in front of an endpoint, so that each endpoint only has to
+// describe what is particular to it.
+type apiSpec struct {
+	*openapi.Document
+}
+
+// legacyTimePattern matches the data.CustomTime values used for most timestamps when the
+// server runs with -time-format=legacy.
+const legacyTimePattern = `^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}$`
+
+// customTimeSchema describes data.CustomTime in the format the server writes it in.
+func customTimeSchema() *openapi.Schema {
+	const accepted = " Requests can also give a date on its own (YYYY-MM-DD)"
+	if data.TimeFormat() == data.TimeFormatLegacy {
+		return &openapi.Schema{
+			Type:        "string",
+			Pattern:     legacyTimePattern,
+			Example:     "2024-01-15 09:30:00",
+			Description: `A date and time in the format "YYYY-MM-DD HH:MM:SS".` + accepted + " or an RFC 3339 timestamp.",
+		}
+	}
+	return &openapi.Schema{
+		Type:        "string",
+		Format:      "date-time",
+		Example:     "2024-01-15T09:30:00Z",
+		Description: "An RFC 3339 timestamp, written in UTC." + accepted + `, or in the legacy format "YYYY-MM-DD HH:MM:SS", read as UTC.`,
+	}
+}
+
+func newAPISpec() *apiSpec {
+	s := &apiSpec{openapi.New("Taskninja API", version)}
+	s.Info.Description = "Tasks, categories and the people working on them, organised in workspaces.\n\n" +
+		"Most endpoints need an authentication token from POST /v1/users/token, or an API key. " +
+		"Tasks and categories belong to a workspace, chosen with the X-Workspace-ID header (or the " +
+		"workspace_id query parameter); without one the user's personal workspace is used."
+	s.Servers = []openapi.Server{{URL: "/"}}
+	s.Tags = []openapi.Tag{
+		{Name: "Health"},
+		{Name: "Tasks"},
+		{Name: "Task details", Description: "Subtasks, comments, attachments, tags, time tracking and history of a task."},
+		{Name: "Categories"},
+		{Name: "Tags"},
+		{Name: "Search", Description: "Tasks, categories, tags and comments matching a few words."},
+		{Name: "Workspaces"},
+		{Name: "Users"},
+		{Name: "Notifications", Description: "Comments on the user's tasks, reminders and failed webhook deliveries."},
+		{Name: "Authentication"},
+		{Name: "Integrations", Description: "Webhooks, API keys, calendar feeds, live updates and reminders on Slack and Telegram.\n\n" +
+			"Calendar apps can also sync tasks both ways over CalDAV, at /caldav/ (or /.well-known/caldav): " +
+			"each workspace is a calendar of to-dos. Clients sign in with the user's email address, and an API key as the password. " +
+			"CalDAV is built on WebDAV methods such as PROPFIND and REPORT, which OpenAPI can't describe, so its routes aren't listed here."},
+		{Name: "Admin"},
+		{Name: "GraphQL", Description: "Tasks, categories, tags and users through a single GraphQL endpoint."},
+	}
+
+	s.DefineType(data.CustomTime{}, "CustomTime", customTimeSchema())
+	s.DefineType(data.TaskStatus(""), "TaskStatus", openapi.Enum(data.TaskStatuses...))
+	s.DefineType(data.TaskPriority(""), "TaskPriority", openapi.Enum(data.TaskPriorities...))
+
+	s.Components.SecuritySchemes["bearerAuth"] = &openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "An authentication token from POST /v1/users/token. When the server runs with -jwt-secret this is a JWT access token, renewed with POST /v1/tokens/refresh.",
+	}
+	s.Components.SecuritySchemes["apiKey"] = &openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        "X-API-Key",
+		Description: "An API key from POST /v1/api-keys, limited to the permissions it was created with. CalDAV clients send it as the password of HTTP Basic authentication instead, with the user's email address as the username.",
+	}
+	s.Security = []openapi.SecurityRequirement{{"bearerAuth": {}}, {"apiKey": {}}}
+
+	s.addErrorResponses()
+	s.addHealthRoutes()
+	s.addTaskRoutes()
+	s.addTaskDetailRoutes()
+	s.addCategoryRoutes()
+	s.addCustomFieldRoutes()
+	s.addTagRoutes()
+	s.addSearchRoutes()
+	s.addWorkspaceRoutes()
+	s.addUserRoutes()
+	s.addNotificationRoutes()
+	s.addAuthenticationRoutes()
+	s.addIntegrationRoutes()
+	s.addAdminRoutes()
+	s.addGraphQLRoutes()
+	return s
+}
+
+// addErrorResponses adds the responses sent by the helpers in errors.go. Every error has
+// the same envelope, except that for failed validation the error is an object mapping
+// each invalid field to what is wrong with it. Clients that accept
+// application/problem+json get problem details instead.
+func (s *apiSpec) addErrorResponses() {
+	traceID := openapi.String().Describe("Identifies the request in the server's logs and traces.")
+	s.Components.Schemas["Error"] = openapi.Object(map[string]*openapi.Schema{
+		"error":    openapi.String(),
+		"trace_id": traceID,
+	})
+	s.Components.Schemas["ValidationError"] = openapi.Object(map[string]*openapi.Schema{
+		"error":    openapi.MapOf(openapi.String()).Describe("The invalid fields, each with a description of the problem."),
+		"trace_id": traceID,
+	})
+	s.Components.Schemas["Problem"] = openapi.Object(map[string]*openapi.Schema{
+		"type":     openapi.String().Describe("Always about:blank: the status says what kind of error it is."),
+		"title":    openapi.String(),
+		"status":   openapi.Integer(),
+		"detail":   openapi.String(),
+		"instance": openapi.String().Describe("The path of the request."),
+		"errors":   openapi.MapOf(openapi.String()).Describe("For failed validation, the invalid fields, each with a description of the problem."),
+		"trace_id": traceID,
+	})
+
+	responses := []struct {
+		name, description, schema string
+	}{
+		{"BadRequest", "The request was malformed, e.g. its body isn't valid JSON or has unknown fields.", "Error"},
+		{"Unauthorized", "The credentials are missing, invalid or expired.", "Error"},
+		{"Forbidden", "The user isn't activated, or lacks the permission or workspace role needed.", "Error"},
+		{"NotFound", "The resource doesn't exist, or isn't visible to the user.", "Error"},
+		{"EditConflict", "The resource was changed by another request; fetch it again and retry.", "Error"},
+		{"FailedValidation", "Some fields are invalid.", "ValidationError"},
+		{"RateLimited", "Too many requests; wait before trying again.", "Error"},
+		{"BadGateway", "A service the server relies on didn't accept the request.", "Error"},
+		{"ServerError", "The server encountered a problem and could not process the request.", "Error"},
+	}
+	for _, r := range responses {
+		s.Components.Responses[r.name] = &openapi.Response{
+			Description: r.description,
+			Content: map[string]openapi.MediaType{
+				"application/json":         {Schema: &openapi.Schema{Ref: "#/components/schemas/" + r.schema}},
+				"application/problem+json": {Schema: &openapi.Schema{Ref: "#/components/schemas/Problem"}},
+			},
+		}
+	}
+}
+
+// deprecateV1 marks the /v1/ operations of the document as deprecated, as the
+// Deprecation header sent by versionRequests() does.
+func (s *apiSpec) deprecateV1() {
+	s.Info.Description += "\n\n/v1/ is deprecated: the same endpoints are served under /v2/, where responses aren't " +
+		"wrapped in an envelope and errors are RFC 7807 problem details."
+	for path, item := range s.Paths {
+		if !strings.HasPrefix(path, "/v1/") {
+			continue
+		}
+		for _, op := range item {
+			op.Deprecated = true
+		}
+	}
+}
+
+// unversionedPaths are the operations whose bodies are the same under /v1/ and /v2/,
+// because they aren't envelopes: files for download and GraphQL responses.
+var unversionedPaths = map[string]bool{
+	"/v1/export":       true,
+	"/v1/tasks/export": true,
+	"/v1/graphql":      true,
+}
+
+// convertToV2 turns the document into the one for /v2/: the paths are moved, response
+// envelopes are replaced by what they hold, as flattenEnvelope() does, and errors are
+// problem details.
+func (s *apiSpec) convertToV2() {
+	s.Info.Description = strings.ReplaceAll(s.Info.Description, "/v1/", "/v2/") +
+		"\n\nLists are paginated with the X-Page, X-Page-Size, X-Last-Page and X-Total-Count headers. " +
+		"Errors are RFC 7807 problem details."
+	for _, scheme := range s.Components.SecuritySchemes {
+		scheme.Description = strings.ReplaceAll(scheme.Description, "/v1/", "/v2/")
+	}
+
+	pagination := map[string]*openapi.Header{
+		"X-Page":        {Description: "The page returned.", Schema: openapi.Integer()},
+		"X-Page-Size":   {Description: "The number of records per page.", Schema: openapi.Integer()},
+		"X-Last-Page":   {Description: "The number of the last page.", Schema: openapi.Integer()},
+		"X-Total-Count": {Description: "The number of records on all pages.", Schema: openapi.Integer()},
+	}
+	paths := make(map[string]openapi.PathItem, len(s.Paths))
+	for path, item := range s.Paths {
+		rest, ok := strings.CutPrefix(path, "/v1/")
+		if !ok {
+			paths[path] = item
+			continue
+		}
+		if !unversionedPaths[path] {
+			for _, op := range item {
+				for _, response := range op.Responses {
+					for mediaType, content := range response.Content {
+						schema, paginated := flattenEnvelopeSchema(content.Schema)
+						response.Content[mediaType] = openapi.MediaType{Schema: schema}
+						if paginated {
+							response.Headers = pagination
+						}
+					}
+				}
+			}
+		}
+		for _, op := range item {
+			op.Description = strings.ReplaceAll(op.Description, "/v1/", "/v2/")
+			for _, param := range op.Parameters {
+				param.Description = strings.ReplaceAll(param.Description, "/v1/", "/v2/")
+			}
+		}
+		paths["/v2/"+rest] = item
+	}
+	s.Paths = paths
+
+	delete(s.Components.Schemas, "Error")
+	delete(s.Components.Schemas, "ValidationError")
+	for _, response := range s.Components.Responses {
+		delete(response.Content, "application/json")
+	}
+}
+
+// The flattenEnvelopeSchema() helper returns the schema of the v2 body for a v1 response
+// envelope, and whether it is a paginated list.
+func flattenEnvelopeSchema(schema *openapi.Schema) (*openapi.Schema, bool) {
+	if schema == nil || schema.Type != "object" {
+		return schema, false
+	}
+	if _, ok := schema.Properties["metadata"]; ok && len(schema.Properties) == 2 {
+		for key, value := range schema.Properties {
+			if key != "metadata" {
+				return value, true
+			}
+		}
+	}
+	if len(schema.Properties) == 1 {
+		for _, value := range schema.Properties {
+			return value, false
+		}
+	}
+	return schema, false
+}
+
+// op adds an operation to the document. Path parameters named id or ending in _id are
+// integers, the others strings. Every endpoint is rate limited and can fail.
+func (s *apiSpec) op(method, path, tag, summary string) *openapi.Operation {
+	op := openapi.NewOperation(summary, tag)
+	for _, segment := range strings.Split(path, "/") {
+		name, ok := strings.CutPrefix(segment, ":")
+		if !ok {
+			continue
+		}
+		schema := openapi.String()
+		if name == "id" || name == "version" || strings.HasSuffix(name, "_id") {
+			schema = openapi.Integer()
+		}
+		op.Param("path", name, schema, "")
+	}
+	op.ReturnsRef(http.StatusTooManyRequests, "RateLimited")
+	op.ReturnsRef(http.StatusInternalServerError, "ServerError")
+	s.Add(method, path, op)
+	return op
+}
+
+// public adds an operation that needs no authentication.
+func (s *apiSpec) public(method, path, tag, summary string) *openapi.Operation {
+	return s.op(method, path, tag, summary).Secure()
+}
+
+// authenticated adds an operation for activated users, see requireActivatedUser().
+func (s *apiSpec) authenticated(method, path, tag, summary string) *openapi.Operation {
+	op := s.op(method, path, tag, summary)
+	op.ReturnsRef(http.StatusUnauthorized, "Unauthorized")
+	op.ReturnsRef(http.StatusForbidden, "Forbidden")
+	return op
+}
+
+// workspace adds an operation on a workspace's tasks or categories, see
+// requireWorkspaceRole().
+func (s *apiSpec) workspace(method, path, tag, summary string) *openapi.Operation {
+	op := s.authenticated(method, path, tag, summary)
+	op.Param("header", "X-Workspace-ID", openapi.Integer(), "The workspace to act in. Defaults to the user's personal workspace.")
+	op.Param("query", "workspace_id", openapi.Integer(), "The workspace to act in, for clients that can't set headers.")
+	op.ReturnsRef(http.StatusNotFound, "NotFound")
+	return op
+}
+
+// idempotent documents the Idempotency-Key header honoured by idempotent().
+func (s *apiSpec) idempotent(op *openapi.Operation) *openapi.Operation {
+	return op.Param("header", "Idempotency-Key", openapi.String(), "Makes retries safe: a repeated request with the same key gets the stored response of the first.")
+}
+
+// rendered documents the render parameter read by readRender().
+func (s *apiSpec) rendered(op *openapi.Operation) *openapi.Operation {
+	return op.Param("query", "render", openapi.Enum("html"), "With html, descriptions and comment bodies are also sent rendered from Markdown as sanitized HTML, in description_html and body_html.")
+}
+
+// sparse documents the fields parameter read by sparseFields().
+func (s *apiSpec) sparse(op *openapi.Operation) *openapi.Operation {
+	return op.Param("query", "fields", openapi.String(), "A comma-separated list of the fields to send, such as id,title,due_date. The others are left out.")
+}
+
+// included documents the include parameter read by readInclude().
+func (s *apiSpec) included(op *openapi.Operation) *openapi.Operation {
+	return op.Param("query", "include", openapi.String(), "A comma-separated list of related resources to embed in the tasks: "+strings.Join(taskIncludeNames, ", ")+". Tasks in lists always embed their category.")
+}
+
+// categoryFielded documents the category_fields parameter read by readCategoryFields().
+func (s *apiSpec) categoryFielded(op *openapi.Operation) *openapi.Operation {
+	return op.Param("query", "category_fields", openapi.String(), "A comma-separated list of the fields of the embedded category_details to send: "+strings.Join(categoryFieldNames, ", ")+". Defaults to "+strings.Join(defaultCategoryFields, ",")+".")
+}
+
+// body sets the JSON request body from a Go value, usually a struct literal mirroring the
+// handler's input struct, along with the responses for bodies that can't be read.
+func (s *apiSpec) body(op *openapi.Operation, v interface{}) *openapi.Operation {
+	op.Body(s.SchemaOf(v))
+	op.ReturnsRef(http.StatusBadRequest, "BadRequest")
+	op.ReturnsRef(http.StatusUnprocessableEntity, "FailedValidation")
+	return op
+}
+
+// paginate documents the page, page_size and sort parameters read into data.Filters. Each
+// sort field can also be prefixed with "-" to sort in descending order.
+func (s *apiSpec) paginate(op *openapi.Operation, maxPageSize int, defaultSort string, sorts ...string) *openapi.Operation {
+	values := append([]string{}, sorts...)
+	for _, sort := range sorts {
+		values = append(values, "-"+sort)
+	}
+	sort := openapi.Enum(values...)
+	sort.Example = defaultSort
+
+	op.Param("query", "page", openapi.Integer(), "The page to return, from 1.")
+	op.Param("query", "page_size", openapi.Integer(), "The number of records per page, at most "+strconv.Itoa(maxPageSize)+". Defaults to 20.")
+	op.Param("query", "sort", sort, "The field to sort by, descending if prefixed with -. Defaults to "+defaultSort+".")
+	op.ReturnsRef(http.StatusUnprocessableEntity, "FailedValidation")
+	return op
+}
+
+// envelope returns the schema of a response envelope, with the schema of each member
+// taken from a Go value or given directly.
+func (s *apiSpec) envelope(env envelope) *openapi.Schema {
+	properties := make(map[string]*openapi.Schema, len(env))
+	for key, value := range env {
+		properties[key] = s.SchemaOf(value)
+	}
+	return openapi.Object(properties)
+}
+
+// message is the envelope of responses that only carry a message, such as most deletes.
+func (s *apiSpec) message() *openapi.Schema {
+	return s.envelope(envelope{"message": openapi.String()})
+}
+
+// negotiated adds a response sent with writeResponse(), which can also be XML or CSV
+// depending on the Accept header, and can be requested conditionally, see
+// writeCacheable().
+func (s *apiSpec) negotiated(op *openapi.Operation, status int, description string, schema *openapi.Schema) *openapi.Operation {
+	op.Returns(status, description, schema)
+	op.ReturnsAs(status, description, "application/xml", schema)
+	op.ReturnsAs(status, description, "text/csv", openapi.String())
+	op.Responses[strconv.Itoa(status)].Headers = map[string]*openapi.Header{
+		"ETag":          {Description: "Identifies this version of the response, for If-None-Match.", Schema: openapi.String()},
+		"Cache-Control": {Description: "Always " + cacheControl + ".", Schema: openapi.String()},
+		"Last-Modified": {Description: "When the resource was last changed, for If-Modified-Since. Only sent for single resources.", Schema: openapi.String()},
+	}
+	op.Param("header", "If-None-Match", openapi.String(), "The ETag of a copy of the response; if it is still current, 304 is returned instead.")
+	op.Param("header", "If-Modified-Since", openapi.String(), "Without If-None-Match, the Last-Modified time of a copy of the response; if the resource hasn't changed since, 304 is returned instead.")
+	op.ReturnsAs(http.StatusNotModified, "The client's copy is still current.", "", nil)
+	return op
+}
+
+func (s *apiSpec) addHealthRoutes() {
+	s.public(http.MethodGet, "/v1/healthcheck", "Health", "Report the API's status and version").
+		Returns(http.StatusOK, "The API is available.", s.envelope(envelope{
+			"status": openapi.String(),
+			"system_info": openapi.Object(map[string]*openapi.Schema{
+				"environment": openapi.String(),
+				"version":     openapi.String(),
+				"schema":      s.SchemaOf((*data.SchemaVersion)(nil)),
+			}),
+		}))
+	s.public(http.MethodGet, "/v1/healthcheck/live", "Health", "Check that the process is serving requests").
+		Returns(http.StatusOK, "The process is alive.", s.envelope(envelope{"status": openapi.Enum("alive")}))
+
+	readiness := s.envelope(envelope{
+		"status": openapi.Enum("ready", "unavailable"),
+		"checks": openapi.MapOf(openapi.Object(map[string]*openapi.Schema{
+			"status":     openapi.Enum("up", "down"),
+			"latency_ms": openapi.Number(),
+			"error":      openapi.String(),
+		})),
+	})
+	s.public(http.MethodGet, "/v1/healthcheck/ready", "Health", "Check the API's dependencies").
+		Returns(http.StatusOK, "Every dependency is up.", readiness).
+		Returns(http.StatusServiceUnavailable, "At least one dependency is down.", readiness)
+	s.public(http.MethodGet, "/v1/time", "Health", "Get the server's current time and time zone").
+		Returns(http.StatusOK, "The server's clock.", s.envelope(envelope{
+			"now":      &openapi.Schema{Type: "string", Format: "date-time"},
+			"timezone": openapi.String(),
+		}))
+	s.public(http.MethodGet, "/metrics", "Health", "Get metrics in the Prometheus text format").
+		ReturnsAs(http.StatusOK, "The metrics.", "text/plain", openapi.String())
+	s.public(http.MethodGet, "/v1/openapi.json", "Health", "Get this OpenAPI document").
+		Returns(http.StatusOK, "The OpenAPI document.", &openapi.Schema{})
+	s.public(http.MethodGet, "/v1/docs", "Health", "Browse this OpenAPI document with Swagger UI").
+		Describe("Only available when the server runs with -docs-ui.").
+		ReturnsAs(http.StatusOK, "The Swagger UI page.", "text/html", openapi.String())
+}
+
+func (s *apiSpec) addTaskRoutes() {
+	task := s.envelope(envelope{"task": data.Task{}})
+	// A task's due and start dates are null if it has none, and null in an update removes
+	// them.
+	optionalDueDate := s.SchemaOf((*data.CustomTime)(nil))
+	s.Components.Schemas["Task"].Properties["due_date"] = optionalDueDate
+	s.Components.Schemas["Task"].Properties["start_date"] = optionalDueDate
+	s.DefineType(optionalTime{}, "", optionalDueDate)
+	s.DefineType(categoryDetails{}, "", &openapi.Schema{
+		AllOf:       []*openapi.Schema{s.SchemaOf(data.Category{})},
+		Description: "The task's category, with only the fields picked by category_fields.",
+	})
+
+	op := s.workspace(http.MethodGet, "/v1/tasks", "Tasks", "List tasks").
+		Describe("Pages of more than 100 tasks are streamed. With ids, the given tasks are returned instead, without metadata.").
+		Param("query", "ids", openapi.String(), "A comma-separated list of task IDs to fetch; the other parameters are then ignored.").
+		Param("query", "title", openapi.String(), "Only tasks whose title contains all these words. If none does, tasks with similar titles are returned instead.").
+		Param("query", "q", openapi.String(), "Search titles and descriptions, ranking the results. If nothing matches, tasks with similar titles are returned instead, most similar first.").
+		Param("query", "tags", openapi.String(), "A comma-separated list of tag names the tasks must have.").
+		Param("query", "include_archived", openapi.Boolean(), "Include archived tasks.").
+		Param("query", "include_snoozed", openapi.Boolean(), "Include snoozed tasks.").
+		Param("query", "status", openapi.String(), "A comma-separated list of statuses: "+strings.Join(data.TaskStatuses, ", ")+".").
+		Param("query", "priority", openapi.String(), "A comma-separated list of priorities: "+strings.Join(data.TaskPriorities, ", ")+".").
+		Param("query", "category", openapi.String(), "Only tasks in the category with this name.").
+		Param("query", "category_id", openapi.Integer(), "Only tasks in this category.").
+		Param("query", "due_before", &openapi.Schema{Type: "string", Format: "date-time"}, "Only tasks due before this time.").
+		Param("query", "due_after", &openapi.Schema{Type: "string", Format: "date-time"}, "Only tasks due after this time.").
+		Param("query", "has_due_date", openapi.Boolean(), "Only tasks with (true) or without (false) a due date.").
+		Param("query", "due", openapi.Enum(data.TaskDueFilters...), "Only tasks that are overdue, due today, or due in the seven days from today, in the user's time zone. Tasks due today are left out until their start date.").
+		Param("query", "available", openapi.Boolean(), "Only tasks without a start date or whose start date has arrived.").
+		Param("query", "scheduled", openapi.Boolean(), "Only tasks whose start date is still to come.").
+		Param("query", "custom.{name}", openapi.String(), "Only tasks whose custom field of this name has the value, e.g. ?custom.customer=Acme.").
+		Param("query", "completed_before", &openapi.Schema{Type: "string", Format: "date-time"}, "Only tasks completed before this time.").
+		Param("query", "completed_after", &openapi.Schema{Type: "string", Format: "date-time"}, "Only tasks completed after this time.").
+		Param("query", "pinned", openapi.Boolean(), "Only tasks the user has (true) or hasn't (false) pinned. Without it, pinned tasks come first.")
+	s.paginate(s.categoryFielded(s.included(s.sparse(s.rendered(op)))), maxStreamedPageSize, "id", "id", "title", "priority", "category", "position", "due_date", "estimate_minutes")
+	s.negotiated(op, http.StatusOK, "A page of tasks.", s.envelope(envelope{"tasks": []taskListItem{}, "metadata": data.Metadata{}}))
+
+	op = s.workspace(http.MethodPost, "/v1/tasks", "Tasks", "Create a task")
+	s.body(s.idempotent(op), struct {
+		Title       string            `json:"title"`
+		Description string            `json:"description"`
+		DueDate     *data.CustomTime  `json:"due_date"`
+		StartDate   *data.CustomTime  `json:"start_date"`
+		Priority    data.TaskPriority `json:"priority"`
+		Status      data.TaskStatus   `json:"status"`
+		CategoryID  int64             `json:"category_id"`
+		Category    string            `json:"category"`
+		Recurrence  string            `json:"recurrence"`
+
+		EstimateMinutes  *int `json:"estimate_minutes"`
+		RemainingMinutes *int `json:"remaining_minutes"`
+
+		CustomFields map[string]interface{} `json:"custom_fields"`
+	}{})
+	op.Returns(http.StatusCreated, "The new task.", task)
+
+	op = s.included(s.sparse(s.rendered(s.workspace(http.MethodGet, "/v1/tasks/:id", "Tasks", "Show a task"))))
+	s.negotiated(op, http.StatusOK, "The task, with its dependencies and tracked time.", s.envelope(envelope{"task": taskDetail{}}))
+
+	op = s.workspace(http.MethodPatch, "/v1/tasks/:id", "Tasks", "Update a task").
+		Describe("Only the fields given are changed. Status changes must follow the workflow.").
+		ReturnsRef(http.StatusConflict, "EditConflict")
+	s.body(op, taskInput{}).Returns(http.StatusOK, "The updated task.", task)
+
+	s.workspace(http.MethodDelete, "/v1/tasks/:id", "Tasks", "Delete a task").
+		Returns(http.StatusOK, "The task was deleted.", s.message())
+
+	for _, action := range []struct{ path, summary string }{
+		{"/v1/tasks/:id/archive", "Archive a task"},
+		{"/v1/tasks/:id/unarchive", "Unarchive a task"},
+		{"/v1/tasks/:id/complete", "Complete a task"},
+		{"/v1/tasks/:id/reopen", "Reopen a completed task"},
+	} {
+		s.idempotent(s.workspace(http.MethodPost, action.path, "Tasks", action.summary)).
+			ReturnsRef(http.StatusConflict, "EditConflict").
+			Returns(http.StatusOK, "The updated task.", task)
+	}
+
+	op = s.idempotent(s.workspace(http.MethodPost, "/v1/tasks/:id/snooze", "Tasks", "Snooze a task")).
+		Describe("Leaves the task out of the default task lists, and holds back its reminders, for duration_minutes or until a time. A date on its own is midnight in the user's time zone. Snoozes are for at most a year.").
+		ReturnsRef(http.StatusConflict, "EditConflict")
+	s.body(op, struct {
+		DurationMinutes *int             `json:"duration_minutes"`
+		Until           *data.CustomTime `json:"until"`
+	}{}).Returns(http.StatusOK, "The snoozed task.", task)
+	s.workspace(http.MethodDelete, "/v1/tasks/:id/snooze", "Tasks", "End a task's snooze").
+		ReturnsRef(http.StatusConflict, "EditConflict").
+		Returns(http.StatusOK, "The task.", task)
+
+	for _, action := range []struct{ path, summary string }{
+		{"/v1/tasks/:id/pin", "Pin a task"},
+		{"/v1/tasks/:id/unpin", "Unpin a task"},
+	} {
+		s.categoryFielded(s.workspace(http.MethodPost, action.path, "Tasks", action.summary)).
+			Describe("Pins are the user's own: pinned tasks come first in their task lists.").
+			Returns(http.StatusOK, "The task, with whether it is pinned.", s.envelope(envelope{"task": taskListItem{}}))
+	}
+
+	op = s.idempotent(s.workspace(http.MethodPost, "/v1/tasks/:id/duplicate", "Tasks", "Duplicate a task")).
+		Describe("Creates a to-do copy of the task, with its subtasks (none of them done) and tags unless turned off. A due date that has passed isn't copied; the body can give a new one. The body is optional.")
+	s.body(op, struct {
+		Subtasks *bool        `json:"subtasks"`
+		Tags     *bool        `json:"tags"`
+		DueDate  optionalTime `json:"due_date"`
+	}{}).Returns(http.StatusCreated, "The new task.", task)
+	op.RequestBody.Required = false
+
+	op = s.workspace(http.MethodPatch, "/v1/tasks/:id/move", "Tasks", "Move a task on the board").
+		Describe("Changes the task's status and places it between two others, given by before_id and after_id.").
+		ReturnsRef(http.StatusConflict, "EditConflict")
+	s.body(op, struct {
+		Status   *data.TaskStatus `json:"status"`
+		BeforeID int64            `json:"before_id"`
+		AfterID  int64            `json:"after_id"`
+		Version  *int32           `json:"version"`
+	}{}).Returns(http.StatusOK, "The moved task.", task)
+
+	op = s.workspace(http.MethodPost, "/v1/tasks/bulk", "Tasks", "Apply several operations to tasks at once").
+		Describe("Operations run in one transaction, which is only committed if they all succeed.")
+	s.body(s.idempotent(op), struct {
+		Operations []bulkOperation `json:"operations"`
+	}{})
+	results := s.envelope(envelope{"committed": openapi.Boolean(), "results": []bulkResult{}})
+	op.Returns(http.StatusOK, "Every operation succeeded.", results).
+		Returns(http.StatusUnprocessableEntity, "An operation failed, and nothing was changed.", results)
+
+	op = s.idempotent(s.workspace(http.MethodPost, "/v1/tasks/import", "Tasks", "Import tasks from a CSV file")).
+		Describe("The file is the \"file\" field of a multipart form, or the raw request body.").
+		Param("query", "mapping", openapi.String(), `A JSON object from CSV column names to task fields, e.g. {"Name": "title"}.`).
+		Param("query", "mode", openapi.Enum("atomic", "best_effort"), "Whether to import nothing if any row is invalid (the default), or only the valid rows.").
+		BodyAs("multipart/form-data", openapi.Object(map[string]*openapi.Schema{
+			"file":    {Type: "string", Format: "binary"},
+			"mapping": openapi.String(),
+			"mode":    openapi.Enum("atomic", "best_effort"),
+		})).
+		BodyAs("text/csv", openapi.String()).
+		ReturnsRef(http.StatusBadRequest, "BadRequest")
+	imported := s.envelope(envelope{"imported": openapi.Integer(), "errors": []importRowError{}})
+	op.Returns(http.StatusOK, "The tasks were imported, apart from any rows reported.", imported).
+		Returns(http.StatusUnprocessableEntity, "Some rows are invalid, and nothing was imported.", imported)
+
+	s.workspace(http.MethodGet, "/v1/tasks/export", "Tasks", "Export all tasks").
+		Param("query", "format", openapi.Enum("csv", "json"), "Defaults to csv.").
+		ReturnsAs(http.StatusOK, "The tasks, as an attachment.", "text/csv", openapi.String()).
+		Returns(http.StatusOK, "The tasks, as an attachment.", s.envelope(envelope{"tasks": []data.Task{}}))
+
+	s.authenticated(http.MethodGet, "/v1/tasks/events", "Tasks", "Stream the user's task events").
+		Describe("A stream of server-sent events, each with the event type and a JSON data line holding the task.").
+		ReturnsAs(http.StatusOK, "The event stream.", "text/event-stream", openapi.String())
+
+	s.public(http.MethodGet, "/v1/tasks/calendar.ics", "Integrations", "Get the user's tasks as an iCalendar feed").
+		Param("query", "token", openapi.String(), "A calendar token from POST /v1/users/me/calendar-token.").
+		Param("query", "kind", openapi.Enum("todo", "event"), "Render tasks as VTODO (the default) or VEVENT components.").
+		ReturnsRef(http.StatusUnauthorized, "Unauthorized").
+		ReturnsRef(http.StatusUnprocessableEntity, "FailedValidation").
+		ReturnsAs(http.StatusOK, "The calendar.", "text/calendar", openapi.String())
+
+	s.rendered(s.public(http.MethodGet, "/v1/shared/:token", "Tasks", "Show a task through a share link")).
+		Returns(http.StatusOK, "The task and its comments.", s.envelope(envelope{"task": data.Task{}, "comments": []data.Comment{}, "metadata": data.Metadata{}})).
+		ReturnsRef(http.StatusNotFound, "NotFound")
+	s.idempotent(s.workspace(http.MethodPost, "/v1/tasks/:id/share", "Tasks", "Create a share link for a task")).
+		Returns(http.StatusCreated, "The share link.", s.envelope(envelope{"share": data.TaskShare{}, "url": openapi.String()}))
+	s.workspace(http.MethodDelete, "/v1/tasks/:id/share", "Tasks", "Revoke a task's share link").
+		Returns(http.StatusOK, "The link was revoked.", s.message())
+
+	s.workspace(http.MethodGet, "/v1/stats", "Tasks", "Get task statistics for the workspace").
+		Param("query", "from", &openapi.Schema{Type: "string", Format: "date-time"}, "Defaults to 30 days before to.").
+		Param("query", "to", &openapi.Schema{Type: "string", Format: "date-time"}, "Defaults to now.").
+		Param("query", "interval", openapi.Enum(data.StatsIntervals...), "Defaults to day.").
+		ReturnsRef(http.StatusUnprocessableEntity, "FailedValidation").
+		Returns(http.StatusOK, "The statistics.", s.envelope(envelope{"stats": data.Stats{}}))
+
+	s.workspace(http.MethodGet, "/v1/export", "Workspaces", "Back up all of the workspace's data").
+		Returns(http.StatusOK, "The backup, as an attachment.", s.envelope(envelope{"backup": data.Backup{}}))
+	op = s.idempotent(s.workspace(http.MethodPost, "/v1/import", "Workspaces", "Restore a backup into the workspace"))
+	s.body(op, struct {
+		Backup *data.Backup `json:"backup"`
+	}{}).Returns(http.StatusOK, "What was imported.", s.envelope(envelope{"imported": data.ImportSummary{}}))
+}
+
+func (s *apiSpec) addTaskDetailRoutes() {
+	const tag = "Task details"
+
+	s.workspace(http.MethodGet, "/v1/tasks/:id/dependencies", tag, "List a task's blockers and dependents").
+		Returns(http.StatusOK, "The related tasks.", s.envelope(envelope{"blockers": []data.TaskRef{}, "dependents": []data.TaskRef{}}))
+	s.workspace(http.MethodPut, "/v1/tasks/:id/blockers/:blocker_id", tag, "Mark a task as blocked by another").
+		ReturnsRef(http.StatusUnprocessableEntity, "FailedValidation").
+		Returns(http.StatusOK, "The blocker was added.", s.envelope(envelope{"blocker": data.TaskRef{}}))
+	s.workspace(http.MethodDelete, "/v1/tasks/:id/blockers/:blocker_id", tag, "Remove a task's blocker").
+		Returns(http.StatusOK, "The blocker was removed.", s.message())
+
+	subtask := s.envelope(envelope{"subtask": data.Subtask{}})
+	s.workspace(http.MethodGet, "/v1/tasks/:id/subtasks", tag, "List a task's subtasks").
+		Returns(http.StatusOK, "The subtasks.", s.envelope(envelope{"subtasks": []data.Subtask{}}))
+	op := s.idempotent(s.workspace(http.MethodPost, "/v1/tasks/:id/subtasks", tag, "Add a subtask"))
+	s.body(op, struct {
+		Title string `json:"title"`
+		Done  bool   `json:"done"`
+	}{}).Returns(http.StatusCreated, "The new subtask.", subtask)
+	op = s.workspace(http.MethodPatch, "/v1/tasks/:id/subtasks/:subtask_id", tag, "Update a subtask")
+	s.body(op, struct {
+		Title    *string `json:"title"`
+		Done     *bool   `json:"done"`
+		Position *int    `json:"position"`
+	}{}).Returns(http.StatusOK, "The updated subtask.", subtask)
+	s.workspace(http.MethodDelete, "/v1/tasks/:id/subtasks/:subtask_id", tag, "Delete a subtask").
+		Returns(http.StatusOK, "The subtask was deleted.", s.message())
+
+	comment := s.envelope(envelope{"comment": data.Comment{}})
+	op = s.rendered(s.workspace(http.MethodGet, "/v1/tasks/:id/comments", tag, "List a task's comments"))
+	s.paginate(op, 100, "created_at", "id", "created_at").
+		Returns(http.StatusOK, "A page of comments.", s.envelope(envelope{"comments": []data.Comment{}, "metadata": data.Metadata{}}))
+	op = s.idempotent(s.workspace(http.MethodPost, "/v1/tasks/:id/comments", tag, "Comment on a task"))
+	s.body(op, struct {
+		Body     string `json:"body"`
+		ParentID *int64 `json:"parent_id"`
+	}{}).Returns(http.StatusCreated, "The new comment.", comment)
+	op = s.workspace(http.MethodPatch, "/v1/tasks/:id/comments/:comment_id", tag, "Edit a comment")
+	s.body(op, struct {
+		Body *string `json:"body"`
+	}{}).Returns(http.StatusOK, "The edited comment.", comment)
+	s.workspace(http.MethodDelete, "/v1/tasks/:id/comments/:comment_id", tag, "Delete a comment").
+		Returns(http.StatusOK, "The comment was deleted.", s.message())
+	s.rendered(s.workspace(http.MethodGet, "/v1/tasks/:id/comments/:comment_id/history", tag, "Show a comment's earlier versions")).
+		Returns(http.StatusOK, "The comment and its edits.", s.envelope(envelope{"comment": data.Comment{}, "history": []data.CommentEdit{}}))
+
+	attachment := s.envelope(envelope{"attachment": data.Attachment{}})
+	s.workspace(http.MethodGet, "/v1/tasks/:id/attachments", tag, "List a task's attachments").
+		Returns(http.StatusOK, "The attachments, without their content.", s.envelope(envelope{"attachments": []data.Attachment{}}))
+	s.workspace(http.MethodPost, "/v1/tasks/:id/attachments", tag, "Attach a file to a task").
+		Describe("The file is the \"file\" field of a multipart form, or the raw request body, named by the filename parameter. Programs and scripts are refused, and so is anything the server's virus scanner finds; until the attachment has been scanned its scan_status is pending and it can't be downloaded.").
+		Param("query", "filename", openapi.String(), "The name of a file sent as the raw request body.").
+		BodyAs("multipart/form-data", openapi.Object(map[string]*openapi.Schema{
+			"file": {Type: "string", Format: "binary"},
+		})).
+		BodyAs("application/octet-stream", &openapi.Schema{Type: "string", Format: "binary"}).
+		ReturnsRef(http.StatusBadRequest, "BadRequest").
+		ReturnsRef(http.StatusUnprocessableEntity, "FailedValidation").
+		Returns(http.StatusCreated, "The new attachment, waiting to be scanned.", attachment)
+	s.workspace(http.MethodGet, "/v1/tasks/:id/attachments/:attachment_id", tag, "Show an attachment").
+		Returns(http.StatusOK, "The attachment, without its content.", attachment)
+	s.workspace(http.MethodGet, "/v1/tasks/:id/attachments/:attachment_id/content", tag, "Download an attachment").
+		Describe("Only attachments that passed their scan can be downloaded: 409 is returned while the scan is pending, or if the attachment was rejected.").
+		ReturnsRef(http.StatusConflict, "EditConflict").
+		ReturnsAs(http.StatusOK, "The content of the file, with the type it was found to have.", "application/octet-stream", &openapi.Schema{Type: "string", Format: "binary"})
+	s.workspace(http.MethodDelete, "/v1/tasks/:id/attachments/:attachment_id", tag, "Delete an attachment").
+		Returns(http.StatusOK, "The attachment was deleted.", s.message())
+
+	s.workspace(http.MethodGet, "/v1/tasks/:id/tags", tag, "List a task's tags").
+		Returns(http.StatusOK, "The tags.", s.envelope(envelope{"tags": []data.Tag{}}))
+	s.workspace(http.MethodPut, "/v1/tasks/:id/tags/:tag_id", tag, "Tag a task").
+		Returns(http.StatusOK, "The tag was added.", s.envelope(envelope{"tag": data.Tag{}}))
+	s.workspace(http.MethodDelete, "/v1/tasks/:id/tags/:tag_id", tag, "Remove a tag from a task").
+		Returns(http.StatusOK, "The tag was removed.", s.message())
+
+	entry := s.envelope(envelope{"time_entry": data.TimeEntry{}})
+	s.idempotent(s.workspace(http.MethodPost, "/v1/tasks/:id/timer/start", tag, "Start a timer on a task")).
+		ReturnsRef(http.StatusConflict, "EditConflict").
+		Returns(http.StatusCreated, "The running time entry.", entry)
+	s.idempotent(s.workspace(http.MethodPost, "/v1/tasks/:id/timer/stop", tag, "Stop the running timer")).
+		Returns(http.StatusOK, "The finished time entry.", entry)
+	s.workspace(http.MethodGet, "/v1/tasks/:id/time-entries", tag, "List the time tracked on a task").
+		Returns(http.StatusOK, "The time entries and their total.", s.envelope(envelope{"time_entries": []data.TimeEntry{}, "tracked_seconds": openapi.Integer()}))
+	op = s.idempotent(s.workspace(http.MethodPost, "/v1/tasks/:id/time-entries", tag, "Record time spent on a task"))
+	s.body(op, struct {
+		StartedAt data.CustomTime  `json:"started_at"`
+		EndedAt   *data.CustomTime `json:"ended_at"`
+		Note      string           `json:"note"`
+	}{}).Returns(http.StatusCreated, "The new time entry.", entry)
+	s.workspace(http.MethodDelete, "/v1/tasks/:id/time-entries/:entry_id", tag, "Delete a time entry").
+		Returns(http.StatusOK, "The time entry was deleted.", s.message())
+
+	s.workspace(http.MethodGet, "/v1/tasks/:id/versions", tag, "List a task's earlier versions").
+		Returns(http.StatusOK, "The versions.", s.envelope(envelope{"versions": []data.TaskVersion{}}))
+	s.idempotent(s.workspace(http.MethodPost, "/v1/tasks/:id/revert/:version", tag, "Revert a task to an earlier version")).
+		ReturnsRef(http.StatusConflict, "EditConflict").
+		ReturnsRef(http.StatusUnprocessableEntity, "FailedValidation").
+		Returns(http.StatusOK, "The reverted task.", s.envelope(envelope{"task": data.Task{}}))
+	op = s.workspace(http.MethodGet, "/v1/tasks/:id/activity", tag, "List the changes made to a task")
+	s.paginate(op, 100, "-created_at", "created_at").
+		Returns(http.StatusOK, "A page of audit entries.", s.envelope(envelope{"activity": []data.AuditEntry{}, "metadata": data.Metadata{}}))
+}
+
+func (s *apiSpec) addCategoryRoutes() {
+	const tag = "Categories"
+	category := s.envelope(envelope{"category": data.Category{}})
+
+	op := s.idempotent(s.workspace(http.MethodPost, "/v1/category", tag, "Create a category"))
+	s.body(op, struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		ParentID    *int64 `json:"parent_id"`
+	}{}).Returns(http.StatusCreated, "The new category.", category)
+	op = s.sparse(s.workspace(http.MethodGet, "/v1/category/:id", tag, "Show a category"))
+	s.negotiated(op, http.StatusOK, "The category.", category)
+	op = s.workspace(http.MethodPatch, "/v1/category/:id", tag, "Update a category").
+		ReturnsRef(http.StatusConflict, "EditConflict")
+	s.body(op, struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}{}).Returns(http.StatusOK, "The updated category.", category)
+	s.workspace(http.MethodDelete, "/v1/category/:id", tag, "Delete a category").
+		Param("query", "strategy", openapi.Enum(data.DeleteStrategies...), "What happens to the category's tasks. By default a category with tasks can't be deleted.").
+		Param("query", "reassign_to", openapi.Integer(), "The category to move the tasks to, with strategy=reassign.").
+		ReturnsRef(http.StatusConflict, "EditConflict").
+		ReturnsRef(http.StatusUnprocessableEntity, "FailedValidation").
+		Returns(http.StatusOK, "The category was deleted.", s.envelope(envelope{
+			"message":          openapi.String(),
+			"tasks_deleted":    openapi.Integer(),
+			"tasks_reassigned": openapi.Integer(),
+		}))
+	op = s.workspace(http.MethodPut, "/v1/category/:id/parent", tag, "Move a category under another").
+		ReturnsRef(http.StatusConflict, "EditConflict")
+	s.body(op, struct {
+		ParentID *int64 `json:"parent_id"`
+	}{}).Returns(http.StatusOK, "The moved category.", category)
+
+	op = s.workspace(http.MethodGet, "/v1/categories", tag, "List categories").
+		Param("query", "name", openapi.String(), "Only categories whose name contains all these words.")
+	s.paginate(s.sparse(op), 100, "id", "id", "name")
+	s.negotiated(op, http.StatusOK, "A page of categories, with their task counts.", s.envelope(envelope{"categories": []data.CategoryWithCounts{}, "metadata": data.Metadata{}}))
+	s.workspace(http.MethodGet, "/v1/categories/tree", tag, "Get the categories nested under their parents").
+		Returns(http.StatusOK, "The top-level categories.", s.envelope(envelope{"categories": []data.CategoryNode{}}))
+}
+
+func (s *apiSpec) addCustomFieldRoutes() {
+	const tag = "Custom fields"
+	field := s.envelope(envelope{"custom_field": data.CustomField{}})
+
+	s.workspace(http.MethodGet, "/v1/custom-fields", tag, "List the workspace's custom fields").
+		Returns(http.StatusOK, "The custom fields, by name.", s.envelope(envelope{"custom_fields": []data.CustomField{}}))
+	op := s.idempotent(s.workspace(http.MethodPost, "/v1/custom-fields", tag, "Add a custom field to the workspace's tasks")).
+		Describe("Only the workspace's owners can. Text, date (2006-01-02) and select values are strings, number values numbers; a select field's value is one of its options.")
+	s.body(op, struct {
+		Name    string   `json:"name"`
+		Type    string   `json:"type"`
+		Options []string `json:"options"`
+	}{}).Returns(http.StatusCreated, "The new custom field.", field)
+	op = s.workspace(http.MethodPatch, "/v1/custom-fields/:id", tag, "Change a select field's options").
+		Describe("Only the workspace's owners can. Options that tasks have can't be removed; the name and type can't be changed.").
+		ReturnsRef(http.StatusConflict, "EditConflict")
+	s.body(op, struct {
+		Options []string `json:"options"`
+	}{}).Returns(http.StatusOK, "The updated custom field.", field)
+	s.workspace(http.MethodDelete, "/v1/custom-fields/:id", tag, "Delete a custom field").
+		Describe("Only the workspace's owners can. The field's values are removed from the tasks.").
+		Returns(http.StatusOK, "The custom field was deleted.", s.message())
+}
+
+func (s *apiSpec) addTagRoutes() {
+	const tag = "Tags"
+	tagEnvelope := s.envelope(envelope{"tag": data.Tag{}})
+
+	s.authenticated(http.MethodGet, "/v1/tags", tag, "List the user's tags").
+		Returns(http.StatusOK, "The tags.", s.envelope(envelope{"tags": []data.Tag{}}))
+	op := s.idempotent(s.authenticated(http.MethodPost, "/v1/tags", tag, "Create a tag"))
+	s.body(op, struct {
+		Name string `json:"name"`
+	}{}).Returns(http.StatusCreated, "The new tag.", tagEnvelope)
+	op = s.authenticated(http.MethodPatch, "/v1/tags/:id", tag, "Rename a tag").
+		ReturnsRef(http.StatusNotFound, "NotFound")
+	s.body(op, struct {
+		Name *string `json:"name"`
+	}{}).Returns(http.StatusOK, "The renamed tag.", tagEnvelope)
+	s.authenticated(http.MethodDelete, "/v1/tags/:id", tag, "Delete a tag").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The tag was deleted.", s.message())
+}
+
+func (s *apiSpec) addSearchRoutes() {
+	group := s.SchemaOf(data.SearchGroup{})
+	groups := map[string]*openapi.Schema{}
+	for _, kind := range data.SearchTypes {
+		groups[kind] = group
+	}
+
+	s.workspace(http.MethodGet, "/v1/search", "Search", "Search everything").
+		Describe("Looks through the workspace's tasks (apart from archived ones), categories and comments, and the user's tags. Each word of the query only needs to start a word of the text. Snippets are HTML-escaped, with the matching words wrapped in <mark>; results of comments are titled with their task's title. If no task matches, tasks with titles similar to the query are returned instead, and their group is marked fuzzy. Servers with an external search engine use it to look for tasks, which gives its own matching and ranking.").
+		Param("query", "q", openapi.String(), "The words to look for.").
+		Param("query", "types", openapi.String(), "A comma-separated list of the kinds of records to search: "+strings.Join(data.SearchTypes, ", ")+". Defaults to all of them.").
+		Param("query", "limit", openapi.Integer(), "How many of the best matches of each kind to return, up to "+strconv.Itoa(data.MaxSearchLimit)+". Defaults to 5.").
+		Returns(http.StatusOK, "The matches, grouped by kind. Only the kinds that were searched are included.", s.envelope(envelope{"query": openapi.String(), "results": openapi.Object(groups)}))
+}
+
+func (s *apiSpec) addWorkspaceRoutes() {
+	const tag = "Workspaces"
+	workspace := s.envelope(envelope{"workspace": data.Workspace{}})
+
+	s.authenticated(http.MethodGet, "/v1/workspaces", tag, "List the user's workspaces").
+		Returns(http.StatusOK, "The workspaces.", s.envelope(envelope{"workspaces": []data.Workspace{}}))
+	op := s.idempotent(s.authenticated(http.MethodPost, "/v1/workspaces", tag, "Create a workspace"))
+	s.body(op, struct {
+		Name string `json:"name"`
+	}{}).Returns(http.StatusCreated, "The new workspace, owned by the user.", workspace)
+	s.authenticated(http.MethodGet, "/v1/workspaces/:id", tag, "Show a workspace").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The workspace.", workspace)
+	op = s.authenticated(http.MethodPatch, "/v1/workspaces/:id", tag, "Rename a workspace").
+		ReturnsRef(http.StatusNotFound, "NotFound")
+	s.body(op, struct {
+		Name *string `json:"name"`
+	}{}).Returns(http.StatusOK, "The renamed workspace.", workspace)
+	s.authenticated(http.MethodDelete, "/v1/workspaces/:id", tag, "Delete a workspace and everything in it").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The workspace was deleted.", s.message())
+
+	s.authenticated(http.MethodGet, "/v1/workspaces/:id/members", tag, "List a workspace's members").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The members.", s.envelope(envelope{"members": []data.Member{}}))
+	op = s.authenticated(http.MethodPatch, "/v1/workspaces/:id/members/:user_id", tag, "Change a member's role").
+		ReturnsRef(http.StatusNotFound, "NotFound")
+	s.body(op, struct {
+		Role string `json:"role"`
+	}{}).Returns(http.StatusOK, "The updated member.", s.envelope(envelope{"member": data.Member{}}))
+	s.authenticated(http.MethodDelete, "/v1/workspaces/:id/members/:user_id", tag, "Remove a member from a workspace").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The member was removed.", s.message())
+
+	op = s.idempotent(s.authenticated(http.MethodPost, "/v1/workspaces/:id/invitations", tag, "Invite someone to a workspace")).
+		ReturnsRef(http.StatusNotFound, "NotFound")
+	s.body(op, struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}{}).Returns(http.StatusCreated, "The invitation, whose token is also emailed to the invitee.", s.envelope(envelope{"invitation": data.Invitation{}}))
+	op = s.authenticated(http.MethodPut, "/v1/invitations/accepted", tag, "Accept an invitation")
+	s.body(op, struct {
+		TokenPlaintext string `json:"token"`
+	}{}).Returns(http.StatusOK, "The user's membership of the workspace.", s.envelope(envelope{"workspace_id": openapi.Integer(), "member": data.Member{}}))
+}
+
+func (s *apiSpec) addUserRoutes() {
+	const tag = "Users"
+	user := s.envelope(envelope{"user": data.User{}})
+
+	op := s.public(http.MethodPost, "/v1/users", tag, "Register a user")
+	s.body(op, struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Timezone string `json:"timezone"`
+	}{}).Returns(http.StatusCreated, "The new user, with the token that activates them.", s.envelope(envelope{"user": struct {
+		Token *string    `json:"token"`
+		User  *data.User `json:"user"`
+	}{}}))
+	op = s.public(http.MethodPut, "/v1/users/activated", tag, "Activate a user")
+	s.body(op, struct {
+		TokenPlaintext string `json:"token"`
+	}{}).ReturnsRef(http.StatusConflict, "EditConflict").Returns(http.StatusOK, "The activated user.", user)
+	op = s.public(http.MethodPost, "/v1/tokens/activation", tag, "Resend the activation token").
+		Describe("A new activation token is mailed to a user who hasn't activated their account, and any older one stops working. Each address can be sent one every two minutes.").
+		ReturnsRef(http.StatusTooManyRequests, "RateLimited")
+	s.body(op, struct {
+		Email string `json:"email"`
+	}{}).Returns(http.StatusAccepted, "The token was sent.", s.message())
+
+	op = s.authenticated(http.MethodPut, "/v1/users/email", tag, "Change the user's email address").
+		Describe("A confirmation token is sent to the new address, which takes effect once it is confirmed.")
+	s.body(op, struct {
+		Email string `json:"email"`
+	}{}).Returns(http.StatusAccepted, "The confirmation was sent.", s.message())
+	op = s.public(http.MethodPut, "/v1/users/email/confirmed", tag, "Confirm a change of email address")
+	s.body(op, struct {
+		TokenPlaintext string `json:"token"`
+	}{}).ReturnsRef(http.StatusConflict, "EditConflict").Returns(http.StatusOK, "The updated user.", user)
+
+	profile := s.envelope(envelope{"user": data.User{}, "settings": data.Settings{}})
+	// A digest_hour of null stands for the server's hour, and sets it back to that.
+	s.Components.Schemas["Settings"].Properties["digest_hour"] = s.SchemaOf((*int)(nil))
+	s.DefineType(optionalInt{}, "", s.SchemaOf((*int)(nil)))
+	s.authenticated(http.MethodGet, "/v1/users/me", tag, "Show the user's profile").
+		Returns(http.StatusOK, "The user and their settings.", profile)
+	op = s.authenticated(http.MethodPatch, "/v1/users/me", tag, "Update the user's profile").
+		Describe("The time zone is an IANA name such as Europe/Moscow, or empty for the server's default. Due dates given as a date alone are read as midnight in it, and due dates in responses are written in it. The settings object changes settings like PATCH /v1/users/me/settings.").
+		ReturnsRef(http.StatusConflict, "EditConflict")
+	s.body(op, struct {
+		Name     *string        `json:"name"`
+		Timezone *string        `json:"timezone"`
+		Settings *settingsInput `json:"settings"`
+	}{}).Returns(http.StatusOK, "The updated user and their settings.", profile)
+
+	settings := s.envelope(envelope{"settings": data.Settings{}})
+	s.authenticated(http.MethodGet, "/v1/users/me/settings", tag, "Show the user's settings").
+		Returns(http.StatusOK, "The settings.", settings)
+	op = s.authenticated(http.MethodPatch, "/v1/users/me/settings", tag, "Update the user's settings").
+		Describe("The locale is the language of the API's messages, taking precedence over Accept-Language. The default page size and sort apply to GET /v1/tasks. The digest hour is in the user's time zone.")
+	s.body(op, settingsInput{}).Returns(http.StatusOK, "The updated settings.", settings)
+
+	op = s.authenticated(http.MethodPost, "/v1/users/me/avatar", tag, "Upload an avatar").
+		Describe("The image is the \"file\" field of a multipart form, or the raw request body. It is cropped to a square and stored in each of the sizes listed.").
+		BodyAs("multipart/form-data", openapi.Object(map[string]*openapi.Schema{
+			"file": {Type: "string", Format: "binary"},
+		})).
+		BodyAs("image/*", &openapi.Schema{Type: "string", Format: "binary"}).
+		ReturnsRef(http.StatusBadRequest, "BadRequest").
+		ReturnsRef(http.StatusUnprocessableEntity, "FailedValidation").
+		Returns(http.StatusOK, "The URL the avatar is served at.", s.envelope(envelope{"avatar_url": openapi.String(), "sizes": []int{}}))
+	s.authenticated(http.MethodDelete, "/v1/users/me/avatar", tag, "Delete the user's avatar").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The avatar was deleted.", s.message())
+	s.public(http.MethodGet, "/v1/avatars/:id", tag, "Get a user's avatar").
+		Param("query", "size", openapi.Integer(), "The width and height in pixels: 32, 64, 128 (the default) or 256.").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		ReturnsRef(http.StatusUnprocessableEntity, "FailedValidation").
+		ReturnsAs(http.StatusOK, "The avatar.", "image/png", &openapi.Schema{Type: "string", Format: "binary"})
+
+	recoveryCodes := s.envelope(envelope{"recovery_codes": []string{}})
+	s.authenticated(http.MethodPost, "/v1/users/me/totp", tag, "Start enrolling in two-factor authentication").
+		Returns(http.StatusCreated, "The TOTP secret, to be added to an authenticator app.", s.envelope(envelope{"secret": openapi.String(), "provisioning_uri": openapi.String()}))
+	op = s.authenticated(http.MethodPut, "/v1/users/me/totp/confirmed", tag, "Finish enrolling in two-factor authentication").
+		ReturnsRef(http.StatusConflict, "EditConflict")
+	s.body(op, struct {
+		Code string `json:"code"`
+	}{}).Returns(http.StatusOK, "The recovery codes, which are only shown once.", recoveryCodes)
+	op = s.authenticated(http.MethodDelete, "/v1/users/me/totp", tag, "Turn off two-factor authentication")
+	s.body(op, struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}{}).Returns(http.StatusOK, "Two-factor authentication was turned off.", s.message())
+	s.authenticated(http.MethodPost, "/v1/users/me/totp/recovery-codes", tag, "Replace the user's recovery codes").
+		ReturnsRef(http.StatusConflict, "EditConflict").
+		Returns(http.StatusCreated, "The new recovery codes.", recoveryCodes)
+
+	s.authenticated(http.MethodGet, "/v1/users/me/sessions", tag, "List the user's signed in sessions").
+		Returns(http.StatusOK, "The sessions.", s.envelope(envelope{"sessions": []data.Session{}}))
+	s.authenticated(http.MethodDelete, "/v1/users/me/sessions", tag, "Sign out every other session").
+		Returns(http.StatusOK, "The number of sessions signed out.", s.envelope(envelope{"revoked": openapi.Integer()}))
+	s.authenticated(http.MethodDelete, "/v1/users/me/sessions/:id", tag, "Sign out a session").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The session was signed out.", s.message())
+}
+
+func (s *apiSpec) addNotificationRoutes() {
+	const tag = "Notifications"
+	op := s.authenticated(http.MethodGet, "/v1/notifications", tag, "List the user's notifications").
+		Describe("Messages are in the user's language. The unread count is of all the user's notifications, not only the ones on the page. Reminders are also sent to the user's chat integrations, and when one of those starts failing the user is told here.").
+		Param("query", "unread", openapi.Boolean(), "Only unread notifications.")
+	s.paginate(op, 100, "-created_at", "id", "created_at").
+		Returns(http.StatusOK, "A page of notifications.", s.envelope(envelope{"notifications": []data.Notification{}, "metadata": data.Metadata{}, "unread_count": openapi.Integer()}))
+	s.authenticated(http.MethodPost, "/v1/notifications/:id/read", tag, "Mark a notification read").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The notification.", s.envelope(envelope{"notification": data.Notification{}, "unread_count": openapi.Integer()}))
+	s.authenticated(http.MethodPost, "/v1/notifications/read", tag, "Mark all notifications read").
+		Returns(http.StatusOK, "The number of notifications that were unread.", s.envelope(envelope{"marked": openapi.Integer(), "unread_count": openapi.Integer()}))
+}
+
+func (s *apiSpec) addAuthenticationRoutes() {
+	const tag = "Authentication"
+	tokens := s.envelope(envelope{
+		"authentication_token": data.Token{},
+		"refresh_token":        s.SchemaOf(data.Token{}).Describe("Only issued when the server runs with -jwt-secret."),
+	})
+
+	op := s.public(http.MethodPost, "/v1/users/token", tag, "Sign in").
+		Describe("Users who require two-factor authentication also send a TOTP code or a recovery code.").
+		ReturnsRef(http.StatusUnauthorized, "Unauthorized")
+	s.body(op, struct {
+		Email        string `json:"email"`
+		Password     string `json:"password"`
+		TOTPCode     string `json:"totp_code"`
+		RecoveryCode string `json:"recovery_code"`
+	}{}).Returns(http.StatusCreated, "The user's tokens.", tokens)
+	op = s.public(http.MethodPost, "/v1/tokens/refresh", tag, "Refresh a JWT access token").
+		ReturnsRef(http.StatusUnauthorized, "Unauthorized")
+	s.body(op, struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}).Returns(http.StatusCreated, "A new access token and refresh token.", tokens)
+
+	s.public(http.MethodGet, "/v1/auth/:provider/login", tag, "Sign in with an external provider").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusFound, "A redirect to the provider.", nil)
+	s.authenticated(http.MethodPost, "/v1/auth/:provider/link", tag, "Link an external provider account to the user").
+		Describe("The user's browser is then sent to the URL returned, and the provider sends it back to the callback endpoint. The response also sets the state cookie, which the callback checks.").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The provider's URL to send the user to.", s.envelope(envelope{"url": openapi.String()}))
+	s.public(http.MethodGet, "/v1/auth/:provider/callback", tag, "Finish signing in with an external provider").
+		Param("query", "code", openapi.String(), "The authorization code from the provider.").
+		Param("query", "state", openapi.String(), "The state handed to the provider by the login or link endpoint.").
+		Param("query", "error", openapi.String(), "Set by the provider if the user didn't sign in.").
+		ReturnsRef(http.StatusUnauthorized, "Unauthorized").
+		ReturnsRef(http.StatusForbidden, "Forbidden").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusCreated, "The user and their tokens.", s.envelope(envelope{
+			"authentication_token": data.Token{},
+			"refresh_token":        data.Token{},
+			"user":                 data.User{},
+		}))
+}
+
+func (s *apiSpec) addIntegrationRoutes() {
+	const tag = "Integrations"
+
+	s.workspace(http.MethodGet, "/v1/ws", tag, "Sync tasks over a WebSocket").
+		Describe("Browsers can't set headers on WebSocket requests, so the token can also be given as a query parameter.").
+		Param("query", "token", openapi.String(), "An authentication token.").
+		Returns(http.StatusSwitchingProtocols, "The connection was upgraded.", nil)
+
+	webhook := s.envelope(envelope{"webhook": data.Webhook{}})
+	s.authenticated(http.MethodGet, "/v1/webhooks", tag, "List the user's webhooks").
+		Returns(http.StatusOK, "The webhooks.", s.envelope(envelope{"webhooks": []data.Webhook{}}))
+	op := s.idempotent(s.authenticated(http.MethodPost, "/v1/webhooks", tag, "Create a webhook")).
+		Describe("Events are one of " + strings.Join(data.WebhookEvents, ", ") + ".")
+	s.body(op, struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+	}{}).Returns(http.StatusCreated, "The new webhook, with the secret its deliveries are signed with.", s.envelope(envelope{"webhook": data.Webhook{}, "secret": openapi.String()}))
+	s.authenticated(http.MethodGet, "/v1/webhooks/:id", tag, "Show a webhook").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The webhook.", webhook)
+	op = s.authenticated(http.MethodPatch, "/v1/webhooks/:id", tag, "Update a webhook").
+		ReturnsRef(http.StatusNotFound, "NotFound")
+	s.body(op, struct {
+		URL    *string  `json:"url"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}{}).Returns(http.StatusOK, "The updated webhook.", webhook)
+	s.authenticated(http.MethodDelete, "/v1/webhooks/:id", tag, "Delete a webhook").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The webhook was deleted.", s.message())
+	op = s.authenticated(http.MethodGet, "/v1/webhooks/:id/deliveries", tag, "List a webhook's deliveries").
+		ReturnsRef(http.StatusNotFound, "NotFound")
+	s.paginate(op, 100, "-created_at", "id", "created_at").
+		Returns(http.StatusOK, "A page of deliveries.", s.envelope(envelope{"deliveries": []data.WebhookDelivery{}, "metadata": data.Metadata{}}))
+
+	integration := s.envelope(envelope{"integration": data.Integration{}})
+	s.authenticated(http.MethodGet, "/v1/integrations", tag, "List the user's chat integrations").
+		Returns(http.StatusOK, "The integrations.", s.envelope(envelope{"integrations": []data.Integration{}}))
+	op = s.authenticated(http.MethodPut, "/v1/integrations/:kind", tag, "Set up a chat integration").
+		Describe("The kind is slack or telegram. Reminders are sent to the user's enabled integrations as well as by email. Slack needs the URL of an incoming webhook; Telegram the token of a bot and the ID of a chat it is in. The webhook URL and bot token are never sent back. Fields left out keep their current values.").
+		ReturnsRef(http.StatusNotFound, "NotFound")
+	s.body(op, struct {
+		WebhookURL *string `json:"webhook_url"`
+		BotToken   *string `json:"bot_token"`
+		ChatID     *string `json:"chat_id"`
+		Enabled    *bool   `json:"enabled"`
+	}{}).Returns(http.StatusOK, "The updated integration.", integration).
+		Returns(http.StatusCreated, "The new integration.", integration)
+	s.authenticated(http.MethodDelete, "/v1/integrations/:kind", tag, "Delete a chat integration").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The integration was deleted.", s.message())
+	s.authenticated(http.MethodPost, "/v1/integrations/:kind/test", tag, "Send a test message").
+		Describe("The message is sent even if the integration is turned off. When the chat service doesn't accept it, its error is kept on the integration as last_error.").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		ReturnsRef(http.StatusBadGateway, "BadGateway").
+		Returns(http.StatusOK, "The message was sent.", s.envelope(envelope{"message": openapi.String(), "integration": data.Integration{}}))
+
+	s.authenticated(http.MethodGet, "/v1/integrations/inbound", tag, "List the user's inbound integrations").
+		Returns(http.StatusOK, "The inbound integrations.", s.envelope(envelope{"inbound_integrations": []data.InboundIntegration{}}))
+	op = s.idempotent(s.workspace(http.MethodPost, "/v1/integrations/inbound", tag, "Create an inbound integration")).
+		Describe("Lets another service create tasks in a category of the workspace on the user's behalf. The provider is one of " + strings.Join(data.InboundProviders, ", ") + ".")
+	s.body(op, struct {
+		Provider   string `json:"provider"`
+		CategoryID int64  `json:"category_id"`
+	}{}).Returns(http.StatusCreated, "The new inbound integration, with the secret its requests are signed with and the path they are sent to.", s.envelope(envelope{"inbound_integration": data.InboundIntegration{}, "secret": openapi.String(), "url": openapi.String()}))
+	s.authenticated(http.MethodDelete, "/v1/integrations/inbound/:id", tag, "Delete an inbound integration").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The inbound integration was deleted.", s.message())
+	op = s.public(http.MethodPost, "/v1/integrations/inbound/:provider", tag, "Create a task from another service").
+		Describe("Instead of authenticating, the request names its integration in "+inboundIntegrationHeader+", gives the current Unix time in "+inboundTimestampHeader+" and is signed in "+inboundSignatureHeader+": sha256= followed by the hex-encoded HMAC-SHA256 of the timestamp, a dot and the body, keyed with the integration's secret. Timestamps more than "+strconv.Itoa(int(inboundTolerance.Minutes()))+" minutes off are refused, and a request that was already received is refused with 409 Conflict. Emails give a subject, which is the title, a text and who they are from; Zapier gives a title, description, due_date and priority.").
+		Param("header", inboundIntegrationHeader, openapi.Integer(), "The ID of the inbound integration.").
+		Param("header", inboundTimestampHeader, openapi.Integer(), "When the request was signed, in seconds since the Unix epoch.").
+		Param("header", inboundSignatureHeader, openapi.String(), "sha256= and the signature.").
+		ReturnsRef(http.StatusUnauthorized, "Unauthorized").
+		ReturnsRef(http.StatusForbidden, "Forbidden").
+		ReturnsRef(http.StatusNotFound, "NotFound")
+	s.body(op, struct {
+		From        string            `json:"from"`
+		Subject     string            `json:"subject"`
+		Text        string            `json:"text"`
+		Title       string            `json:"title"`
+		Description string            `json:"description"`
+		DueDate     data.CustomTime   `json:"due_date"`
+		Priority    data.TaskPriority `json:"priority"`
+	}{}).Returns(http.StatusCreated, "The new task.", s.envelope(envelope{"task": data.Task{}}))
+
+	s.authenticated(http.MethodGet, "/v1/api-keys", tag, "List the user's API keys").
+		Returns(http.StatusOK, "The API keys.", s.envelope(envelope{"api_keys": []data.APIKey{}}))
+	op = s.idempotent(s.authenticated(http.MethodPost, "/v1/api-keys", tag, "Create an API key")).
+		Describe("The key can only be given permissions the user has.")
+	s.body(op, struct {
+		Name        string   `json:"name"`
+		Permissions []string `json:"permissions"`
+	}{}).Returns(http.StatusCreated, "The new API key, whose plaintext is only shown once.", s.envelope(envelope{"api_key": data.APIKey{}}))
+	s.authenticated(http.MethodDelete, "/v1/api-keys/:id", tag, "Revoke an API key").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The API key was revoked.", s.message())
+
+	s.authenticated(http.MethodPost, "/v1/users/me/calendar-token", tag, "Create a token for the calendar feed").
+		Returns(http.StatusCreated, "The token and the URL of the feed.", s.envelope(envelope{"calendar_token": data.Token{}, "url": openapi.String()}))
+	s.authenticated(http.MethodDelete, "/v1/users/me/calendar-token", tag, "Revoke the calendar feed's tokens").
+		Returns(http.StatusOK, "The tokens were revoked.", s.message())
+}
+
+func (s *apiSpec) addAdminRoutes() {
+	const tag = "Admin"
+	user := s.envelope(envelope{"user": data.User{}})
+	roles := s.envelope(envelope{"roles": data.Roles{}})
+
+	op := s.authenticated(http.MethodGet, "/v1/audit", tag, "List the audit log").
+		Param("query", "entity_type", openapi.Enum(data.AuditEntityTypes...), "").
+		Param("query", "entity_id", openapi.Integer(), "").
+		Param("query", "actor_id", openapi.Integer(), "The user who made the changes.")
+	s.paginate(op, 100, "-created_at", "created_at").
+		Returns(http.StatusOK, "A page of audit entries.", s.envelope(envelope{"audit": []data.AuditEntry{}, "metadata": data.Metadata{}}))
+
+	op = s.authenticated(http.MethodGet, "/v1/admin/users", tag, "List users").
+		Param("query", "search", openapi.String(), "Only users whose name or email contains this.").
+		Param("query", "activated", openapi.Boolean(), "").
+		Param("query", "deactivated", openapi.Boolean(), "").
+		Param("query", "role", openapi.Enum(data.AccountRoles...), "")
+	s.paginate(op, 100, "id", "id", "name", "email", "created_at").
+		Returns(http.StatusOK, "A page of users.", s.envelope(envelope{"users": []data.User{}, "metadata": data.Metadata{}}))
+	s.authenticated(http.MethodGet, "/v1/admin/users/:id", tag, "Show a user").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The user, with their roles and task counts.", s.envelope(envelope{"user": data.User{}, "roles": data.Roles{}, "task_counts": data.TaskCounts{}}))
+	s.authenticated(http.MethodPost, "/v1/admin/users/:id/deactivate", tag, "Deactivate a user").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		ReturnsRef(http.StatusConflict, "EditConflict").
+		Returns(http.StatusOK, "The deactivated user.", user)
+	s.authenticated(http.MethodPost, "/v1/admin/users/:id/reactivate", tag, "Reactivate a user").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		ReturnsRef(http.StatusConflict, "EditConflict").
+		Returns(http.StatusOK, "The reactivated user.", user)
+	s.authenticated(http.MethodDelete, "/v1/admin/users/:id/tokens", tag, "Sign a user out everywhere").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The user's tokens were expired.", s.message())
+
+	s.authenticated(http.MethodGet, "/v1/admin/roles", tag, "List the account roles").
+		Returns(http.StatusOK, "The roles and their permissions.", s.envelope(envelope{"roles": []data.Role{}}))
+	s.authenticated(http.MethodGet, "/v1/admin/users/:id/roles", tag, "List a user's roles").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The roles.", roles)
+	s.authenticated(http.MethodPut, "/v1/admin/users/:id/roles/:role", tag, "Grant a user a role").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		ReturnsRef(http.StatusUnprocessableEntity, "FailedValidation").
+		Returns(http.StatusOK, "The user's roles.", roles)
+	s.authenticated(http.MethodDelete, "/v1/admin/users/:id/roles/:role", tag, "Revoke a role from a user").
+		ReturnsRef(http.StatusNotFound, "NotFound").
+		Returns(http.StatusOK, "The user's roles.", roles)
+
+	maintenance := s.envelope(envelope{"maintenance": maintenanceState{}})
+	s.authenticated(http.MethodGet, "/v1/admin/maintenance", tag, "Show the maintenance mode").
+		Returns(http.StatusOK, "Whether the API is in maintenance mode.", maintenance)
+	op = s.authenticated(http.MethodPut, "/v1/admin/maintenance", tag, "Turn maintenance mode on or off").
+		Describe("In maintenance mode every endpoint but the health checks, /metrics, logging in, refreshing tokens and this one answers 503 Service Unavailable with Retry-After, and the background jobs pause. A message that is left out goes back to the default one.")
+	s.body(op, struct {
+		Enabled    bool   `json:"enabled"`
+		Message    string `json:"message"`
+		RetryAfter *int   `json:"retry_after_seconds"`
+	}{}).
+		Returns(http.StatusOK, "The new maintenance state.", maintenance)
+}
+
+func (s *apiSpec) addGraphQLRoutes() {
+	location := openapi.Object(map[string]*openapi.Schema{"line": openapi.Integer(), "column": openapi.Integer()})
+	gqlError := openapi.Object(map[string]*openapi.Schema{
+		"message":    openapi.String(),
+		"locations":  openapi.ArrayOf(location),
+		"path":       openapi.ArrayOf(&openapi.Schema{}).Describe("The field the error belongs to: response keys and list indexes."),
+		"extensions": openapi.Object(map[string]*openapi.Schema{"status": openapi.Integer(), "errors": openapi.MapOf(openapi.String())}).Describe("The status the REST API would have responded with, and the invalid fields for failed validation."),
+	})
+
+	op := s.workspace(http.MethodPost, "/v1/graphql", "GraphQL", "Run a GraphQL query or mutation").
+		Describe("Queries can fetch tasks with their category, tags and creator, and categories with their tasks, nested as deeply as " +
+			strconv.Itoa(graphqlMaxDepth) + " levels, batching the lookups of each level into one query. Mutations need write access to the workspace. " +
+			"Introspection isn't supported.")
+	s.body(op, struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}{}).Returns(http.StatusOK, "The result. Errors in the query or in resolving its fields are reported alongside the data.", openapi.Object(map[string]*openapi.Schema{
+		"data":   &openapi.Schema{Type: "object"},
+		"errors": openapi.ArrayOf(gqlError),
+	}))
+}
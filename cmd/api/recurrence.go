@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/rrule"
+)
+
+// The startRecurrenceScheduler() method starts a background job which creates the next
+// occurrence of every recurring task that has been completed.
+func (app *application) startRecurrenceScheduler() {
+	app.backgroundTicker("recurrence", app.config.recurrence.interval, func() {
+		err := app.materializeRecurrences()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+func (app *application) materializeRecurrences() error {
+	tasks, err := app.models.Tasks.GetPendingRecurrences(context.Background(), 100)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		next, err := nextOccurrence(task)
+		if err != nil {
+			// The rule was validated on write, so this only happens for rows edited
+			// behind the API's back. Log it and keep going with the other tasks.
+			app.logger.PrintError(err, map[string]string{"task_id": strconv.FormatInt(task.ID, 10)})
+			continue
+		}
+		err = app.models.Tasks.InsertOccurrence(context.Background(), task, next)
+		switch {
+		case err == nil && next != nil:
+			app.publishTaskEvent(next.WorkspaceID, data.EventTaskCreated, next)
+			// The occurrence is created by the scheduler rather than by a user.
+			app.recordAudit(0, data.AuditTask, next.ID, data.AuditCreate, nil, next)
+		case err != nil && !errors.Is(err, data.ErrEditConflict):
+			return err
+		}
+	}
+	return nil
+}
+
+// nextOccurrence builds the task that follows a completed recurring task, or returns
+// nil if its recurrence rule has run out.
+func nextOccurrence(task *data.Task) (*data.Task, error) {
+	rule, err := rrule.Parse(task.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	due, ok := rule.Next(time.Time(task.DueDate))
+	if !ok {
+		return nil, nil
+	}
+	next := &data.Task{
+		Title:       task.Title,
+		Description: task.Description,
+		DueDate:     data.CustomTime(due),
+		Priority:    task.Priority,
+		Status:      data.StatusTodo,
+		CategoryID:  task.CategoryID,
+		Category:    task.Category,
+		UserID:      task.UserID,
+		WorkspaceID: task.WorkspaceID,
+		Recurrence:  rule.Remaining().String(),
+
+		EstimateMinutes:  task.EstimateMinutes,
+		RemainingMinutes: task.EstimateMinutes,
+		CustomFields:     task.CustomFields,
+	}
+	// The next occurrence starts as long before its due date as this one did.
+	if !task.StartDate.IsZero() {
+		next.StartDate = data.CustomTime(due.Add(-time.Time(task.DueDate).Sub(time.Time(task.StartDate))))
+	}
+	return next, nil
+}
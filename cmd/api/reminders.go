@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+)
+
+// The startReminderWorker() method starts a background job which emails users about
+// their tasks that are about to fall due.
+func (app *application) startReminderWorker() {
+	app.backgroundTicker("reminders", app.config.reminders.interval, func() {
+		err := app.sendReminders()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+func (app *application) sendReminders() error {
+	reminders, err := app.models.Reminders.GetDue(context.Background(), app.now(), 50)
+	if err != nil {
+		return err
+	}
+	for _, reminder := range reminders {
+		// Stop early if the server is shutting down, rather than holding it up while
+		// the rest of the batch is sent. The remaining reminders go out on the next run.
+		select {
+		case <-app.done:
+			return nil
+		default:
+		}
+
+		sendErr := app.sendReminder(reminder)
+		if sendErr != nil {
+			app.logger.PrintError(sendErr, map[string]string{"task_id": strconv.FormatInt(reminder.TaskID, 10)})
+		}
+		// Record the outcome either way, so that a sent reminder isn't sent again and a
+		// failing one is only retried a limited number of times.
+		err = app.models.Reminders.Record(context.Background(), reminder, sendErr)
+		if err != nil {
+			return err
+		}
+		// A reminder that is going to be retried is only shown once it has gone out.
+		if sendErr == nil {
+			app.notify(&data.Notification{
+				UserID:  reminder.UserID,
+				Kind:    data.NotificationReminder,
+				Message: fmt.Sprintf("%q is due soon", reminder.Title),
+				TaskID:  &reminder.TaskID,
+			})
+		}
+	}
+	return nil
+}
+
+func (app *application) sendReminder(reminder *data.DueReminder) error {
+	tmplData := map[string]interface{}{
+		"name":    reminder.UserName,
+		"title":   reminder.Title,
+		"taskID":  reminder.TaskID,
+		"dueDate": reminder.DueDate.In(app.zoneOrDefault(reminder.UserTimezone)).Format("Mon, 02 Jan 2006 15:04 MST"),
+	}
+	return app.sendMail(context.Background(), reminder.UserEmail, "task_reminder.tmpl", tmplData)
+}
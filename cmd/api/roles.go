@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// The listRolesHandler returns every account role along with the permissions it grants.
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.models.Roles.GetAll(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The addUserRoleHandler gives a user a role. Like other PUT requests it can safely be
+// repeated.
+func (app *application) addUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, role, ok := app.readUserRoleParams(w, r)
+	if !ok {
+		return
+	}
+
+	before, err := app.models.Roles.GetAllForUser(r.Context(), userID)
+	if err == nil {
+		err = app.models.Roles.AddForUser(r.Context(), userID, role)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.respondWithUserRoles(w, r, userID, before)
+}
+
+func (app *application) removeUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, role, ok := app.readUserRoleParams(w, r)
+	if !ok {
+		return
+	}
+
+	before, err := app.models.Roles.GetAllForUser(r.Context(), userID)
+	if err == nil {
+		err = app.models.Roles.RemoveForUser(r.Context(), userID, role)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLastAdmin):
+			app.errorResponse(w, r, http.StatusConflict, "there must be at least one admin")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.respondWithUserRoles(w, r, userID, before)
+}
+
+// The readUserRoleParams() helper reads the user ID and role name from the URL of the
+// role assignment endpoints. Unknown roles get a 404, like unknown users.
+func (app *application) readUserRoleParams(w http.ResponseWriter, r *http.Request) (int64, string, bool) {
+	userID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return 0, "", false
+	}
+	role := httprouter.ParamsFromContext(r.Context()).ByName("role")
+	if !validator.In(role, data.AccountRoles...) {
+		app.notFoundResponse(w, r)
+		return 0, "", false
+	}
+	return userID, role, true
+}
+
+// The respondWithUserRoles() helper records a change to a user's roles in the audit log
+// and sends back the roles they have now.
+func (app *application) respondWithUserRoles(w http.ResponseWriter, r *http.Request, userID int64, before data.Roles) {
+	roles, err := app.models.Roles.GetAllForUser(r.Context(), userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.recordAudit(app.contextGetUser(r).ID, data.AuditUser, userID, data.AuditUpdate, envelope{"roles": before}, envelope{"roles": roles})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
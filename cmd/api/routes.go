@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 	"github.com/julienschmidt/httprouter"
+	"github.com/zarinakolybaeva/DoMake/internal/data"
 )
 
 // Update the routes() method to return a http.Handler instead of a *httprouter.Router.
@@ -19,11 +20,45 @@ func (app *application) routes() http.Handler {
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	// Liveness and readiness checks for orchestrators, see readinessHandler().
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/live", app.livenessHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/healthcheck/ready", app.readinessHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/time", app.timeHandler)
+	// Prometheus scrapes GET /metrics, see metricsHandler().
+	router.HandlerFunc(http.MethodGet, "/metrics", app.metricsHandler)
+	// The OpenAPI document describes every route below but CalDAV's, see openapi.go, which
+	// has to be kept in step with this file.
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", app.openAPIHandler)
+	if app.config.docs.ui {
+		router.HandlerFunc(http.MethodGet, "/v1/docs", app.docsHandler)
+	}
+
+	// Tasks and categories belong to a workspace, so on top of the usual checks their
+	// endpoints need the user to be a member of the workspace, see requireWorkspaceRole().
+	// Viewers can read, members can also write. Writes need the tasks:write permission,
+	// which every account role has, so that API keys can be limited to reading.
+	reader := func(next http.HandlerFunc) http.HandlerFunc {
+		return app.requirePermission("tasks:read", app.requireWorkspaceRole(data.RoleViewer, next))
+	}
+	writer := func(next http.HandlerFunc) http.HandlerFunc {
+		return app.requirePermission("tasks:write", app.requireWorkspaceRole(data.RoleMember, next))
+	}
+	// Changing how the workspace's tasks are set up, such as their custom fields, is left
+	// to its owners.
+	owner := func(next http.HandlerFunc) http.HandlerFunc {
+		return app.requirePermission("tasks:write", app.requireWorkspaceRole(data.RoleOwner, next))
+	}
 
 	// Use the requirePermission() middleware on each of the /v1/tasks** endpoints,
 	// passing in the required permission code as the first parameter.
-	router.HandlerFunc(http.MethodGet, "/v1/tasks", app.requirePermission("tasks:read", app.listTasksHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id", app.requirePermission("tasks:read", app.showTaskHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tasks", reader(app.sparseFields(app.listTasksHandler)))
+	// GET /v1/tasks/events (the live event stream) and /v1/tasks/calendar.ics share the
+	// :id route, see dispatchIDParam(). The calendar feed authenticates with its own token.
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id", app.dispatchIDParam(map[string]http.HandlerFunc{
+		"events":       app.requirePermission("tasks:read", app.taskEventsHandler),
+		"calendar.ics": app.calendarFeedHandler,
+		"export":       reader(app.exportTasksHandler),
+	}, reader(app.sparseFields(app.showTaskHandler))))
 
 
 	// Require a PATCH request, rather than PUT.
@@ -32,32 +67,235 @@ func (app *application) routes() http.Handler {
 		// router.HandlerFunc(http.MethodPost, "/v1/tasks", app.requirePermission("tasks:write", app.createTaskHandler))
 //     router.HandlerFunc(http.MethodGet, "/v1/tasks", app.listTasksHandler)
 
-    router.HandlerFunc(http.MethodPost, "/v1/tasks", app.createTaskHandler)
+	// The write endpoints need an activated (and therefore authenticated) user who is
+	// at least a member of the workspace. POST
+	// endpoints also honour an Idempotency-Key header, see idempotent().
+	router.HandlerFunc(http.MethodPost, "/v1/tasks", writer(app.idempotent(app.createTaskHandler)))
+	// POST /v1/tasks/:id is not a route of its own; it only carries the fixed
+	// collection-level actions such as /v1/tasks/bulk.
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id", app.dispatchIDParam(map[string]http.HandlerFunc{
+		"bulk":   writer(app.idempotent(app.bulkTasksHandler)),
+		"import": writer(app.idempotent(app.importTasksHandler)),
+	}, app.methodNotAllowedResponse))
+	router.HandlerFunc(http.MethodPatch, "/v1/tasks/:id", writer(app.updateTaskHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id", writer(app.deleteTaskHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/archive", writer(app.idempotent(app.archiveTaskHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/unarchive", writer(app.idempotent(app.unarchiveTaskHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/complete", writer(app.idempotent(app.completeTaskHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/duplicate", writer(app.idempotent(app.duplicateTaskHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/reopen", writer(app.idempotent(app.reopenTaskHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/snooze", writer(app.idempotent(app.snoozeTaskHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/snooze", writer(app.unsnoozeTaskHandler))
+	// Pins are each user's own, so reading the task is enough to pin it.
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/pin", reader(app.pinTaskHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/unpin", reader(app.unpinTaskHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/tasks/:id/move", writer(app.moveTaskHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/dependencies", reader(app.listTaskDependenciesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/tasks/:id/blockers/:blocker_id", writer(app.addTaskBlockerHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/blockers/:blocker_id", writer(app.removeTaskBlockerHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/subtasks", reader(app.listSubtasksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/subtasks", writer(app.idempotent(app.createSubtaskHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/tasks/:id/subtasks/:subtask_id", writer(app.updateSubtaskHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/subtasks/:subtask_id", writer(app.deleteSubtaskHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/comments", reader(app.listCommentsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/comments", writer(app.idempotent(app.createCommentHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/tasks/:id/comments/:comment_id", writer(app.updateCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/comments/:comment_id", writer(app.deleteCommentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/comments/:comment_id/history", reader(app.showCommentHistoryHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/attachments", reader(app.listAttachmentsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/attachments", writer(app.createAttachmentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/attachments/:attachment_id", reader(app.showAttachmentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/attachments/:attachment_id/content", reader(app.downloadAttachmentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/attachments/:attachment_id", writer(app.deleteAttachmentHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/tags", reader(app.listTaskTagsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/tasks/:id/tags/:tag_id", writer(app.addTaskTagHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/tags/:tag_id", writer(app.removeTaskTagHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/timer/start", writer(app.idempotent(app.startTimerHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/timer/stop", writer(app.idempotent(app.stopTimerHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/time-entries", reader(app.listTimeEntriesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/time-entries", writer(app.idempotent(app.createTimeEntryHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/time-entries/:entry_id", writer(app.deleteTimeEntryHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/versions", reader(app.listTaskVersionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/revert/:version", writer(app.idempotent(app.revertTaskHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id/activity", reader(app.taskActivityHandler))
+	// Shared links are public, so GET /v1/shared/:token has no authentication of its own.
+	router.HandlerFunc(http.MethodPost, "/v1/tasks/:id/share", writer(app.idempotent(app.shareTaskHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id/share", writer(app.unshareTaskHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/shared/:token", app.showSharedTaskHandler)
+	// The audit feed covers every user, so it needs a permission only managers and admins have.
+	router.HandlerFunc(http.MethodGet, "/v1/audit", app.requirePermission("audit:read", app.listAuditHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requireAdmin(app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requireAdmin(app.showUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/deactivate", app.requireAdmin(app.deactivateUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/reactivate", app.requireAdmin(app.reactivateUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/tokens", app.requireAdmin(app.expireUserTokensHandler))
+	// Managing role assignments is reserved for admins.
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", app.requireRole(data.RoleAdmin, app.listRolesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/roles", app.requireRole(data.RoleAdmin, app.listUserRolesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/roles/:role", app.requireRole(data.RoleAdmin, app.addUserRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role", app.requireRole(data.RoleAdmin, app.removeUserRoleHandler))
+	// The maintenance endpoints are still served in maintenance mode, see maintenanceExempt().
+	router.HandlerFunc(http.MethodGet, "/v1/admin/maintenance", app.requireAdmin(app.showMaintenanceHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/maintenance", app.requireAdmin(app.updateMaintenanceHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/stats", reader(app.statsHandler))
 
-    router.HandlerFunc(http.MethodPatch, "/v1/tasks/:id", app.updateTaskHandler)
-// No permission check for deletion.
-    router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id", app.deleteTaskHandler)
+	// GET /v1/export and POST /v1/import back up and restore all of a workspace's data.
+	router.HandlerFunc(http.MethodGet, "/v1/export", reader(app.exportBackupHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/import", writer(app.idempotent(app.importBackupHandler)))
 
+	router.HandlerFunc(http.MethodGet, "/v1/ws", app.authenticateQueryToken(reader(app.syncSocketHandler)))
 
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks", app.requireActivatedUser(app.listWebhooksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks", app.requireActivatedUser(app.idempotent(app.createWebhookHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id", app.requireActivatedUser(app.showWebhookHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/webhooks/:id", app.requireActivatedUser(app.updateWebhookHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/webhooks/:id", app.requireActivatedUser(app.deleteWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:id/deliveries", app.requireActivatedUser(app.listWebhookDeliveriesHandler))
 
-	router.HandlerFunc(http.MethodPost, "/v1/category", app.createCategoryHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/notifications", app.requireActivatedUser(app.listNotificationsHandler))
+	// POST /v1/notifications/read marks them all read; it shares the :id route, see
+	// dispatchIDParam().
+	router.HandlerFunc(http.MethodPost, "/v1/notifications/:id", app.dispatchIDParam(map[string]http.HandlerFunc{
+		"read": app.requireActivatedUser(app.markAllNotificationsReadHandler),
+	}, app.methodNotAllowedResponse))
+	router.HandlerFunc(http.MethodPost, "/v1/notifications/:id/read", app.requireActivatedUser(app.markNotificationReadHandler))
 
-    router.HandlerFunc(http.MethodPatch, "/v1/category/:id", app.updateCategoryHandler)
-// No permission check for deletion.
-    router.HandlerFunc(http.MethodDelete, "/v1/category/:id", app.deleteCategoryHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/category/:id", app.showCategoryHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/integrations", app.requireActivatedUser(app.listIntegrationsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/integrations/:kind", app.requireActivatedUser(app.updateIntegrationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/integrations/:kind", app.requireActivatedUser(app.deleteIntegrationHandler))
+	// Inbound integrations share the :kind routes, see dispatchParam(). Other services push
+	// tasks to POST /v1/integrations/inbound/:provider, signing their requests instead of
+	// authenticating, see receiveInboundHandler().
+	router.HandlerFunc(http.MethodGet, "/v1/integrations/inbound", app.requireActivatedUser(app.listInboundIntegrationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/integrations/:kind", app.dispatchParam("kind", map[string]http.HandlerFunc{
+		"inbound": writer(app.idempotent(app.createInboundIntegrationHandler)),
+	}, app.methodNotAllowedResponse))
+	router.HandlerFunc(http.MethodDelete, "/v1/integrations/:kind/:name", app.dispatchParam("kind", map[string]http.HandlerFunc{
+		"inbound": app.requireActivatedUser(app.deleteInboundIntegrationHandler),
+	}, app.notFoundResponse))
+	router.HandlerFunc(http.MethodPost, "/v1/integrations/:kind/:name", app.dispatchParam("kind", map[string]http.HandlerFunc{
+		"inbound": app.receiveInboundHandler,
+	}, app.dispatchParam("name", map[string]http.HandlerFunc{
+		"test": app.requireActivatedUser(app.testIntegrationHandler),
+	}, app.notFoundResponse)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/api-keys", app.requireActivatedUser(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/api-keys", app.requireActivatedUser(app.idempotent(app.createAPIKeyHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/api-keys/:id", app.requireActivatedUser(app.revokeAPIKeyHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tags", app.requireActivatedUser(app.listTagsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tags", app.requireActivatedUser(app.idempotent(app.createTagHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/tags/:id", app.requireActivatedUser(app.updateTagHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tags/:id", app.requireActivatedUser(app.deleteTagHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/search", reader(app.searchHandler))
+
+
+
+	// Categories belong to a workspace, like tasks. Tags stay private to each user.
+	router.HandlerFunc(http.MethodPost, "/v1/category", writer(app.idempotent(app.createCategoryHandler)))
+
+    router.HandlerFunc(http.MethodPatch, "/v1/category/:id", writer(app.updateCategoryHandler))
+    router.HandlerFunc(http.MethodDelete, "/v1/category/:id", writer(app.deleteCategoryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/category/:id", reader(app.sparseFields(app.showCategoryHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/categories", reader(app.sparseFields(app.listCategoriesHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/categories/tree", reader(app.categoryTreeHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/category/:id/parent", writer(app.moveCategoryHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/custom-fields", reader(app.listCustomFieldsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/custom-fields", owner(app.idempotent(app.createCustomFieldHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/custom-fields/:id", owner(app.updateCustomFieldHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/custom-fields/:id", owner(app.deleteCustomFieldHandler))
+
+	// GraphQL exposes the tasks, categories and tags above through a single endpoint, see
+	// graphql.go. Mutations check for write access themselves.
+	router.HandlerFunc(http.MethodPost, "/v1/graphql", reader(app.graphqlHandler(app.graphqlSchema())))
 
 	
 
 
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces", app.requireActivatedUser(app.listWorkspacesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces", app.requireActivatedUser(app.idempotent(app.createWorkspaceHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces/:id", app.requireActivatedUser(app.showWorkspaceHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/workspaces/:id", app.requireActivatedUser(app.updateWorkspaceHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/workspaces/:id", app.requireActivatedUser(app.deleteWorkspaceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/workspaces/:id/members", app.requireActivatedUser(app.listWorkspaceMembersHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/workspaces/:id/members/:user_id", app.requireActivatedUser(app.updateWorkspaceMemberHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/workspaces/:id/members/:user_id", app.requireActivatedUser(app.removeWorkspaceMemberHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/workspaces/:id/invitations", app.requireActivatedUser(app.idempotent(app.createInvitationHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/invitations/accepted", app.requireActivatedUser(app.acceptInvitationHandler))
+
 	// Add the route for the POST /v1/users endpoint.
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	// Add the route for the PUT /v1/users/activated endpoint.
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.requireActivatedUser(app.changeEmailHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/email/confirmed", app.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireActivatedUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireActivatedUser(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/settings", app.requireActivatedUser(app.showSettingsHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/settings", app.requireActivatedUser(app.updateSettingsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/avatar", app.requireActivatedUser(app.uploadAvatarHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/avatar", app.requireActivatedUser(app.deleteAvatarHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/avatars/:id", app.showAvatarHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/totp", app.requireActivatedUser(app.enrollTwoFactorHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/totp", app.requireActivatedUser(app.disableTwoFactorHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/totp/confirmed", app.requireActivatedUser(app.confirmTwoFactorHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/totp/recovery-codes", app.requireActivatedUser(app.regenerateRecoveryCodesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireActivatedUser(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions", app.requireActivatedUser(app.revokeOtherSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireActivatedUser(app.revokeSessionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/calendar-token", app.requirePermission("tasks:read", app.createCalendarTokenHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/calendar-token", app.requireActivatedUser(app.deleteCalendarTokenHandler))
+
+	// CalDAV, for calendar apps that sync to-dos both ways, see caldav.go. Each workspace is
+	// a calendar, so reading needs a viewer and writing a member, as with /v1/tasks. OpenAPI
+	// has no way to describe WebDAV methods like PROPFIND, so these routes are only
+	// mentioned in the description of the Integrations tag.
+	caldavReader := func(next http.HandlerFunc) http.HandlerFunc {
+		return app.caldav("tasks:read", app.caldavWorkspace(data.RoleViewer, next))
+	}
+	caldavWriter := func(next http.HandlerFunc) http.HandlerFunc {
+		return app.caldav("tasks:write", app.caldavWorkspace(data.RoleMember, next))
+	}
+	router.HandlerFunc(http.MethodGet, "/.well-known/caldav", app.caldavWellKnownHandler)
+	router.HandlerFunc(methodPropfind, "/.well-known/caldav", app.caldavWellKnownHandler)
+	router.HandlerFunc(http.MethodOptions, "/caldav/*path", app.caldavOptionsHandler)
+	router.HandlerFunc(methodPropfind, "/caldav/", app.caldav("tasks:read", app.caldavRootHandler))
+	router.HandlerFunc(methodPropfind, "/caldav/principal/", app.caldav("tasks:read", app.caldavPrincipalHandler))
+	router.HandlerFunc(methodPropfind, "/caldav/calendars/", app.caldav("tasks:read", app.caldavHomeHandler))
+	router.HandlerFunc(methodPropfind, "/caldav/calendars/:workspace/", caldavReader(app.caldavCalendarHandler))
+	router.HandlerFunc(methodReport, "/caldav/calendars/:workspace/", caldavReader(app.caldavReportHandler))
+	router.HandlerFunc(methodPropfind, "/caldav/calendars/:workspace/:object", caldavReader(app.caldavObjectPropfindHandler))
+	router.HandlerFunc(http.MethodGet, "/caldav/calendars/:workspace/:object", caldavReader(app.caldavGetHandler))
+	router.HandlerFunc(http.MethodPut, "/caldav/calendars/:workspace/:object", caldavWriter(app.caldavPutHandler))
+	router.HandlerFunc(http.MethodDelete, "/caldav/calendars/:workspace/:object", caldavWriter(app.caldavDeleteHandler))
 
 	// Add the route for the POST /v1/tokens/authentication endpoint.
 	router.HandlerFunc(http.MethodPost, "/v1/users/token", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/auth/:provider/login", app.oauthLoginHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/auth/:provider/callback", app.oauthCallbackHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/auth/:provider/link", app.requireActivatedUser(app.oauthLinkHandler))
 
 	// Add the enableCORS() middleware.
-	return app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router))))
+	// recordMetrics() goes first, so that it also counts the responses sent by the
+	// other middleware (e.g. for a panic or for too many requests). compressResponses()
+	// comes before recoverPanic() so that error responses are compressed too.
+	// versionRequests() is outside all of them, so that /v2/ requests are seen as the
+	// /v1/ routes they are served by. secureHeaders() is outside recoverPanic() so that
+	// every response gets the security headers, and limitRequests() turns requests away
+	// before they are authenticated. checkMaintenance() comes before them too, so that
+	// the requests it turns away never reach the database. realIP() comes first of all,
+	// so that everything after it sees the client's address rather than a proxy's.
+	return app.realIP(app.versionRequests(app.recordMetrics(router, app.traceRequests(router, app.compressResponses(app.secureHeaders(app.recoverPanic(app.enableCORS(app.checkMaintenance(app.limitRequests(router, app.authenticate(app.rateLimit(router))))))))))))
 }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/searchindex"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// searchEngines are the values of -search-engine.
+var searchEngines = []string{"none", "elasticsearch", "meilisearch"}
+
+// reindexBatchSize is how many tasks -search-reindex sends to the search engine at a time.
+const reindexBatchSize = 500
+
+// The newSearchIndex() function returns the index of the search engine chosen on the
+// command line, or nil if there is none.
+func newSearchIndex(cfg config) searchindex.Index {
+	switch cfg.search.engine {
+	case "elasticsearch":
+		return searchindex.NewElasticsearch(cfg.search.url, cfg.search.apiKey, cfg.search.index)
+	case "meilisearch":
+		return searchindex.NewMeilisearch(cfg.search.url, cfg.search.apiKey, cfg.search.index)
+	default:
+		return nil
+	}
+}
+
+// The searchHandler() looks for the words in ?q= across the current workspace's tasks,
+// categories and comments and the user's tags, the same way ?q= searches tasks: each
+// word only needs to start a word of the text. Results are grouped by kind, best matches
+// first, with up to ?limit= of each; ?types= narrows down the kinds to look through. When
+// no task matches, tasks with similar titles are returned instead, flagged as fuzzy.
+// With -search-engine, tasks are looked for with the search engine instead, falling back
+// to the database if it can't be reached.
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query string
+		Types []string
+		Limit int
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Query = app.readString(qs, "q", "")
+	input.Types = app.readCSV(qs, "types", data.SearchTypes, len(data.SearchTypes), v)
+	input.Limit = app.readInt(qs, "limit", 5, v)
+
+	if data.ValidateSearch(v, input.Query, input.Types, input.Limit); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	workspaceID := app.contextGetWorkspace(r).WorkspaceID
+	types := input.Types
+	var tasks *data.SearchGroup
+	if app.searchIndex != nil && validator.In(data.SearchTasks, types...) {
+		var err error
+		tasks, err = app.searchEngineTasks(r.Context(), workspaceID, input.Query, input.Limit)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		} else {
+			types = make([]string, 0, len(input.Types))
+			for _, t := range input.Types {
+				if t != data.SearchTasks {
+					types = append(types, t)
+				}
+			}
+		}
+	}
+
+	results, err := app.models.Search.Search(r.Context(), workspaceID, app.contextGetUser(r).ID, input.Query, types, input.Limit, app.config.search.similarity)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if tasks != nil {
+		results[data.SearchTasks] = tasks
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"query": input.Query, "results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The searchEngineTasks() helper looks for tasks with the search engine, and fills in the
+// results from the database.
+func (app *application) searchEngineTasks(ctx context.Context, workspaceID int64, q string, limit int) (*data.SearchGroup, error) {
+	ids, total, err := app.searchIndex.Search(ctx, workspaceID, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	results, err := app.models.Search.TaskResults(ctx, workspaceID, ids, q)
+	if err != nil {
+		return nil, err
+	}
+	return &data.SearchGroup{Total: total, Results: results}, nil
+}
+
+// The setupSearchIndex() method creates the search engine's index if it doesn't exist
+// yet. An engine that can't be reached is only logged, since searches fall back to the
+// database; the readiness check reports it as well.
+func (app *application) setupSearchIndex() {
+	if app.searchIndex == nil {
+		return
+	}
+	err := app.searchIndex.Setup(context.Background())
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
+
+// The indexTask() helper mirrors a change to a task into the search engine, if there is
+// one, in the background. Archived tasks are removed from the index, as searches leave
+// them out. Failures are only logged; -search-reindex catches the index up.
+func (app *application) indexTask(event string, task interface{}) {
+	// A completed task has just been indexed for the task.updated event that comes with it.
+	if app.searchIndex == nil || event == data.EventTaskCompleted {
+		return
+	}
+	app.background(func() {
+		var err error
+		switch t := task.(type) {
+		case *data.Task:
+			if t.Archived {
+				err = app.searchIndex.Delete(context.Background(), []int64{t.ID})
+			} else {
+				err = app.searchIndex.Upsert(context.Background(), []searchindex.Document{searchDocument(t)})
+			}
+		case map[string]int64:
+			err = app.searchIndex.Delete(context.Background(), []int64{t["id"]})
+		}
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"event": event})
+		}
+	})
+}
+
+// The reindexSearch() method rebuilds the search engine's index from the database, for
+// -search-reindex: when an engine is first set up, or to catch up on writes it missed.
+// The index is recreated so that deleted tasks don't linger in it, which leaves searches
+// incomplete until the rebuild is done.
+func (app *application) reindexSearch(ctx context.Context) error {
+	if app.searchIndex == nil {
+		return errors.New("-search-reindex needs a -search-engine")
+	}
+	err := app.searchIndex.Recreate(ctx)
+	if err != nil {
+		return err
+	}
+
+	var afterID int64
+	indexed := 0
+	for {
+		tasks, err := app.models.Search.TasksAfter(ctx, afterID, reindexBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			break
+		}
+		docs := make([]searchindex.Document, len(tasks))
+		for i, task := range tasks {
+			docs[i] = searchDocument(task)
+		}
+		err = app.searchIndex.Upsert(ctx, docs)
+		if err != nil {
+			return err
+		}
+		afterID = tasks[len(tasks)-1].ID
+		indexed += len(tasks)
+	}
+
+	app.logger.PrintInfo("search index rebuilt", map[string]string{"engine": app.config.search.engine, "tasks": strconv.Itoa(indexed)})
+	return nil
+}
+
+func searchDocument(task *data.Task) searchindex.Document {
+	return searchindex.Document{
+		ID:          task.ID,
+		WorkspaceID: task.WorkspaceID,
+		Title:       task.Title,
+		Description: task.Description,
+	}
+}
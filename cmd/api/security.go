@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// defaultCSP is the Content-Security-Policy sent unless -csp says otherwise. The API only
+// sends data, so nothing in a response should ever be loaded or run by a browser, nor
+// should a response be framed.
+const defaultCSP = "default-src 'none'; frame-ancestors 'none'"
+
+// docsCSP is the Content-Security-Policy of the Swagger UI page, which loads the UI from
+// the CDN and starts it with an inline script, and then fetches the OpenAPI document.
+const docsCSP = "default-src 'none'; script-src https://unpkg.com 'unsafe-inline'; style-src https://unpkg.com; img-src https: data:; connect-src 'self'; frame-ancestors 'none'"
+
+// routeBodyLimits holds the body size limits of the routes that accept bodies larger than
+// -max-body-bytes, keyed by method and route pattern. The handlers enforce the same limits
+// themselves, since they also say what the body may contain.
+var routeBodyLimits = map[string]int64{
+	// POST /v1/tasks/import, see the routes dispatched by dispatchIDParam().
+	http.MethodPost + " /v1/tasks/:id":             maxImportBytes,
+	http.MethodPost + " /v1/import":                maxBackupBytes,
+	http.MethodPost + " /v1/users/me/avatar":       maxAvatarBytes,
+	http.MethodPost + " /v1/tasks/:id/attachments": maxAttachmentBytes,
+}
+
+// The secureHeaders() middleware adds the headers that tell browsers to keep their guard
+// up with our responses: to only use HTTPS from now on (for -hsts-max-age), not to guess
+// at content types, not to show the responses in frames, and the -csp policy.
+func (app *application) secureHeaders(next http.Handler) http.Handler {
+	hsts := ""
+	if app.config.security.hstsMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(app.config.security.hstsMaxAge.Seconds()))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hsts != "" {
+			w.Header().Set("Strict-Transport-Security", hsts)
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
+		if app.config.security.csp != "" {
+			w.Header().Set("Content-Security-Policy", app.config.security.csp)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The limitRequests() middleware turns away requests with more than -max-header-count
+// header fields, and limits the size of request bodies: to -max-body-bytes, or the route's
+// limit in routeBodyLimits. Bodies known to be too large from their Content-Length are
+// refused before anything is read; others fail when the limit is reached. The total size
+// of the headers is limited by the server, see -max-header-bytes.
+func (app *application) limitRequests(router *httprouter.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count := 0
+		for _, values := range r.Header {
+			count += len(values)
+		}
+		if count > app.config.security.maxHeaderCount {
+			app.errorResponse(w, r, http.StatusRequestHeaderFieldsTooLarge, fmt.Sprintf("the request must not have more than %d header fields", app.config.security.maxHeaderCount))
+			return
+		}
+
+		limit, ok := routeBodyLimits[r.Method+" "+routeLabel(router, r)]
+		if !ok {
+			limit = app.config.security.maxBodyBytes
+		}
+		if r.ContentLength > limit {
+			app.errorResponse(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("body must not be larger than %d bytes", limit))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+		next.ServeHTTP(w, r)
+	})
+}
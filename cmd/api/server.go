@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 )
@@ -18,7 +19,32 @@ func (app *application) serve() error {
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		// Larger headers are refused with 431 Request Header Fields Too Large.
+		MaxHeaderBytes: app.config.security.maxHeaderBytes,
 	}
+	// Close the open event streams when shutdown starts, otherwise Shutdown() would wait
+	// for them until its deadline.
+	srv.RegisterOnShutdown(app.events.Close)
+
+	// With TLS, the plain HTTP requests on -tls-redirect-port are redirected to HTTPS.
+	var redirect *http.Server
+	manager := app.certManager()
+	if app.tlsEnabled() {
+		srv.TLSConfig = app.tlsConfig(manager)
+		if app.config.tls.redirectPort != 0 {
+			redirect = app.redirectServer(manager)
+			srv.RegisterOnShutdown(func() {
+				redirect.Close()
+			})
+		}
+	}
+	ln, err := app.listen()
+	if err != nil {
+		return err
+	}
+	// With -listen, the address is the socket rather than the port.
+	srv.Addr = ln.Addr().String()
+
 	// Create a shutdownError channel. We will use this to receive any errors returned
 	// by the graceful Shutdown() function.
 	shutdownError := make(chan error)
@@ -29,31 +55,31 @@ func (app *application) serve() error {
 		app.logger.PrintInfo("caught signal", map[string]string{
 			"signal": s.String(),
 		})
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		// The whole shutdown, requests and background tasks alike, has to finish
+		// within the -shutdown-timeout deadline.
+		ctx, cancel := context.WithTimeout(context.Background(), app.config.shutdownTimeout)
 		defer cancel()
-		// Call Shutdown() on the server like before, but now we only send on the
-		// shutdownError channel if it returns an error.
-		err := srv.Shutdown(ctx)
-		if err != nil {
-			shutdownError <- err
-		}
-		// Log a message to say that we're waiting for any background goroutines to
-		// complete their tasks.
-		app.logger.PrintInfo("completing background tasks", map[string]string{
-			"addr": srv.Addr,
-		})
-		// Call Wait() to block until our WaitGroup counter is zero --- essentially
-		// blocking until the background goroutines have finished. Then we return nil on
-		// the shutdownError channel, to indicate that the shutdown completed without
-		// any issues.
-		app.wg.Wait()
-		shutdownError <- nil
+		shutdownError <- app.shutdown(ctx, srv)
 	}()
 	app.logger.PrintInfo("starting server", map[string]string{
 		"addr": srv.Addr,
 		"env":  app.config.env,
+		"tls":  strconv.FormatBool(app.tlsEnabled()),
 	})
-	err := srv.ListenAndServe()
+	if redirect != nil {
+		go func() {
+			err := redirect.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintError(err, map[string]string{"addr": redirect.Addr})
+			}
+		}()
+	}
+	if app.tlsEnabled() {
+		// The certificate comes from srv.TLSConfig when Let's Encrypt provides it.
+		err = srv.ServeTLS(ln, app.config.tls.certFile, app.config.tls.keyFile)
+	} else {
+		err = srv.Serve(ln)
+	}
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -66,3 +92,44 @@ func (app *application) serve() error {
 	})
 	return nil
 }
+
+// The shutdown() method stops the server gracefully. It stops accepting connections and
+// waits for the in-flight requests, then stops the scheduled jobs and waits for the
+// background tasks (such as emails being sent) to finish, and finally exports the spans
+// still queued. It gives up with an error if ctx expires first.
+func (app *application) shutdown(ctx context.Context, srv *http.Server) error {
+	app.logger.PrintInfo("completing in-flight requests", map[string]string{
+		"addr":    srv.Addr,
+		"timeout": app.config.shutdownTimeout.String(),
+	})
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("completing in-flight requests: %w", err)
+	}
+
+	// Tell the scheduled background jobs to stop after their current run.
+	close(app.done)
+	app.logger.PrintInfo("completing background tasks", map[string]string{
+		"addr": srv.Addr,
+	})
+	// Wait for the WaitGroup counter to reach zero in a separate goroutine, so that we
+	// can stop waiting when the deadline passes.
+	finished := make(chan struct{})
+	go func() {
+		app.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		return fmt.Errorf("completing background tasks: %w", ctx.Err())
+	}
+
+	// Export the spans that are still queued.
+	app.logger.PrintInfo("flushing traces", nil)
+	err = app.tracer.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("flushing traces: %w", err)
+	}
+	return nil
+}
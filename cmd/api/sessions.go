@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+)
+
+// The listSessionsHandler lists the current user's active sessions, so that they can spot
+// ones they don't recognise. The session the request was made with is marked as current.
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.models.Sessions.GetAllForUser(r.Context(), app.contextGetUser(r).ID, app.sessionScope())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	current := app.contextGetSession(r)
+	for _, session := range sessions {
+		session.Current = session.ID == current
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The revokeSessionHandler signs out one of the current user's sessions. In JWT mode the
+// session's access tokens can't be revoked, but they can't be refreshed either and run
+// out soon after.
+func (app *application) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Sessions.Delete(r.Context(), id, app.contextGetUser(r).ID, app.sessionScope())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The revokeOtherSessionsHandler signs the current user out everywhere except for the
+// session the request was made with.
+func (app *application) revokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	revoked, err := app.models.Sessions.DeleteAllExcept(r.Context(), app.contextGetUser(r).ID, app.sessionScope(), app.contextGetSession(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revoked": revoked}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+func (app *application) showSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := app.models.Settings.Get(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"settings": settings}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := app.models.Settings.Get(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var input settingsInput
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before := *settings
+	v := validator.New()
+	err = app.applySettings(r.Context(), v, settings, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Settings.Save(r.Context(), settings)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Settings are audited as changes to the user they belong to.
+	app.recordAudit(settings.UserID, data.AuditUser, settings.UserID, data.AuditUpdate, &before, settings)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"settings": settings}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// settingsInput holds the changes to a user's settings, for PATCH /v1/users/me/settings
+// and the settings object of PATCH /v1/users/me. Settings that are left out aren't
+// changed, and a digest_hour of null goes back to the server's hour.
+type settingsInput struct {
+	ReminderWindow   *int        `json:"reminder_window_minutes"`
+	DailyDigest      *bool       `json:"daily_digest"`
+	RequireTwoFactor *bool       `json:"require_two_factor"`
+	Locale           *string     `json:"locale"`
+	DefaultPageSize  *int        `json:"default_page_size"`
+	DefaultSort      *string     `json:"default_sort"`
+	DigestHour       optionalInt `json:"digest_hour"`
+}
+
+// optionalInt is a number that can be set to null, which a pointer can't tell apart from
+// a key that was left out. Like optionalTime, set records whether the key was there.
+type optionalInt struct {
+	set   bool
+	value *int
+}
+
+func (o *optionalInt) UnmarshalJSON(b []byte) error {
+	o.set = true
+	return json.Unmarshal(b, &o.value)
+}
+
+// The applySettings() helper copies the fields given in input onto settings and validates
+// the result, adding any problems to v. An error is only returned if the checks couldn't
+// be made.
+func (app *application) applySettings(ctx context.Context, v *validator.Validator, settings *data.Settings, input settingsInput) error {
+	before := *settings
+	if input.ReminderWindow != nil {
+		settings.ReminderWindow = *input.ReminderWindow
+	}
+	if input.DailyDigest != nil {
+		settings.DailyDigest = *input.DailyDigest
+	}
+	if input.Locale != nil {
+		settings.Locale = *input.Locale
+	}
+	if input.DefaultPageSize != nil {
+		settings.DefaultPageSize = *input.DefaultPageSize
+	}
+	if input.DefaultSort != nil {
+		settings.DefaultSort = *input.DefaultSort
+	}
+	if input.DigestHour.set {
+		settings.DigestHour = input.DigestHour.value
+	}
+
+	if input.RequireTwoFactor != nil {
+		settings.RequireTwoFactor = *input.RequireTwoFactor
+		// Requiring a second factor that hasn't been set up would lock the user out.
+		if settings.RequireTwoFactor && !before.RequireTwoFactor {
+			twoFactor, err := app.models.TwoFactor.Get(ctx, settings.UserID)
+			if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+				return err
+			}
+			v.Check(err == nil && twoFactor.Confirmed, "require_two_factor", "two-factor authentication must be set up first")
+		}
+	}
+	data.ValidateSettings(v, settings, app.messages.Languages())
+	return nil
+}
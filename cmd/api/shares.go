@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// The shareTaskHandler() creates a public, read-only link to one of the workspace's tasks.
+// Anyone with the link can see the task and its comments without an account. Sharing a
+// task again replaces its previous link.
+func (app *application) shareTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	share, err := app.models.Shares.New(r.Context(), task.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The token is only stored hashed, so this is the only time the URL can be shown.
+	err = app.writeJSON(w, http.StatusCreated, envelope{"share": share, "url": "/v1/shared/" + share.Plaintext}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The unshareTaskHandler() revokes a task's public link.
+func (app *application) unshareTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Shares.Delete(r.Context(), task.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "share link successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The showSharedTaskHandler() is the public side of a share link. It needs no
+// authentication: the token in the URL is what grants access, to that one task only.
+// Comments are paginated like on GET /v1/tasks/:id/comments.
+func (app *application) showSharedTaskHandler(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	// Unknown, malformed and revoked tokens all look the same from the outside.
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return
+	}
+	task, err := app.models.Shares.GetTask(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	comments, metadata, ok := app.readComments(w, r, task)
+	if !ok {
+		return
+	}
+
+	task.SetDueStatus(app.clock())
+	// readComments() has checked the render parameter.
+	if r.URL.Query().Get("render") == "html" {
+		task.RenderDescription()
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"task": task, "comments": comments, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
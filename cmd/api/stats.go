@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// maxStatsRange is the longest date range that GET /v1/stats reports on at once.
+const maxStatsRange = 366 * 24 * time.Hour
+
+// The statsHandler returns the current workspace's task statistics for the range given by ?from
+// and ?to (the last 30 days by default), with completions grouped by ?interval=day|week.
+func (app *application) statsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	// Days and weeks start at midnight in the user's time zone.
+	loc := app.userLocation(app.contextGetUser(r))
+	to := app.readTime(qs, "to", app.clock().In(loc), loc, v)
+	from := app.readTime(qs, "from", to.AddDate(0, 0, -30), loc, v)
+	interval := app.readString(qs, "interval", "day")
+
+	v.Check(from.Before(to), "from", "must be earlier than to")
+	v.Check(to.Sub(from) <= maxStatsRange, "from", "must be at most 366 days before to")
+	v.Check(validator.In(interval, data.StatsIntervals...), "interval", "must be one of "+strings.Join(data.StatsIntervals, ", "))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	stats, err := app.models.Stats.Get(r.Context(), app.contextGetWorkspace(r).WorkspaceID, from, to, interval, loc)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
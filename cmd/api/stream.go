@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// streamHeartbeat is how often a comment line is sent on an idle event stream, so that
+// proxies don't time the connection out.
+const streamHeartbeat = 15 * time.Second
+
+// The taskEventsHandler() holds a Server-Sent Events connection open and pushes the
+// current user's task events down it as they happen. Each event is sent as
+//
+//	id: 42
+//	event: task.updated
+//	data: {"occurred_at":"...","task":{...}}
+func (app *application) taskEventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// The stream is meant to stay open, so lift the server's write timeout for this
+	// connection only.
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	sub := app.events.Subscribe(app.contextGetUser(r).ID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop nginx and similar proxies from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Tell the client how long to wait before reconnecting, and flush the headers so it
+	// knows the stream is open.
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-sub.C:
+			// The bus closes subscriptions when the server is shutting down.
+			if !ok {
+				return
+			}
+			js, err := json.Marshal(map[string]interface{}{
+				"occurred_at": event.OccurredAt.Format(time.RFC3339),
+				"task":        event.Data,
+			})
+			if err != nil {
+				app.logError(r, err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, js)
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+func (app *application) createSubtaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Title string `json:"title"`
+		Done  bool   `json:"done"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	subtask := &data.Subtask{
+		TaskID: task.ID,
+		Title:  input.Title,
+		Done:   input.Done,
+	}
+
+	v := validator.New()
+	if data.ValidateSubtask(v, subtask); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Subtasks.Insert(r.Context(), subtask)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tasks/%d/subtasks/%d", task.ID, subtask.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"subtask": subtask}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSubtasksHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	subtasks, err := app.models.Subtasks.GetAllForTask(r.Context(), task.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"subtasks": subtasks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateSubtaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "subtask_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	subtask, err := app.models.Subtasks.Get(r.Context(), id, task.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Use pointers for the fields.
+	var input struct {
+		Title    *string `json:"title"`
+		Done     *bool   `json:"done"`
+		Position *int    `json:"position"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Title != nil {
+		subtask.Title = *input.Title
+	}
+	if input.Done != nil {
+		subtask.Done = *input.Done
+	}
+	if input.Position != nil {
+		subtask.Position = *input.Position
+	}
+
+	v := validator.New()
+	if data.ValidateSubtask(v, subtask); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Subtasks.Update(r.Context(), subtask)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// If this change ticked off the last open item on the checklist, complete the
+	// parent task as well (when enabled in the config).
+	if subtask.Done && app.config.subtasks.autoComplete {
+		err = app.autoCompleteTask(r.Context(), app.contextGetUser(r).ID, task)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"subtask": subtask}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSubtaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := app.readNamedIDParam(r, "subtask_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Subtasks.Delete(r.Context(), id, task.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "subtask successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The autoCompleteTask() helper marks a task as completed once all of its subtasks are done,
+// on behalf of the user who ticked off the last one.
+// A concurrent edit of the task is not treated as a failure: the subtask change has already
+// been saved, and the client will see the task's current state on its next read.
+func (app *application) autoCompleteTask(ctx context.Context, actorID int64, task *data.Task) error {
+	if task.Status == data.StatusCompleted {
+		return nil
+	}
+	allDone, err := app.models.Subtasks.AllDone(ctx, task.ID)
+	if err != nil || !allDone {
+		return err
+	}
+	// A task that is still blocked by open tasks stays as it is.
+	before := *task
+	previousStatus := task.Status
+	task.Status = data.StatusCompleted
+	err = app.models.Dependencies.CheckBlockers(ctx, task, previousStatus)
+	if err != nil {
+		task.Status = previousStatus
+		var transitionErr *data.TransitionError
+		if errors.As(err, &transitionErr) {
+			return nil
+		}
+		return err
+	}
+	err = app.models.Tasks.Update(ctx, task)
+	switch {
+	case err == nil:
+		app.publishTaskUpdate(task, previousStatus)
+		app.recordTaskUpdate(actorID, before, task)
+	case !errors.Is(err, data.ErrEditConflict):
+		return err
+	}
+	return nil
+}
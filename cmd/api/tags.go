@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+func (app *application) createTagHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tag := &data.Tag{
+		UserID: app.contextGetUser(r).ID,
+		Name:   input.Name,
+	}
+
+	v := validator.New()
+	if data.ValidateTag(v, tag); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tags.Insert(r.Context(), tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTag):
+			v.AddError("name", "a tag with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tags/%d", tag.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"tag": tag}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tags, err := app.models.Tags.GetAllForUser(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tags": tags}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateTagHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	tag, err := app.models.Tags.Get(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name *string `json:"name"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		tag.Name = *input.Name
+	}
+
+	v := validator.New()
+	if data.ValidateTag(v, tag); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tags.Update(r.Context(), tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTag):
+			v.AddError("name", "a tag with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Tags.Delete(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tag successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTaskTagsHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	tags, err := app.models.Tags.GetForTask(r.Context(), task.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tags": tags}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addTaskTagHandler(w http.ResponseWriter, r *http.Request) {
+	task, tag, ok := app.readOwnedTaskAndTag(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Tags.AddToTask(r.Context(), task.ID, tag.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeTaskTagHandler(w http.ResponseWriter, r *http.Request) {
+	task, tag, ok := app.readOwnedTaskAndTag(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Tags.RemoveFromTask(r.Context(), task.ID, tag.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tag successfully removed from task"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readOwnedTaskAndTag() helper fetches the task (:id) and tag (:tag_id) from the URL,
+// both of which must belong to the current user.
+func (app *application) readOwnedTaskAndTag(w http.ResponseWriter, r *http.Request) (*data.Task, *data.Tag, bool) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	tagID, err := app.readNamedIDParam(r, "tag_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	tag, err := app.models.Tags.Get(r.Context(), tagID, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+	return task, tag, true
+}
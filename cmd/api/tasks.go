@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/zarinakolybaeva/DoMake/internal/data"
 	"github.com/zarinakolybaeva/DoMake/internal/validator"
 	"net/http"
+	"strings"
+	"time"
 )
 
 func (app *application) createTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -13,43 +16,73 @@ func (app *application) createTaskHandler(w http.ResponseWriter, r *http.Request
 	// (note that the field names and types in the struct are a subset of the Movie struct that we created earlier).
 	// This struct will be our *target  decode destination*.
 	var input struct {
-		Title       string          `json:"title"`
-		Description string          `json:"description"`
-		DueDate     data.CustomTime `json:"due_date"`
-		Priority    string          `json:"priority"`
-		Status      string          `json:"status"`
-		Category    string          `json:"category"`
+		Title       string            `json:"title"`
+		Description string            `json:"description"`
+		DueDate     data.CustomTime   `json:"due_date"`
+		StartDate   data.CustomTime   `json:"start_date"`
+		Priority    data.TaskPriority `json:"priority"`
+		Status      data.TaskStatus   `json:"status"`
+		CategoryID  int64             `json:"category_id"`
+		Category    string            `json:"category"`
+		Recurrence  string            `json:"recurrence"`
+
+		EstimateMinutes  *int `json:"estimate_minutes"`
+		RemainingMinutes *int `json:"remaining_minutes"`
+
+		CustomFields map[string]interface{} `json:"custom_fields"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
-	// Copy the values from the input struct to a new Movie struct.
+	// Copy the values from the input struct to a new Movie struct. A due or start date
+	// given as a date on its own is midnight in the user's time zone.
+	user := app.contextGetUser(r)
 	task := &data.Task{
 		Title:       input.Title,
 		Description: input.Description,
-		DueDate:     input.DueDate,
+		DueDate:     input.DueDate.ResolveDate(app.userLocation(user)),
+		StartDate:   input.StartDate.ResolveDate(app.userLocation(user)),
 		Priority:    input.Priority,
 		Status:      input.Status,
+		CategoryID:  input.CategoryID,
 		Category:    input.Category,
+		UserID:      user.ID,
+		WorkspaceID: app.contextGetWorkspace(r).WorkspaceID,
+		Recurrence:  input.Recurrence,
+
+		EstimateMinutes:  input.EstimateMinutes,
+		RemainingMinutes: input.RemainingMinutes,
+	}
+	setCustomFields(task, input.CustomFields)
+	// Nothing has been done on a new task yet, so all of its estimate is left.
+	if task.RemainingMinutes == nil {
+		task.RemainingMinutes = task.EstimateMinutes
 	}
 
 	// Initialize a new Validator.
 	v := validator.New()
 
-	// Call the ValidateTask() function and return a response containing the errors if any of the checks fail.
-	if data.ValidateTask(v, task); !v.Valid() {
+	// Call the validateTask() helper and return a response containing the errors if any of the checks fail.
+	err = app.validateTask(r.Context(), v, task)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 	// Call the Insert() method on our tasks model, passing in a pointer to the validated task struct.
 	// This will create a record in the database and update the task struct with the system-generated information.
-	err = app.models.Tasks.Insert(task)
+	err = app.models.Tasks.Insert(r.Context(), task)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.publishTaskEvent(task.WorkspaceID, data.EventTaskCreated, task)
+	app.recordAudit(task.UserID, data.AuditTask, task.ID, data.AuditCreate, nil, task)
 	// When sending a HTTP response, we want to include a Location header to
 	//		let the client know which URL they can find the newly-created resource at.
 	// We make an empty http.Header map and then use the Set() method to add a new Location header,
@@ -57,7 +90,7 @@ func (app *application) createTaskHandler(w http.ResponseWriter, r *http.Request
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/tasks/%d", task.ID))
 	// Write a JSON response with a 201 Created status code, the task data in the response body, and the Location header.
-	err = app.writeJSON(w, http.StatusCreated, envelope{"task": task}, headers)
+	err = app.writeJSON(w, http.StatusCreated, envelope{"task": app.localTask(user, task)}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -74,7 +107,15 @@ func (app *application) showTaskHandler(w http.ResponseWriter, r *http.Request)
 	// Call the Get() method to fetch the data for a specific task.
 	// We also need to use the errors.Is() function to check if it returns a data.ErrRecordNotFound error,
 	// in which case we send a 404 Not Found response to the client.
-	task, err := app.models.Tasks.Get(id)
+	// Tasks are shared by a workspace, so we only look among the ones in the current workspace.
+	v := validator.New()
+	render := app.readRender(r.URL.Query(), v)
+	include := app.readInclude(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	task, err := app.models.Tasks.GetForWorkspace(r.Context(), id, app.contextGetWorkspace(r).WorkspaceID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -84,12 +125,64 @@ func (app *application) showTaskHandler(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"task": task}, nil)
+	// Embed the tasks this one is blocked by and the tasks waiting on it.
+	blockers, err := app.models.Dependencies.GetBlockers(r.Context(), task.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	dependents, err := app.models.Dependencies.GetDependents(r.Context(), task.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	trackedSeconds, err := app.models.TimeEntries.TotalForTask(r.Context(), task.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	detail := taskDetail{Task: app.localTask(app.contextGetUser(r), task), Blockers: blockers, Dependents: dependents, TrackedSeconds: trackedSeconds}
+	// Embed the related resources asked for with ?include=.
+	if include["category"] {
+		detail.CategoryDetails, err = app.models.Categories.Get(r.Context(), task.CategoryID, task.WorkspaceID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	includes, err := app.loadTaskIncludes(r.Context(), app.contextGetUser(r), []int64{task.ID}, include)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	detail.taskIncludes = includes[0]
+	// Last-Modified is when the task itself was last changed. Its dependencies and tracked
+	// time can change without it, so clients that need those to be current should
+	// revalidate with the ETag instead.
+	setLastModified(w, time.Time(task.UpdatedAt))
+	if render {
+		detail.Task.RenderDescription()
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"task": detail}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// taskDetail is the representation of a single task returned by GET /v1/tasks/:id. It adds
+// the related tasks and the time tracked on it, which are too expensive to load for every
+// task in a list, and the resources asked for with ?include=.
+type taskDetail struct {
+	*data.Task
+	Blockers       []*data.TaskRef `json:"blockers"`
+	Dependents     []*data.TaskRef `json:"dependents"`
+	TrackedSeconds int64           `json:"tracked_seconds"`
+
+	CategoryDetails *data.Category `json:"category_details,omitempty"`
+	taskIncludes
+}
+
 func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the task ID from the URL.
 	id, err := app.readIDParam(r)
@@ -97,8 +190,8 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 		app.notFoundResponse(w, r)
 		return
 	}
-	// Retrieve the task record as normal.
-	task, err := app.models.Tasks.Get(id)
+	// Retrieve the task record, making sure it belongs to the current workspace.
+	task, err := app.models.Tasks.GetForWorkspace(r.Context(), id, app.contextGetWorkspace(r).WorkspaceID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -109,14 +202,7 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	// Use pointers for the fields.
-	var input struct {
-		Title       *string          `json:"title"`
-		Description *string          `json:"description"`
-		DueDate     *data.CustomTime `json:"due_date"`
-		Priority    *string          `json:"priority"`
-		Status      *string          `json:"status"`
-		Category    *string          `json:"category"`
-	}
+	var input taskInput
 
 	// Decode the Json as normal
 	err = app.readJSON(w, r, &input)
@@ -125,17 +211,92 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// If the input.Title value is nil then we know that no corresponding "title"
-	//		key/value pair was provided in the JSON request body.
-	// So we move on and leave the task record unchanged.
-	// Otherwise, we update the task record with the new title value.
-	// Importantly, because input.Title is a now a pointer to a string,
-	//		we need to dereference the pointer using the * operator to get the underlying value
-	// 			before assigning it to our task record.
+	// Copy the provided fields onto the task record, remembering the old status so that
+	// we can check the change against the workflow rules, and the old record for the
+	// audit log.
+	before := *task
+	previousStatus := task.Status
+	input.apply(task, app.userLocation(app.contextGetUser(r)))
+
+	// Validate the updated task record, sending the client a 422 Unprocessable Entity response if any checks fail.
+	v := validator.New()
+	err = app.validateTask(r.Context(), v, task)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if !app.checkStatusChange(w, r, task, previousStatus) {
+		return
+	}
+	// Intercept any ErrEditConflict error and call the new editConflictResponse() helper.
+	err = app.models.Tasks.Update(r.Context(), task)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.publishTaskUpdate(task, previousStatus)
+	app.recordTaskUpdate(app.contextGetUser(r).ID, before, task)
+
+	// Write the updated task record in a JSON response.
+	err = app.writeJSON(w, http.StatusOK, envelope{"task": app.localTask(app.contextGetUser(r), task)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// taskInput holds the fields a client may change on an existing task. Pointers are used so
+// that we can tell a field which was left out of the JSON apart from one set to its zero value.
+type taskInput struct {
+	Title       *string            `json:"title"`
+	Description *string            `json:"description"`
+	DueDate     optionalTime       `json:"due_date"`
+	StartDate   optionalTime       `json:"start_date"`
+	Priority    *data.TaskPriority `json:"priority"`
+	Status      *data.TaskStatus   `json:"status"`
+	CategoryID  *int64             `json:"category_id"`
+	Category    *string            `json:"category"`
+	Recurrence  *string            `json:"recurrence"`
+
+	EstimateMinutes  optionalInt `json:"estimate_minutes"`
+	RemainingMinutes optionalInt `json:"remaining_minutes"`
+
+	// CustomFields sets the values of the custom fields given, leaving the others alone;
+	// null clears a field.
+	CustomFields map[string]interface{} `json:"custom_fields"`
+}
+
+// optionalTime is a time in a taskInput. A pointer can't tell a due date that was left out
+// of the JSON apart from one set to null to remove it, so set records whether the key was
+// there at all, and a null leaves time as the zero value.
+type optionalTime struct {
+	set  bool
+	time data.CustomTime
+}
+
+func (o *optionalTime) UnmarshalJSON(b []byte) error {
+	o.set = true
+	return o.time.UnmarshalJSON(b)
+}
+
+// The apply() method copies the provided fields onto task, reading a due or start date
+// given as a date on its own as midnight in loc.
+// If input.Title is nil then we know that no corresponding "title" key/value pair was
+// provided in the JSON request body, so we leave the task record unchanged. Otherwise, we
+// dereference the pointer using the * operator to get the underlying value before
+// assigning it to our task record. We do the same for the other fields.
+func (input taskInput) apply(task *data.Task, loc *time.Location) {
 	if input.Title != nil {
 		task.Title = *input.Title
 	}
-	// We also do the same for the other fields in the input struct.
 	if input.Description != nil {
 		task.Description = *input.Description
 	}
@@ -145,48 +306,88 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 	if input.Status != nil {
 		task.Status = *input.Status
 	}
+	// A category can be picked by ID or by name; validateTask() looks up the other one.
+	if input.CategoryID != nil {
+		task.CategoryID = *input.CategoryID
+		task.Category = ""
+	}
 	if input.Category != nil {
+		task.CategoryID = 0
 		task.Category = *input.Category
 	}
-	if input.DueDate != nil {
-		task.DueDate = *input.DueDate
+	if input.DueDate.set {
+		task.DueDate = input.DueDate.time.ResolveDate(loc)
+	}
+	if input.StartDate.set {
+		task.StartDate = input.StartDate.time.ResolveDate(loc)
+	}
+	if input.Recurrence != nil {
+		task.Recurrence = *input.Recurrence
+	}
+	if input.EstimateMinutes.set {
+		task.EstimateMinutes = input.EstimateMinutes.value
+	}
+	if input.RemainingMinutes.set {
+		task.RemainingMinutes = input.RemainingMinutes.value
 	}
+	setCustomFields(task, input.CustomFields)
+}
 
-	// Validate the updated task record, sending the client a 422 Unprocessable Entity response if any checks fail.
-	v := validator.New()
-	if data.ValidateTask(v, task); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+// The setCustomFields() helper sets the values of a task's custom fields, removing those
+// set to nil. The task gets a new map, so that copies of it made beforehand (for the audit
+// log, say) keep the old values.
+func setCustomFields(task *data.Task, values map[string]interface{}) {
+	if len(values) == 0 {
 		return
 	}
-	// Intercept any ErrEditConflict error and call the new editConflictResponse() helper.
-	err = app.models.Tasks.Update(task)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
+	fields := make(data.CustomFieldValues, len(task.CustomFields)+len(values))
+	for name, value := range task.CustomFields {
+		fields[name] = value
+	}
+	for name, value := range values {
+		if value == nil {
+			delete(fields, name)
+		} else {
+			fields[name] = value
 		}
-		return
 	}
+	task.CustomFields = fields
+}
 
-	// Write the updated task record in a JSON response.
-	err = app.writeJSON(w, http.StatusOK, envelope{"task": task}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
+// The validateTask() helper runs data.ValidateTask() and, if the task passes, checks its
+// custom fields against the workspace's, and that its category exists and belongs to the
+// task's owner, filling in the category's ID and name on the task. Only unexpected
+// database errors are returned; problems with the task are recorded in v.
+func (app *application) validateTask(ctx context.Context, v *validator.Validator, task *data.Task) error {
+	if data.ValidateTask(v, task); !v.Valid() {
+		return nil
+	}
+	if len(task.CustomFields) > 0 {
+		fields, err := app.models.CustomFields.GetAllForWorkspace(ctx, task.WorkspaceID)
+		if err != nil {
+			return err
+		}
+		if data.ValidateCustomFieldValues(v, fields, task.CustomFields); !v.Valid() {
+			return nil
+		}
+	}
+	err := app.models.Categories.ResolveForTask(ctx, task)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		v.AddError("category_id", "must be one of your categories")
+		return nil
 	}
+	return err
 }
 
 func (app *application) deleteTaskHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the task ID from the URL.
-	id, err := app.readIDParam(r)
-	if err != nil {
-		app.notFoundResponse(w, r)
+	// Fetch the task first, so that the audit log can record what was deleted.
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
 		return
 	}
 	// Delete the task from the database,
 	//		sending a 404 Not Found response to the client if there isn't a matching record.
-	err = app.models.Tasks.Delete(id)
+	err := app.models.Tasks.DeleteForWorkspace(r.Context(), task.ID, task.WorkspaceID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -196,6 +397,8 @@ func (app *application) deleteTaskHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
+	app.publishTaskEvent(task.WorkspaceID, data.EventTaskDeleted, map[string]int64{"id": task.ID})
+	app.recordAudit(app.contextGetUser(r).ID, data.AuditTask, task.ID, data.AuditDelete, task, nil)
 	// Return a 200 OK status code along with a success message.
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "task successfully deleted"}, nil)
 	if err != nil {
@@ -206,7 +409,7 @@ func (app *application) deleteTaskHandler(w http.ResponseWriter, r *http.Request
 func (app *application) listTasksHandler(w http.ResponseWriter, r *http.Request) {
 	// Embed the new Filters struct.
 	var input struct {
-		Title string
+		data.TaskFilters
 		data.Filters
 	}
 	// Initialize a new Validator instance.
@@ -215,33 +418,653 @@ func (app *application) listTasksHandler(w http.ResponseWriter, r *http.Request)
 	// Call r.URL.Query() to get the url.Values map containing the query string data.
 	qs := r.URL.Query()
 
+	// The ids parameter fetches the given tasks in one request, e.g. ?ids=1,2,3, instead of
+	// searching. The other filters and the pagination don't apply to it.
+	ids := app.readIDs(qs, "ids", app.config.filters.maxIDs, v)
+
 	input.Title = app.readString(qs, "title", "")
+	// The q parameter searches both title and description and ranks the results.
+	input.Query = app.readString(qs, "q", "")
+	// If neither finds anything, titles similar to them are looked for instead, to get
+	// past typos.
+	input.Similarity = app.config.search.similarity
+	// Read the list filters. The multi-value ones are comma-separated, e.g. ?tags=work,urgent
+	// or ?status=to-do,in-progress.
+	input.Tags = app.readCSV(qs, "tags", []string{}, app.config.filters.maxValues, v)
+	input.IncludeArchived = app.readBool(qs, "include_archived", false, v)
+	input.IncludeSnoozed = app.readBool(qs, "include_snoozed", false, v)
+	input.Statuses = app.readCSV(qs, "status", []string{}, len(data.TaskStatuses), v)
+	input.Priorities = app.readCSV(qs, "priority", []string{}, len(data.TaskPriorities), v)
+	input.Category = app.readString(qs, "category", "")
+	input.CategoryID = int64(app.readInt(qs, "category_id", 0, v))
+	loc := app.userLocation(app.contextGetUser(r))
+	input.DueBefore = app.readTime(qs, "due_before", time.Time{}, loc, v)
+	input.DueAfter = app.readTime(qs, "due_after", time.Time{}, loc, v)
+	input.CompletedBefore = app.readTime(qs, "completed_before", time.Time{}, loc, v)
+	input.CompletedAfter = app.readTime(qs, "completed_after", time.Time{}, loc, v)
+	// ?has_due_date=false lists the "someday" tasks, which have no due date.
+	if qs.Has("has_due_date") {
+		hasDueDate := app.readBool(qs, "has_due_date", false, v)
+		input.HasDueDate = &hasDueDate
+	}
+	// The user's pinned tasks come first, and ?pinned=true lists only those.
+	input.UserID = app.contextGetUser(r).ID
+	if qs.Has("pinned") {
+		pinned := app.readBool(qs, "pinned", false, v)
+		input.Pinned = &pinned
+	}
+	// ?due=overdue|today|this_week are shortcuts relative to the current day in the user's
+	// time zone.
+	input.Due = app.readString(qs, "due", "")
+	input.Now = app.clock().In(loc)
+	input.Today = time.Date(input.Now.Year(), input.Now.Month(), input.Now.Day(), 0, 0, 0, 0, loc)
+	// ?available=true leaves out the tasks whose start date is still to come, and
+	// ?scheduled=true lists only those.
+	input.Available = app.readBool(qs, "available", false, v)
+	input.Scheduled = app.readBool(qs, "scheduled", false, v)
+	// ?custom.name=value lists the tasks with that value of the custom field.
+	customFields, err := app.readCustomFieldFilters(r.Context(), qs, app.contextGetWorkspace(r).WorkspaceID, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	input.CustomFields = customFields
+	// ?render=html adds the descriptions rendered as HTML, ?category_fields= picks the
+	// fields of the embedded categories, and ?include= embeds related resources, see
+	// taskListItems().
+	app.readRender(qs, v)
+	app.readCategoryFields(qs, v)
+	app.readInclude(qs, v)
+
+	// The page size and sort default to the ones the user has chosen in their settings.
+	settings, err := app.models.Settings.Get(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	// Read the page and page_size query string values into the embedded struct.
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
-	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", settings.DefaultPageSize, v)
 
 	// Read the sort query string value into the embedded struct.
-	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.Sort = app.readString(qs, "sort", settings.DefaultSort)
 
 	// Add the supported sort values for this endpoint to the sort safelist.
-	input.Filters.SortSafelist = []string{"id", "title", "priority", "category", "-id", "-title", "-priority", "-category"}
+	input.Filters.SortSafelist = data.TaskSorts
+	// Pages larger than usual are allowed, since they are streamed, see streamTasks().
+	input.Filters.MaxPageSize = maxStreamedPageSize
 
 	// Execute the validation checks on the Filters struct and send a response containing the errors if necessary.
+	data.ValidateTaskFilters(v, input.TaskFilters)
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	workspaceID := app.contextGetWorkspace(r).WorkspaceID
+
+	if len(ids) > 0 {
+		tasks, err := app.models.Tasks.GetMany(r.Context(), workspaceID, ids)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		items, err := app.taskListItems(r, workspaceID, tasks)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		err = app.writeResponse(w, r, http.StatusOK, envelope{"tasks": items}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Filters.PageSize > maxBufferedPageSize && negotiateFormat(r.Header.Get("Accept")) == formatJSON && apiVersion(w) == apiV1 {
+		app.streamTasks(w, r, workspaceID, input.TaskFilters, input.Filters)
+		return
+	}
+
 	// Accept the metadata struct as a return value.
-	tasks, metadata, err := app.models.Tasks.GetAll(input.Title, input.Filters)
+	tasks, metadata, err := app.models.Tasks.GetAllForWorkspace(r.Context(), workspaceID, input.TaskFilters, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	items, err := app.taskListItems(r, workspaceID, tasks)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	// Include the metadata in the response envelope.
-	err = app.writeJSON(w, http.StatusOK, envelope{"tasks": tasks, "metadata": metadata}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"tasks": items, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Define the page sizes of task lists. Pages of up to maxBufferedPageSize tasks are
+// loaded in full before the response is written. Larger ones, of up to
+// maxStreamedPageSize tasks, are streamed in batches of streamBatchSize when the client
+// asks for JSON from /v1/; XML, CSV and /v2/ responses are still produced from the whole
+// page.
+const (
+	maxBufferedPageSize = 100
+	maxStreamedPageSize = 1000
+	streamBatchSize     = 100
+)
+
+// The streamTasks() helper sends a page of tasks like listTasksHandler() does, but writes
+// the tasks with a jsonStream as their rows are read, so that only one batch of them is
+// held in memory at a time. The categories are fetched once per batch.
+func (app *application) streamTasks(w http.ResponseWriter, r *http.Request, workspaceID int64, tf data.TaskFilters, filters data.Filters) {
+	w.Header().Add("Vary", "Accept")
+	stream := app.newJSONStream(w, http.StatusOK, "tasks", nil)
+
+	batch := make([]*data.Task, 0, streamBatchSize)
+	flush := func() error {
+		items, err := app.taskListItems(r, workspaceID, batch)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			err = stream.write(item)
+			if err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	metadata, err := app.models.Tasks.StreamForWorkspace(r.Context(), workspaceID, tf, filters, func(task *data.Task) error {
+		batch = append(batch, task)
+		if len(batch) < streamBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil {
+		err = stream.close(envelope{"metadata": metadata})
+	}
+	if err != nil {
+		// Once the status line has been sent all we can do is log the problem; the client
+		// will see a truncated document.
+		if stream.started() {
+			app.logError(r, err)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// taskListItem is the representation of a task in the lists returned by GET /v1/tasks. It
+// embeds the task's category, next to the category name that the task carries itself, and
+// says whether the current user has pinned it.
+type taskListItem struct {
+	*data.Task
+	CategoryDetails *categoryDetails `json:"category_details"`
+	Pinned          bool             `json:"pinned"`
+	taskIncludes
+}
+
+// The taskListItems() helper embeds their categories in a list of tasks, marks the ones
+// the user has pinned, and converts their due dates to the user's time zone. The
+// categories and pins are fetched with a single query each for the whole list, rather
+// than one per task. The descriptions are rendered as HTML if
+// the request asks for it with ?render=html, the categories are cut down to the fields
+// asked for with ?category_fields=, and the resources asked for with ?include= are
+// embedded, all of which listTasksHandler() has validated.
+func (app *application) taskListItems(r *http.Request, workspaceID int64, tasks []*data.Task) ([]taskListItem, error) {
+	categoryIDs := []int64{}
+	taskIDs := make([]int64, len(tasks))
+	seen := make(map[int64]bool)
+	for i, task := range tasks {
+		taskIDs[i] = task.ID
+		if !seen[task.CategoryID] {
+			seen[task.CategoryID] = true
+			categoryIDs = append(categoryIDs, task.CategoryID)
+		}
+	}
+	categories, err := app.models.Categories.GetMany(r.Context(), workspaceID, categoryIDs)
+	if err != nil {
+		return nil, err
+	}
+	user := app.contextGetUser(r)
+	pinned, err := app.models.Pins.GetForTasks(r.Context(), user.ID, taskIDs)
+	if err != nil {
+		return nil, err
+	}
+	includes, err := app.loadTaskIncludes(r.Context(), user, taskIDs, app.readInclude(r.URL.Query(), validator.New()))
+	if err != nil {
+		return nil, err
+	}
+
+	render := r.URL.Query().Get("render") == "html"
+	categoryFields := app.readCategoryFields(r.URL.Query(), validator.New())
+	items := make([]taskListItem, len(tasks))
+	for i, task := range tasks {
+		items[i] = taskListItem{Task: app.localTask(user, task), Pinned: pinned[task.ID], taskIncludes: includes[i]}
+		if category, ok := categories[task.CategoryID]; ok {
+			items[i].CategoryDetails = &categoryDetails{category: category, fields: categoryFields}
+		}
+		if render {
+			items[i].Task.RenderDescription()
+		}
+	}
+	return items, nil
+}
+
+// The readOwnedTask() helper reads the task ID from the URL and fetches the matching task, as long as it
+// belongs to the current workspace. If anything goes wrong it sends the appropriate error response itself and
+// returns false, so that handlers for nested resources (e.g. /v1/tasks/:id/subtasks) can simply return.
+func (app *application) readOwnedTask(w http.ResponseWriter, r *http.Request) (*data.Task, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	task, err := app.models.Tasks.GetForWorkspace(r.Context(), id, app.contextGetWorkspace(r).WorkspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return task, true
+}
+
+// The archiveTaskHandler() hides a task from the default list views without deleting it.
+func (app *application) archiveTaskHandler(w http.ResponseWriter, r *http.Request) {
+	app.setTaskArchived(w, r, true)
+}
+
+// The unarchiveTaskHandler() brings an archived task back into the default list views.
+func (app *application) unarchiveTaskHandler(w http.ResponseWriter, r *http.Request) {
+	app.setTaskArchived(w, r, false)
+}
+
+// maxSnooze is the longest a task can be snoozed for.
+const maxSnooze = 365 * 24 * time.Hour
+
+// The snoozeTaskHandler() hides a task from the default list views, and holds back its
+// reminders, for {"duration_minutes": n} or until {"until": time}. A date on its own is
+// midnight in the user's time zone. Snoozing a snoozed task again replaces its snooze.
+func (app *application) snoozeTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		DurationMinutes *int             `json:"duration_minutes"`
+		Until           *data.CustomTime `json:"until"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	now := app.clock()
+	var until time.Time
+	v := validator.New()
+	switch {
+	case input.DurationMinutes != nil && input.Until != nil:
+		v.AddError("until", "must not be given with duration_minutes")
+	case input.DurationMinutes != nil:
+		v.Check(*input.DurationMinutes > 0, "duration_minutes", "must be greater than zero")
+		v.Check(*input.DurationMinutes <= int(maxSnooze/time.Minute), "duration_minutes", "must not be more than a year")
+		until = now.Add(time.Duration(*input.DurationMinutes) * time.Minute)
+	case input.Until != nil:
+		until = time.Time(input.Until.ResolveDate(app.userLocation(app.contextGetUser(r))))
+		v.Check(until.After(now), "until", "must be in the future")
+		v.Check(!until.After(now.Add(maxSnooze)), "until", "must not be more than a year away")
+	default:
+		v.AddError("duration_minutes", "must be provided unless until is")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.setTaskSnoozedUntil(w, r, task, data.CustomTime(until.Truncate(time.Second)))
+}
+
+// The unsnoozeTaskHandler() ends a task's snooze early.
+func (app *application) unsnoozeTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+	app.setTaskSnoozedUntil(w, r, task, data.CustomTime{})
+}
+
+func (app *application) setTaskSnoozedUntil(w http.ResponseWriter, r *http.Request, task *data.Task, until data.CustomTime) {
+	if !time.Time(task.SnoozedUntil).Equal(time.Time(until)) {
+		before := *task
+		task.SnoozedUntil = until
+		err := app.models.Tasks.Update(r.Context(), task)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.publishTaskUpdate(task, task.Status)
+		app.recordTaskUpdate(app.contextGetUser(r).ID, before, task)
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"task": app.localTask(app.contextGetUser(r), task)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The pinTaskHandler() pins a task for the current user, bringing it to the top of their
+// task lists. Pins are personal, so viewers can pin tasks too.
+func (app *application) pinTaskHandler(w http.ResponseWriter, r *http.Request) {
+	app.setTaskPinned(w, r, true)
+}
+
+// The unpinTaskHandler() unpins a task for the current user.
+func (app *application) unpinTaskHandler(w http.ResponseWriter, r *http.Request) {
+	app.setTaskPinned(w, r, false)
+}
+
+func (app *application) setTaskPinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	if pinned {
+		err = app.models.Pins.Pin(r.Context(), app.contextGetUser(r).ID, task.ID)
+	} else {
+		err = app.models.Pins.Unpin(r.Context(), app.contextGetUser(r).ID, task.ID)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	items, err := app.taskListItems(r, task.WorkspaceID, []*data.Task{task})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"task": items[0]}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) setTaskArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	if task.Archived != archived {
+		before := *task
+		task.Archived = archived
+		err := app.models.Tasks.Update(r.Context(), task)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.publishTaskUpdate(task, task.Status)
+		app.recordTaskUpdate(app.contextGetUser(r).ID, before, task)
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"task": app.localTask(app.contextGetUser(r), task)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The duplicateTaskHandler() creates a copy of a task, for work that repeats. The copy starts
+// out as a new task: it is "to-do", at the bottom of its column, and created by the current
+// user. Its subtasks and tags are copied too unless the body turns them off with
+// {"subtasks": false} or {"tags": false}; the body can be left out altogether. A due date
+// that has already passed isn't kept, and the body can give a new one.
+func (app *application) duplicateTaskHandler(w http.ResponseWriter, r *http.Request) {
+	source, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Subtasks *bool        `json:"subtasks"`
+		Tags     *bool        `json:"tags"`
+		DueDate  optionalTime `json:"due_date"`
+	}
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	user := app.contextGetUser(r)
+	task := &data.Task{
+		Title:       source.Title,
+		Description: source.Description,
+		DueDate:     source.DueDate,
+		Priority:    source.Priority,
+		Status:      data.StatusTodo,
+		CategoryID:  source.CategoryID,
+		Category:    source.Category,
+		UserID:      user.ID,
+		WorkspaceID: source.WorkspaceID,
+		Recurrence:  source.Recurrence,
+
+		EstimateMinutes:  source.EstimateMinutes,
+		RemainingMinutes: source.EstimateMinutes,
+		CustomFields:     source.CustomFields,
+	}
+	if task.DueDate.Before(app.clock()) {
+		task.DueDate = data.CustomTime{}
+	}
+	if input.DueDate.set {
+		task.DueDate = input.DueDate.time.ResolveDate(app.userLocation(user))
+	}
+
+	v := validator.New()
+	err := app.validateTask(r.Context(), v, task)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	opts := data.DuplicateOptions{
+		Subtasks: input.Subtasks == nil || *input.Subtasks,
+		Tags:     input.Tags == nil || *input.Tags,
+	}
+	err = app.models.Tasks.Duplicate(r.Context(), source.ID, task, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.publishTaskEvent(task.WorkspaceID, data.EventTaskCreated, task)
+	app.recordAudit(task.UserID, data.AuditTask, task.ID, data.AuditCreate, nil, task)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tasks/%d", task.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"task": app.localTask(user, task)}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The completeTaskHandler() marks a task as completed in one step, for clients that don't
+// want to send a whole update. The workflow rules apply as they do to a regular update,
+// so a task that is blocked by open tasks can't be completed. Completing a task that
+// already is changes nothing, like archiving an archived one.
+func (app *application) completeTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	if task.Status != data.StatusCompleted {
+		before := *task
+		previousStatus := task.Status
+		task.Status = data.StatusCompleted
+		if !app.checkStatusChange(w, r, task, previousStatus) {
+			return
+		}
+		err := app.models.Tasks.Update(r.Context(), task)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.publishTaskUpdate(task, previousStatus)
+		app.recordTaskUpdate(app.contextGetUser(r).ID, before, task)
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"task": app.localTask(app.contextGetUser(r), task)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The reopenTaskHandler() moves a completed task back to "to-do". Regular updates can't
+// take a task out of "completed", so that finished work isn't reopened by accident.
+func (app *application) reopenTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	before := *task
+	previousStatus := task.Status
+	err := task.Reopen()
+	if err != nil {
+		app.invalidTransitionResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Tasks.Update(r.Context(), task)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.publishTaskUpdate(task, previousStatus)
+	app.recordTaskUpdate(app.contextGetUser(r).ID, before, task)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"task": app.localTask(app.contextGetUser(r), task)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The moveTaskHandler reorders a task on the user's board, optionally moving it to another
+// status column. The task is dropped directly above before_id or directly below after_id,
+// or at the bottom of the column if neither is given.
+func (app *application) moveTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Status   *data.TaskStatus `json:"status"`
+		BeforeID int64            `json:"before_id"`
+		AfterID  int64            `json:"after_id"`
+		Version  *int32           `json:"version"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before := *task
+	previousStatus := task.Status
+	move := data.TaskMove{Status: task.Status, BeforeID: input.BeforeID, AfterID: input.AfterID}
+	if input.Status != nil {
+		move.Status = *input.Status
+	}
+
+	v := validator.New()
+	v.Check(validator.In(string(move.Status), data.TaskStatuses...), "status", "must be one of "+strings.Join(data.TaskStatuses, ", "))
+	v.Check(input.BeforeID == 0 || input.AfterID == 0, "before_id", "must not be given together with after_id")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Boards are edited by several people and devices at once, so clients can send the
+	// version they last saw to avoid moving a task that has changed in the meantime.
+	if input.Version != nil && *input.Version != task.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	task.Status = move.Status
+	if !app.checkStatusChange(w, r, task, previousStatus) {
+		return
+	}
+
+	err = app.models.Tasks.Move(r.Context(), task, move)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMoveAnchorNotFound):
+			key := "before_id"
+			if input.AfterID != 0 {
+				key = "after_id"
+			}
+			v.AddError(key, "must be another task in the target column")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.publishTaskUpdate(task, previousStatus)
+	app.recordTaskUpdate(app.contextGetUser(r).ID, before, task)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"task": app.localTask(app.contextGetUser(r), task)}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/events"
+	"github.com/zarinakolybaeva/DoMake/internal/i18n"
+	"github.com/zarinakolybaeva/DoMake/internal/jsonlog"
+	"github.com/zarinakolybaeva/DoMake/internal/tracing"
+)
+
+// newTestApplication returns an application backed by data.NewMockModels(), with the
+// limits that the flags default to.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+
+	var cfg config
+	cfg.env = "development"
+	cfg.security.maxBodyBytes = 1_048_576
+	cfg.security.maxHeaderBytes = 1 << 20
+	cfg.security.maxHeaderCount = 100
+	cfg.filters.maxValues = 100
+	cfg.filters.maxIDs = 100
+	cfg.search.similarity = 0.3
+
+	messages, err := i18n.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	maintenance, err := newMaintenanceMode(cfg, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &application{
+		config:      cfg,
+		logger:      jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		models:      data.NewMockModels(),
+		events:      events.New(),
+		clock:       time.Now,
+		location:    time.UTC,
+		metrics:     newMetrics(nil),
+		tracer:      tracing.New(tracing.Config{}),
+		messages:    messages,
+		done:        make(chan struct{}),
+		maintenance: maintenance,
+	}
+}
+
+// newTestUser adds an activated user with the given permissions and a personal workspace
+// holding an "Inbox" category, and returns an authentication token for them.
+func newTestUser(t *testing.T, app *application, email string, permissions ...string) string {
+	t.Helper()
+	ctx := context.Background()
+
+	user := &data.User{Name: "Test User", Email: email, Activated: true}
+	err := user.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.models.Users.Insert(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	workspace := &data.Workspace{Name: "Personal", Personal: true}
+	err = app.models.Workspaces.Insert(ctx, workspace, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.models.Categories.Insert(ctx, &data.Category{WorkspaceID: workspace.ID, Name: "Inbox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.models.Permissions.AddForUser(ctx, user.ID, permissions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := app.models.Sessions.New(ctx, user.ID, time.Hour, data.ScopeAuthentications, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.Plaintext
+}
+
+// do sends a request through the application's routes and decodes the JSON response.
+func do(t *testing.T, handler http.Handler, method, path, token, body string) (int, map[string]interface{}) {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatalf("%s %s: decoding %q: %v", method, path, w.Body.String(), err)
+	}
+	return w.Code, response
+}
+
+func TestCreateAndShowTask(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.routes()
+	token := newTestUser(t, app, "alice@example.com", "tasks:read", "tasks:write")
+
+	status, response := do(t, handler, http.MethodPost, "/v1/tasks", token, `{"title": "Write the tests", "description": "Create and show a task", "category": "Inbox", "status": "to-do", "priority": "high"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("create: got status %d, want %d: %v", status, http.StatusCreated, response)
+	}
+	created, _ := response["task"].(map[string]interface{})
+	id, _ := created["id"].(float64)
+	if id < 1 {
+		t.Fatalf("create: got task %v, want one with an ID", response["task"])
+	}
+
+	status, response = do(t, handler, http.MethodGet, fmt.Sprintf("/v1/tasks/%d", int64(id)), token, "")
+	if status != http.StatusOK {
+		t.Fatalf("show: got status %d, want %d: %v", status, http.StatusOK, response)
+	}
+	shown, _ := response["task"].(map[string]interface{})
+	if shown["title"] != "Write the tests" || shown["priority"] != "high" {
+		t.Errorf("show: got task %v, want the one that was created", shown)
+	}
+
+	status, response = do(t, handler, http.MethodGet, "/v1/tasks", token, "")
+	if status != http.StatusOK {
+		t.Fatalf("list: got status %d, want %d: %v", status, http.StatusOK, response)
+	}
+	if tasks, _ := response["tasks"].([]interface{}); len(tasks) != 1 {
+		t.Errorf("list: got %d tasks, want 1", len(tasks))
+	}
+
+	// The task isn't in other users' workspaces, and reading tasks needs the tasks:read
+	// permission.
+	other := newTestUser(t, app, "bob@example.com", "tasks:read")
+	status, _ = do(t, handler, http.MethodGet, fmt.Sprintf("/v1/tasks/%d", int64(id)), other, "")
+	if status != http.StatusNotFound {
+		t.Errorf("show by another user: got status %d, want %d", status, http.StatusNotFound)
+	}
+	unprivileged := newTestUser(t, app, "carol@example.com")
+	status, _ = do(t, handler, http.MethodGet, fmt.Sprintf("/v1/tasks/%d", int64(id)), unprivileged, "")
+	if status != http.StatusForbidden {
+		t.Errorf("show without tasks:read: got status %d, want %d", status, http.StatusForbidden)
+	}
+
+	app.wg.Wait()
+}
+
+func TestListTasksCategoryFields(t *testing.T) {
+	app := newTestApplication(t)
+	handler := app.routes()
+	token := newTestUser(t, app, "alice@example.com", "tasks:read", "tasks:write")
+
+	status, response := do(t, handler, http.MethodPost, "/v1/tasks", token, `{"title": "Write the tests", "description": "d", "category": "Inbox", "status": "to-do", "priority": "low"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("create: got status %d, want %d: %v", status, http.StatusCreated, response)
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		fields []string
+	}{
+		{"", http.StatusOK, []string{"id", "name"}},
+		{"?category_fields=name", http.StatusOK, []string{"name"}},
+		{"?category_fields=id,description,version", http.StatusOK, []string{"id", "description", "version"}},
+		{"?category_fields=color", http.StatusUnprocessableEntity, nil},
+	}
+	for _, tt := range tests {
+		status, response := do(t, handler, http.MethodGet, "/v1/tasks"+tt.query, token, "")
+		if status != tt.status {
+			t.Errorf("%q: got status %d, want %d: %v", tt.query, status, tt.status, response)
+			continue
+		}
+		if tt.fields == nil {
+			continue
+		}
+		tasks, _ := response["tasks"].([]interface{})
+		if len(tasks) != 1 {
+			t.Fatalf("%q: got %d tasks, want 1", tt.query, len(tasks))
+		}
+		category, _ := tasks[0].(map[string]interface{})["category_details"].(map[string]interface{})
+		if len(category) != len(tt.fields) {
+			t.Errorf("%q: got category %v, want the fields %v", tt.query, category, tt.fields)
+		}
+		for _, field := range tt.fields {
+			if _, ok := category[field]; !ok {
+				t.Errorf("%q: got category %v, want the fields %v", tt.query, category, tt.fields)
+				break
+			}
+		}
+	}
+
+	app.wg.Wait()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+)
+
+// The now() helper returns the current time from the application clock, converted
+// to the configured default time zone. Handlers should use this rather than calling
+// time.Now() directly so that the clock can be swapped out.
+func (app *application) now() time.Time {
+	return app.clock().In(app.location)
+}
+
+// The userLocation() helper returns the time zone a user's dates are read and written
+// in: the one set in their profile, or else the configured default time zone.
+func (app *application) userLocation(user *data.User) *time.Location {
+	return app.zoneOrDefault(user.Timezone)
+}
+
+// The zoneOrDefault() helper returns the time zone with the given name, or the configured
+// default time zone if the name is empty or unknown.
+func (app *application) zoneOrDefault(name string) *time.Location {
+	if name != "" {
+		loc, err := data.LoadZone(name)
+		if err == nil {
+			return loc
+		}
+	}
+	return app.location
+}
+
+// The localTask() helper returns a task as it is sent to a user: a copy with is_overdue and
+// due_in_seconds worked out as of now, and with the due date converted to the user's time
+// zone if they have set one (otherwise it is written in UTC). The task is copied rather
+// than changed, as it may still be in use by the events and webhooks published about it.
+func (app *application) localTask(user *data.User, task *data.Task) *data.Task {
+	if task == nil {
+		return nil
+	}
+	local := *task
+	local.SetDueStatus(app.clock())
+	if user.Timezone != "" && !task.DueDate.IsZero() {
+		local.DueDate = data.CustomTime(time.Time(task.DueDate).In(app.userLocation(user)))
+	}
+	if user.Timezone != "" && !task.StartDate.IsZero() {
+		local.StartDate = data.CustomTime(time.Time(task.StartDate).In(app.userLocation(user)))
+	}
+	return &local
+}
+
+// The timeHandler() returns the server's idea of "now" and its time zone, so that clients
+// doing relative date math agree with the server on day boundaries. For authenticated
+// users these are in their own time zone.
+func (app *application) timeHandler(w http.ResponseWriter, r *http.Request) {
+	loc := app.userLocation(app.contextGetUser(r))
+	env := envelope{
+		"now":      app.clock().In(loc).Format(time.RFC3339),
+		"timezone": loc.String(),
+	}
+	err := app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// The startTimerHandler starts tracking time on a task. Only one timer can run at a time,
+// so it has to be stopped before another one is started.
+func (app *application) startTimerHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	entry, err := app.models.TimeEntries.Start(r.Context(), task.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTimerRunning):
+			app.errorResponse(w, r, http.StatusConflict, "a timer is already running, stop it before starting another one")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tasks/%d/time-entries/%d", task.ID, entry.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"time_entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) stopTimerHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	entry, err := app.models.TimeEntries.Stop(r.Context(), task.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusConflict, "there is no timer running on this task")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"time_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createTimeEntryHandler records time spent on a task after the fact.
+func (app *application) createTimeEntryHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		StartedAt data.CustomTime  `json:"started_at"`
+		EndedAt   *data.CustomTime `json:"ended_at"`
+		Note      string           `json:"note"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entry := &data.TimeEntry{
+		TaskID:    task.ID,
+		UserID:    app.contextGetUser(r).ID,
+		StartedAt: input.StartedAt,
+		EndedAt:   input.EndedAt,
+		Note:      input.Note,
+	}
+
+	v := validator.New()
+	if data.ValidateTimeEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.TimeEntries.Insert(r.Context(), entry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tasks/%d/time-entries/%d", task.ID, entry.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"time_entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listTimeEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := app.models.TimeEntries.GetAllForTask(r.Context(), task.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.DurationSeconds
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"time_entries": entries, "tracked_seconds": total}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTimeEntryHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	entryID, err := app.readNamedIDParam(r, "entry_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.TimeEntries.Delete(r.Context(), entryID, task.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "time entry successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
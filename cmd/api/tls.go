@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsDomainRX is what the names in -tls-domains look like. Let's Encrypt needs full
+// domain names, without wildcards.
+var tlsDomainRX = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+// The tlsEnabled() method reports whether the server serves HTTPS, with the certificate
+// in -tls-cert and -tls-key or with certificates from Let's Encrypt for -tls-domains.
+func (app *application) tlsEnabled() bool {
+	return app.config.tls.certFile != "" || len(app.config.tls.domains) > 0
+}
+
+// The certManager() method returns the manager that obtains and renews the certificates
+// of -tls-domains from Let's Encrypt, keeping them in -tls-cache-dir so that they survive
+// restarts. It returns nil if the certificate comes from files.
+func (app *application) certManager() *autocert.Manager {
+	if len(app.config.tls.domains) == 0 {
+		return nil
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(app.config.tls.cacheDir),
+		HostPolicy: autocert.HostWhitelist(app.config.tls.domains...),
+		Email:      app.config.tls.email,
+	}
+}
+
+// The tlsConfig() method returns the TLS settings of the server: TLS 1.2 at the least,
+// with only the cipher suites that have forward secrecy and authenticated encryption (TLS
+// 1.3's are always used), and the curves with fast, constant-time implementations. The
+// certificates come from manager when there is one. HTTP/2 is negotiated by net/http.
+func (app *application) tlsConfig(manager *autocert.Manager) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		},
+	}
+	if manager != nil {
+		// The manager's config also answers the TLS-ALPN-01 challenges of Let's Encrypt.
+		acmeConfig := manager.TLSConfig()
+		cfg.GetCertificate = acmeConfig.GetCertificate
+		cfg.NextProtos = acmeConfig.NextProtos
+	}
+	return cfg
+}
+
+// The redirectServer() method returns the server for -tls-redirect-port, which sends
+// plain HTTP requests to the same URL over HTTPS. With certificates from Let's Encrypt it
+// also answers the HTTP-01 challenges, which come in on port 80.
+func (app *application) redirectServer(manager *autocert.Manager) *http.Server {
+	var handler http.Handler = http.HandlerFunc(app.redirectToHTTPS)
+	if manager != nil {
+		handler = manager.HTTPHandler(handler)
+	}
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", app.config.tls.redirectPort),
+		Handler:           handler,
+		IdleTimeout:       time.Minute,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		MaxHeaderBytes:    app.config.security.maxHeaderBytes,
+	}
+}
+
+// The redirectToHTTPS() handler permanently redirects a request to the API's HTTPS port,
+// keeping the method and body of the request.
+func (app *application) redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if app.config.port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(app.config.port))
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/jwt"
 	"github.com/zarinakolybaeva/DoMake/internal/validator"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,6 +18,9 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	var input struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		// Users who require two-factor authentication also send one of these.
+		TOTPCode     string `json:"totp_code"`
+		RecoveryCode string `json:"recovery_code"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -27,13 +35,18 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	// Turn away sign ins for accounts and clients with too many recent failures.
+	if !app.checkLoginThrottle(w, r, input.Email) {
+		return
+	}
 	// Lookup the user record based on the email address. If no matching user was
 	// found, then we call the app.invalidCredentialsResponse() helper to send a 401
 	// Unauthorized response to the client (we will create this helper in a moment).
-	user, err := app.models.Users.GetByEmail(input.Email)
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			app.recordLoginFailure(r, input.Email, nil)
 			app.invalidCredentialsResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -49,20 +62,284 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	// If the passwords don't match, then we call the app.invalidCredentialsResponse()
 	// helper again and return.
 	if !match {
+		app.recordLoginFailure(r, input.Email, user)
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
-	// Otherwise, if the password is correct, we generate a new token with a 24-hour
-	// expiry time and the scope 'authentication'.
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentications)
+	// Users who have turned on the require_two_factor setting need a second factor too.
+	if !app.checkTokenSecondFactor(w, r, user, input.TOTPCode, input.RecoveryCode) {
+		return
+	}
+	app.resetLoginFailures(r, input.Email)
+	// Otherwise, if the password is correct, we generate a new authentication token
+	// (and, in JWT mode, a refresh token).
+	tokens, err := app.newAuthenticationTokens(r, user)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	// Encode the token to JSON and send it in the response along with a 201 Created
+	// Encode the tokens to JSON and send them in the response along with a 201 Created
 	// status code.
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.writeJSON(w, http.StatusCreated, tokens, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// Define the lifetime of activation tokens, and how long a user has to wait before
+// another one can be sent to them.
+const (
+	activationTokenTTL     = 3 * 24 * time.Hour
+	activationResendWindow = 2 * time.Minute
+)
+
+// The createActivationTokenHandler mails a new activation token to a user who hasn't
+// activated their account yet, e.g. because the first one expired. Any older token stops
+// working. A token can only be sent to each address once every activationResendWindow.
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(r.Context(), input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no matching email address found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if user.Deactivated {
+		app.deactivatedAccountResponse(w, r)
+		return
+	}
+	if user.Activated {
+		v.AddError("email", "user has already been activated")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	issued, err := app.models.Tokens.LastIssued(r.Context(), data.ScopeActivation, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if wait := issued.Add(activationResendWindow).Sub(app.now()); wait > 0 {
+		app.activationResendThrottledResponse(w, r, wait)
+		return
+	}
+
+	token, err := app.models.Tokens.Replace(r.Context(), user.ID, activationTokenTTL, data.ScopeActivation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.background(func() {
+		tmplData := map[string]interface{}{
+			"name":  user.Name,
+			"token": token.Plaintext,
+		}
+		err := app.sendMail(r.Context(), user.Email, "token_activation.tmpl", tmplData)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "an email will be sent to you containing activation instructions"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) activationResendThrottledResponse(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	message := fmt.Sprintf("an activation token was sent to this address recently, please try again in %d seconds", seconds)
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// The refreshTokenHandler trades a refresh token for a new access token in JWT mode. The
+// refresh token is replaced as well, and the old one stops working.
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if app.config.jwt.secret == "" {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The refresh token is replaced rather than reused, which also guards against it
+	// being used twice at the same time. The session carries on with the new one.
+	refresh, err := app.models.Sessions.Rotate(r.Context(), data.ScopeRefresh, input.RefreshToken, app.config.jwt.refreshTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// The user is looked up afresh here, so that changes to their account (including
+	// deactivation) show up in the new access token.
+	user, err := app.models.Users.Get(r.Context(), refresh.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	access, err := app.signAccessToken(user, refresh.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": access, "refresh_token": refresh}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The checkTokenSecondFactor() helper asks for a TOTP or recovery code when the user has
+// made two-factor authentication a requirement for new tokens. It sends the error response
+// itself and returns false if the request doesn't pass.
+func (app *application) checkTokenSecondFactor(w http.ResponseWriter, r *http.Request, user *data.User, code, recoveryCode string) bool {
+	settings, err := app.models.Settings.Get(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if !settings.RequireTwoFactor {
+		return true
+	}
+	twoFactor, err := app.models.TwoFactor.Get(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if code == "" && recoveryCode == "" {
+		app.twoFactorRequiredResponse(w, r)
+		return false
+	}
+	ok, err := app.verifySecondFactor(r.Context(), twoFactor, code, recoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if !ok {
+		// Wrong codes count as failed sign ins too, which stops them being guessed.
+		app.recordLoginFailure(r, user.Email, user)
+		app.invalidCredentialsResponse(w, r)
+		return false
+	}
+	return true
+}
+
+// The newAuthenticationTokens() helper starts a new session for a user who has signed in,
+// and issues its tokens. Normally that is a 24-hour token stored in the database. In JWT
+// mode it is a short-lived signed access token plus a refresh token.
+func (app *application) newAuthenticationTokens(r *http.Request, user *data.User) (envelope, error) {
+	if app.config.jwt.secret == "" {
+		token, err := app.models.Sessions.New(r.Context(), user.ID, 24*time.Hour, data.ScopeAuthentications, r.UserAgent(), clientIP(r))
+		if err != nil {
+			return nil, err
+		}
+		return envelope{"authentication_token": token}, nil
+	}
+
+	refresh, err := app.models.Sessions.New(r.Context(), user.ID, app.config.jwt.refreshTTL, data.ScopeRefresh, r.UserAgent(), clientIP(r))
+	if err != nil {
+		return nil, err
+	}
+	access, err := app.signAccessToken(user, refresh.ID)
+	if err != nil {
+		return nil, err
+	}
+	return envelope{"authentication_token": access, "refresh_token": refresh}, nil
+}
+
+// The signAccessToken() helper issues a JWT access token for a user, as part of the
+// session with the given ID.
+func (app *application) signAccessToken(user *data.User, sessionID int64) (*data.Token, error) {
+	now := app.now()
+	claims := jwt.Claims{
+		Subject:     strconv.FormatInt(user.ID, 10),
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(app.config.jwt.accessTTL).Unix(),
+		SessionID:   sessionID,
+		Name:        user.Name,
+		Email:       user.Email,
+		Activated:   user.Activated,
+		Deactivated: user.Deactivated,
+		Timezone:    user.Timezone,
+	}
+	signed, err := jwt.Sign(claims, []byte(app.config.jwt.secret))
+	if err != nil {
+		return nil, err
+	}
+	return &data.Token{Plaintext: signed, Expiry: time.Unix(claims.ExpiresAt, 0)}, nil
+}
+
+// The sessionScope() helper returns the scope of the tokens that back sessions: refresh
+// tokens in JWT mode, and authentication tokens otherwise.
+func (app *application) sessionScope() string {
+	if app.config.jwt.secret != "" {
+		return data.ScopeRefresh
+	}
+	return data.ScopeAuthentications
+}
+
+// The userForToken() helper returns the user that an authentication token belongs to and
+// the ID of its session, or ErrRecordNotFound if the token isn't valid. In JWT mode, JWTs
+// are checked against their signature, and then their session is looked up by the ID in
+// their claims, so that signing out, revoking the session or deactivating the user takes
+// effect straight away rather than when the JWT expires. Tokens issued before JWT mode
+// was turned on keep working until they expire.
+func (app *application) userForToken(r *http.Request, token string) (*data.User, int64, error) {
+	if app.config.jwt.secret != "" && strings.Count(token, ".") == 2 {
+		claims, err := jwt.Parse(token, []byte(app.config.jwt.secret), app.now())
+		if err != nil {
+			return nil, 0, data.ErrRecordNotFound
+		}
+		id, err := strconv.ParseInt(claims.Subject, 10, 64)
+		if err != nil {
+			return nil, 0, data.ErrRecordNotFound
+		}
+		user, err := app.models.Sessions.GetUser(r.Context(), claims.SessionID, id, data.ScopeRefresh)
+		if err != nil {
+			return nil, 0, err
+		}
+		return user, claims.SessionID, nil
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		return nil, 0, data.ErrRecordNotFound
+	}
+	return app.models.Sessions.GetForToken(r.Context(), data.ScopeAuthentications, token)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+)
+
+func TestJWTSessionChecks(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.jwt.secret = "0123456789abcdef0123456789abcdef"
+	app.config.jwt.accessTTL = 15 * time.Minute
+	handler := app.routes()
+	ctx := context.Background()
+
+	newTestUser(t, app, "alice@example.com")
+	user, err := app.models.Users.GetByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signIn starts a session for the user, as the refresh token does, and returns a JWT
+	// access token for it.
+	signIn := func() (string, int64) {
+		t.Helper()
+		refresh, err := app.models.Sessions.New(ctx, user.ID, time.Hour, data.ScopeRefresh, "test", "127.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		access, err := app.signAccessToken(user, refresh.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return access.Plaintext, refresh.ID
+	}
+
+	token, sessionID := signIn()
+	status, _ := do(t, handler, http.MethodGet, "/v1/users/me", token, "")
+	if status != http.StatusOK {
+		t.Fatalf("signed in: got status %d, want %d", status, http.StatusOK)
+	}
+
+	// Revoking the session stops its JWTs working before they expire.
+	err = app.models.Sessions.Delete(ctx, sessionID, user.ID, data.ScopeRefresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ = do(t, handler, http.MethodGet, "/v1/users/me", token, "")
+	if status != http.StatusUnauthorized {
+		t.Errorf("revoked session: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// So does deactivating the user, though the token says they are active.
+	token, _ = signIn()
+	user.Deactivated = true
+	err = app.models.Users.Update(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ = do(t, handler, http.MethodGet, "/v1/users/me", token, "")
+	if status != http.StatusForbidden {
+		t.Errorf("deactivated user: got status %d, want %d", status, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/zarinakolybaeva/DoMake/internal/tracing"
+)
+
+// The traceRequests() middleware starts a server span for every request, continuing the
+// caller's trace if the request has a traceparent header. Handlers pass the request's
+// context to the models, so that their queries show up as children of this span.
+func (app *application) traceRequests(router *httprouter.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if parent, ok := tracing.ParseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = tracing.ContextWithRemoteParent(ctx, parent)
+		}
+		route := routeLabel(router, r)
+		ctx, span := app.tracer.Start(ctx, r.Method+" "+route, tracing.KindServer)
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", r.URL.RequestURI())
+		span.SetAttribute("http.user_agent", r.UserAgent())
+		span.SetAttribute("net.peer.ip", clientIP(r))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", rec.status)
+		if rec.status >= 500 {
+			span.SetError(errorStatus(rec.status))
+		}
+	})
+}
+
+type errorStatus int
+
+func (s errorStatus) Error() string {
+	return http.StatusText(int(s))
+}
+
+// The traceID() helper returns the ID of the request's trace, or "" if it isn't traced.
+func traceID(r *http.Request) string {
+	span := tracing.SpanFromContext(r.Context())
+	if span == nil {
+		return ""
+	}
+	return span.TraceID()
+}
+
+// parseHeaders reads a list of HTTP headers given as "key=value,key=value", like the
+// OTEL_EXPORTER_OTLP_HEADERS environment variable.
+func parseHeaders(s string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, found := strings.Cut(pair, "=")
+		if found && strings.TrimSpace(key) != "" {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/totp"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// totpIssuer is the name authenticator apps show next to the account.
+const totpIssuer = "Taskninja"
+
+// The enrollTwoFactorHandler starts setting up two-factor authentication for the current
+// user. It returns a new TOTP secret and its otpauth:// URI, which authenticator apps can
+// scan as a QR code. The enrolment only takes effect once a code from the app is sent to
+// PUT /v1/users/me/totp/confirmed.
+func (app *application) enrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.models.TwoFactor.Enroll(r.Context(), user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTwoFactorEnabled):
+			app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled, disable it first to enroll again")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"secret": secret, "provisioning_uri": totp.URI(secret, totpIssuer, user.Email)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The confirmTwoFactorHandler finishes enrolment with a code from the authenticator app,
+// and returns the user's recovery codes. These are only shown once.
+func (app *application) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	twoFactor, err := app.models.TwoFactor.Get(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusConflict, "two-factor authentication must be enrolled first")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if twoFactor.Confirmed {
+		app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	ok, err := app.verifySecondFactor(r.Context(), twoFactor, input.Code, "")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		v := validator.New()
+		v.AddError("code", "invalid code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	codes, err := app.models.TwoFactor.Confirm(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.recordAudit(user.ID, data.AuditUser, user.ID, data.AuditUpdate, envelope{"two_factor": false}, envelope{"two_factor": true})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The regenerateRecoveryCodesHandler replaces the current user's recovery codes with a
+// fresh set; the old ones stop working.
+func (app *application) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	twoFactor, ok := app.readConfirmedTwoFactor(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := app.models.TwoFactor.NewRecoveryCodes(r.Context(), twoFactor.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The disableTwoFactorHandler turns two-factor authentication off. It needs a current code
+// (or a recovery code), so that a stolen authentication token isn't enough to remove it.
+func (app *application) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	twoFactor, ok := app.readConfirmedTwoFactor(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ok, err = app.verifySecondFactor(r.Context(), twoFactor, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		v := validator.New()
+		v.AddError("code", "invalid code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.TwoFactor.Delete(r.Context(), twoFactor.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.recordAudit(twoFactor.UserID, data.AuditUser, twoFactor.UserID, data.AuditUpdate, envelope{"two_factor": true}, envelope{"two_factor": false})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication successfully disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readConfirmedTwoFactor() helper fetches the current user's TOTP enrolment, sending a
+// 409 response and returning false unless two-factor authentication is enabled.
+func (app *application) readConfirmedTwoFactor(w http.ResponseWriter, r *http.Request) (*data.TwoFactor, bool) {
+	twoFactor, err := app.models.TwoFactor.Get(r.Context(), app.contextGetUser(r).ID)
+	switch {
+	case err == nil && twoFactor.Confirmed:
+		return twoFactor, true
+	case err == nil || errors.Is(err, data.ErrRecordNotFound):
+		app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is not enabled")
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+	return nil, false
+}
+
+// The verifySecondFactor() helper checks a TOTP code or, failing that, a recovery code.
+// Either one can only be used once.
+func (app *application) verifySecondFactor(ctx context.Context, twoFactor *data.TwoFactor, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := totp.Verify(twoFactor.Secret, code, app.now())
+		if !ok {
+			return false, nil
+		}
+		return app.models.TwoFactor.UseStep(ctx, twoFactor.UserID, step)
+	}
+	if recoveryCode != "" {
+		return app.models.TwoFactor.UseRecoveryCode(ctx, twoFactor.UserID, recoveryCode)
+	}
+	return false, nil
+}
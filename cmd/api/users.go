@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zarinakolybaeva/DoMake/internal/data"
@@ -14,6 +17,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Timezone string `json:"timezone"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -21,8 +25,9 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	user := &data.User{
-		Name:  input.Name,
-		Email: input.Email,
+		Name:     input.Name,
+		Email:    input.Email,
+		Timezone: input.Timezone,
 	}
 
 	err = user.Password.Set(input.Password)
@@ -35,7 +40,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.models.Users.Insert(user)
+	err = app.models.Users.Insert(r.Context(), user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -46,13 +51,12 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	// Add the "movies:read" permission for the new user.
-	err = app.models.Permissions.AddForUser(user.ID, "tasks:read")
+	err = app.setUpNewUser(r.Context(), user)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	token, err := app.models.Tokens.New(r.Context(), user.ID, activationTokenTTL, data.ScopeActivation)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -82,6 +86,38 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	app.writeJSON(w, http.StatusCreated, envelope{"user": res}, nil)
 }
 
+// The setUpNewUser() helper does what every newly inserted user needs, however they signed
+// up: it records the audit entry, grants the default role and creates their personal
+// workspace. Users who are activated already are given their welcome tasks straight away.
+func (app *application) setUpNewUser(ctx context.Context, user *data.User) error {
+	app.recordAudit(user.ID, data.AuditUser, user.ID, data.AuditCreate, nil, user)
+	// New users get the "user" role, which bundles the permissions for their own tasks.
+	err := app.models.Roles.AddForUser(ctx, user.ID, data.RoleUser)
+	if err != nil {
+		return err
+	}
+	// Every user gets a personal workspace, which is used whenever a request doesn't
+	// name another one.
+	err = app.models.Workspaces.Insert(ctx, &data.Workspace{Name: "Personal", Personal: true}, user.ID)
+	if err != nil {
+		return err
+	}
+	if user.Activated {
+		app.seedActivatedUser(ctx, user)
+	}
+	return nil
+}
+
+// The seedActivatedUser() helper gives a user who has just been activated their welcome
+// tasks, if they haven't been given them already. The account is usable whether or not
+// they can be created, so a failure is only logged.
+func (app *application) seedActivatedUser(ctx context.Context, user *data.User) {
+	err := app.seedNewUser(ctx, user)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"user_id": strconv.FormatInt(user.ID, 10)})
+	}
+}
+
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse the plaintext activation token from the request body.
 	var input struct {
@@ -101,22 +137,38 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	// Retrieve the details of the user associated with the token using the
 	// GetForToken() method (which we will create in a minute). If no matching record
 	// is found, then we let the client know that the token they provided is not valid.
-	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
+	user, err := app.models.Users.GetForToken(r.Context(), data.ScopeActivation, input.TokenPlaintext)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid or expired activation token")
+			// Tell an expired token apart, so that the client knows to ask for a new one.
+			expired, err := app.models.Tokens.Expired(r.Context(), data.ScopeActivation, input.TokenPlaintext)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if expired {
+				v.AddError("token", "activation token has expired, request a new one at POST /v1/tokens/activation")
+			} else {
+				v.AddError("token", "invalid activation token")
+			}
 			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	// A deactivated user stays locked out; activation only confirms the email address.
+	if user.Deactivated {
+		app.deactivatedAccountResponse(w, r)
+		return
+	}
 	// Update the user's activation status.
+	before := *user
 	user.Activated = true
 	// Save the updated user record in our database, checking for any edit conflicts in
 	// the same way that we did for our movie records.
-	err = app.models.Users.Update(user)
+	err = app.models.Users.Update(r.Context(), user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -126,9 +178,11 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+	app.recordAudit(user.ID, data.AuditUser, user.ID, data.AuditUpdate, &before, user)
+	app.seedActivatedUser(r.Context(), user)
 	// If everything went successfully, then we delete all activation tokens for the
 	// user.
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	err = app.models.Tokens.DeleteAllForUser(r.Context(), data.ScopeActivation, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -139,3 +193,207 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// The showCurrentUserHandler() returns the profile of the authenticated user, along with
+// their settings, so that a client can set itself up with a single request.
+func (app *application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Users authenticated with a JWT are only as up to date as their token, so the
+	// profile is read from the database.
+	user, err := app.models.Users.Get(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	settings, err := app.models.Settings.Get(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "settings": settings}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The updateCurrentUserHandler() changes the name and time zone of the authenticated user,
+// and the settings given in the settings object, which works like PATCH
+// /v1/users/me/settings. The time zone is an IANA name such as "Europe/Moscow", or "" for
+// the server's default; due dates given as a date alone are read as midnight in it, and
+// due dates in responses are converted to it. In JWT mode, access tokens issued before the
+// change keep the old time zone until they are refreshed.
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.Get(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	settings, err := app.models.Settings.Get(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Name     *string        `json:"name"`
+		Timezone *string        `json:"timezone"`
+		Settings *settingsInput `json:"settings"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before := *user
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	if input.Timezone != nil {
+		user.Timezone = *input.Timezone
+	}
+
+	v := validator.New()
+	data.ValidateUser(v, user)
+	beforeSettings := *settings
+	if input.Settings != nil {
+		sv := validator.New()
+		err = app.applySettings(r.Context(), sv, settings, *input.Settings)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		v.Merge("settings", sv)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if user.Name != before.Name || user.Timezone != before.Timezone {
+		err = app.models.Users.Update(r.Context(), user)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.recordAudit(user.ID, data.AuditUser, user.ID, data.AuditUpdate, &before, user)
+	}
+	if input.Settings != nil {
+		err = app.models.Settings.Save(r.Context(), settings)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.recordAudit(user.ID, data.AuditUser, user.ID, data.AuditUpdate, &beforeSettings, settings)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "settings": settings}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// emailChangeTTL is how long the token confirming a new email address stays valid.
+const emailChangeTTL = 24 * time.Hour
+
+// The changeEmailHandler starts a change of the current user's email address. A token is
+// mailed to the new address, and the account only switches over once it is confirmed with
+// PUT /v1/users/email/confirmed; until then the old address stays in use.
+func (app *application) changeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if strings.EqualFold(input.Email, user.Email) {
+		v.AddError("email", "must be different from your current email address")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	_, err = app.models.Users.GetByEmail(r.Context(), input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "a user with this email address already exists")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	change, err := app.models.EmailChanges.New(r.Context(), user.ID, input.Email, emailChangeTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.background(func() {
+		tmplData := map[string]interface{}{
+			"name":  user.Name,
+			"token": change.Plaintext,
+		}
+		err := app.sendMail(r.Context(), change.Email, "email_change.tmpl", tmplData)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "a confirmation token has been sent to " + change.Email}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The confirmEmailChangeHandler switches an account over to the email address that the
+// confirmation token was sent to. Like account activation, the token is all it needs.
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, previousEmail, err := app.models.EmailChanges.Confirm(r.Context(), input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired confirmation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.recordAudit(user.ID, data.AuditUser, user.ID, data.AuditUpdate, envelope{"email": previousEmail}, envelope{"email": user.Email})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+)
+
+// The API is served under two URL prefixes which share every route and handler. /v1/
+// wraps resources in an envelope, such as {"task": {...}}, and reports errors as
+// {"error": ...}. /v2/ sends resources as they are, moves pagination metadata to headers,
+// and reports errors as RFC 7807 problem details.
+const (
+	apiV1 = 1
+	apiV2 = 2
+)
+
+// v1Deprecation is when /v1/ was deprecated in favour of /v2/, announced in the
+// Deprecation header of every v1 response (RFC 9745).
+var v1Deprecation = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// versionWriter marks the response to a /v2/ request, so that writeJSON() and
+// errorResponse(), which are only handed the ResponseWriter, know which format to use.
+type versionWriter struct {
+	http.ResponseWriter
+	version int
+}
+
+func (vw *versionWriter) Unwrap() http.ResponseWriter {
+	return vw.ResponseWriter
+}
+
+// The apiVersion() helper returns the API version that a response is for. The
+// versionWriter is the first wrapper put around the ResponseWriter, so it is found by
+// unwrapping the ones that the other middleware add.
+func apiVersion(w http.ResponseWriter) int {
+	for {
+		if vw, ok := w.(*versionWriter); ok {
+			return vw.version
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return apiV1
+		}
+		w = u.Unwrap()
+	}
+}
+
+// The versionRequests() middleware serves /v2/ requests with the /v1/ routes, marking
+// their responses for the v2 format. It goes in front of all the other middleware, so
+// that metrics and traces are recorded against the route patterns. Responses to /v1/
+// requests get the Deprecation header, a link to their v2 equivalent and, if -v1-sunset
+// is set, the date from which v1 will be gone.
+func (app *application) versionRequests(next http.Handler) http.Handler {
+	var sunset string
+	if app.config.api.v1Sunset != "" {
+		// The date was checked by validateConfig().
+		t, _ := time.Parse("2006-01-02", app.config.api.v1Sunset)
+		sunset = t.Format(http.TimeFormat)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/v2/"); ok {
+			r.URL.Path = "/v1/" + rest
+			if r.URL.RawPath != "" {
+				r.URL.RawPath = "/v1/" + strings.TrimPrefix(r.URL.RawPath, "/v2/")
+			}
+			next.ServeHTTP(&versionWriter{ResponseWriter: w, version: apiV2}, r)
+			return
+		}
+
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/v1/"); ok {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(v1Deprecation.Unix(), 10))
+			w.Header().Add("Link", fmt.Sprintf(`</v2/%s>; rel="successor-version"`, rest))
+			if sunset != "" {
+				w.Header().Set("Sunset", sunset)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The flattenEnvelope() helper turns the envelope of a v1 response into the body of a v2
+// one. An envelope holding a single resource, or a list along with its pagination
+// metadata, gives way to the resource or list itself, with the metadata in the X-Page,
+// X-Page-Size, X-Last-Page and X-Total-Count headers. Anything else, such as the result
+// of a bulk request, is already a plain object and is sent as it is.
+func flattenEnvelope(h http.Header, env envelope) interface{} {
+	if metadata, ok := env["metadata"].(data.Metadata); ok && len(env) == 2 {
+		h.Set("X-Page", strconv.Itoa(metadata.CurrentPage))
+		h.Set("X-Page-Size", strconv.Itoa(metadata.PageSize))
+		h.Set("X-Last-Page", strconv.Itoa(metadata.LastPage))
+		h.Set("X-Total-Count", strconv.Itoa(metadata.TotalRecords))
+		for key, value := range env {
+			if key != "metadata" {
+				return value
+			}
+		}
+	}
+	if len(env) == 1 {
+		for _, value := range env {
+			return value
+		}
+	}
+	return env
+}
+
+// The versionedBody() helper returns what writeJSON() and writeResponse() should encode
+// for an envelope: the envelope itself for v1, or its flattened form for v2.
+func versionedBody(w http.ResponseWriter, env envelope) interface{} {
+	if apiVersion(w) == apiV2 {
+		return flattenEnvelope(w.Header(), env)
+	}
+	return env
+}
+
+// The requestPath() helper returns the path that the client asked for, which for /v2/
+// requests isn't the one they are routed by.
+func requestPath(w http.ResponseWriter, r *http.Request) string {
+	if apiVersion(w) == apiV2 {
+		return "/v2/" + strings.TrimPrefix(r.URL.Path, "/v1/")
+	}
+	return r.URL.Path
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// The listTaskVersionsHandler returns the saved versions of a task, newest first.
+func (app *application) listTaskVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := app.models.TaskVersions.GetAllForTask(r.Context(), task.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"versions": versions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The revertTaskHandler restores a task to one of its earlier versions. The revert is an
+// edit like any other: it creates a new version, so it can be undone in turn, and it has
+// to pass the same validation and status rules. That means, for example, that a version
+// whose category has since been deleted can't be restored.
+func (app *application) revertTaskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := app.readOwnedTask(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := app.readNamedIDParam(r, "version")
+	if err != nil || version > math.MaxInt32 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	snapshot, err := app.models.TaskVersions.Get(r.Context(), task.ID, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Reverting to the current version leaves nothing to change.
+	if snapshot.Version != task.Version {
+		before := *task
+		previousStatus := task.Status
+		snapshot.Apply(task)
+
+		v := validator.New()
+		err = app.validateTask(r.Context(), v, task)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		if !app.checkStatusChange(w, r, task, previousStatus) {
+			return
+		}
+
+		err = app.models.Tasks.Update(r.Context(), task)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.publishTaskUpdate(task, previousStatus)
+		app.recordTaskUpdate(app.contextGetUser(r).ID, before, task)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"task": app.localTask(app.contextGetUser(r), task)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
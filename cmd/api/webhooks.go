@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/egress"
+	"github.com/zarinakolybaeva/DoMake/internal/tracing"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// webhookClient is used for all outgoing webhook requests. The timeout stops a slow
+// receiver from holding up the deliveries queued behind it. Webhook URLs are chosen by
+// users, so it only connects to public addresses and doesn't follow redirects.
+var webhookClient = egress.NewClient(10 * time.Second)
+
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	webhook := &data.Webhook{
+		UserID: app.contextGetUser(r).ID,
+		URL:    input.URL,
+		Secret: input.Secret,
+		Events: input.Events,
+	}
+	// Subscribe to everything unless told otherwise, and pick a secret for clients that
+	// don't bring their own.
+	if len(webhook.Events) == 0 {
+		webhook.Events = data.WebhookEvents
+	}
+	if webhook.Secret == "" {
+		webhook.Secret, err = data.GenerateWebhookSecret()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Webhooks.Insert(r.Context(), webhook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d", webhook.ID))
+
+	// This is the only time the secret is sent back, so the client must store it now.
+	err = app.writeJSON(w, http.StatusCreated, envelope{"webhook": webhook, "secret": webhook.Secret}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := app.models.Webhooks.GetAllForUser(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhooks": webhooks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		URL    *string  `json:"url"`
+		Events []string `json:"events"`
+		Active *bool    `json:"active"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.URL != nil {
+		webhook.URL = *input.URL
+	}
+	if input.Events != nil {
+		webhook.Events = input.Events
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Webhooks.Update(r.Context(), webhook)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Webhooks.Delete(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "webhook successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The listWebhookDeliveriesHandler() returns the delivery log of a webhook, newest first
+// by default.
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"id", "created_at", "-id", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deliveries, metadata, err := app.models.Webhooks.GetDeliveries(r.Context(), webhook.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readOwnedWebhook() helper reads the webhook ID from the URL and fetches the matching
+// webhook, as long as it belongs to the current user.
+func (app *application) readOwnedWebhook(w http.ResponseWriter, r *http.Request) (*data.Webhook, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	webhook, err := app.models.Webhooks.Get(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return webhook, true
+}
+
+// The startWebhookDispatcher() method starts a background job which sends queued webhook
+// deliveries, retrying failed ones with exponential backoff.
+func (app *application) startWebhookDispatcher() {
+	app.backgroundTicker("webhooks", app.config.webhooks.interval, func() {
+		err := app.dispatchWebhooks()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+func (app *application) dispatchWebhooks() error {
+	deliveries, err := app.models.Webhooks.GetDueDeliveries(context.Background(), app.now(), 50)
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		select {
+		case <-app.done:
+			return nil
+		default:
+		}
+
+		statusCode, sendErr := app.sendWebhook(delivery)
+		delivery.LastStatusCode = statusCode
+		delivery.LastError = ""
+		switch {
+		case sendErr == nil:
+			delivery.Status = data.DeliverySucceeded
+		case delivery.Attempts+1 >= data.MaxDeliveryAttempts:
+			delivery.Status = data.DeliveryFailed
+			delivery.LastError = sendErr.Error()
+		default:
+			delivery.Status = data.DeliveryPending
+			delivery.LastError = sendErr.Error()
+			delivery.NextAttemptAt = data.CustomTime(app.now().Add(webhookBackoff(delivery.Attempts + 1)))
+		}
+
+		err = app.models.Webhooks.RecordAttempt(context.Background(), delivery)
+		if err != nil {
+			return err
+		}
+		if delivery.Status == data.DeliveryFailed {
+			app.logger.PrintError(sendErr, map[string]string{"webhook_delivery_id": strconv.FormatInt(delivery.ID, 10)})
+			app.notify(&data.Notification{
+				UserID:    delivery.UserID,
+				Kind:      data.NotificationWebhookFailed,
+				Message:   fmt.Sprintf("delivery of a %s event to %s failed after %d attempts", delivery.Event, delivery.URL, delivery.Attempts),
+				WebhookID: &delivery.WebhookID,
+			})
+		}
+	}
+	return nil
+}
+
+// webhookBackoff returns how long to wait before the next attempt, after the given number
+// of failed attempts: 30s, 1m, 2m, 4m and so on, capped at six hours.
+func webhookBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second
+	for i := 1; i < attempts && backoff < 6*time.Hour; i++ {
+		backoff *= 2
+	}
+	if backoff > 6*time.Hour {
+		backoff = 6 * time.Hour
+	}
+	return backoff
+}
+
+// sendWebhook POSTs a delivery's payload to its webhook. The body is signed with the
+// webhook's secret (HMAC-SHA256, hex encoded, in the X-Webhook-Signature header) so that
+// the receiver can verify it. Any non-2xx response counts as a failure. Each attempt is
+// traced, and the receiver is sent the trace context in the traceparent header.
+func (app *application) sendWebhook(delivery *data.WebhookDelivery) (statusCode int, err error) {
+	_, span := app.tracer.Start(context.Background(), "webhook.deliver", tracing.KindClient)
+	defer func() {
+		span.SetAttribute("http.status_code", statusCode)
+		span.SetError(err)
+		span.End()
+	}()
+	span.SetAttribute("webhook.event", delivery.Event)
+	span.SetAttribute("webhook.delivery_id", delivery.ID)
+
+	mac := hmac.New(sha256.New, []byte(delivery.Secret))
+	mac.Write(delivery.Payload)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Taskninja-Webhooks/"+version)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Webhook-Signature", "sha256="+signature)
+	req.Header.Set("traceparent", span.SpanContext().Traceparent())
+
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// Drain (a bounded amount of) the body so that the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("webhook responded with status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
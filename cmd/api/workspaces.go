@@ -0,0 +1,379 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// invitationTTL is how long an invitation to a workspace stays valid.
+const invitationTTL = 7 * 24 * time.Hour
+
+func (app *application) createWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	workspace := &data.Workspace{Name: input.Name}
+
+	v := validator.New()
+	if data.ValidateWorkspace(v, workspace); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Workspaces.Insert(r.Context(), workspace, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/workspaces/%d", workspace.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"workspace": workspace}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWorkspacesHandler(w http.ResponseWriter, r *http.Request) {
+	workspaces, err := app.models.Workspaces.GetAllForUser(r.Context(), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspaces": workspaces}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.readWorkspace(w, r, data.RoleViewer)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"workspace": workspace}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.readWorkspace(w, r, data.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name *string `json:"name"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		workspace.Name = *input.Name
+	}
+
+	v := validator.New()
+	if data.ValidateWorkspace(v, workspace); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Workspaces.Update(r.Context(), workspace)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspace": workspace}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The deleteWorkspaceHandler removes a shared workspace together with its tasks and
+// categories.
+func (app *application) deleteWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.readWorkspace(w, r, data.RoleOwner)
+	if !ok {
+		return
+	}
+
+	err := app.models.Workspaces.Delete(r.Context(), workspace.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPersonalWorkspace):
+			app.errorResponse(w, r, http.StatusConflict, "a personal workspace can't be deleted")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "workspace successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWorkspaceMembersHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.readWorkspace(w, r, data.RoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := app.models.Workspaces.GetMembers(r.Context(), workspace.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateWorkspaceMemberHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, member, ok := app.readWorkspaceMember(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateRole(v, input.Role); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Workspaces.SetMemberRole(r.Context(), workspace.ID, member.UserID, input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrLastOwner):
+			app.errorResponse(w, r, http.StatusConflict, "a workspace must keep at least one owner")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	member.Role = input.Role
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The removeWorkspaceMemberHandler takes a member out of a workspace. Owners can remove
+// anyone, and any member can remove themselves to leave the workspace.
+func (app *application) removeWorkspaceMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readNamedIDParam(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	role := data.RoleOwner
+	if userID == app.contextGetUser(r).ID {
+		role = data.RoleViewer
+	}
+	workspace, ok := app.readWorkspace(w, r, role)
+	if !ok {
+		return
+	}
+	if workspace.Personal {
+		app.errorResponse(w, r, http.StatusConflict, "a personal workspace can't be left")
+		return
+	}
+
+	_, err = app.models.Workspaces.GetMember(r.Context(), workspace.ID, userID)
+	if err == nil {
+		err = app.models.Workspaces.RemoveMember(r.Context(), workspace.ID, userID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLastOwner):
+			app.errorResponse(w, r, http.StatusConflict, "a workspace must keep at least one owner")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createInvitationHandler invites someone to a workspace by email address. The
+// response carries the invitation token, which the invited user sends to
+// PUT /v1/invitations/accepted once they have an account with that address.
+func (app *application) createInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.readWorkspace(w, r, data.RoleOwner)
+	if !ok {
+		return
+	}
+	if workspace.Personal {
+		app.errorResponse(w, r, http.StatusConflict, "a personal workspace can't be shared")
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Role == "" {
+		input.Role = data.RoleMember
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	if data.ValidateRole(v, input.Role); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	invitation, err := app.models.Workspaces.NewInvitation(r.Context(), workspace.ID, input.Email, input.Role, app.contextGetUser(r).ID, invitationTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrAlreadyMember):
+			v.AddError("email", "is already a member of this workspace")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"invitation": invitation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The acceptInvitationHandler adds the current user to the workspace they were invited
+// to.
+func (app *application) acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	member, err := app.models.Workspaces.AcceptInvitation(r.Context(), input.TokenPlaintext, app.contextGetUser(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired invitation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrAlreadyMember):
+			app.errorResponse(w, r, http.StatusConflict, "you are already a member of this workspace")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspace_id": member.WorkspaceID, "member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readWorkspace() helper fetches the workspace named by the :id URL parameter, as long
+// as the current user is a member with at least the given role. Like readOwnedTask(), it
+// sends the error response itself and returns false if anything goes wrong.
+func (app *application) readWorkspace(w http.ResponseWriter, r *http.Request, role string) (*data.Workspace, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	workspace, err := app.models.Workspaces.GetForUser(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	if !data.RoleAllows(workspace.Role, role) {
+		app.notPermittedResponses(w, r)
+		return nil, false
+	}
+	return workspace, true
+}
+
+// The readWorkspaceMember() helper fetches a workspace owned by the current user and the
+// member named by the :user_id URL parameter.
+func (app *application) readWorkspaceMember(w http.ResponseWriter, r *http.Request) (*data.Workspace, *data.Member, bool) {
+	workspace, ok := app.readWorkspace(w, r, data.RoleOwner)
+	if !ok {
+		return nil, nil, false
+	}
+	userID, err := app.readNamedIDParam(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+	member, err := app.models.Workspaces.GetMember(r.Context(), workspace.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+	return workspace, member, true
+}
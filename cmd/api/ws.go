@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/data"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+	"github.com/zarinakolybaeva/DoMake/internal/websocket"
+)
+
+// socketPingInterval is how often the server pings a sync connection. A client that
+// stays silent for two intervals is considered gone.
+const socketPingInterval = 30 * time.Second
+
+// socketRequest is a message sent by the client on the sync channel. request_id is
+// chosen by the client and echoed in the reply, so that replies can be matched up.
+type socketRequest struct {
+	Type       string          `json:"type"`
+	RequestID  string          `json:"request_id"`
+	Operations []bulkOperation `json:"operations"`
+}
+
+// socketMessage is a message sent by the server on the sync channel: a task event, the
+// result of a batch of mutations, a pong or an error.
+type socketMessage struct {
+	Type       string       `json:"type"`
+	RequestID  string       `json:"request_id,omitempty"`
+	ID         uint64       `json:"id,omitempty"`
+	Event      string       `json:"event,omitempty"`
+	OccurredAt string       `json:"occurred_at,omitempty"`
+	Task       interface{}  `json:"task,omitempty"`
+	Committed  *bool        `json:"committed,omitempty"`
+	Results    []bulkResult `json:"results,omitempty"`
+	Error      interface{}  `json:"error,omitempty"`
+}
+
+// The syncSocketHandler() upgrades the request to a WebSocket connection. The server
+// pushes the user's task events down it (as with GET /v1/tasks/events), and the client
+// can send batches of mutations up it, which are applied exactly like POST /v1/tasks/bulk:
+//
+//	{"type": "mutations", "request_id": "1", "operations": [{"op": "status", "id": 7, "status": "completed"}]}
+//	{"type": "ping", "request_id": "2"}
+func (app *application) syncSocketHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		switch {
+		case errors.Is(err, websocket.ErrBadHandshake):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.logError(r, err)
+		}
+		return
+	}
+	defer conn.Close()
+	conn.ReadTimeout = 2 * socketPingInterval
+
+	user := app.contextGetUser(r)
+	// Sockets opened with an API key can only make changes if the key allows writing.
+	key := app.contextGetAPIKey(r)
+	readOnly := key != nil && !key.Permissions.Include("tasks:write")
+	sub := app.events.Subscribe(user.ID)
+	defer sub.Close()
+
+	// Read client messages in their own goroutine, so that events can be pushed while
+	// we wait. The channel is closed when the connection goes away.
+	incoming := make(chan []byte)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(incoming)
+		for {
+			msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			select {
+			case incoming <- msg:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(socketPingInterval)
+	defer ping.Stop()
+
+	for {
+		var reply socketMessage
+		select {
+		case event, ok := <-sub.C:
+			// The bus closes subscriptions when the server is shutting down.
+			if !ok {
+				conn.CloseWithStatus(websocket.CloseGoingAway)
+				return
+			}
+			reply = socketMessage{
+				Type:       "event",
+				ID:         event.ID,
+				Event:      event.Type,
+				OccurredAt: event.OccurredAt.Format(time.RFC3339),
+				Task:       event.Data,
+			}
+		case msg, ok := <-incoming:
+			if !ok {
+				return
+			}
+			reply = app.handleSocketRequest(r.Context(), user, app.contextGetWorkspace(r), readOnly, msg)
+		case <-ping.C:
+			if conn.Ping() != nil {
+				return
+			}
+			continue
+		}
+
+		js, err := json.Marshal(reply)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+		if conn.WriteMessage(js) != nil {
+			return
+		}
+	}
+}
+
+func (app *application) handleSocketRequest(ctx context.Context, user *data.User, member *data.Member, readOnly bool, msg []byte) socketMessage {
+	var req socketRequest
+	err := json.Unmarshal(msg, &req)
+	if err != nil {
+		return socketMessage{Type: "error", Error: "message contains badly-formed JSON"}
+	}
+
+	switch req.Type {
+	case "ping":
+		return socketMessage{Type: "pong", RequestID: req.RequestID}
+	case "mutations":
+		// The socket is opened with read access, so viewers can follow along but
+		// only members may change tasks.
+		if !data.RoleAllows(member.Role, data.RoleMember) {
+			return socketMessage{Type: "error", RequestID: req.RequestID, Error: "your workspace role doesn't allow changing tasks"}
+		}
+		if readOnly {
+			return socketMessage{Type: "error", RequestID: req.RequestID, Error: "your API key doesn't allow changing tasks"}
+		}
+		v := validator.New()
+		if validateBulkOperations(v, req.Operations); !v.Valid() {
+			return socketMessage{Type: "error", RequestID: req.RequestID, Error: v.Errors}
+		}
+		results, committed, err := app.runBulk(ctx, user, member.WorkspaceID, req.Operations)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return socketMessage{Type: "error", RequestID: req.RequestID, Error: "the server encountered a problem and could not process your request"}
+		}
+		return socketMessage{Type: "result", RequestID: req.RequestID, Committed: &committed, Results: results}
+	default:
+		return socketMessage{Type: "error", RequestID: req.RequestID, Error: "type must be one of mutations or ping"}
+	}
+}
+
+// The authenticateQueryToken() middleware lets a client pass its authentication token as
+// ?token= instead of in the Authorization header. Browsers can't set headers on a
+// WebSocket handshake, so this is only used for the sync channel.
+func (app *application) authenticateQueryToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" || !app.contextGetUser(r).IsAnonymous() {
+			next(w, r)
+			return
+		}
+
+		user, sessionID, err := app.userForToken(r, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		next(w, app.contextSetSession(app.contextSetUser(r, user), sessionID))
+	}
+}
@@ -0,0 +1,120 @@
+// Package avatar turns uploaded pictures into user avatars. It checks that an upload is
+// a PNG, JPEG or GIF image of reasonable dimensions, crops it to a square around its
+// centre, and scales that to each of the standard sizes, encoded as PNG.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/png"
+
+	// Register the GIF and JPEG decoders with image.Decode().
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+// Sizes are the widths, and heights, in pixels, that avatars are stored in. Each is half
+// of the next, so that the smaller ones can be scaled from the larger ones.
+var Sizes = []int{32, 64, 128, 256}
+
+// IsSize reports whether size is one of Sizes.
+func IsSize(size int) bool {
+	for _, s := range Sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultSize is the size served when none is asked for.
+const DefaultSize = 128
+
+// MaxDimension is the largest width or height an upload may have. Decoding allocates
+// memory for every pixel, so this is checked before an image is decoded.
+const MaxDimension = 4096
+
+var (
+	ErrUnsupportedFormat = errors.New("avatar: not a PNG, JPEG or GIF image")
+	ErrTooLarge          = errors.New("avatar: image is too large")
+)
+
+// Resize decodes an uploaded image and returns it as a square avatar in each of Sizes,
+// encoded as PNG and keyed by size.
+func Resize(upload []byte) (map[int][]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(upload))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(upload))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	// Copy the centre square into an RGBA image, whose pixels can be read directly.
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	if side == 0 {
+		return nil, ErrUnsupportedFormat
+	}
+	origin := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), img, origin, draw.Src)
+
+	images := make(map[int][]byte, len(Sizes))
+	scaled := square
+	for i := len(Sizes) - 1; i >= 0; i-- {
+		scaled = scale(scaled, Sizes[i])
+		var buf bytes.Buffer
+		err = png.Encode(&buf, scaled)
+		if err != nil {
+			return nil, err
+		}
+		images[Sizes[i]] = buf.Bytes()
+	}
+	return images, nil
+}
+
+// scale resizes a square image to size by size pixels. Each pixel of the result is the
+// average of the pixels of src it covers, or when enlarging, the pixel it falls on.
+func scale(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := span(y, side, size)
+		for x := 0; x < size; x++ {
+			x0, x1 := span(x, side, size)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for c := range sum {
+				dst.Pix[offset+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// span returns the range of source pixels, out of side, covered by pixel i of size.
+func span(i, side, size int) (int, int) {
+	start := i * side / size
+	end := (i + 1) * side / size
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
@@ -0,0 +1,12 @@
+// Package cache stores encoded values by key for a limited time, either in memory or in
+// Redis. Entries are never updated in place: callers build keys which change whenever the
+// value would, so a stale entry is simply never asked for again and ages out.
+package cache
+
+// Cache is a key-value store whose entries may disappear at any time, whether they expire
+// or are evicted to make room.
+type Cache interface {
+	// Get returns the value stored under key, and false if there isn't one.
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte) error
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory cache holding up to a fixed number of entries. When it is full, the
+// least recently used entry is evicted.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // Most recently used at the front.
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU returns an in-memory cache of at most size entries, each of which expires ttl
+// after it was set.
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRU) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.entries[key]
+	if !found {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+func (c *LRU) Set(key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &lruEntry{key: key, value: value, expires: time.Now().Add(c.ttl)}
+	if elem, found := c.entries[key]; found {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
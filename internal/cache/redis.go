@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/redis"
+)
+
+// Redis keeps the cache in Redis, so that every API instance using the same server
+// shares it. Eviction is left to the server's maxmemory policy.
+type Redis struct {
+	client *redis.Client
+	ttl    time.Duration
+	// prefix namespaces the keys, in case the Redis server is shared with other uses.
+	prefix string
+}
+
+// NewRedis returns a cache kept on the given Redis server, whose entries expire ttl after
+// they were set.
+func NewRedis(client *redis.Client, ttl time.Duration) *Redis {
+	return &Redis{client: client, ttl: ttl, prefix: "cache:"}
+}
+
+func (c *Redis) Get(key string) ([]byte, bool, error) {
+	reply, err := c.client.Do("GET", c.prefix+key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, _ := reply.(string)
+	return []byte(value), true, nil
+}
+
+func (c *Redis) Set(key string, value []byte) error {
+	_, err := c.client.Do("SET", c.prefix+key, string(value), "PX", strconv.FormatInt(c.ttl.Milliseconds(), 10))
+	return err
+}
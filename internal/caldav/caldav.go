@@ -0,0 +1,275 @@
+// Package caldav reads and writes the XML bodies of WebDAV (RFC 4918) and CalDAV
+// (RFC 4791) requests: PROPFIND and REPORT requests, and the multistatus responses to
+// them. Which resources and properties there are is up to the caller.
+package caldav
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// The XML namespaces of the properties. CalendarServer's is only used for getctag, which
+// many clients check to tell whether anything in a calendar has changed.
+const (
+	NamespaceDAV            = "DAV:"
+	NamespaceCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	NamespaceCalendarServer = "http://calendarserver.org/ns/"
+)
+
+// prefixes are the namespace prefixes used in responses. Properties in other namespaces,
+// which are only ever reported as missing, declare their namespace themselves.
+var prefixes = map[string]string{
+	NamespaceDAV:            "d",
+	NamespaceCalDAV:         "c",
+	NamespaceCalendarServer: "cs",
+}
+
+// DAV returns the name of a property in the DAV: namespace, CalDAV the name of one in
+// the CalDAV namespace.
+func DAV(local string) xml.Name    { return xml.Name{Space: NamespaceDAV, Local: local} }
+func CalDAV(local string) xml.Name { return xml.Name{Space: NamespaceCalDAV, Local: local} }
+
+// maxBodyBytes is the largest PROPFIND or REPORT body that is read.
+const maxBodyBytes = 1 << 20
+
+// ErrInvalidBody is returned for request bodies that aren't the XML they should be.
+var ErrInvalidBody = errors.New("caldav: invalid XML body")
+
+// Propfind is a PROPFIND request: either all properties, or only the ones named.
+type Propfind struct {
+	AllProp bool
+	Props   []xml.Name
+}
+
+type element struct {
+	XMLName xml.Name
+}
+
+type propList struct {
+	Names []element `xml:",any"`
+}
+
+func (p *propList) names() []xml.Name {
+	if p == nil {
+		return nil
+	}
+	names := make([]xml.Name, len(p.Names))
+	for i, e := range p.Names {
+		names[i] = e.XMLName
+	}
+	return names
+}
+
+// ReadPropfind reads the body of a PROPFIND request. An empty body asks for all
+// properties, like <allprop/>.
+func ReadPropfind(r io.Reader) (*Propfind, error) {
+	var body struct {
+		XMLName  xml.Name  `xml:"DAV: propfind"`
+		AllProp  *struct{} `xml:"DAV: allprop"`
+		PropName *struct{} `xml:"DAV: propname"`
+		Prop     *propList `xml:"DAV: prop"`
+	}
+	empty, err := decode(r, &body)
+	if err != nil {
+		return nil, err
+	}
+	if empty || body.Prop == nil {
+		return &Propfind{AllProp: true}, nil
+	}
+	return &Propfind{Props: body.Prop.names()}, nil
+}
+
+// Report is a calendar-query or calendar-multiget REPORT request. Hrefs are the resources
+// asked for by a calendar-multiget; Components lists the components named by the
+// comp-filters of a calendar-query, outermost first, e.g. VCALENDAR, VTODO. Other
+// filters aren't read, so a query may return more than it asked for, which RFC 4791
+// leaves clients to cope with.
+type Report struct {
+	Name       xml.Name
+	Props      []xml.Name
+	Hrefs      []string
+	Components []string
+}
+
+type compFilter struct {
+	Name  string       `xml:"name,attr"`
+	Comps []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// ReadReport reads the body of a REPORT request.
+func ReadReport(r io.Reader) (*Report, error) {
+	var body struct {
+		XMLName xml.Name
+		Prop    *propList `xml:"DAV: prop"`
+		Hrefs   []string  `xml:"DAV: href"`
+		Filter  *struct {
+			Comp *compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+		} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	}
+	empty, err := decode(r, &body)
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		return nil, ErrInvalidBody
+	}
+
+	report := &Report{Name: body.XMLName, Props: body.Prop.names(), Hrefs: body.Hrefs}
+	if body.Filter != nil {
+		for comp := body.Filter.Comp; comp != nil; {
+			report.Components = append(report.Components, strings.ToUpper(comp.Name))
+			if len(comp.Comps) == 0 {
+				break
+			}
+			comp = &comp.Comps[0]
+		}
+	}
+	return report, nil
+}
+
+// decode reads an XML body into v, reporting whether it was empty.
+func decode(r io.Reader, v interface{}) (empty bool, err error) {
+	br := bufio.NewReader(io.LimitReader(r, maxBodyBytes))
+	if _, err := br.Peek(1); err == io.EOF {
+		return true, nil
+	}
+	err = xml.NewDecoder(br).Decode(v)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidBody, err)
+	}
+	return false, nil
+}
+
+// Prop is a property and its value, as XML ready to be written inside the property's
+// element.
+type Prop struct {
+	Name  xml.Name
+	Inner string
+}
+
+// Text returns a property whose value is text.
+func Text(name xml.Name, value string) Prop {
+	return Prop{Name: name, Inner: escape(value)}
+}
+
+// Href returns a property whose value is a DAV:href, such as current-user-principal.
+func Href(name xml.Name, href string) Prop {
+	return Prop{Name: name, Inner: "<d:href>" + escape(href) + "</d:href>"}
+}
+
+// Elements returns a property whose value is a list of empty elements, such as the
+// resourcetype of a calendar, <d:collection/><c:calendar/>.
+func Elements(name xml.Name, elements ...xml.Name) Prop {
+	var b strings.Builder
+	for _, e := range elements {
+		b.WriteString("<" + qualified(e) + "/>")
+	}
+	return Prop{Name: name, Inner: b.String()}
+}
+
+// Raw returns a property whose value is already XML, using the d, c and cs prefixes.
+func Raw(name xml.Name, inner string) Prop {
+	return Prop{Name: name, Inner: inner}
+}
+
+// Response is one resource in a multistatus response. Status is set for resources that
+// couldn't be found or read, and then the properties are left out; otherwise Props are
+// the properties that were found and Missing the ones that weren't.
+type Response struct {
+	Href    string
+	Status  int
+	Props   []Prop
+	Missing []xml.Name
+}
+
+// Select fills in a response from the properties a resource has: all of them for an
+// allprop request, or else the ones asked for, with the others listed as missing.
+func (resp *Response) Select(available []Prop, propfind *Propfind) {
+	if propfind.AllProp {
+		resp.Props = append(resp.Props, available...)
+		return
+	}
+	for _, name := range propfind.Props {
+		found := false
+		for _, p := range available {
+			if p.Name == name {
+				resp.Props = append(resp.Props, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			resp.Missing = append(resp.Missing, name)
+		}
+	}
+}
+
+// WriteMultistatus writes a 207 Multi-Status response.
+func WriteMultistatus(w http.ResponseWriter, responses []Response) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+	for _, resp := range responses {
+		b.WriteString("<d:response><d:href>" + escape(resp.Href) + "</d:href>")
+		if resp.Status != 0 {
+			b.WriteString(status(resp.Status))
+		}
+		if len(resp.Props) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, p := range resp.Props {
+				b.WriteString("<" + qualified(p.Name) + ">" + p.Inner + "</" + prefixed(p.Name) + ">")
+			}
+			b.WriteString("</d:prop>" + status(http.StatusOK) + "</d:propstat>")
+		}
+		if len(resp.Missing) > 0 {
+			b.WriteString("<d:propstat><d:prop>")
+			for _, name := range resp.Missing {
+				b.WriteString("<" + qualified(name) + "/>")
+			}
+			b.WriteString("</d:prop>" + status(http.StatusNotFound) + "</d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+	b.WriteString("</d:multistatus>")
+
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusMultiStatus)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func status(code int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", code, http.StatusText(code))
+}
+
+// prefixed returns the name of an element with its namespace prefix, e.g. d:getetag.
+// Elements in other namespaces use the x prefix, declared by qualified().
+func prefixed(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	if prefix, ok := prefixes[name.Space]; ok {
+		return prefix + ":" + name.Local
+	}
+	return "x:" + name.Local
+}
+
+// qualified returns the opening of an element, declaring its namespace if it has no
+// prefix of its own.
+func qualified(name xml.Name) string {
+	if _, ok := prefixes[name.Space]; ok || name.Space == "" {
+		return prefixed(name)
+	}
+	return prefixed(name) + ` xmlns:x="` + escape(name.Space) + `"`
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
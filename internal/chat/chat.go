@@ -0,0 +1,61 @@
+// Package chat sends short text messages to chat services, for users who want their
+// reminders there as well as by email.
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/egress"
+)
+
+// Sender sends messages to one chat, channel or conversation of a chat service.
+type Sender interface {
+	Send(ctx context.Context, text string) error
+}
+
+// ErrUnreachable is returned, with the service's name, when a chat service can't be
+// reached at all. The network error is left out, since the errors are shown to users and
+// would tell them about the server's network.
+var ErrUnreachable = errors.New("the service could not be reached")
+
+// client is shared by the senders. The services get ten seconds to accept a message. It
+// only connects to public addresses, like the webhook client.
+var client = egress.NewClient(10 * time.Second)
+
+// post sends body as JSON to a chat service's API. Any non-2xx response is an error, which
+// includes the start of the response body, where the services explain what was wrong.
+// The URL is left out of errors, since it holds the user's credentials: the Slack webhook
+// URL is a secret, and the Telegram bot token is part of the URL.
+func post(ctx context.Context, service, apiURL string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("%s: invalid URL", service)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", service, ErrUnreachable)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s: %s", service, res.Status, strings.TrimSpace(string(body)))
+	}
+	// Drain (a bounded amount of) the body so that the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+	return nil
+}
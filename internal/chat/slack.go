@@ -0,0 +1,16 @@
+package chat
+
+import "context"
+
+// Slack posts messages with a Slack incoming webhook, to the channel it was created for.
+type Slack struct {
+	webhookURL string
+}
+
+func NewSlack(webhookURL string) *Slack {
+	return &Slack{webhookURL: webhookURL}
+}
+
+func (s *Slack) Send(ctx context.Context, text string) error {
+	return post(ctx, "slack", s.webhookURL, map[string]string{"text": text})
+}
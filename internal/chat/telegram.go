@@ -0,0 +1,24 @@
+package chat
+
+import "context"
+
+// telegramAPI is the Telegram Bot API's base URL.
+const telegramAPI = "https://api.telegram.org"
+
+// Telegram sends messages from a Telegram bot to a chat it is a member of.
+type Telegram struct {
+	botToken string
+	chatID   string
+}
+
+func NewTelegram(botToken, chatID string) *Telegram {
+	return &Telegram{botToken: botToken, chatID: chatID}
+}
+
+func (t *Telegram) Send(ctx context.Context, text string) error {
+	body := map[string]string{
+		"chat_id": t.chatID,
+		"text":    text,
+	}
+	return post(ctx, "telegram", telegramAPI+"/bot"+t.botToken+"/sendMessage", body)
+}
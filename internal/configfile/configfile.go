@@ -0,0 +1,141 @@
+// Package configfile reads settings files written in a small subset of YAML: nested
+// mappings of scalar values, with comments. Nested keys are flattened into one name
+// joined with dashes, so that
+//
+//	db:
+//	  dsn: postgres://localhost/taskninja
+//	  max-open-conns: 25
+//
+// gives the settings "db-dsn" and "db-max-open-conns", matching the command-line flags.
+// Underscores in keys are read as dashes. Sequences, anchors and multi-line strings
+// aren't supported.
+package configfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ParseFile reads the settings in the file at path.
+func ParseFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	settings, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Parse reads settings from r, returning them by their flattened name.
+func Parse(r io.Reader) (map[string]string, error) {
+	type parent struct {
+		indent int
+		name   string
+	}
+	var (
+		settings = make(map[string]string)
+		parents  []parent
+		lineNo   int
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		line := stripComment(scanner.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		content := strings.TrimLeft(line, " ")
+		indent := len(line) - len(content)
+		if strings.HasPrefix(content, "\t") {
+			return nil, fmt.Errorf("line %d: tabs can't be used for indentation", lineNo)
+		}
+		if strings.HasPrefix(content, "-") {
+			return nil, fmt.Errorf("line %d: lists aren't supported, write the value as the flag expects it", lineNo)
+		}
+
+		key, value, found := strings.Cut(content, ":")
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		if !found || key == "" {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", lineNo)
+		}
+
+		// Drop the mappings that this line is no longer nested inside.
+		for len(parents) > 0 && parents[len(parents)-1].indent >= indent {
+			parents = parents[:len(parents)-1]
+		}
+		name := key
+		if len(parents) > 0 {
+			name = parents[len(parents)-1].name + "-" + key
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			// The start of a nested mapping.
+			parents = append(parents, parent{indent: indent, name: name})
+			continue
+		}
+		value, err := unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if _, exists := settings[name]; exists {
+			return nil, fmt.Errorf("line %d: %s is set more than once", lineNo, name)
+		}
+		settings[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// stripComment removes a # comment from the end of a line. A # only starts a comment at
+// the beginning of the line or after a space, and not inside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				// Skip the escaped character, which may be a quote.
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquote returns the value of a plain, single-quoted or double-quoted scalar.
+func unquote(value string) (string, error) {
+	switch {
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted string %s", value)
+		}
+		return s, nil
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		// In single-quoted strings, a quote is written as two quotes.
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case value[0] == '"' || value[0] == '\'':
+		return "", fmt.Errorf("unterminated string %s", value)
+	}
+	return value, nil
+}
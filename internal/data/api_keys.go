@@ -0,0 +1,201 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// apiKeyPrefix starts every API key, so that keys are easy to recognise (and to find
+// with secret scanners) when they leak into code or logs.
+const apiKeyPrefix = "tn_"
+
+// APIKey is a long-lived credential for scripts and integrations. It can only be used
+// for the permissions it was created with, and only while its owner still has them.
+// The plaintext key is only set when the key is created.
+type APIKey struct {
+	ID          int64       `json:"id"`
+	CreatedAt   CustomTime  `json:"created_at"`
+	UserID      int64       `json:"-"`
+	Name        string      `json:"name"`
+	Plaintext   string      `json:"key,omitempty"`
+	Prefix      string      `json:"prefix"`
+	Hash        []byte      `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	LastUsedAt  *CustomTime `json:"last_used_at"`
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(key.Permissions) > 0, "permissions", "must contain at least one permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+}
+
+// Define an APIKeyModel struct type which wraps a sql.DB connection pool.
+type APIKeyModel struct {
+	DB dbConn
+}
+
+// Insert generates a new key and stores it. Only the hash is kept, so the returned
+// plaintext is the only chance to see it.
+func (m APIKeyModel) Insert(ctx context.Context, key *APIKey) error {
+	token, err := generateToken(key.UserID, 0, "api_key")
+	if err != nil {
+		return err
+	}
+	key.Plaintext = apiKeyPrefix + token.Plaintext
+	// The prefix is shown in listings so that users can tell their keys apart.
+	key.Prefix = key.Plaintext[:len(apiKeyPrefix)+6]
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, hash, permissions)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	args := []interface{}{key.UserID, key.Name, key.Prefix, key.Hash, m.DB.dialect.array(key.Permissions)}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (m APIKeyModel) GetAllForUser(ctx context.Context, userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT id, created_at, user_id, name, prefix, permissions, last_used_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			m.DB.dialect.array(&key.Permissions),
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetForKey returns the API key with the given plaintext along with the user it belongs
+// to, and records that the key has been used. It returns ErrRecordNotFound for an
+// unknown or revoked key.
+func (m APIKeyModel) GetForKey(ctx context.Context, plaintext string) (*APIKey, *User, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	// Updating last_used_at in the same statement saves a round trip on every request
+	// made with a key. SQLite can't update in a WITH query, so there it takes a statement
+	// of its own.
+	query := m.DB.dialect.choose(`
+		WITH key AS (
+			UPDATE api_keys
+			SET last_used_at = NOW()
+			WHERE hash = $1
+			RETURNING id, created_at, user_id, name, prefix, permissions, last_used_at
+		)
+		SELECT key.id, key.created_at, key.name, key.prefix, key.permissions, key.last_used_at,
+			users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.deactivated, users.timezone, users.version
+		FROM key
+		INNER JOIN users ON users.id = key.user_id`, `
+		SELECT key.id, key.created_at, key.name, key.prefix, key.permissions, key.last_used_at,
+			users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.deactivated, users.timezone, users.version
+		FROM api_keys AS key
+		INNER JOIN users ON users.id = key.user_id
+		WHERE key.hash = $1`)
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	if !m.DB.dialect.writableCTEs() {
+		_, err := m.DB.ExecContext(ctx, `UPDATE api_keys SET last_used_at = NOW() WHERE hash = $1`, hash[:])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var key APIKey
+	var user User
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.Name,
+		&key.Prefix,
+		m.DB.dialect.array(&key.Permissions),
+		&key.LastUsedAt,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Deactivated,
+		&user.Timezone,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	key.UserID = user.ID
+	key.Hash = hash[:]
+	return &key, &user, nil
+}
+
+// Delete revokes one of a user's API keys.
+func (m APIKeyModel) Delete(ctx context.Context, id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// Define the states of an attachment's scan. Attachments are quarantined, pending, from
+// when they are uploaded until the scanners have passed them, and can't be downloaded
+// until they are clean.
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanRejected = "rejected"
+)
+
+// Attachment is a file uploaded to a task. Its content is kept apart, since it is only
+// needed to download or scan the file, see AttachmentModel.GetContent().
+type Attachment struct {
+	ID          int64      `json:"id"`
+	CreatedAt   CustomTime `json:"created_at"`
+	TaskID      *int64     `json:"task_id"`
+	UserID      int64      `json:"user_id"`
+	Filename    string     `json:"filename"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	ScanStatus  string     `json:"scan_status"`
+	// ScanReason says why an attachment was rejected, such as the name of the virus found.
+	ScanReason string      `json:"scan_reason,omitempty"`
+	ScannedAt  *CustomTime `json:"scanned_at"`
+}
+
+func ValidateAttachment(v *validator.Validator, attachment *Attachment) {
+	v.Check(attachment.Filename != "", "filename", "must be provided")
+	v.Check(len(attachment.Filename) <= 255, "filename", "must not be more than 255 bytes long")
+	v.Check(utf8.ValidString(attachment.Filename) && strings.IndexFunc(attachment.Filename, unicode.IsControl) < 0, "filename", "must not contain control characters")
+	v.Check(!strings.ContainsAny(attachment.Filename, `/\`), "filename", "must not contain slashes")
+	v.Check(attachment.Size > 0, "file", "must not be empty")
+}
+
+const attachmentColumns = `id, created_at, task_id, user_id, filename, content_type, size, scan_status, scan_reason, scanned_at`
+
+func (attachment *Attachment) scanDest() []interface{} {
+	return []interface{}{
+		&attachment.ID,
+		&attachment.CreatedAt,
+		&attachment.TaskID,
+		&attachment.UserID,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.ScanStatus,
+		&attachment.ScanReason,
+		&attachment.ScannedAt,
+	}
+}
+
+// Define an AttachmentModel struct type which wraps a sql.DB connection pool.
+type AttachmentModel struct {
+	DB dbConn
+}
+
+// insertAttachment stores a file along with its content, setting the attachment's ID,
+// size and the time it was uploaded. It is shared with the models that keep other files
+// as attachments.
+func insertAttachment(ctx context.Context, q queryer, attachment *Attachment, content []byte) error {
+	query := `
+		INSERT INTO attachments (task_id, user_id, filename, content_type, size, content, scan_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+	attachment.Size = int64(len(content))
+	args := []interface{}{attachment.TaskID, attachment.UserID, attachment.Filename, attachment.ContentType, attachment.Size, content, attachment.ScanStatus}
+	return q.QueryRowContext(ctx, query, args...).Scan(&attachment.ID, &attachment.CreatedAt)
+}
+
+// Insert adds a file to a task. The attachment is quarantined until it is scanned.
+func (m AttachmentModel) Insert(ctx context.Context, attachment *Attachment, content []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	attachment.ScanStatus = ScanPending
+	return insertAttachment(ctx, m.DB, attachment, content)
+}
+
+// Get fetches one of a task's attachments, without its content.
+func (m AttachmentModel) Get(ctx context.Context, id int64, taskID int64) (*Attachment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM attachments
+		WHERE id = $1 AND task_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var attachment Attachment
+	err := m.DB.QueryRowContext(ctx, query, id, taskID).Scan(attachment.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &attachment, nil
+}
+
+// GetAllForTask returns the attachments of a task, oldest first, without their content.
+func (m AttachmentModel) GetAllForTask(ctx context.Context, taskID int64) ([]*Attachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM attachments
+		WHERE task_id = $1
+		ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	attachments := []*Attachment{}
+	err := queryEach(ctx, m.DB, query, []interface{}{taskID}, func(rows *sql.Rows) error {
+		var attachment Attachment
+		err := rows.Scan(attachment.scanDest()...)
+		attachments = append(attachments, &attachment)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// GetContent returns the content of an attachment.
+func (m AttachmentModel) GetContent(ctx context.Context, id int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var content []byte
+	err := m.DB.QueryRowContext(ctx, `SELECT content FROM attachments WHERE id = $1`, id).Scan(&content)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+// GetPending returns up to limit of the attachments uploaded before the given time that
+// are still waiting to be scanned, oldest first.
+func (m AttachmentModel) GetPending(ctx context.Context, before time.Time, limit int) ([]*Attachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM attachments
+		WHERE scan_status = 'pending' AND created_at < $1
+		ORDER BY created_at, id
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	attachments := []*Attachment{}
+	err := queryEach(ctx, m.DB, query, []interface{}{before, limit}, func(rows *sql.Rows) error {
+		var attachment Attachment
+		err := rows.Scan(attachment.scanDest()...)
+		attachments = append(attachments, &attachment)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// SetScanResult records the outcome of a pending attachment's scan, from its ScanStatus
+// and ScanReason, and sets ScannedAt. It returns ErrRecordNotFound if the attachment has
+// been deleted or scanned already in the meantime.
+func (m AttachmentModel) SetScanResult(ctx context.Context, attachment *Attachment) error {
+	query := `
+		UPDATE attachments
+		SET scan_status = $2, scan_reason = $3, scanned_at = NOW()
+		WHERE id = $1 AND scan_status = 'pending'
+		RETURNING scanned_at`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, attachment.ID, attachment.ScanStatus, attachment.ScanReason).Scan(&attachment.ScannedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes an attachment from a task.
+func (m AttachmentModel) Delete(ctx context.Context, id int64, taskID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM attachments WHERE id = $1 AND task_id = $2`, id, taskID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
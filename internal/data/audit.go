@@ -0,0 +1,177 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// The kinds of records that are audited.
+const (
+	AuditTask     = "task"
+	AuditCategory = "category"
+	AuditUser     = "user"
+)
+
+// AuditEntityTypes lists the values accepted by the entity_type filter.
+var AuditEntityTypes = []string{AuditTask, AuditCategory, AuditUser}
+
+// The actions recorded in the audit log.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// auditIgnoredFields are left out of the recorded changes because they change on every
+// write without saying anything about what was changed, or, like a task's is_overdue and
+// due_in_seconds, are worked out from the time rather than stored.
+var auditIgnoredFields = map[string]bool{"version": true, "is_overdue": true, "due_in_seconds": true}
+
+// FieldChange holds the JSON values of a field before and after a change. Old is null for
+// a created record and New is null for a deleted one.
+type FieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// AuditEntry records who changed a task, category or user, and how.
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	CreatedAt  CustomTime             `json:"created_at"`
+	ActorID    *int64                 `json:"actor_id"`
+	EntityType string                 `json:"entity_type"`
+	EntityID   int64                  `json:"entity_id"`
+	Action     string                 `json:"action"`
+	Changes    map[string]FieldChange `json:"changes"`
+}
+
+// AuditChanges compares the JSON representations of a record before and after a change,
+// and returns the fields whose values differ. Either side can be nil, for a record that
+// was created or deleted.
+func AuditChanges(before, after interface{}) (map[string]FieldChange, error) {
+	oldFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]FieldChange{}
+	for name, value := range oldFields {
+		if !bytes.Equal(value, newFields[name]) {
+			changes[name] = FieldChange{Old: value, New: newFields[name]}
+		}
+	}
+	for name, value := range newFields {
+		if _, ok := oldFields[name]; !ok {
+			changes[name] = FieldChange{New: value}
+		}
+	}
+	for name := range auditIgnoredFields {
+		delete(changes, name)
+	}
+	return changes, nil
+}
+
+// auditFields breaks a record up into the JSON values of its fields.
+func auditFields(record interface{}) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if record == nil {
+		return fields, nil
+	}
+	js, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(js, &fields)
+	if err != nil {
+		return nil, fmt.Errorf("audit: record is not a JSON object: %w", err)
+	}
+	return fields, nil
+}
+
+// AuditFilters narrows down the audit feed.
+type AuditFilters struct {
+	EntityType string
+	EntityID   int64
+	ActorID    int64
+}
+
+func (af AuditFilters) where() *whereClause {
+	w := &whereClause{}
+	if af.EntityType != "" {
+		w.add("entity_type = " + w.arg(af.EntityType))
+	}
+	if af.EntityID > 0 {
+		w.add("entity_id = " + w.arg(af.EntityID))
+	}
+	if af.ActorID > 0 {
+		w.add("actor_id = " + w.arg(af.ActorID))
+	}
+	return w
+}
+
+// Define an AuditModel struct type which wraps a sql.DB connection pool.
+type AuditModel struct {
+	DB dbConn
+}
+
+// Insert records an audit entry. An entry without an actor was made by the system, e.g. by
+// the recurrence scheduler.
+func (m AuditModel) Insert(ctx context.Context, entry *AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_log (actor_id, entity_type, entity_id, action, changes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+	args := []interface{}{entry.ActorID, entry.EntityType, entry.EntityID, entry.Action, changes}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// GetAll returns a page of the audit entries matching the filters.
+func (m AuditModel) GetAll(ctx context.Context, af AuditFilters, filters Filters) ([]*AuditEntry, Metadata, error) {
+	w := af.where()
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, actor_id, entity_type, entity_id, action, changes
+		FROM audit_log
+		WHERE %s
+		ORDER BY %s %s, id %s
+		LIMIT %s OFFSET %s`,
+		w, filters.sortColumn(), filters.sortDirection(), filters.sortDirection(),
+		w.arg(filters.limit()), w.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	totalRecords := 0
+	entries := []*AuditEntry{}
+	err := queryEach(ctx, m.DB, query, w.args, func(rows *sql.Rows) error {
+		var entry AuditEntry
+		var changes []byte
+		err := rows.Scan(&totalRecords, &entry.ID, &entry.CreatedAt, &entry.ActorID, &entry.EntityType, &entry.EntityID, &entry.Action, &changes)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &entry)
+		return json.Unmarshal(changes, &entry.Changes)
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Avatar is one of the sizes of a user's avatar, a square PNG image. The image itself is
+// kept as an attachment, see AvatarModel.Save().
+type Avatar struct {
+	UserID    int64
+	Size      int
+	Image     []byte
+	UpdatedAt CustomTime
+}
+
+// avatarJoin joins a query on the users table to their avatars, for avatarURLDest. The
+// sizes of an avatar are saved together, so any one of them will do.
+const avatarJoin = `LEFT JOIN avatars ON avatars.user_id = users.id AND avatars.size = 128`
+
+// AvatarURL returns the URL a user's avatar is served at. The time it was last changed is
+// part of the URL, so that a new avatar isn't hidden by a cached copy of the old one.
+func AvatarURL(userID int64, updatedAt time.Time) string {
+	return fmt.Sprintf("/v1/avatars/%d?v=%d", userID, updatedAt.Unix())
+}
+
+// avatarURLDest scans avatars.updated_at, as joined by avatarJoin, into the URL of the
+// user's avatar, or nil if they have none. The user's ID must come before it in the
+// query, so that it has been scanned already.
+type avatarURLDest struct {
+	userID *int64
+	url    **string
+}
+
+func (d avatarURLDest) Scan(value interface{}) error {
+	var updatedAt CustomTime
+	err := updatedAt.Scan(value)
+	if err != nil {
+		return err
+	}
+	*d.url = nil
+	if !updatedAt.IsZero() {
+		url := AvatarURL(*d.userID, time.Time(updatedAt))
+		*d.url = &url
+	}
+	return nil
+}
+
+// Define an AvatarModel struct type which wraps a sql.DB connection pool.
+type AvatarModel struct {
+	DB dbConn
+}
+
+// Save replaces a user's avatar with new images, keyed by size, returning the time it was
+// changed. Each size is stored as an attachment of its own, named avatar-<size>.png.
+func (m AvatarModel) Save(ctx context.Context, userID int64, images map[int][]byte) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = deleteAvatar(ctx, tx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	sizes := make([]int, 0, len(images))
+	for size := range images {
+		sizes = append(sizes, size)
+	}
+	sort.Ints(sizes)
+
+	// Every size gets the time the first one was stored at, so that they all agree.
+	var updatedAt CustomTime
+	for i, size := range sizes {
+		// The images have been decoded and drawn again by avatar.Resize(), so unlike other
+		// uploads there is nothing in them left to scan.
+		attachment := &Attachment{
+			UserID:      userID,
+			Filename:    fmt.Sprintf("avatar-%d.png", size),
+			ContentType: "image/png",
+			ScanStatus:  ScanClean,
+		}
+		err = insertAttachment(ctx, tx, attachment, images[size])
+		if err != nil {
+			return time.Time{}, err
+		}
+		if i == 0 {
+			updatedAt = attachment.CreatedAt
+		}
+
+		query := `
+			INSERT INTO avatars (user_id, size, attachment_id, updated_at)
+			VALUES ($1, $2, $3, $4)`
+		_, err = tx.ExecContext(ctx, query, userID, size, attachment.ID, updatedAt)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Time(updatedAt), tx.Commit()
+}
+
+// Get returns one size of a user's avatar.
+func (m AvatarModel) Get(ctx context.Context, userID int64, size int) (*Avatar, error) {
+	query := `
+		SELECT avatars.user_id, avatars.size, attachments.content, avatars.updated_at
+		FROM avatars
+		INNER JOIN attachments ON attachments.id = avatars.attachment_id
+		WHERE avatars.user_id = $1 AND avatars.size = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var avatar Avatar
+	err := m.DB.QueryRowContext(ctx, query, userID, size).Scan(&avatar.UserID, &avatar.Size, &avatar.Image, &avatar.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &avatar, nil
+}
+
+// Delete removes a user's avatar, returning ErrRecordNotFound if they have none.
+func (m AvatarModel) Delete(ctx context.Context, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	deleted, err := deleteAvatar(ctx, m.DB, userID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// deleteAvatar removes the attachments holding a user's avatar, which takes their rows in
+// the avatars table with them, and reports whether there were any.
+func deleteAvatar(ctx context.Context, q queryer, userID int64) (bool, error) {
+	query := `
+		DELETE FROM attachments
+		WHERE id IN (SELECT attachment_id FROM avatars WHERE user_id = $1)`
+	result, err := q.ExecContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
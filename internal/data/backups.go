@@ -0,0 +1,377 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// BackupVersion is the version of the backup format written by Export().
+const BackupVersion = 1
+
+// Backup is a complete copy of a user's data, used to move it between instances. IDs are
+// those of the exporting instance; they only serve to link the records together and are
+// remapped on import.
+type Backup struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Categories []*BackupCategory `json:"categories"`
+	Tags       []*BackupTag      `json:"tags"`
+	Tasks      []*BackupTask     `json:"tasks"`
+	Comments   []*BackupComment  `json:"comments"`
+}
+
+type BackupCategory struct {
+	ID          int64  `json:"id"`
+	ParentID    *int64 `json:"parent_id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type BackupTag struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type BackupTask struct {
+	ID          int64        `json:"id"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	DueDate     *time.Time   `json:"due_date"`
+	Priority    TaskPriority `json:"priority"`
+	Status      TaskStatus   `json:"status"`
+	Category    string       `json:"category"`
+	Recurrence  string       `json:"recurrence,omitempty"`
+	Archived    bool         `json:"archived"`
+	TagIDs      []int64      `json:"tag_ids"`
+}
+
+type BackupComment struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	TaskID    int64     `json:"task_id"`
+	ParentID  *int64    `json:"parent_id,omitempty"`
+	Body      string    `json:"body"`
+}
+
+// ImportCount says how many records of one kind a restore created, and how many it
+// skipped because they already existed (or referred to records that don't).
+type ImportCount struct {
+	Created int `json:"created"`
+	Skipped int `json:"skipped"`
+}
+
+type ImportSummary struct {
+	Categories ImportCount `json:"categories"`
+	Tags       ImportCount `json:"tags"`
+	Tasks      ImportCount `json:"tasks"`
+	Comments   ImportCount `json:"comments"`
+}
+
+// Define a BackupModel struct type which wraps a sql.DB connection pool.
+type BackupModel struct {
+	DB dbConn
+}
+
+// Export reads all of a workspace's categories, tasks and comments, along with the user's
+// tags.
+func (m BackupModel) Export(ctx context.Context, workspaceID int64, userID int64) (*Backup, error) {
+	// A backup reads several tables, so allow it more time than a single query, and use a
+	// read-only transaction so that they are all read from the same snapshot.
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	backup := &Backup{
+		Version:    BackupVersion,
+		Categories: []*BackupCategory{},
+		Tags:       []*BackupTag{},
+		Tasks:      []*BackupTask{},
+		Comments:   []*BackupComment{},
+	}
+
+	query := `
+		SELECT id, parent_id, name, COALESCE(description, '')
+		FROM categories
+		WHERE workspace_id = $1
+		ORDER BY id ASC`
+	err = queryEach(ctx, tx, query, []interface{}{workspaceID}, func(rows *sql.Rows) error {
+		var category BackupCategory
+		err := rows.Scan(&category.ID, &category.ParentID, &category.Name, &category.Description)
+		backup.Categories = append(backup.Categories, &category)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT id, name
+		FROM tags
+		WHERE user_id = $1
+		ORDER BY id ASC`
+	err = queryEach(ctx, tx, query, []interface{}{userID}, func(rows *sql.Rows) error {
+		var tag BackupTag
+		err := rows.Scan(&tag.ID, &tag.Name)
+		backup.Tags = append(backup.Tags, &tag)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT tasks.id, tasks.created_at, tasks.title, tasks.description, tasks.due_date, tasks.priority,
+			tasks.status, tasks.category, tasks.recurrence, tasks.archived,
+			` + m.DB.dialect.arrayAgg("task_tags.tag_id") + `
+		FROM tasks
+		LEFT JOIN task_tags ON task_tags.task_id = tasks.id
+			AND task_tags.tag_id IN (SELECT id FROM tags WHERE user_id = $2)
+		WHERE tasks.workspace_id = $1
+		GROUP BY tasks.id
+		ORDER BY tasks.id ASC`
+	err = queryEach(ctx, tx, query, []interface{}{workspaceID, userID}, func(rows *sql.Rows) error {
+		task := BackupTask{TagIDs: []int64{}}
+		err := rows.Scan(
+			&task.ID,
+			&task.CreatedAt,
+			&task.Title,
+			&task.Description,
+			&task.DueDate,
+			&task.Priority,
+			&task.Status,
+			&task.Category,
+			&task.Recurrence,
+			&task.Archived,
+			m.DB.dialect.array(&task.TagIDs),
+		)
+		backup.Tasks = append(backup.Tasks, &task)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT comments.id, comments.created_at, comments.task_id, comments.parent_id, comments.body
+		FROM comments
+		INNER JOIN tasks ON tasks.id = comments.task_id
+		WHERE tasks.workspace_id = $1
+		ORDER BY comments.id ASC`
+	err = queryEach(ctx, tx, query, []interface{}{workspaceID}, func(rows *sql.Rows) error {
+		var comment BackupComment
+		err := rows.Scan(&comment.ID, &comment.CreatedAt, &comment.TaskID, &comment.ParentID, &comment.Body)
+		backup.Comments = append(backup.Comments, &comment)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	backup.ExportedAt = time.Now().UTC()
+	return backup, tx.Commit()
+}
+
+// queryEach runs a query and calls fn for every row.
+func queryEach(ctx context.Context, q queryer, query string, args []interface{}, fn func(rows *sql.Rows) error) error {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err = fn(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Import restores a backup into a workspace in a single transaction, as the given user. Records get
+// new IDs, and references between them are remapped. Records that already exist are
+// skipped: tags with the same name, tasks with the same title and due date, comments
+// with the same body and creation time on the same task, and categories with the same
+// name. Comments on tasks that aren't in the backup are skipped too. Every task's
+// category must be among the backup's categories.
+func (m BackupModel) Import(ctx context.Context, workspaceID int64, userID int64, backup *Backup) (*ImportSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var summary ImportSummary
+
+	categoryIDs := make(map[int64]int64, len(backup.Categories))
+	created := make(map[int64]bool, len(backup.Categories))
+	for _, category := range backup.Categories {
+		query := `
+			INSERT INTO categories (workspace_id, name, description, updated_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (workspace_id, name) DO NOTHING
+			RETURNING id`
+		var id int64
+		err := tx.QueryRowContext(ctx, query, workspaceID, category.Name, category.Description).Scan(&id)
+		switch {
+		case err == nil:
+			summary.Categories.Created++
+			created[id] = true
+		case errors.Is(err, sql.ErrNoRows):
+			summary.Categories.Skipped++
+			err = tx.QueryRowContext(ctx, `SELECT id FROM categories WHERE workspace_id = $1 AND name = $2`, workspaceID, category.Name).Scan(&id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		categoryIDs[category.ID] = id
+	}
+	// Nest the new categories once they all exist. Categories that were already there
+	// keep their place in the hierarchy.
+	for _, category := range backup.Categories {
+		id := categoryIDs[category.ID]
+		if category.ParentID == nil || !created[id] {
+			continue
+		}
+		parentID, ok := categoryIDs[*category.ParentID]
+		if !ok || parentID == id {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE categories SET parent_id = $1, updated_at = NOW() WHERE id = $2`, parentID, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tagIDs := make(map[int64]int64, len(backup.Tags))
+	for _, tag := range backup.Tags {
+		query := `
+			INSERT INTO tags (user_id, name)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id, name) DO NOTHING
+			RETURNING id`
+		var id int64
+		err := tx.QueryRowContext(ctx, query, userID, tag.Name).Scan(&id)
+		switch {
+		case err == nil:
+			summary.Tags.Created++
+		case errors.Is(err, sql.ErrNoRows):
+			summary.Tags.Skipped++
+			err = tx.QueryRowContext(ctx, `SELECT id FROM tags WHERE user_id = $1 AND name = $2`, userID, tag.Name).Scan(&id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		tagIDs[tag.ID] = id
+	}
+
+	taskIDs := make(map[int64]int64, len(backup.Tasks))
+	for _, task := range backup.Tasks {
+		query := `
+			SELECT id
+			FROM tasks
+			WHERE workspace_id = $1 AND title = $2 AND due_date IS NOT DISTINCT FROM $3
+			LIMIT 1`
+		var id int64
+		err := tx.QueryRowContext(ctx, query, workspaceID, task.Title, task.DueDate).Scan(&id)
+		switch {
+		case err == nil:
+			summary.Tasks.Skipped++
+			taskIDs[task.ID] = id
+			continue
+		case !errors.Is(err, sql.ErrNoRows):
+			return nil, err
+		}
+
+		// Completed recurring tasks are marked as materialized, so that restoring a
+		// backup doesn't create their next occurrences a second time.
+		query = `
+			INSERT INTO tasks (created_at, title, description, priority, status, category_id, category, due_date,
+				user_id, workspace_id, recurrence, archived, recurrence_materialized, updated_at)
+			SELECT $1::timestamptz, $2::text, $3::text, $4::text, $5::text, categories.id, categories.name,
+				$7::timestamptz, $8::bigint, categories.workspace_id, $9::text, $10::bool, $5::text = 'completed', NOW()
+			FROM categories
+			WHERE categories.workspace_id = $11 AND categories.name = $6
+			RETURNING id`
+		args := []interface{}{
+			task.CreatedAt, task.Title, task.Description, task.Priority, task.Status, task.Category,
+			task.DueDate, userID, task.Recurrence, task.Archived, workspaceID,
+		}
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&id)
+		if err == nil {
+			err = saveTaskVersion(ctx, tx, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		summary.Tasks.Created++
+		taskIDs[task.ID] = id
+
+		for _, tagID := range task.TagIDs {
+			newTagID, ok := tagIDs[tagID]
+			if !ok {
+				continue
+			}
+			_, err = tx.ExecContext(ctx, `INSERT INTO task_tags (task_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, id, newTagID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Comments are exported in ID order, so a parent always comes before its replies.
+	commentIDs := make(map[int64]int64, len(backup.Comments))
+	for _, comment := range backup.Comments {
+		taskID, ok := taskIDs[comment.TaskID]
+		if !ok {
+			summary.Comments.Skipped++
+			continue
+		}
+		var parentID *int64
+		if comment.ParentID != nil {
+			if id, ok := commentIDs[*comment.ParentID]; ok {
+				parentID = &id
+			}
+		}
+
+		query := `
+			SELECT id
+			FROM comments
+			WHERE task_id = $1 AND body = $2 AND created_at = $3
+			LIMIT 1`
+		var id int64
+		err := tx.QueryRowContext(ctx, query, taskID, comment.Body, comment.CreatedAt).Scan(&id)
+		switch {
+		case err == nil:
+			summary.Comments.Skipped++
+			commentIDs[comment.ID] = id
+			continue
+		case !errors.Is(err, sql.ErrNoRows):
+			return nil, err
+		}
+
+		query = `
+			INSERT INTO comments (created_at, task_id, user_id, parent_id, body)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`
+		err = tx.QueryRowContext(ctx, query, comment.CreatedAt, taskID, userID, parentID, comment.Body).Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		summary.Comments.Created++
+		commentIDs[comment.ID] = id
+	}
+
+	return &summary, tx.Commit()
+}
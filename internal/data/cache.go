@@ -0,0 +1,93 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/zarinakolybaeva/DoMake/internal/cache"
+)
+
+// workspaceCache caches lookups of a workspace's tasks and categories. Instead of deleting
+// entries when something changes, every change gives the workspace a new generation,
+// which is part of the key of each of its entries. That keeps multi-row changes (renaming
+// a category renames it on all of its tasks, for example) cheap to invalidate, and a
+// lookup which read the old generation before a change can only store its result under
+// that generation, where nobody will look for it again. Tasks are shared by everyone in a
+// workspace, so the entries are too; callers check membership before looking anything up.
+//
+// A nil cache caches nothing. Errors from the cache are treated as misses, since the
+// database can always answer instead.
+type workspaceCache struct {
+	cache cache.Cache
+}
+
+// generation returns the workspace's current generation, starting a new one if the cache
+// has none (because it was never set, or has expired or been evicted). Generations are
+// random, so that entries from an evicted one can't come back into use.
+func (wc workspaceCache) generation(workspaceID int64) string {
+	key := "generation:" + strconv.FormatInt(workspaceID, 10)
+	gen, found, err := wc.cache.Get(key)
+	if err == nil && found {
+		return string(gen)
+	}
+	return wc.newGeneration(key)
+}
+
+func (wc workspaceCache) newGeneration(key string) string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		return ""
+	}
+	gen := hex.EncodeToString(b)
+	if wc.cache.Set(key, []byte(gen)) != nil {
+		return ""
+	}
+	return gen
+}
+
+func (wc workspaceCache) key(gen, kind string, workspaceID, id int64) string {
+	return kind + ":" + strconv.FormatInt(workspaceID, 10) + ":" + gen + ":" + strconv.FormatInt(id, 10)
+}
+
+// get looks up a task or category and decodes it into dst. It returns the generation the
+// lookup was made in, to be passed to set() on a miss, and whether dst was filled in.
+func (wc workspaceCache) get(kind string, workspaceID, id int64, dst interface{}) (string, bool) {
+	if wc.cache == nil {
+		return "", false
+	}
+	gen := wc.generation(workspaceID)
+	if gen == "" {
+		return "", false
+	}
+	value, found, err := wc.cache.Get(wc.key(gen, kind, workspaceID, id))
+	if err != nil || !found {
+		return gen, false
+	}
+	return gen, gob.NewDecoder(bytes.NewReader(value)).Decode(dst) == nil
+}
+
+// set stores a task or category that was loaded from the database after get() missed.
+func (wc workspaceCache) set(gen, kind string, workspaceID, id int64, src interface{}) {
+	if wc.cache == nil || gen == "" {
+		return
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(src)
+	if err != nil {
+		return
+	}
+	wc.cache.Set(wc.key(gen, kind, workspaceID, id), buf.Bytes())
+}
+
+// invalidate drops everything cached for the workspace, by starting a new generation. It
+// must be called after the change has been committed.
+func (wc workspaceCache) invalidate(workspaceID int64) {
+	if wc.cache == nil {
+		return
+	}
+	wc.newGeneration("generation:" + strconv.FormatInt(workspaceID, 10))
+}
@@ -4,16 +4,28 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"time"
 	"fmt"
 	"github.com/zarinakolybaeva/DoMake/internal/validator"
 )
 
+var (
+	ErrDuplicateCategory     = errors.New("duplicate category")
+	ErrCategoryInUse         = errors.New("category in use")
+	ErrCategoryCycle         = errors.New("category cycle")
+	ErrInvalidReassignTarget = errors.New("invalid reassignment target")
+)
+
+// Category groups a workspace's tasks. Every task belongs to exactly one category.
+// Categories can be nested (e.g. a project and its sub-projects) through ParentID.
 type Category struct {
 	ID          int64      `json:"id"`
 	CreatedAt   CustomTime `json:"created_at"`
+	UpdatedAt   CustomTime `json:"updated_at"`
+	WorkspaceID int64      `json:"workspace_id"`
+	ParentID    *int64     `json:"parent_id"`
 	Name        string     `json:"name"`
 	Description string     `json:"description"`
+	Version     int32      `json:"version"`
 }
 
 // ValidateCategory validates the category data.
@@ -24,40 +36,139 @@ func ValidateCategory(v *validator.Validator, category *Category) {
 	v.Check(len(category.Description) <= 500, "description", "must not be more than 500 bytes long")
 }
 
+// CategoryWithCounts is a category along with how many of its tasks are open and how many
+// are completed. Archived tasks aren't counted.
+type CategoryWithCounts struct {
+	*Category
+	TaskCount      int `json:"task_count"`
+	OpenCount      int `json:"open_count"`
+	CompletedCount int `json:"completed_count"`
+}
+
 type CategoryModel struct {
-	DB *sql.DB
+	DB    dbConn
+	cache workspaceCache
 }
 
 // Insert a new record in the categories table.
-func (m CategoryModel) Insert(category *Category) error {
+func (m CategoryModel) Insert(ctx context.Context, category *Category) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return insertCategory(ctx, m.DB, m.DB.dialect, category)
+}
+
+func insertCategory(ctx context.Context, q queryer, d dialect, category *Category) error {
 	query := `
-		INSERT INTO categories (name, description)
-		VALUES ($1, $2)
-		RETURNING id, created_at`
-	args := []interface{}{category.Name, category.Description}
+		INSERT INTO categories (workspace_id, parent_id, name, description, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id, created_at, updated_at, version`
+	args := []interface{}{category.WorkspaceID, category.ParentID, category.Name, category.Description}
 
-	return m.DB.QueryRow(query, args...).Scan(&category.ID, &category.CreatedAt)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&category.ID, &category.CreatedAt, &category.UpdatedAt, &category.Version)
+	if err != nil {
+		switch {
+		case d.isUniqueViolation(err, "categories_workspace_id_name_key"):
+			return ErrDuplicateCategory
+		default:
+			return err
+		}
+	}
+	return nil
 }
 
-// Retrieve a specific record from the categories table.
-func (m CategoryModel) Get(id int64) (*Category, error) {
+// Retrieve a specific record belonging to a workspace from the categories table.
+func (m CategoryModel) Get(ctx context.Context, id int64, workspaceID int64) (*Category, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-		SELECT id, created_at, name, description
+		SELECT id, created_at, updated_at, workspace_id, parent_id, name, COALESCE(description, ''), version
 		FROM categories
-		WHERE id = $1`
+		WHERE id = $1 AND workspace_id = $2`
+
+	var cached Category
+	gen, found := m.cache.get("category", workspaceID, id, &cached)
+	if found {
+		return &cached, nil
+	}
+	category, err := m.get(ctx, query, id, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	m.cache.set(gen, "category", workspaceID, id, category)
+	return category, nil
+}
+
+// GetByName retrieves a workspace's category by its name.
+func (m CategoryModel) GetByName(ctx context.Context, workspaceID int64, name string) (*Category, error) {
+	query := `
+		SELECT id, created_at, updated_at, workspace_id, parent_id, name, COALESCE(description, ''), version
+		FROM categories
+		WHERE workspace_id = $1 AND name = $2`
+
+	return m.get(ctx, query, workspaceID, name)
+}
+
+// GetMany retrieves a workspace's categories with the given IDs in a single query, keyed
+// by ID. IDs that don't belong to a category in the workspace are left out of the map.
+func (m CategoryModel) GetMany(ctx context.Context, workspaceID int64, ids []int64) (map[int64]*Category, error) {
+	categories := make(map[int64]*Category, len(ids))
+	if len(ids) == 0 {
+		return categories, nil
+	}
+	query := `
+		SELECT id, created_at, updated_at, workspace_id, parent_id, name, COALESCE(description, ''), version
+		FROM categories
+		WHERE workspace_id = $1 AND ` + m.DB.dialect.anyOf("id", "$2")
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID, m.DB.dialect.array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var category Category
+		err := rows.Scan(
+			&category.ID,
+			&category.CreatedAt,
+			&category.UpdatedAt,
+			&category.WorkspaceID,
+			&category.ParentID,
+			&category.Name,
+			&category.Description,
+			&category.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		categories[category.ID] = &category
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (m CategoryModel) get(ctx context.Context, query string, args ...interface{}) (*Category, error) {
 	var category Category
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
 		&category.ID,
 		&category.CreatedAt,
+		&category.UpdatedAt,
+		&category.WorkspaceID,
+		&category.ParentID,
 		&category.Name,
 		&category.Description,
+		&category.Version,
 	)
 	if err != nil {
 		switch {
@@ -70,65 +181,367 @@ func (m CategoryModel) Get(id int64) (*Category, error) {
 	return &category, nil
 }
 
-// Update a specific record in the categories table.
-func (m CategoryModel) Update(category *Category) error {
+// ResolveForTask looks up the category of a task among the categories of the task's
+// workspace, by task.CategoryID if it is set and by the task.Category name otherwise, and
+// fills in both fields. It returns ErrRecordNotFound if the workspace has no such category.
+func (m CategoryModel) ResolveForTask(ctx context.Context, task *Task) error {
+	return resolveTaskCategory(ctx, m, task)
+}
+
+func resolveTaskCategory(ctx context.Context, categories CategoryRepository, task *Task) error {
+	var category *Category
+	var err error
+	if task.CategoryID != 0 {
+		category, err = categories.Get(ctx, task.CategoryID, task.WorkspaceID)
+	} else {
+		category, err = categories.GetByName(ctx, task.WorkspaceID, task.Category)
+	}
+	if err != nil {
+		return err
+	}
+	task.CategoryID = category.ID
+	task.Category = category.Name
+	return nil
+}
+
+// Update a specific record in the categories table, using the version number to detect
+// concurrent edits. Tasks keep a copy of their category's name, so a rename is applied to
+// them as well.
+func (m CategoryModel) Update(ctx context.Context, category *Category) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE categories
-		SET name = $1, description = $2
-		WHERE id = $3`
+		SET name = $1, description = $2, version = version + 1, updated_at = NOW()
+		WHERE id = $3 AND workspace_id = $4 AND version = $5
+		RETURNING version, updated_at`
 	args := []interface{}{
 		category.Name,
 		category.Description,
 		category.ID,
+		category.WorkspaceID,
+		category.Version,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&category.Version, &category.UpdatedAt)
+	if err != nil {
+		switch {
+		case m.DB.dialect.isUniqueViolation(err, "categories_workspace_id_name_key"):
+			return ErrDuplicateCategory
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	query = `
+		UPDATE tasks
+		SET category = $1, updated_at = NOW()
+		WHERE category_id = $2 AND category <> $1`
+	_, err = tx.ExecContext(ctx, query, category.Name, category.ID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	m.cache.invalidate(category.WorkspaceID)
+	return nil
 }
 
-// Delete a specific record from the categories table.
-func (m CategoryModel) Delete(id int64) error {
-	if id < 1 {
-		return ErrRecordNotFound
+// Move puts a category under a new parent, or at the top level if parentID is nil. The
+// parent must belong to the same workspace; Move returns ErrCategoryCycle if it is the
+// category itself or one of its subcategories, and ErrEditConflict if the category was
+// changed in the meantime.
+func (m CategoryModel) Move(ctx context.Context, category *Category, parentID *int64) error {
+	if parentID != nil && *parentID == category.ID {
+		return ErrCategoryCycle
 	}
-	query := `
-		DELETE FROM categories
-		WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	if parentID != nil {
+		// Walk up from the new parent. If we pass the category on the way, the
+		// category would end up as its own ancestor.
+		query := `
+			WITH RECURSIVE ancestors (id) AS (
+				SELECT parent_id FROM categories WHERE id = $2
+				UNION
+				SELECT categories.parent_id
+				FROM categories
+				INNER JOIN ancestors ON categories.id = ancestors.id
+			)
+			SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $1)`
+		var cycle bool
+		err = tx.QueryRowContext(ctx, query, category.ID, *parentID).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrCategoryCycle
+		}
+	}
 
-	rowsAffected, err := result.RowsAffected()
+	query := `
+		UPDATE categories
+		SET parent_id = $1, version = version + 1, updated_at = NOW()
+		WHERE id = $2 AND workspace_id = $3 AND version = $4
+		RETURNING version, updated_at`
+	args := []interface{}{parentID, category.ID, category.WorkspaceID, category.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&category.Version, &category.UpdatedAt)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
 	}
+	category.ParentID = parentID
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	err = tx.Commit()
+	if err != nil {
+		return err
 	}
+	m.cache.invalidate(category.WorkspaceID)
 	return nil
 }
 
-// GetAll retrieves all categories with pagination support.
-func (m CategoryModel) GetAll(filters Filters) ([]*Category, Metadata, error) {
+// CategoryNode is a category together with its subcategories, as returned by GetTree().
+type CategoryNode struct {
+	*Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// GetTree returns a workspace's categories nested under their parents. Top-level categories
+// and the children of each category are sorted by name.
+func (m CategoryModel) GetTree(ctx context.Context, workspaceID int64) ([]*CategoryNode, error) {
+	query := `
+		SELECT id, created_at, updated_at, workspace_id, parent_id, name, COALESCE(description, ''), version
+		FROM categories
+		WHERE workspace_id = $1
+		ORDER BY name ASC, id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := []*CategoryNode{}
+	for rows.Next() {
+		var category Category
+		err := rows.Scan(
+			&category.ID,
+			&category.CreatedAt,
+			&category.UpdatedAt,
+			&category.WorkspaceID,
+			&category.ParentID,
+			&category.Name,
+			&category.Description,
+			&category.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, &CategoryNode{Category: &category, Children: []*CategoryNode{}})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return buildCategoryTree(nodes), nil
+}
+
+// buildCategoryTree nests category nodes, sorted by name, under their parents and returns
+// the top-level ones.
+func buildCategoryTree(nodes []*CategoryNode) []*CategoryNode {
+	// The nodes are sorted by name, so appending each node to its parent in order keeps
+	// every level sorted as well.
+	byID := make(map[int64]*CategoryNode, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+	roots := []*CategoryNode{}
+	for _, node := range nodes {
+		if node.ParentID != nil {
+			if parent, ok := byID[*node.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
+
+// Define the ways of dealing with a category's tasks when it is deleted.
+const (
+	DeleteBlock    = "block"    // refuse to delete a category that still has tasks
+	DeleteCascade  = "cascade"  // delete the tasks along with the category
+	DeleteReassign = "reassign" // move the tasks to another category first
+)
+
+// DeleteStrategies lists the supported deletion strategies.
+var DeleteStrategies = []string{DeleteBlock, DeleteCascade, DeleteReassign}
+
+// CategoryDeletion reports what happened to a deleted category's tasks.
+type CategoryDeletion struct {
+	DeletedTaskIDs  []int64
+	ReassignedTasks []*Task
+}
+
+// Delete a specific record belonging to a workspace from the categories table, dealing
+// with its tasks according to strategy: with DeleteBlock it returns ErrCategoryInUse if
+// there are any, with DeleteCascade they are deleted, and with DeleteReassign they are
+// moved to the category targetID, which must belong to the same workspace. Everything
+// happens in a single transaction. Subcategories are moved up to the top level.
+func (m CategoryModel) Delete(ctx context.Context, id int64, workspaceID int64, strategy string, targetID int64) (*CategoryDeletion, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the category so that no task can be added to it while we clear it out.
+	query := `
+		SELECT id
+		FROM categories
+		WHERE id = $1 AND workspace_id = $2
+		FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, id, workspaceID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	deletion := &CategoryDeletion{DeletedTaskIDs: []int64{}, ReassignedTasks: []*Task{}}
+	switch strategy {
+	case DeleteCascade:
+		query = `
+			DELETE FROM tasks
+			WHERE category_id = $1
+			RETURNING id`
+		err = queryEach(ctx, tx, query, []interface{}{id}, func(rows *sql.Rows) error {
+			var taskID int64
+			err := rows.Scan(&taskID)
+			deletion.DeletedTaskIDs = append(deletion.DeletedTaskIDs, taskID)
+			return err
+		})
+	case DeleteReassign:
+		// Lock the target as well, so that it can't be deleted before we're done.
+		var targetName string
+		query = `
+			SELECT name
+			FROM categories
+			WHERE id = $1 AND workspace_id = $2 AND id <> $3
+			FOR UPDATE`
+		err = tx.QueryRowContext(ctx, query, targetID, workspaceID, id).Scan(&targetName)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil, ErrInvalidReassignTarget
+			default:
+				return nil, err
+			}
+		}
+
+		query = `
+			UPDATE tasks
+			SET category_id = $2, category = $3, version = version + 1, updated_at = NOW()
+			WHERE category_id = $1
+			RETURNING ` + taskColumns
+		err = queryEach(ctx, tx, query, []interface{}{id, targetID, targetName}, func(rows *sql.Rows) error {
+			var task Task
+			err := rows.Scan(task.scanDest()...)
+			deletion.ReassignedTasks = append(deletion.ReassignedTasks, &task)
+			return err
+		})
+		for i := 0; err == nil && i < len(deletion.ReassignedTasks); i++ {
+			err = saveTaskVersion(ctx, tx, deletion.ReassignedTasks[i].ID)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		DELETE FROM categories
+		WHERE id = $1`
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case m.DB.dialect.isForeignKeyViolation(err, "tasks_category_id_fkey"):
+			return nil, ErrCategoryInUse
+		default:
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	m.cache.invalidate(workspaceID)
+	return deletion, nil
+}
+
+// GetAll retrieves a workspace's categories, with their task counts, with filtering and
+// pagination support.
+func (m CategoryModel) GetAll(ctx context.Context, workspaceID int64, name string, filters Filters) ([]*CategoryWithCounts, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, name, description
+		SELECT count(*) OVER(), id, created_at, updated_at, workspace_id, parent_id, name, COALESCE(description, ''), version,
+			COALESCE(counts.task_count, 0), COALESCE(counts.open_count, 0), COALESCE(counts.completed_count, 0)
 		FROM categories
+		LEFT JOIN (
+			SELECT category_id,
+				count(*) AS task_count,
+				count(*) FILTER (WHERE status <> 'completed') AS open_count,
+				count(*) FILTER (WHERE status = 'completed') AS completed_count
+			FROM tasks
+			WHERE workspace_id = $1 AND NOT archived
+			GROUP BY category_id
+		) AS counts ON counts.category_id = categories.id
+		WHERE workspace_id = $1
+		AND (`+m.DB.dialect.textMatch("name", "$2")+` OR $2 = '')
 		ORDER BY %s %s, id ASC
-		LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
 
-	args := []interface{}{filters.limit(), filters.offset()}
+	args := []interface{}{workspaceID, name, filters.limit(), filters.offset()}
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -137,16 +550,23 @@ func (m CategoryModel) GetAll(filters Filters) ([]*Category, Metadata, error) {
 	defer rows.Close()
 
 	totalRecords := 0
-	categories := []*Category{}
+	categories := []*CategoryWithCounts{}
 
 	for rows.Next() {
-		var category Category
+		category := CategoryWithCounts{Category: &Category{}}
 		err := rows.Scan(
 			&totalRecords,
 			&category.ID,
 			&category.CreatedAt,
+			&category.UpdatedAt,
+			&category.WorkspaceID,
+			&category.ParentID,
 			&category.Name,
 			&category.Description,
+			&category.Version,
+			&category.TaskCount,
+			&category.OpenCount,
+			&category.CompletedCount,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -160,4 +580,4 @@ func (m CategoryModel) GetAll(filters Filters) ([]*Category, Metadata, error) {
 
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 	return categories, metadata, nil
-}
\ No newline at end of file
+}
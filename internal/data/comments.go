@@ -0,0 +1,293 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/zarinakolybaeva/DoMake/internal/markdown"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// Comment is a message left on a task. Replies point at the comment they answer
+// through ParentID, which lets clients render threads.
+type Comment struct {
+	ID         int64       `json:"id"`
+	CreatedAt  CustomTime  `json:"created_at"`
+	EditedAt   *CustomTime `json:"edited_at,omitempty"`
+	TaskID     int64       `json:"task_id"`
+	UserID     int64       `json:"user_id"`
+	AuthorName string      `json:"author_name"`
+	// The URL of the author's avatar, or null if they haven't uploaded one.
+	AuthorAvatarURL *string `json:"author_avatar_url"`
+	ParentID        *int64  `json:"parent_id,omitempty"`
+	Body            string  `json:"body" validate:"required,max=5000"`
+	Version         int32   `json:"version"`
+	// The body rendered from Markdown, only sent to clients asking for it with
+	// ?render=html.
+	BodyHTML string `json:"body_html,omitempty"`
+}
+
+// CommentEdit is a previous version of a comment's body.
+type CommentEdit struct {
+	Body     string     `json:"body"`
+	EditedAt CustomTime `json:"edited_at"`
+	BodyHTML string     `json:"body_html,omitempty"`
+}
+
+// maxRenderedComment is how long a comment's body may be once rendered as HTML.
+const maxRenderedComment = 40000
+
+// ValidateComment checks a comment against the rules in the tags of its fields, and the
+// length of its body once rendered.
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Struct(comment)
+	v.Check(len(markdown.ToHTML(comment.Body)) <= maxRenderedComment, "body", fmt.Sprintf("must not be more than %d bytes long once rendered as HTML", maxRenderedComment))
+}
+
+// avatarURLDest scans the author's avatar into AuthorAvatarURL.
+func (comment *Comment) avatarURLDest() avatarURLDest {
+	return avatarURLDest{userID: &comment.UserID, url: &comment.AuthorAvatarURL}
+}
+
+// RenderBody sets the comment's BodyHTML to its body rendered as HTML.
+func (comment *Comment) RenderBody() {
+	comment.BodyHTML = markdown.ToHTML(comment.Body)
+}
+
+// RenderBody sets the edit's BodyHTML to its body rendered as HTML.
+func (edit *CommentEdit) RenderBody() {
+	edit.BodyHTML = markdown.ToHTML(edit.Body)
+}
+
+// Define a CommentModel struct type which wraps a sql.DB connection pool.
+type CommentModel struct {
+	DB dbConn
+}
+
+// Insert a new comment. The author name is read back so that the returned comment
+// looks the same as one fetched with Get().
+func (m CommentModel) Insert(ctx context.Context, comment *Comment) error {
+	query := `
+		WITH inserted AS (
+			INSERT INTO comments (task_id, user_id, parent_id, body)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, user_id, version
+		)
+		SELECT inserted.id, inserted.created_at, users.name, avatars.updated_at, inserted.version
+		FROM inserted
+		INNER JOIN users ON users.id = inserted.user_id
+		` + avatarJoin
+	args := []interface{}{comment.TaskID, comment.UserID, comment.ParentID, comment.Body}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	// SQLite can't insert in a WITH query, so there the author is read separately.
+	if !m.DB.dialect.writableCTEs() {
+		query = `
+			INSERT INTO comments (task_id, user_id, parent_id, body)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, version`
+		err := m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.Version)
+		if err != nil {
+			return err
+		}
+		query = `SELECT users.name, avatars.updated_at FROM users ` + avatarJoin + ` WHERE users.id = $1`
+		return m.DB.QueryRowContext(ctx, query, comment.UserID).Scan(&comment.AuthorName, comment.avatarURLDest())
+	}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.AuthorName, comment.avatarURLDest(), &comment.Version)
+}
+
+// Get fetches a specific comment on a specific task.
+func (m CommentModel) Get(ctx context.Context, id int64, taskID int64) (*Comment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT comments.id, comments.created_at, comments.edited_at, comments.task_id, comments.user_id,
+			users.name, avatars.updated_at, comments.parent_id, comments.body, comments.version
+		FROM comments
+		INNER JOIN users ON users.id = comments.user_id
+		` + avatarJoin + `
+		WHERE comments.id = $1 AND comments.task_id = $2`
+	var comment Comment
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, taskID).Scan(
+		&comment.ID,
+		&comment.CreatedAt,
+		&comment.EditedAt,
+		&comment.TaskID,
+		&comment.UserID,
+		&comment.AuthorName,
+		comment.avatarURLDest(),
+		&comment.ParentID,
+		&comment.Body,
+		&comment.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &comment, nil
+}
+
+// GetAllForTask returns a page of the comments on a task.
+func (m CommentModel) GetAllForTask(ctx context.Context, taskID int64, filters Filters) ([]*Comment, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), comments.id, comments.created_at, comments.edited_at, comments.task_id,
+			comments.user_id, users.name, avatars.updated_at, comments.parent_id, comments.body, comments.version
+		FROM comments
+		INNER JOIN users ON users.id = comments.user_id
+		`+avatarJoin+`
+		WHERE comments.task_id = $1
+		ORDER BY comments.%s %s, comments.id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, taskID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	comments := []*Comment{}
+
+	for rows.Next() {
+		var comment Comment
+		err := rows.Scan(
+			&totalRecords,
+			&comment.ID,
+			&comment.CreatedAt,
+			&comment.EditedAt,
+			&comment.TaskID,
+			&comment.UserID,
+			&comment.AuthorName,
+			comment.avatarURLDest(),
+			&comment.ParentID,
+			&comment.Body,
+			&comment.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		comments = append(comments, &comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return comments, metadata, nil
+}
+
+// Update changes the body of a comment and records the previous body in the edit
+// history, both inside one transaction.
+func (m CommentModel) Update(ctx context.Context, comment *Comment, previousBody string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE comments
+		SET body = $1, edited_at = NOW(), version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING edited_at, version`
+	err = tx.QueryRowContext(ctx, query, comment.Body, comment.ID, comment.Version).Scan(&comment.EditedAt, &comment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+		INSERT INTO comment_edits (comment_id, body)
+		VALUES ($1, $2)`
+	_, err = tx.ExecContext(ctx, query, comment.ID, previousBody)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete a comment (and, through the foreign key, all replies to it).
+func (m CommentModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM comments
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetHistory returns the previous bodies of a comment, newest first.
+func (m CommentModel) GetHistory(ctx context.Context, commentID int64) ([]*CommentEdit, error) {
+	query := `
+		SELECT body, edited_at
+		FROM comment_edits
+		WHERE comment_id = $1
+		ORDER BY edited_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := []*CommentEdit{}
+	for rows.Next() {
+		var edit CommentEdit
+		err := rows.Scan(&edit.Body, &edit.EditedAt)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, &edit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
@@ -0,0 +1,386 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// Define the types a custom field can have.
+const (
+	CustomFieldText   = "text"
+	CustomFieldNumber = "number"
+	CustomFieldDate   = "date"
+	CustomFieldSelect = "select"
+)
+
+// CustomFieldTypes lists the types a custom field can have.
+var CustomFieldTypes = []string{CustomFieldText, CustomFieldNumber, CustomFieldDate, CustomFieldSelect}
+
+var ErrDuplicateCustomField = errors.New("duplicate custom field")
+
+// customFieldNameRX is what the names of custom fields look like. They are the keys of the
+// values on tasks and are given in ?custom.name= parameters, so they are kept simple.
+var customFieldNameRX = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// maxCustomFieldText is how long the value of a text field may be.
+const maxCustomFieldText = 500
+
+// CustomField is a field that a workspace's owners have added to its tasks. A select
+// field's value is one of its options.
+type CustomField struct {
+	ID          int64      `json:"id"`
+	CreatedAt   CustomTime `json:"created_at"`
+	WorkspaceID int64      `json:"workspace_id"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Options     []string   `json:"options,omitempty"`
+	Version     int32      `json:"version"`
+}
+
+func ValidateCustomField(v *validator.Validator, field *CustomField) {
+	v.Check(field.Name != "", "name", "must be provided")
+	v.Check(len(field.Name) <= 50, "name", "must not be more than 50 bytes long")
+	v.Check(field.Name == "" || customFieldNameRX.MatchString(field.Name), "name", "must start with a lowercase letter and contain only lowercase letters, digits and underscores")
+	v.Check(validator.In(field.Type, CustomFieldTypes...), "type", "must be one of "+strings.Join(CustomFieldTypes, ", "))
+	if field.Type != CustomFieldSelect {
+		v.Check(len(field.Options) == 0, "options", "must only be given for select fields")
+		return
+	}
+	v.Check(len(field.Options) > 0, "options", "must be provided")
+	v.Check(len(field.Options) <= 50, "options", "must not contain more than 50 elements")
+	v.Check(validator.Unique(field.Options), "options", "must not contain duplicate values")
+	for _, option := range field.Options {
+		v.Check(option != "", "options", "must not contain empty values")
+		v.Check(len(option) <= 100, "options", "must not contain values more than 100 bytes long")
+	}
+}
+
+// validValue reports whether value can be stored in the field: a string for text, date
+// (2006-01-02) and select fields, and a float64, as decoded from JSON, for number fields.
+func (field *CustomField) validValue(value interface{}) bool {
+	switch field.Type {
+	case CustomFieldNumber:
+		_, ok := value.(float64)
+		return ok
+	case CustomFieldDate:
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		_, err := time.Parse(time.DateOnly, s)
+		return err == nil
+	case CustomFieldSelect:
+		s, ok := value.(string)
+		return ok && validator.In(s, field.Options...)
+	default:
+		s, ok := value.(string)
+		return ok && len(s) <= maxCustomFieldText
+	}
+}
+
+// ValueMessage is the validation message for a value that validValue() turns down.
+func (field *CustomField) ValueMessage() string {
+	switch field.Type {
+	case CustomFieldNumber:
+		return "must be a number"
+	case CustomFieldDate:
+		return "must be a date (2006-01-02)"
+	case CustomFieldSelect:
+		return "must be one of " + strings.Join(field.Options, ", ")
+	default:
+		return fmt.Sprintf("must be a string of at most %d bytes", maxCustomFieldText)
+	}
+}
+
+// ParseValue reads a value of the field from a query string parameter, as given in
+// ?custom.name=value. It returns false if the text isn't a valid value.
+func (field *CustomField) ParseValue(s string) (interface{}, bool) {
+	var value interface{} = s
+	if field.Type == CustomFieldNumber {
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, false
+		}
+		value = n
+	}
+	return value, field.validValue(value)
+}
+
+// CustomFieldValues holds the values of a task's custom fields, keyed by the fields'
+// names. Fields without a value are left out.
+type CustomFieldValues map[string]interface{}
+
+func (values CustomFieldValues) Value() (driver.Value, error) {
+	if values == nil {
+		return "{}", nil
+	}
+	js, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return string(js), nil
+}
+
+func (values *CustomFieldValues) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(src), values)
+	case []byte:
+		return json.Unmarshal(src, values)
+	case nil:
+		*values = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into custom field values", src)
+	}
+}
+
+// ValidateCustomFieldValues checks that each of a task's values belongs to one of the
+// workspace's custom fields, and suits its type. The errors are keyed custom_fields.name.
+func ValidateCustomFieldValues(v *validator.Validator, fields []*CustomField, values CustomFieldValues) {
+	byName := make(map[string]*CustomField, len(fields))
+	for _, field := range fields {
+		byName[field.Name] = field
+	}
+	for name, value := range values {
+		key := "custom_fields." + name
+		field, ok := byName[name]
+		if !ok {
+			v.AddError(key, "must be one of the workspace's custom fields")
+			continue
+		}
+		v.Check(field.validValue(value), key, field.ValueMessage())
+	}
+}
+
+// CustomFieldFilter picks out the tasks whose custom field Name has Value, as parsed by
+// CustomField.ParseValue().
+type CustomFieldFilter struct {
+	Name  string
+	Value interface{}
+}
+
+// match reports whether a task meets the filter, for the mocks.
+func (cf CustomFieldFilter) match(task *Task) bool {
+	return task.CustomFields[cf.Name] == cf.Value
+}
+
+// Define a CustomFieldModel struct type which wraps a sql.DB connection pool.
+type CustomFieldModel struct {
+	DB    dbConn
+	cache workspaceCache
+}
+
+// Insert adds a custom field to a workspace.
+func (m CustomFieldModel) Insert(ctx context.Context, field *CustomField) error {
+	options, err := customFieldOptions(field.Options)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO custom_fields (workspace_id, name, type, options)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, field.WorkspaceID, field.Name, field.Type, options).Scan(&field.ID, &field.CreatedAt, &field.Version)
+	if err != nil {
+		switch {
+		case m.DB.dialect.isUniqueViolation(err, "custom_fields_workspace_id_name_key"):
+			return ErrDuplicateCustomField
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// customFieldOptions encodes the options of a custom field for the options column, which
+// holds a JSON array.
+func customFieldOptions(options []string) (string, error) {
+	if options == nil {
+		options = []string{}
+	}
+	js, err := json.Marshal(options)
+	return string(js), err
+}
+
+// Get fetches a specific custom field of a workspace.
+func (m CustomFieldModel) Get(ctx context.Context, id int64, workspaceID int64) (*CustomField, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, workspace_id, name, type, options, version
+		FROM custom_fields
+		WHERE id = $1 AND workspace_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	fields, err := m.query(ctx, query, id, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	return fields[0], nil
+}
+
+// GetAllForWorkspace returns a workspace's custom fields sorted by name.
+func (m CustomFieldModel) GetAllForWorkspace(ctx context.Context, workspaceID int64) ([]*CustomField, error) {
+	query := `
+		SELECT id, created_at, workspace_id, name, type, options, version
+		FROM custom_fields
+		WHERE workspace_id = $1
+		ORDER BY name ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.query(ctx, query, workspaceID)
+}
+
+func (m CustomFieldModel) query(ctx context.Context, query string, args ...interface{}) ([]*CustomField, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []*CustomField{}
+	for rows.Next() {
+		var field CustomField
+		var options []byte
+		err := rows.Scan(&field.ID, &field.CreatedAt, &field.WorkspaceID, &field.Name, &field.Type, &options, &field.Version)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(options, &field.Options); err != nil {
+			return nil, err
+		}
+		fields = append(fields, &field)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// Update saves a custom field's options. Its name and type can't be changed, since the
+// values on the tasks depend on them.
+func (m CustomFieldModel) Update(ctx context.Context, field *CustomField) error {
+	options, err := customFieldOptions(field.Options)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE custom_fields
+		SET options = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, options, field.ID, field.Version).Scan(&field.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// ValuesInUse returns the distinct values that the workspace's tasks have for a custom
+// field, so that a select field's options aren't removed while tasks still use them.
+func (m CustomFieldModel) ValuesInUse(ctx context.Context, field *CustomField) ([]string, error) {
+	value := m.DB.dialect.jsonText("custom_fields", "$2")
+	query := `
+		SELECT DISTINCT ` + value + `
+		FROM tasks
+		WHERE workspace_id = $1 AND ` + value + ` IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, field.WorkspaceID, field.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Delete removes a custom field from a workspace, along with its values on the tasks, in
+// a single transaction.
+func (m CustomFieldModel) Delete(ctx context.Context, id int64, workspaceID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM custom_fields
+		WHERE id = $1 AND workspace_id = $2
+		RETURNING name`
+	var name string
+	err = tx.QueryRowContext(ctx, query, id, workspaceID).Scan(&name)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	query = `
+		UPDATE tasks
+		SET custom_fields = ` + m.DB.dialect.jsonRemove("custom_fields", "$2") + `, updated_at = NOW()
+		WHERE workspace_id = $1 AND ` + m.DB.dialect.jsonText("custom_fields", "$2") + ` IS NOT NULL`
+	_, err = tx.ExecContext(ctx, query, workspaceID, name)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	m.cache.invalidate(workspaceID)
+	return nil
+}
@@ -0,0 +1,179 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrDependencyCycle = errors.New("dependency cycle")
+
+// TaskRef is a short reference to a related task, used when embedding blockers and
+// dependents in a task response.
+type TaskRef struct {
+	ID     int64      `json:"id"`
+	Title  string     `json:"title"`
+	Status TaskStatus `json:"status"`
+}
+
+// Define a DependencyModel struct type which wraps a sql.DB connection pool. A row in
+// task_dependencies says that task_id is blocked by blocked_by_id.
+type DependencyModel struct {
+	DB dbConn
+}
+
+// Add records that a task is blocked by another task. Declaring the same dependency
+// twice is not an error, but one that would close a loop (A blocked by B blocked by A)
+// returns ErrDependencyCycle.
+func (m DependencyModel) Add(ctx context.Context, taskID int64, blockerID int64) error {
+	if taskID == blockerID {
+		return ErrDependencyCycle
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Walk everything the blocker is (transitively) waiting on. If the task is among
+	// them, the new dependency would make both tasks wait on each other forever.
+	query := `
+		WITH RECURSIVE upstream (id) AS (
+			SELECT blocked_by_id FROM task_dependencies WHERE task_id = $2
+			UNION
+			SELECT task_dependencies.blocked_by_id
+			FROM task_dependencies
+			INNER JOIN upstream ON task_dependencies.task_id = upstream.id
+		)
+		SELECT EXISTS (SELECT 1 FROM upstream WHERE id = $1)`
+	var cycle bool
+	err = tx.QueryRowContext(ctx, query, taskID, blockerID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrDependencyCycle
+	}
+
+	query = `
+		INSERT INTO task_dependencies (task_id, blocked_by_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+	_, err = tx.ExecContext(ctx, query, taskID, blockerID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Remove deletes a dependency between two tasks.
+func (m DependencyModel) Remove(ctx context.Context, taskID int64, blockerID int64) error {
+	query := `
+		DELETE FROM task_dependencies
+		WHERE task_id = $1 AND blocked_by_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, taskID, blockerID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetBlockers returns the tasks that a task is blocked by.
+func (m DependencyModel) GetBlockers(ctx context.Context, taskID int64) ([]*TaskRef, error) {
+	query := `
+		SELECT tasks.id, tasks.title, tasks.status
+		FROM task_dependencies
+		INNER JOIN tasks ON tasks.id = task_dependencies.blocked_by_id
+		WHERE task_dependencies.task_id = $1
+		ORDER BY tasks.id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.query(ctx, query, taskID)
+}
+
+// GetDependents returns the tasks that are blocked by a task.
+func (m DependencyModel) GetDependents(ctx context.Context, taskID int64) ([]*TaskRef, error) {
+	query := `
+		SELECT tasks.id, tasks.title, tasks.status
+		FROM task_dependencies
+		INNER JOIN tasks ON tasks.id = task_dependencies.task_id
+		WHERE task_dependencies.blocked_by_id = $1
+		ORDER BY tasks.id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.query(ctx, query, taskID)
+}
+
+func (m DependencyModel) query(ctx context.Context, query string, args ...interface{}) ([]*TaskRef, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := []*TaskRef{}
+	for rows.Next() {
+		var ref TaskRef
+		err := rows.Scan(&ref.ID, &ref.Title, &ref.Status)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, &ref)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// CheckBlockers returns a *TransitionError if task is being completed (coming from the
+// status from) while some of the tasks it is blocked by are still open.
+func (m DependencyModel) CheckBlockers(ctx context.Context, task *Task, from TaskStatus) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return checkBlockers(ctx, m.DB, task, from)
+}
+
+func checkBlockers(ctx context.Context, q queryer, task *Task, from TaskStatus) error {
+	if task.Status != StatusCompleted || from == StatusCompleted {
+		return nil
+	}
+
+	query := `
+		SELECT count(*)
+		FROM task_dependencies
+		INNER JOIN tasks ON tasks.id = task_dependencies.blocked_by_id
+		WHERE task_dependencies.task_id = $1 AND tasks.status <> 'completed'`
+	var open int
+	err := q.QueryRowContext(ctx, query, task.ID).Scan(&open)
+	if err != nil {
+		return err
+	}
+	if open > 0 {
+		return &TransitionError{From: from, To: task.Status, Rule: fmt.Sprintf("the task is blocked by %d open task(s)", open)}
+	}
+	return nil
+}
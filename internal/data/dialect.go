@@ -0,0 +1,298 @@
+package data
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Define the database drivers that the models can run on, as chosen with -db-driver.
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Drivers lists the supported database drivers.
+var Drivers = []string{DriverPostgres, DriverSQLite}
+
+// dialect hides the differences between the SQL understood by the supported databases.
+// Queries are written for PostgreSQL, and the SQLite driver translates the parts that
+// only differ in spelling, see sqliteQuery(). Everything else that is specific to one
+// database is built by the dialect.
+//
+// Both databases support RETURNING, upserts, window functions and FILTER clauses, so those
+// are used as they are.
+type dialect interface {
+	// name identifies the database in traces.
+	name() string
+
+	// choose returns the query for the database the models run on, for the few queries
+	// that have to be written separately.
+	choose(postgres, sqlite string) string
+
+	// array wraps a slice, or a pointer to one, so that it can be passed as an argument
+	// or scanned into.
+	array(a interface{}) interface{}
+
+	// anyOf returns a condition that is true if expr is one of the elements of an array.
+	anyOf(expr, array string) string
+
+	// writableCTEs reports whether INSERT, UPDATE and DELETE can be used in a WITH query,
+	// which SQLite doesn't allow.
+	writableCTEs() bool
+
+	// timeZones reports whether the database can convert times to other time zones, which
+	// SQLite can't.
+	timeZones() bool
+
+	// arrayAgg returns an aggregate that collects the non-null values of expr, in order,
+	// into an array, which is empty if there are none.
+	arrayAgg(expr string) string
+
+	// textMatch returns a condition that is true if document contains every word of
+	// query, ignoring case.
+	textMatch(document, query string) string
+
+	// ilike returns a condition that is true if expr matches a LIKE pattern, ignoring
+	// case. Backslashes escape the wildcards in the pattern.
+	ilike(expr, pattern string) string
+
+	// search returns a condition that is true if a row matches a search built by
+	// searchQuery(), and searchRank an expression for ordering the results by how well
+	// they match, with matches in title counting for more than matches in body.
+	// PostgreSQL uses the row's generated tsvector column, which is built from the same
+	// text; SQLite searches title and body themselves.
+	search(column, title, body, query string) string
+	searchRank(column, title, body, query string) string
+
+	// addSeconds returns a timestamp expression plus a number of seconds.
+	addSeconds(timestamp, seconds string) string
+
+	// secondsBetween returns the number of seconds from one timestamp to another.
+	secondsBetween(from, to string) string
+
+	// jsonText and jsonNumber return the value of a key of the JSON object in column, as
+	// text or as a number, and jsonRemove the object without the key.
+	jsonText(column, key string) string
+	jsonNumber(column, key string) string
+	jsonRemove(column, key string) string
+
+	// isUniqueViolation and isForeignKeyViolation report whether err was caused by the
+	// named constraint.
+	isUniqueViolation(err error, constraint string) bool
+	isForeignKeyViolation(err error, constraint string) bool
+}
+
+// dialectFor returns the dialect of the database that a connection pool is opened on.
+func dialectFor(db *sql.DB) dialect {
+	if db != nil {
+		if _, ok := db.Driver().(sqliteDriver); ok {
+			return sqliteDialect{}
+		}
+	}
+	return postgresDialect{}
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) name() string {
+	return "postgresql"
+}
+
+func (postgresDialect) choose(postgres, sqlite string) string {
+	return postgres
+}
+
+func (postgresDialect) array(a interface{}) interface{} {
+	return pq.Array(a)
+}
+
+func (postgresDialect) anyOf(expr, array string) string {
+	return expr + " = ANY(" + array + ")"
+}
+
+func (postgresDialect) writableCTEs() bool {
+	return true
+}
+
+func (postgresDialect) timeZones() bool {
+	return true
+}
+
+func (postgresDialect) arrayAgg(expr string) string {
+	return fmt.Sprintf("COALESCE(array_agg(%[1]s ORDER BY %[1]s) FILTER (WHERE %[1]s IS NOT NULL), '{}')", expr)
+}
+
+func (postgresDialect) textMatch(document, query string) string {
+	return "to_tsvector('simple', " + document + ") @@ plainto_tsquery('simple', " + query + ")"
+}
+
+func (postgresDialect) ilike(expr, pattern string) string {
+	return expr + " ILIKE " + pattern
+}
+
+func (postgresDialect) search(column, title, body, query string) string {
+	return column + " @@ to_tsquery('simple', " + query + ")"
+}
+
+func (postgresDialect) searchRank(column, title, body, query string) string {
+	return "ts_rank(" + column + ", to_tsquery('simple', " + query + "))"
+}
+
+func (postgresDialect) addSeconds(timestamp, seconds string) string {
+	return "(" + timestamp + " + (" + seconds + ") * interval '1 second')"
+}
+
+func (postgresDialect) secondsBetween(from, to string) string {
+	return "EXTRACT(EPOCH FROM " + to + " - " + from + ")"
+}
+
+// The key is cast to text, since the operators also take array indexes.
+func (postgresDialect) jsonText(column, key string) string {
+	return "(" + column + " ->> " + key + "::text)"
+}
+
+func (postgresDialect) jsonNumber(column, key string) string {
+	return "(" + column + " ->> " + key + "::text)::numeric"
+}
+
+func (postgresDialect) jsonRemove(column, key string) string {
+	return "(" + column + " - " + key + "::text)"
+}
+
+func (postgresDialect) isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+func (postgresDialect) isForeignKeyViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503" && pqErr.Constraint == constraint
+}
+
+// sqliteDialect keeps arrays as JSON, and implements the text search and time arithmetic
+// with the functions registered by registerSQLiteFunctions().
+type sqliteDialect struct{}
+
+func (sqliteDialect) name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) choose(postgres, sqlite string) string {
+	return sqlite
+}
+
+func (sqliteDialect) array(a interface{}) interface{} {
+	return jsonArray{a}
+}
+
+func (sqliteDialect) anyOf(expr, array string) string {
+	return expr + " IN (SELECT value FROM json_each(" + array + "))"
+}
+
+func (sqliteDialect) writableCTEs() bool {
+	return false
+}
+
+func (sqliteDialect) timeZones() bool {
+	return false
+}
+
+func (sqliteDialect) arrayAgg(expr string) string {
+	return fmt.Sprintf("COALESCE(json_group_array(%[1]s ORDER BY %[1]s) FILTER (WHERE %[1]s IS NOT NULL), '[]')", expr)
+}
+
+func (sqliteDialect) textMatch(document, query string) string {
+	return "text_match(" + document + ", " + query + ")"
+}
+
+// LIKE ignores case in SQLite, though only for ASCII letters, and has no escape character
+// unless one is given.
+func (sqliteDialect) ilike(expr, pattern string) string {
+	return expr + " LIKE " + pattern + ` ESCAPE '\'`
+}
+
+func (sqliteDialect) search(column, title, body, query string) string {
+	return "text_search(" + title + " || ' ' || " + body + ", " + query + ")"
+}
+
+func (sqliteDialect) searchRank(column, title, body, query string) string {
+	return "text_search_rank(" + title + ", " + body + ", " + query + ")"
+}
+
+func (sqliteDialect) addSeconds(timestamp, seconds string) string {
+	return "add_seconds(" + timestamp + ", " + seconds + ")"
+}
+
+func (sqliteDialect) secondsBetween(from, to string) string {
+	return "(unixepoch(" + to + ") - unixepoch(" + from + "))"
+}
+
+// json_extract() returns JSON numbers as numbers and strings as text, so jsonText and
+// jsonNumber are the same. Keys are put in a JSON path as they are, which is safe for the
+// names of custom fields, see CustomField.
+func (sqliteDialect) jsonText(column, key string) string {
+	return "json_extract(" + column + ", '$.' || " + key + ")"
+}
+
+func (sqliteDialect) jsonNumber(column, key string) string {
+	return "json_extract(" + column + ", '$.' || " + key + ")"
+}
+
+func (sqliteDialect) jsonRemove(column, key string) string {
+	return "json_remove(" + column + ", '$.' || " + key + ")"
+}
+
+// sqliteUniqueColumns maps the names of the unique constraints, as they are called in
+// PostgreSQL, to the columns that SQLite names when one is violated.
+var sqliteUniqueColumns = map[string]string{
+	"categories_workspace_id_name_key":    "categories.workspace_id, categories.name",
+	"custom_fields_workspace_id_name_key": "custom_fields.workspace_id, custom_fields.name",
+	"tags_user_id_name_key":               "tags.user_id, tags.name",
+	"time_entries_running_idx":            "time_entries.user_id",
+	"users_email_key":                     "users.email",
+}
+
+func (sqliteDialect) isUniqueViolation(err error, constraint string) bool {
+	return err.Error() == "UNIQUE constraint failed: "+sqliteUniqueColumns[constraint]
+}
+
+// SQLite doesn't say which foreign key constraint was violated, so any violation counts.
+func (sqliteDialect) isForeignKeyViolation(err error, constraint string) bool {
+	return err.Error() == "FOREIGN KEY constraint failed"
+}
+
+// jsonArray is an array argument or scan destination for SQLite, which keeps arrays as
+// JSON text.
+type jsonArray struct {
+	a interface{}
+}
+
+func (j jsonArray) Value() (driver.Value, error) {
+	js, err := json.Marshal(j.a)
+	if err != nil {
+		return nil, err
+	}
+	// A nil slice is passed as an empty array, since the array columns are NOT NULL.
+	if string(js) == "null" {
+		return "[]", nil
+	}
+	return string(js), nil
+}
+
+func (j jsonArray) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(src), j.a)
+	case []byte:
+		return json.Unmarshal(src, j.a)
+	case nil:
+		return json.Unmarshal([]byte("null"), j.a)
+	default:
+		return fmt.Errorf("cannot scan %T into an array", src)
+	}
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// DigestRecipient is a user who has opted in to the daily digest and hasn't received
+// today's yet.
+type DigestRecipient struct {
+	UserID   int64
+	Name     string
+	Email    string
+	Timezone string
+}
+
+// Digest groups a user's open tasks for the daily digest email.
+type Digest struct {
+	Overdue     []*Task
+	DueToday    []*Task
+	DueThisWeek []*Task
+}
+
+// Empty reports whether there is nothing worth emailing about.
+func (d Digest) Empty() bool {
+	return len(d.Overdue) == 0 && len(d.DueToday) == 0 && len(d.DueThisWeek) == 0
+}
+
+// Define a DigestModel struct type which wraps a sql.DB connection pool.
+type DigestModel struct {
+	DB dbConn
+}
+
+// GetTimezones returns the time zones of the users who have opted in to the digest, as
+// set in their profiles. The empty string stands for the users who haven't set one.
+// Each zone's day starts at a different time, so digests are sent zone by zone.
+func (m DigestModel) GetTimezones(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT DISTINCT users.timezone
+		FROM users
+		INNER JOIN user_settings ON user_settings.user_id = users.id
+		WHERE users.activated AND NOT users.deactivated
+		AND user_settings.daily_digest
+		ORDER BY users.timezone ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	timezones := []string{}
+	err := queryEach(ctx, m.DB, query, nil, func(rows *sql.Rows) error {
+		var timezone string
+		err := rows.Scan(&timezone)
+		timezones = append(timezones, timezone)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return timezones, nil
+}
+
+// GetRecipients returns the opted-in users in the given time zone who haven't been sent
+// a digest for the given day, in that zone, yet, and whose digest hour has come. hour is
+// the current hour of the day in the zone, and defaultHour the digest hour of the users
+// who haven't chosen one.
+func (m DigestModel) GetRecipients(ctx context.Context, timezone string, day time.Time, hour, defaultHour, limit int) ([]*DigestRecipient, error) {
+	query := `
+		SELECT users.id, users.name, users.email, users.timezone
+		FROM users
+		INNER JOIN user_settings ON user_settings.user_id = users.id
+		WHERE users.activated AND NOT users.deactivated
+		AND users.timezone = $1
+		AND user_settings.daily_digest
+		AND (user_settings.digest_sent_on IS NULL OR user_settings.digest_sent_on < $2::date)
+		AND COALESCE(user_settings.digest_hour, $3) <= $4
+		ORDER BY users.id ASC
+		LIMIT $5`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, timezone, day.Format("2006-01-02"), defaultHour, hour, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []*DigestRecipient{}
+	for rows.Next() {
+		var recipient DigestRecipient
+		err := rows.Scan(&recipient.UserID, &recipient.Name, &recipient.Email, &recipient.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, &recipient)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return recipients, nil
+}
+
+// Get builds a user's digest. now is the current time and day the start of the current
+// day, both in the time zone the digest is written for. Tasks due before now are
+// overdue, the rest of today's are due today, and those in the following six days are
+// due this week. Snoozed tasks are left out.
+func (m DigestModel) Get(ctx context.Context, userID int64, now time.Time, day time.Time) (*Digest, error) {
+	endOfToday := day.AddDate(0, 0, 1)
+	endOfWeek := day.AddDate(0, 0, 7)
+
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE user_id = $1 AND status <> 'completed' AND NOT archived AND due_date < $2
+		AND (snoozed_until IS NULL OR snoozed_until <= $3)
+		ORDER BY due_date ASC, id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, endOfWeek, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var digest Digest
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(task.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		due := time.Time(task.DueDate)
+		switch {
+		case due.Before(now):
+			digest.Overdue = append(digest.Overdue, &task)
+		case due.Before(endOfToday):
+			digest.DueToday = append(digest.DueToday, &task)
+		default:
+			digest.DueThisWeek = append(digest.DueThisWeek, &task)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return &digest, nil
+}
+
+// MarkSent records that a user's digest for the given day has been dealt with.
+func (m DigestModel) MarkSent(ctx context.Context, userID int64, day time.Time) error {
+	query := `
+		UPDATE user_settings
+		SET digest_sent_on = $2::date
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, day.Format("2006-01-02"))
+	return err
+}
@@ -3,25 +3,123 @@ package data
 import (
 	"database/sql/driver"
 	"errors"
-	"fmt"
 	"strconv"
+	"sync"
 	"time"
 )
 
 // Define an error that our UnmarshalJSON() method
 // can return if we're unable to parse  or convert the JSON string successfully.
-var ErrInvalidTimeFormat = errors.New("invalid Time format")
+var ErrInvalidTimeFormat = errors.New("times must be in RFC 3339 (2006-01-02T15:04:05Z), 2006-01-02 or 2006-01-02 15:04:05 format")
 
+// The formats that times can be written in, chosen with SetTimeFormat(). TimeFormatLegacy
+// is the layout used before RFC 3339, which has no time zone; it is kept for clients that
+// haven't moved on yet.
+const (
+	TimeFormatRFC3339 = "rfc3339"
+	TimeFormatLegacy  = "legacy"
+
+	legacyLayout = "2006-01-02 15:04:05"
+	dateLayout   = "2006-01-02"
+)
+
+// TimeFormats lists the formats accepted by SetTimeFormat().
+var TimeFormats = []string{TimeFormatRFC3339, TimeFormatLegacy}
+
+// timeFormat is the format that CustomTime values are written in. It is only changed at
+// startup, before any are.
+var timeFormat = TimeFormatRFC3339
+
+// SetTimeFormat sets the format that CustomTime values are written in, which is RFC 3339
+// in UTC unless it is set to TimeFormatLegacy. Whatever the format, all of the layouts
+// accepted by ParseTime() can be read.
+func SetTimeFormat(format string) {
+	timeFormat = format
+}
+
+// TimeFormat returns the format set with SetTimeFormat().
+func TimeFormat() string {
+	return timeFormat
+}
+
+// zones caches the locations loaded by LoadZone(), by name.
+var zones sync.Map
+
+// LoadZone returns the time zone with the given IANA name, such as "Europe/Moscow",
+// loading it only once. Times moved into a zone returned by LoadZone are written in that
+// zone by FormatTime(), which is how due dates are shown in their owner's time zone.
+func LoadZone(name string) (*time.Location, error) {
+	if loc, ok := zones.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := zones.LoadOrStore(name, loc)
+	return actual.(*time.Location), nil
+}
+
+// userZone reports whether a location is one returned by LoadZone().
+func userZone(loc *time.Location) bool {
+	cached, ok := zones.Load(loc.String())
+	return ok && cached == loc
+}
+
+// dateZone is the location of the times read from a date on its own, which stands for
+// midnight wherever the user is rather than for an instant. Until ResolveDate() places
+// such a time in a user's time zone it is midnight UTC.
+var dateZone = time.FixedZone("date", 0)
+
+// FormatTime writes a time in the format set with SetTimeFormat(). RFC 3339 times are
+// written in UTC, unless they are in a zone returned by LoadZone(), in which case they
+// keep its offset.
+func FormatTime(t time.Time) string {
+	if timeFormat == TimeFormatLegacy {
+		return t.Format(legacyLayout)
+	}
+	if !userZone(t.Location()) {
+		t = t.UTC()
+	}
+	return t.Format(time.RFC3339)
+}
+
+// ParseTime reads a time in any of the layouts CustomTime accepts: RFC 3339, a date on its
+// own (2006-01-02, meaning midnight) or the legacy "2006-01-02 15:04:05". Legacy times are
+// read as UTC, and dates as midnight UTC until ResolveDate() places them in a time zone.
+func ParseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse(legacyLayout, s)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.ParseInLocation(dateLayout, s, dateZone)
+	if err == nil {
+		return t, nil
+	}
+	return time.Time{}, ErrInvalidTimeFormat
+}
+
+// CustomTime is a time that is written in the format set with SetTimeFormat(). The zero
+// value stands for no time at all, such as a task without a due date: it is written to
+// JSON as null and stored as NULL, and both are read back as the zero value.
 type CustomTime time.Time
 
 func (ct CustomTime) MarshalJSON() ([]byte, error) {
-	formattedTime := time.Time(ct).Format("2006-01-02 15:04:05")
-	quotedJSONValue := strconv.Quote(formattedTime)
-	return []byte(quotedJSONValue), nil
+	if ct.IsZero() {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.Quote(FormatTime(time.Time(ct)))), nil
 }
 
 // Implement the database/sql/driver Val() method to convert CustomTime to a value that can be stored in the database.
 func (ct CustomTime) Value() (driver.Value, error) {
+	if ct.IsZero() {
+		return nil, nil
+	}
 	return time.Time(ct), nil
 }
 
@@ -44,18 +142,22 @@ func (ct *CustomTime) Scan(value interface{}) error {
 // we must use a pointer receiver for this to work correctly.
 // Otherwise, we will only be modifying a copy (which is then discarded when this method returns).
 func (ct *CustomTime) UnmarshalJSON(jsonValue []byte) error {
-	// We expect the incoming JSON value to be a string in the format "YYYY-MM-DD HH:MM:SS",
-	// so we first remove the surrounding double-quotes from this string.
+	// null means no time at all, which is the zero value.
+	if string(jsonValue) == "null" {
+		*ct = CustomTime{}
+		return nil
+	}
+
+	// We expect the incoming JSON value to be a string in one of the layouts accepted by
+	// ParseTime(), so we first remove the surrounding double-quotes from this string.
 	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
 	if err != nil {
 		return ErrInvalidTimeFormat
 	}
 
-	// Now, parse the unquoted JSON string into a time.Time value using a specified layout.
-	// If the layout doesn't match the expected format, return the ErrInvalidTimeFormat error.
-	const layout = "2006-01-02 15:04:05"
-	parsedTime, err := time.Parse(layout, unquotedJSONValue)
-	fmt.Println(parsedTime)
+	// Now, parse the unquoted JSON string into a time.Time value.
+	// If it isn't in any of the layouts, return the ErrInvalidTimeFormat error.
+	parsedTime, err := ParseTime(unquotedJSONValue)
 	if err != nil {
 		return ErrInvalidTimeFormat
 	}
@@ -67,6 +169,32 @@ func (ct *CustomTime) UnmarshalJSON(jsonValue []byte) error {
 	return nil
 }
 
+// GobEncode and GobDecode let cached tasks and categories keep their times exactly, which
+// the JSON format above doesn't.
+func (ct CustomTime) GobEncode() ([]byte, error) {
+	return time.Time(ct).MarshalBinary()
+}
+
+func (ct *CustomTime) GobDecode(data []byte) error {
+	var t time.Time
+	err := t.UnmarshalBinary(data)
+	if err != nil {
+		return err
+	}
+	*ct = CustomTime(t)
+	return nil
+}
+
+// ResolveDate returns the time as meant by a user in the time zone loc: a time read from a
+// date on its own becomes midnight of that date in loc, and any other time is unchanged.
+func (ct CustomTime) ResolveDate(loc *time.Location) CustomTime {
+	t := time.Time(ct)
+	if t.Location() != dateZone {
+		return ct
+	}
+	return CustomTime(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc))
+}
+
 func (ct CustomTime) IsZero() bool {
 	return time.Time(ct).IsZero()
 }
@@ -78,3 +206,26 @@ func (ct CustomTime) Before(t time.Time) bool {
 func (ct CustomTime) After(t time.Time) bool {
 	return time.Time(ct).After(t)
 }
+
+// The shortcuts for filtering tasks by due date, see TaskFilters.Due.
+const (
+	DueOverdue  = "overdue"
+	DueToday    = "today"
+	DueThisWeek = "this_week"
+)
+
+// TaskDueFilters lists the values of TaskFilters.Due.
+var TaskDueFilters = []string{DueOverdue, DueToday, DueThisWeek}
+
+// SetDueStatus fills in the computed IsOverdue and DueInSeconds fields of a task as of now.
+// A task without a due date is never overdue, and has no DueInSeconds.
+func (task *Task) SetDueStatus(now time.Time) {
+	task.IsOverdue = false
+	task.DueInSeconds = nil
+	if task.DueDate.IsZero() {
+		return
+	}
+	seconds := int64(time.Time(task.DueDate).Sub(now) / time.Second)
+	task.DueInSeconds = &seconds
+	task.IsOverdue = task.Status != StatusCompleted && task.DueDate.Before(now)
+}
@@ -0,0 +1,130 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ScopeEmailChange is the scope of the tokens sent to confirm a new email address. They
+// are kept with the address they confirm, in their own table.
+const ScopeEmailChange = "email_change"
+
+// EmailChange is a pending change of a user's email address. The account keeps its old
+// address until the token sent to the new one is confirmed.
+type EmailChange struct {
+	Plaintext string
+	Hash      []byte
+	UserID    int64
+	Email     string
+	Expiry    time.Time
+}
+
+// Define an EmailChangeModel struct type which wraps a sql.DB connection pool.
+type EmailChangeModel struct {
+	DB dbConn
+}
+
+// New records a pending email change for a user. A user has at most one pending change, so
+// asking again replaces the earlier one and its token stops working.
+func (m EmailChangeModel) New(ctx context.Context, userID int64, email string, ttl time.Duration) (*EmailChange, error) {
+	token, err := generateToken(userID, ttl, ScopeEmailChange)
+	if err != nil {
+		return nil, err
+	}
+	change := &EmailChange{
+		Plaintext: token.Plaintext,
+		Hash:      token.Hash,
+		UserID:    userID,
+		Email:     email,
+		Expiry:    token.Expiry,
+	}
+
+	query := `
+		INSERT INTO email_changes (hash, user_id, email, expiry)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET hash = EXCLUDED.hash, email = EXCLUDED.email, expiry = EXCLUDED.expiry`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, change.Hash, userID, email, change.Expiry)
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// Confirm switches a user's email address to the one the token was sent to, and returns
+// the updated user along with their previous address. It returns ErrRecordNotFound for an
+// unknown or expired token, and ErrDuplicateEmail if another account has taken the address
+// in the meantime.
+func (m EmailChangeModel) Confirm(ctx context.Context, tokenPlaintext string) (*User, string, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM email_changes
+		WHERE hash = $1 AND expiry > $2
+		RETURNING user_id, email`
+	var userID int64
+	var email string
+	err = tx.QueryRowContext(ctx, query, hash[:], time.Now()).Scan(&userID, &email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, "", ErrRecordNotFound
+		default:
+			return nil, "", err
+		}
+	}
+
+	var previousEmail string
+	query = `
+		SELECT email
+		FROM users
+		WHERE id = $1
+		FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, userID).Scan(&previousEmail)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query = `
+		UPDATE users
+		SET email = $1, version = version + 1
+		WHERE id = $2
+		RETURNING id, created_at, name, email, password_hash, activated, deactivated, timezone, version`
+	var user User
+	err = tx.QueryRowContext(ctx, query, email, userID).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Deactivated,
+		&user.Timezone,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case m.DB.dialect.isUniqueViolation(err, "users_email_key"):
+			return nil, "", ErrDuplicateEmail
+		default:
+			return nil, "", err
+		}
+	}
+	return &user, previousEmail, tx.Commit()
+}
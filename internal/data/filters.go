@@ -3,6 +3,7 @@ package data
 import (
 	"github.com/zarinakolybaeva/DoMake/internal/validator"
 	"math"
+	"strconv"
 	"strings"
 
 )
@@ -13,6 +14,7 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	MaxPageSize  int // The largest page_size allowed, 100 if not set.
 }
 
 // Define a new Metadata struct for holding the pagination metadata.
@@ -78,7 +80,36 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page > 0, "page", "must be greater than zero")
 	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
-	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+	maxPageSize := f.MaxPageSize
+	if maxPageSize == 0 {
+		maxPageSize = 100
+	}
+	v.Check(f.PageSize <= maxPageSize, "page_size", "must be a maximum of "+strconv.Itoa(maxPageSize))
 	// Check that the sort parameter matches a value in the safelist.
 	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
 }
+
+// whereClause collects SQL conditions and their placeholder arguments for queries whose
+// WHERE clause depends on which filters the client supplied.
+type whereClause struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds a placeholder argument and returns its $N reference for use in the query.
+func (w *whereClause) arg(value interface{}) string {
+	w.args = append(w.args, value)
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+// add appends a condition. All conditions are combined with AND.
+func (w *whereClause) add(condition string) {
+	w.conditions = append(w.conditions, condition)
+}
+
+func (w *whereClause) String() string {
+	if len(w.conditions) == 0 {
+		return "true"
+	}
+	return strings.Join(w.conditions, " AND ")
+}
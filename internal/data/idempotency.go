@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyKey is a client-supplied Idempotency-Key, together with a fingerprint of the
+// request it was first used with and, once that request has finished, its response.
+type IdempotencyKey struct {
+	UserID      int64
+	Key         string
+	RequestHash []byte
+	Completed   bool
+	StatusCode  int
+	Header      map[string][]string
+	Body        []byte
+}
+
+// Define an IdempotencyModel struct type which wraps a sql.DB connection pool.
+type IdempotencyModel struct {
+	DB dbConn
+}
+
+// Reserve claims a key for a request. If the key is new (or its previous use has
+// expired) it is stored with the request's fingerprint and Reserve returns true. Otherwise
+// it returns false along with the stored key, which may still be waiting for its response.
+func (m IdempotencyModel) Reserve(ctx context.Context, userID int64, key string, requestHash []byte, ttl time.Duration) (*IdempotencyKey, bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (user_id, key, request_hash, expires_at)
+		VALUES ($1, $2, $3, ` + m.DB.dialect.addSeconds("NOW()", "$4") + `)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET created_at = NOW(), expires_at = EXCLUDED.expires_at, request_hash = EXCLUDED.request_hash,
+			status_code = NULL, header = NULL, body = NULL
+		WHERE idempotency_keys.expires_at <= NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, key, requestHash, int64(ttl/time.Second))
+	if err != nil {
+		return nil, false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+	if rowsAffected > 0 {
+		return &IdempotencyKey{UserID: userID, Key: key, RequestHash: requestHash}, true, nil
+	}
+
+	query = `
+		SELECT request_hash, status_code, header, body
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2`
+
+	stored := IdempotencyKey{UserID: userID, Key: key}
+	var statusCode sql.NullInt32
+	var header []byte
+	err = m.DB.QueryRowContext(ctx, query, userID, key).Scan(&stored.RequestHash, &statusCode, &header, &stored.Body)
+	if err != nil {
+		// The key can only have disappeared if it expired and was cleaned up in the
+		// meantime; report it as a conflict and let the client retry.
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, ErrEditConflict
+		}
+		return nil, false, err
+	}
+	if statusCode.Valid {
+		stored.Completed = true
+		stored.StatusCode = int(statusCode.Int32)
+		err = json.Unmarshal(header, &stored.Header)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return &stored, false, nil
+}
+
+// Complete stores the response to the request that reserved a key, so that it can be
+// replayed for later requests with the same key.
+func (m IdempotencyModel) Complete(ctx context.Context, key *IdempotencyKey) error {
+	header, err := json.Marshal(key.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $1, header = $2, body = $3
+		WHERE user_id = $4 AND key = $5`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, key.StatusCode, header, key.Body, key.UserID, key.Key)
+	return err
+}
+
+// Release forgets a key whose request failed without a response worth replaying, so that
+// the client can retry with the same key.
+func (m IdempotencyModel) Release(ctx context.Context, userID int64, key string) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2 AND status_code IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, key)
+	return err
+}
+
+// DeleteExpired removes keys whose replay window has passed.
+func (m IdempotencyModel) DeleteExpired(ctx context.Context) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE expires_at <= NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query)
+	return err
+}
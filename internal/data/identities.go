@@ -0,0 +1,142 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// scopeOAuthState is the scope of the state values handed to identity providers. They
+// are kept in their own table until the provider sends the user back, and are only tied
+// to a user when one was signed in already.
+const scopeOAuthState = "oauth_state"
+
+// Identity links a user to their account with an external identity provider.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	UserID    int64     `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Define an IdentityModel struct type which wraps a sql.DB connection pool.
+type IdentityModel struct {
+	DB dbConn
+}
+
+// GetUser returns the user linked to a provider account, or ErrRecordNotFound if the
+// account hasn't been linked to anyone yet.
+func (m IdentityModel) GetUser(ctx context.Context, provider, subject string) (*User, error) {
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.deactivated, users.timezone, users.version
+		FROM users
+		INNER JOIN user_identities ON user_identities.user_id = users.id
+		WHERE user_identities.provider = $1 AND user_identities.subject = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var user User
+	err := m.DB.QueryRowContext(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Deactivated,
+		&user.Timezone,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// Insert links a provider account to a user. Linking an account that is already linked
+// (say, by a concurrent sign in) is not an error; the existing link is kept.
+func (m IdentityModel) Insert(ctx context.Context, identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (provider, subject) DO NOTHING
+		RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	args := []interface{}{identity.Provider, identity.Subject, identity.UserID, identity.Email}
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&identity.CreatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// NewState returns a fresh state value for a sign in with the given provider. userID is
+// the user to link the provider account to, or 0 if nobody is signed in. Expired states
+// from sign ins that were never finished are cleared out at the same time.
+func (m IdentityModel) NewState(ctx context.Context, provider string, userID int64, ttl time.Duration) (string, error) {
+	token, err := generateToken(userID, ttl, scopeOAuthState)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM oauth_states WHERE expiry < NOW()`)
+	if err != nil {
+		return "", err
+	}
+
+	query := `
+		INSERT INTO oauth_states (hash, provider, expiry, user_id)
+		VALUES ($1, $2, $3, $4)`
+	var owner *int64
+	if userID != 0 {
+		owner = &userID
+	}
+	_, err = m.DB.ExecContext(ctx, query, token.Hash, provider, token.Expiry, owner)
+	if err != nil {
+		return "", err
+	}
+	return token.Plaintext, nil
+}
+
+// UseState checks a state value sent back by a provider and deletes it, so that it can
+// only be used once. It returns the ID of the user the state was issued to (0 if nobody
+// was signed in), or false if the state is unknown, expired or was issued for a different
+// provider.
+func (m IdentityModel) UseState(ctx context.Context, provider, state string) (int64, bool, error) {
+	hash := sha256.Sum256([]byte(state))
+
+	query := `
+		DELETE FROM oauth_states
+		WHERE hash = $1 AND provider = $2 AND expiry > $3
+		RETURNING COALESCE(user_id, 0)`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var userID int64
+	err := m.DB.QueryRowContext(ctx, query, hash[:], provider, time.Now()).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+	return userID, true, nil
+}
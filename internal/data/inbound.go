@@ -0,0 +1,209 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// Define the services that can push tasks to an inbound integration.
+const (
+	InboundEmail  = "email"
+	InboundZapier = "zapier"
+)
+
+// InboundProviders lists the services tasks can be created from, with
+// POST /v1/integrations/inbound/:provider.
+var InboundProviders = []string{InboundEmail, InboundZapier}
+
+// InboundIntegration lets a service, such as an email gateway or Zapier, create tasks in a
+// category of a workspace on behalf of the user who set it up. Its requests are signed with the secret,
+// which like a webhook's is only shown to the client once, when the integration is
+// created.
+type InboundIntegration struct {
+	ID             int64       `json:"id"`
+	CreatedAt      CustomTime  `json:"created_at"`
+	UserID         int64       `json:"-"`
+	WorkspaceID    int64       `json:"workspace_id"`
+	CategoryID     int64       `json:"category_id"`
+	Provider       string      `json:"provider"`
+	Secret         string      `json:"-"`
+	LastReceivedAt *CustomTime `json:"last_received_at,omitempty"`
+}
+
+func ValidateInboundIntegration(v *validator.Validator, integration *InboundIntegration) {
+	v.Check(integration.Provider != "", "provider", "must be provided")
+	v.Check(integration.CategoryID != 0, "category_id", "must be provided")
+	v.Check(integration.Provider == "" || validator.In(integration.Provider, InboundProviders...), "provider", "must be one of "+strings.Join(InboundProviders, ", "))
+}
+
+// Define an InboundIntegrationModel struct type which wraps a sql.DB connection pool.
+type InboundIntegrationModel struct {
+	DB dbConn
+}
+
+// Insert a new inbound integration.
+func (m InboundIntegrationModel) Insert(ctx context.Context, integration *InboundIntegration) error {
+	query := `
+		INSERT INTO inbound_integrations (user_id, workspace_id, category_id, provider, secret)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+	args := []interface{}{integration.UserID, integration.WorkspaceID, integration.CategoryID, integration.Provider, integration.Secret}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&integration.ID, &integration.CreatedAt)
+}
+
+// Get returns an inbound integration, whoever it belongs to, for checking the signature
+// of a request made to it.
+func (m InboundIntegrationModel) Get(ctx context.Context, id int64) (*InboundIntegration, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, user_id, workspace_id, category_id, provider, secret, last_received_at
+		FROM inbound_integrations
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var integration InboundIntegration
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(integration.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &integration, nil
+}
+
+// GetAllForUser returns a user's inbound integrations, oldest first.
+func (m InboundIntegrationModel) GetAllForUser(ctx context.Context, userID int64) ([]*InboundIntegration, error) {
+	query := `
+		SELECT id, created_at, user_id, workspace_id, category_id, provider, secret, last_received_at
+		FROM inbound_integrations
+		WHERE user_id = $1
+		ORDER BY id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	integrations := []*InboundIntegration{}
+	for rows.Next() {
+		var integration InboundIntegration
+		if err := rows.Scan(integration.scanDest()...); err != nil {
+			return nil, err
+		}
+		integrations = append(integrations, &integration)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return integrations, nil
+}
+
+// Delete an inbound integration belonging to a user.
+func (m InboundIntegrationModel) Delete(ctx context.Context, id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM inbound_integrations
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// RecordDelivery remembers the signature of a request received by an integration. It
+// returns false, without an error, if a request with the same signature was already
+// received, which makes the new one a replay.
+func (m InboundIntegrationModel) RecordDelivery(ctx context.Context, integration *InboundIntegration, signature string) (bool, error) {
+	query := `
+		INSERT INTO inbound_deliveries (integration_id, signature)
+		VALUES ($1, $2)
+		ON CONFLICT (integration_id, signature) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, integration.ID, signature)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	query = `
+		UPDATE inbound_integrations
+		SET last_received_at = NOW()
+		WHERE id = $1
+		RETURNING last_received_at`
+
+	err = m.DB.QueryRowContext(ctx, query, integration.ID).Scan(&integration.LastReceivedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteOldDeliveries forgets the signatures of the requests received longer than age
+// ago, once requests that old are turned away for their timestamp anyway.
+func (m InboundIntegrationModel) DeleteOldDeliveries(ctx context.Context, age time.Duration) error {
+	query := `
+		DELETE FROM inbound_deliveries
+		WHERE received_at < ` + m.DB.dialect.addSeconds("NOW()", "$1")
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, -int64(age/time.Second))
+	return err
+}
+
+func (integration *InboundIntegration) scanDest() []interface{} {
+	return []interface{}{
+		&integration.ID,
+		&integration.CreatedAt,
+		&integration.UserID,
+		&integration.WorkspaceID,
+		&integration.CategoryID,
+		&integration.Provider,
+		&integration.Secret,
+		&integration.LastReceivedAt,
+	}
+}
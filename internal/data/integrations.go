@@ -0,0 +1,265 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// Define the kinds of chat integrations.
+const (
+	IntegrationSlack    = "slack"
+	IntegrationTelegram = "telegram"
+)
+
+// IntegrationKinds lists the chat services reminders can be sent to.
+var IntegrationKinds = []string{IntegrationSlack, IntegrationTelegram}
+
+var (
+	// A Telegram bot token is the bot's ID and a secret, as given by @BotFather.
+	telegramBotTokenRX = regexp.MustCompile(`^\d+:[A-Za-z0-9_-]+$`)
+	// A Telegram chat is identified by its numeric ID, or a public channel by its username.
+	telegramChatIDRX = regexp.MustCompile(`^(-?\d+|@[A-Za-z0-9_]{5,32})$`)
+)
+
+// Integration is where a user's reminders are sent on a chat service: a Slack incoming
+// webhook, or a Telegram chat that a bot of theirs is in. The webhook URL and the bot
+// token are credentials, so like webhook secrets they are never sent back. LastError and
+// LastFailedAt are about the last delivery that failed, and are cleared by one that works.
+type Integration struct {
+	ID           int64       `json:"id"`
+	CreatedAt    CustomTime  `json:"created_at"`
+	UserID       int64       `json:"-"`
+	Kind         string      `json:"kind"`
+	WebhookURL   string      `json:"-"`
+	BotToken     string      `json:"-"`
+	ChatID       string      `json:"chat_id,omitempty"`
+	Enabled      bool        `json:"enabled"`
+	LastError    string      `json:"last_error,omitempty"`
+	LastFailedAt *CustomTime `json:"last_failed_at,omitempty"`
+	Version      int32       `json:"version"`
+}
+
+// slackWebhookHost is the host of Slack's incoming webhook URLs.
+const slackWebhookHost = "hooks.slack.com"
+
+func ValidateIntegration(v *validator.Validator, integration *Integration) {
+	switch integration.Kind {
+	case IntegrationSlack:
+		v.Check(integration.WebhookURL != "", "webhook_url", "must be provided")
+		v.Check(len(integration.WebhookURL) <= 2000, "webhook_url", "must not be more than 2000 bytes long")
+		if integration.WebhookURL != "" {
+			u, err := url.Parse(integration.WebhookURL)
+			// Only Slack's own host is allowed, so that the URL can't be used to make
+			// the server send requests elsewhere.
+			v.Check(err == nil && u.Scheme == "https" && u.Host == slackWebhookHost, "webhook_url", "must be a Slack incoming webhook URL, starting with https://"+slackWebhookHost+"/")
+		}
+	case IntegrationTelegram:
+		v.Check(integration.BotToken != "", "bot_token", "must be provided")
+		v.Check(integration.BotToken == "" || telegramBotTokenRX.MatchString(integration.BotToken), "bot_token", "must be a bot token from @BotFather")
+		v.Check(integration.ChatID != "", "chat_id", "must be provided")
+		v.Check(integration.ChatID == "" || telegramChatIDRX.MatchString(integration.ChatID), "chat_id", "must be a numeric chat ID or a channel @username")
+	default:
+		v.AddError("kind", fmt.Sprintf(validator.MsgOneOf, strings.Join(IntegrationKinds, ", ")))
+	}
+}
+
+// Define an IntegrationModel struct type which wraps a sql.DB connection pool.
+type IntegrationModel struct {
+	DB dbConn
+}
+
+// Save stores a user's integration of a kind, replacing the one they had. A new
+// configuration hasn't failed yet, so the last error is cleared.
+func (m IntegrationModel) Save(ctx context.Context, integration *Integration) error {
+	query := `
+		INSERT INTO integrations (user_id, kind, webhook_url, bot_token, chat_id, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, kind) DO UPDATE
+		SET webhook_url = EXCLUDED.webhook_url,
+			bot_token = EXCLUDED.bot_token,
+			chat_id = EXCLUDED.chat_id,
+			enabled = EXCLUDED.enabled,
+			last_error = '',
+			last_failed_at = NULL,
+			version = integrations.version + 1
+		RETURNING id, created_at, last_error, last_failed_at, version`
+	args := []interface{}{
+		integration.UserID,
+		integration.Kind,
+		integration.WebhookURL,
+		integration.BotToken,
+		integration.ChatID,
+		integration.Enabled,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&integration.ID,
+		&integration.CreatedAt,
+		&integration.LastError,
+		&integration.LastFailedAt,
+		&integration.Version,
+	)
+}
+
+// Get returns a user's integration of a kind, or ErrRecordNotFound if they have none.
+func (m IntegrationModel) Get(ctx context.Context, userID int64, kind string) (*Integration, error) {
+	query := `
+		SELECT id, created_at, user_id, kind, webhook_url, bot_token, chat_id, enabled,
+			last_error, last_failed_at, version
+		FROM integrations
+		WHERE user_id = $1 AND kind = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var integration Integration
+	err := m.DB.QueryRowContext(ctx, query, userID, kind).Scan(integration.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &integration, nil
+}
+
+// GetAllForUser returns a user's integrations, or only the enabled ones if enabledOnly is
+// set, ordered by kind.
+func (m IntegrationModel) GetAllForUser(ctx context.Context, userID int64, enabledOnly bool) ([]*Integration, error) {
+	query := `
+		SELECT id, created_at, user_id, kind, webhook_url, bot_token, chat_id, enabled,
+			last_error, last_failed_at, version
+		FROM integrations
+		WHERE user_id = $1 AND (enabled OR NOT $2)
+		ORDER BY kind ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, enabledOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	integrations := []*Integration{}
+	for rows.Next() {
+		var integration Integration
+		err := rows.Scan(integration.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		integrations = append(integrations, &integration)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return integrations, nil
+}
+
+// RecordDelivery saves the outcome of sending a message with an integration: the error,
+// or nil if it was delivered, which clears the last error. It reports whether the
+// integration has just started failing, i.e. this is the first error since it last worked.
+// That is decided by the database, so that of two messages failing at the same time only
+// one counts as the first.
+func (m IntegrationModel) RecordDelivery(ctx context.Context, integration *Integration, sendErr error) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	if sendErr == nil {
+		query := `
+			UPDATE integrations
+			SET last_error = '', last_failed_at = NULL
+			WHERE id = $1`
+		_, err := m.DB.ExecContext(ctx, query, integration.ID)
+		if err != nil {
+			return false, err
+		}
+		integration.LastError, integration.LastFailedAt = "", nil
+		return false, nil
+	}
+
+	query := `
+		UPDATE integrations
+		SET last_error = $2, last_failed_at = NOW()
+		WHERE id = $1 AND last_error = ''
+		RETURNING last_error, last_failed_at`
+	err := m.DB.QueryRowContext(ctx, query, integration.ID, sendErr.Error()).Scan(&integration.LastError, &integration.LastFailedAt)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	// It was failing already, or has been deleted since it was read.
+	query = `
+		UPDATE integrations
+		SET last_error = $2, last_failed_at = NOW()
+		WHERE id = $1
+		RETURNING last_error, last_failed_at`
+	err = m.DB.QueryRowContext(ctx, query, integration.ID, sendErr.Error()).Scan(&integration.LastError, &integration.LastFailedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// Delete removes a user's integration of a kind, returning ErrRecordNotFound if they have
+// none.
+func (m IntegrationModel) Delete(ctx context.Context, userID int64, kind string) error {
+	query := `
+		DELETE FROM integrations
+		WHERE user_id = $1 AND kind = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, kind)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (integration *Integration) scanDest() []interface{} {
+	return []interface{}{
+		&integration.ID,
+		&integration.CreatedAt,
+		&integration.UserID,
+		&integration.Kind,
+		&integration.WebhookURL,
+		&integration.BotToken,
+		&integration.ChatID,
+		&integration.Enabled,
+		&integration.LastError,
+		&integration.LastFailedAt,
+		&integration.Version,
+	}
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Failed sign ins are counted per account (by email address, whether or not the account
+// exists) and per client IP address.
+const (
+	LoginByAccount = "account"
+	LoginByIP      = "ip"
+)
+
+// Define a LoginAttemptModel struct type which wraps a sql.DB connection pool.
+type LoginAttemptModel struct {
+	DB dbConn
+}
+
+// BlockedUntil returns the time until which sign ins for the key are blocked, or the zero
+// time if they aren't.
+func (m LoginAttemptModel) BlockedUntil(ctx context.Context, kind, key string) (time.Time, error) {
+	query := `
+		SELECT blocked_until
+		FROM login_attempts
+		WHERE kind = $1 AND key = $2 AND blocked_until > $3`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var until time.Time
+	err := m.DB.QueryRowContext(ctx, query, kind, key, time.Now()).Scan(&until)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// RecordFailure counts a failed sign in for the key and returns the number of failures in
+// a row. Failures older than window are forgotten, so the count starts again at one.
+func (m LoginAttemptModel) RecordFailure(ctx context.Context, kind, key string, window time.Duration) (int, error) {
+	query := `
+		INSERT INTO login_attempts (kind, key, failures, last_failed_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (kind, key) DO UPDATE
+		SET failures = CASE WHEN login_attempts.last_failed_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failed_at = NOW()
+		RETURNING failures`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var failures int
+	err := m.DB.QueryRowContext(ctx, query, kind, key, time.Now().Add(-window)).Scan(&failures)
+	return failures, err
+}
+
+// Block stops sign ins for the key until the given time.
+func (m LoginAttemptModel) Block(ctx context.Context, kind, key string, until time.Time) error {
+	query := `
+		UPDATE login_attempts
+		SET blocked_until = $3
+		WHERE kind = $1 AND key = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, kind, key, until)
+	return err
+}
+
+// Reset forgets the failed sign ins for the key, after a successful one.
+func (m LoginAttemptModel) Reset(ctx context.Context, kind, key string) error {
+	query := `
+		DELETE FROM login_attempts
+		WHERE kind = $1 AND key = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, kind, key)
+	return err
+}
+
+// DeleteExpired removes the records that no longer block anything and whose failures are
+// older than window.
+func (m LoginAttemptModel) DeleteExpired(ctx context.Context, window time.Duration) error {
+	query := `
+		DELETE FROM login_attempts
+		WHERE last_failed_at < $1 AND (blocked_until IS NULL OR blocked_until < NOW())`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now().Add(-window))
+	return err
+}
@@ -0,0 +1,1047 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// Check that the mocks implement the interfaces.
+var (
+	_ TaskRepository       = (*MockTaskModel)(nil)
+	_ CategoryRepository   = (*MockCategoryModel)(nil)
+	_ UserRepository       = (*MockUserModel)(nil)
+	_ PermissionRepository = (*MockPermissionModel)(nil)
+	_ WorkspaceRepository  = (*MockWorkspaceModel)(nil)
+	_ SessionRepository    = (*MockSessionModel)(nil)
+	_ AuditRepository      = (*MockAuditModel)(nil)
+	_ WebhookRepository    = (*MockWebhookModel)(nil)
+	_ DependencyRepository = (*MockDependencyModel)(nil)
+	_ TimeEntryRepository  = (*MockTimeEntryModel)(nil)
+	_ PinRepository        = (*MockPinModel)(nil)
+	_ SettingsRepository   = (*MockSettingsModel)(nil)
+)
+
+// NewMockModels returns a Models struct whose repositories are kept in memory, so that
+// handlers can be tested without PostgreSQL. That covers the tasks and categories, the
+// users with their permissions, sessions and settings, workspaces, and what the task
+// handlers keep alongside tasks: dependencies, time entries, pins, the audit log and
+// webhooks. The mocks follow the SQL models as closely as is practical: IDs, versions and
+// board positions are handed out in the same way and the same errors are returned. The
+// other models have no database behind them and must not be used.
+func NewMockModels() Models {
+	store := &mockStore{
+		tasks:        make(map[int64]*Task),
+		materialized: make(map[int64]bool),
+		categories:   make(map[int64]*Category),
+		users:        make(map[int64]*User),
+		tokens:       make(map[[32]byte]mockToken),
+		permissions:  make(map[int64]Permissions),
+		workspaces:   make(map[int64]*mockWorkspace),
+		members:      make(map[int64]map[int64]mockMember),
+		invitations:  make(map[[32]byte]*Invitation),
+		settings:     make(map[int64]*Settings),
+		pins:         make(map[int64]map[int64]bool),
+		dependencies: make(map[int64]map[int64]bool),
+		timeEntries:  make(map[int64]*TimeEntry),
+		webhooks:     make(map[int64]*Webhook),
+		deliveries:   make(map[int64]*WebhookDelivery),
+	}
+	return Models{
+		Tasks:        &MockTaskModel{store: store},
+		Categories:   &MockCategoryModel{store: store},
+		Users:        &MockUserModel{store: store},
+		Permissions:  &MockPermissionModel{store: store},
+		Workspaces:   &MockWorkspaceModel{store: store},
+		Sessions:     &MockSessionModel{store: store},
+		Audit:        &MockAuditModel{store: store},
+		Webhooks:     &MockWebhookModel{store: store},
+		Dependencies: &MockDependencyModel{store: store},
+		TimeEntries:  &MockTimeEntryModel{store: store},
+		Pins:         &MockPinModel{store: store},
+		Settings:     &MockSettingsModel{store: store},
+	}
+}
+
+// mockStore holds the records of the mocks. Tasks and categories refer to each other, so
+// the mocks share a single store and lock.
+type mockStore struct {
+	mu              sync.Mutex
+	lastTaskID      int64
+	lastCategoryID  int64
+	lastUserID      int64
+	lastTokenID     int64
+	lastWorkspaceID int64
+	lastEntryID     int64
+	lastAuditID     int64
+	lastWebhookID   int64
+	lastDeliveryID  int64
+	tasks           map[int64]*Task
+	materialized    map[int64]bool // recurring tasks whose next occurrence has been created
+	categories      map[int64]*Category
+	users           map[int64]*User
+	tokens          map[[32]byte]mockToken
+	permissions     map[int64]Permissions
+	workspaces      map[int64]*mockWorkspace
+	members         map[int64]map[int64]mockMember // by workspace and then user ID
+	invitations     map[[32]byte]*Invitation
+	settings        map[int64]*Settings
+	pins            map[int64]map[int64]bool // by user and then task ID
+	dependencies    map[int64]map[int64]bool // by task and then blocker ID
+	timeEntries     map[int64]*TimeEntry
+	audit           []*AuditEntry
+	webhooks        map[int64]*Webhook
+	deliveries      map[int64]*WebhookDelivery
+}
+
+// mockToken is a token as kept in the tokens table. The tokens added with AddToken()
+// aren't sessions and have no ID.
+type mockToken struct {
+	id         int64
+	userID     int64
+	scope      string
+	expiry     time.Time
+	createdAt  time.Time
+	lastUsedAt *time.Time
+	userAgent  string
+	ip         string
+}
+
+// MockTaskModel is an in-memory TaskRepository. It doesn't know about tags or workspace
+// members, so filtering on tags matches no tasks, and GetAllForCalendar() returns the
+// tasks that the user created. Blockers are never reported by a TaskTx, and search
+// results aren't ranked.
+type MockTaskModel struct {
+	store *mockStore
+}
+
+func (m *MockTaskModel) Insert(ctx context.Context, task *Task) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.store.insertTask(task)
+	return nil
+}
+
+func (m *MockTaskModel) GetForWorkspace(ctx context.Context, id int64, workspaceID int64) (*Task, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	return m.store.getTaskForWorkspace(id, workspaceID)
+}
+
+func (m *MockTaskModel) GetMany(ctx context.Context, workspaceID int64, ids []int64) ([]*Task, error) {
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	tasks := m.store.findTasks(func(task *Task) bool {
+		return task.WorkspaceID == workspaceID && wanted[task.ID]
+	})
+	sortByID(tasks)
+	return tasks, nil
+}
+
+func (m *MockTaskModel) GetForCategories(ctx context.Context, workspaceID int64, categoryIDs []int64) ([]*Task, error) {
+	wanted := make(map[int64]bool, len(categoryIDs))
+	for _, id := range categoryIDs {
+		wanted[id] = true
+	}
+	tasks := m.store.findTasks(func(task *Task) bool {
+		return task.WorkspaceID == workspaceID && !task.Archived && wanted[task.CategoryID]
+	})
+	sortByID(tasks)
+	return tasks, nil
+}
+
+func (m *MockTaskModel) Update(ctx context.Context, task *Task) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	return m.store.updateTask(task)
+}
+
+func (m *MockTaskModel) DeleteForWorkspace(ctx context.Context, id int64, workspaceID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	return m.store.deleteTaskForWorkspace(id, workspaceID)
+}
+
+func (m *MockTaskModel) GetAllForWorkspace(ctx context.Context, workspaceID int64, tf TaskFilters, filters Filters) ([]*Task, Metadata, error) {
+	tasks := m.store.findTasks(func(task *Task) bool {
+		return task.WorkspaceID == workspaceID && tf.match(task)
+	})
+	// Like the SQL model, fall back to fuzzy matching when nothing matches exactly.
+	if len(tasks) == 0 && tf.canRetryFuzzy() {
+		tf.fuzzy = true
+		return m.GetAllForWorkspace(ctx, workspaceID, tf, filters)
+	}
+	sortRecords(tasks, filters, taskColumn, func(task *Task) int64 { return task.ID })
+	if tf.fuzzy {
+		text := tf.fuzzyText()
+		sort.SliceStable(tasks, func(i, j int) bool {
+			return wordSimilarity(text, tasks[i].Title) > wordSimilarity(text, tasks[j].Title)
+		})
+	}
+	tasks, metadata := paginate(tasks, filters)
+	return tasks, metadata, nil
+}
+
+func (m *MockTaskModel) StreamForWorkspace(ctx context.Context, workspaceID int64, tf TaskFilters, filters Filters, fn func(task *Task) error) (Metadata, error) {
+	tasks, metadata, err := m.GetAllForWorkspace(ctx, workspaceID, tf, filters)
+	if err != nil {
+		return Metadata{}, err
+	}
+	for _, task := range tasks {
+		err := fn(task)
+		if err != nil {
+			return Metadata{}, err
+		}
+	}
+	return metadata, nil
+}
+
+// match reports whether a task meets the conditions in tf, like the clause built by
+// where() does. The mocks don't keep tags or pins, so no task has any.
+func (tf TaskFilters) match(task *Task) bool {
+	switch {
+	case tf.fuzzy && tf.Title != "" && wordSimilarity(tf.Title, task.Title) < tf.Similarity:
+		return false
+	case tf.fuzzy && searchQuery(tf.Query) != "" && wordSimilarity(tf.Query, task.Title) < tf.Similarity:
+		return false
+	case !tf.fuzzy && !matchWords(task.Title, tf.Title, false):
+		return false
+	case !tf.fuzzy && !matchWords(task.Title+" "+task.Description, tf.Query, true):
+		return false
+	case len(tf.Tags) > 0:
+		return false
+	case tf.Pinned != nil && *tf.Pinned:
+		return false
+	case !tf.IncludeArchived && task.Archived:
+		return false
+	case !tf.IncludeSnoozed && task.IsSnoozed(time.Now()):
+		return false
+	case len(tf.Statuses) > 0 && !validator.In(string(task.Status), tf.Statuses...):
+		return false
+	case len(tf.Priorities) > 0 && !validator.In(string(task.Priority), tf.Priorities...):
+		return false
+	case tf.Category != "" && task.Category != tf.Category:
+		return false
+	case tf.CategoryID != 0 && task.CategoryID != tf.CategoryID:
+		return false
+	case !tf.DueBefore.IsZero() && (task.DueDate.IsZero() || !task.DueDate.Before(tf.DueBefore)):
+		return false
+	case !tf.DueAfter.IsZero() && (task.DueDate.IsZero() || !task.DueDate.After(tf.DueAfter)):
+		return false
+	case tf.HasDueDate != nil && *tf.HasDueDate == task.DueDate.IsZero():
+		return false
+	case !tf.CompletedBefore.IsZero() && (task.CompletedAt.IsZero() || !task.CompletedAt.Before(tf.CompletedBefore)):
+		return false
+	case !tf.CompletedAfter.IsZero() && (task.CompletedAt.IsZero() || !task.CompletedAt.After(tf.CompletedAfter)):
+		return false
+	case tf.Due != "" && !tf.matchDue(task):
+		return false
+	case tf.Available && task.IsScheduled(tf.Now):
+		return false
+	case tf.Scheduled && !task.IsScheduled(tf.Now):
+		return false
+	}
+	for _, cf := range tf.CustomFields {
+		if !cf.match(task) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchDue reports whether a task meets the tf.Due shortcut.
+func (tf TaskFilters) matchDue(task *Task) bool {
+	due := time.Time(task.DueDate)
+	if due.IsZero() {
+		return false
+	}
+	switch tf.Due {
+	case DueOverdue:
+		return due.Before(tf.Now) && task.Status != StatusCompleted
+	case DueToday:
+		return !due.Before(tf.Today) && due.Before(tf.Today.AddDate(0, 0, 1)) && !task.IsScheduled(tf.Now)
+	case DueThisWeek:
+		return !due.Before(tf.Today) && due.Before(tf.Today.AddDate(0, 0, 7))
+	}
+	return true
+}
+
+func (m *MockTaskModel) GetPendingRecurrences(ctx context.Context, limit int) ([]*Task, error) {
+	tasks := m.store.findTasks(func(task *Task) bool {
+		return task.Recurrence != "" && !m.store.materialized[task.ID] && task.Status == StatusCompleted
+	})
+	sortByID(tasks)
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+	}
+	return tasks, nil
+}
+
+func (m *MockTaskModel) InsertOccurrence(ctx context.Context, prev *Task, next *Task) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	if _, ok := m.store.tasks[prev.ID]; !ok || m.store.materialized[prev.ID] {
+		return ErrEditConflict
+	}
+	m.store.materialized[prev.ID] = true
+	if next != nil {
+		m.store.insertTask(next)
+	}
+	return nil
+}
+
+// Duplicate only inserts the copy, since the mocks don't keep subtasks or tags.
+func (m *MockTaskModel) Duplicate(ctx context.Context, sourceID int64, copy *Task, opts DuplicateOptions) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	if _, ok := m.store.tasks[sourceID]; !ok {
+		return ErrRecordNotFound
+	}
+	m.store.insertTask(copy)
+	return nil
+}
+
+func (m *MockTaskModel) GetAllForCalendar(ctx context.Context, userID int64) ([]*Task, error) {
+	tasks := m.store.findTasks(func(task *Task) bool {
+		return task.UserID == userID && !task.Archived
+	})
+	sortRecords(tasks, Filters{Sort: "due_date", SortSafelist: []string{"due_date"}}, taskColumn, func(task *Task) int64 { return task.ID })
+	return tasks, nil
+}
+
+func (m *MockTaskModel) ForEachForWorkspace(ctx context.Context, workspaceID int64, fn func(task *Task) error) error {
+	tasks := m.store.findTasks(func(task *Task) bool {
+		return task.WorkspaceID == workspaceID
+	})
+	sortByID(tasks)
+	for _, task := range tasks {
+		err := fn(task)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InTx runs fn and undoes its changes to the tasks and categories if it returns an
+// error. Unlike a database transaction, it isn't isolated from calls made at the same
+// time, and an undo also discards their changes.
+func (m *MockTaskModel) InTx(ctx context.Context, fn func(tx TaskTx) error) error {
+	m.store.mu.Lock()
+	saved := make(map[int64]*Task, len(m.store.tasks))
+	for id, task := range m.store.tasks {
+		copied := *task
+		saved[id] = &copied
+	}
+	savedCategories := make(map[int64]*Category, len(m.store.categories))
+	for id, category := range m.store.categories {
+		savedCategories[id] = copyCategory(category)
+	}
+	m.store.mu.Unlock()
+
+	err := fn(mockTaskTx{store: m.store})
+	if err != nil {
+		m.store.mu.Lock()
+		m.store.tasks = saved
+		m.store.categories = savedCategories
+		m.store.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (m *MockTaskModel) Move(ctx context.Context, task *Task, move TaskMove) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	var column []*Task
+	for _, other := range m.store.tasks {
+		if other.WorkspaceID == task.WorkspaceID && other.Status == move.Status && other.ID != task.ID {
+			column = append(column, other)
+		}
+	}
+	sort.Slice(column, func(i, j int) bool {
+		if column[i].Position != column[j].Position {
+			return column[i].Position < column[j].Position
+		}
+		return column[i].ID < column[j].ID
+	})
+	ids := make([]int64, len(column))
+	positions := make([]int64, len(column))
+	for i, other := range column {
+		ids[i] = other.ID
+		positions[i] = other.Position
+	}
+
+	index, err := moveIndex(ids, move)
+	if err != nil {
+		return err
+	}
+	saved, ok := m.store.tasks[task.ID]
+	if !ok || saved.Version != task.Version {
+		return ErrEditConflict
+	}
+
+	position, ok := positionBetween(positions, index)
+	if !ok {
+		position = renumberPositions(positions, index)
+		for i, other := range column {
+			other.Position = positions[i]
+		}
+	}
+	saved.Status = move.Status
+	saved.Position = position
+	saved.Version++
+	saved.CompletedAt = completedAt(saved.Status, saved.CompletedAt)
+	saved.UpdatedAt = CustomTime(time.Now())
+
+	task.Status = saved.Status
+	task.Position = saved.Position
+	task.Version = saved.Version
+	task.CompletedAt = saved.CompletedAt
+	task.UpdatedAt = saved.UpdatedAt
+	return nil
+}
+
+// completedAt works out a task's completed_at like the SQL models do: it is set when the
+// task becomes completed, kept while it stays so, and cleared otherwise.
+func completedAt(status TaskStatus, previous CustomTime) CustomTime {
+	switch {
+	case status != StatusCompleted:
+		return CustomTime{}
+	case previous.IsZero():
+		return CustomTime(time.Now())
+	}
+	return previous
+}
+
+// mockTaskTx is the TaskTx of MockTaskModel.
+type mockTaskTx struct {
+	store *mockStore
+}
+
+func (t mockTaskTx) Insert(task *Task) error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+	t.store.insertTask(task)
+	return nil
+}
+
+func (t mockTaskTx) GetForWorkspace(id int64, workspaceID int64) (*Task, error) {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+	return t.store.getTaskForWorkspace(id, workspaceID)
+}
+
+func (t mockTaskTx) Update(task *Task) error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+	return t.store.updateTask(task)
+}
+
+func (t mockTaskTx) DeleteForWorkspace(id int64, workspaceID int64) error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+	return t.store.deleteTaskForWorkspace(id, workspaceID)
+}
+
+func (t mockTaskTx) CheckBlockers(task *Task, from TaskStatus) error {
+	return nil
+}
+
+func (t mockTaskTx) InsertCategory(category *Category) error {
+	return (&MockCategoryModel{store: t.store}).Insert(context.Background(), category)
+}
+
+// insertTask adds a task at the bottom of its status column. The caller must hold the lock.
+func (s *mockStore) insertTask(task *Task) {
+	position := int64(0)
+	for _, other := range s.tasks {
+		if other.WorkspaceID == task.WorkspaceID && other.Status == task.Status && other.Position > position {
+			position = other.Position
+		}
+	}
+	s.lastTaskID++
+	task.ID = s.lastTaskID
+	task.CreatedAt = CustomTime(time.Now())
+	task.UpdatedAt = task.CreatedAt
+	task.Version = 1
+	task.Position = position + positionGap
+	task.CompletedAt = completedAt(task.Status, CustomTime{})
+
+	saved := *task
+	s.tasks[task.ID] = &saved
+}
+
+func (s *mockStore) getTaskForWorkspace(id int64, workspaceID int64) (*Task, error) {
+	task, ok := s.tasks[id]
+	if !ok || task.WorkspaceID != workspaceID {
+		return nil, ErrRecordNotFound
+	}
+	copied := *task
+	return &copied, nil
+}
+
+func (s *mockStore) updateTask(task *Task) error {
+	saved, ok := s.tasks[task.ID]
+	if !ok || saved.Version != task.Version {
+		return ErrEditConflict
+	}
+	task.Version++
+	task.CompletedAt = completedAt(task.Status, saved.CompletedAt)
+	task.UpdatedAt = CustomTime(time.Now())
+
+	// The same columns as updateTask() are changed.
+	updated := *task
+	updated.CreatedAt = saved.CreatedAt
+	updated.WorkspaceID = saved.WorkspaceID
+	updated.Position = saved.Position
+	s.tasks[task.ID] = &updated
+	return nil
+}
+
+func (s *mockStore) deleteTaskForWorkspace(id int64, workspaceID int64) error {
+	task, ok := s.tasks[id]
+	if !ok || task.WorkspaceID != workspaceID {
+		return ErrRecordNotFound
+	}
+	delete(s.tasks, id)
+	delete(s.materialized, id)
+	return nil
+}
+
+// findTasks returns copies of the tasks that match.
+func (s *mockStore) findTasks(match func(task *Task) bool) []*Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tasks := []*Task{}
+	for _, task := range s.tasks {
+		if match(task) {
+			copied := *task
+			tasks = append(tasks, &copied)
+		}
+	}
+	return tasks
+}
+
+func taskColumn(task *Task, column string) interface{} {
+	switch column {
+	case "id":
+		return task.ID
+	case "title":
+		return task.Title
+	case "priority":
+		return string(task.Priority)
+	case "category":
+		return task.Category
+	case "position":
+		return task.Position
+	case "due_date":
+		if task.DueDate.IsZero() {
+			return nil
+		}
+		return time.Time(task.DueDate)
+	case "estimate_minutes":
+		if task.EstimateMinutes == nil {
+			return nil
+		}
+		return int64(*task.EstimateMinutes)
+	case "created_at":
+		return time.Time(task.CreatedAt)
+	}
+	panic("unsupported sort column: " + column)
+}
+
+// MockCategoryModel is an in-memory CategoryRepository.
+type MockCategoryModel struct {
+	store *mockStore
+}
+
+func (m *MockCategoryModel) Insert(ctx context.Context, category *Category) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	if m.store.categoryNameTaken(category.WorkspaceID, category.Name, 0) {
+		return ErrDuplicateCategory
+	}
+	m.store.lastCategoryID++
+	category.ID = m.store.lastCategoryID
+	category.CreatedAt = CustomTime(time.Now())
+	category.UpdatedAt = category.CreatedAt
+	category.Version = 1
+	m.store.categories[category.ID] = copyCategory(category)
+	return nil
+}
+
+func (m *MockCategoryModel) Get(ctx context.Context, id int64, workspaceID int64) (*Category, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	category, ok := m.store.categories[id]
+	if !ok || category.WorkspaceID != workspaceID {
+		return nil, ErrRecordNotFound
+	}
+	return copyCategory(category), nil
+}
+
+func (m *MockCategoryModel) GetByName(ctx context.Context, workspaceID int64, name string) (*Category, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for _, category := range m.store.categories {
+		if category.WorkspaceID == workspaceID && category.Name == name {
+			return copyCategory(category), nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m *MockCategoryModel) GetMany(ctx context.Context, workspaceID int64, ids []int64) (map[int64]*Category, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	categories := make(map[int64]*Category, len(ids))
+	for _, id := range ids {
+		category, ok := m.store.categories[id]
+		if ok && category.WorkspaceID == workspaceID {
+			categories[id] = copyCategory(category)
+		}
+	}
+	return categories, nil
+}
+
+func (m *MockCategoryModel) ResolveForTask(ctx context.Context, task *Task) error {
+	return resolveTaskCategory(ctx, m, task)
+}
+
+func (m *MockCategoryModel) Update(ctx context.Context, category *Category) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	saved, ok := m.store.categories[category.ID]
+	if !ok || saved.WorkspaceID != category.WorkspaceID || saved.Version != category.Version {
+		return ErrEditConflict
+	}
+	if m.store.categoryNameTaken(category.WorkspaceID, category.Name, category.ID) {
+		return ErrDuplicateCategory
+	}
+	saved.Name = category.Name
+	saved.Description = category.Description
+	saved.Version++
+	saved.UpdatedAt = CustomTime(time.Now())
+	category.Version = saved.Version
+	category.UpdatedAt = saved.UpdatedAt
+
+	for _, task := range m.store.tasks {
+		if task.CategoryID == category.ID && task.Category != category.Name {
+			task.Category = category.Name
+			task.UpdatedAt = saved.UpdatedAt
+		}
+	}
+	return nil
+}
+
+func (m *MockCategoryModel) Move(ctx context.Context, category *Category, parentID *int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	// Walk up from the new parent, as CategoryModel.Move() does.
+	for id := parentID; id != nil; {
+		if *id == category.ID {
+			return ErrCategoryCycle
+		}
+		parent, ok := m.store.categories[*id]
+		if !ok {
+			break
+		}
+		id = parent.ParentID
+	}
+
+	saved, ok := m.store.categories[category.ID]
+	if !ok || saved.WorkspaceID != category.WorkspaceID || saved.Version != category.Version {
+		return ErrEditConflict
+	}
+	saved.ParentID = copyID(parentID)
+	saved.Version++
+	saved.UpdatedAt = CustomTime(time.Now())
+	category.ParentID = parentID
+	category.Version = saved.Version
+	category.UpdatedAt = saved.UpdatedAt
+	return nil
+}
+
+func (m *MockCategoryModel) GetTree(ctx context.Context, workspaceID int64) ([]*CategoryNode, error) {
+	categories := m.store.findCategories(workspaceID)
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Name != categories[j].Name {
+			return categories[i].Name < categories[j].Name
+		}
+		return categories[i].ID < categories[j].ID
+	})
+	nodes := make([]*CategoryNode, len(categories))
+	for i, category := range categories {
+		nodes[i] = &CategoryNode{Category: category, Children: []*CategoryNode{}}
+	}
+	return buildCategoryTree(nodes), nil
+}
+
+func (m *MockCategoryModel) Delete(ctx context.Context, id int64, workspaceID int64, strategy string, targetID int64) (*CategoryDeletion, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	category, ok := m.store.categories[id]
+	if !ok || category.WorkspaceID != workspaceID {
+		return nil, ErrRecordNotFound
+	}
+
+	var tasks []*Task
+	for _, task := range m.store.tasks {
+		if task.CategoryID == id {
+			tasks = append(tasks, task)
+		}
+	}
+	sortByID(tasks)
+
+	deletion := &CategoryDeletion{DeletedTaskIDs: []int64{}, ReassignedTasks: []*Task{}}
+	switch strategy {
+	case DeleteCascade:
+		for _, task := range tasks {
+			delete(m.store.tasks, task.ID)
+			delete(m.store.materialized, task.ID)
+			deletion.DeletedTaskIDs = append(deletion.DeletedTaskIDs, task.ID)
+		}
+	case DeleteReassign:
+		target, ok := m.store.categories[targetID]
+		if !ok || target.WorkspaceID != workspaceID || targetID == id {
+			return nil, ErrInvalidReassignTarget
+		}
+		for _, task := range tasks {
+			task.CategoryID = target.ID
+			task.Category = target.Name
+			task.Version++
+			task.UpdatedAt = CustomTime(time.Now())
+			copied := *task
+			deletion.ReassignedTasks = append(deletion.ReassignedTasks, &copied)
+		}
+	default:
+		if len(tasks) > 0 {
+			return nil, ErrCategoryInUse
+		}
+	}
+
+	delete(m.store.categories, id)
+	for _, child := range m.store.categories {
+		if child.ParentID != nil && *child.ParentID == id {
+			child.ParentID = nil
+		}
+	}
+	return deletion, nil
+}
+
+func (m *MockCategoryModel) GetAll(ctx context.Context, workspaceID int64, name string, filters Filters) ([]*CategoryWithCounts, Metadata, error) {
+	m.store.mu.Lock()
+	categories := []*CategoryWithCounts{}
+	for _, category := range m.store.categories {
+		if category.WorkspaceID != workspaceID || !matchWords(category.Name, name, false) {
+			continue
+		}
+		counted := &CategoryWithCounts{Category: copyCategory(category)}
+		for _, task := range m.store.tasks {
+			if task.CategoryID != category.ID || task.Archived {
+				continue
+			}
+			counted.TaskCount++
+			if task.Status == StatusCompleted {
+				counted.CompletedCount++
+			} else {
+				counted.OpenCount++
+			}
+		}
+		categories = append(categories, counted)
+	}
+	m.store.mu.Unlock()
+
+	sortRecords(categories, filters, func(category *CategoryWithCounts, column string) interface{} {
+		return categoryColumn(category.Category, column)
+	}, func(category *CategoryWithCounts) int64 { return category.ID })
+	categories, metadata := paginate(categories, filters)
+	return categories, metadata, nil
+}
+
+// categoryNameTaken reports whether a workspace has a category other than exceptID with
+// the given name. The caller must hold the lock.
+func (s *mockStore) categoryNameTaken(workspaceID int64, name string, exceptID int64) bool {
+	for _, category := range s.categories {
+		if category.WorkspaceID == workspaceID && category.Name == name && category.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// findCategories returns copies of a workspace's categories.
+func (s *mockStore) findCategories(workspaceID int64) []*Category {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	categories := []*Category{}
+	for _, category := range s.categories {
+		if category.WorkspaceID == workspaceID {
+			categories = append(categories, copyCategory(category))
+		}
+	}
+	return categories
+}
+
+func copyCategory(category *Category) *Category {
+	copied := *category
+	copied.ParentID = copyID(category.ParentID)
+	return &copied
+}
+
+func copyID(id *int64) *int64 {
+	if id == nil {
+		return nil
+	}
+	copied := *id
+	return &copied
+}
+
+func categoryColumn(category *Category, column string) interface{} {
+	switch column {
+	case "id":
+		return category.ID
+	case "name":
+		return category.Name
+	case "created_at":
+		return time.Time(category.CreatedAt)
+	}
+	panic("unsupported sort column: " + column)
+}
+
+// MockUserModel is an in-memory UserRepository. It doesn't know about roles, so filtering
+// on a role matches no users. Tokens for GetForToken() are added with AddToken().
+type MockUserModel struct {
+	store *mockStore
+}
+
+// AddToken makes GetForToken() return the user for the plaintext token in the given scope
+// until expiry, standing in for TokenModel.New().
+func (m *MockUserModel) AddToken(userID int64, scope, plaintext string, expiry time.Time) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.store.tokens[sha256.Sum256([]byte(plaintext))] = mockToken{userID: userID, scope: scope, expiry: expiry}
+}
+
+func (m *MockUserModel) Insert(ctx context.Context, user *User) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	if m.store.emailTaken(user.Email, 0) {
+		return ErrDuplicateEmail
+	}
+	m.store.lastUserID++
+	user.ID = m.store.lastUserID
+	user.CreatedAt = time.Now()
+	user.Version = 1
+	m.store.users[user.ID] = copyUser(user)
+	return nil
+}
+
+func (m *MockUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for _, user := range m.store.users {
+		if strings.EqualFold(user.Email, email) {
+			return copyUser(user), nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m *MockUserModel) Get(ctx context.Context, id int64) (*User, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	user, ok := m.store.users[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (m *MockUserModel) GetMany(ctx context.Context, ids []int64) (map[int64]*User, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	users := make(map[int64]*User, len(ids))
+	for _, id := range ids {
+		if user, ok := m.store.users[id]; ok {
+			users[id] = copyUser(user)
+		}
+	}
+	return users, nil
+}
+
+func (m *MockUserModel) GetAll(ctx context.Context, uf UserFilters, filters Filters) ([]*User, Metadata, error) {
+	m.store.mu.Lock()
+	users := []*User{}
+	search := strings.ToLower(uf.Search)
+	for _, user := range m.store.users {
+		switch {
+		case search != "" && !strings.Contains(strings.ToLower(user.Name), search) && !strings.Contains(strings.ToLower(user.Email), search):
+		case uf.Activated != nil && user.Activated != *uf.Activated:
+		case uf.Deactivated != nil && user.Deactivated != *uf.Deactivated:
+		case uf.Role != "":
+		default:
+			// Like the SQL model, GetAll() doesn't return password hashes.
+			copied := copyUser(user)
+			copied.Password = password{}
+			users = append(users, copied)
+		}
+	}
+	m.store.mu.Unlock()
+
+	sortRecords(users, filters, userColumn, func(user *User) int64 { return user.ID })
+	users, metadata := paginate(users, filters)
+	return users, metadata, nil
+}
+
+func (m *MockUserModel) Update(ctx context.Context, user *User) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	saved, ok := m.store.users[user.ID]
+	if !ok || saved.Version != user.Version {
+		return ErrEditConflict
+	}
+	if m.store.emailTaken(user.Email, user.ID) {
+		return ErrDuplicateEmail
+	}
+	user.Version++
+	updated := copyUser(user)
+	updated.CreatedAt = saved.CreatedAt
+	m.store.users[user.ID] = updated
+	return nil
+}
+
+func (m *MockUserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	token, ok := m.store.tokens[sha256.Sum256([]byte(tokenPlaintext))]
+	if !ok || token.scope != tokenScope || !token.expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+	user, ok := m.store.users[token.userID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return copyUser(user), nil
+}
+
+// emailTaken reports whether a user other than exceptID has the email address, which
+// is compared case-insensitively like the citext column. The caller must hold the lock.
+func (s *mockStore) emailTaken(email string, exceptID int64) bool {
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) && user.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// copyUser returns a copy of a user as it would be read back from the database, with
+// only the password hash.
+func copyUser(user *User) *User {
+	copied := *user
+	copied.Password = password{hash: user.Password.hash}
+	return &copied
+}
+
+func userColumn(user *User, column string) interface{} {
+	switch column {
+	case "id":
+		return user.ID
+	case "name":
+		return user.Name
+	case "email":
+		return strings.ToLower(user.Email)
+	case "created_at":
+		return user.CreatedAt
+	}
+	panic("unsupported sort column: " + column)
+}
+
+// sortRecords orders records by the client's sort column and then by ID, like the ORDER
+// BY clauses of the SQL models. column returns the value of a record's column, or nil
+// for NULL, which sorts last in either direction.
+func sortRecords[T any](records []T, filters Filters, column func(record T, name string) interface{}, id func(record T) int64) {
+	name := filters.sortColumn()
+	descending := filters.sortDirection() == "DESC"
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := column(records[i], name), column(records[j], name)
+		var c int
+		switch {
+		case a == nil && b == nil:
+		case a == nil:
+			return false
+		case b == nil:
+			return true
+		default:
+			c = compareValues(a, b)
+		}
+		if descending {
+			c = -c
+		}
+		if c == 0 {
+			return id(records[i]) < id(records[j])
+		}
+		return c < 0
+	})
+}
+
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		return cmp.Compare(a, b.(int64))
+	case string:
+		return cmp.Compare(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	panic("unsupported sort value")
+}
+
+// paginate returns the page of records asked for in filters. As with the window function
+// in the SQL models, a page past the end has no metadata.
+func paginate[T any](records []T, filters Filters) ([]T, Metadata) {
+	if filters.offset() >= len(records) {
+		return []T{}, Metadata{}
+	}
+	end := min(filters.offset()+filters.limit(), len(records))
+	return records[filters.offset():end], calculateMetadata(len(records), filters.Page, filters.PageSize)
+}
+
+func sortByID(tasks []*Task) {
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+}
+
+// matchWords reports whether text contains every word of query, ignoring case, like the
+// 'simple' text search configuration. With prefix, the words of query only need to start
+// words of the text, as with searchQuery(). An empty query matches everything.
+func matchWords(text, query string, prefix bool) bool {
+	isSeparator := func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}
+	words := strings.FieldsFunc(strings.ToLower(text), isSeparator)
+	for _, want := range strings.FieldsFunc(strings.ToLower(query), isSeparator) {
+		found := false
+		for _, word := range words {
+			if word == want || prefix && strings.HasPrefix(word, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,470 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MockPermissionModel is an in-memory PermissionRepository. It doesn't know about roles,
+// so users only have the permissions granted to them with AddForUser().
+type MockPermissionModel struct {
+	store *mockStore
+}
+
+func (m *MockPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	return append(Permissions(nil), m.store.permissions[userID]...), nil
+}
+
+func (m *MockPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for _, code := range codes {
+		if !m.store.permissions[userID].Include(code) {
+			m.store.permissions[userID] = append(m.store.permissions[userID], code)
+		}
+	}
+	return nil
+}
+
+// mockWorkspace is a row of the workspaces table. The role of the Workspace is left
+// empty, since it depends on who is asking.
+type mockWorkspace struct {
+	Workspace
+	personalUserID int64
+}
+
+// mockMember is a row of the workspace_members table.
+type mockMember struct {
+	role      string
+	createdAt time.Time
+}
+
+// MockWorkspaceModel is an in-memory WorkspaceRepository. Members never have an avatar.
+type MockWorkspaceModel struct {
+	store *mockStore
+}
+
+func (m *MockWorkspaceModel) Insert(ctx context.Context, workspace *Workspace, ownerID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	var personalUserID int64
+	if workspace.Personal {
+		personalUserID = ownerID
+	}
+	m.store.lastWorkspaceID++
+	workspace.ID = m.store.lastWorkspaceID
+	workspace.CreatedAt = CustomTime(time.Now())
+	workspace.Version = 1
+	workspace.Role = RoleOwner
+	saved := &mockWorkspace{Workspace: *workspace, personalUserID: personalUserID}
+	saved.Role = ""
+	m.store.workspaces[workspace.ID] = saved
+	m.store.members[workspace.ID] = map[int64]mockMember{
+		ownerID: {role: RoleOwner, createdAt: time.Now()},
+	}
+	return nil
+}
+
+func (m *MockWorkspaceModel) GetForUser(ctx context.Context, id int64, userID int64) (*Workspace, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	workspace, ok := m.store.workspaceForUser(id, userID)
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return workspace, nil
+}
+
+func (m *MockWorkspaceModel) GetAllForUser(ctx context.Context, userID int64) ([]*Workspace, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	workspaces := []*Workspace{}
+	for id := range m.store.workspaces {
+		if workspace, ok := m.store.workspaceForUser(id, userID); ok {
+			workspaces = append(workspaces, workspace)
+		}
+	}
+	sort.Slice(workspaces, func(i, j int) bool {
+		a, b := workspaces[i], workspaces[j]
+		switch {
+		case a.Personal != b.Personal:
+			return a.Personal
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+	return workspaces, nil
+}
+
+func (m *MockWorkspaceModel) Update(ctx context.Context, workspace *Workspace) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	saved, ok := m.store.workspaces[workspace.ID]
+	if !ok || saved.Version != workspace.Version {
+		return ErrEditConflict
+	}
+	workspace.Version++
+	saved.Name = workspace.Name
+	saved.Version = workspace.Version
+	return nil
+}
+
+// Delete removes a shared workspace, and the tasks and categories in it.
+func (m *MockWorkspaceModel) Delete(ctx context.Context, id int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	saved, ok := m.store.workspaces[id]
+	if !ok || saved.Personal {
+		return ErrPersonalWorkspace
+	}
+	delete(m.store.workspaces, id)
+	delete(m.store.members, id)
+	for taskID, task := range m.store.tasks {
+		if task.WorkspaceID == id {
+			delete(m.store.tasks, taskID)
+		}
+	}
+	for categoryID, category := range m.store.categories {
+		if category.WorkspaceID == id {
+			delete(m.store.categories, categoryID)
+		}
+	}
+	return nil
+}
+
+func (m *MockWorkspaceModel) GetPersonalID(ctx context.Context, userID int64) (int64, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for id, saved := range m.store.workspaces {
+		if saved.personalUserID == userID {
+			return id, nil
+		}
+	}
+	return 0, ErrRecordNotFound
+}
+
+func (m *MockWorkspaceModel) GetMember(ctx context.Context, workspaceID int64, userID int64) (*Member, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	member, ok := m.store.member(workspaceID, userID)
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+	return member, nil
+}
+
+func (m *MockWorkspaceModel) GetMembers(ctx context.Context, workspaceID int64) ([]*Member, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	members := []*Member{}
+	for userID := range m.store.members[workspaceID] {
+		if member, ok := m.store.member(workspaceID, userID); ok {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		switch {
+		case (a.Role == RoleOwner) != (b.Role == RoleOwner):
+			return a.Role == RoleOwner
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		}
+		return a.UserID < b.UserID
+	})
+	return members, nil
+}
+
+func (m *MockWorkspaceModel) GetMemberIDs(ctx context.Context, workspaceID int64) ([]int64, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	var userIDs []int64
+	for userID := range m.store.members[workspaceID] {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+	return userIDs, nil
+}
+
+func (m *MockWorkspaceModel) SetMemberRole(ctx context.Context, workspaceID int64, userID int64, role string) error {
+	return m.changeMember(workspaceID, userID, role)
+}
+
+func (m *MockWorkspaceModel) RemoveMember(ctx context.Context, workspaceID int64, userID int64) error {
+	return m.changeMember(workspaceID, userID, "")
+}
+
+// changeMember sets a member's role, or removes them if role is empty.
+func (m *MockWorkspaceModel) changeMember(workspaceID int64, userID int64, role string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	members := m.store.members[workspaceID]
+	owners := 0
+	for _, member := range members {
+		if member.role == RoleOwner {
+			owners++
+		}
+	}
+	member, ok := members[userID]
+	if !ok {
+		return nil
+	}
+	if member.role == RoleOwner && owners == 1 && role != RoleOwner {
+		return ErrLastOwner
+	}
+	if role == "" {
+		delete(members, userID)
+		return nil
+	}
+	member.role = role
+	members[userID] = member
+	return nil
+}
+
+func (m *MockWorkspaceModel) NewInvitation(ctx context.Context, workspaceID int64, email string, role string, invitedBy int64, ttl time.Duration) (*Invitation, error) {
+	token, err := generateToken(invitedBy, ttl, ScopeInvitation)
+	if err != nil {
+		return nil, err
+	}
+	invitation := &Invitation{
+		Plaintext:   token.Plaintext,
+		Hash:        token.Hash,
+		WorkspaceID: workspaceID,
+		Email:       email,
+		Role:        role,
+		InvitedBy:   invitedBy,
+		Expiry:      token.Expiry,
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for userID := range m.store.members[workspaceID] {
+		if user, ok := m.store.users[userID]; ok && strings.EqualFold(user.Email, email) {
+			return nil, ErrAlreadyMember
+		}
+	}
+	for hash, saved := range m.store.invitations {
+		if saved.WorkspaceID == workspaceID && strings.EqualFold(saved.Email, email) {
+			delete(m.store.invitations, hash)
+		}
+	}
+	saved := *invitation
+	saved.Plaintext = ""
+	m.store.invitations[[32]byte(token.Hash)] = &saved
+	return invitation, nil
+}
+
+func (m *MockWorkspaceModel) AcceptInvitation(ctx context.Context, tokenPlaintext string, user *User) (*Member, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	invitation, ok := m.store.invitations[hash]
+	if !ok || !strings.EqualFold(invitation.Email, user.Email) || !invitation.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+	delete(m.store.invitations, hash)
+	members := m.store.members[invitation.WorkspaceID]
+	if members == nil {
+		return nil, ErrRecordNotFound
+	}
+	if _, ok := members[user.ID]; ok {
+		return nil, ErrAlreadyMember
+	}
+	joined := mockMember{role: invitation.Role, createdAt: time.Now()}
+	members[user.ID] = joined
+	return &Member{
+		WorkspaceID: invitation.WorkspaceID,
+		UserID:      user.ID,
+		Name:        user.Name,
+		Email:       user.Email,
+		Role:        joined.role,
+		CreatedAt:   CustomTime(joined.createdAt),
+	}, nil
+}
+
+// workspaceForUser returns a copy of a workspace with the user's role in it, if they
+// are a member. The caller must hold the lock.
+func (s *mockStore) workspaceForUser(id int64, userID int64) (*Workspace, bool) {
+	saved, ok := s.workspaces[id]
+	if !ok {
+		return nil, false
+	}
+	member, ok := s.members[id][userID]
+	if !ok {
+		return nil, false
+	}
+	workspace := saved.Workspace
+	workspace.Role = member.role
+	return &workspace, true
+}
+
+// member returns a user's membership of a workspace, with their name and email address.
+// The caller must hold the lock.
+func (s *mockStore) member(workspaceID int64, userID int64) (*Member, bool) {
+	saved, ok := s.members[workspaceID][userID]
+	if !ok {
+		return nil, false
+	}
+	member := &Member{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Role:        saved.role,
+		CreatedAt:   CustomTime(saved.createdAt),
+	}
+	if user, ok := s.users[userID]; ok {
+		member.Name = user.Name
+		member.Email = user.Email
+	}
+	return member, true
+}
+
+// MockSessionModel is an in-memory SessionRepository. Its tokens are kept with the ones
+// added by MockUserModel.AddToken().
+type MockSessionModel struct {
+	store *mockStore
+}
+
+func (m *MockSessionModel) New(ctx context.Context, userID int64, ttl time.Duration, scope, userAgent, ip string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.store.lastTokenID++
+	token.ID = m.store.lastTokenID
+	m.store.tokens[[32]byte(token.Hash)] = mockToken{
+		id:        token.ID,
+		userID:    userID,
+		scope:     scope,
+		expiry:    token.Expiry,
+		createdAt: time.Now(),
+		userAgent: userAgent,
+		ip:        ip,
+	}
+	return token, nil
+}
+
+func (m *MockSessionModel) GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, int64, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	token, ok := m.store.tokens[hash]
+	if !ok || token.scope != scope || !token.expiry.After(time.Now()) {
+		return nil, 0, ErrRecordNotFound
+	}
+	user, ok := m.store.users[token.userID]
+	if !ok {
+		return nil, 0, ErrRecordNotFound
+	}
+	now := time.Now()
+	token.lastUsedAt = &now
+	m.store.tokens[hash] = token
+	return copyUser(user), token.id, nil
+}
+
+func (m *MockSessionModel) GetUser(ctx context.Context, id, userID int64, scope string) (*User, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for _, token := range m.store.tokens {
+		if token.id != id || token.userID != userID || token.scope != scope || !token.expiry.After(time.Now()) {
+			continue
+		}
+		user, ok := m.store.users[userID]
+		if !ok {
+			return nil, ErrRecordNotFound
+		}
+		return copyUser(user), nil
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m *MockSessionModel) Rotate(ctx context.Context, scope, tokenPlaintext string, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(0, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	saved, ok := m.store.tokens[hash]
+	if !ok || saved.scope != scope || !saved.expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+	delete(m.store.tokens, hash)
+	now := time.Now()
+	saved.expiry = token.Expiry
+	saved.lastUsedAt = &now
+	m.store.tokens[[32]byte(token.Hash)] = saved
+	token.ID = saved.id
+	token.UserID = saved.userID
+	return token, nil
+}
+
+func (m *MockSessionModel) GetAllForUser(ctx context.Context, userID int64, scope string) ([]*Session, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	sessions := []*Session{}
+	lastUsed := make(map[int64]time.Time)
+	for _, token := range m.store.tokens {
+		if token.userID != userID || token.scope != scope || !token.expiry.After(time.Now()) {
+			continue
+		}
+		session := &Session{
+			ID:        token.id,
+			CreatedAt: CustomTime(token.createdAt),
+			Expiry:    CustomTime(token.expiry),
+			UserAgent: token.userAgent,
+			IP:        token.ip,
+		}
+		lastUsed[token.id] = token.createdAt
+		if token.lastUsedAt != nil {
+			usedAt := CustomTime(*token.lastUsedAt)
+			session.LastUsedAt = &usedAt
+			lastUsed[token.id] = *token.lastUsedAt
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		a, b := lastUsed[sessions[i].ID], lastUsed[sessions[j].ID]
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+	return sessions, nil
+}
+
+func (m *MockSessionModel) Delete(ctx context.Context, id, userID int64, scope string) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for hash, token := range m.store.tokens {
+		if token.id == id && token.userID == userID && token.scope == scope {
+			delete(m.store.tokens, hash)
+			return nil
+		}
+	}
+	return ErrRecordNotFound
+}
+
+func (m *MockSessionModel) DeleteAllExcept(ctx context.Context, userID int64, scope string, keepID int64) (int64, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	var deleted int64
+	for hash, token := range m.store.tokens {
+		if token.userID == userID && token.scope == scope && token.id != keepID {
+			delete(m.store.tokens, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
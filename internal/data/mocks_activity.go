@@ -0,0 +1,517 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// MockSettingsModel is an in-memory SettingsRepository.
+type MockSettingsModel struct {
+	store *mockStore
+}
+
+func (m *MockSettingsModel) Get(ctx context.Context, userID int64) (*Settings, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	if saved, ok := m.store.settings[userID]; ok {
+		copied := *saved
+		copied.DigestHour = copyInt(saved.DigestHour)
+		return &copied, nil
+	}
+	return &Settings{UserID: userID, ReminderWindow: DefaultReminderWindow, DefaultPageSize: DefaultPageSize, DefaultSort: DefaultSort}, nil
+}
+
+func (m *MockSettingsModel) Save(ctx context.Context, settings *Settings) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	saved := *settings
+	saved.DigestHour = copyInt(settings.DigestHour)
+	m.store.settings[settings.UserID] = &saved
+	return nil
+}
+
+func copyInt(n *int) *int {
+	if n == nil {
+		return nil
+	}
+	copied := *n
+	return &copied
+}
+
+// MockPinModel is an in-memory PinRepository.
+type MockPinModel struct {
+	store *mockStore
+}
+
+func (m *MockPinModel) Pin(ctx context.Context, userID, taskID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	if m.store.pins[userID] == nil {
+		m.store.pins[userID] = make(map[int64]bool)
+	}
+	m.store.pins[userID][taskID] = true
+	return nil
+}
+
+func (m *MockPinModel) Unpin(ctx context.Context, userID, taskID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	delete(m.store.pins[userID], taskID)
+	return nil
+}
+
+func (m *MockPinModel) GetForTasks(ctx context.Context, userID int64, taskIDs []int64) (map[int64]bool, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	pinned := make(map[int64]bool)
+	for _, taskID := range taskIDs {
+		if m.store.pins[userID][taskID] {
+			pinned[taskID] = true
+		}
+	}
+	return pinned, nil
+}
+
+// MockDependencyModel is an in-memory DependencyRepository.
+type MockDependencyModel struct {
+	store *mockStore
+}
+
+func (m *MockDependencyModel) Add(ctx context.Context, taskID int64, blockerID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	if taskID == blockerID || m.store.blockedBy(blockerID, taskID, map[int64]bool{}) {
+		return ErrDependencyCycle
+	}
+	if m.store.dependencies[taskID] == nil {
+		m.store.dependencies[taskID] = make(map[int64]bool)
+	}
+	m.store.dependencies[taskID][blockerID] = true
+	return nil
+}
+
+func (m *MockDependencyModel) Remove(ctx context.Context, taskID int64, blockerID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	if !m.store.dependencies[taskID][blockerID] {
+		return ErrRecordNotFound
+	}
+	delete(m.store.dependencies[taskID], blockerID)
+	return nil
+}
+
+func (m *MockDependencyModel) GetBlockers(ctx context.Context, taskID int64) ([]*TaskRef, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	var ids []int64
+	for blockerID := range m.store.dependencies[taskID] {
+		ids = append(ids, blockerID)
+	}
+	return m.store.taskRefs(ids), nil
+}
+
+func (m *MockDependencyModel) GetDependents(ctx context.Context, taskID int64) ([]*TaskRef, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	var ids []int64
+	for dependentID, blockers := range m.store.dependencies {
+		if blockers[taskID] {
+			ids = append(ids, dependentID)
+		}
+	}
+	return m.store.taskRefs(ids), nil
+}
+
+func (m *MockDependencyModel) CheckBlockers(ctx context.Context, task *Task, from TaskStatus) error {
+	if task.Status != StatusCompleted || from == StatusCompleted {
+		return nil
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	open := 0
+	for blockerID := range m.store.dependencies[task.ID] {
+		if blocker, ok := m.store.tasks[blockerID]; ok && blocker.Status != StatusCompleted {
+			open++
+		}
+	}
+	if open > 0 {
+		return &TransitionError{From: from, To: task.Status, Rule: fmt.Sprintf("the task is blocked by %d open task(s)", open)}
+	}
+	return nil
+}
+
+// blockedBy reports whether a task is waiting on another, directly or through other
+// tasks. The caller must hold the lock.
+func (s *mockStore) blockedBy(taskID int64, blockerID int64, seen map[int64]bool) bool {
+	if seen[taskID] {
+		return false
+	}
+	seen[taskID] = true
+	for id := range s.dependencies[taskID] {
+		if id == blockerID || s.blockedBy(id, blockerID, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// taskRefs returns references to the tasks with the given IDs that still exist, in
+// order of ID. The caller must hold the lock.
+func (s *mockStore) taskRefs(ids []int64) []*TaskRef {
+	refs := []*TaskRef{}
+	for _, id := range ids {
+		if task, ok := s.tasks[id]; ok {
+			refs = append(refs, &TaskRef{ID: id, Title: task.Title, Status: task.Status})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].ID < refs[j].ID })
+	return refs
+}
+
+// MockTimeEntryModel is an in-memory TimeEntryRepository.
+type MockTimeEntryModel struct {
+	store *mockStore
+}
+
+func (m *MockTimeEntryModel) Start(ctx context.Context, taskID int64, userID int64) (*TimeEntry, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for _, entry := range m.store.timeEntries {
+		if entry.UserID == userID && entry.EndedAt == nil {
+			return nil, ErrTimerRunning
+		}
+	}
+	entry := &TimeEntry{TaskID: taskID, UserID: userID, StartedAt: CustomTime(time.Now())}
+	m.store.insertTimeEntry(entry)
+	return copyTimeEntry(entry), nil
+}
+
+func (m *MockTimeEntryModel) Stop(ctx context.Context, taskID int64, userID int64) (*TimeEntry, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for _, entry := range m.store.timeEntries {
+		if entry.TaskID == taskID && entry.UserID == userID && entry.EndedAt == nil {
+			endedAt := CustomTime(time.Now())
+			entry.EndedAt = &endedAt
+			return copyTimeEntry(entry), nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
+
+func (m *MockTimeEntryModel) Insert(ctx context.Context, entry *TimeEntry) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	saved := *entry
+	m.store.insertTimeEntry(&saved)
+	*entry = *copyTimeEntry(&saved)
+	return nil
+}
+
+func (m *MockTimeEntryModel) GetAllForTask(ctx context.Context, taskID int64) ([]*TimeEntry, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	entries := []*TimeEntry{}
+	for _, entry := range m.store.timeEntries {
+		if entry.TaskID == taskID {
+			entries = append(entries, copyTimeEntry(entry))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := time.Time(entries[i].StartedAt), time.Time(entries[j].StartedAt)
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+	return entries, nil
+}
+
+func (m *MockTimeEntryModel) TotalForTask(ctx context.Context, taskID int64) (int64, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	var total int64
+	for _, entry := range m.store.timeEntries {
+		if entry.TaskID == taskID {
+			total += copyTimeEntry(entry).DurationSeconds
+		}
+	}
+	return total, nil
+}
+
+func (m *MockTimeEntryModel) Delete(ctx context.Context, id int64, taskID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	entry, ok := m.store.timeEntries[id]
+	if !ok || entry.TaskID != taskID {
+		return ErrRecordNotFound
+	}
+	delete(m.store.timeEntries, id)
+	return nil
+}
+
+// insertTimeEntry gives a time entry its ID and saves it. The caller must hold the lock.
+func (s *mockStore) insertTimeEntry(entry *TimeEntry) {
+	s.lastEntryID++
+	entry.ID = s.lastEntryID
+	entry.CreatedAt = CustomTime(time.Now())
+	s.timeEntries[entry.ID] = entry
+}
+
+// copyTimeEntry returns a copy of a time entry with its duration worked out, like the
+// column calculated by timeEntryColumns().
+func copyTimeEntry(entry *TimeEntry) *TimeEntry {
+	copied := *entry
+	end := time.Now()
+	if entry.EndedAt != nil {
+		endedAt := *entry.EndedAt
+		copied.EndedAt = &endedAt
+		end = time.Time(endedAt)
+	}
+	copied.DurationSeconds = int64(end.Sub(time.Time(entry.StartedAt)).Seconds())
+	return &copied
+}
+
+// MockAuditModel is an in-memory AuditRepository.
+type MockAuditModel struct {
+	store *mockStore
+}
+
+func (m *MockAuditModel) Insert(ctx context.Context, entry *AuditEntry) error {
+	// Round-trip the changes through JSON, as storing them in the database would.
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.store.lastAuditID++
+	entry.ID = m.store.lastAuditID
+	entry.CreatedAt = CustomTime(time.Now())
+	saved := *entry
+	saved.ActorID = copyID(entry.ActorID)
+	saved.Changes = nil
+	if err := json.Unmarshal(changes, &saved.Changes); err != nil {
+		return err
+	}
+	m.store.audit = append(m.store.audit, &saved)
+	return nil
+}
+
+func (m *MockAuditModel) GetAll(ctx context.Context, af AuditFilters, filters Filters) ([]*AuditEntry, Metadata, error) {
+	m.store.mu.Lock()
+	entries := []*AuditEntry{}
+	for _, entry := range m.store.audit {
+		switch {
+		case af.EntityType != "" && entry.EntityType != af.EntityType:
+		case af.EntityID > 0 && entry.EntityID != af.EntityID:
+		case af.ActorID > 0 && (entry.ActorID == nil || *entry.ActorID != af.ActorID):
+		default:
+			copied := *entry
+			copied.ActorID = copyID(entry.ActorID)
+			entries = append(entries, &copied)
+		}
+	}
+	m.store.mu.Unlock()
+
+	sortRecords(entries, filters, auditColumn, func(entry *AuditEntry) int64 { return entry.ID })
+	entries, metadata := paginate(entries, filters)
+	return entries, metadata, nil
+}
+
+func auditColumn(entry *AuditEntry, column string) interface{} {
+	switch column {
+	case "id":
+		return entry.ID
+	case "created_at":
+		return time.Time(entry.CreatedAt)
+	}
+	panic("unsupported sort column: " + column)
+}
+
+// MockWebhookModel is an in-memory WebhookRepository.
+type MockWebhookModel struct {
+	store *mockStore
+}
+
+func (m *MockWebhookModel) Insert(ctx context.Context, webhook *Webhook) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.store.lastWebhookID++
+	webhook.ID = m.store.lastWebhookID
+	webhook.CreatedAt = CustomTime(time.Now())
+	webhook.Active = true
+	webhook.Version = 1
+	m.store.webhooks[webhook.ID] = copyWebhook(webhook)
+	return nil
+}
+
+func (m *MockWebhookModel) Get(ctx context.Context, id int64, userID int64) (*Webhook, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	webhook, ok := m.store.webhooks[id]
+	if !ok || webhook.UserID != userID {
+		return nil, ErrRecordNotFound
+	}
+	return copyWebhook(webhook), nil
+}
+
+func (m *MockWebhookModel) GetAllForUser(ctx context.Context, userID int64) ([]*Webhook, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	webhooks := []*Webhook{}
+	for _, webhook := range m.store.webhooks {
+		if webhook.UserID == userID {
+			webhooks = append(webhooks, copyWebhook(webhook))
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+func (m *MockWebhookModel) Update(ctx context.Context, webhook *Webhook) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	saved, ok := m.store.webhooks[webhook.ID]
+	if !ok || saved.UserID != webhook.UserID || saved.Version != webhook.Version {
+		return ErrEditConflict
+	}
+	webhook.Version++
+	updated := copyWebhook(webhook)
+	updated.CreatedAt = saved.CreatedAt
+	updated.Secret = saved.Secret
+	m.store.webhooks[webhook.ID] = updated
+	return nil
+}
+
+func (m *MockWebhookModel) Delete(ctx context.Context, id int64, userID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	webhook, ok := m.store.webhooks[id]
+	if !ok || webhook.UserID != userID {
+		return ErrRecordNotFound
+	}
+	delete(m.store.webhooks, id)
+	for deliveryID, delivery := range m.store.deliveries {
+		if delivery.WebhookID == id {
+			delete(m.store.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (m *MockWebhookModel) Enqueue(ctx context.Context, userID int64, event string, payload []byte) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	for _, webhook := range m.store.webhooks {
+		if webhook.UserID != userID || !webhook.Active || !slices.Contains(webhook.Events, event) {
+			continue
+		}
+		m.store.lastDeliveryID++
+		now := CustomTime(time.Now())
+		m.store.deliveries[m.store.lastDeliveryID] = &WebhookDelivery{
+			ID:            m.store.lastDeliveryID,
+			CreatedAt:     now,
+			WebhookID:     webhook.ID,
+			Event:         event,
+			Payload:       append(json.RawMessage(nil), payload...),
+			Status:        "pending",
+			NextAttemptAt: now,
+		}
+	}
+	return nil
+}
+
+func (m *MockWebhookModel) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	deliveries := []*WebhookDelivery{}
+	for _, delivery := range m.store.deliveries {
+		if delivery.Status != "pending" || time.Time(delivery.NextAttemptAt).After(now) {
+			continue
+		}
+		copied := copyDelivery(delivery)
+		webhook := m.store.webhooks[delivery.WebhookID]
+		copied.URL, copied.Secret, copied.UserID = webhook.URL, webhook.Secret, webhook.UserID
+		deliveries = append(deliveries, copied)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		a, b := time.Time(deliveries[i].NextAttemptAt), time.Time(deliveries[j].NextAttemptAt)
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (m *MockWebhookModel) RecordAttempt(ctx context.Context, delivery *WebhookDelivery) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	saved, ok := m.store.deliveries[delivery.ID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	saved.Status = delivery.Status
+	saved.Attempts++
+	saved.NextAttemptAt = delivery.NextAttemptAt
+	saved.LastStatusCode = delivery.LastStatusCode
+	saved.LastError = delivery.LastError
+	saved.DeliveredAt = nil
+	if delivery.Status == "succeeded" {
+		deliveredAt := CustomTime(time.Now())
+		saved.DeliveredAt = &deliveredAt
+	}
+	delivery.Attempts = saved.Attempts
+	delivery.DeliveredAt = saved.DeliveredAt
+	return nil
+}
+
+func (m *MockWebhookModel) GetDeliveries(ctx context.Context, webhookID int64, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	m.store.mu.Lock()
+	deliveries := []*WebhookDelivery{}
+	for _, delivery := range m.store.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, copyDelivery(delivery))
+		}
+	}
+	m.store.mu.Unlock()
+
+	// The SQL model breaks ties by descending ID, the newest delivery first.
+	sortRecords(deliveries, filters, deliveryColumn, func(delivery *WebhookDelivery) int64 { return -delivery.ID })
+	deliveries, metadata := paginate(deliveries, filters)
+	return deliveries, metadata, nil
+}
+
+func deliveryColumn(delivery *WebhookDelivery, column string) interface{} {
+	switch column {
+	case "id":
+		return delivery.ID
+	case "created_at":
+		return time.Time(delivery.CreatedAt)
+	}
+	panic("unsupported sort column: " + column)
+}
+
+func copyWebhook(webhook *Webhook) *Webhook {
+	copied := *webhook
+	copied.Events = append([]string(nil), webhook.Events...)
+	return &copied
+}
+
+func copyDelivery(delivery *WebhookDelivery) *WebhookDelivery {
+	copied := *delivery
+	copied.Payload = append(json.RawMessage(nil), delivery.Payload...)
+	if delivery.DeliveredAt != nil {
+		deliveredAt := *delivery.DeliveredAt
+		copied.DeliveredAt = &deliveredAt
+	}
+	return &copied
+}
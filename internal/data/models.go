@@ -1,8 +1,12 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/cache"
 )
 
 var (
@@ -10,21 +14,111 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// queryer is satisfied by both dbConn and *sql.Tx, so that the same query code can run
+// either directly on the connection pool or as part of a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// dbConn is the connection pool as the models use it. It carries the timeout for their
+// queries and the dialect of the database, and traces the queries whose context carries
+// a span, see tracing.go.
+type dbConn struct {
+	pool    *sql.DB
+	timeout time.Duration
+	dialect dialect
+}
+
 type Models struct {
-	Tasks       TaskModel
-	Categories  CategoryModel // Add the Categories field.
-	Permissions PermissionModel
-	Tokens      TokenModel
-	Users       UserModel
+	Tasks         TaskRepository
+	Categories    CategoryRepository // Add the Categories field.
+	APIKeys       APIKeyModel
+	Attachments   AttachmentModel
+	Audit         AuditRepository
+	Avatars       AvatarModel
+	Backups       BackupModel
+	Comments      CommentModel
+	CustomFields  CustomFieldModel
+	Dependencies  DependencyRepository
+	Digests       DigestModel
+	EmailChanges  EmailChangeModel
+	Idempotency   IdempotencyModel
+	Inbound       InboundIntegrationModel
+	Identities    IdentityModel
+	Integrations  IntegrationModel
+	LoginAttempts LoginAttemptModel
+	Notifications NotificationModel
+	Outbox        OutboxModel
+	Permissions   PermissionRepository
+	Pins          PinRepository
+	Reminders     ReminderModel
+	Roles         RoleModel
+	Schema        SchemaModel
+	Search        SearchModel
+	Sessions      SessionRepository
+	Settings      SettingsRepository
+	Shares        ShareModel
+	Stats         StatsModel
+	Subtasks      SubtaskModel
+	Tags          TagModel
+	TaskVersions  TaskVersionModel
+	TimeEntries   TimeEntryRepository
+	Tokens        TokenModel
+	TwoFactor     TwoFactorModel
+	Users         UserRepository
+	Webhooks      WebhookRepository
+	Workspaces    WorkspaceRepository
 }
 
 // NewModels returns a Models struct containing the initialized TaskModel, CategoryModel, etc.
-func NewModels(db *sql.DB) Models {
+// Task and category lookups are cached in c, unless it is nil. Each query is given up to
+// queryTimeout, on top of any deadline or cancellation of the context it is run with.
+// db can be opened on any of Drivers, see Open().
+func NewModels(db *sql.DB, c cache.Cache, queryTimeout time.Duration) Models {
+	return newModels(dbConn{pool: db, timeout: queryTimeout, dialect: dialectFor(db)}, workspaceCache{cache: c})
+}
+
+func newModels(db dbConn, wc workspaceCache) Models {
 	return Models{
-		Tasks:       TaskModel{DB: db},
-		Categories:  CategoryModel{DB: db}, // Initialize the CategoryModel instance.
-		Permissions: PermissionModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
+		Tasks:         TaskModel{DB: db, cache: wc},
+		Categories:    CategoryModel{DB: db, cache: wc}, // Initialize the CategoryModel instance.
+		APIKeys:       APIKeyModel{DB: db},
+		Attachments:   AttachmentModel{DB: db},
+		Audit:         AuditModel{DB: db},
+		Avatars:       AvatarModel{DB: db},
+		Backups:       BackupModel{DB: db},
+		Comments:      CommentModel{DB: db},
+		CustomFields:  CustomFieldModel{DB: db, cache: wc},
+		Dependencies:  DependencyModel{DB: db},
+		Digests:       DigestModel{DB: db},
+		EmailChanges:  EmailChangeModel{DB: db},
+		Idempotency:   IdempotencyModel{DB: db},
+		Inbound:       InboundIntegrationModel{DB: db},
+		Identities:    IdentityModel{DB: db},
+		Integrations:  IntegrationModel{DB: db},
+		LoginAttempts: LoginAttemptModel{DB: db},
+		Notifications: NotificationModel{DB: db},
+		Outbox:        OutboxModel{DB: db},
+		Permissions:   PermissionModel{DB: db},
+		Pins:          PinModel{DB: db},
+		Reminders:     ReminderModel{DB: db},
+		Roles:         RoleModel{DB: db},
+		Schema:        SchemaModel{DB: db},
+		Search:        SearchModel{DB: db},
+		Sessions:      SessionModel{DB: db},
+		Settings:      SettingsModel{DB: db},
+		Shares:        ShareModel{DB: db},
+		Stats:         StatsModel{DB: db},
+		Subtasks:      SubtaskModel{DB: db},
+		Tags:          TagModel{DB: db},
+		TaskVersions:  TaskVersionModel{DB: db},
+		TimeEntries:   TimeEntryModel{DB: db},
+		Tokens:        TokenModel{DB: db},
+		TwoFactor:     TwoFactorModel{DB: db},
+		Users:         UserModel{DB: db},
+		Webhooks:      WebhookModel{DB: db},
+		Workspaces:    WorkspaceModel{DB: db},
 	}
 }
@@ -0,0 +1,168 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Define the kinds of notifications, for what they are about.
+const (
+	NotificationComment           = "comment"
+	NotificationReply             = "reply"
+	NotificationReminder          = "reminder"
+	NotificationWebhookFailed     = "webhook_failed"
+	NotificationIntegrationFailed = "integration_failed"
+)
+
+// Notification is shown in a user's notification center until they have read it. It
+// points at the task, comment or webhook it is about, if any.
+type Notification struct {
+	ID        int64      `json:"id"`
+	CreatedAt CustomTime `json:"created_at"`
+	UserID    int64      `json:"-"`
+	Kind      string     `json:"kind"`
+	Message   string     `json:"message"`
+	TaskID    *int64     `json:"task_id,omitempty"`
+	CommentID *int64     `json:"comment_id,omitempty"`
+	WebhookID *int64     `json:"webhook_id,omitempty"`
+	ReadAt    CustomTime `json:"read_at"`
+}
+
+// Define a NotificationModel struct type which wraps a sql.DB connection pool.
+type NotificationModel struct {
+	DB dbConn
+}
+
+func (m NotificationModel) Insert(ctx context.Context, notification *Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, kind, message, task_id, comment_id, webhook_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+	args := []interface{}{
+		notification.UserID,
+		notification.Kind,
+		notification.Message,
+		notification.TaskID,
+		notification.CommentID,
+		notification.WebhookID,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&notification.ID, &notification.CreatedAt)
+}
+
+// GetAllForUser returns a page of a user's notifications, or only the unread ones if
+// unreadOnly is set.
+func (m NotificationModel) GetAllForUser(ctx context.Context, userID int64, unreadOnly bool, filters Filters) ([]*Notification, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, user_id, kind, message, task_id, comment_id,
+			webhook_id, read_at
+		FROM notifications
+		WHERE user_id = $1 AND (read_at IS NULL OR NOT $2)
+		ORDER BY %s %s, id DESC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, unreadOnly, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	notifications := []*Notification{}
+
+	for rows.Next() {
+		var notification Notification
+		err := rows.Scan(append([]interface{}{&totalRecords}, notification.scanDest()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		notifications = append(notifications, &notification)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return notifications, metadata, nil
+}
+
+// CountUnread returns how many of a user's notifications they haven't read yet.
+func (m NotificationModel) CountUnread(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT count(*)
+		FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks one of a user's notifications as read, if it wasn't already, and returns
+// it. It returns ErrRecordNotFound if the user has no notification with that ID.
+func (m NotificationModel) MarkRead(ctx context.Context, id, userID int64) (*Notification, error) {
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2
+		RETURNING id, created_at, user_id, kind, message, task_id, comment_id, webhook_id, read_at`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var notification Notification
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(notification.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &notification, nil
+}
+
+// MarkAllRead marks all of a user's notifications as read, and returns how many of them
+// were unread.
+func (m NotificationModel) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	query := `
+		UPDATE notifications
+		SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (notification *Notification) scanDest() []interface{} {
+	return []interface{}{
+		&notification.ID,
+		&notification.CreatedAt,
+		&notification.UserID,
+		&notification.Kind,
+		&notification.Message,
+		&notification.TaskID,
+		&notification.CommentID,
+		&notification.WebhookID,
+		&notification.ReadAt,
+	}
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// MaxMailAttempts is how many times an email is tried before it is marked failed. With
+// the backoff between attempts, the last one is about four hours after the first.
+const MaxMailAttempts = 10
+
+// OutboxMessage is an email queued in the mail_outbox table. Its Status is one of the
+// delivery states of webhook deliveries: pending, succeeded or failed.
+type OutboxMessage struct {
+	ID            int64
+	CreatedAt     CustomTime
+	Recipient     string
+	Subject       string
+	PlainBody     string
+	HTMLBody      string
+	Status        string
+	Attempts      int
+	NextAttemptAt CustomTime
+	LastError     string
+	SentAt        *CustomTime
+}
+
+// Define an OutboxModel struct type which wraps a sql.DB connection pool.
+type OutboxModel struct {
+	DB dbConn
+}
+
+// Enqueue queues an email, to be sent as soon as the mail worker gets to it.
+func (m OutboxModel) Enqueue(ctx context.Context, msg *OutboxMessage) error {
+	query := `
+		INSERT INTO mail_outbox (recipient, subject, plain_body, html_body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, status, next_attempt_at`
+	args := []interface{}{msg.Recipient, msg.Subject, msg.PlainBody, msg.HTMLBody}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&msg.ID, &msg.CreatedAt, &msg.Status, &msg.NextAttemptAt)
+}
+
+// GetDue returns pending emails whose next attempt is due, oldest first.
+func (m OutboxModel) GetDue(ctx context.Context, now time.Time, limit int) ([]*OutboxMessage, error) {
+	query := `
+		SELECT id, created_at, recipient, subject, plain_body, html_body, status, attempts,
+			next_attempt_at, last_error, sent_at
+		FROM mail_outbox
+		WHERE status = 'pending' AND next_attempt_at <= $1
+		ORDER BY next_attempt_at ASC, id ASC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []*OutboxMessage{}
+	for rows.Next() {
+		var msg OutboxMessage
+		err := rows.Scan(
+			&msg.ID,
+			&msg.CreatedAt,
+			&msg.Recipient,
+			&msg.Subject,
+			&msg.PlainBody,
+			&msg.HTMLBody,
+			&msg.Status,
+			&msg.Attempts,
+			&msg.NextAttemptAt,
+			&msg.LastError,
+			&msg.SentAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, &msg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// RecordAttempt saves the outcome of an attempt to send an email. The caller sets Status,
+// LastError and NextAttemptAt; the attempt counter is bumped here.
+func (m OutboxModel) RecordAttempt(ctx context.Context, msg *OutboxMessage) error {
+	query := `
+		UPDATE mail_outbox
+		SET status = $1, attempts = attempts + 1, next_attempt_at = $2, last_error = $3,
+			sent_at = CASE WHEN $1 = 'succeeded' THEN NOW() END
+		WHERE id = $4
+		RETURNING attempts, sent_at`
+	args := []interface{}{msg.Status, msg.NextAttemptAt, msg.LastError, msg.ID}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&msg.Attempts, &msg.SentAt)
+}
+
+// DeleteFinished removes the emails that were sent, or given up on, when last attempted
+// more than age ago. They hold tokens which shouldn't be kept for longer than needed.
+func (m OutboxModel) DeleteFinished(ctx context.Context, age time.Duration) error {
+	query := `
+		DELETE FROM mail_outbox
+		WHERE status <> 'pending' AND next_attempt_at < $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now().Add(-age))
+	return err
+}
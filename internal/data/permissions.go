@@ -2,9 +2,6 @@ package data
 
 import (
 	"context"
-	"database/sql"
-	"github.com/lib/pq"
-	"time"
 )
 
 type Permissions []string
@@ -22,21 +19,27 @@ func (p Permissions) Include(code string) bool {
 
 // Define the PermissionModel type.
 type PermissionModel struct {
-	DB *sql.DB
+	DB dbConn
 }
 
 // The GetAllForUser() method returns all permission codes for a specific user in a
-// Permissions slice. The code in this method should feel very familiar --- it uses the
-// standard pattern that we've already seen before for retrieving multiple data rows in
-// an SQL query.
-func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+// Permissions slice, both those granted directly and those that come with the user's
+// roles. The code in this method should feel very familiar --- it uses the standard
+// pattern that we've already seen before for retrieving multiple data rows in an SQL
+// query.
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
 	query := `
 		SELECT permissions.code
 		FROM permissions
 		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-		INNER JOIN users ON users_permissions.user_id = users.id
-		WHERE users.id = $1`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		WHERE users_permissions.user_id = $1
+		UNION
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+		INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+		WHERE users_roles.user_id = $1`
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
 	rows, err := m.DB.QueryContext(ctx, query, userID)
 	if err != nil {
@@ -61,12 +64,12 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 // Add the provided permission codes for a specific user. Notice that we're using a
 // variadic parameter for the codes so that we can assign multiple permissions in a
 // single call.
-func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
 	query := `
 		INSERT INTO users_permissions
-		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		SELECT $1, permissions.id FROM permissions WHERE ` + m.DB.dialect.anyOf("permissions.code", "$2")
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	_, err := m.DB.ExecContext(ctx, query, userID, m.DB.dialect.array(codes))
 	return err
 }
@@ -0,0 +1,70 @@
+package data
+
+import "context"
+
+// Define a PinModel struct type which wraps a sql.DB connection pool. A row in task_pins
+// says that a user has pinned a task, which brings it to the top of their task lists.
+type PinModel struct {
+	DB dbConn
+}
+
+// Pin pins a task for a user. Pinning a task twice is not an error.
+func (m PinModel) Pin(ctx context.Context, userID, taskID int64) error {
+	query := `
+		INSERT INTO task_pins (user_id, task_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, taskID)
+	return err
+}
+
+// Unpin unpins a task for a user. Unpinning a task that isn't pinned is not an error.
+func (m PinModel) Unpin(ctx context.Context, userID, taskID int64) error {
+	query := `
+		DELETE FROM task_pins
+		WHERE user_id = $1 AND task_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, taskID)
+	return err
+}
+
+// GetForTasks reports which of the given tasks the user has pinned, in a single query.
+// The tasks that aren't pinned are left out of the map.
+func (m PinModel) GetForTasks(ctx context.Context, userID int64, taskIDs []int64) (map[int64]bool, error) {
+	pinned := make(map[int64]bool)
+	if len(taskIDs) == 0 {
+		return pinned, nil
+	}
+	query := `
+		SELECT task_id
+		FROM task_pins
+		WHERE user_id = $1 AND ` + m.DB.dialect.anyOf("task_id", "$2")
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, m.DB.dialect.array(taskIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var taskID int64
+		if err := rows.Scan(&taskID); err != nil {
+			return nil, err
+		}
+		pinned[taskID] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return pinned, nil
+}
@@ -0,0 +1,161 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// positionGap is the distance between the positions of neighbouring tasks when a board
+// column is (re)numbered. The gaps let a task be moved between two others by giving it the
+// position halfway between theirs, without touching any other task.
+const positionGap = 1024
+
+var ErrMoveAnchorNotFound = errors.New("move anchor not found")
+
+// TaskMove describes where a task is dropped on a board: into the Status column, directly
+// above BeforeID or directly below AfterID. With neither, the task goes to the bottom.
+type TaskMove struct {
+	Status   TaskStatus
+	BeforeID int64
+	AfterID  int64
+}
+
+// Move places a task in a status column of its workspace's board and saves the new status and
+// position, using the task's version number to detect concurrent edits. The column is
+// locked for the duration, so that concurrent moves can't hand out the same position.
+// If there's no room left between the neighbours, the column is renumbered. Move returns
+// ErrMoveAnchorNotFound if the BeforeID or AfterID task isn't in the column.
+func (m TaskModel) Move(ctx context.Context, task *Task, move TaskMove) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, position
+		FROM tasks
+		WHERE workspace_id = $1 AND status = $2 AND id <> $3
+		ORDER BY position ASC, id ASC
+		FOR UPDATE`
+	var ids, positions []int64
+	err = queryEach(ctx, tx, query, []interface{}{task.WorkspaceID, move.Status, task.ID}, func(rows *sql.Rows) error {
+		var id, position int64
+		err := rows.Scan(&id, &position)
+		ids = append(ids, id)
+		positions = append(positions, position)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	index, err := moveIndex(ids, move)
+	if err != nil {
+		return err
+	}
+
+	position, ok := positionBetween(positions, index)
+	if !ok {
+		position = renumberPositions(positions, index)
+		renumbered := m.DB.dialect.choose(
+			`unnest($1::bigint[], $2::bigint[]) AS renumbered (id, position)`,
+			`(SELECT ids.value AS id, positions.value AS position
+				FROM json_each($1) AS ids
+				INNER JOIN json_each($2) AS positions ON positions.key = ids.key) AS renumbered`)
+		query = `
+			UPDATE tasks
+			SET position = renumbered.position, updated_at = NOW()
+			FROM ` + renumbered + `
+			WHERE tasks.id = renumbered.id`
+		_, err = tx.ExecContext(ctx, query, m.DB.dialect.array(ids), m.DB.dialect.array(positions))
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `
+		UPDATE tasks
+		SET status = $1, position = $2, version = version + 1,
+			completed_at = CASE WHEN $1 <> 'completed' THEN NULL ELSE COALESCE(completed_at, NOW()) END, updated_at = NOW()
+		WHERE id = $3 AND version = $4
+		RETURNING version, completed_at, updated_at`
+	err = tx.QueryRowContext(ctx, query, move.Status, position, task.ID, task.Version).Scan(&task.Version, &task.CompletedAt, &task.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	task.Status = move.Status
+	task.Position = position
+
+	err = saveTaskVersion(ctx, tx, task.ID)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	m.cache.invalidate(task.WorkspaceID)
+	return nil
+}
+
+// moveIndex works out the index in a column, whose tasks have the given IDs in order, that
+// a moved task is inserted at.
+func moveIndex(ids []int64, move TaskMove) (int, error) {
+	if move.BeforeID == 0 && move.AfterID == 0 {
+		return len(ids), nil
+	}
+	index := -1
+	for i, id := range ids {
+		switch id {
+		case move.BeforeID:
+			index = i
+		case move.AfterID:
+			index = i + 1
+		}
+	}
+	if index < 0 {
+		return 0, ErrMoveAnchorNotFound
+	}
+	return index, nil
+}
+
+// renumberPositions spreads out the positions of a column that has no gap left, leaving
+// a slot for a task inserted at index, and returns the position of that slot.
+func renumberPositions(positions []int64, index int) int64 {
+	for i := range positions {
+		slot := i
+		if i >= index {
+			slot++
+		}
+		positions[i] = int64(slot+1) * positionGap
+	}
+	return int64(index+1) * positionGap
+}
+
+// positionBetween returns a free position for inserting a task at index into a column
+// with the given (sorted) positions, or false if the neighbours leave no room.
+func positionBetween(positions []int64, index int) (int64, bool) {
+	switch {
+	case len(positions) == 0:
+		return positionGap, true
+	case index == 0:
+		return positions[0] - positionGap, true
+	case index == len(positions):
+		return positions[len(positions)-1] + positionGap, true
+	}
+	before, after := positions[index-1], positions[index]
+	if after-before < 2 {
+		return 0, false
+	}
+	return before + (after-before)/2, true
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// maxReminderAttempts is how many times sending a reminder is tried before giving up.
+const maxReminderAttempts = 3
+
+// Define the delivery states recorded in the reminders table.
+const (
+	ReminderSent   = "sent"
+	ReminderFailed = "failed"
+)
+
+// DueReminder is a task that is about to fall due and whose owner hasn't been reminded
+// about it yet, together with what's needed to send the email.
+type DueReminder struct {
+	TaskID    int64
+	Title     string
+	DueDate   time.Time
+	UserID    int64
+	UserName  string
+	UserEmail string
+	// UserTimezone is the owner's time zone, which the email shows the due date in.
+	UserTimezone string
+}
+
+// Define a ReminderModel struct type which wraps a sql.DB connection pool.
+type ReminderModel struct {
+	DB dbConn
+}
+
+// GetDue returns the open tasks due between now and the end of their owner's reminder
+// window, leaving out snoozed ones until their snooze is over. A reminder is keyed on the task and its due date, so moving the due date
+// produces a new reminder, while one that was already sent (or failed too often) is
+// never sent again.
+func (m ReminderModel) GetDue(ctx context.Context, now time.Time, limit int) ([]*DueReminder, error) {
+	query := `
+		SELECT tasks.id, tasks.title, tasks.due_date, users.id, users.name, users.email, users.timezone
+		FROM tasks
+		INNER JOIN users ON users.id = tasks.user_id
+		LEFT JOIN user_settings ON user_settings.user_id = users.id
+		LEFT JOIN reminders ON reminders.task_id = tasks.id AND reminders.due_date = tasks.due_date
+		WHERE users.activated AND NOT users.deactivated
+		AND tasks.status <> 'completed'
+		AND NOT tasks.archived
+		AND (tasks.snoozed_until IS NULL OR tasks.snoozed_until <= $1)
+		AND COALESCE(user_settings.reminder_window_minutes, $2) > 0
+		AND tasks.due_date > $1
+		AND tasks.due_date <= ` + m.DB.dialect.addSeconds("$1", "COALESCE(user_settings.reminder_window_minutes, $2) * 60") + `
+		AND (reminders.id IS NULL OR (reminders.status = 'failed' AND reminders.attempts < $3))
+		ORDER BY tasks.due_date ASC
+		LIMIT $4`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, now, DefaultReminderWindow, maxReminderAttempts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []*DueReminder{}
+	for rows.Next() {
+		var reminder DueReminder
+		err := rows.Scan(
+			&reminder.TaskID,
+			&reminder.Title,
+			&reminder.DueDate,
+			&reminder.UserID,
+			&reminder.UserName,
+			&reminder.UserEmail,
+			&reminder.UserTimezone,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, &reminder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// Record stores the outcome of an attempt to send a reminder. sendErr is the error
+// returned by the mailer, or nil if the email went out.
+func (m ReminderModel) Record(ctx context.Context, reminder *DueReminder, sendErr error) error {
+	status, lastError := ReminderSent, ""
+	if sendErr != nil {
+		status, lastError = ReminderFailed, sendErr.Error()
+	}
+
+	query := `
+		INSERT INTO reminders (task_id, due_date, status, attempts, last_error, sent_at)
+		VALUES ($1, $2, $3, 1, $4, CASE WHEN $3 = 'sent' THEN NOW() END)
+		ON CONFLICT (task_id, due_date) DO UPDATE
+		SET status = EXCLUDED.status,
+			attempts = reminders.attempts + 1,
+			last_error = EXCLUDED.last_error,
+			sent_at = EXCLUDED.sent_at`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, reminder.TaskID, reminder.DueDate, status, lastError)
+	return err
+}
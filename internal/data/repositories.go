@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// TaskRepository stores tasks. TaskModel keeps them in PostgreSQL; MockTaskModel keeps
+// them in memory, for tests that don't have a database.
+type TaskRepository interface {
+	Insert(ctx context.Context, task *Task) error
+	GetForWorkspace(ctx context.Context, id int64, workspaceID int64) (*Task, error)
+	GetMany(ctx context.Context, workspaceID int64, ids []int64) ([]*Task, error)
+	GetForCategories(ctx context.Context, workspaceID int64, categoryIDs []int64) ([]*Task, error)
+	Update(ctx context.Context, task *Task) error
+	DeleteForWorkspace(ctx context.Context, id int64, workspaceID int64) error
+	GetAllForWorkspace(ctx context.Context, workspaceID int64, tf TaskFilters, filters Filters) ([]*Task, Metadata, error)
+	StreamForWorkspace(ctx context.Context, workspaceID int64, tf TaskFilters, filters Filters, fn func(task *Task) error) (Metadata, error)
+	GetPendingRecurrences(ctx context.Context, limit int) ([]*Task, error)
+	InsertOccurrence(ctx context.Context, prev *Task, next *Task) error
+	Duplicate(ctx context.Context, sourceID int64, copy *Task, opts DuplicateOptions) error
+	GetAllForCalendar(ctx context.Context, userID int64) ([]*Task, error)
+	ForEachForWorkspace(ctx context.Context, workspaceID int64, fn func(task *Task) error) error
+	InTx(ctx context.Context, fn func(tx TaskTx) error) error
+	Move(ctx context.Context, task *Task, move TaskMove) error
+}
+
+// TaskTx gives access to a workspace's tasks inside a transaction. It is handed to the
+// function passed to TaskRepository.InTx().
+type TaskTx interface {
+	Insert(task *Task) error
+	GetForWorkspace(id int64, workspaceID int64) (*Task, error)
+	Update(task *Task) error
+	DeleteForWorkspace(id int64, workspaceID int64) error
+	CheckBlockers(task *Task, from TaskStatus) error
+	// InsertCategory inserts a category, so that tasks can be filed in it in the same
+	// transaction.
+	InsertCategory(category *Category) error
+}
+
+// CategoryRepository stores the categories of workspaces. CategoryModel keeps them in
+// PostgreSQL; MockCategoryModel keeps them in memory.
+type CategoryRepository interface {
+	Insert(ctx context.Context, category *Category) error
+	Get(ctx context.Context, id int64, workspaceID int64) (*Category, error)
+	GetByName(ctx context.Context, workspaceID int64, name string) (*Category, error)
+	GetMany(ctx context.Context, workspaceID int64, ids []int64) (map[int64]*Category, error)
+	ResolveForTask(ctx context.Context, task *Task) error
+	Update(ctx context.Context, category *Category) error
+	Move(ctx context.Context, category *Category, parentID *int64) error
+	GetTree(ctx context.Context, workspaceID int64) ([]*CategoryNode, error)
+	Delete(ctx context.Context, id int64, workspaceID int64, strategy string, targetID int64) (*CategoryDeletion, error)
+	GetAll(ctx context.Context, workspaceID int64, name string, filters Filters) ([]*CategoryWithCounts, Metadata, error)
+}
+
+// UserRepository stores user accounts. UserModel keeps them in PostgreSQL; MockUserModel
+// keeps them in memory.
+type UserRepository interface {
+	Insert(ctx context.Context, user *User) error
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Get(ctx context.Context, id int64) (*User, error)
+	GetMany(ctx context.Context, ids []int64) (map[int64]*User, error)
+	GetAll(ctx context.Context, uf UserFilters, filters Filters) ([]*User, Metadata, error)
+	Update(ctx context.Context, user *User) error
+	GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+}
+
+// PermissionRepository stores the permissions granted to users. PermissionModel keeps
+// them in PostgreSQL; MockPermissionModel keeps them in memory.
+type PermissionRepository interface {
+	GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+	AddForUser(ctx context.Context, userID int64, codes ...string) error
+}
+
+// WorkspaceRepository stores workspaces, their members and invitations to join them.
+// WorkspaceModel keeps them in PostgreSQL; MockWorkspaceModel keeps them in memory.
+type WorkspaceRepository interface {
+	Insert(ctx context.Context, workspace *Workspace, ownerID int64) error
+	GetForUser(ctx context.Context, id int64, userID int64) (*Workspace, error)
+	GetAllForUser(ctx context.Context, userID int64) ([]*Workspace, error)
+	Update(ctx context.Context, workspace *Workspace) error
+	Delete(ctx context.Context, id int64) error
+	GetPersonalID(ctx context.Context, userID int64) (int64, error)
+	GetMember(ctx context.Context, workspaceID int64, userID int64) (*Member, error)
+	GetMembers(ctx context.Context, workspaceID int64) ([]*Member, error)
+	GetMemberIDs(ctx context.Context, workspaceID int64) ([]int64, error)
+	SetMemberRole(ctx context.Context, workspaceID int64, userID int64, role string) error
+	RemoveMember(ctx context.Context, workspaceID int64, userID int64) error
+	NewInvitation(ctx context.Context, workspaceID int64, email string, role string, invitedBy int64, ttl time.Duration) (*Invitation, error)
+	AcceptInvitation(ctx context.Context, tokenPlaintext string, user *User) (*Member, error)
+}
+
+// SessionRepository stores the sessions of signed-in clients. SessionModel keeps them in
+// PostgreSQL; MockSessionModel keeps them in memory.
+type SessionRepository interface {
+	New(ctx context.Context, userID int64, ttl time.Duration, scope, userAgent, ip string) (*Token, error)
+	GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, int64, error)
+	GetUser(ctx context.Context, id, userID int64, scope string) (*User, error)
+	Rotate(ctx context.Context, scope, tokenPlaintext string, ttl time.Duration) (*Token, error)
+	GetAllForUser(ctx context.Context, userID int64, scope string) ([]*Session, error)
+	Delete(ctx context.Context, id, userID int64, scope string) error
+	DeleteAllExcept(ctx context.Context, userID int64, scope string, keepID int64) (int64, error)
+}
+
+// AuditRepository stores the audit log. AuditModel keeps it in PostgreSQL;
+// MockAuditModel keeps it in memory.
+type AuditRepository interface {
+	Insert(ctx context.Context, entry *AuditEntry) error
+	GetAll(ctx context.Context, af AuditFilters, filters Filters) ([]*AuditEntry, Metadata, error)
+}
+
+// WebhookRepository stores webhooks and their deliveries. WebhookModel keeps them in
+// PostgreSQL; MockWebhookModel keeps them in memory.
+type WebhookRepository interface {
+	Insert(ctx context.Context, webhook *Webhook) error
+	Get(ctx context.Context, id int64, userID int64) (*Webhook, error)
+	GetAllForUser(ctx context.Context, userID int64) ([]*Webhook, error)
+	Update(ctx context.Context, webhook *Webhook) error
+	Delete(ctx context.Context, id int64, userID int64) error
+	Enqueue(ctx context.Context, userID int64, event string, payload []byte) error
+	GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, delivery *WebhookDelivery) error
+	GetDeliveries(ctx context.Context, webhookID int64, filters Filters) ([]*WebhookDelivery, Metadata, error)
+}
+
+// DependencyRepository stores which tasks block which. DependencyModel keeps them in
+// PostgreSQL; MockDependencyModel keeps them in memory.
+type DependencyRepository interface {
+	Add(ctx context.Context, taskID int64, blockerID int64) error
+	Remove(ctx context.Context, taskID int64, blockerID int64) error
+	GetBlockers(ctx context.Context, taskID int64) ([]*TaskRef, error)
+	GetDependents(ctx context.Context, taskID int64) ([]*TaskRef, error)
+	CheckBlockers(ctx context.Context, task *Task, from TaskStatus) error
+}
+
+// TimeEntryRepository stores the time tracked on tasks. TimeEntryModel keeps it in
+// PostgreSQL; MockTimeEntryModel keeps it in memory.
+type TimeEntryRepository interface {
+	Start(ctx context.Context, taskID int64, userID int64) (*TimeEntry, error)
+	Stop(ctx context.Context, taskID int64, userID int64) (*TimeEntry, error)
+	Insert(ctx context.Context, entry *TimeEntry) error
+	GetAllForTask(ctx context.Context, taskID int64) ([]*TimeEntry, error)
+	TotalForTask(ctx context.Context, taskID int64) (int64, error)
+	Delete(ctx context.Context, id int64, taskID int64) error
+}
+
+// PinRepository stores the tasks that users have pinned. PinModel keeps them in
+// PostgreSQL; MockPinModel keeps them in memory.
+type PinRepository interface {
+	Pin(ctx context.Context, userID, taskID int64) error
+	Unpin(ctx context.Context, userID, taskID int64) error
+	GetForTasks(ctx context.Context, userID int64, taskIDs []int64) (map[int64]bool, error)
+}
+
+// SettingsRepository stores users' preferences. SettingsModel keeps them in PostgreSQL;
+// MockSettingsModel keeps them in memory.
+type SettingsRepository interface {
+	Get(ctx context.Context, userID int64) (*Settings, error)
+	Save(ctx context.Context, settings *Settings) error
+}
+
+// Check that the SQL models implement the interfaces.
+var (
+	_ TaskRepository       = TaskModel{}
+	_ CategoryRepository   = CategoryModel{}
+	_ UserRepository       = UserModel{}
+	_ PermissionRepository = PermissionModel{}
+	_ WorkspaceRepository  = WorkspaceModel{}
+	_ SessionRepository    = SessionModel{}
+	_ AuditRepository      = AuditModel{}
+	_ WebhookRepository    = WebhookModel{}
+	_ DependencyRepository = DependencyModel{}
+	_ TimeEntryRepository  = TimeEntryModel{}
+	_ PinRepository        = PinModel{}
+	_ SettingsRepository   = SettingsModel{}
+)
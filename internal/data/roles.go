@@ -0,0 +1,170 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// The account roles. A role bundles a set of permissions, so that they can be granted
+// and taken away together. These are separate from the roles a user has in a workspace.
+const (
+	RoleAdmin   = "admin"
+	RoleManager = "manager"
+	RoleUser    = "user"
+)
+
+var AccountRoles = []string{RoleAdmin, RoleManager, RoleUser}
+
+var ErrLastAdmin = errors.New("last admin")
+
+type Roles []string
+
+// Include reports whether the Roles slice contains a specific role.
+func (r Roles) Include(name string) bool {
+	for i := range r {
+		if name == r[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// Role is an account role along with the permission codes it grants.
+type Role struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// Define the RoleModel type.
+type RoleModel struct {
+	DB dbConn
+}
+
+// GetAll returns every role with its permissions.
+func (m RoleModel) GetAll(ctx context.Context) ([]*Role, error) {
+	query := `
+		SELECT roles.name, ` + m.DB.dialect.arrayAgg("permissions.code") + `
+		FROM roles
+		LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+		LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id
+		GROUP BY roles.id
+		ORDER BY roles.id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	roles := []*Role{}
+	err := queryEach(ctx, m.DB, query, nil, func(rows *sql.Rows) error {
+		var role Role
+		err := rows.Scan(&role.Name, m.DB.dialect.array(&role.Permissions))
+		roles = append(roles, &role)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetAllForUser returns the names of a user's roles. It returns ErrRecordNotFound if the
+// user doesn't exist.
+func (m RoleModel) GetAllForUser(ctx context.Context, userID int64) (Roles, error) {
+	query := `
+		SELECT ` + m.DB.dialect.arrayAgg("roles.name") + `
+		FROM users
+		LEFT JOIN users_roles ON users_roles.user_id = users.id
+		LEFT JOIN roles ON roles.id = users_roles.role_id
+		WHERE users.id = $1
+		GROUP BY users.id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var roles Roles
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(m.DB.dialect.array(&roles))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return roles, nil
+}
+
+// AddForUser gives a user a role. Giving a user a role they already have is not an
+// error. It returns ErrRecordNotFound if the user doesn't exist.
+func (m RoleModel) AddForUser(ctx context.Context, userID int64, name string) error {
+	query := `
+		INSERT INTO users_roles (user_id, role_id)
+		SELECT $1, roles.id FROM roles WHERE roles.name = $2
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, name)
+	if err != nil {
+		switch {
+		case m.DB.dialect.isForeignKeyViolation(err, "users_roles_user_id_fkey"):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveForUser takes a role away from a user. It returns ErrRecordNotFound if the user
+// doesn't have the role, and ErrLastAdmin rather than leave the system without an admin.
+func (m RoleModel) RemoveForUser(ctx context.Context, userID int64, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if name == RoleAdmin {
+		// Lock the admins, so that two admins can't demote each other at the same time.
+		admins := map[int64]bool{}
+		query := `
+			SELECT users_roles.user_id
+			FROM users_roles
+			INNER JOIN roles ON roles.id = users_roles.role_id
+			WHERE roles.name = $1
+			FOR UPDATE OF users_roles`
+		err = queryEach(ctx, tx, query, []interface{}{RoleAdmin}, func(rows *sql.Rows) error {
+			var id int64
+			err := rows.Scan(&id)
+			admins[id] = true
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if admins[userID] && len(admins) == 1 {
+			return ErrLastAdmin
+		}
+	}
+
+	query := `
+		DELETE FROM users_roles
+		WHERE user_id = $1 AND role_id IN (SELECT id FROM roles WHERE name = $2)`
+	result, err := tx.ExecContext(ctx, query, userID, name)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return tx.Commit()
+}
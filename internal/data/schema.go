@@ -0,0 +1,53 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// SchemaVersion is the state of the database schema, as recorded by golang-migrate in
+// the schema_migrations table.
+type SchemaVersion struct {
+	Version int64 `json:"version"`
+	// Dirty is set when a migration failed part way through and needs fixing by hand.
+	Dirty bool `json:"dirty"`
+}
+
+// Define a SchemaModel struct type which wraps a sql.DB connection pool.
+type SchemaModel struct {
+	DB dbConn
+}
+
+// Version returns the version of the last migration applied, or ErrRecordNotFound if
+// none has been.
+func (m SchemaModel) Version(ctx context.Context) (*SchemaVersion, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	// The table only exists once migrations have been run, and selecting from it
+	// before then would be an error.
+	var exists bool
+	query := m.DB.dialect.choose(
+		`SELECT to_regclass('schema_migrations') IS NOT NULL`,
+		`SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')`)
+	err := m.DB.QueryRowContext(ctx, query).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrRecordNotFound
+	}
+
+	var schema SchemaVersion
+	err = m.DB.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&schema.Version, &schema.Dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &schema, nil
+}
@@ -0,0 +1,339 @@
+package data
+
+import (
+	"context"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// Define the kinds of records that GET /v1/search looks through.
+const (
+	SearchTasks      = "tasks"
+	SearchCategories = "categories"
+	SearchTags       = "tags"
+	SearchComments   = "comments"
+)
+
+// SearchTypes lists the kinds of records that can be searched.
+var SearchTypes = []string{SearchTasks, SearchCategories, SearchTags, SearchComments}
+
+// MaxSearchLimit is the most results of each kind that a search returns.
+const MaxSearchLimit = 50
+
+// snippetWords is how many words of a record's text a search result shows around the
+// first match.
+const snippetWords = 24
+
+// SearchResult is a record matching a search: its title (the name of a category or tag,
+// or the title of the task a comment is on) and a snippet of its text around the first
+// match. The snippet is HTML-escaped, with the matching words wrapped in <mark>.
+type SearchResult struct {
+	ID      int64  `json:"id"`
+	TaskID  *int64 `json:"task_id,omitempty"`
+	Title   string `json:"title"`
+	Snippet string `json:"snippet"`
+}
+
+// SearchGroup holds the best matches of one kind, along with how many there are in all.
+// Fuzzy is set when nothing matched exactly and the results are tasks with titles similar
+// to the query instead.
+type SearchGroup struct {
+	Total   int             `json:"total"`
+	Fuzzy   bool            `json:"fuzzy,omitempty"`
+	Results []*SearchResult `json:"results"`
+}
+
+// ValidateSearch checks the parameters of a search. The query needs at least one word to
+// look for, since everything else in it is ignored.
+func ValidateSearch(v *validator.Validator, q string, types []string, limit int) {
+	v.Check(q != "", "q", "must be provided")
+	if q != "" {
+		v.Check(searchQuery(q) != "", "q", "must contain at least one letter or digit")
+	}
+	for _, t := range types {
+		v.Check(validator.In(t, SearchTypes...), "types", "must be one of "+strings.Join(SearchTypes, ", "))
+	}
+	v.Check(validator.Unique(types), "types", "must not contain duplicate values")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= MaxSearchLimit, "limit", "must be a maximum of 50")
+}
+
+// Define a SearchModel struct type which wraps a sql.DB connection pool.
+type SearchModel struct {
+	DB dbConn
+}
+
+// Search looks for q in the records of the given kinds that the user can see: the tasks,
+// categories and task comments of a workspace, and the user's own tags. Archived tasks,
+// and the comments on them, are left out. Up to limit of the best matches of each kind
+// are returned, keyed by kind. If no task matches and similarity is above zero, the tasks
+// whose titles are at least that similar to q are returned instead, most similar first.
+func (m SearchModel) Search(ctx context.Context, workspaceID, userID int64, q string, types []string, limit int, similarity float64) (map[string]*SearchGroup, error) {
+	tsquery := searchQuery(q)
+	d := m.DB.dialect
+
+	queries := map[string]struct {
+		sql   string
+		owner int64
+	}{
+		SearchTasks: {`
+			SELECT count(*) OVER(), id, NULL, title, title, description
+			FROM tasks
+			WHERE workspace_id = $1 AND NOT archived AND ` + d.search("search", "title", "description", "$2") + `
+			ORDER BY ` + d.searchRank("search", "title", "description", "$2") + ` DESC, id ASC
+			LIMIT $3`, workspaceID},
+		SearchCategories: {`
+			SELECT count(*) OVER(), id, NULL, name, name, COALESCE(description, '')
+			FROM categories
+			WHERE workspace_id = $1 AND ` + d.search("search", "name", "COALESCE(description, '')", "$2") + `
+			ORDER BY ` + d.searchRank("search", "name", "COALESCE(description, '')", "$2") + ` DESC, id ASC
+			LIMIT $3`, workspaceID},
+		SearchTags: {`
+			SELECT count(*) OVER(), id, NULL, name, name, ''
+			FROM tags
+			WHERE user_id = $1 AND ` + d.search("search", "name", "''", "$2") + `
+			ORDER BY ` + d.searchRank("search", "name", "''", "$2") + ` DESC, id ASC
+			LIMIT $3`, userID},
+		SearchComments: {`
+			SELECT count(*) OVER(), comments.id, comments.task_id, tasks.title, comments.body, ''
+			FROM comments
+			INNER JOIN tasks ON tasks.id = comments.task_id
+			WHERE tasks.workspace_id = $1 AND NOT tasks.archived AND ` + d.search("comments.search", "comments.body", "''", "$2") + `
+			ORDER BY ` + d.searchRank("comments.search", "comments.body", "''", "$2") + ` DESC, comments.id DESC
+			LIMIT $3`, workspaceID},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	groups := make(map[string]*SearchGroup, len(types))
+	words := searchWords(tsquery)
+	exact := func(word string) bool { return matchesAny(word, words) }
+	for _, kind := range types {
+		query := queries[kind]
+		group, err := m.searchGroup(ctx, exact, query.sql, query.owner, tsquery, limit)
+		if err != nil {
+			return nil, err
+		}
+		if kind == SearchTasks && group.Total == 0 && similarity > 0 {
+			group, err = m.searchSimilarTasks(ctx, workspaceID, q, limit, similarity)
+			if err != nil {
+				return nil, err
+			}
+		}
+		groups[kind] = group
+	}
+	return groups, nil
+}
+
+// searchSimilarTasks looks for tasks whose titles are similar to q, for when a search
+// finds none that match it exactly, most likely because of a typo.
+func (m SearchModel) searchSimilarTasks(ctx context.Context, workspaceID int64, q string, limit int, similarity float64) (*SearchGroup, error) {
+	query := `
+		SELECT count(*) OVER(), id, NULL, title, title, description
+		FROM tasks
+		WHERE workspace_id = $1 AND NOT archived AND word_similarity($2, title) >= $4
+		ORDER BY word_similarity($2, title) DESC, id ASC
+		LIMIT $3`
+
+	similar := func(word string) bool { return similarWords(word, q, similarity) }
+	group, err := m.searchGroup(ctx, similar, query, workspaceID, q, limit, similarity)
+	if err != nil {
+		return nil, err
+	}
+	group.Fuzzy = group.Total > 0
+	return group, nil
+}
+
+// TaskResults turns the IDs of tasks found by an external search engine into results,
+// in the same order. Tasks that are no longer in the workspace, or have been archived
+// since they were indexed, are left out.
+func (m SearchModel) TaskResults(ctx context.Context, workspaceID int64, ids []int64, q string) ([]*SearchResult, error) {
+	results := []*SearchResult{}
+	if len(ids) == 0 {
+		return results, nil
+	}
+	query := `
+		SELECT id, title, description
+		FROM tasks
+		WHERE workspace_id = $1 AND NOT archived AND ` + m.DB.dialect.anyOf("id", "$2")
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID, m.DB.dialect.array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	words := searchWords(searchQuery(q))
+	exact := func(word string) bool { return matchesAny(word, words) }
+	found := make(map[int64]*SearchResult, len(ids))
+	for rows.Next() {
+		var result SearchResult
+		var description string
+		err := rows.Scan(&result.ID, &result.Title, &description)
+		if err != nil {
+			return nil, err
+		}
+		result.Snippet = snippet(result.Title, exact)
+		if !strings.Contains(result.Snippet, "<mark>") {
+			result.Snippet = snippet(description, exact)
+		}
+		found[result.ID] = &result
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if result, ok := found[id]; ok {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// TasksAfter returns up to limit unarchived tasks of all workspaces with IDs above
+// afterID, in ID order, for filling an external search index a batch at a time.
+func (m SearchModel) TasksAfter(ctx context.Context, afterID int64, limit int) ([]*Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE id > $1 AND NOT archived
+		ORDER BY id
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []*Task{}
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(task.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// searchGroup runs the query for one kind of record. The query returns the total number
+// of matches, the ID, the task ID of a comment, the title, and the two texts that the
+// snippet can come from: the first, or the second if only it matches. match picks the
+// words to highlight.
+func (m SearchModel) searchGroup(ctx context.Context, match func(word string) bool, query string, args ...interface{}) (*SearchGroup, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	group := &SearchGroup{Results: []*SearchResult{}}
+	for rows.Next() {
+		var result SearchResult
+		var first, second string
+		err := rows.Scan(&group.Total, &result.ID, &result.TaskID, &result.Title, &first, &second)
+		if err != nil {
+			return nil, err
+		}
+		result.Snippet = snippet(first, match)
+		if !strings.Contains(result.Snippet, "<mark>") && second != "" {
+			result.Snippet = snippet(second, match)
+		}
+		group.Results = append(group.Results, &result)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// snippet returns up to snippetWords words of text, starting a few words before the first
+// one that match reports as matching, HTML-escaped and with the matching words wrapped in
+// <mark>. match is given the words in lower case. An ellipsis marks where text was cut off.
+func snippet(text string, match func(word string) bool) string {
+	// Find the words of the text, as textWords() does, but keeping their positions.
+	type span struct{ start, end int }
+	var spans []span
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			spans = append(spans, span{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start, len(text)})
+	}
+
+	matches := make([]bool, len(spans))
+	first := -1
+	for i, s := range spans {
+		matches[i] = match(strings.ToLower(text[s.start:s.end]))
+		if matches[i] && first < 0 {
+			first = i
+		}
+	}
+
+	from, to := 0, len(spans)
+	if first > 4 {
+		from = first - 4
+	}
+	if to-from > snippetWords {
+		to = from + snippetWords
+	}
+
+	var b strings.Builder
+	textStart, textEnd := 0, len(text)
+	if from > 0 {
+		textStart = spans[from].start
+		b.WriteString("…")
+	}
+	if to < len(spans) {
+		textEnd = spans[to-1].end
+	}
+	pos := textStart
+	for i := from; i < to; i++ {
+		s := spans[i]
+		if !matches[i] {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:s.start]))
+		b.WriteString("<mark>" + html.EscapeString(text[s.start:s.end]) + "</mark>")
+		pos = s.end
+	}
+	b.WriteString(html.EscapeString(text[pos:textEnd]))
+	if textEnd < len(text) {
+		b.WriteString("…")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// matchesAny reports whether a lower-case word starts with one of the search words.
+func matchesAny(word string, words []string) bool {
+	for _, want := range words {
+		if strings.HasPrefix(word, want) {
+			return true
+		}
+	}
+	return false
+}
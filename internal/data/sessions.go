@@ -0,0 +1,262 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Session is a signed-in client, as seen by its owner. Each one is backed by a token:
+// an authentication token normally, or a refresh token in JWT mode.
+type Session struct {
+	ID         int64       `json:"id"`
+	CreatedAt  CustomTime  `json:"created_at"`
+	LastUsedAt *CustomTime `json:"last_used_at"`
+	Expiry     CustomTime  `json:"expiry"`
+	UserAgent  string      `json:"user_agent"`
+	IP         string      `json:"ip"`
+	// Current is set on the session that the request listing the sessions was made with.
+	Current bool `json:"current"`
+}
+
+// Define a SessionModel struct type which wraps a sql.DB connection pool.
+type SessionModel struct {
+	DB dbConn
+}
+
+// New issues a token for a new session, recording the client it was issued to. The
+// token's ID identifies the session.
+func (m SessionModel) New(ctx context.Context, userID int64, ttl time.Duration, scope, userAgent, ip string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO tokens (hash, user_id, expiry, scope, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	args := []interface{}{token.Hash, userID, token.Expiry, scope, userAgent, ip}
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&token.ID)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetForToken returns the user that a session token belongs to along with the session's
+// ID, and records that the session has been used. It returns ErrRecordNotFound for an
+// unknown, revoked or expired token.
+func (m SessionModel) GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, int64, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	// SQLite can't update in a WITH query, so there the session is marked as used by a
+	// statement of its own.
+	query := m.DB.dialect.choose(`
+		WITH token AS (
+			UPDATE tokens
+			SET last_used_at = NOW()
+			WHERE hash = $1 AND scope = $2 AND expiry > $3
+			RETURNING id, user_id
+		)
+		SELECT token.id, users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.deactivated, users.timezone, users.version
+		FROM token
+		INNER JOIN users ON users.id = token.user_id`, `
+		SELECT token.id, users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.deactivated, users.timezone, users.version
+		FROM tokens AS token
+		INNER JOIN users ON users.id = token.user_id
+		WHERE token.hash = $1 AND token.scope = $2 AND token.expiry > $3`)
+	args := []interface{}{hash[:], scope, time.Now()}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	if !m.DB.dialect.writableCTEs() {
+		_, err := m.DB.ExecContext(ctx, `UPDATE tokens SET last_used_at = NOW() WHERE hash = $1 AND scope = $2 AND expiry > $3`, args...)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var sessionID int64
+	var user User
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&sessionID,
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Deactivated,
+		&user.Timezone,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, 0, ErrRecordNotFound
+		default:
+			return nil, 0, err
+		}
+	}
+	return &user, sessionID, nil
+}
+
+// GetUser returns the user that the session with the given ID belongs to, for access
+// tokens that carry the session's ID rather than its token. It returns ErrRecordNotFound
+// if the session has been revoked or has expired, or belongs to someone else.
+func (m SessionModel) GetUser(ctx context.Context, id, userID int64, scope string) (*User, error) {
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.deactivated, users.timezone, users.version
+		FROM tokens
+		INNER JOIN users ON users.id = tokens.user_id
+		WHERE tokens.id = $1 AND tokens.user_id = $2 AND tokens.scope = $3 AND tokens.expiry > $4`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var user User
+	err := m.DB.QueryRowContext(ctx, query, id, userID, scope, time.Now()).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Deactivated,
+		&user.Timezone,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// Rotate replaces a session's token with a new one, which expires ttl from now. The old
+// token stops working, and the session keeps its ID. It returns ErrRecordNotFound if the
+// token is unknown, expired or was already rotated.
+func (m SessionModel) Rotate(ctx context.Context, scope, tokenPlaintext string, ttl time.Duration) (*Token, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	token, err := generateToken(0, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE tokens
+		SET hash = $1, expiry = $2, last_used_at = NOW()
+		WHERE hash = $3 AND scope = $4 AND expiry > $5
+		RETURNING id, user_id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	args := []interface{}{token.Hash, token.Expiry, hash[:], scope, time.Now()}
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&token.ID, &token.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+// GetAllForUser returns a user's unexpired sessions, most recently used first.
+func (m SessionModel) GetAllForUser(ctx context.Context, userID int64, scope string) ([]*Session, error) {
+	query := `
+		SELECT id, created_at, last_used_at, expiry, user_agent, ip
+		FROM tokens
+		WHERE user_id = $1 AND scope = $2 AND expiry > $3
+		ORDER BY COALESCE(last_used_at, created_at) DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, scope, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.UserAgent,
+			&session.IP,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Delete revokes one of a user's sessions.
+func (m SessionModel) Delete(ctx context.Context, id, userID int64, scope string) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM tokens
+		WHERE id = $1 AND user_id = $2 AND scope = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID, scope)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteAllExcept revokes all of a user's sessions apart from the one with the given ID,
+// and returns how many were revoked.
+func (m SessionModel) DeleteAllExcept(ctx context.Context, userID int64, scope string, keepID int64) (int64, error) {
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND scope = $2 AND id <> $3`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, scope, keepID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
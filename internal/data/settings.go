@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// DefaultReminderWindow is how long before a task's due date its owner is reminded,
+// unless they have chosen otherwise.
+const DefaultReminderWindow = 24 * 60
+
+// DefaultPageSize and DefaultSort are how lists of tasks are paginated and sorted for
+// users who haven't chosen otherwise. MaxDefaultPageSize is the largest page size that
+// can be made the default; larger pages have to be asked for.
+const (
+	DefaultPageSize    = 20
+	DefaultSort        = "id"
+	MaxDefaultPageSize = 100
+)
+
+// Settings holds a user's preferences. Users who never changed anything have no row in
+// the user_settings table and get the defaults.
+type Settings struct {
+	UserID int64 `json:"-"`
+	// ReminderWindow is in minutes; 0 turns due-date reminders off.
+	ReminderWindow int `json:"reminder_window_minutes"`
+	// DailyDigest opts the user in to a daily summary email of their upcoming and
+	// overdue tasks.
+	DailyDigest bool `json:"daily_digest"`
+	// RequireTwoFactor makes POST /v1/users/token ask for a TOTP or recovery code as well
+	// as the password. It can only be turned on once two-factor authentication is set up.
+	RequireTwoFactor bool `json:"require_two_factor"`
+	// Locale is the language of the API's messages, which takes precedence over the
+	// Accept-Language header. Empty goes by the header.
+	Locale string `json:"locale"`
+	// DefaultPageSize and DefaultSort are used by GET /v1/tasks when the page_size and
+	// sort parameters aren't given.
+	DefaultPageSize int    `json:"default_page_size"`
+	DefaultSort     string `json:"default_sort"`
+	// DigestHour is the hour of the day, in the user's time zone, after which the daily
+	// digest is sent; nil for the server's configured hour.
+	DigestHour *int `json:"digest_hour"`
+}
+
+// ValidateSettings checks a user's settings. The locale is checked against the languages
+// that messages are available in, which the i18n package knows.
+func ValidateSettings(v *validator.Validator, settings *Settings, locales []string) {
+	v.Check(settings.ReminderWindow >= 0, "reminder_window_minutes", "must not be negative")
+	v.Check(settings.ReminderWindow <= 30*24*60, "reminder_window_minutes", "must not be more than 30 days")
+	v.Check(settings.Locale == "" || validator.In(settings.Locale, locales...), "locale", fmt.Sprintf(validator.MsgOneOf, strings.Join(locales, ", ")))
+	validator.Field(v, "default_page_size", settings.DefaultPageSize, validator.Range(1, MaxDefaultPageSize))
+	v.Check(validator.In(settings.DefaultSort, TaskSorts...), "default_sort", fmt.Sprintf(validator.MsgOneOf, strings.Join(TaskSorts, ", ")))
+	if settings.DigestHour != nil {
+		validator.Field(v, "digest_hour", *settings.DigestHour, validator.Range(0, 23))
+	}
+}
+
+// Define a SettingsModel struct type which wraps a sql.DB connection pool.
+type SettingsModel struct {
+	DB dbConn
+}
+
+// Get returns a user's settings, falling back to the defaults.
+func (m SettingsModel) Get(ctx context.Context, userID int64) (*Settings, error) {
+	query := `
+		SELECT reminder_window_minutes, daily_digest, require_two_factor, locale, default_page_size, default_sort, digest_hour
+		FROM user_settings
+		WHERE user_id = $1`
+	settings := Settings{UserID: userID, ReminderWindow: DefaultReminderWindow, DefaultPageSize: DefaultPageSize, DefaultSort: DefaultSort}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&settings.ReminderWindow,
+		&settings.DailyDigest,
+		&settings.RequireTwoFactor,
+		&settings.Locale,
+		&settings.DefaultPageSize,
+		&settings.DefaultSort,
+		&settings.DigestHour,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// Save stores a user's settings, creating the row on first use.
+func (m SettingsModel) Save(ctx context.Context, settings *Settings) error {
+	query := `
+		INSERT INTO user_settings (user_id, reminder_window_minutes, daily_digest, require_two_factor, locale, default_page_size, default_sort, digest_hour)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id) DO UPDATE
+		SET reminder_window_minutes = EXCLUDED.reminder_window_minutes,
+			daily_digest = EXCLUDED.daily_digest,
+			require_two_factor = EXCLUDED.require_two_factor,
+			locale = EXCLUDED.locale,
+			default_page_size = EXCLUDED.default_page_size,
+			default_sort = EXCLUDED.default_sort,
+			digest_hour = EXCLUDED.digest_hour`
+	args := []interface{}{
+		settings.UserID,
+		settings.ReminderWindow,
+		settings.DailyDigest,
+		settings.RequireTwoFactor,
+		settings.Locale,
+		settings.DefaultPageSize,
+		settings.DefaultSort,
+		settings.DigestHour,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
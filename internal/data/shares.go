@@ -0,0 +1,109 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+)
+
+// ScopeShare is the scope of the tokens in public task links. Like invitations, they are
+// kept in their own table since they belong to a task rather than to a user.
+const ScopeShare = "share"
+
+// TaskShare is a public, read-only link to a single task. Only the hash of the token is
+// stored, so the plaintext is only known when the link is created.
+type TaskShare struct {
+	Plaintext string     `json:"token"`
+	Hash      []byte     `json:"-"`
+	TaskID    int64      `json:"task_id"`
+	CreatedBy int64      `json:"-"`
+	CreatedAt CustomTime `json:"created_at"`
+}
+
+// Define a ShareModel struct type which wraps a sql.DB connection pool.
+type ShareModel struct {
+	DB dbConn
+}
+
+// New creates a share link for a task. A task has at most one link, so sharing it again
+// replaces the earlier link, which stops working.
+func (m ShareModel) New(ctx context.Context, taskID int64, userID int64) (*TaskShare, error) {
+	// Share links don't expire; they last until they are revoked or replaced.
+	token, err := generateToken(userID, 0, ScopeShare)
+	if err != nil {
+		return nil, err
+	}
+	share := &TaskShare{
+		Plaintext: token.Plaintext,
+		Hash:      token.Hash,
+		TaskID:    taskID,
+		CreatedBy: userID,
+	}
+
+	query := `
+		INSERT INTO task_shares (hash, task_id, created_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (task_id) DO UPDATE
+		SET hash = EXCLUDED.hash, created_by = EXCLUDED.created_by, created_at = NOW()
+		RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, share.Hash, taskID, userID).Scan(&share.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// GetTask returns the task a share token points to, or ErrRecordNotFound if the token
+// is unknown or has been revoked.
+func (m ShareModel) GetTask(ctx context.Context, tokenPlaintext string) (*Task, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE id = (SELECT task_id FROM task_shares WHERE hash = $1)`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var task Task
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(task.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &task, nil
+}
+
+// Delete revokes a task's share link. It returns ErrRecordNotFound if the task isn't
+// shared.
+func (m ShareModel) Delete(ctx context.Context, taskID int64) error {
+	query := `
+		DELETE FROM task_shares
+		WHERE task_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, taskID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
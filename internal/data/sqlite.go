@@ -0,0 +1,259 @@
+package data
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Open opens a connection pool on the given driver, one of Drivers. For PostgreSQL the
+// DSN is a connection string or URL; for SQLite it is the path of the database file,
+// which is created if it doesn't exist.
+func Open(driverName, dsn string) (*sql.DB, error) {
+	switch driverName {
+	case DriverPostgres:
+		return sql.Open("postgres", dsn)
+	case DriverSQLite:
+		return openSQLite(sqliteDSN(dsn))
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driverName)
+	}
+}
+
+// sqliteDSN adds the connection options the models rely on to a SQLite DSN:
+//
+//   - foreign keys are enforced, so that ON DELETE CASCADE works;
+//   - a writer waits for the database to be unlocked instead of failing at once;
+//   - write-ahead logging lets requests read while another one writes;
+//   - transactions take the write lock when they begin, which stands in for the
+//     SELECT ... FOR UPDATE that the queries use in PostgreSQL.
+//
+// Options already in the DSN are kept.
+func sqliteDSN(dsn string) string {
+	path, query, _ := strings.Cut(dsn, "?")
+	options := []string{"_foreign_keys=on", "_busy_timeout=5000", "_journal_mode=WAL", "_txlock=immediate"}
+	for _, option := range options {
+		name, _, _ := strings.Cut(option, "=")
+		if !strings.Contains("&"+query, "&"+name+"=") {
+			query = strings.TrimPrefix(query+"&"+option, "&")
+		}
+	}
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + path
+	}
+	return path + "?" + query
+}
+
+// sqliteQuery translates the parts of a query written for PostgreSQL that SQLite only
+// spells differently:
+//
+//   - $1 placeholders become ?1, which SQLite binds by number like PostgreSQL does;
+//   - ::type casts are dropped, since SQLite columns take any type;
+//   - FOR UPDATE [OF table] is dropped, since transactions lock the whole database
+//     anyway, see sqliteDSN().
+//
+// String literals and quoted identifiers are left alone.
+func sqliteQuery(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			b.WriteByte('?')
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			i += 2
+			for i < len(query) && (isWordByte(query[i]) || query[i] == '[' || query[i] == ']') {
+				i++
+			}
+			i--
+		case hasKeywords(query[i:], "FOR", "UPDATE") && (i == 0 || !isWordByte(query[i-1])):
+			rest := strings.TrimLeft(query[i+len("FOR"):], " \t\n")
+			i = len(query) - len(strings.TrimLeft(rest[len("UPDATE"):], " \t\n"))
+			if hasKeywords(query[i:], "OF") {
+				i = len(query) - len(strings.TrimLeft(query[i+len("OF"):], " \t\n"))
+				for i < len(query) && (isWordByte(query[i]) || query[i] == '.') {
+					i++
+				}
+			}
+			i--
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// hasKeywords reports whether s starts with the given keywords, separated by whitespace
+// and each followed by a non-word character.
+func hasKeywords(s string, keywords ...string) bool {
+	for i, keyword := range keywords {
+		if i > 0 {
+			trimmed := strings.TrimLeft(s, " \t\n")
+			if trimmed == s {
+				return false
+			}
+			s = trimmed
+		}
+		if len(s) < len(keyword) || !strings.EqualFold(s[:len(keyword)], keyword) {
+			return false
+		}
+		s = s[len(keyword):]
+		if s != "" && isWordByte(s[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// sqliteTimeFormat is how SQLite stores times: the format of now() below, of the column
+// defaults in the SQLite migrations, and of the times that CheckNamedValue passes to the
+// SQLite driver.
+const sqliteTimeFormat = "2006-01-02 15:04:05-07:00"
+
+// sqliteNow is now(): the current time, in UTC and to the second.
+func sqliteNow() string {
+	return time.Now().UTC().Round(time.Second).Format(sqliteTimeFormat)
+}
+
+// sqliteTextMatch is text_match(document, query), which like plainto_tsquery() matches
+// a document containing every word of the query.
+func sqliteTextMatch(document, query string) bool {
+	words := textWords(document)
+	for _, want := range textWords(query) {
+		if !containsWord(words, want, false) {
+			return false
+		}
+	}
+	return true
+}
+
+// sqliteTextSearch is text_search(document, query), for a query built by searchQuery():
+// it matches a document containing a word starting with each word of the query.
+func sqliteTextSearch(document, query string) bool {
+	words := textWords(document)
+	for _, want := range searchWords(query) {
+		if !containsWord(words, want, true) {
+			return false
+		}
+	}
+	return true
+}
+
+// sqliteTextSearchRank is text_search_rank(title, body, query). Like ts_rank() on the
+// search columns, matches in the title count for more than matches in the body.
+func sqliteTextSearchRank(title, body, query string) float64 {
+	titleWords, bodyWords := textWords(title), textWords(body)
+	var rank float64
+	for _, want := range searchWords(query) {
+		if containsWord(titleWords, want, true) {
+			rank += 1
+		}
+		if containsWord(bodyWords, want, true) {
+			rank += 0.4
+		}
+	}
+	return rank
+}
+
+// sqliteLeast and sqliteGreatest are least() and greatest(). SQLite has min() and max()
+// for this, but unlike them least() and greatest() ignore NULL arguments.
+func sqliteLeast(args ...interface{}) (interface{}, error) {
+	return sqliteExtreme(args, -1)
+}
+
+func sqliteGreatest(args ...interface{}) (interface{}, error) {
+	return sqliteExtreme(args, 1)
+}
+
+// sqliteExtreme returns the argument that compares as sign to all the others, skipping
+// NULLs. Numbers are compared by value and text, which includes times, by bytes.
+func sqliteExtreme(args []interface{}, sign int) (interface{}, error) {
+	var result interface{}
+	for _, arg := range args {
+		if arg == nil {
+			continue
+		}
+		if result == nil {
+			result = arg
+			continue
+		}
+		c, err := compareSQLiteValues(arg, result)
+		if err != nil {
+			return nil, err
+		}
+		if c == sign {
+			result = arg
+		}
+	}
+	return result, nil
+}
+
+func compareSQLiteValues(a, b interface{}) (int, error) {
+	switch a := a.(type) {
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return cmp.Compare(a, b), nil
+		case float64:
+			return cmp.Compare(float64(a), b), nil
+		}
+	case float64:
+		switch b := b.(type) {
+		case int64:
+			return cmp.Compare(a, float64(b)), nil
+		case float64:
+			return cmp.Compare(a, b), nil
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+}
+
+// textWords splits text into lower-case words the way the 'simple' text search
+// configuration does.
+func textWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchWords returns the words of a query built by searchQuery().
+func searchWords(query string) []string {
+	words := strings.Split(strings.ToLower(query), " & ")
+	for i, word := range words {
+		words[i] = strings.TrimSuffix(word, ":*")
+	}
+	return words
+}
+
+func containsWord(words []string, want string, prefix bool) bool {
+	for _, word := range words {
+		if word == want || prefix && strings.HasPrefix(word, want) {
+			return true
+		}
+	}
+	return false
+}
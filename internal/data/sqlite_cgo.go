@@ -0,0 +1,143 @@
+//go:build cgo
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// openSQLite opens a connection pool on a SQLite database. SQLite support needs cgo, for
+// github.com/mattn/go-sqlite3; builds without it, such as static PostgreSQL-only ones,
+// get the stub in sqlite_nocgo.go instead.
+func openSQLite(dsn string) (*sql.DB, error) {
+	return sql.OpenDB(sqliteConnector{dsn: dsn}), nil
+}
+
+// sqliteConnector opens connections through sqliteDriver, without registering it
+// globally with database/sql.
+type sqliteConnector struct {
+	dsn string
+}
+
+func (c sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.Driver().Open(c.dsn)
+}
+
+func (c sqliteConnector) Driver() driver.Driver {
+	return sqliteDriver{}
+}
+
+// sqliteDriver is the SQLite driver with the functions that the dialect relies on
+// registered on every connection. Its connections translate the queries, which are
+// written for PostgreSQL, see sqliteQuery().
+type sqliteDriver struct{}
+
+func (sqliteDriver) Open(dsn string) (driver.Conn, error) {
+	d := &sqlite3.SQLiteDriver{ConnectHook: registerSQLiteFunctions}
+	conn, err := d.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type sqliteConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.SQLiteConn.Prepare(sqliteQuery(query))
+}
+
+func (c sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.SQLiteConn.PrepareContext(ctx, sqliteQuery(query))
+}
+
+func (c sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.SQLiteConn.ExecContext(ctx, sqliteQuery(query), args)
+}
+
+func (c sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.SQLiteConn.QueryContext(ctx, sqliteQuery(query), args)
+}
+
+// CheckNamedValue stores times in UTC and to the second, like the timestamp(0) with time
+// zone columns in PostgreSQL. Times are kept as text in SQLite, and this keeps them all
+// in the same format, so that comparing them compares the times.
+func (c sqliteConn) CheckNamedValue(nv *driver.NamedValue) error {
+	value, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := value.(time.Time); ok {
+		value = t.UTC().Round(time.Second)
+	}
+	nv.Value = value
+	return nil
+}
+
+// registerSQLiteFunctions adds the functions that stand in for PostgreSQL's to a new
+// connection.
+func registerSQLiteFunctions(conn *sqlite3.SQLiteConn) error {
+	functions := []struct {
+		name string
+		impl interface{}
+		pure bool
+	}{
+		{"now", sqliteNow, false},
+		{"text_match", sqliteTextMatch, true},
+		{"text_search", sqliteTextSearch, true},
+		{"text_search_rank", sqliteTextSearchRank, true},
+		{"word_similarity", wordSimilarity, true},
+		{"add_seconds", sqliteAddSeconds, true},
+		{"least", sqliteLeast, true},
+		{"greatest", sqliteGreatest, true},
+	}
+	for _, fn := range functions {
+		err := conn.RegisterFunc(fn.name, fn.impl, fn.pure)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteAddSeconds is add_seconds(timestamp, seconds). It returns NULL if either
+// argument is NULL.
+func sqliteAddSeconds(timestamp, seconds interface{}) (interface{}, error) {
+	var s string
+	switch ts := timestamp.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		s = ts
+	case []byte:
+		s = string(ts)
+	default:
+		return nil, fmt.Errorf("add_seconds: %T is not a timestamp", timestamp)
+	}
+	var d time.Duration
+	switch secs := seconds.(type) {
+	case nil:
+		return nil, nil
+	case int64:
+		d = time.Duration(secs) * time.Second
+	case float64:
+		d = time.Duration(secs * float64(time.Second))
+	default:
+		return nil, fmt.Errorf("add_seconds: %T is not a number of seconds", seconds)
+	}
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		t, err := time.Parse(format, s)
+		if err == nil {
+			return t.Add(d).UTC().Round(time.Second).Format(sqliteTimeFormat), nil
+		}
+	}
+	return nil, fmt.Errorf("add_seconds: cannot parse %q as a timestamp", s)
+}
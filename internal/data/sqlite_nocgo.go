@@ -0,0 +1,26 @@
+//go:build !cgo
+
+package data
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+)
+
+// errSQLiteNotCompiled is returned for the SQLite driver by builds without cgo, which
+// github.com/mattn/go-sqlite3 needs. Such builds only work with PostgreSQL.
+var errSQLiteNotCompiled = errors.New("SQLite support is not compiled in: build with CGO_ENABLED=1")
+
+// openSQLite refuses to open a SQLite database, see errSQLiteNotCompiled.
+func openSQLite(dsn string) (*sql.DB, error) {
+	return nil, errSQLiteNotCompiled
+}
+
+// sqliteDriver stands in for the SQLite driver of sqlite_cgo.go, which dialectFor() looks
+// for.
+type sqliteDriver struct{}
+
+func (sqliteDriver) Open(dsn string) (driver.Conn, error) {
+	return nil, errSQLiteNotCompiled
+}
@@ -0,0 +1,271 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// StatsIntervals lists the periods that completions can be grouped by.
+var StatsIntervals = []string{"day", "week"}
+
+// Stats are the aggregates returned by GET /v1/stats for a date range.
+type Stats struct {
+	From                   time.Time         `json:"from"`
+	To                     time.Time         `json:"to"`
+	Interval               string            `json:"interval"`
+	Completed              []*PeriodCount    `json:"completed"`
+	Overdue                int               `json:"overdue"`
+	AverageCompletionHours *float64          `json:"average_completion_hours"`
+	ByPriority             []*BreakdownCount `json:"by_priority"`
+	ByCategory             []*BreakdownCount `json:"by_category"`
+	TrackedSeconds         int64             `json:"tracked_seconds"`
+}
+
+// PeriodCount is the number of tasks completed in the day or week starting on Period.
+type PeriodCount struct {
+	Period string `json:"period"`
+	Count  int    `json:"count"`
+}
+
+// BreakdownCount counts tasks sharing a priority or category, and compares the time
+// planned for them with the time tracked on them.
+type BreakdownCount struct {
+	CategoryID *int64 `json:"category_id,omitempty"`
+	Name       string `json:"name"`
+	Total      int    `json:"total"`
+	Open       int    `json:"open"`
+	Completed  int    `json:"completed"`
+
+	// The sums of the tasks' estimates and remaining work, leaving out the tasks that
+	// haven't been estimated, and the time tracked on the tasks so far.
+	EstimateMinutes  int64 `json:"estimate_minutes"`
+	RemainingMinutes int64 `json:"remaining_minutes"`
+	TrackedSeconds   int64 `json:"tracked_seconds"`
+}
+
+// breakdownColumns are the aggregates of a BreakdownCount, for a query on tasks joined with
+// the tracked table of breakdownTracked().
+const breakdownColumns = `count(*),
+			count(*) FILTER (WHERE status <> 'completed'),
+			count(*) FILTER (WHERE status = 'completed'),
+			COALESCE(SUM(estimate_minutes), 0), COALESCE(SUM(remaining_minutes), 0),
+			COALESCE(SUM(tracked.seconds), 0)::bigint`
+
+// breakdownTracked returns a subquery with the seconds tracked on each task in the
+// workspace given as $1.
+func breakdownTracked(d dialect) string {
+	return `(
+			SELECT task_id, SUM(` + d.secondsBetween("started_at", "COALESCE(ended_at, NOW())") + `) AS seconds
+			FROM time_entries
+			WHERE task_id IN (SELECT id FROM tasks WHERE workspace_id = $1)
+			GROUP BY task_id
+		) AS tracked`
+}
+
+// Define a StatsModel struct type which wraps a sql.DB connection pool.
+type StatsModel struct {
+	DB dbConn
+}
+
+// Get calculates a workspace's statistics for the range [from, to). Completions are
+// counted by when they happened and grouped into days or weeks in the given time zone; the
+// priority and category breakdowns cover the tasks created in the range, with all the time
+// tracked on them whenever it was; the overdue count
+// is of the tasks that are overdue now. Archived tasks are left out of the breakdowns and
+// the overdue count. The tracked time is the part of the time entries on the workspace's
+// tasks that falls in the range.
+func (m StatsModel) Get(ctx context.Context, workspaceID int64, from, to time.Time, interval string, location *time.Location) (*Stats, error) {
+	// The statistics take several queries, so allow them more time than a single one.
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	stats := &Stats{
+		From:       from,
+		To:         to,
+		Interval:   interval,
+		Completed:  []*PeriodCount{},
+		ByPriority: []*BreakdownCount{},
+		ByCategory: []*BreakdownCount{},
+	}
+
+	// generate_series() produces every period in the range, so that periods without any
+	// completions are reported with a count of zero. SQLite has neither generate_series()
+	// nor time zones, so there the periods are counted by countCompletions().
+	query := `
+		SELECT to_char(periods.start, 'YYYY-MM-DD'), count(tasks.id)
+		FROM generate_series(
+			date_trunc($4::text, $2::timestamptz AT TIME ZONE $5::text),
+			($3::timestamptz AT TIME ZONE $5::text) - interval '1 second',
+			('1 ' || $4::text)::interval
+		) AS periods (start)
+		LEFT JOIN tasks ON tasks.workspace_id = $1
+			AND tasks.completed_at >= $2 AND tasks.completed_at < $3
+			AND date_trunc($4, tasks.completed_at AT TIME ZONE $5) = periods.start
+		GROUP BY periods.start
+		ORDER BY periods.start ASC`
+	args := []interface{}{workspaceID, from, to, interval, location.String()}
+	var err error
+	if m.DB.dialect.timeZones() {
+		err = queryEach(ctx, m.DB, query, args, func(rows *sql.Rows) error {
+			var count PeriodCount
+			err := rows.Scan(&count.Period, &count.Count)
+			stats.Completed = append(stats.Completed, &count)
+			return err
+		})
+	} else {
+		stats.Completed, err = m.countCompletions(ctx, workspaceID, from, to, interval, location)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT count(*)
+		FROM tasks
+		WHERE workspace_id = $1 AND status <> 'completed' AND NOT archived AND due_date < NOW()`
+	err = m.DB.QueryRowContext(ctx, query, workspaceID).Scan(&stats.Overdue)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT avg(` + m.DB.dialect.secondsBetween("created_at", "completed_at") + ` / 3600.0)
+		FROM tasks
+		WHERE workspace_id = $1 AND completed_at >= $2 AND completed_at < $3`
+	err = m.DB.QueryRowContext(ctx, query, workspaceID, from, to).Scan(&stats.AverageCompletionHours)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT priority, ` + breakdownColumns + `
+		FROM tasks
+		LEFT JOIN ` + breakdownTracked(m.DB.dialect) + ` ON tracked.task_id = tasks.id
+		WHERE workspace_id = $1 AND NOT archived AND created_at >= $2 AND created_at < $3
+		GROUP BY priority
+		ORDER BY priority ASC`
+	err = queryEach(ctx, m.DB, query, []interface{}{workspaceID, from, to}, func(rows *sql.Rows) error {
+		var count BreakdownCount
+		err := rows.Scan(&count.Name, &count.Total, &count.Open, &count.Completed, &count.EstimateMinutes, &count.RemainingMinutes, &count.TrackedSeconds)
+		stats.ByPriority = append(stats.ByPriority, &count)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT category_id, category, ` + breakdownColumns + `
+		FROM tasks
+		LEFT JOIN ` + breakdownTracked(m.DB.dialect) + ` ON tracked.task_id = tasks.id
+		WHERE workspace_id = $1 AND NOT archived AND created_at >= $2 AND created_at < $3
+		GROUP BY category_id, category
+		ORDER BY category ASC`
+	err = queryEach(ctx, m.DB, query, []interface{}{workspaceID, from, to}, func(rows *sql.Rows) error {
+		var count BreakdownCount
+		err := rows.Scan(&count.CategoryID, &count.Name, &count.Total, &count.Open, &count.Completed, &count.EstimateMinutes, &count.RemainingMinutes, &count.TrackedSeconds)
+		stats.ByCategory = append(stats.ByCategory, &count)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries that cross either end of the range only count for the part inside it.
+	query = `
+		SELECT COALESCE(SUM(` + m.DB.dialect.secondsBetween("GREATEST(started_at, $2)", "LEAST(COALESCE(ended_at, NOW()), $3)") + `), 0)::bigint
+		FROM time_entries
+		WHERE task_id IN (SELECT id FROM tasks WHERE workspace_id = $1)
+			AND started_at < $3 AND COALESCE(ended_at, NOW()) > $2`
+	err = m.DB.QueryRowContext(ctx, query, workspaceID, from, to).Scan(&stats.TrackedSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// countCompletions counts the tasks completed in each day or week of the range [from, to)
+// in the given time zone, like the first query in Get() does in PostgreSQL.
+func (m StatsModel) countCompletions(ctx context.Context, workspaceID int64, from, to time.Time, interval string, location *time.Location) ([]*PeriodCount, error) {
+	query := `
+		SELECT completed_at
+		FROM tasks
+		WHERE workspace_id = $1 AND completed_at >= $2 AND completed_at < $3`
+	counts := map[string]int{}
+	err := queryEach(ctx, m.DB, query, []interface{}{workspaceID, from, to}, func(rows *sql.Rows) error {
+		var completedAt time.Time
+		err := rows.Scan(&completedAt)
+		counts[periodStart(completedAt.In(location), interval).Format("2006-01-02")]++
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	periods := []*PeriodCount{}
+	last := to.In(location).Add(-time.Second)
+	for start := periodStart(from.In(location), interval); !start.After(last); {
+		period := start.Format("2006-01-02")
+		periods = append(periods, &PeriodCount{Period: period, Count: counts[period]})
+		if interval == "week" {
+			start = start.AddDate(0, 0, 7)
+		} else {
+			start = start.AddDate(0, 0, 1)
+		}
+	}
+	return periods, nil
+}
+
+// periodStart returns the start of the day or week that t falls in, like date_trunc():
+// midnight, on Monday for a week.
+func periodStart(t time.Time, interval string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if interval == "week" {
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+// TaskCounts summarises the tasks a user has created, for the admin API.
+type TaskCounts struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"by_status"`
+	Archived int            `json:"archived"`
+	Overdue  int            `json:"overdue"`
+}
+
+// GetTaskCounts counts the tasks created by a user, across all of their workspaces. Like
+// in Get(), archived tasks are not counted as overdue.
+func (m StatsModel) GetTaskCounts(ctx context.Context, userID int64, now time.Time) (*TaskCounts, error) {
+	query := `
+		SELECT status, count(*),
+			count(*) FILTER (WHERE archived),
+			count(*) FILTER (WHERE NOT archived AND status <> 'completed' AND due_date < $2)
+		FROM tasks
+		WHERE user_id = $1
+		GROUP BY status`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	counts := &TaskCounts{ByStatus: map[string]int{}}
+	for _, status := range TaskStatuses {
+		counts.ByStatus[status] = 0
+	}
+	err := queryEach(ctx, m.DB, query, []interface{}{userID, now}, func(rows *sql.Rows) error {
+		var status string
+		var total, archived, overdue int
+		err := rows.Scan(&status, &total, &archived, &overdue)
+		counts.ByStatus[status] = total
+		counts.Total += total
+		counts.Archived += archived
+		counts.Overdue += overdue
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
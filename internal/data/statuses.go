@@ -0,0 +1,78 @@
+package data
+
+import (
+	"fmt"
+)
+
+// TaskStatus is the workflow state of a task.
+type TaskStatus string
+
+const (
+	StatusTodo       TaskStatus = "to-do"
+	StatusInProgress TaskStatus = "in-progress"
+	StatusCompleted  TaskStatus = "completed"
+)
+
+// TaskPriority says how urgent a task is.
+type TaskPriority string
+
+const (
+	PriorityLow    TaskPriority = "low"
+	PriorityMedium TaskPriority = "medium"
+	PriorityHigh   TaskPriority = "high"
+)
+
+// Define the allowed statuses and priorities as plain strings, for use with validator.In()
+// and in query string filters.
+var (
+	TaskStatuses   = []string{string(StatusTodo), string(StatusInProgress), string(StatusCompleted)}
+	TaskPriorities = []string{string(PriorityLow), string(PriorityMedium), string(PriorityHigh)}
+)
+
+// statusTransitions lists the statuses that each status may be changed to through a
+// regular update. Leaving "completed" requires an explicit reopen, see Reopen().
+var statusTransitions = map[TaskStatus][]TaskStatus{
+	StatusTodo:       {StatusInProgress, StatusCompleted},
+	StatusInProgress: {StatusTodo, StatusCompleted},
+	StatusCompleted:  {},
+}
+
+// TransitionError reports a status change that the workflow doesn't allow, along with
+// the rule that was violated.
+type TransitionError struct {
+	From TaskStatus
+	To   TaskStatus
+	Rule string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot change status from %q to %q: %s", e.From, e.To, e.Rule)
+}
+
+// CheckStatusTransition returns a *TransitionError if a task may not move from one status
+// to another through a regular update. Keeping the same status is always allowed, and so
+// is leaving a status that predates the workflow rules.
+func CheckStatusTransition(from, to TaskStatus) error {
+	allowed, known := statusTransitions[from]
+	if from == to || !known {
+		return nil
+	}
+	for _, status := range allowed {
+		if status == to {
+			return nil
+		}
+	}
+	if from == StatusCompleted {
+		return &TransitionError{From: from, To: to, Rule: "a completed task must be reopened before its status can change"}
+	}
+	return &TransitionError{From: from, To: to, Rule: "this status change is not allowed"}
+}
+
+// Reopen moves a completed task back to "to-do". It is the only way out of "completed".
+func (task *Task) Reopen() error {
+	if task.Status != StatusCompleted {
+		return &TransitionError{From: task.Status, To: StatusTodo, Rule: "only completed tasks can be reopened"}
+	}
+	task.Status = StatusTodo
+	return nil
+}
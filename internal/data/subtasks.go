@@ -0,0 +1,241 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// Subtask is a single checklist item belonging to a task.
+type Subtask struct {
+	ID        int64      `json:"id"`
+	CreatedAt CustomTime `json:"created_at"`
+	TaskID    int64      `json:"task_id"`
+	Title     string     `json:"title"`
+	Done      bool       `json:"done"`
+	Position  int        `json:"position"`
+	Version   int32      `json:"version"`
+}
+
+func ValidateSubtask(v *validator.Validator, subtask *Subtask) {
+	validator.Field(v, "title", subtask.Title, validator.Required[string](), validator.MaxLen(500))
+	v.Check(subtask.Position >= 0, "position", "must not be negative")
+}
+
+// Define a SubtaskModel struct type which wraps a sql.DB connection pool.
+type SubtaskModel struct {
+	DB dbConn
+}
+
+// Insert a new subtask at the end of its task's checklist.
+func (m SubtaskModel) Insert(ctx context.Context, subtask *Subtask) error {
+	query := `
+		INSERT INTO subtasks (task_id, title, done, position)
+		VALUES ($1, $2, $3, (SELECT COALESCE(MAX(position), 0) + 1 FROM subtasks WHERE task_id = $1))
+		RETURNING id, created_at, position, version`
+	args := []interface{}{subtask.TaskID, subtask.Title, subtask.Done}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&subtask.ID, &subtask.CreatedAt, &subtask.Position, &subtask.Version)
+}
+
+// Get fetches a specific subtask of a specific task.
+func (m SubtaskModel) Get(ctx context.Context, id int64, taskID int64) (*Subtask, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, task_id, title, done, position, version
+		FROM subtasks
+		WHERE id = $1 AND task_id = $2`
+	var subtask Subtask
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, taskID).Scan(
+		&subtask.ID,
+		&subtask.CreatedAt,
+		&subtask.TaskID,
+		&subtask.Title,
+		&subtask.Done,
+		&subtask.Position,
+		&subtask.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &subtask, nil
+}
+
+// GetAllForTask returns the checklist of a task in display order.
+func (m SubtaskModel) GetAllForTask(ctx context.Context, taskID int64) ([]*Subtask, error) {
+	query := `
+		SELECT id, created_at, task_id, title, done, position, version
+		FROM subtasks
+		WHERE task_id = $1
+		ORDER BY position ASC, id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subtasks := []*Subtask{}
+
+	for rows.Next() {
+		var subtask Subtask
+		err := rows.Scan(
+			&subtask.ID,
+			&subtask.CreatedAt,
+			&subtask.TaskID,
+			&subtask.Title,
+			&subtask.Done,
+			&subtask.Position,
+			&subtask.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subtasks = append(subtasks, &subtask)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return subtasks, nil
+}
+
+// GetForTasks returns the checklists of the given tasks in a single query, keyed by task
+// ID and in display order. Tasks without subtasks are left out.
+func (m SubtaskModel) GetForTasks(ctx context.Context, taskIDs []int64) (map[int64][]*Subtask, error) {
+	subtasks := make(map[int64][]*Subtask, len(taskIDs))
+	if len(taskIDs) == 0 {
+		return subtasks, nil
+	}
+	query := `
+		SELECT id, created_at, task_id, title, done, position, version
+		FROM subtasks
+		WHERE ` + m.DB.dialect.anyOf("task_id", "$1") + `
+		ORDER BY task_id ASC, position ASC, id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, m.DB.dialect.array(taskIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var subtask Subtask
+		err := rows.Scan(
+			&subtask.ID,
+			&subtask.CreatedAt,
+			&subtask.TaskID,
+			&subtask.Title,
+			&subtask.Done,
+			&subtask.Position,
+			&subtask.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subtasks[subtask.TaskID] = append(subtasks[subtask.TaskID], &subtask)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return subtasks, nil
+}
+
+// Update a subtask, using the version number to detect concurrent edits.
+func (m SubtaskModel) Update(ctx context.Context, subtask *Subtask) error {
+	query := `
+		UPDATE subtasks
+		SET title = $1, done = $2, position = $3, version = version + 1
+		WHERE id = $4 AND task_id = $5 AND version = $6
+		RETURNING version`
+	args := []interface{}{
+		subtask.Title,
+		subtask.Done,
+		subtask.Position,
+		subtask.ID,
+		subtask.TaskID,
+		subtask.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&subtask.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete a specific subtask of a specific task.
+func (m SubtaskModel) Delete(ctx context.Context, id int64, taskID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM subtasks
+		WHERE id = $1 AND task_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, taskID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// AllDone reports whether a task has at least one subtask and every one of them is done.
+func (m SubtaskModel) AllDone(ctx context.Context, taskID int64) (bool, error) {
+	query := `
+		SELECT count(*) > 0 AND bool_and(done)
+		FROM subtasks
+		WHERE task_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var allDone sql.NullBool
+	err := m.DB.QueryRowContext(ctx, query, taskID).Scan(&allDone)
+	if err != nil {
+		return false, err
+	}
+	return allDone.Valid && allDone.Bool, nil
+}
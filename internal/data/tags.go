@@ -0,0 +1,264 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+var ErrDuplicateTag = errors.New("duplicate tag")
+
+// Tag is a user-defined label. A task can carry any number of tags.
+type Tag struct {
+	ID        int64      `json:"id"`
+	CreatedAt CustomTime `json:"created_at"`
+	UserID    int64      `json:"-"`
+	Name      string     `json:"name"`
+	Version   int32      `json:"version"`
+}
+
+func ValidateTag(v *validator.Validator, tag *Tag) {
+	v.Check(tag.Name != "", "name", "must be provided")
+	v.Check(len(tag.Name) <= 50, "name", "must not be more than 50 bytes long")
+	// Tags are filtered with ?tags=a,b, so a comma inside a name could never be matched.
+	v.Check(!strings.Contains(tag.Name, ","), "name", "must not contain commas")
+}
+
+// Define a TagModel struct type which wraps a sql.DB connection pool.
+type TagModel struct {
+	DB dbConn
+}
+
+// Insert a new tag for a user.
+func (m TagModel) Insert(ctx context.Context, tag *Tag) error {
+	query := `
+		INSERT INTO tags (user_id, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tag.UserID, tag.Name).Scan(&tag.ID, &tag.CreatedAt, &tag.Version)
+	if err != nil {
+		switch {
+		case m.DB.dialect.isUniqueViolation(err, "tags_user_id_name_key"):
+			return ErrDuplicateTag
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get fetches a specific tag belonging to a user.
+func (m TagModel) Get(ctx context.Context, id int64, userID int64) (*Tag, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, user_id, name, version
+		FROM tags
+		WHERE id = $1 AND user_id = $2`
+	var tag Tag
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&tag.ID, &tag.CreatedAt, &tag.UserID, &tag.Name, &tag.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &tag, nil
+}
+
+// GetAllForUser returns all of a user's tags sorted by name.
+func (m TagModel) GetAllForUser(ctx context.Context, userID int64) ([]*Tag, error) {
+	query := `
+		SELECT id, created_at, user_id, name, version
+		FROM tags
+		WHERE user_id = $1
+		ORDER BY name ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.query(ctx, query, userID)
+}
+
+// GetForTask returns the tags a user has attached to a task sorted by name. Tags are
+// private, so those that the other members of the task's workspace attached are left out.
+func (m TagModel) GetForTask(ctx context.Context, taskID int64, userID int64) ([]*Tag, error) {
+	query := `
+		SELECT tags.id, tags.created_at, tags.user_id, tags.name, tags.version
+		FROM tags
+		INNER JOIN task_tags ON task_tags.tag_id = tags.id
+		WHERE task_tags.task_id = $1 AND tags.user_id = $2
+		ORDER BY tags.name ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.query(ctx, query, taskID, userID)
+}
+
+// GetForTasks returns the tags a user has attached to each of the given tasks in a single
+// query, keyed by task ID and sorted by name. Tasks without tags are left out.
+func (m TagModel) GetForTasks(ctx context.Context, taskIDs []int64, userID int64) (map[int64][]*Tag, error) {
+	tags := make(map[int64][]*Tag, len(taskIDs))
+	if len(taskIDs) == 0 {
+		return tags, nil
+	}
+	query := `
+		SELECT task_tags.task_id, tags.id, tags.created_at, tags.user_id, tags.name, tags.version
+		FROM tags
+		INNER JOIN task_tags ON task_tags.tag_id = tags.id
+		WHERE ` + m.DB.dialect.anyOf("task_tags.task_id", "$1") + ` AND tags.user_id = $2
+		ORDER BY tags.name ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, m.DB.dialect.array(taskIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var taskID int64
+		var tag Tag
+		err := rows.Scan(&taskID, &tag.ID, &tag.CreatedAt, &tag.UserID, &tag.Name, &tag.Version)
+		if err != nil {
+			return nil, err
+		}
+		tags[taskID] = append(tags[taskID], &tag)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (m TagModel) query(ctx context.Context, query string, args ...interface{}) ([]*Tag, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		var tag Tag
+		err := rows.Scan(&tag.ID, &tag.CreatedAt, &tag.UserID, &tag.Name, &tag.Version)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// Update renames a tag, using the version number to detect concurrent edits.
+func (m TagModel) Update(ctx context.Context, tag *Tag) error {
+	query := `
+		UPDATE tags
+		SET name = $1, version = version + 1
+		WHERE id = $2 AND user_id = $3 AND version = $4
+		RETURNING version`
+	args := []interface{}{tag.Name, tag.ID, tag.UserID, tag.Version}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&tag.Version)
+	if err != nil {
+		switch {
+		case m.DB.dialect.isUniqueViolation(err, "tags_user_id_name_key"):
+			return ErrDuplicateTag
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete a tag belonging to a user. It is detached from all tasks automatically.
+func (m TagModel) Delete(ctx context.Context, id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM tags
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// AddToTask attaches a tag to a task. Attaching a tag twice is not an error.
+func (m TagModel) AddToTask(ctx context.Context, taskID int64, tagID int64) error {
+	query := `
+		INSERT INTO task_tags (task_id, tag_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, taskID, tagID)
+	return err
+}
+
+// RemoveFromTask detaches a tag from a task.
+func (m TagModel) RemoveFromTask(ctx context.Context, taskID int64, tagID int64) error {
+	query := `
+		DELETE FROM task_tags
+		WHERE task_id = $1 AND tag_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, taskID, tagID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// TaskVersion is a snapshot of the editable fields of a task, saved every time the task
+// is created or changed.
+type TaskVersion struct {
+	Version     int32        `json:"version"`
+	CreatedAt   CustomTime   `json:"created_at"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	DueDate     CustomTime   `json:"due_date"`
+	Priority    TaskPriority `json:"priority"`
+	Status      TaskStatus   `json:"status"`
+	CategoryID  int64        `json:"category_id"`
+	Category    string       `json:"category"`
+	Recurrence  string       `json:"recurrence,omitempty"`
+	Archived    bool         `json:"archived"`
+}
+
+// Apply copies the snapshot's fields onto a task, leaving its ID, owner, version and board
+// position as they are.
+func (tv *TaskVersion) Apply(task *Task) {
+	task.Title = tv.Title
+	task.Description = tv.Description
+	task.DueDate = tv.DueDate
+	task.Priority = tv.Priority
+	task.Status = tv.Status
+	task.CategoryID = tv.CategoryID
+	task.Category = tv.Category
+	task.Recurrence = tv.Recurrence
+	task.Archived = tv.Archived
+}
+
+const taskVersionColumns = `version, created_at, title, description, due_date, priority, status, category_id, category, recurrence, archived`
+
+func (tv *TaskVersion) scanDest() []interface{} {
+	return []interface{}{
+		&tv.Version,
+		&tv.CreatedAt,
+		&tv.Title,
+		&tv.Description,
+		&tv.DueDate,
+		&tv.Priority,
+		&tv.Status,
+		&tv.CategoryID,
+		&tv.Category,
+		&tv.Recurrence,
+		&tv.Archived,
+	}
+}
+
+// saveTaskVersion copies the current version of a task into its history. It is called in
+// the same transaction as every write that increments the task's version.
+func saveTaskVersion(ctx context.Context, q queryer, taskID int64) error {
+	query := `
+		INSERT INTO task_versions (task_id, version, title, description, due_date, priority, status, category_id, category, recurrence, archived)
+		SELECT id, version, title, description, due_date, priority, status, category_id, category, recurrence, archived
+		FROM tasks
+		WHERE id = $1
+		ON CONFLICT (task_id, version) DO NOTHING`
+	_, err := q.ExecContext(ctx, query, taskID)
+	return err
+}
+
+// Define a TaskVersionModel struct type which wraps a sql.DB connection pool.
+type TaskVersionModel struct {
+	DB dbConn
+}
+
+// GetAllForTask returns the saved versions of a task, newest first.
+func (m TaskVersionModel) GetAllForTask(ctx context.Context, taskID int64) ([]*TaskVersion, error) {
+	query := `
+		SELECT ` + taskVersionColumns + `
+		FROM task_versions
+		WHERE task_id = $1
+		ORDER BY version DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	versions := []*TaskVersion{}
+	err := queryEach(ctx, m.DB, query, []interface{}{taskID}, func(rows *sql.Rows) error {
+		var tv TaskVersion
+		err := rows.Scan(tv.scanDest()...)
+		versions = append(versions, &tv)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Get returns one saved version of a task.
+func (m TaskVersionModel) Get(ctx context.Context, taskID int64, version int32) (*TaskVersion, error) {
+	query := `
+		SELECT ` + taskVersionColumns + `
+		FROM task_versions
+		WHERE task_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var tv TaskVersion
+	err := m.DB.QueryRowContext(ctx, query, taskID, version).Scan(tv.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &tv, nil
+}
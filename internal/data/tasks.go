@@ -5,21 +5,132 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/zarinakolybaeva/DoMake/internal/markdown"
+	"github.com/zarinakolybaeva/DoMake/internal/rrule"
 	"github.com/zarinakolybaeva/DoMake/internal/validator"
+	"strings"
 	"time"
+	"unicode"
 )
 
 type Task struct {
-	ID          int64      `json:"id"`          // Unique integer ID for the task
-	CreatedAt   CustomTime `json:"created_at"`  // Timestamp for when the task is added to our database
-	Title       string     `json:"title"`       // Task title
-	Description string     `json:"description"` //  Task description
-	DueDate     CustomTime `json:"due_date"`    // Deadline or due date for the task
-	Priority    string     `json:"priority"`    // Task priority (e.g., high, medium, low)
-	Status      string     `json:"status"`      // Task status (e.g., to-do, in-progress, completed)
-	Category    string     `json:"category"`    // Task category or project it belongs to
-	UserID      int64      `json:"user_id"`     // ID of the user who created the task (for multi-user support)
-	Version     int32      `json:"version"`
+	ID          int64        `json:"id"`           // Unique integer ID for the task
+	CreatedAt   CustomTime   `json:"created_at"`   // Timestamp for when the task is added to our database
+	UpdatedAt   CustomTime   `json:"updated_at"`   // When the task was last changed, sent as Last-Modified
+	Title       string       `json:"title"`        // Task title
+	Description string       `json:"description"`  //  Task description
+	DueDate     CustomTime   `json:"due_date"`     // Deadline or due date for the task
+	StartDate   CustomTime   `json:"start_date"`   // When work on the task can start; it is scheduled until then
+	Priority    TaskPriority `json:"priority"`     // Task priority (low, medium or high)
+	Status      TaskStatus   `json:"status"`       // Task status (to-do, in-progress or completed)
+	CategoryID  int64        `json:"category_id"`  // ID of the category (project) the task belongs to
+	Category    string       `json:"category"`     // Name of the category, kept in sync by CategoryModel.Update()
+	UserID      int64        `json:"user_id"`      // ID of the user who created the task (for multi-user support)
+	WorkspaceID int64        `json:"workspace_id"` // ID of the workspace the task belongs to
+	Version     int32        `json:"version"`
+	Recurrence  string       `json:"recurrence,omitempty"` // iCalendar RRULE, e.g. "FREQ=WEEKLY;BYDAY=TU"
+	Archived    bool         `json:"archived"`             // Archived tasks are hidden from lists by default
+	Position    int64        `json:"position"`             // Order of the task within its status column on a board
+	CompletedAt CustomTime   `json:"completed_at"`         // When the task was completed; null unless its status is completed
+
+	// Until when the task is left out of the default lists and not reminded about; null
+	// unless it has been snoozed, see IsSnoozed().
+	SnoozedUntil CustomTime `json:"snoozed_until"`
+
+	// How long the task is expected to take in all, and how much of that is left, in
+	// minutes; null until it has been estimated.
+	EstimateMinutes  *int `json:"estimate_minutes"`
+	RemainingMinutes *int `json:"remaining_minutes"`
+
+	// The values of the workspace's custom fields, see CustomField.
+	CustomFields CustomFieldValues `json:"custom_fields"`
+
+	// Computed when the task is sent to a client, see SetDueStatus(); they aren't stored.
+	IsOverdue    bool   `json:"is_overdue"`     // Past its due date and not completed
+	DueInSeconds *int64 `json:"due_in_seconds"` // Seconds until the due date, negative once passed; null without one
+
+	// The description rendered from Markdown, only sent to clients asking for it with
+	// ?render=html, see RenderDescription().
+	DescriptionHTML string `json:"description_html,omitempty"`
+}
+
+// maxEstimateMinutes is the longest a task can be estimated to take: a year.
+const maxEstimateMinutes = 365 * 24 * 60
+
+// maxRenderedDescription is how long a description may be once rendered as HTML. Markdown
+// such as deeply nested lists or quotes renders to many times its own length.
+const maxRenderedDescription = 8000
+
+// IsSnoozed reports whether the task is snoozed at the given time.
+func (task *Task) IsSnoozed(now time.Time) bool {
+	return !task.SnoozedUntil.IsZero() && time.Time(task.SnoozedUntil).After(now)
+}
+
+// IsScheduled reports whether the task's start date is still to come at the given time.
+func (task *Task) IsScheduled(now time.Time) bool {
+	return !task.StartDate.IsZero() && time.Time(task.StartDate).After(now)
+}
+
+// RenderDescription sets the task's DescriptionHTML to its description rendered as HTML.
+func (task *Task) RenderDescription() {
+	task.DescriptionHTML = markdown.ToHTML(task.Description)
+}
+
+// TaskSorts are the values of the sort parameter of lists of tasks: a column to sort by,
+// descending if prefixed with a minus sign.
+var TaskSorts = []string{"id", "title", "priority", "category", "position", "due_date", "estimate_minutes", "-id", "-title", "-priority", "-category", "-position", "-due_date", "-estimate_minutes"}
+
+// taskColumns lists the tasks table columns in the order that scanDest() expects them,
+// so that every query returning full task rows stays in sync with the Task struct.
+const taskColumns = `id, created_at, updated_at, title, description, priority, status, category_id, category, due_date, user_id, workspace_id, version, recurrence, archived, position, completed_at, snoozed_until, start_date, estimate_minutes, remaining_minutes, custom_fields`
+
+// scanDest returns pointers to the Task fields in the same order as taskColumns, ready
+// to be passed to Scan().
+func (task *Task) scanDest() []interface{} {
+	return []interface{}{
+		&task.ID,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+		&task.Title,
+		&task.Description,
+		&task.Priority,
+		&task.Status,
+		&task.CategoryID,
+		&task.Category,
+		&task.DueDate,
+		&task.UserID,
+		&task.WorkspaceID,
+		&task.Version,
+		&task.Recurrence,
+		&task.Archived,
+		&task.Position,
+		&task.CompletedAt,
+		&task.SnoozedUntil,
+		&task.StartDate,
+		&task.EstimateMinutes,
+		&task.RemainingMinutes,
+		&task.CustomFields,
+	}
+}
+
+// ValidateTaskFilters checks the list filters that have a fixed set of allowed values.
+func ValidateTaskFilters(v *validator.Validator, tf TaskFilters) {
+	for _, status := range tf.Statuses {
+		v.Check(validator.In(status, TaskStatuses...), "status", "must be one of "+strings.Join(TaskStatuses, ", "))
+	}
+	for _, priority := range tf.Priorities {
+		v.Check(validator.In(priority, TaskPriorities...), "priority", "must be one of "+strings.Join(TaskPriorities, ", "))
+	}
+	if !tf.DueBefore.IsZero() && !tf.DueAfter.IsZero() {
+		v.Check(tf.DueAfter.Before(tf.DueBefore), "due_after", "must be earlier than due_before")
+	}
+	if !tf.CompletedBefore.IsZero() && !tf.CompletedAfter.IsZero() {
+		v.Check(tf.CompletedAfter.Before(tf.CompletedBefore), "completed_after", "must be earlier than completed_before")
+	}
+	if tf.Due != "" {
+		v.Check(validator.In(tf.Due, TaskDueFilters...), "due", "must be one of "+strings.Join(TaskDueFilters, ", "))
+	}
+	v.Check(!tf.Available || !tf.Scheduled, "scheduled", "must not be given with available")
 }
 
 func ValidateTask(v *validator.Validator, task *Task) {
@@ -27,74 +138,111 @@ func ValidateTask(v *validator.Validator, task *Task) {
 	v.Check(len(task.Title) <= 500, "title", "must not be more than 500 bytes long")
 	v.Check(task.Description != "", "description", "must be provided")
 	v.Check(len(task.Description) <= 1000, "description", "must not be more than 1000 bytes long")
-	v.Check(!task.DueDate.IsZero(), "due_date", "must be provided")
-	v.Check(task.DueDate.Before(time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC)), "due_date", "must be before 2060")
-	v.Check(task.DueDate.After(time.Date(2023, 10, 7, 0, 0, 0, 0, time.UTC)), "due_date", "must be after 2023-10-07")
+	v.Check(len(markdown.ToHTML(task.Description)) <= maxRenderedDescription, "description", fmt.Sprintf("must not be more than %d bytes long once rendered as HTML", maxRenderedDescription))
+	// A task without a due date is a "someday" task, so the date is only checked if given.
+	if !task.DueDate.IsZero() {
+		v.Check(task.DueDate.Before(time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC)), "due_date", "must be before 2060")
+		v.Check(task.DueDate.After(time.Date(2023, 10, 7, 0, 0, 0, 0, time.UTC)), "due_date", "must be after 2023-10-07")
+	}
+	if !task.StartDate.IsZero() && !task.DueDate.IsZero() {
+		v.Check(!task.StartDate.After(time.Time(task.DueDate)), "start_date", "must not be after due_date")
+	}
+	if task.EstimateMinutes != nil {
+		v.Check(*task.EstimateMinutes >= 0, "estimate_minutes", "must not be negative")
+		v.Check(*task.EstimateMinutes <= maxEstimateMinutes, "estimate_minutes", "must not be more than a year")
+	}
+	if task.RemainingMinutes != nil {
+		v.Check(*task.RemainingMinutes >= 0, "remaining_minutes", "must not be negative")
+		v.Check(*task.RemainingMinutes <= maxEstimateMinutes, "remaining_minutes", "must not be more than a year")
+	}
 	v.Check(task.Priority != "", "priority", "must be provided")
+	v.Check(task.Priority == "" || validator.In(string(task.Priority), TaskPriorities...), "priority", "must be one of "+strings.Join(TaskPriorities, ", "))
 	v.Check(task.Status != "", "status", "must be provided")
-	v.Check(task.Category != "", "category", "must be provided")
+	v.Check(task.Status == "" || validator.In(string(task.Status), TaskStatuses...), "status", "must be one of "+strings.Join(TaskStatuses, ", "))
+	// The category can be given by ID or by name; CategoryModel.ResolveForTask() checks
+	// that it exists and belongs to the task's owner.
+	v.Check(task.CategoryID != 0 || task.Category != "", "category_id", "must be provided")
+	if task.Recurrence != "" {
+		_, err := rrule.Parse(task.Recurrence)
+		v.Check(err == nil, "recurrence", "must be a valid RRULE (e.g. FREQ=WEEKLY;BYDAY=TU)")
+		// The next occurrence is scheduled from the due date.
+		v.Check(!task.DueDate.IsZero(), "due_date", "must be provided for recurring tasks")
+	}
 }
 
 // Define a TaskModel struct type which wraps a sql.DB connection pool.
 type TaskModel struct {
-	DB *sql.DB
+	DB    dbConn
+	cache workspaceCache
+}
+
+// Add a placeholder method for inserting a new record in the task table. The first
+// version of the task is saved in its history in the same transaction.
+func (m TaskModel) Insert(ctx context.Context, task *Task) error {
+	return m.InTx(ctx, func(tx TaskTx) error {
+		return tx.Insert(task)
+	})
 }
 
-// Add a placeholder method for inserting a new record in the task table.
-func (m TaskModel) Insert(task *Task) error {
+func insertTask(ctx context.Context, q queryer, task *Task) error {
 	// Define the SQL query for inserting a new record in the task table and returning the system-generated data.
+	// New tasks go to the bottom of their status column.
 	query := `
-		INSERT INTO tasks (title, description, priority, status, category, due_date)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, user_id, version`
+		INSERT INTO tasks (title, description, priority, status, category_id, category, due_date, user_id, workspace_id, recurrence, position, completed_at, start_date,
+			estimate_minutes, remaining_minutes, custom_fields, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+			(SELECT COALESCE(MAX(position), 0) + $11 FROM tasks WHERE workspace_id = $9 AND status = $4),
+			CASE WHEN $4 = 'completed' THEN NOW() END, $12, $13, $14, $15, NOW())
+		RETURNING id, created_at, updated_at, version, position, completed_at`
 	// Create an args slice containing the values for the placeholder parameters from the task struct.
 	// Declaring this slice immediately next to our SQL query helps to make it nice
 	// 		and clear *what values are being used where* in the query.
-	args := []interface{}{task.Title, task.Description, task.Priority, task.Status, task.Category, task.DueDate}
-	// Use the QueryRow() method to execute the SQL query on our connection pool,
+	args := []interface{}{task.Title, task.Description, task.Priority, task.Status, task.CategoryID, task.Category, task.DueDate, task.UserID, task.WorkspaceID, task.Recurrence, positionGap, task.StartDate, task.EstimateMinutes, task.RemainingMinutes, task.CustomFields}
+	// Use the QueryRowContext() method to execute the SQL query,
 	// passing in the args slice as a variadic parameter
-	// and scanning the system-generated id, created_at and version values into the movie struct.
-	return m.DB.QueryRow(query, args...).Scan(&task.ID, &task.CreatedAt, &task.UserID, &task.Version)
+	// and scanning the system-generated id, created_at and version values into the task struct.
+	if task.CustomFields == nil {
+		task.CustomFields = CustomFieldValues{}
+	}
+	err := q.QueryRowContext(ctx, query, args...).Scan(&task.ID, &task.CreatedAt, &task.UpdatedAt, &task.Version, &task.Position, &task.CompletedAt)
+	if err != nil {
+		return err
+	}
+	return saveTaskVersion(ctx, q, task.ID)
 }
 
-// Add a placeholder method for fetching a specific record from the task table.
-func (m TaskModel) Get(id int64) (*Task, error) {
-	// The PostgreSQL bigserial type that we're using for the movie ID starts auto-incrementing at 1 by default,
-	// so we know that no task will have ID values less than that.
-	// To avoid making an unnecessary database call, we take a shortcut and return an ErrRecordNotFound error straight away.
+// GetForWorkspace() fetches a specific task, but only if it belongs to the given workspace.
+// A task in another workspace is reported as ErrRecordNotFound, so that callers can't
+// probe for the existence of other users' tasks.
+func (m TaskModel) GetForWorkspace(ctx context.Context, id int64, workspaceID int64) (*Task, error) {
+	var cached Task
+	gen, found := m.cache.get("task", workspaceID, id, &cached)
+	if found {
+		return &cached, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	task, err := getTaskForWorkspace(ctx, m.DB, id, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	m.cache.set(gen, "task", workspaceID, id, task)
+	return task, nil
+}
+
+func getTaskForWorkspace(ctx context.Context, q queryer, id int64, workspaceID int64) (*Task, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
-	// Define the SQL query for retrieving the task data.
 	query := `
-		SELECT id, created_at, title, description, priority, status, category, due_date, user_id, version
+		SELECT ` + taskColumns + `
 		FROM tasks
-		WHERE id = $1`
-	// Declare a Task struct to hold the data returned by the query.
+		WHERE id = $1 AND workspace_id = $2`
 	var task Task
 
-	// Use the context.WithTimeout() function to create a context.Context which carries a 3-second timeout deadline.
-	// Note that we're using the empty context.Background() as the 'parent' context.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-
-	// Importantly, use defer to make sure that we cancel the context before the Get() method returns.
-	defer cancel()
-
-	// Use the QueryRowContext() method to execute the query, passing in the context with the deadline as the first argument.
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&task.ID,
-		&task.CreatedAt,
-		&task.Title,
-		&task.Description,
-		&task.Priority,
-		&task.Status,
-		&task.Category,
-		&task.DueDate,
-		&task.UserID,
-		&task.Version,
-	)
-	// Handle any errors. If there was no matching task found, Scan() will return a sql.ErrNoRows error.
-	// We check for this and return our custom ErrRecordNotFound error instead.
+	err := q.QueryRowContext(ctx, query, id, workspaceID).Scan(task.scanDest()...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -103,37 +251,122 @@ func (m TaskModel) Get(id int64) (*Task, error) {
 			return nil, err
 		}
 	}
-	// Otherwise, return a pointer to the Movie struct.
 	return &task, nil
 }
 
-// Add a placeholder method for updating a specific record in the task table.
-func (m TaskModel) Update(task *Task) error {
+// GetMany() fetches the tasks with the given IDs in a single query, ordered by ID. IDs that
+// don't belong to a task in the workspace are skipped rather than reported, so the result
+// can be shorter than ids.
+func (m TaskModel) GetMany(ctx context.Context, workspaceID int64, ids []int64) ([]*Task, error) {
+	tasks := []*Task{}
+	if len(ids) == 0 {
+		return tasks, nil
+	}
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE workspace_id = $1 AND ` + m.DB.dialect.anyOf("id", "$2") + `
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID, m.DB.dialect.array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(task.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// GetForCategories() fetches the unarchived tasks in any of the given categories in a
+// single query, ordered by ID.
+func (m TaskModel) GetForCategories(ctx context.Context, workspaceID int64, categoryIDs []int64) ([]*Task, error) {
+	tasks := []*Task{}
+	if len(categoryIDs) == 0 {
+		return tasks, nil
+	}
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE workspace_id = $1 AND NOT archived AND ` + m.DB.dialect.anyOf("category_id", "$2") + `
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID, m.DB.dialect.array(categoryIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(task.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Add a placeholder method for updating a specific record in the task table. The new
+// version of the task is saved in its history in the same transaction.
+func (m TaskModel) Update(ctx context.Context, task *Task) error {
+	return m.InTx(ctx, func(tx TaskTx) error {
+		return tx.Update(task)
+	})
+}
+
+func updateTask(ctx context.Context, q queryer, task *Task) error {
 	// Declare the SQL query for updating the record and returning the new version number.
+	// completed_at records when the task was completed, and is cleared if it's reopened.
 	query := `
 		UPDATE tasks
-		SET title = $1, description = $2, priority = $3, status = $4, category = $5, due_date = $6, user_id = $7, version = version + 1
-		WHERE id = $8 AND version = $9
-		RETURNING version`
+		SET title = $1, description = $2, priority = $3, status = $4, category_id = $5, category = $6, due_date = $7, user_id = $8, recurrence = $9, archived = $10, snoozed_until = $13, start_date = $14, estimate_minutes = $15, remaining_minutes = $16, custom_fields = $17, version = version + 1,
+			completed_at = CASE WHEN $4 <> 'completed' THEN NULL ELSE COALESCE(completed_at, NOW()) END, updated_at = NOW()
+		WHERE id = $11 AND version = $12
+		RETURNING version, completed_at, updated_at`
 	// Create an args slice containing the values for the placeholder parameters.
 	args := []interface{}{
 		task.Title,
 		task.Description,
 		task.Priority,
 		task.Status,
+		task.CategoryID,
 		task.Category,
 		task.DueDate,
 		task.UserID,
+		task.Recurrence,
+		task.Archived,
 		task.ID,
 		task.Version, // // Add the expected task version
+		task.SnoozedUntil,
+		task.StartDate,
+		task.EstimateMinutes,
+		task.RemainingMinutes,
+		task.CustomFields,
 	}
 
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	// Use QueryRowContext() and pass the context as the first argument.
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&task.Version)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&task.Version, &task.CompletedAt, &task.UpdatedAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -142,117 +375,595 @@ func (m TaskModel) Update(task *Task) error {
 			return err
 		}
 	}
+	return saveTaskVersion(ctx, q, task.ID)
+}
+
+// DeleteForWorkspace() deletes a specific task, but only if it belongs to the given
+// workspace.
+func (m TaskModel) DeleteForWorkspace(ctx context.Context, id int64, workspaceID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := deleteTaskForWorkspace(ctx, m.DB, id, workspaceID)
+	if err != nil {
+		return err
+	}
+	m.cache.invalidate(workspaceID)
 	return nil
 }
 
-// Add a placeholder method for deleting a specific record from the task table.
-func (m TaskModel) Delete(id int64) error {
-	// Return an ErrRecordNotFound error if the task ID is less than 1.
+func deleteTaskForWorkspace(ctx context.Context, q queryer, id int64, workspaceID int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
-	// Construct the SQL query to delete the record.
 	query := `
 		DELETE FROM tasks
-		WHERE id = $1`
-
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+		WHERE id = $1 AND workspace_id = $2`
 
-	// Use ExecContext() and pass the context as the first argument.
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := q.ExecContext(ctx, query, id, workspaceID)
 	if err != nil {
 		return err
 	}
 
-	// Call the RowsAffected() method on the sql.Result object to get the number of rows affected by the query.
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
-	// If no rows were affected,
-	//	we know that the tasks table didn't contain a record with the provided ID at the moment we tried to delete it.
-	// In that case we return an ErrRecordNotFound error.
 	if rowsAffected == 0 {
 		return ErrRecordNotFound
 	}
 	return nil
 }
 
-// Create a new GetAll() method which returns a slice of tasks.
-// Although we're not using them right now, we've set this up to accept the various filter parameters as arguments.
-func (t TaskModel) GetAll(title string, filters Filters) ([]*Task, Metadata, error) {
-	// Update the SQL query to include the window function which counts the total (filtered) records.
+// TaskFilters holds the optional conditions for listing a user's tasks. A zero value
+// means "don't filter on this".
+type TaskFilters struct {
+	Title           string
+	Query           string   // Full-text search over title and description, see searchQuery().
+	Tags            []string // Only tasks carrying every one of these tags.
+	IncludeArchived bool
+	IncludeSnoozed  bool     // Include tasks that are snoozed, see Task.IsSnoozed().
+	Statuses        []string // Only tasks with one of these statuses.
+	Priorities      []string // Only tasks with one of these priorities.
+	Category        string
+	CategoryID      int64
+	DueBefore       time.Time
+	DueAfter        time.Time
+	HasDueDate      *bool // Only tasks with (true) or without (false) a due date.
+	CompletedBefore time.Time
+	CompletedAfter  time.Time
+	// Due is one of TaskDueFilters, a shortcut for the tasks that are overdue at Now, or
+	// due on the day or in the seven days starting at Today, the start of the current day
+	// in the user's time zone.
+	Due   string
+	Now   time.Time
+	Today time.Time
+	// Available picks out the tasks that can be started at Now, those without a start date
+	// or whose start date has arrived, and Scheduled the ones whose start date hasn't.
+	Available bool
+	Scheduled bool
+	// CustomFields picks out the tasks with the given values of custom fields.
+	CustomFields []CustomFieldFilter
+	// UserID is the user whose pins count: their pinned tasks come first, and Pinned
+	// picks out the tasks they have (true) or haven't (false) pinned.
+	UserID int64
+	Pinned *bool
+	// Similarity is how similar a task's title must be to Title or Query, from 0 to 1,
+	// for fuzzy matching to find it when they match nothing exactly. Zero turns fuzzy
+	// matching off.
+	Similarity float64
+	fuzzy      bool // Set for the fuzzy retry, see eachForWorkspace().
+}
+
+// fuzzyText returns the text that fuzzy matching compares task titles with: the
+// full-text search if there is one, otherwise the title filter.
+func (tf TaskFilters) fuzzyText() string {
+	if searchQuery(tf.Query) != "" {
+		return tf.Query
+	}
+	return tf.Title
+}
+
+// where builds the WHERE clause and its placeholder arguments for the given workspace and
+// filters, including only the conditions that are actually set.
+func (tf TaskFilters) where(d dialect, workspaceID int64) *whereClause {
+	w := &whereClause{}
+	w.add("workspace_id = " + w.arg(workspaceID))
+	switch {
+	case tf.fuzzy:
+		// pg_trgm's word_similarity() finds titles containing something close to each of
+		// the texts, typos and all. No index helps here, but the workspace_id one keeps the
+		// number of titles to compare down.
+		if tf.Title != "" {
+			w.add("word_similarity(" + w.arg(tf.Title) + ", title) >= " + w.arg(tf.Similarity))
+		}
+		if searchQuery(tf.Query) != "" {
+			w.add("word_similarity(" + w.arg(tf.Query) + ", title) >= " + w.arg(tf.Similarity))
+		}
+	default:
+		if tf.Title != "" {
+			w.add(d.textMatch("title", w.arg(tf.Title)))
+		}
+		if tsquery := searchQuery(tf.Query); tsquery != "" {
+			w.add(d.search("search", "title", "description", w.arg(tsquery)))
+		}
+	}
+	if len(tf.Tags) > 0 {
+		// Tags are private, so only the user's own count, see TagModel.GetForTask().
+		owner := ""
+		if tf.UserID != 0 {
+			owner = " AND tags.user_id = " + w.arg(tf.UserID)
+		}
+		w.add(`id IN (
+			SELECT task_tags.task_id
+			FROM task_tags
+			INNER JOIN tags ON tags.id = task_tags.tag_id
+			WHERE ` + d.anyOf("tags.name", w.arg(d.array(tf.Tags))) + owner + `
+			GROUP BY task_tags.task_id
+			HAVING count(DISTINCT tags.name) = ` + w.arg(len(tf.Tags)) + `)`)
+	}
+	if !tf.IncludeArchived {
+		w.add("NOT archived")
+	}
+	if !tf.IncludeSnoozed {
+		w.add("(snoozed_until IS NULL OR snoozed_until <= NOW())")
+	}
+	if len(tf.Statuses) > 0 {
+		w.add(d.anyOf("status", w.arg(d.array(tf.Statuses))))
+	}
+	if len(tf.Priorities) > 0 {
+		w.add(d.anyOf("priority", w.arg(d.array(tf.Priorities))))
+	}
+	if tf.Category != "" {
+		w.add("category = " + w.arg(tf.Category))
+	}
+	if tf.CategoryID != 0 {
+		w.add("category_id = " + w.arg(tf.CategoryID))
+	}
+	if !tf.DueBefore.IsZero() {
+		w.add("due_date < " + w.arg(tf.DueBefore))
+	}
+	if !tf.DueAfter.IsZero() {
+		w.add("due_date > " + w.arg(tf.DueAfter))
+	}
+	if !tf.CompletedBefore.IsZero() {
+		w.add("completed_at < " + w.arg(tf.CompletedBefore))
+	}
+	if !tf.CompletedAfter.IsZero() {
+		w.add("completed_at > " + w.arg(tf.CompletedAfter))
+	}
+	// The shortcuts compare due_date with times worked out beforehand, rather than with
+	// date functions applied to it, so that they can use the tasks_workspace_id_due_date_idx
+	// index.
+	switch tf.Due {
+	case DueOverdue:
+		w.add("due_date < " + w.arg(tf.Now))
+		w.add("status <> 'completed'")
+	case DueToday:
+		// Tasks scheduled to start later in the day join the list when they start.
+		w.add("due_date >= " + w.arg(tf.Today))
+		w.add("due_date < " + w.arg(tf.Today.AddDate(0, 0, 1)))
+		w.add("(start_date IS NULL OR start_date <= " + w.arg(tf.Now) + ")")
+	case DueThisWeek:
+		w.add("due_date >= " + w.arg(tf.Today))
+		w.add("due_date < " + w.arg(tf.Today.AddDate(0, 0, 7)))
+	}
+	if tf.HasDueDate != nil {
+		if *tf.HasDueDate {
+			w.add("due_date IS NOT NULL")
+		} else {
+			w.add("due_date IS NULL")
+		}
+	}
+	if tf.Available {
+		w.add("(start_date IS NULL OR start_date <= " + w.arg(tf.Now) + ")")
+	}
+	if tf.Scheduled {
+		w.add("start_date > " + w.arg(tf.Now))
+	}
+	for _, cf := range tf.CustomFields {
+		if _, ok := cf.Value.(float64); ok {
+			w.add(d.jsonNumber("custom_fields", w.arg(cf.Name)) + " = " + w.arg(cf.Value))
+		} else {
+			w.add(d.jsonText("custom_fields", w.arg(cf.Name)) + " = " + w.arg(cf.Value))
+		}
+	}
+	if tf.Pinned != nil {
+		pinned := "id IN (SELECT task_id FROM task_pins WHERE user_id = " + w.arg(tf.UserID) + ")"
+		if !*tf.Pinned {
+			pinned = "NOT " + pinned
+		}
+		w.add(pinned)
+	}
+	return w
+}
+
+// searchQuery turns free text typed by a user into a tsquery that matches documents
+// containing all of the words, each as a prefix (so "meet sched" finds "meeting
+// schedule"). Anything other than letters and digits is dropped, which keeps tsquery
+// operators in the input from being interpreted.
+func searchQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// orderBy returns the ORDER BY clause for a task list. When a full-text search is active the
+// best matches come first, and the client's sort order breaks ties; fuzzy matches are
+// ordered by how similar their titles are. After that the user's pinned tasks come first.
+// Tasks without a due date or estimate come after the others when sorting by it, in either
+// direction.
+func (tf TaskFilters) orderBy(d dialect, w *whereClause, filters Filters) string {
+	order := fmt.Sprintf("%s %s, id ASC", filters.sortColumn(), filters.sortDirection())
+	if column := filters.sortColumn(); column == "due_date" || column == "estimate_minutes" {
+		order = fmt.Sprintf("%s %s NULLS LAST, id ASC", column, filters.sortDirection())
+	}
+	if tf.UserID != 0 && tf.Pinned == nil {
+		order = "EXISTS (SELECT 1 FROM task_pins WHERE task_pins.task_id = tasks.id AND task_pins.user_id = " + w.arg(tf.UserID) + ") DESC, " + order
+	}
+	switch {
+	case tf.fuzzy:
+		order = "word_similarity(" + w.arg(tf.fuzzyText()) + ", title) DESC, " + order
+	case searchQuery(tf.Query) != "":
+		order = d.searchRank("search", "title", "description", w.arg(searchQuery(tf.Query))) + " DESC, " + order
+	}
+	return order
+}
+
+// GetAllForWorkspace() works like GetAll(), but only returns tasks that belong to the given
+// workspace and match the conditions in tf.
+func (t TaskModel) GetAllForWorkspace(ctx context.Context, workspaceID int64, tf TaskFilters, filters Filters) ([]*Task, Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.DB.timeout)
+	defer cancel()
+
+	tasks := []*Task{}
+	metadata, err := t.eachForWorkspace(ctx, workspaceID, tf, filters, func(task *Task) error {
+		tasks = append(tasks, task)
+		return nil
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return tasks, metadata, nil
+}
+
+// StreamForWorkspace() works like GetAllForWorkspace(), but calls fn for each task as its
+// row is read instead of collecting them, so that a large page doesn't have to fit in
+// memory. The metadata is returned once all of the rows have been read.
+func (t TaskModel) StreamForWorkspace(ctx context.Context, workspaceID int64, tf TaskFilters, filters Filters, fn func(task *Task) error) (Metadata, error) {
+	// Streaming to a slow client can take a while, so allow more time than usual.
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	return t.eachForWorkspace(ctx, workspaceID, tf, filters, fn)
+}
+
+func (t TaskModel) eachForWorkspace(ctx context.Context, workspaceID int64, tf TaskFilters, filters Filters, fn func(task *Task) error) (Metadata, error) {
+	where := tf.where(t.DB.dialect, workspaceID)
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, title, description, due_date, priority, status, category, user_id, version
+		SELECT count(*) OVER(), `+taskColumns+`
 		FROM tasks
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		ORDER BY %s %s, id ASC
-		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+		WHERE %s
+		ORDER BY %s
+		LIMIT %s OFFSET %s`, where, tf.orderBy(t.DB.dialect, where, filters), where.arg(filters.limit()), where.arg(filters.offset()))
+
+	rows, err := t.DB.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(append([]interface{}{&totalRecords}, task.scanDest()...)...)
+		if err != nil {
+			return Metadata{}, err
+		}
+		err = fn(&task)
+		if err != nil {
+			return Metadata{}, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return Metadata{}, err
+	}
+
+	// Finding nothing may be down to a typo in the title or search, so try again with
+	// fuzzy matching. fn hasn't been called yet, so nothing is returned twice.
+	if totalRecords == 0 && tf.canRetryFuzzy() {
+		exact, err := t.anyForWorkspace(ctx, workspaceID, tf, filters)
+		if err != nil {
+			return Metadata{}, err
+		}
+		if !exact {
+			tf.fuzzy = true
+			return t.eachForWorkspace(ctx, workspaceID, tf, filters, fn)
+		}
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return metadata, nil
+}
+
+// canRetryFuzzy reports whether a task list that found nothing should be tried again with
+// fuzzy matching.
+func (tf TaskFilters) canRetryFuzzy() bool {
+	return !tf.fuzzy && tf.Similarity > 0 && tf.fuzzyText() != ""
+}
+
+// anyForWorkspace reports whether any task matches tf exactly. An empty page past the
+// first doesn't mean that nothing does, so only then is it worth asking.
+func (t TaskModel) anyForWorkspace(ctx context.Context, workspaceID int64, tf TaskFilters, filters Filters) (bool, error) {
+	if filters.offset() == 0 {
+		return false, nil
+	}
+	where := tf.where(t.DB.dialect, workspaceID)
+	var exists bool
+	err := t.DB.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM tasks WHERE "+where.String()+")", where.args...).Scan(&exists)
+	return exists, err
+}
 
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// GetPendingRecurrences returns completed recurring tasks whose next occurrence hasn't
+// been created yet.
+func (m TaskModel) GetPendingRecurrences(ctx context.Context, limit int) ([]*Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE recurrence <> '' AND NOT recurrence_materialized AND status = 'completed'
+		ORDER BY id
+		LIMIT $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
 
-	// As our SQL query now has quite a few placeholder parameters,
-	// let's collect the values for the placeholders in a slice.
-	// Notice here how we call the limit() and offset() methods on the Filters struct to get the appropriate values
-	//		for the LIMIT and OFFSET clauses.
-	args := []interface{}{title, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	// And then pass the args slice to QueryContext() as a variadic parameter.
-	rows, err := t.DB.QueryContext(ctx, query, args...)
+	tasks := []*Task{}
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(task.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// InsertOccurrence inserts next as the following occurrence of the recurring task prev
+// and marks prev as materialized, in a single transaction. If prev has already been
+// materialized (e.g. by another instance of the API), nothing is inserted and
+// ErrEditConflict is returned.
+func (m TaskModel) InsertOccurrence(ctx context.Context, prev *Task, next *Task) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, Metadata{}, err // Update this to return an empty Metadata struct.
+		return err
 	}
+	defer tx.Rollback()
 
-	// Importantly, defer a call to rows.Close() to ensure that the resultset is closed before GetAll() returns.
-	defer rows.Close()
+	query := `
+		UPDATE tasks
+		SET recurrence_materialized = true
+		WHERE id = $1 AND NOT recurrence_materialized`
+	result, err := tx.ExecContext(ctx, query, prev.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
 
-	// Declare a totalRecords variable.
-	totalRecords := 0
+	// The series has ended, so there is nothing to insert.
+	if next == nil {
+		return tx.Commit()
+	}
+
+	err = insertTask(ctx, tx, next)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DuplicateOptions says what TaskRepository.Duplicate() copies along with a task.
+type DuplicateOptions struct {
+	Subtasks bool
+	Tags     bool
+}
+
+// Duplicate inserts copy, a new task made from the one with the ID sourceID, and gives it
+// the source's subtasks and tags as opts says, in a single transaction. The subtasks are
+// copied in the same order, none of them done.
+func (m TaskModel) Duplicate(ctx context.Context, sourceID int64, copy *Task, opts DuplicateOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertTask(ctx, tx, copy)
+	if err != nil {
+		return err
+	}
+	if opts.Subtasks {
+		query := `
+			INSERT INTO subtasks (task_id, title, done, position)
+			SELECT $1, title, false, position
+			FROM subtasks
+			WHERE task_id = $2
+			ORDER BY position, id`
+		_, err = tx.ExecContext(ctx, query, copy.ID, sourceID)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.Tags {
+		query := `
+			INSERT INTO task_tags (task_id, tag_id)
+			SELECT $1, tag_id
+			FROM task_tags
+			WHERE task_id = $2`
+		_, err = tx.ExecContext(ctx, query, copy.ID, sourceID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetAllForCalendar returns the tasks that aren't archived in all of the workspaces a user
+// is a member of, ordered by due date, for the calendar feed. Those without a due date
+// come last.
+func (m TaskModel) GetAllForCalendar(ctx context.Context, userID int64) ([]*Task, error) {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1) AND NOT archived
+		ORDER BY due_date ASC NULLS LAST, id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	// Initialize an empty slice to hold the movie data.
 	tasks := []*Task{}
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(task.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &task)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// ForEachForWorkspace calls fn for every one of a workspace's tasks, archived ones
+// included, in ID order. Rows are read one at a time, so a large export doesn't have to fit
+// in memory.
+func (m TaskModel) ForEachForWorkspace(ctx context.Context, workspaceID int64, fn func(task *Task) error) error {
+	query := `
+		SELECT ` + taskColumns + `
+		FROM tasks
+		WHERE workspace_id = $1
+		ORDER BY id ASC`
+
+	// Streaming to a slow client can take a while, so allow more time than usual.
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
-	// Use rows.Next to iterate through the rows in the resultset.
 	for rows.Next() {
-		// Initialize an empty Movie struct to hold the data for an individual movie.
 		var task Task
-		// Scan the values from the row into the Movie struct. Again, note that we're
-		// using the pq.Array() adapter on the genres field here.
-		err := rows.Scan(
-			&totalRecords, // Scan the count from the window function into totalRecords.
-			&task.ID,
-			&task.CreatedAt,
-			&task.Title,
-			&task.Description,
-			&task.DueDate,
-			&task.Priority,
-			&task.Status,
-			&task.Category,
-			&task.UserID,
-			&task.Version,
-		)
+		err := rows.Scan(task.scanDest()...)
 		if err != nil {
-			return nil, Metadata{}, err // Update this to return an empty Metadata struct.
+			return err
 		}
+		err = fn(&task)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
 
-		// Add the Movie struct to the slice.
-		tasks = append(tasks, &task)
+// taskTx is the TaskTx of TaskModel, which runs everything in a database transaction.
+type taskTx struct {
+	ctx     context.Context
+	tx      *sql.Tx
+	dialect dialect
+	// changed collects the workspaces whose tasks were changed, to be invalidated in
+	// the cache once the transaction has committed.
+	changed map[int64]bool
+}
+
+// InTx runs fn inside a single transaction, committing if fn returns nil and rolling
+// everything back otherwise.
+func (m TaskModel) InTx(ctx context.Context, fn func(tx TaskTx) error) error {
+	// A transaction may contain many statements, so allow it more time than a single query.
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	// When the rows.Next() loop has finished, call rows.Err() to retrieve any error that was encountered during the iteration.
-	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err // Update this to return an empty Metadata struct.
+	t := taskTx{ctx: ctx, tx: tx, dialect: m.DB.dialect, changed: make(map[int64]bool)}
+	err = fn(t)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	for workspaceID := range t.changed {
+		m.cache.invalidate(workspaceID)
 	}
+	return nil
+}
 
-	// Generate a Metadata struct, passing in the total record count and pagination
-	// parameters from the client.
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+func (t taskTx) Insert(task *Task) error {
+	return insertTask(t.ctx, t.tx, task)
+}
 
-	// If everything went OK, then return the slice of movies.
-	return tasks, metadata, nil
+func (t taskTx) GetForWorkspace(id int64, workspaceID int64) (*Task, error) {
+	return getTaskForWorkspace(t.ctx, t.tx, id, workspaceID)
+}
+
+func (t taskTx) Update(task *Task) error {
+	t.changed[task.WorkspaceID] = true
+	return updateTask(t.ctx, t.tx, task)
+}
+
+func (t taskTx) DeleteForWorkspace(id int64, workspaceID int64) error {
+	t.changed[workspaceID] = true
+	return deleteTaskForWorkspace(t.ctx, t.tx, id, workspaceID)
+}
+
+func (t taskTx) CheckBlockers(task *Task, from TaskStatus) error {
+	return checkBlockers(t.ctx, t.tx, task, from)
+}
+
+func (t taskTx) InsertCategory(category *Category) error {
+	return insertCategory(t.ctx, t.tx, t.dialect, category)
 }
@@ -0,0 +1,193 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+var ErrTimerRunning = errors.New("timer already running")
+
+// TimeEntry is a stretch of time spent on a task, either tracked with the timer or added
+// by hand. A running timer has no EndedAt yet.
+type TimeEntry struct {
+	ID        int64       `json:"id"`
+	CreatedAt CustomTime  `json:"created_at"`
+	TaskID    int64       `json:"task_id"`
+	UserID    int64       `json:"-"`
+	StartedAt CustomTime  `json:"started_at"`
+	EndedAt   *CustomTime `json:"ended_at"`
+	Note      string      `json:"note"`
+	// Duration is calculated when the entry is read; for a running timer it is the time
+	// tracked so far.
+	DurationSeconds int64 `json:"duration_seconds"`
+}
+
+func ValidateTimeEntry(v *validator.Validator, entry *TimeEntry) {
+	v.Check(!entry.StartedAt.IsZero(), "started_at", "must be provided")
+	v.Check(entry.EndedAt != nil && !entry.EndedAt.IsZero(), "ended_at", "must be provided")
+	if entry.EndedAt != nil && !entry.StartedAt.IsZero() {
+		v.Check(entry.EndedAt.After(time.Time(entry.StartedAt)), "ended_at", "must be later than started_at")
+		v.Check(time.Time(*entry.EndedAt).Sub(time.Time(entry.StartedAt)) <= 24*time.Hour, "ended_at", "must be at most 24 hours after started_at")
+		v.Check(entry.EndedAt.Before(time.Now().Add(time.Minute)), "ended_at", "must not be in the future")
+	}
+	v.Check(len(entry.Note) <= 500, "note", "must not be more than 500 bytes long")
+}
+
+// timeEntryColumns lists the columns scanned by scanDest(), including the calculated
+// duration.
+func timeEntryColumns(d dialect) string {
+	return `id, created_at, task_id, user_id, started_at, ended_at, note,
+	` + d.secondsBetween("started_at", "COALESCE(ended_at, NOW())") + `::bigint`
+}
+
+func (entry *TimeEntry) scanDest() []interface{} {
+	return []interface{}{
+		&entry.ID,
+		&entry.CreatedAt,
+		&entry.TaskID,
+		&entry.UserID,
+		&entry.StartedAt,
+		&entry.EndedAt,
+		&entry.Note,
+		&entry.DurationSeconds,
+	}
+}
+
+// Define a TimeEntryModel struct type which wraps a sql.DB connection pool.
+type TimeEntryModel struct {
+	DB dbConn
+}
+
+// Start starts a timer on a task. A user can only have one timer running, so this
+// returns ErrTimerRunning if another one is still going.
+func (m TimeEntryModel) Start(ctx context.Context, taskID int64, userID int64) (*TimeEntry, error) {
+	query := `
+		INSERT INTO time_entries (task_id, user_id, started_at)
+		VALUES ($1, $2, NOW())
+		RETURNING ` + timeEntryColumns(m.DB.dialect)
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var entry TimeEntry
+	err := m.DB.QueryRowContext(ctx, query, taskID, userID).Scan(entry.scanDest()...)
+	if err != nil {
+		switch {
+		case m.DB.dialect.isUniqueViolation(err, "time_entries_running_idx"):
+			return nil, ErrTimerRunning
+		default:
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// Stop stops the timer running on a task, returning ErrRecordNotFound if there isn't one.
+func (m TimeEntryModel) Stop(ctx context.Context, taskID int64, userID int64) (*TimeEntry, error) {
+	query := `
+		UPDATE time_entries
+		SET ended_at = NOW()
+		WHERE task_id = $1 AND user_id = $2 AND ended_at IS NULL
+		RETURNING ` + timeEntryColumns(m.DB.dialect)
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var entry TimeEntry
+	err := m.DB.QueryRowContext(ctx, query, taskID, userID).Scan(entry.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// Insert adds a finished time entry entered by hand.
+func (m TimeEntryModel) Insert(ctx context.Context, entry *TimeEntry) error {
+	query := `
+		INSERT INTO time_entries (task_id, user_id, started_at, ended_at, note)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + timeEntryColumns(m.DB.dialect)
+	args := []interface{}{entry.TaskID, entry.UserID, entry.StartedAt, entry.EndedAt, entry.Note}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(entry.scanDest()...)
+}
+
+// GetAllForTask returns the time entries of a task, most recent first.
+func (m TimeEntryModel) GetAllForTask(ctx context.Context, taskID int64) ([]*TimeEntry, error) {
+	query := `
+		SELECT ` + timeEntryColumns(m.DB.dialect) + `
+		FROM time_entries
+		WHERE task_id = $1
+		ORDER BY started_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	entries := []*TimeEntry{}
+	err := queryEach(ctx, m.DB, query, []interface{}{taskID}, func(rows *sql.Rows) error {
+		var entry TimeEntry
+		err := rows.Scan(entry.scanDest()...)
+		entries = append(entries, &entry)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// TotalForTask returns the number of seconds tracked on a task, including the time so far
+// of a running timer.
+func (m TimeEntryModel) TotalForTask(ctx context.Context, taskID int64) (int64, error) {
+	query := `
+		SELECT COALESCE(SUM(` + m.DB.dialect.secondsBetween("started_at", "COALESCE(ended_at, NOW())") + `), 0)::bigint
+		FROM time_entries
+		WHERE task_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var total int64
+	err := m.DB.QueryRowContext(ctx, query, taskID).Scan(&total)
+	return total, err
+}
+
+// Delete removes a time entry from a task.
+func (m TimeEntryModel) Delete(ctx context.Context, id int64, taskID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM time_entries
+		WHERE id = $1 AND task_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, taskID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
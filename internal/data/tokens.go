@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"github.com/zarinakolybaeva/DoMake/internal/validator"
 	"time"
 )
@@ -15,10 +16,17 @@ import (
 const (
 	ScopeActivation      = "activation"
 	ScopeAuthentications = "authentication"
+	// ScopeCalendar tokens only give read access to the calendar feed, so that they can
+	// be embedded in a subscription URL.
+	ScopeCalendar = "calendar"
+	// ScopeRefresh tokens are only issued in JWT mode, and can be traded for a new
+	// access token at POST /v1/tokens/refresh.
+	ScopeRefresh = "refresh"
 )
 
 // Add struct tags to control how the struct appears when encoded to JSON.
 type Token struct {
+	ID        int64     `json:"-"`
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
@@ -71,39 +79,105 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 
 // Define the TokenModel type.
 type TokenModel struct {
-	DB *sql.DB
+	DB dbConn
 }
 
 // The New() method is a shortcut which creates a new Token struct and then inserts the
 // data in the tokens table.
-func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+func (m TokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
-	err = m.Insert(token)
+	err = m.Insert(ctx, token)
 	return token, err
 }
 
 // Insert() adds the data for a specific token to the tokens table.
-func (m TokenModel) Insert(token *Token) error {
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
 	query := `
 INSERT INTO tokens (hash, user_id, expiry, scope)
 VALUES ($1, $2, $3, $4)`
 	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, args...)
 	return err
 }
 
 // DeleteAllForUser() deletes all tokens for a specific user and scope.
-func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
+func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
 	query := `
 DELETE FROM tokens
 WHERE scope = $1 AND user_id = $2`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// Replace issues a new token for a user in place of all their existing tokens with the
+// same scope, in a single transaction, so that only the newest one works.
+func (m TokenModel) Replace(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE scope = $1 AND user_id = $2`, scope, userID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+INSERT INTO tokens (hash, user_id, expiry, scope)
+VALUES ($1, $2, $3, $4)`
+	_, err = tx.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return nil, err
+	}
+	return token, tx.Commit()
+}
+
+// LastIssued returns when the newest of a user's tokens with the given scope was issued,
+// or the zero time if they have none.
+func (m TokenModel) LastIssued(ctx context.Context, scope string, userID int64) (time.Time, error) {
+	query := `
+SELECT created_at
+FROM tokens
+WHERE scope = $1 AND user_id = $2
+ORDER BY created_at DESC
+LIMIT 1`
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+	var issued CustomTime
+	err := m.DB.QueryRowContext(ctx, query, scope, userID).Scan(&issued)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, err
+	}
+	return time.Time(issued), nil
+}
+
+// Expired reports whether tokenPlaintext is a token with the given scope that has expired,
+// so that it can be told apart from one that was never valid.
+func (m TokenModel) Expired(ctx context.Context, scope, tokenPlaintext string) (bool, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+SELECT EXISTS (
+	SELECT 1 FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry <= $3
+)`
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+	var expired bool
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], scope, time.Now()).Scan(&expired)
+	return expired, err
+}
@@ -0,0 +1,64 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/zarinakolybaeva/DoMake/internal/tracing"
+)
+
+// start records a span for a query made directly on the connection pool, as a child of
+// the span in ctx (such as the span of the request being handled). Without a span in ctx
+// it returns nil, and nothing is recorded. Statements run inside a transaction aren't
+// traced one by one, since *sql.Tx can't be wrapped without changing every model that
+// uses one.
+func (db dbConn) start(ctx context.Context, query string) *tracing.Span {
+	parent := tracing.SpanFromContext(ctx)
+	if parent == nil {
+		return nil
+	}
+	statement := strings.Join(strings.Fields(query), " ")
+	operation, _, _ := strings.Cut(statement, " ")
+
+	_, span := parent.Tracer().Start(ctx, strings.ToUpper(operation), tracing.KindClient)
+	span.SetAttribute("db.system", db.dialect.name())
+	span.SetAttribute("db.operation", strings.ToUpper(operation))
+	span.SetAttribute("db.statement", statement)
+	return span
+}
+
+// end finishes a span started by start(), if there is one.
+func end(span *tracing.Span, err error) {
+	if span != nil {
+		span.SetError(err)
+		span.End()
+	}
+}
+
+func (db dbConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	span := db.start(ctx, query)
+	result, err := db.pool.ExecContext(ctx, query, args...)
+	end(span, err)
+	return result, err
+}
+
+func (db dbConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	span := db.start(ctx, query)
+	rows, err := db.pool.QueryContext(ctx, query, args...)
+	end(span, err)
+	return rows, err
+}
+
+func (db dbConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	span := db.start(ctx, query)
+	row := db.pool.QueryRowContext(ctx, query, args...)
+	// Err() reports whether the query failed. It never returns sql.ErrNoRows, which only
+	// comes from Scan().
+	end(span, row.Err())
+	return row
+}
+
+func (db dbConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return db.pool.BeginTx(ctx, opts)
+}
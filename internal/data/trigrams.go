@@ -0,0 +1,63 @@
+package data
+
+// trigrams returns the trigrams of text in order, the way pg_trgm makes them: each word
+// is lower-cased and padded with two spaces in front and one behind, so "cat" gives
+// "  c", " ca", "cat" and "at ".
+func trigrams(text string) []string {
+	var result []string
+	for _, word := range textWords(text) {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			result = append(result, string(runes[i:i+3]))
+		}
+	}
+	return result
+}
+
+// wordSimilarity works like pg_trgm's word_similarity(query, text): it returns how
+// similar the trigrams of query are to those of the most similar stretch of text, from 0
+// to 1, so that a misspelt word still scores well against a long title containing the
+// word. The SQLite driver registers it as word_similarity().
+func wordSimilarity(query, text string) float64 {
+	want := make(map[string]bool)
+	for _, t := range trigrams(query) {
+		want[t] = true
+	}
+	if len(want) == 0 {
+		return 0
+	}
+
+	have := trigrams(text)
+	best := 0.0
+	for start := range have {
+		seen := make(map[string]bool)
+		shared := 0
+		for _, t := range have[start:] {
+			if seen[t] {
+				continue
+			}
+			seen[t] = true
+			if want[t] {
+				shared++
+			}
+			// The similarity of the two sets of trigrams: those they share out of all of
+			// them.
+			similarity := float64(shared) / float64(len(want)+len(seen)-shared)
+			if similarity > best {
+				best = similarity
+			}
+		}
+	}
+	return best
+}
+
+// similarWords reports whether word is similar enough to one of the words of query,
+// for highlighting the words that fuzzy matching found.
+func similarWords(word, query string, threshold float64) bool {
+	for _, want := range textWords(query) {
+		if wordSimilarity(want, word) >= threshold {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at a time.
+const recoveryCodeCount = 10
+
+var ErrTwoFactorEnabled = errors.New("two-factor authentication already enabled")
+
+// TwoFactor is a user's TOTP enrolment. The secret has to be kept in the clear, since
+// it is needed to work out the expected codes.
+type TwoFactor struct {
+	UserID    int64
+	CreatedAt time.Time
+	Secret    string
+	// Confirmed is set once the user has proved that their authenticator app works by
+	// sending a code from it. Until then the enrolment isn't used.
+	Confirmed bool
+}
+
+// Define a TwoFactorModel struct type which wraps a sql.DB connection pool.
+type TwoFactorModel struct {
+	DB dbConn
+}
+
+// Enroll stores a new, unconfirmed TOTP secret for a user, replacing any earlier
+// enrolment that was never confirmed. It returns ErrTwoFactorEnabled if the user already
+// has two-factor authentication set up.
+func (m TwoFactorModel) Enroll(ctx context.Context, userID int64, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, created_at = NOW(), last_step = 0
+		WHERE NOT user_totp.confirmed`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+// Get returns a user's TOTP enrolment, or ErrRecordNotFound if they haven't started one.
+func (m TwoFactorModel) Get(ctx context.Context, userID int64) (*TwoFactor, error) {
+	query := `
+		SELECT user_id, created_at, secret, confirmed
+		FROM user_totp
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var twoFactor TwoFactor
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&twoFactor.UserID,
+		&twoFactor.CreatedAt,
+		&twoFactor.Secret,
+		&twoFactor.Confirmed,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &twoFactor, nil
+}
+
+// Confirm marks a user's enrolment as confirmed and gives them a fresh set of recovery
+// codes, whose plaintexts are returned.
+func (m TwoFactorModel) Confirm(ctx context.Context, userID int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE user_totp
+		SET confirmed = true
+		WHERE user_id = $1`
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// UseStep records that the code for the given time step has been accepted. It returns
+// false if a code from that step (or a later one) was already used, so that a code that
+// has been seen once can't be replayed.
+func (m TwoFactorModel) UseStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp
+		SET last_step = $2
+		WHERE user_id = $1 AND last_step < $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// Delete turns two-factor authentication off for a user. Their recovery codes go with it,
+// and so does the setting that requires it.
+func (m TwoFactorModel) Delete(ctx context.Context, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM user_totp WHERE user_id = $1`,
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`UPDATE user_settings SET require_two_factor = false WHERE user_id = $1`,
+	} {
+		_, err = tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// NewRecoveryCodes replaces a user's recovery codes with a fresh set and returns their
+// plaintexts. Only hashes are stored, so this is the only time they can be shown.
+func (m TwoFactorModel) NewRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// UseRecoveryCode checks a recovery code and marks it as used. It returns false if the code
+// is wrong or has been used before.
+func (m TwoFactorModel) UseRecoveryCode(ctx context.Context, userID int64, code string) (bool, error) {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, hashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64) ([]string, error) {
+	_, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		random := make([]byte, 5)
+		_, err := rand.Read(random)
+		if err != nil {
+			return nil, err
+		}
+		// Eight base32 characters, shown as two groups of four to make them easier to copy.
+		code := base32.StdEncoding.EncodeToString(random)
+		codes[i] = code[:4] + "-" + code[4:]
+
+		query := `
+			INSERT INTO recovery_codes (user_id, hash)
+			VALUES ($1, $2)`
+		_, err = tx.ExecContext(ctx, query, userID, hashRecoveryCode(codes[i]))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode hashes a recovery code for storage. Codes are compared without the
+// separator and regardless of case, since people tend to type them in by hand.
+func hashRecoveryCode(code string) []byte {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
@@ -5,8 +5,10 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/zarinakolybaeva/DoMake/internal/validator"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"time"
 )
 
@@ -25,13 +27,15 @@ var AnonymousUser = &User{}
 //
 // Also notice that the Password field uses the custom password type defined below.
 type User struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Name        string    `json:"name"`
+	Email       string    `json:"email"`
+	Password    password  `json:"-"`
+	Activated   bool      `json:"activated"`
+	Deactivated bool      `json:"deactivated"` // Locked out by an admin; activating the account again doesn't clear it
+	Timezone    string    `json:"timezone"`    // IANA name, such as Europe/Moscow; empty for the server's default
+	Version     int       `json:"-"`
 }
 
 // Check if a User instance is the AnonymousUser.
@@ -88,11 +92,22 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
 	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
 }
+
+// ValidateTimezone checks that a time zone is either empty, meaning the server's default,
+// or the IANA name of a zone known to the server.
+func ValidateTimezone(v *validator.Validator, timezone string) {
+	if timezone == "" {
+		return
+	}
+	_, err := LoadZone(timezone)
+	v.Check(err == nil && timezone != "Local", "timezone", "must be an IANA time zone name, such as Europe/Moscow")
+}
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Name != "", "name", "must be provided")
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
 	// Call the standalone ValidateEmail() helper.
 	ValidateEmail(v, user.Email)
+	ValidateTimezone(v, user.Timezone)
 	// If the plaintext password is not nil, call the standalone
 	// ValidatePasswordPlaintext() helper.
 	if user.Password.plaintext != nil {
@@ -109,20 +124,20 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 // Create a UserModel struct which wraps the connection pool.
 type UserModel struct {
-	DB *sql.DB
+	DB dbConn
 }
 
 // Insert a new record in the database for the user. Note that the id, created_at and
 // version fields are all automatically generated by our database, so we use the
 // RETURNING clause to read them into the User struct after the insert, in the same way
 // that we did when creating a movie.
-func (m UserModel) Insert(user *User) error {
+func (m UserModel) Insert(ctx context.Context, user *User) error {
 	query := `
-		INSERT INTO users (name, email, password_hash, activated)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (name, email, password_hash, activated, timezone)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at, version`
-	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated, user.Timezone}
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
 	// If the table already contains a record with this email address, then when we try
 	// to perform the insert there will be a violation of the UNIQUE "users_email_key"
@@ -131,7 +146,7 @@ func (m UserModel) Insert(user *User) error {
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		case m.DB.dialect.isUniqueViolation(err, "users_email_key"):
 			return ErrDuplicateEmail
 		default:
 			return err
@@ -143,13 +158,13 @@ func (m UserModel) Insert(user *User) error {
 // Retrieve the User details from the database based on the user's email address.
 // Because we have a UNIQUE constraint on the email column, this SQL query will only
 // return one record (or none at all, in which case we return a ErrRecordNotFound error).
-func (m UserModel) GetByEmail(email string) (*User, error) {
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, deactivated, timezone, version
 		FROM users
 		WHERE email = $1`
 	var user User
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
 	err := m.DB.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
@@ -158,6 +173,8 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Deactivated,
+		&user.Timezone,
 		&user.Version,
 	)
 	if err != nil {
@@ -171,31 +188,165 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// Get returns the user with the given ID.
+func (m UserModel) Get(ctx context.Context, id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, deactivated, timezone, version
+		FROM users
+		WHERE id = $1`
+	var user User
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Deactivated,
+		&user.Timezone,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// GetMany retrieves the users with the given IDs in a single query, keyed by ID. IDs
+// that don't exist are left out.
+func (m UserModel) GetMany(ctx context.Context, ids []int64) (map[int64]*User, error) {
+	users := make(map[int64]*User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, deactivated, timezone, version
+		FROM users
+		WHERE ` + m.DB.dialect.anyOf("id", "$1")
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, m.DB.dialect.array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.hash,
+			&user.Activated,
+			&user.Deactivated,
+			&user.Timezone,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users[user.ID] = &user
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// UserFilters narrows down the users returned by GetAll(). Only the fields that are set
+// are applied.
+type UserFilters struct {
+	Search      string // Part of the name or email address, case-insensitively.
+	Activated   *bool
+	Deactivated *bool
+	Role        string // Only users with this account role.
+}
+
+// GetAll returns a page of users matching the filters, for the admin API.
+func (m UserModel) GetAll(ctx context.Context, uf UserFilters, filters Filters) ([]*User, Metadata, error) {
+	where := &whereClause{}
+	if uf.Search != "" {
+		search := where.arg("%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(uf.Search) + "%")
+		where.add("(" + m.DB.dialect.ilike("name", search) + " OR " + m.DB.dialect.ilike("email", search) + ")")
+	}
+	if uf.Activated != nil {
+		where.add("activated = " + where.arg(*uf.Activated))
+	}
+	if uf.Deactivated != nil {
+		where.add("deactivated = " + where.arg(*uf.Deactivated))
+	}
+	if uf.Role != "" {
+		where.add(`id IN (
+			SELECT users_roles.user_id
+			FROM users_roles
+			INNER JOIN roles ON roles.id = users_roles.role_id
+			WHERE roles.name = ` + where.arg(uf.Role) + `)`)
+	}
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, email, activated, deactivated, timezone, version
+		FROM users
+		WHERE %s
+		ORDER BY %s %s, id ASC
+		LIMIT %s OFFSET %s`, where, filters.sortColumn(), filters.sortDirection(), where.arg(filters.limit()), where.arg(filters.offset()))
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	totalRecords := 0
+	users := []*User{}
+	err := queryEach(ctx, m.DB, query, where.args, func(rows *sql.Rows) error {
+		var user User
+		err := rows.Scan(&totalRecords, &user.ID, &user.CreatedAt, &user.Name, &user.Email, &user.Activated, &user.Deactivated, &user.Timezone, &user.Version)
+		users = append(users, &user)
+		return err
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return users, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
 // Update the details for a specific user. Notice that we check against the version
 // field to help prevent any race conditions during the request cycle, just like we did
 // when updating a movie. And we also check for a violation of the "users_email_key"
 // constraint when performing the update, just like we did when inserting the user
 // record originally.
-func (m UserModel) Update(user *User) error {
+func (m UserModel) Update(ctx context.Context, user *User) error {
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET name = $1, email = $2, password_hash = $3, activated = $4, deactivated = $5, timezone = $6, version = version + 1
+		WHERE id = $7 AND version = $8
 		RETURNING version`
 	args := []interface{}{
 		user.Name,
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Deactivated,
+		user.Timezone,
 		user.ID,
 		user.Version,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+		case m.DB.dialect.isUniqueViolation(err, "users_email_key"):
 			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
@@ -206,13 +357,13 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
-func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+func (m UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
 	// Calculate the SHA-256 hash of the plaintext token provided by the client.
 	// Remember that this returns a byte *array* with length 32, not a slice.
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	// Set up the SQL query.
 	query := `
-SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.deactivated, users.timezone, users.version
 FROM users
 INNER JOIN tokens
 ON users.id = tokens.user_id
@@ -225,7 +376,7 @@ AND tokens.expiry > $3`
 	// value to check against the token expiry.
 	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
 	var user User
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
 	defer cancel()
 	// Execute the query, scanning the return values into a User struct. If no matching
 	// record is found we return an ErrRecordNotFound error.
@@ -236,6 +387,8 @@ AND tokens.expiry > $3`
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Deactivated,
+		&user.Timezone,
 		&user.Version,
 	)
 	if err != nil {
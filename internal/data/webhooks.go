@@ -0,0 +1,371 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/egress"
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// Define the task lifecycle events that webhooks can subscribe to.
+const (
+	EventTaskCreated   = "task.created"
+	EventTaskUpdated   = "task.updated"
+	EventTaskDeleted   = "task.deleted"
+	EventTaskCompleted = "task.completed"
+)
+
+var WebhookEvents = []string{EventTaskCreated, EventTaskUpdated, EventTaskDeleted, EventTaskCompleted}
+
+// Define the delivery states recorded in the webhook_deliveries table.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// MaxDeliveryAttempts is how many times a delivery is tried before it is marked failed.
+const MaxDeliveryAttempts = 8
+
+// Webhook is a URL that the server POSTs task events to. The secret is used to sign
+// each payload so that the receiver can check it came from us; it is only shown to the
+// client once, when the webhook is created.
+type Webhook struct {
+	ID        int64      `json:"id"`
+	CreatedAt CustomTime `json:"created_at"`
+	UserID    int64      `json:"-"`
+	URL       string     `json:"url"`
+	Secret    string     `json:"-"`
+	Events    []string   `json:"events"`
+	Active    bool       `json:"active"`
+	Version   int32      `json:"version"`
+}
+
+// WebhookDelivery is one event queued for (or delivered to) one webhook.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	CreatedAt      CustomTime      `json:"created_at"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  CustomTime      `json:"next_attempt_at"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	DeliveredAt    *CustomTime     `json:"delivered_at,omitempty"`
+	URL            string          `json:"-"`
+	Secret         string          `json:"-"`
+	UserID         int64           `json:"-"`
+}
+
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	v.Check(webhook.URL != "", "url", "must be provided")
+	v.Check(len(webhook.URL) <= 2000, "url", "must not be more than 2000 bytes long")
+	if webhook.URL != "" {
+		u, err := url.Parse(webhook.URL)
+		v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+		v.Check(err != nil || egress.IsPublicHost(u.Hostname()), "url", "must not point to a private or local address")
+	}
+	v.Check(len(webhook.Secret) >= 16, "secret", "must be at least 16 bytes long")
+	v.Check(len(webhook.Secret) <= 200, "secret", "must not be more than 200 bytes long")
+	v.Check(len(webhook.Events) > 0, "events", "must contain at least one event")
+	v.Check(validator.Unique(webhook.Events), "events", "must not contain duplicate values")
+	for _, event := range webhook.Events {
+		v.Check(validator.In(event, WebhookEvents...), "events", "must only contain "+strings.Join(WebhookEvents, ", "))
+	}
+}
+
+// GenerateWebhookSecret returns a random secret for clients that don't choose their own.
+func GenerateWebhookSecret() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
+
+// Define a WebhookModel struct type which wraps a sql.DB connection pool.
+type WebhookModel struct {
+	DB dbConn
+}
+
+// Insert a new webhook.
+func (m WebhookModel) Insert(ctx context.Context, webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (user_id, url, secret, events)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, active, version`
+	args := []interface{}{webhook.UserID, webhook.URL, webhook.Secret, m.DB.dialect.array(webhook.Events)}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.Active, &webhook.Version)
+}
+
+// Get fetches a specific webhook belonging to a user.
+func (m WebhookModel) Get(ctx context.Context, id int64, userID int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, user_id, url, secret, events, active, version
+		FROM webhooks
+		WHERE id = $1 AND user_id = $2`
+	var webhook Webhook
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&webhook.ID,
+		&webhook.CreatedAt,
+		&webhook.UserID,
+		&webhook.URL,
+		&webhook.Secret,
+		m.DB.dialect.array(&webhook.Events),
+		&webhook.Active,
+		&webhook.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &webhook, nil
+}
+
+// GetAllForUser returns all of a user's webhooks, oldest first.
+func (m WebhookModel) GetAllForUser(ctx context.Context, userID int64) ([]*Webhook, error) {
+	query := `
+		SELECT id, created_at, user_id, url, secret, events, active, version
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.CreatedAt,
+			&webhook.UserID,
+			&webhook.URL,
+			&webhook.Secret,
+			m.DB.dialect.array(&webhook.Events),
+			&webhook.Active,
+			&webhook.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// Update changes a webhook's URL, events and active flag, using the version number to
+// detect concurrent edits.
+func (m WebhookModel) Update(ctx context.Context, webhook *Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET url = $1, events = $2, active = $3, version = version + 1
+		WHERE id = $4 AND user_id = $5 AND version = $6
+		RETURNING version`
+	args := []interface{}{webhook.URL, m.DB.dialect.array(webhook.Events), webhook.Active, webhook.ID, webhook.UserID, webhook.Version}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete a webhook belonging to a user, along with its delivery log.
+func (m WebhookModel) Delete(ctx context.Context, id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Enqueue queues an event for delivery to every active webhook of the user that is
+// subscribed to it.
+func (m WebhookModel) Enqueue(ctx context.Context, userID int64, event string, payload []byte) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $2, $3
+		FROM webhooks
+		WHERE user_id = $1 AND active AND ` + m.DB.dialect.anyOf("$2", "events")
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, event, string(payload))
+	return err
+}
+
+// GetDueDeliveries returns pending deliveries whose next attempt is due, oldest first,
+// along with the URL and secret of their webhook.
+func (m WebhookModel) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT webhook_deliveries.id, webhook_deliveries.created_at, webhook_deliveries.webhook_id,
+			webhook_deliveries.event, webhook_deliveries.payload, webhook_deliveries.status,
+			webhook_deliveries.attempts, webhook_deliveries.next_attempt_at,
+			webhook_deliveries.last_status_code, webhook_deliveries.last_error,
+			webhook_deliveries.delivered_at, webhooks.url, webhooks.secret, webhooks.user_id
+		FROM webhook_deliveries
+		INNER JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id
+		WHERE webhook_deliveries.status = 'pending' AND webhook_deliveries.next_attempt_at <= $1
+		ORDER BY webhook_deliveries.next_attempt_at ASC, webhook_deliveries.id ASC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		dest := append(delivery.scanDest(), &delivery.URL, &delivery.Secret, &delivery.UserID)
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (delivery *WebhookDelivery) scanDest() []interface{} {
+	return []interface{}{
+		&delivery.ID,
+		&delivery.CreatedAt,
+		&delivery.WebhookID,
+		&delivery.Event,
+		(*[]byte)(&delivery.Payload),
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.DeliveredAt,
+	}
+}
+
+// RecordAttempt saves the outcome of an attempt to deliver an event. The caller sets
+// Status, LastStatusCode, LastError and NextAttemptAt; the attempt counter is bumped here.
+func (m WebhookModel) RecordAttempt(ctx context.Context, delivery *WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, next_attempt_at = $2, last_status_code = $3, last_error = $4,
+			delivered_at = CASE WHEN $1 = 'succeeded' THEN NOW() END
+		WHERE id = $5
+		RETURNING attempts, delivered_at`
+	args := []interface{}{delivery.Status, delivery.NextAttemptAt, delivery.LastStatusCode, delivery.LastError, delivery.ID}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&delivery.Attempts, &delivery.DeliveredAt)
+}
+
+// GetDeliveries returns a page of a webhook's delivery log.
+func (m WebhookModel) GetDeliveries(ctx context.Context, webhookID int64, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, webhook_id, event, payload, status, attempts,
+			next_attempt_at, last_status_code, last_error, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY %s %s, id DESC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		dest := append([]interface{}{&totalRecords}, delivery.scanDest()...)
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return deliveries, metadata, nil
+}
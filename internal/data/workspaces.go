@@ -0,0 +1,525 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/zarinakolybaeva/DoMake/internal/validator"
+)
+
+// The roles a user can have in a workspace. Viewers can only read the workspace's tasks,
+// members can change them as well, and owners can also manage the workspace itself and
+// its members.
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
+var WorkspaceRoles = []string{RoleOwner, RoleMember, RoleViewer}
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleMember: 2, RoleOwner: 3}
+
+// RoleAllows reports whether a member with the given role can do what needs the required
+// role.
+func RoleAllows(role, required string) bool {
+	return roleRanks[role] >= roleRanks[required]
+}
+
+var (
+	ErrAlreadyMember     = errors.New("already a member")
+	ErrLastOwner         = errors.New("last owner")
+	ErrPersonalWorkspace = errors.New("personal workspace")
+)
+
+// ScopeInvitation is the scope of the tokens sent to invited users. Invitations are kept
+// in their own table rather than with the other tokens, since they aren't tied to a user.
+const ScopeInvitation = "invitation"
+
+// Workspace groups the tasks and categories shared by its members.
+type Workspace struct {
+	ID        int64      `json:"id"`
+	CreatedAt CustomTime `json:"created_at"`
+	Name      string     `json:"name"`
+	Personal  bool       `json:"personal"`
+	// Role is the current user's role in the workspace.
+	Role    string `json:"role"`
+	Version int32  `json:"version"`
+}
+
+// Member is a user's membership of a workspace.
+type Member struct {
+	WorkspaceID int64      `json:"-"`
+	UserID      int64      `json:"user_id"`
+	Name        string     `json:"name"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`
+	CreatedAt   CustomTime `json:"joined_at"`
+	AvatarURL   *string    `json:"avatar_url"`
+}
+
+// Invitation lets the user with the given email address join a workspace. Only the hash
+// of the token is stored, like for the other tokens.
+type Invitation struct {
+	Plaintext   string    `json:"token"`
+	Hash        []byte    `json:"-"`
+	WorkspaceID int64     `json:"workspace_id"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	InvitedBy   int64     `json:"-"`
+	Expiry      time.Time `json:"expiry"`
+}
+
+func ValidateWorkspace(v *validator.Validator, workspace *Workspace) {
+	v.Check(strings.TrimSpace(workspace.Name) != "", "name", "must be provided")
+	v.Check(len(workspace.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+func ValidateRole(v *validator.Validator, role string) {
+	v.Check(validator.In(role, WorkspaceRoles...), "role", "must be one of "+strings.Join(WorkspaceRoles, ", "))
+}
+
+// Define a WorkspaceModel struct type which wraps a sql.DB connection pool.
+type WorkspaceModel struct {
+	DB dbConn
+}
+
+// Insert creates a workspace with the given user as its owner. A personal workspace is
+// tied to its owner, who can only have one.
+func (m WorkspaceModel) Insert(ctx context.Context, workspace *Workspace, ownerID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var personalUserID *int64
+	if workspace.Personal {
+		personalUserID = &ownerID
+	}
+	query := `
+		INSERT INTO workspaces (name, personal_user_id)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+	err = tx.QueryRowContext(ctx, query, workspace.Name, personalUserID).Scan(&workspace.ID, &workspace.CreatedAt, &workspace.Version)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO workspace_members (workspace_id, user_id, role)
+		VALUES ($1, $2, $3)`
+	_, err = tx.ExecContext(ctx, query, workspace.ID, ownerID, RoleOwner)
+	if err != nil {
+		return err
+	}
+	workspace.Role = RoleOwner
+
+	return tx.Commit()
+}
+
+const workspaceColumns = `workspaces.id, workspaces.created_at, workspaces.name,
+	workspaces.personal_user_id IS NOT NULL, workspace_members.role, workspaces.version`
+
+func (workspace *Workspace) scanDest() []interface{} {
+	return []interface{}{
+		&workspace.ID,
+		&workspace.CreatedAt,
+		&workspace.Name,
+		&workspace.Personal,
+		&workspace.Role,
+		&workspace.Version,
+	}
+}
+
+// GetForUser returns a workspace along with the user's role in it. A workspace the user
+// isn't a member of is reported as ErrRecordNotFound.
+func (m WorkspaceModel) GetForUser(ctx context.Context, id int64, userID int64) (*Workspace, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + workspaceColumns + `
+		FROM workspaces
+		INNER JOIN workspace_members ON workspace_members.workspace_id = workspaces.id
+		WHERE workspaces.id = $1 AND workspace_members.user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var workspace Workspace
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(workspace.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &workspace, nil
+}
+
+// GetAllForUser returns the workspaces a user is a member of, personal workspace first.
+func (m WorkspaceModel) GetAllForUser(ctx context.Context, userID int64) ([]*Workspace, error) {
+	query := `
+		SELECT ` + workspaceColumns + `
+		FROM workspaces
+		INNER JOIN workspace_members ON workspace_members.workspace_id = workspaces.id
+		WHERE workspace_members.user_id = $1
+		ORDER BY workspaces.personal_user_id IS NULL, workspaces.name, workspaces.id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	workspaces := []*Workspace{}
+	err := queryEach(ctx, m.DB, query, []interface{}{userID}, func(rows *sql.Rows) error {
+		var workspace Workspace
+		err := rows.Scan(workspace.scanDest()...)
+		workspaces = append(workspaces, &workspace)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return workspaces, nil
+}
+
+// Update renames a workspace, using the version number to detect concurrent edits.
+func (m WorkspaceModel) Update(ctx context.Context, workspace *Workspace) error {
+	query := `
+		UPDATE workspaces
+		SET name = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, workspace.Name, workspace.ID, workspace.Version).Scan(&workspace.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes a shared workspace along with all of its tasks and categories. Personal
+// workspaces can't be deleted.
+func (m WorkspaceModel) Delete(ctx context.Context, id int64) error {
+	query := `
+		DELETE FROM workspaces
+		WHERE id = $1 AND personal_user_id IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPersonalWorkspace
+	}
+	return nil
+}
+
+// GetPersonalID returns the ID of a user's personal workspace, which is used when a
+// request doesn't say which workspace it is for.
+func (m WorkspaceModel) GetPersonalID(ctx context.Context, userID int64) (int64, error) {
+	query := `
+		SELECT id
+		FROM workspaces
+		WHERE personal_user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+const memberColumns = `workspace_members.workspace_id, workspace_members.user_id, users.name, users.email,
+	workspace_members.role, workspace_members.created_at, avatars.updated_at`
+
+func (member *Member) scanDest() []interface{} {
+	return []interface{}{
+		&member.WorkspaceID,
+		&member.UserID,
+		&member.Name,
+		&member.Email,
+		&member.Role,
+		&member.CreatedAt,
+		avatarURLDest{userID: &member.UserID, url: &member.AvatarURL},
+	}
+}
+
+// GetMember returns a user's membership of a workspace, or ErrRecordNotFound if they
+// aren't a member.
+func (m WorkspaceModel) GetMember(ctx context.Context, workspaceID int64, userID int64) (*Member, error) {
+	query := `
+		SELECT ` + memberColumns + `
+		FROM workspace_members
+		INNER JOIN users ON users.id = workspace_members.user_id
+		` + avatarJoin + `
+		WHERE workspace_members.workspace_id = $1 AND workspace_members.user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var member Member
+	err := m.DB.QueryRowContext(ctx, query, workspaceID, userID).Scan(member.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &member, nil
+}
+
+// GetMembers returns the members of a workspace, owners first.
+func (m WorkspaceModel) GetMembers(ctx context.Context, workspaceID int64) ([]*Member, error) {
+	query := `
+		SELECT ` + memberColumns + `
+		FROM workspace_members
+		INNER JOIN users ON users.id = workspace_members.user_id
+		` + avatarJoin + `
+		WHERE workspace_members.workspace_id = $1
+		ORDER BY workspace_members.role = 'owner' DESC, users.name, users.id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	members := []*Member{}
+	err := queryEach(ctx, m.DB, query, []interface{}{workspaceID}, func(rows *sql.Rows) error {
+		var member Member
+		err := rows.Scan(member.scanDest()...)
+		members = append(members, &member)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// GetMemberIDs returns the IDs of the users who are members of a workspace, for sending
+// them its events.
+func (m WorkspaceModel) GetMemberIDs(ctx context.Context, workspaceID int64) ([]int64, error) {
+	query := `
+		SELECT user_id
+		FROM workspace_members
+		WHERE workspace_id = $1
+		ORDER BY user_id`
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	var userIDs []int64
+	err := queryEach(ctx, m.DB, query, []interface{}{workspaceID}, func(rows *sql.Rows) error {
+		var userID int64
+		err := rows.Scan(&userID)
+		userIDs = append(userIDs, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+// SetMemberRole changes a member's role. It returns ErrLastOwner rather than leave the
+// workspace without an owner.
+func (m WorkspaceModel) SetMemberRole(ctx context.Context, workspaceID int64, userID int64, role string) error {
+	return m.changeMember(ctx, workspaceID, userID, role)
+}
+
+// RemoveMember takes a user out of a workspace. It returns ErrLastOwner rather than leave
+// the workspace without an owner.
+func (m WorkspaceModel) RemoveMember(ctx context.Context, workspaceID int64, userID int64) error {
+	return m.changeMember(ctx, workspaceID, userID, "")
+}
+
+// changeMember sets a member's role, or removes them if role is empty.
+func (m WorkspaceModel) changeMember(ctx context.Context, workspaceID int64, userID int64, role string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the owners first, so that two owners can't demote each other at the same time.
+	owners := map[int64]bool{}
+	query := `
+		SELECT user_id
+		FROM workspace_members
+		WHERE workspace_id = $1 AND role = 'owner'
+		FOR UPDATE`
+	err = queryEach(ctx, tx, query, []interface{}{workspaceID}, func(rows *sql.Rows) error {
+		var id int64
+		err := rows.Scan(&id)
+		owners[id] = true
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if owners[userID] && len(owners) == 1 && role != RoleOwner {
+		return ErrLastOwner
+	}
+
+	if role == "" {
+		query = `
+			DELETE FROM workspace_members
+			WHERE workspace_id = $1 AND user_id = $2`
+		_, err = tx.ExecContext(ctx, query, workspaceID, userID)
+	} else {
+		query = `
+			UPDATE workspace_members
+			SET role = $3
+			WHERE workspace_id = $1 AND user_id = $2`
+		_, err = tx.ExecContext(ctx, query, workspaceID, userID, role)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// NewInvitation creates an invitation to a workspace for an email address. Inviting the
+// same address again replaces the earlier invitation.
+func (m WorkspaceModel) NewInvitation(ctx context.Context, workspaceID int64, email string, role string, invitedBy int64, ttl time.Duration) (*Invitation, error) {
+	token, err := generateToken(invitedBy, ttl, ScopeInvitation)
+	if err != nil {
+		return nil, err
+	}
+	invitation := &Invitation{
+		Plaintext:   token.Plaintext,
+		Hash:        token.Hash,
+		WorkspaceID: workspaceID,
+		Email:       email,
+		Role:        role,
+		InvitedBy:   invitedBy,
+		Expiry:      token.Expiry,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM workspace_members
+			INNER JOIN users ON users.id = workspace_members.user_id
+			WHERE workspace_members.workspace_id = $1 AND users.email = $2
+		)`
+	var member bool
+	err = tx.QueryRowContext(ctx, query, workspaceID, email).Scan(&member)
+	if err != nil {
+		return nil, err
+	}
+	if member {
+		return nil, ErrAlreadyMember
+	}
+
+	query = `
+		DELETE FROM workspace_invitations
+		WHERE workspace_id = $1 AND email = $2`
+	_, err = tx.ExecContext(ctx, query, workspaceID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO workspace_invitations (hash, workspace_id, email, role, invited_by, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	args := []interface{}{invitation.Hash, workspaceID, email, role, invitedBy, invitation.Expiry}
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return invitation, tx.Commit()
+}
+
+// AcceptInvitation adds a user to the workspace they were invited to. The invitation
+// must be for the user's email address and must not have expired; otherwise
+// ErrRecordNotFound is returned.
+func (m WorkspaceModel) AcceptInvitation(ctx context.Context, tokenPlaintext string, user *User) (*Member, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(ctx, m.DB.timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM workspace_invitations
+		WHERE hash = $1 AND email = $2 AND expiry > $3
+		RETURNING workspace_id, role`
+	member := Member{UserID: user.ID, Name: user.Name, Email: user.Email}
+	err = tx.QueryRowContext(ctx, query, hash[:], user.Email, time.Now()).Scan(&member.WorkspaceID, &member.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		INSERT INTO workspace_members (workspace_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (workspace_id, user_id) DO NOTHING
+		RETURNING created_at`
+	err = tx.QueryRowContext(ctx, query, member.WorkspaceID, user.ID, member.Role).Scan(&member.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrAlreadyMember
+		default:
+			return nil, err
+		}
+	}
+	return &member, tx.Commit()
+}
@@ -0,0 +1,96 @@
+// Package egress makes HTTP requests to URLs that users choose, such as webhooks, without
+// letting them reach the server's own network: loopback, private, link-local and other
+// addresses that aren't on the public internet are refused.
+package egress
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrNonPublicAddress is returned when a request would connect to an address that isn't
+// on the public internet.
+var ErrNonPublicAddress = errors.New("egress: refusing to connect to a non-public address")
+
+// nonPublicPrefixes are the ranges that netip.Addr has no method for: shared address
+// space for carrier-grade NAT, "this network", benchmarking, documentation, NAT64 and the
+// ranges reserved for future use.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// IsPublic reports whether addr is on the public internet.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPublicHost reports whether the host of a URL may be on the public internet. Names
+// other than localhost can't be told apart before they are resolved, so only IP
+// addresses and localhost are refused here; the client returned by NewClient checks the
+// addresses the names resolve to.
+func IsPublicHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return IsPublic(addr)
+	}
+	return true
+}
+
+// NewClient returns an HTTP client that only connects to public addresses. The check is
+// made on the address being dialled, after DNS resolution, so that a name can't resolve
+// to a private address. Redirects aren't followed, since they could lead anywhere, and
+// proxies from the environment aren't used, since the check would apply to the proxy.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   control,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// control is called with the resolved address of each connection before it is made.
+func control(network, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil || !IsPublic(addrPort.Addr()) {
+		return ErrNonPublicAddress
+	}
+	return nil
+}
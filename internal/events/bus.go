@@ -0,0 +1,109 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// subscriptionBuffer is how many events a subscriber can fall behind before new events
+// are dropped for it.
+const subscriptionBuffer = 32
+
+// Event is a change to one of a user's resources.
+type Event struct {
+	ID         uint64
+	Type       string
+	UserID     int64
+	OccurredAt time.Time
+	Data       interface{}
+}
+
+// Bus delivers events published by the handlers to the subscribers interested in them,
+// such as open event streams. Delivery is best effort: Publish never blocks, so an event
+// is dropped for a subscriber whose buffer is full.
+type Bus struct {
+	mu     sync.Mutex
+	nextID uint64
+	subs   map[int64]map[*Subscription]struct{}
+	closed bool
+}
+
+// Subscription receives the events of one user on C until it is closed.
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	userID int64
+	bus    *Bus
+	once   sync.Once
+}
+
+func New() *Bus {
+	return &Bus{subs: make(map[int64]map[*Subscription]struct{})}
+}
+
+// Publish sends an event to every subscriber of the event's user, setting its ID.
+func (b *Bus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event.ID = b.nextID
+	for sub := range b.subs[event.UserID] {
+		select {
+		case sub.c <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a subscription to a user's events. After the bus has been closed
+// the subscription's channel is closed straight away.
+func (b *Bus) Subscribe(userID int64) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	sub := &Subscription{C: c, c: c, userID: userID, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(c)
+		return sub
+	}
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[*Subscription]struct{})
+	}
+	b.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+// Close stops the subscription and closes its channel. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.close()
+}
+
+// close must be called with the bus mutex held.
+func (s *Subscription) close() {
+	s.once.Do(func() {
+		delete(s.bus.subs[s.userID], s)
+		if len(s.bus.subs[s.userID]) == 0 {
+			delete(s.bus.subs, s.userID)
+		}
+		close(s.c)
+	})
+}
+
+// Close closes every subscription, which tells long-lived consumers such as event
+// streams to finish. It is called when the server shuts down.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for _, subs := range b.subs {
+		for sub := range subs {
+			sub.close()
+		}
+	}
+}
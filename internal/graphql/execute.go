@@ -0,0 +1,490 @@
+// Package graphql implements enough of GraphQL to serve queries and mutations against
+// a schema built in code: parsing and validating requests, coercing variables and
+// arguments, and executing operations. Fields on the same level of a query are resolved
+// together, so that a Loader can fetch what they need in one batch. Interfaces, unions,
+// subscriptions and introspection are not supported.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Request is a GraphQL request, as sent in the body of a POST request.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Response is the result of a request. Data is left out if the request couldn't be
+// executed at all, e.g. because of a syntax error.
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Error is an error in a response. Resolvers can return one to add extensions, such as
+// the validation errors of a mutation.
+type Error struct {
+	Message    string                 `json:"message"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf returns an Error with a formatted message.
+func Errorf(format string, args ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}
+
+// Execute runs a request against the schema. Queries resolve the fields on each level of
+// the query together, so that loaders batch the loads of a level into one. The fields at
+// the top of a mutation are run one after the other, in the order they are given.
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{err.(*Error)}}
+	}
+
+	op, gqlErr := selectOperation(doc, req.OperationName)
+	if gqlErr != nil {
+		return &Response{Errors: []*Error{gqlErr}}
+	}
+	root := s.Query
+	switch op.Type {
+	case "mutation":
+		root = s.Mutation
+		if root == nil {
+			return &Response{Errors: []*Error{{Message: "The schema does not support mutations.", Locations: []Location{op.Location}}}}
+		}
+	case "subscription":
+		return &Response{Errors: []*Error{{Message: "The schema does not support subscriptions.", Locations: []Location{op.Location}}}}
+	}
+
+	if errs := s.validate(doc, op, root); len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+	variables, errs := s.coerceVariables(op, req.Variables)
+	if len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	e := &executor{ctx: ctx, schema: s, doc: doc, variables: variables}
+	fields := e.collectFields(root, op.SelectionSet)
+	data := newResult(fields)
+	if op.Type == "mutation" {
+		for _, field := range fields {
+			e.run([]*job{{object: root, fields: []*collectedField{field}, out: data}})
+		}
+	} else {
+		e.run([]*job{{object: root, fields: fields, out: data}})
+	}
+	return &Response{Data: data, Errors: e.errors}
+}
+
+func selectOperation(doc *Document, name string) (*Operation, *Error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, &Error{Message: "Must provide operation name if query contains multiple operations."}
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, Errorf("Unknown operation named %q.", name)
+}
+
+// coerceVariables checks the request's variables against their definitions, and fills
+// in the defaults of those that weren't given.
+func (s *Schema) coerceVariables(op *Operation, given map[string]interface{}) (map[string]interface{}, []*Error) {
+	types := s.typeMap()
+	variables := make(map[string]interface{}, len(op.Variables))
+	var errs []*Error
+	for _, def := range op.Variables {
+		t, err := inputType(types, def.Type)
+		if err != nil {
+			errs = append(errs, &Error{Message: err.Error(), Locations: []Location{def.Location}})
+			continue
+		}
+		value, ok := given[def.Name]
+		if !ok {
+			if def.Default == nil {
+				if _, required := t.(*NonNull); required {
+					errs = append(errs, &Error{Message: fmt.Sprintf("Variable \"$%s\" of required type %q was not provided.", def.Name, t), Locations: []Location{def.Location}})
+				}
+				continue
+			}
+			value = literalValue(def.Default, nil)
+		}
+		coerced, err := coerceInput(t, value, "Variable \"$"+def.Name+"\"")
+		if err != nil {
+			errs = append(errs, &Error{Message: err.Error(), Locations: []Location{def.Location}})
+			continue
+		}
+		variables[def.Name] = coerced
+	}
+	return variables, errs
+}
+
+// inputType looks up the type of a variable.
+func inputType(types map[string]Type, ref *TypeRef) (Type, error) {
+	var t Type
+	if ref.Elem != nil {
+		elem, err := inputType(types, ref.Elem)
+		if err != nil {
+			return nil, err
+		}
+		t = ListOf(elem)
+	} else {
+		t = types[ref.Name]
+		switch t.(type) {
+		case *Scalar, *Enum, *InputObject:
+		case nil:
+			return nil, fmt.Errorf("Unknown type %q.", ref.Name)
+		default:
+			return nil, fmt.Errorf("Variable type %q is not an input type.", ref.Name)
+		}
+	}
+	if ref.NonNull {
+		t = NonNullOf(t)
+	}
+	return t, nil
+}
+
+type executor struct {
+	ctx       context.Context
+	schema    *Schema
+	doc       *Document
+	variables map[string]interface{}
+	coerced   map[string]interface{}
+	errors    []*Error
+	// next holds the objects found while completing one level of the query, whose
+	// fields make up the next.
+	next []*job
+}
+
+// collectedField is a field of the response, which may have been selected more than
+// once, e.g. directly and through a fragment.
+type collectedField struct {
+	key    string
+	index  int // The position of the field in its result.
+	fields []*Field
+}
+
+// job is an object whose fields are to be resolved.
+type job struct {
+	object *Object
+	source interface{}
+	fields []*collectedField
+	out    *result
+	path   []interface{}
+}
+
+// pendingField is a field whose resolver has been called, but whose value is yet to be
+// completed.
+type pendingField struct {
+	value interface{}
+	err   error
+	typ   Type
+	field *collectedField
+	path  []interface{}
+	set   func(value interface{})
+}
+
+// run resolves the fields of the jobs, and then of the objects those fields hold, one
+// level of the query at a time. All the resolvers on a level are called before any of the
+// thunks they return.
+func (e *executor) run(jobs []*job) {
+	for len(jobs) > 0 {
+		var pending []*pendingField
+		for _, j := range jobs {
+			for _, field := range j.fields {
+				pending = append(pending, e.resolve(j, field))
+			}
+		}
+
+		e.next = nil
+		for _, p := range pending {
+			if thunk, ok := p.value.(Thunk); ok && p.err == nil {
+				p.value, p.err = thunk()
+			}
+			if p.err != nil {
+				e.fieldError(p.field, p.path, p.err)
+				p.set(nil)
+				continue
+			}
+			e.complete(p.typ, p.field, p.value, p.path, p.set)
+		}
+		jobs = e.next
+	}
+}
+
+func (e *executor) resolve(j *job, field *collectedField) *pendingField {
+	path := append(append([]interface{}{}, j.path...), field.key)
+	p := &pendingField{field: field, path: path, set: func(value interface{}) {
+		j.out.values[field.index] = value
+	}}
+
+	name := field.fields[0].Name
+	if name == "__typename" {
+		p.value, p.typ = j.object.Name, NonNullOf(String)
+		return p
+	}
+	def := j.object.Fields[name]
+	p.typ = def.Type
+
+	args, err := e.arguments(def, field.fields[0])
+	if err != nil {
+		// A bad argument is the client's mistake, so PresentError shouldn't hide it.
+		p.err = &Error{Message: err.Error()}
+		return p
+	}
+	if def.Resolve == nil {
+		p.value = defaultResolve(j.source, name)
+		return p
+	}
+	p.value, p.err = def.Resolve(ResolveParams{Context: e.ctx, Source: j.source, Args: args})
+	return p
+}
+
+// arguments coerces the arguments given to a field, and fills in the defaults of those
+// that weren't.
+func (e *executor) arguments(def *FieldDef, field *Field) (map[string]interface{}, error) {
+	args := make(map[string]interface{}, len(def.Args))
+	for name, argDef := range def.Args {
+		var value interface{}
+		given := false
+		for _, arg := range field.Arguments {
+			if arg.Name != name {
+				continue
+			}
+			given = true
+			if variable, ok := arg.Value.(Variable); ok {
+				_, given = e.variables[string(variable)]
+			}
+			value = literalValue(arg.Value, e.coercedVariables())
+		}
+		if !given {
+			if argDef.Default != nil {
+				args[name] = argDef.Default
+				continue
+			}
+			if _, required := argDef.Type.(*NonNull); required {
+				return nil, fmt.Errorf("Argument %q of required type %q was not provided.", name, argDef.Type)
+			}
+			continue
+		}
+		coerced, err := coerceInput(argDef.Type, value, "Argument \""+name+"\"")
+		if err != nil {
+			return nil, err
+		}
+		args[name] = coerced
+	}
+	return args, nil
+}
+
+// complete turns a resolved value into its form in the response, according to its type.
+// Objects are added to the next level of the query.
+func (e *executor) complete(t Type, field *collectedField, value interface{}, path []interface{}, set func(interface{})) {
+	if nonNull, ok := t.(*NonNull); ok {
+		if isNil(value) {
+			e.fieldError(field, path, fmt.Errorf("Cannot return null for non-nullable field %s.", field.fields[0].Name))
+			set(nil)
+			return
+		}
+		t = nonNull.Of
+	}
+	if isNil(value) {
+		set(nil)
+		return
+	}
+
+	switch t := t.(type) {
+	case *Scalar:
+		v, err := t.Serialize(value)
+		if err != nil {
+			e.fieldError(field, path, err)
+			set(nil)
+			return
+		}
+		set(v)
+	case *Enum:
+		v := reflect.ValueOf(value)
+		name, ok := "", false
+		if v.Kind() == reflect.String {
+			name, ok = t.name(v.String())
+		}
+		if !ok {
+			e.fieldError(field, path, fmt.Errorf("Enum %q cannot represent value: %v", t.Name, value))
+			set(nil)
+			return
+		}
+		set(name)
+	case *List:
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			e.fieldError(field, path, fmt.Errorf("Expected a list for field %s.", field.fields[0].Name))
+			set(nil)
+			return
+		}
+		items := make([]interface{}, v.Len())
+		set(items)
+		for i := range items {
+			i := i
+			itemPath := append(append([]interface{}{}, path...), i)
+			e.complete(t.Of, field, v.Index(i).Interface(), itemPath, func(value interface{}) {
+				items[i] = value
+			})
+		}
+	case *Object:
+		var selections []Selection
+		for _, f := range field.fields {
+			selections = append(selections, f.SelectionSet...)
+		}
+		fields := e.collectFields(t, selections)
+		out := newResult(fields)
+		set(out)
+		e.next = append(e.next, &job{object: t, source: value, fields: fields, out: out, path: path})
+	}
+}
+
+func isNil(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
+
+func (e *executor) fieldError(field *collectedField, path []interface{}, err error) {
+	var presented *Error
+	if e.schema.PresentError != nil {
+		presented = e.schema.PresentError(e.ctx, err)
+	} else if !errors.As(err, &presented) {
+		presented = &Error{Message: err.Error()}
+	}
+	copied := *presented
+	copied.Locations = []Location{field.fields[0].Location}
+	copied.Path = path
+	e.errors = append(e.errors, &copied)
+}
+
+// collectFields lists the fields selected on an object, in order, following fragments
+// and applying @skip and @include. Fields selected more than once under the same
+// response key are merged.
+func (e *executor) collectFields(t *Object, selections []Selection) []*collectedField {
+	var fields []*collectedField
+	byKey := make(map[string]*collectedField)
+	var collect func(selections []Selection)
+	collect = func(selections []Selection) {
+		for _, selection := range selections {
+			switch sel := selection.(type) {
+			case *Field:
+				if !e.included(sel.Directives) {
+					continue
+				}
+				key := sel.ResponseKey()
+				if field, ok := byKey[key]; ok {
+					field.fields = append(field.fields, sel)
+					continue
+				}
+				field := &collectedField{key: key, index: len(fields), fields: []*Field{sel}}
+				byKey[key] = field
+				fields = append(fields, field)
+			case *InlineFragment:
+				if e.included(sel.Directives) && (sel.TypeCondition == "" || sel.TypeCondition == t.Name) {
+					collect(sel.SelectionSet)
+				}
+			case *FragmentSpread:
+				fragment := e.doc.Fragments[sel.Name]
+				if e.included(sel.Directives) && fragment.TypeCondition == t.Name {
+					collect(fragment.SelectionSet)
+				}
+			}
+		}
+	}
+	collect(selections)
+	return fields
+}
+
+// coercedVariables returns the variables marked as already coerced, for literalValue(),
+// so that coerceInput() doesn't coerce them a second time as part of an argument.
+func (e *executor) coercedVariables() map[string]interface{} {
+	if e.coerced == nil {
+		e.coerced = make(map[string]interface{}, len(e.variables))
+		for name, value := range e.variables {
+			e.coerced[name] = preCoerced{value}
+		}
+	}
+	return e.coerced
+}
+
+// included applies the @skip(if:) and @include(if:) directives.
+func (e *executor) included(directives []*Directive) bool {
+	for _, d := range directives {
+		for _, arg := range d.Arguments {
+			if arg.Name != "if" {
+				continue
+			}
+			value, _ := literalValue(arg.Value, e.variables).(bool)
+			if (d.Name == "skip" && value) || (d.Name == "include" && !value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// result is an object in the response. Its fields are kept in the order they were
+// selected in, as GraphQL requires, which a map wouldn't do.
+type result struct {
+	keys   []string
+	values []interface{}
+}
+
+func newResult(fields []*collectedField) *result {
+	r := &result{keys: make([]string, len(fields)), values: make([]interface{}, len(fields))}
+	for i, field := range fields {
+		r.keys[i] = field.key
+	}
+	return r
+}
+
+func (r *result) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,51 @@
+package graphql
+
+import "context"
+
+// Loader batches the loads of values by key, so that resolving a field of every task in a
+// list, say, takes one query rather than one per task. Load queues a key and returns a
+// Thunk; the first thunk to be forced fetches all the keys queued so far at once. Values
+// are cached for the life of the loader, which is meant to be one request. A Loader is not
+// safe for concurrent use, which the executor doesn't need.
+type Loader[K comparable, V any] struct {
+	ctx     context.Context
+	fetch   func(ctx context.Context, keys []K) (map[K]V, error)
+	queued  []K
+	results map[K]*loaderResult[V]
+}
+
+type loaderResult[V any] struct {
+	value V
+	err   error
+}
+
+// NewLoader returns a loader which fetches values with fetch. Keys missing from the map
+// fetch returns load the zero value.
+func NewLoader[K comparable, V any](ctx context.Context, fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{ctx: ctx, fetch: fetch, results: make(map[K]*loaderResult[V])}
+}
+
+// Load returns a thunk for the value of a key.
+func (l *Loader[K, V]) Load(key K) Thunk {
+	if _, ok := l.results[key]; !ok {
+		l.results[key] = nil
+		l.queued = append(l.queued, key)
+	}
+	return func() (interface{}, error) {
+		if l.results[key] == nil {
+			l.dispatch()
+		}
+		r := l.results[key]
+		return r.value, r.err
+	}
+}
+
+// dispatch fetches the queued keys.
+func (l *Loader[K, V]) dispatch() {
+	keys := l.queued
+	l.queued = nil
+	values, err := l.fetch(l.ctx, keys)
+	for _, key := range keys {
+		l.results[key] = &loaderResult[V]{value: values[key], err: err}
+	}
+}
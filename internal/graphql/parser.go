@@ -0,0 +1,632 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed GraphQL request document.
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query or a mutation.
+type Operation struct {
+	Type         string // "query" or "mutation"
+	Name         string
+	Variables    []*VariableDefinition
+	SelectionSet []Selection
+	Location     Location
+}
+
+type VariableDefinition struct {
+	Name     string
+	Type     *TypeRef
+	Default  Value
+	Location Location
+}
+
+// TypeRef is a type as written in a variable definition, such as [ID!]!.
+type TypeRef struct {
+	Name    string   // The named type, unless this is a list.
+	Elem    *TypeRef // The type of the items, if this is a list.
+	NonNull bool
+}
+
+func (t *TypeRef) String() string {
+	s := t.Name
+	if t.Elem != nil {
+		s = "[" + t.Elem.String() + "]"
+	}
+	if t.NonNull {
+		s += "!"
+	}
+	return s
+}
+
+// Selection is a *Field, *FragmentSpread or *InlineFragment.
+type Selection interface {
+	location() Location
+}
+
+type Field struct {
+	Alias        string
+	Name         string
+	Arguments    []*Argument
+	Directives   []*Directive
+	SelectionSet []Selection
+	Location     Location
+}
+
+// ResponseKey is the key of the field in the response: its alias, or else its name.
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+	Location   Location
+}
+
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	SelectionSet  []Selection
+	Location      Location
+}
+
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	SelectionSet  []Selection
+	Location      Location
+}
+
+func (f *Field) location() Location          { return f.Location }
+func (f *FragmentSpread) location() Location { return f.Location }
+func (f *InlineFragment) location() Location { return f.Location }
+
+type Argument struct {
+	Name     string
+	Value    Value
+	Location Location
+}
+
+type Directive struct {
+	Name      string
+	Arguments []*Argument
+	Location  Location
+}
+
+// Value is a literal or variable in a document: a Variable, an EnumValue, an int64, a
+// float64, a string, a bool, nil, a []Value or a map[string]Value.
+type Value interface{}
+
+// Variable is a reference to one of the operation's variables.
+type Variable string
+
+// EnumValue is an unquoted name used as a value, such as HIGH.
+type EnumValue string
+
+// Location is a position in a document, counted from 1.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Parse parses a request document.
+func Parse(source string) (doc *Document, err error) {
+	p := &parser{lexer: lexer{src: source, line: 1, col: 1}}
+	// The parser panics with a *Error at the first syntax error, which saves checking for
+	// one after every token.
+	defer func() {
+		if r := recover(); r != nil {
+			syntaxErr, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, syntaxErr
+		}
+	}()
+	p.next()
+	return p.parseDocument(), nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunctuator
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+func (k tokenKind) String() string {
+	return [...]string{"<EOF>", "punctuator", "Name", "Int", "Float", "String"}[k]
+}
+
+type token struct {
+	kind  tokenKind
+	value string
+	loc   Location
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "<EOF>"
+	case tokenPunctuator:
+		return `"` + t.value + `"`
+	}
+	return t.kind.String() + ` "` + t.value + `"`
+}
+
+type lexer struct {
+	src       string
+	pos       int
+	line, col int
+}
+
+func (l *lexer) errorf(loc Location, format string, args ...interface{}) {
+	panic(&Error{Message: "Syntax Error: " + fmt.Sprintf(format, args...), Locations: []Location{loc}})
+}
+
+func (l *lexer) advance(n int) {
+	for _, c := range l.src[l.pos : l.pos+n] {
+		if c == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+	}
+	l.pos += n
+}
+
+// skipIgnored skips white space, line terminators, commas and comments, which have no
+// meaning in GraphQL.
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.advance(1)
+		case c == '#':
+			end := strings.IndexAny(l.src[l.pos:], "\r\n")
+			if end < 0 {
+				end = len(l.src) - l.pos
+			}
+			l.advance(end)
+		case strings.HasPrefix(l.src[l.pos:], "\ufeff"):
+			// A byte order mark.
+			l.advance(len("\ufeff"))
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) next() token {
+	l.skipIgnored()
+	loc := Location{Line: l.line, Column: l.col}
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, loc: loc}
+	}
+
+	rest := l.src[l.pos:]
+	c := rest[0]
+	switch {
+	case strings.HasPrefix(rest, "..."):
+		l.advance(3)
+		return token{kind: tokenPunctuator, value: "...", loc: loc}
+	case strings.ContainsRune("!$&():=@[]{}|", rune(c)):
+		l.advance(1)
+		return token{kind: tokenPunctuator, value: string(c), loc: loc}
+	case isNameStart(c):
+		n := 1
+		for n < len(rest) && isNameContinue(rest[n]) {
+			n++
+		}
+		l.advance(n)
+		return token{kind: tokenName, value: rest[:n], loc: loc}
+	case c == '-' || isDigit(c):
+		return l.number(loc)
+	case strings.HasPrefix(rest, `"""`):
+		return l.blockString(loc)
+	case c == '"':
+		return l.string(loc)
+	}
+	r, _ := utf8.DecodeRuneInString(rest)
+	l.errorf(loc, "Unexpected character %q.", r)
+	return token{}
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameContinue(c byte) bool {
+	return isNameStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (l *lexer) number(loc Location) token {
+	rest := l.src[l.pos:]
+	n := 0
+	if rest[n] == '-' {
+		n++
+	}
+	digits := func() {
+		start := n
+		for n < len(rest) && isDigit(rest[n]) {
+			n++
+		}
+		if n == start {
+			l.errorf(loc, "Invalid number %q.", rest[:n])
+		}
+	}
+	digits()
+	kind := tokenInt
+	if n < len(rest) && rest[n] == '.' {
+		kind = tokenFloat
+		n++
+		digits()
+	}
+	if n < len(rest) && (rest[n] == 'e' || rest[n] == 'E') {
+		kind = tokenFloat
+		n++
+		if n < len(rest) && (rest[n] == '+' || rest[n] == '-') {
+			n++
+		}
+		digits()
+	}
+	if n < len(rest) && (isNameStart(rest[n]) || rest[n] == '.') {
+		l.errorf(loc, "Invalid number %q.", rest[:n+1])
+	}
+	l.advance(n)
+	return token{kind: kind, value: rest[:n], loc: loc}
+}
+
+func (l *lexer) string(loc Location) token {
+	var b strings.Builder
+	i := l.pos + 1
+	for {
+		if i >= len(l.src) || l.src[i] == '\n' || l.src[i] == '\r' {
+			l.errorf(loc, "Unterminated string.")
+		}
+		c := l.src[i]
+		if c == '"' {
+			break
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		if i+1 >= len(l.src) {
+			l.errorf(loc, "Unterminated string.")
+		}
+		switch esc := l.src[i+1]; esc {
+		case '"', '\\', '/':
+			b.WriteByte(esc)
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			if i+6 > len(l.src) {
+				l.errorf(loc, "Invalid Unicode escape sequence.")
+			}
+			code, err := strconv.ParseUint(l.src[i+2:i+6], 16, 32)
+			if err != nil {
+				l.errorf(loc, "Invalid Unicode escape sequence %q.", l.src[i:i+6])
+			}
+			b.WriteRune(rune(code))
+			i += 4
+		default:
+			l.errorf(loc, "Invalid character escape sequence \\%c.", esc)
+		}
+		i += 2
+	}
+	l.advance(i + 1 - l.pos)
+	return token{kind: tokenString, value: b.String(), loc: loc}
+}
+
+// blockString reads a """triple-quoted""" string, removing the indentation common to its
+// lines and any blank lines at its start and end.
+func (l *lexer) blockString(loc Location) token {
+	start := l.pos + 3
+	end := start
+	for {
+		i := strings.Index(l.src[end:], `"""`)
+		if i < 0 {
+			l.errorf(loc, "Unterminated string.")
+		}
+		end += i
+		if l.src[end-1] != '\\' {
+			break
+		}
+		end += 3
+	}
+	raw := strings.ReplaceAll(l.src[start:end], `\"""`, `"""`)
+	l.advance(end + 3 - l.pos)
+
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		} else {
+			lines[i] = ""
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return token{kind: tokenString, value: strings.Join(lines, "\n"), loc: loc}
+}
+
+type parser struct {
+	lexer
+	tok token
+}
+
+func (p *parser) next() {
+	p.tok = p.lexer.next()
+}
+
+func (p *parser) peek(value string) bool {
+	return p.tok.kind == tokenPunctuator && p.tok.value == value
+}
+
+func (p *parser) skip(value string) bool {
+	if p.peek(value) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(value string) {
+	if !p.skip(value) {
+		p.errorf(p.tok.loc, "Expected %q, found %s.", value, p.tok)
+	}
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokenName {
+		p.errorf(p.tok.loc, "Expected Name, found %s.", p.tok)
+	}
+	name := p.tok.value
+	p.next()
+	return name
+}
+
+func (p *parser) parseDocument() *Document {
+	doc := &Document{Fragments: make(map[string]*Fragment)}
+	for p.tok.kind != tokenEOF {
+		loc := p.tok.loc
+		switch {
+		case p.peek("{"):
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", SelectionSet: p.parseSelectionSet(), Location: loc})
+		case p.tok.kind == tokenName && (p.tok.value == "query" || p.tok.value == "mutation" || p.tok.value == "subscription"):
+			doc.Operations = append(doc.Operations, p.parseOperation())
+		case p.tok.kind == tokenName && p.tok.value == "fragment":
+			p.next()
+			fragment := &Fragment{Location: loc}
+			fragment.Name = p.name()
+			if fragment.Name == "on" {
+				p.errorf(loc, `Unexpected Name "on".`)
+			}
+			if p.name() != "on" {
+				p.errorf(loc, `Expected "on".`)
+			}
+			fragment.TypeCondition = p.name()
+			p.parseDirectives()
+			fragment.SelectionSet = p.parseSelectionSet()
+			if _, ok := doc.Fragments[fragment.Name]; ok {
+				p.errorf(loc, "There can be only one fragment named %q.", fragment.Name)
+			}
+			doc.Fragments[fragment.Name] = fragment
+		default:
+			p.errorf(p.tok.loc, "Unexpected %s.", p.tok)
+		}
+	}
+	if len(doc.Operations) == 0 {
+		p.errorf(p.tok.loc, "The document has no operations.")
+	}
+	return doc
+}
+
+func (p *parser) parseOperation() *Operation {
+	op := &Operation{Type: p.tok.value, Location: p.tok.loc}
+	p.next()
+	if p.tok.kind == tokenName {
+		op.Name = p.name()
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			def := &VariableDefinition{Location: p.tok.loc}
+			p.expect("$")
+			def.Name = p.name()
+			p.expect(":")
+			def.Type = p.parseTypeRef()
+			if p.skip("=") {
+				def.Default = p.parseValue(true)
+			}
+			p.parseDirectives()
+			op.Variables = append(op.Variables, def)
+		}
+	}
+	p.parseDirectives()
+	op.SelectionSet = p.parseSelectionSet()
+	return op
+}
+
+func (p *parser) parseTypeRef() *TypeRef {
+	var t *TypeRef
+	if p.skip("[") {
+		t = &TypeRef{Elem: p.parseTypeRef()}
+		p.expect("]")
+	} else {
+		t = &TypeRef{Name: p.name()}
+	}
+	t.NonNull = p.skip("!")
+	return t
+}
+
+func (p *parser) parseSelectionSet() []Selection {
+	p.expect("{")
+	var selections []Selection
+	for !p.skip("}") {
+		selections = append(selections, p.parseSelection())
+	}
+	if len(selections) == 0 {
+		p.errorf(p.tok.loc, "Expected a selection, found %s.", p.tok)
+	}
+	return selections
+}
+
+func (p *parser) parseSelection() Selection {
+	loc := p.tok.loc
+	if p.skip("...") {
+		if p.tok.kind == tokenName && p.tok.value != "on" {
+			return &FragmentSpread{Name: p.name(), Directives: p.parseDirectives(), Location: loc}
+		}
+		fragment := &InlineFragment{Location: loc}
+		if p.tok.kind == tokenName {
+			p.next()
+			fragment.TypeCondition = p.name()
+		}
+		fragment.Directives = p.parseDirectives()
+		fragment.SelectionSet = p.parseSelectionSet()
+		return fragment
+	}
+
+	field := &Field{Location: loc}
+	field.Name = p.name()
+	if p.skip(":") {
+		field.Alias = field.Name
+		field.Name = p.name()
+	}
+	field.Arguments = p.parseArguments()
+	field.Directives = p.parseDirectives()
+	if p.peek("{") {
+		field.SelectionSet = p.parseSelectionSet()
+	}
+	return field
+}
+
+func (p *parser) parseArguments() []*Argument {
+	var args []*Argument
+	if !p.skip("(") {
+		return nil
+	}
+	for !p.skip(")") {
+		arg := &Argument{Location: p.tok.loc}
+		arg.Name = p.name()
+		p.expect(":")
+		arg.Value = p.parseValue(false)
+		args = append(args, arg)
+	}
+	return args
+}
+
+func (p *parser) parseDirectives() []*Directive {
+	var directives []*Directive
+	for p.peek("@") {
+		loc := p.tok.loc
+		p.next()
+		directives = append(directives, &Directive{Name: p.name(), Arguments: p.parseArguments(), Location: loc})
+	}
+	return directives
+}
+
+// parseValue parses a value. Variables aren't allowed in constant values, such as the
+// defaults of variables.
+func (p *parser) parseValue(constant bool) Value {
+	tok := p.tok
+	switch tok.kind {
+	case tokenPunctuator:
+		switch tok.value {
+		case "$":
+			if constant {
+				p.errorf(tok.loc, "Unexpected variable in a constant value.")
+			}
+			p.next()
+			return Variable(p.name())
+		case "[":
+			p.next()
+			list := []Value{}
+			for !p.skip("]") {
+				list = append(list, p.parseValue(constant))
+			}
+			return list
+		case "{":
+			p.next()
+			object := map[string]Value{}
+			for !p.skip("}") {
+				name := p.name()
+				p.expect(":")
+				object[name] = p.parseValue(constant)
+			}
+			return object
+		}
+	case tokenInt:
+		p.next()
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			p.errorf(tok.loc, "Int %s is out of range.", tok.value)
+		}
+		return n
+	case tokenFloat:
+		p.next()
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			p.errorf(tok.loc, "Float %s is out of range.", tok.value)
+		}
+		return f
+	case tokenString:
+		p.next()
+		return tok.value
+	case tokenName:
+		p.next()
+		switch tok.value {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return EnumValue(tok.value)
+	}
+	p.errorf(tok.loc, "Unexpected %s.", tok)
+	return nil
+}
@@ -0,0 +1,483 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Schema is the set of types that can be queried, starting from its Query and Mutation
+// root objects.
+type Schema struct {
+	Query    *Object
+	Mutation *Object
+
+	// MaxDepth limits how deeply fields can be nested, since each level of a query like
+	// tasks { category { tasks { category ... } } } multiplies the work. Zero means no limit.
+	MaxDepth int
+
+	// PresentError turns an error returned by a resolver into the one reported to the
+	// client. It lets the application hide unexpected errors, which might reveal its
+	// internals, behind a generic message. By default the error's message is used as is.
+	PresentError func(ctx context.Context, err error) *Error
+}
+
+// Type is one of *Scalar, *Enum, *Object, *InputObject, *List and *NonNull.
+type Type interface {
+	String() string
+}
+
+// Scalar is a leaf type, such as String. Serialize turns a resolved value into its JSON
+// form, and Parse turns an argument into the Go value handed to resolvers. Parse is given
+// an int64, float64, string or bool from a literal in the query, or a value decoded from
+// the JSON variables, in which numbers are float64s, or json.Numbers if they were decoded
+// with UseNumber.
+type Scalar struct {
+	Name        string
+	Description string
+	Serialize   func(value interface{}) (interface{}, error)
+	Parse       func(value interface{}) (interface{}, error)
+}
+
+// Enum is a leaf type whose values are one of a set of names. Values maps each name to
+// the string it stands for, which is what resolvers are handed, and what they return as a
+// value of any type whose underlying type is a string.
+type Enum struct {
+	Name        string
+	Description string
+	Values      map[string]string
+}
+
+// NewEnum returns an enum of the given strings, each named in the usual GraphQL style, so
+// that "in-progress" is IN_PROGRESS.
+func NewEnum(name string, values ...string) *Enum {
+	e := &Enum{Name: name, Values: make(map[string]string, len(values))}
+	for _, value := range values {
+		valueName := strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '_'
+		}, strings.ToUpper(value))
+		e.Values[valueName] = value
+	}
+	return e
+}
+
+// name returns the name of an enum value.
+func (t *Enum) name(value string) (string, bool) {
+	for name, v := range t.Values {
+		if v == value {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Object is a type with fields, each of which is resolved separately.
+type Object struct {
+	Name        string
+	Description string
+	Fields      map[string]*FieldDef
+}
+
+// InputObject is a type for arguments made up of several fields. It is handed to
+// resolvers as a map[string]interface{} holding the fields that were given.
+type InputObject struct {
+	Name        string
+	Description string
+	Fields      map[string]*InputValue
+}
+
+// List and NonNull wrap another type.
+type List struct{ Of Type }
+type NonNull struct{ Of Type }
+
+// ListOf and NonNullOf wrap a type, for use in expressions.
+func ListOf(t Type) *List       { return &List{Of: t} }
+func NonNullOf(t Type) *NonNull { return &NonNull{Of: t} }
+
+func (t *Scalar) String() string      { return t.Name }
+func (t *Enum) String() string        { return t.Name }
+func (t *Object) String() string      { return t.Name }
+func (t *InputObject) String() string { return t.Name }
+func (t *List) String() string        { return "[" + t.Of.String() + "]" }
+func (t *NonNull) String() string     { return t.Of.String() + "!" }
+
+// FieldDef is a field of an Object. If Resolve is nil, the field is read from the parent
+// value: a map's element with the field's name, or a struct's field whose name matches
+// it, ignoring case, so that a field named dueDate reads Task.DueDate.
+type FieldDef struct {
+	Type        Type
+	Description string
+	Args        map[string]*InputValue
+	Resolve     ResolveFunc
+}
+
+// InputValue is an argument of a field, or a field of an input object.
+type InputValue struct {
+	Type        Type
+	Description string
+	Default     interface{} // Used when the argument isn't given, if not nil.
+}
+
+// ResolveFunc returns the value of a field. To have the value loaded in a batch along
+// with others, it can return a Thunk instead, see Loader.
+type ResolveFunc func(p ResolveParams) (interface{}, error)
+
+// ResolveParams are the inputs of a ResolveFunc: the value of the object the field
+// belongs to, and the field's arguments.
+type ResolveParams struct {
+	Context context.Context
+	Source  interface{}
+	Args    map[string]interface{}
+}
+
+// Thunk is a value that is yet to be loaded. The executor calls every resolver on a level
+// of the query before calling any of the thunks they returned.
+type Thunk func() (interface{}, error)
+
+// The built-in scalars.
+var (
+	Int = &Scalar{
+		Name:      "Int",
+		Serialize: serializeInt,
+		Parse: func(value interface{}) (interface{}, error) {
+			n, err := parseInt(value)
+			if err != nil {
+				return nil, err
+			}
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, fmt.Errorf("Int cannot represent non 32-bit signed integer value: %d", n)
+			}
+			return int(n), nil
+		},
+	}
+	Float = &Scalar{
+		Name: "Float",
+		Serialize: func(value interface{}) (interface{}, error) {
+			v := reflect.ValueOf(value)
+			switch v.Kind() {
+			case reflect.Float32, reflect.Float64:
+				return v.Float(), nil
+			}
+			return serializeInt(value)
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			switch v := value.(type) {
+			case float64:
+				return v, nil
+			case int64:
+				return float64(v), nil
+			case json.Number:
+				return v.Float64()
+			}
+			return nil, fmt.Errorf("Float cannot represent non numeric value: %v", value)
+		},
+	}
+	String = &Scalar{
+		Name: "String",
+		Serialize: func(value interface{}) (interface{}, error) {
+			if s, ok := value.(fmt.Stringer); ok {
+				return s.String(), nil
+			}
+			v := reflect.ValueOf(value)
+			if v.Kind() == reflect.String {
+				return v.String(), nil
+			}
+			return nil, fmt.Errorf("String cannot represent value: %v", value)
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok {
+				return s, nil
+			}
+			return nil, fmt.Errorf("String cannot represent a non string value: %v", value)
+		},
+	}
+	Boolean = &Scalar{
+		Name: "Boolean",
+		Serialize: func(value interface{}) (interface{}, error) {
+			if b, ok := value.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("Boolean cannot represent a non boolean value: %v", value)
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			if b, ok := value.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("Boolean cannot represent a non boolean value: %v", value)
+		},
+	}
+	// ID is serialized as a string, but accepts integers as well.
+	ID = &Scalar{
+		Name: "ID",
+		Serialize: func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok {
+				return s, nil
+			}
+			n, err := serializeInt(value)
+			if err != nil {
+				return nil, fmt.Errorf("ID cannot represent value: %v", value)
+			}
+			return strconv.FormatInt(n.(int64), 10), nil
+		},
+		Parse: func(value interface{}) (interface{}, error) {
+			if s, ok := value.(string); ok {
+				return s, nil
+			}
+			if n, err := parseInt(value); err == nil {
+				return strconv.FormatInt(n, 10), nil
+			}
+			return nil, fmt.Errorf("ID cannot represent value: %v", value)
+		},
+	}
+)
+
+func serializeInt(value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	}
+	return nil, fmt.Errorf("Int cannot represent non-integer value: %v", value)
+}
+
+func parseInt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		// Variables decoded without UseNumber hold every number as a float64.
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v), nil
+		}
+	case json.Number:
+		n, err := v.Int64()
+		if err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("Int cannot represent non-integer value: %v", value)
+}
+
+// namedType strips the List and NonNull wrappers off a type.
+func namedType(t Type) Type {
+	for {
+		switch wrapper := t.(type) {
+		case *List:
+			t = wrapper.Of
+		case *NonNull:
+			t = wrapper.Of
+		default:
+			return t
+		}
+	}
+}
+
+// isLeaf reports whether a type is a scalar or enum, which can't have a selection set.
+func isLeaf(t Type) bool {
+	switch namedType(t).(type) {
+	case *Scalar, *Enum:
+		return true
+	}
+	return false
+}
+
+// typeMap returns the schema's types by name, which is needed to look up the types of
+// variables.
+func (s *Schema) typeMap() map[string]Type {
+	types := map[string]Type{}
+	var add func(t Type)
+	add = func(t Type) {
+		t = namedType(t)
+		if _, ok := types[t.String()]; ok {
+			return
+		}
+		types[t.String()] = t
+		switch t := t.(type) {
+		case *Object:
+			for _, f := range t.Fields {
+				add(f.Type)
+				for _, arg := range f.Args {
+					add(arg.Type)
+				}
+			}
+		case *InputObject:
+			for _, f := range t.Fields {
+				add(f.Type)
+			}
+		}
+	}
+	for _, t := range []Type{Int, Float, String, Boolean, ID} {
+		add(t)
+	}
+	add(s.Query)
+	if s.Mutation != nil {
+		add(s.Mutation)
+	}
+	return types
+}
+
+// coerceInput checks a value given for an argument, a variable or an input object field
+// against its type, and converts it to the Go value handed to resolvers. Literals have
+// already had their variables replaced. The path describes the value in errors.
+func coerceInput(t Type, value interface{}, path string) (interface{}, error) {
+	if pre, ok := value.(preCoerced); ok {
+		if _, required := t.(*NonNull); required && pre.value == nil {
+			return nil, fmt.Errorf("%s: expected a value of non-null type %s", path, t)
+		}
+		return pre.value, nil
+	}
+	if nonNull, ok := t.(*NonNull); ok {
+		if value == nil {
+			return nil, fmt.Errorf("%s: expected a value of non-null type %s", path, t)
+		}
+		return coerceInput(nonNull.Of, value, path)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *List:
+		items, ok := value.([]interface{})
+		if !ok {
+			// A single value is accepted where a list is expected.
+			item, err := coerceInput(t.Of, value, path)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+		coerced := make([]interface{}, len(items))
+		for i, item := range items {
+			c, err := coerceInput(t.Of, item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			coerced[i] = c
+		}
+		return coerced, nil
+	case *InputObject:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: expected an object of type %s", path, t)
+		}
+		for name := range fields {
+			if _, ok := t.Fields[name]; !ok {
+				return nil, fmt.Errorf("%s: field %q is not defined by type %s", path, name, t)
+			}
+		}
+		coerced := make(map[string]interface{}, len(t.Fields))
+		for name, field := range t.Fields {
+			v, ok := fields[name]
+			if !ok {
+				if field.Default != nil {
+					coerced[name] = field.Default
+					continue
+				}
+				if _, required := field.Type.(*NonNull); required {
+					return nil, fmt.Errorf("%s: field %q of type %s is required", path, name, field.Type)
+				}
+				continue
+			}
+			c, err := coerceInput(field.Type, v, path+"."+name)
+			if err != nil {
+				return nil, err
+			}
+			coerced[name] = c
+		}
+		return coerced, nil
+	case *Enum:
+		var name string
+		switch v := value.(type) {
+		case EnumValue:
+			name = string(v)
+		case string:
+			name = v
+		}
+		v, ok := t.Values[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: value %v does not exist in %q enum", path, value, t.Name)
+		}
+		return v, nil
+	case *Scalar:
+		if _, ok := value.(EnumValue); ok {
+			return nil, fmt.Errorf("%s: %s cannot represent value: %v", path, t.Name, value)
+		}
+		v, err := t.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("%s: type %s can't be used as an input", path, t)
+}
+
+// preCoerced is the value of a variable used in an argument. Variables are coerced to
+// their own types before the operation runs, so coerceInput() takes it as it is.
+type preCoerced struct{ value interface{} }
+
+// literalValue replaces the variables in a literal with their values, and turns lists
+// and objects into the []interface{} and map[string]interface{} that variables decode to.
+// Variables that weren't given are left out of objects.
+func literalValue(value Value, variables map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case Variable:
+		return variables[string(v)]
+	case []Value:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = literalValue(item, variables)
+		}
+		return list
+	case map[string]Value:
+		object := make(map[string]interface{}, len(v))
+		for name, field := range v {
+			if variable, ok := field.(Variable); ok {
+				if _, given := variables[string(variable)]; !given {
+					continue
+				}
+			}
+			object[name] = literalValue(field, variables)
+		}
+		return object
+	}
+	return value
+}
+
+// defaultResolve reads a field from the parent value, see Field.
+func defaultResolve(source interface{}, name string) interface{} {
+	if m, ok := source.(map[string]interface{}); ok {
+		return m[name]
+	}
+	v := reflect.ValueOf(source)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	sf, ok := v.Type().FieldByNameFunc(func(fieldName string) bool {
+		return strings.EqualFold(fieldName, name)
+	})
+	if !ok || !sf.IsExported() {
+		return nil
+	}
+	// Reading a field promoted from a nil embedded pointer fails rather than panicking.
+	f, err := v.FieldByIndexErr(sf.Index)
+	if err != nil {
+		return nil
+	}
+	return f.Interface()
+}
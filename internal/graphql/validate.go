@@ -0,0 +1,190 @@
+package graphql
+
+import "fmt"
+
+// validation checks an operation against the schema before it's run, so that a mistake
+// in a query is reported in full rather than as a half-executed result.
+type validation struct {
+	doc       *Document
+	op        *Operation
+	maxDepth  int
+	errors    []*Error
+	tooDeep   bool
+	variables map[string]bool
+	// spreading holds the fragments being visited, to catch fragments that spread
+	// themselves.
+	spreading map[string]bool
+}
+
+func (s *Schema) validate(doc *Document, op *Operation, root *Object) []*Error {
+	v := &validation{
+		doc:       doc,
+		op:        op,
+		maxDepth:  s.MaxDepth,
+		variables: make(map[string]bool, len(op.Variables)),
+		spreading: make(map[string]bool),
+	}
+	for _, def := range op.Variables {
+		if v.variables[def.Name] {
+			v.errorf(def.Location, "There can be only one variable named \"$%s\".", def.Name)
+		}
+		v.variables[def.Name] = true
+	}
+	v.selectionSet(root, op.SelectionSet, 1)
+	return v.errors
+}
+
+func (v *validation) errorf(loc Location, format string, args ...interface{}) {
+	v.errors = append(v.errors, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{loc}})
+}
+
+func (v *validation) selectionSet(t *Object, selections []Selection, depth int) {
+	if v.maxDepth > 0 && depth > v.maxDepth && len(selections) > 0 {
+		if !v.tooDeep {
+			v.errorf(selections[0].location(), "The query exceeds the maximum depth of %d.", v.maxDepth)
+			v.tooDeep = true
+		}
+		return
+	}
+
+	for _, selection := range selections {
+		switch sel := selection.(type) {
+		case *Field:
+			v.directives(sel.Directives)
+			v.field(t, sel, depth)
+		case *InlineFragment:
+			v.directives(sel.Directives)
+			if sel.TypeCondition != "" && sel.TypeCondition != t.Name {
+				v.errorf(sel.Location, "Fragment cannot be spread here as objects of type %q can never be of type %q.", t.Name, sel.TypeCondition)
+				continue
+			}
+			v.selectionSet(t, sel.SelectionSet, depth)
+		case *FragmentSpread:
+			v.directives(sel.Directives)
+			fragment, ok := v.doc.Fragments[sel.Name]
+			if !ok {
+				v.errorf(sel.Location, "Unknown fragment %q.", sel.Name)
+				continue
+			}
+			if fragment.TypeCondition != t.Name {
+				v.errorf(sel.Location, "Fragment %q cannot be spread here as objects of type %q can never be of type %q.", sel.Name, t.Name, fragment.TypeCondition)
+				continue
+			}
+			if v.spreading[sel.Name] {
+				v.errorf(sel.Location, "Cannot spread fragment %q within itself.", sel.Name)
+				continue
+			}
+			v.spreading[sel.Name] = true
+			v.selectionSet(t, fragment.SelectionSet, depth)
+			delete(v.spreading, sel.Name)
+		}
+	}
+}
+
+func (v *validation) field(t *Object, field *Field, depth int) {
+	if field.Name == "__typename" {
+		if len(field.SelectionSet) > 0 {
+			v.errorf(field.Location, "Field \"__typename\" must not have a selection since type \"String!\" has no subfields.")
+		}
+		return
+	}
+	def, ok := t.Fields[field.Name]
+	if !ok {
+		v.errorf(field.Location, "Cannot query field %q on type %q.", field.Name, t.Name)
+		return
+	}
+
+	for _, arg := range field.Arguments {
+		argDef, ok := def.Args[arg.Name]
+		if !ok {
+			v.errorf(arg.Location, "Unknown argument %q on field \"%s.%s\".", arg.Name, t.Name, field.Name)
+			continue
+		}
+		v.value(arg.Value, arg.Location)
+		// Literals can be checked now; values with variables in them are checked when
+		// the variables are known.
+		if !hasVariables(arg.Value) {
+			if _, err := coerceInput(argDef.Type, literalValue(arg.Value, nil), "Argument \""+arg.Name+"\""); err != nil {
+				v.errorf(arg.Location, "%s", err)
+			}
+		}
+	}
+	for name, argDef := range def.Args {
+		if _, required := argDef.Type.(*NonNull); !required || argDef.Default != nil {
+			continue
+		}
+		given := false
+		for _, arg := range field.Arguments {
+			given = given || arg.Name == name
+		}
+		if !given {
+			v.errorf(field.Location, "Field %q argument %q of type %q is required, but it was not provided.", field.Name, name, argDef.Type)
+		}
+	}
+
+	switch object := namedType(def.Type).(type) {
+	case *Object:
+		if len(field.SelectionSet) == 0 {
+			v.errorf(field.Location, "Field %q of type %q must have a selection of subfields.", field.Name, def.Type)
+			return
+		}
+		v.selectionSet(object, field.SelectionSet, depth+1)
+	default:
+		if len(field.SelectionSet) > 0 {
+			v.errorf(field.Location, "Field %q must not have a selection since type %q has no subfields.", field.Name, def.Type)
+		}
+	}
+}
+
+// directives checks that only @skip and @include are used, each with an if argument.
+func (v *validation) directives(directives []*Directive) {
+	for _, d := range directives {
+		if d.Name != "skip" && d.Name != "include" {
+			v.errorf(d.Location, "Unknown directive \"@%s\".", d.Name)
+			continue
+		}
+		if len(d.Arguments) != 1 || d.Arguments[0].Name != "if" {
+			v.errorf(d.Location, "Directive \"@%s\" takes exactly one argument, \"if\".", d.Name)
+			continue
+		}
+		v.value(d.Arguments[0].Value, d.Arguments[0].Location)
+	}
+}
+
+// value checks that the variables used in a value are defined by the operation.
+func (v *validation) value(value Value, loc Location) {
+	switch val := value.(type) {
+	case Variable:
+		if !v.variables[string(val)] {
+			v.errorf(loc, "Variable \"$%s\" is not defined by operation %q.", val, v.op.Name)
+		}
+	case []Value:
+		for _, item := range val {
+			v.value(item, loc)
+		}
+	case map[string]Value:
+		for _, field := range val {
+			v.value(field, loc)
+		}
+	}
+}
+
+func hasVariables(value Value) bool {
+	switch val := value.(type) {
+	case Variable:
+		return true
+	case []Value:
+		for _, item := range val {
+			if hasVariables(item) {
+				return true
+			}
+		}
+	case map[string]Value:
+		for _, field := range val {
+			if hasVariables(field) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+// Package i18n translates the API's messages into the language a client asks for with
+// the Accept-Language header. Messages are written in English in the code, and English
+// is what clients get when there is no catalog for their language or no translation for
+// a message. The catalogs are JSON files in the locales directory, one per language,
+// mapping English messages to their translations.
+//
+// A message in a catalog can contain fmt verbs such as %d or %s, in which case it also
+// translates every message of that form: "must not be more than %d bytes long" covers
+// "must not be more than 100 bytes long", whatever the number. The text standing in
+// for each verb is put in place of the verbs of the translation, in order, or in the
+// order given by explicit indexes such as %[2]s.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed "locales"
+var localeFS embed.FS
+
+// English is the language of the messages in the code.
+const English = "en"
+
+// Translator holds the catalogs. It is safe for concurrent use.
+type Translator struct {
+	catalogs map[string]*catalog
+}
+
+type catalog struct {
+	exact    map[string]string
+	patterns []pattern
+}
+
+// pattern is a message with verbs, matched against messages by a regular expression
+// with a group for each verb.
+type pattern struct {
+	rx          *regexp.Regexp
+	literal     int
+	translation string
+}
+
+// verbRX matches fmt verbs, with an optional explicit argument index.
+var verbRX = regexp.MustCompile(`%(\[\d+\])?[a-z]`)
+
+// New loads the catalogs in the locales directory.
+func New() (*Translator, error) {
+	files, err := localeFS.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Translator{catalogs: make(map[string]*catalog)}
+	for _, file := range files {
+		lang, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok {
+			continue
+		}
+		js, err := localeFS.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(js, &messages); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", file.Name(), err)
+		}
+		t.catalogs[strings.ToLower(lang)] = newCatalog(messages)
+	}
+	return t, nil
+}
+
+func newCatalog(messages map[string]string) *catalog {
+	c := &catalog{exact: make(map[string]string)}
+	for message, translation := range messages {
+		if !verbRX.MatchString(message) {
+			c.exact[message] = translation
+			continue
+		}
+		// %d only stands for a number, so that "must be %d" doesn't translate every
+		// message starting with "must be"; the other verbs stand for any text.
+		literals := verbRX.Split(message, -1)
+		verbs := verbRX.FindAllString(message, -1)
+		var expr strings.Builder
+		length := 0
+		for i, literal := range literals {
+			expr.WriteString(regexp.QuoteMeta(literal))
+			length += len(literal)
+			switch {
+			case i == len(verbs):
+			case strings.HasSuffix(verbs[i], "d"):
+				expr.WriteString(`(-?\d+)`)
+			default:
+				expr.WriteString(`(.+?)`)
+			}
+		}
+		c.patterns = append(c.patterns, pattern{
+			rx:          regexp.MustCompile("^" + expr.String() + "$"),
+			literal:     length,
+			translation: translation,
+		})
+	}
+	// A message can match more than one pattern, such as "must be at least 8 bytes
+	// long", which matches "must be at least %v" as well as "must be at least %d bytes
+	// long". The pattern with the most text in common with it is the one meant.
+	sort.Slice(c.patterns, func(i, j int) bool {
+		if c.patterns[i].literal != c.patterns[j].literal {
+			return c.patterns[i].literal > c.patterns[j].literal
+		}
+		return c.patterns[i].rx.String() < c.patterns[j].rx.String()
+	})
+	return c
+}
+
+// Languages returns the languages that messages are available in, English included, in
+// alphabetical order.
+func (t *Translator) Languages() []string {
+	languages := []string{English}
+	for lang := range t.catalogs {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Negotiate picks the language for an Accept-Language header, honouring quality values.
+// A language range such as "ru-RU" is served by the catalog for "ru" if there is no
+// catalog for it. English is returned when none of the languages asked for is available.
+func (t *Translator) Negotiate(acceptLanguage string) string {
+	best, bestQ := English, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		if lang, ok := t.match(tag); ok {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+func (t *Translator) match(tag string) (string, bool) {
+	for {
+		if tag == English {
+			return English, true
+		}
+		if _, ok := t.catalogs[tag]; ok {
+			return tag, true
+		}
+		i := strings.LastIndexByte(tag, '-')
+		if i < 0 {
+			return "", false
+		}
+		tag = tag[:i]
+	}
+}
+
+// Translate returns the translation of a message into lang, or the message itself if
+// there is none.
+func (t *Translator) Translate(lang, message string) string {
+	c, ok := t.catalogs[lang]
+	if !ok {
+		return message
+	}
+	if translation, ok := c.exact[message]; ok {
+		return translation
+	}
+	for _, p := range c.patterns {
+		if args := p.rx.FindStringSubmatch(message); args != nil {
+			return substitute(p.translation, args[1:])
+		}
+	}
+	return message
+}
+
+// TranslateAll translates the values of a map of messages, such as the errors of a
+// validator.Validator, returning a new map.
+func (t *Translator) TranslateAll(lang string, messages map[string]string) map[string]string {
+	translated := make(map[string]string, len(messages))
+	for key, message := range messages {
+		translated[key] = t.Translate(lang, message)
+	}
+	return translated
+}
+
+// substitute puts args in place of the verbs of a translation.
+func substitute(translation string, args []string) string {
+	next := 0
+	return verbRX.ReplaceAllStringFunc(translation, func(verb string) string {
+		i := next
+		if index := verbRX.FindStringSubmatch(verb)[1]; index != "" {
+			n, _ := strconv.Atoi(strings.Trim(index, "[]"))
+			i = n - 1
+		}
+		next = i + 1
+		if i < 0 || i >= len(args) {
+			return verb
+		}
+		return args[i]
+	})
+}
@@ -0,0 +1,100 @@
+// Package ical writes and reads iCalendar (RFC 5545) data. It only covers what the
+// calendar feed and CalDAV need: components, properties, parameters, text escaping, line
+// folding and dates.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxLineLength is the longest a content line may be, in octets, before it has to be
+// folded onto a continuation line.
+const maxLineLength = 75
+
+// Writer writes iCalendar content lines. Errors are sticky: once a write fails the rest
+// are skipped, and Flush() returns the error.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Begin starts a component, e.g. VCALENDAR or VTODO.
+func (w *Writer) Begin(component string) {
+	w.line("BEGIN:" + component)
+}
+
+// End finishes a component.
+func (w *Writer) End(component string) {
+	w.line("END:" + component)
+}
+
+// Prop writes a property whose value is already in iCalendar form, e.g. a date or an
+// RRULE.
+func (w *Writer) Prop(name, value string) {
+	w.line(name + ":" + value)
+}
+
+// Text writes a property with a free-text value, escaping it as required.
+func (w *Writer) Text(name, value string) {
+	w.line(name + ":" + EscapeText(value))
+}
+
+// Time writes a property with a UTC date-time value.
+func (w *Writer) Time(name string, t time.Time) {
+	w.line(name + ":" + FormatTime(t))
+}
+
+// Flush writes any buffered data and returns the first error encountered.
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// line writes a content line, folding it so that no physical line is longer than 75
+// octets, without splitting a UTF-8 sequence.
+func (w *Writer) line(s string) {
+	if w.err != nil {
+		return
+	}
+	var b strings.Builder
+	limit := maxLineLength
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !startsRune(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// The leading space of a continuation line counts towards its length.
+		limit = maxLineLength - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	_, w.err = w.w.WriteString(b.String())
+}
+
+func startsRune(b byte) bool {
+	return b&0xc0 != 0x80
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// EscapeText escapes a TEXT value.
+func EscapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// FormatTime formats t as a UTC date-time, e.g. 20240131T170000Z.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
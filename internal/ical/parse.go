@@ -0,0 +1,197 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Component is a parsed component, e.g. a VCALENDAR holding VTODOs.
+type Component struct {
+	Name       string
+	Props      []*Property
+	Components []*Component
+}
+
+// Property is a parsed content line. Parameter names are upper case; values are as they
+// were sent, so TEXT values still need UnescapeText().
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Prop returns the first property with the given name, or nil if there is none.
+func (c *Component) Prop(name string) *Property {
+	for _, p := range c.Props {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Component returns the first child component with the given name, or nil if there is
+// none.
+func (c *Component) Component(name string) *Component {
+	for _, child := range c.Components {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// Parse reads one component, usually a VCALENDAR, unfolding lines as it goes. Only the
+// structure is checked: every BEGIN must have a matching END.
+func Parse(r io.Reader) (*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var root *Component
+	var stack []*Component
+	for _, line := range lines {
+		prop, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+		switch prop.Name {
+		case "BEGIN":
+			if root != nil && len(stack) == 0 {
+				return nil, errors.New("ical: data after the end of the component")
+			}
+			c := &Component{Name: strings.ToUpper(prop.Value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, c)
+			} else {
+				root = c
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("ical: unexpected END:%s", prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("ical: %s property outside a component", prop.Name)
+			}
+			c := stack[len(stack)-1]
+			c.Props = append(c.Props, prop)
+		}
+	}
+	if root == nil {
+		return nil, errors.New("ical: no component")
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("ical: missing END:%s", stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+// unfold returns the content lines of r, joining continuation lines (those starting with
+// a space or tab) onto the line before them. Blank lines are skipped.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseLine splits a content line into its name, parameters and value. Parameter values
+// may be quoted, in which case they can contain the ";", ":" and "," that otherwise
+// separate them.
+func parseLine(line string) (*Property, error) {
+	prop := &Property{Params: make(map[string]string)}
+
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return nil, fmt.Errorf("ical: invalid content line %q", line)
+	}
+	prop.Name = strings.ToUpper(line[:i])
+	line = line[i:]
+
+	for line[0] == ';' {
+		line = line[1:]
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("ical: invalid parameter in %s", prop.Name)
+		}
+		name := strings.ToUpper(line[:eq])
+		line = line[eq+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("ical: unterminated quoted parameter in %s", prop.Name)
+			}
+			value = line[1 : end+1]
+			line = line[end+2:]
+		} else {
+			end := strings.IndexAny(line, ";:")
+			if end < 0 {
+				return nil, fmt.Errorf("ical: missing value in %s", prop.Name)
+			}
+			value = line[:end]
+			line = line[end:]
+		}
+		prop.Params[name] = value
+		if line == "" {
+			return nil, fmt.Errorf("ical: missing value in %s", prop.Name)
+		}
+	}
+	if line[0] != ':' {
+		return nil, fmt.Errorf("ical: invalid content line for %s", prop.Name)
+	}
+	prop.Value = line[1:]
+	return prop, nil
+}
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+// UnescapeText undoes EscapeText().
+func UnescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
+
+// ParseTime reads a DATE or DATE-TIME property such as DUE. A date-time in UTC ends in Z;
+// one with a TZID parameter is in that time zone, and a "floating" one without either is
+// read in loc. A date on its own is midnight in loc, and is reported with dateOnly set.
+func ParseTime(p *Property, loc *time.Location) (t time.Time, dateOnly bool, err error) {
+	value := p.Value
+	if p.Params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err = time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	if tzid := p.Params["TZID"]; tzid != "" {
+		zone, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("ical: unknown time zone %q", tzid)
+		}
+		loc = zone
+	}
+	t, err = time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
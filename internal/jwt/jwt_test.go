@@ -0,0 +1,71 @@
+package jwt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestParse(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	claims := Claims{Subject: "42", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix(), SessionID: 7, Activated: true}
+	token, err := Sign(claims, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+
+	// resign signs a tampered header and payload with the right secret, as someone who
+	// knew it could.
+	resign := func(header, payload string) string {
+		unsigned := encoding.EncodeToString([]byte(header)) + "." + encoding.EncodeToString([]byte(payload))
+		return unsigned + "." + encoding.EncodeToString(sign(unsigned, secret))
+	}
+	adminPayload := encoding.EncodeToString([]byte(`{"sub":"1","iat":1700000000,"exp":1700000060,"activated":true}`))
+
+	tests := []struct {
+		name  string
+		token string
+		at    time.Time
+		err   error
+	}{
+		{"valid", token, now, nil},
+		{"just before expiry", token, now.Add(time.Minute - time.Second), nil},
+		{"expired", token, now.Add(time.Minute), ErrExpiredToken},
+		{"long expired", token, now.Add(24 * time.Hour), ErrExpiredToken},
+		{"alg none", encoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + ".", now, ErrInvalidToken},
+		{"alg none, signed", resign(`{"alg":"none","typ":"JWT"}`, `{"sub":"42","exp":1700000060}`), now, ErrInvalidToken},
+		{"alg HS512", resign(`{"alg":"HS512","typ":"JWT"}`, `{"sub":"42","exp":1700000060}`), now, ErrInvalidToken},
+		{"other subject", parts[0] + "." + adminPayload + "." + parts[2], now, ErrInvalidToken},
+		{"other secret", mustSign(t, claims, []byte("another secret, just as long as it")), now, ErrInvalidToken},
+		{"no signature", parts[0] + "." + parts[1] + ".", now, ErrInvalidToken},
+		{"truncated signature", token[:len(token)-2], now, ErrInvalidToken},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!!", now, ErrInvalidToken},
+		{"two parts", parts[0] + "." + parts[1], now, ErrInvalidToken},
+		{"four parts", token + ".x", now, ErrInvalidToken},
+		{"payload not JSON", resign(header, `not json`), now, ErrInvalidToken},
+		{"empty", "", now, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.token, secret, tt.at)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && *got != claims {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, claims)
+		}
+	}
+}
+
+func mustSign(t *testing.T, claims Claims, secret []byte) string {
+	t.Helper()
+	token, err := Sign(claims, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
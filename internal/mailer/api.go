@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// apiTimeout is how long the HTTP APIs of mail services get to accept a message.
+const apiTimeout = 10 * time.Second
+
+// newAPIRequest returns a POST request to a mail service's HTTP API with body encoded as
+// JSON.
+func newAPIRequest(ctx context.Context, url string, body interface{}) (*http.Request, []byte, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, payload, nil
+}
+
+// sendAPIRequest sends a request made by newAPIRequest. Any non-2xx response is an error,
+// which includes the start of the response body, where the services explain what was wrong.
+func sendAPIRequest(client *http.Client, service string, req *http.Request) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s: %s", service, res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// parseSender splits a sender such as "Taskninja <no-reply@taskninja.bayashat.com>" into
+// its name and address, as the HTTP APIs want them.
+func parseSender(sender string) (name, address string, err error) {
+	addr, err := mail.ParseAddress(sender)
+	if err != nil {
+		return "", "", fmt.Errorf("mailer: invalid sender %q: %w", sender, err)
+	}
+	return addr.Name, addr.Address, nil
+}
@@ -0,0 +1,27 @@
+package mailer
+
+import "context"
+
+// infoLogger is the part of jsonlog.Logger that Log needs.
+type infoLogger interface {
+	PrintInfo(message string, properties map[string]string)
+}
+
+// Log doesn't send messages, but writes them to the log, for development without a mail
+// service. Tokens mailed to users can be copied from there.
+type Log struct {
+	logger infoLogger
+}
+
+func NewLog(logger infoLogger) *Log {
+	return &Log{logger: logger}
+}
+
+func (l *Log) Send(ctx context.Context, msg *Message) error {
+	l.logger.PrintInfo("email not sent, the mail backend is log", map[string]string{
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.PlainBody,
+	})
+	return nil
+}
@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"html/template"
+)
+
+// Declare a new variable with the type embed.FS (embedded file system) to hold our email
+// templates. The comment directive below tells Go to store the contents of the
+// ./templates directory in the templateFS variable.
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Message is an email rendered from one of the templates, ready to be sent.
+type Message struct {
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Backend sends messages through a mail service. The sender information (the name and
+// address the emails come from, e.g. "Taskninja <no-reply@taskninja.bayashat.com>") is
+// part of each backend's configuration.
+type Backend interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Pinger is implemented by backends which can check that their service is reachable
+// without sending anything.
+type Pinger interface {
+	Ping() error
+}
+
+// Define a Mailer struct which renders emails from the templates and sends them with one
+// of the backends: SMTP, SendGrid, SES or Log.
+type Mailer struct {
+	backend Backend
+}
+
+func New(backend Backend) Mailer {
+	return Mailer{backend: backend}
+}
+
+// The Render() method takes the recipient email address as the first parameter, the name
+// of the file containing the templates, and any dynamic data for the templates as an
+// interface{} parameter. Each template file defines a "subject", "plainBody" and
+// "htmlBody" template.
+func (m Mailer) Render(recipient, templateFile string, data interface{}) (*Message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:        recipient,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
+
+// The Send() method sends a rendered message with the backend.
+func (m Mailer) Send(ctx context.Context, msg *Message) error {
+	return m.backend.Send(ctx, msg)
+}
+
+// The Ping() method checks that the backend's service can be reached, if it has a way to
+// do so; otherwise it always succeeds.
+func (m Mailer) Ping() error {
+	pinger, ok := m.backend.(Pinger)
+	if !ok {
+		return nil
+	}
+	return pinger.Ping()
+}
@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"context"
+	"net/http"
+)
+
+const sendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// SendGrid sends messages with the SendGrid v3 Mail Send API.
+type SendGrid struct {
+	apiKey      string
+	senderName  string
+	senderEmail string
+	client      *http.Client
+}
+
+func NewSendGrid(apiKey, sender string) (*SendGrid, error) {
+	name, address, err := parseSender(sender)
+	if err != nil {
+		return nil, err
+	}
+	return &SendGrid{
+		apiKey:      apiKey,
+		senderName:  name,
+		senderEmail: address,
+		client:      &http.Client{Timeout: apiTimeout},
+	}, nil
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (s *SendGrid) Send(ctx context.Context, msg *Message) error {
+	body := struct {
+		Personalizations []sendGridPersonalization `json:"personalizations"`
+		From             sendGridAddress           `json:"from"`
+		Subject          string                    `json:"subject"`
+		Content          []sendGridContent         `json:"content"`
+	}{
+		Personalizations: []sendGridPersonalization{{To: []sendGridAddress{{Email: msg.To}}}},
+		From:             sendGridAddress{Email: s.senderEmail, Name: s.senderName},
+		Subject:          msg.Subject,
+		// SendGrid wants the plain text part first.
+		Content: []sendGridContent{
+			{Type: "text/plain", Value: msg.PlainBody},
+			{Type: "text/html", Value: msg.HTMLBody},
+		},
+	}
+	req, _, err := newAPIRequest(ctx, sendGridURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	return sendAPIRequest(s.client, "sendgrid", req)
+}
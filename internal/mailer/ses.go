@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SES sends messages with the Amazon SES v2 SendEmail API. Requests are signed with AWS
+// Signature Version 4, using an access key of an IAM user allowed to call ses:SendEmail.
+type SES struct {
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	sender          string
+	client          *http.Client
+	now             func() time.Time
+}
+
+func NewSES(region, accessKeyID, secretAccessKey, sender string) *SES {
+	return &SES{
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		sender:          sender,
+		client:          &http.Client{Timeout: apiTimeout},
+		now:             time.Now,
+	}
+}
+
+type sesContent struct {
+	Data    string `json:"Data"`
+	Charset string `json:"Charset"`
+}
+
+func (s *SES) Send(ctx context.Context, msg *Message) error {
+	var body struct {
+		FromEmailAddress string
+		Destination      struct {
+			ToAddresses []string
+		}
+		Content struct {
+			Simple struct {
+				Subject sesContent
+				Body    struct {
+					Text sesContent
+					Html sesContent
+				}
+			}
+		}
+	}
+	body.FromEmailAddress = s.sender
+	body.Destination.ToAddresses = []string{msg.To}
+	body.Content.Simple.Subject = sesContent{Data: msg.Subject, Charset: "UTF-8"}
+	body.Content.Simple.Body.Text = sesContent{Data: msg.PlainBody, Charset: "UTF-8"}
+	body.Content.Simple.Body.Html = sesContent{Data: msg.HTMLBody, Charset: "UTF-8"}
+
+	url := fmt.Sprintf("https://email.%s.amazonaws.com/v2/email/outbound-emails", s.region)
+	req, payload, err := newAPIRequest(ctx, url, body)
+	if err != nil {
+		return err
+	}
+	s.sign(req, payload)
+	return sendAPIRequest(s.client, "ses", req)
+}
+
+// sign adds the headers of AWS Signature Version 4 to a request with the given body. See
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html.
+func (s *SES) sign(req *http.Request, payload []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// The headers are signed in lower case, sorted by name.
+	const signedHeaders = "content-type;host;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		hashHex(payload),
+	}, "\n")
+
+	scope := date + "/" + s.region + "/ses/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hashHex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "ses")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hashHex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
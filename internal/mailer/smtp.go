@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+// SMTP sends messages through an SMTP server.
+type SMTP struct {
+	dialer *mail.Dialer
+	sender string
+}
+
+func NewSMTP(host string, port int, username, password, sender string) *SMTP {
+	// Initialize a new mail.Dialer instance with the given SMTP server settings. We
+	// also configure this to use a 5-second timeout whenever we send an email.
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTP{
+		dialer: dialer,
+		sender: sender,
+	}
+}
+
+func (s *SMTP) Send(ctx context.Context, msg *Message) error {
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", s.sender)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
+
+	// Call the DialAndSend() method on the dialer, passing in the message to send. This
+	// opens a connection to the SMTP server, sends the message, then closes the
+	// connection. If there is a timeout, it will return a "dial tcp: i/o timeout" error.
+	return s.dialer.DialAndSend(m)
+}
+
+// The Ping() method connects to the SMTP server (authenticating if a username is set) and
+// disconnects again without sending anything, to check that the server can be reached.
+func (s *SMTP) Ping() error {
+	conn, err := s.dialer.Dial()
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,491 @@
+// Package markdown renders the Markdown of task descriptions and comments as HTML, for
+// clients that would rather not bundle a renderer of their own. It covers the common
+// subset: paragraphs and hard line breaks, ATX headings, emphasis, strikethrough, code
+// spans and fenced code blocks, links and autolinks, block quotes, lists and thematic
+// breaks. Setext headings, indented code blocks, tables and raw HTML are not supported.
+//
+// The output is safe to put into a page as it is. Every piece of text is escaped, raw HTML
+// is written out as text rather than passed through, and links are only made for http,
+// https and mailto URLs; any other link is rendered as its text alone. Images are rendered
+// as links to the image, so that showing a comment doesn't fetch anything.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxDepth is how deeply block quotes and lists may nest. Deeper markers are rendered as
+// text, so that rendering is bounded however the input is written.
+const maxDepth = 8
+
+var (
+	headingRX  = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*))?$`)
+	closingRX  = regexp.MustCompile(`(?:^|[ \t]+)#+[ \t]*$`)
+	ruleRX     = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fenceRX    = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`]*)$")
+	quoteRX    = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	listRX     = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])(?:[ \t]+(.*))?$`)
+	languageRX = regexp.MustCompile(`^[A-Za-z0-9_+#.-]+$`)
+	autolinkRX = regexp.MustCompile(`^(?:[A-Za-z][A-Za-z0-9+.-]*:[^\s<>]+|[^\s<>@]+@[^\s<>@]+)$`)
+)
+
+// ToHTML renders Markdown as HTML.
+func ToHTML(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\r", "\n")
+	var r renderer
+	r.blocks(strings.Split(src, "\n"), 0, false)
+	return r.b.String()
+}
+
+type renderer struct {
+	b strings.Builder
+}
+
+// blocks renders lines as a sequence of blocks. In a tight list item paragraphs are
+// written without <p> tags.
+func (r *renderer) blocks(lines []string, depth int, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case fenceRX.MatchString(line):
+			i = r.fence(lines, i)
+		case headingRX.MatchString(line):
+			m := headingRX.FindStringSubmatch(line)
+			tag := "h" + strconv.Itoa(len(m[1]))
+			r.b.WriteString("<" + tag + ">")
+			r.inline(strings.TrimSpace(closingRX.ReplaceAllString(m[2], "")), false)
+			r.b.WriteString("</" + tag + ">\n")
+			i++
+		case ruleRX.MatchString(line):
+			r.b.WriteString("<hr>\n")
+			i++
+		case depth < maxDepth && quoteRX.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && quoteRX.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quoteRX.FindStringSubmatch(lines[i])[1])
+			}
+			r.b.WriteString("<blockquote>\n")
+			r.blocks(quoted, depth+1, false)
+			r.b.WriteString("</blockquote>\n")
+		case depth < maxDepth && listRX.MatchString(line):
+			i = r.list(lines, i, depth)
+		default:
+			i = r.paragraph(lines, i, depth, tight)
+		}
+	}
+}
+
+// startsBlock reports whether a line interrupts a paragraph.
+func startsBlock(line string, depth int) bool {
+	if fenceRX.MatchString(line) || headingRX.MatchString(line) || ruleRX.MatchString(line) {
+		return true
+	}
+	return depth < maxDepth && (quoteRX.MatchString(line) || listRX.MatchString(line))
+}
+
+func (r *renderer) paragraph(lines []string, i, depth int, tight bool) int {
+	text := []string{strings.TrimLeft(lines[i], " \t")}
+	for i++; i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i], depth); i++ {
+		text = append(text, strings.TrimLeft(lines[i], " \t"))
+	}
+	if !tight {
+		r.b.WriteString("<p>")
+	}
+	r.inline(strings.TrimRight(strings.Join(text, "\n"), " \t"), false)
+	if !tight {
+		r.b.WriteString("</p>")
+	}
+	r.b.WriteString("\n")
+	return i
+}
+
+// fence renders a fenced code block, which runs to its closing fence or, without one, to
+// the end of the input.
+func (r *renderer) fence(lines []string, i int) int {
+	m := fenceRX.FindStringSubmatch(lines[i])
+	closing := regexp.MustCompile(`^ {0,3}` + regexp.QuoteMeta(m[1]) + string(m[1][0]) + `*[ \t]*$`)
+	r.b.WriteString("<pre><code")
+	if language, _, _ := strings.Cut(strings.TrimSpace(m[2]), " "); languageRX.MatchString(language) {
+		r.b.WriteString(` class="language-` + html.EscapeString(language) + `"`)
+	}
+	r.b.WriteString(">")
+	for i++; i < len(lines); i++ {
+		if closing.MatchString(lines[i]) {
+			i++
+			break
+		}
+		r.b.WriteString(html.EscapeString(lines[i]) + "\n")
+	}
+	r.b.WriteString("</code></pre>\n")
+	return i
+}
+
+// list renders a list and returns the index of the line after it. An item runs on over
+// lines indented under it, as well as over lines continuing its paragraph; a blank line
+// ends it unless the next line is indented.
+func (r *renderer) list(lines []string, i, depth int) int {
+	m := listRX.FindStringSubmatch(lines[i])
+	kind := listKind(m[2])
+	if kind == "." || kind == ")" {
+		start := strings.TrimRight(m[2], ".)")
+		if n, _ := strconv.Atoi(start); n != 1 {
+			r.b.WriteString(`<ol start="` + strconv.Itoa(n) + `">` + "\n")
+		} else {
+			r.b.WriteString("<ol>\n")
+		}
+	} else {
+		r.b.WriteString("<ul>\n")
+	}
+
+	for i < len(lines) {
+		m = listRX.FindStringSubmatch(lines[i])
+		if m == nil || listKind(m[2]) != kind {
+			break
+		}
+		width := len(m[1]) + len(m[2]) + 1
+		item := []string{m[3]}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if isBlank(line) {
+				next := i + 1
+				for next < len(lines) && isBlank(lines[next]) {
+					next++
+				}
+				if next == len(lines) || indentation(lines[next]) < 2 {
+					break
+				}
+				item = append(item, "")
+				continue
+			}
+			if indentation(line) >= 2 {
+				item = append(item, outdent(line, width))
+				continue
+			}
+			if startsBlock(line, depth) {
+				break
+			}
+			item = append(item, line)
+		}
+		for i < len(lines) && isBlank(lines[i]) {
+			i++
+		}
+
+		var inner renderer
+		inner.blocks(item, depth+1, true)
+		r.b.WriteString("<li>" + strings.TrimSuffix(inner.b.String(), "\n") + "</li>\n")
+	}
+
+	if kind == "." || kind == ")" {
+		r.b.WriteString("</ol>\n")
+	} else {
+		r.b.WriteString("</ul>\n")
+	}
+	return i
+}
+
+// listKind tells lists apart: a bullet list by its bullet, and an ordered list by the
+// punctuation after its numbers.
+func listKind(marker string) string {
+	return marker[len(marker)-1:]
+}
+
+// inline renders the text of a paragraph or heading. Links aren't made inside links.
+func (r *renderer) inline(s string, inLink bool) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			r.b.WriteString("<br>\n")
+			i += 2
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			r.b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+		case c == '`':
+			i = r.codeSpan(s, i)
+		case c == ' ':
+			// Two or more spaces at the end of a line make a hard line break; spaces at
+			// the end of a line are dropped in any case.
+			j := i
+			for j < len(s) && s[j] == ' ' {
+				j++
+			}
+			switch {
+			case j == len(s):
+			case s[j] == '\n' && j-i >= 2:
+				r.b.WriteString("<br>\n")
+				j++
+			case s[j] == '\n':
+				r.b.WriteString("\n")
+				j++
+			default:
+				r.b.WriteString(s[i:j])
+			}
+			i = j
+		case c == '<' && !inLink:
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				if target := s[i+1 : i+end]; autolinkRX.MatchString(target) {
+					href := target
+					if !strings.Contains(target, ":") {
+						href = "mailto:" + target
+					}
+					r.link(href, target, true)
+					i += end + 1
+					continue
+				}
+			}
+			r.b.WriteString("&lt;")
+			i++
+		case c == '!' && i+1 < len(s) && s[i+1] == '[' && !inLink:
+			if text, href, n, ok := parseLink(s[i+1:]); ok {
+				r.link(href, text, false)
+				i += 1 + n
+				continue
+			}
+			r.b.WriteString("!")
+			i++
+		case c == '[' && !inLink:
+			if text, href, n, ok := parseLink(s[i:]); ok {
+				r.link(href, text, false)
+				i += n
+				continue
+			}
+			r.b.WriteString("[")
+			i++
+		case c == '*' || c == '_' || c == '~':
+			n := i
+			for n < len(s) && s[n] == c {
+				n++
+			}
+			if end, ok := r.emphasis(s, i, n-i, inLink); ok {
+				i = end
+				continue
+			}
+			r.b.WriteString(s[i:n])
+			i = n
+		default:
+			r.b.WriteString(html.EscapeString(s[i : i+1]))
+			i++
+		}
+	}
+}
+
+// codeSpan renders the code span starting with the run of backticks at i, which is closed
+// by a run of the same length. A run without one is written as it is.
+func (r *renderer) codeSpan(s string, i int) int {
+	n := i
+	for n < len(s) && s[n] == '`' {
+		n++
+	}
+	fence := s[i:n]
+	for j := n; j < len(s); {
+		k := strings.Index(s[j:], fence)
+		if k < 0 {
+			break
+		}
+		k += j
+		end := k + len(fence)
+		if end < len(s) && s[end] == '`' {
+			for end < len(s) && s[end] == '`' {
+				end++
+			}
+			j = end
+			continue
+		}
+		code := strings.ReplaceAll(s[n:k], "\n", " ")
+		if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+			code = code[1 : len(code)-1]
+		}
+		r.b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+		return end
+	}
+	r.b.WriteString(fence)
+	return n
+}
+
+// emphasis renders the emphasis opened by the run of n delimiters at i, if it is closed,
+// returning the index after the closing delimiter. ** and __ make strong emphasis, * and _
+// emphasis and ~~ strikethrough. Underscores only count at the edges of words, so that
+// snake_case names come out as they are.
+func (r *renderer) emphasis(s string, i, n int, inLink bool) (int, bool) {
+	c := s[i]
+	delimiter, tag := s[i:i+1], "em"
+	switch {
+	case c == '~' && n != 2:
+		return 0, false
+	case c == '~':
+		delimiter, tag = "~~", "del"
+	case n >= 2:
+		delimiter, tag = s[i:i+2], "strong"
+	}
+	if c == '_' && i > 0 && isAlnum(s[i-1]) {
+		return 0, false
+	}
+	start := i + len(delimiter)
+	if start >= len(s) || s[start] == ' ' || s[start] == '\n' {
+		return 0, false
+	}
+
+	// Runs of the delimiter after a space open emphasis nested in this one, and are
+	// matched by the next closing run of the same length. The first closing run that is
+	// left over closes this emphasis, at its end: in ***a*** the strong emphasis holds *a*.
+	var nested []int
+	for j := start + 1; j < len(s); {
+		k := strings.IndexByte(s[j:], c)
+		if k < 0 {
+			return 0, false
+		}
+		k += j
+		end := k
+		for end < len(s) && s[end] == c {
+			end++
+		}
+		j = end
+		run := end - k
+		after := byte(' ')
+		if end < len(s) {
+			after = s[end]
+		}
+		switch {
+		case isSpace(s[k-1]) && isSpace(after):
+		case isSpace(s[k-1]):
+			nested = append(nested, run)
+		case c == '_' && isAlnum(after):
+		case len(nested) > 0 && nested[len(nested)-1] == run:
+			nested = nested[:len(nested)-1]
+		case run >= len(delimiter):
+			r.b.WriteString("<" + tag + ">")
+			r.inline(s[start:end-len(delimiter)], inLink)
+			r.b.WriteString("</" + tag + ">")
+			return end, true
+		}
+	}
+	return 0, false
+}
+
+// parseLink parses an inline link, [text](destination "title"), at the start of s,
+// returning its text, its destination and its length. The title is ignored.
+func parseLink(s string) (text, href string, n int, ok bool) {
+	depth := 0
+	closeText := -1
+	for i := 0; i < len(s) && closeText < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeText = i
+			}
+		}
+	}
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return "", "", 0, false
+	}
+
+	depth = 0
+	for i := closeText + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				href = strings.TrimSpace(s[closeText+2 : i])
+				if space := strings.IndexAny(href, " \t\n"); space >= 0 {
+					href = href[:space]
+				}
+				href = strings.TrimSuffix(strings.TrimPrefix(href, "<"), ">")
+				return s[1:closeText], href, i + 1, true
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+// link writes a link, or only its text if the URL isn't one that is safe to follow.
+func (r *renderer) link(href, text string, literal bool) {
+	safe := safeURL(href)
+	if safe {
+		r.b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow">`)
+	}
+	if literal {
+		r.b.WriteString(html.EscapeString(text))
+	} else {
+		r.inline(text, true)
+	}
+	if safe {
+		r.b.WriteString("</a>")
+	}
+}
+
+// safeURL reports whether a URL uses one of the schemes links are made for. Anything
+// else, such as javascript: or data: URLs, could run code or smuggle content in.
+func safeURL(href string) bool {
+	lower := strings.ToLower(href)
+	for _, scheme := range []string{"http://", "https://", "mailto:"} {
+		if strings.HasPrefix(lower, scheme) && len(lower) > len(scheme) {
+			return !strings.ContainsAny(href, " \t\n\x00")
+		}
+	}
+	return false
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// indentation is the width of a line's leading whitespace, counting a tab as four spaces.
+func indentation(line string) int {
+	n := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			n++
+		case '\t':
+			n += 4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// outdent removes up to width columns of a line's leading whitespace.
+func outdent(line string, width int) string {
+	n := 0
+	for i, c := range line {
+		switch {
+		case n >= width:
+			return line[i:]
+		case c == ' ':
+			n++
+		case c == '\t':
+			n += 4
+		default:
+			return line[i:]
+		}
+	}
+	return ""
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
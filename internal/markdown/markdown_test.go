@@ -0,0 +1,50 @@
+package markdown
+
+import "testing"
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"link", "[x](https://example.com)", `<p><a href="https://example.com" rel="nofollow">x</a></p>` + "\n"},
+		{"emphasis", "*a* **b** ~~c~~", "<p><em>a</em> <strong>b</strong> <del>c</del></p>\n"},
+		{"snake case", "a_b_c", "<p>a_b_c</p>\n"},
+		{"code block", "```go\nx := 1\n```", `<pre><code class="language-go">x := 1` + "\n</code></pre>\n"},
+
+		// Links are only made for http, https and mailto URLs.
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"javascript link in capitals", "[x](JavaScript:alert(1))", "<p>x</p>\n"},
+		{"javascript link after a space", "[x]( javascript:alert(1))", "<p>x</p>\n"},
+		{"javascript link split by a tab", "[x](java\tscript:alert(1))", "<p>x</p>\n"},
+		{"javascript link as an entity", "[x](&#106;avascript:alert(1))", "<p>x</p>\n"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>javascript:alert(1)</p>\n"},
+		{"javascript image", "![x](javascript:alert(1))", "<p>x</p>\n"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>\n"},
+		{"vbscript link", "[x](vbscript:msgbox)", "<p>x</p>\n"},
+
+		// Raw HTML is written out as text.
+		{"script", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"event handler", "<img src=x onerror=alert(1)>", "<p>&lt;img src=x onerror=alert(1)&gt;</p>\n"},
+		{"raw link", `<a href="javascript:alert(1)">x</a>`, "<p>&lt;a href=&#34;javascript:alert(1)&#34;&gt;x&lt;/a&gt;</p>\n"},
+		{"html in a heading", "# <i>h</i>", "<h1>&lt;i&gt;h&lt;/i&gt;</h1>\n"},
+		{"html in a code span", "`<b>`", "<p><code>&lt;b&gt;</code></p>\n"},
+		{"html in a code block", "```\n<script>\n```", "<pre><code>&lt;script&gt;\n</code></pre>\n"},
+
+		// Quotes can't break out of an attribute.
+		{"quote in a link", `[x](https://e.com/"onmouseover="alert(1))`, `<p><a href="https://e.com/&#34;onmouseover=&#34;alert(1)" rel="nofollow">x</a></p>` + "\n"},
+		{"quote and title in a link", `[x](https://e.com/" onmouseover="alert(1))`, `<p><a href="https://e.com/&#34;" rel="nofollow">x</a></p>` + "\n"},
+		{"single quote in a link", "[x](https://e.com/'x)", `<p><a href="https://e.com/&#39;x" rel="nofollow">x</a></p>` + "\n"},
+		{"quote in an autolink", `<https://e.com/"onclick="x>`, `<p><a href="https://e.com/&#34;onclick=&#34;x" rel="nofollow">https://e.com/&#34;onclick=&#34;x</a></p>` + "\n"},
+		{"quote in an email autolink", `<a@b.c"onclick=x>`, `<p><a href="mailto:a@b.c&#34;onclick=x" rel="nofollow">a@b.c&#34;onclick=x</a></p>` + "\n"},
+		{"html in link text", `["><script>](https://e.com)`, `<p><a href="https://e.com" rel="nofollow">&#34;&gt;&lt;script&gt;</a></p>` + "\n"},
+		{"html in a code language", "```js\"><script>\nx\n```", "<pre><code>x\n</code></pre>\n"},
+	}
+	for _, tt := range tests {
+		got := ToHTML(tt.src)
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+// Package metrics keeps counters, gauges and histograms and writes them out in the
+// Prometheus text exposition format, for scraping.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram buckets suited to HTTP request latencies, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds the metrics to be exposed, in the order they were created.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// WritePrometheus writes every metric in the Prometheus text format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// desc is the part common to all kinds of metric: the name, help text and label names.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+}
+
+// seriesKey joins label values into a map key. The separator can't appear in valid UTF-8.
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs formats the labels of one series, with any extra pair (a histogram's le)
+// added at the end. It returns "" when there are no labels.
+func (d desc) labelPairs(values []string, extra ...string) string {
+	var pairs []string
+	for i, name := range d.labels {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (d desc) checkLabels(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+}
+
+// series holds the values of a metric for each combination of label values seen so far.
+type series[T any] struct {
+	mu     sync.Mutex
+	values map[string]*T
+	labels map[string][]string
+}
+
+func (s *series[T]) get(values []string, create func() *T) *T {
+	key := seriesKey(values)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]*T)
+		s.labels = make(map[string][]string)
+	}
+	v, found := s.values[key]
+	if !found {
+		v = create()
+		s.values[key] = v
+		s.labels[key] = append([]string(nil), values...)
+	}
+	return v
+}
+
+// each calls fn for every series in a stable order, with the series lock held.
+func (s *series[T]) each(fn func(labels []string, v *T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fn(s.labels[key], s.values[key])
+	}
+}
+
+// Counter is a value that only goes up, such as a number of requests.
+type Counter struct {
+	desc
+	series series[float64]
+}
+
+// NewCounter creates a counter with the given label names and adds it to the registry.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name: name, help: help, kind: "counter", labels: labels}}
+	if len(labels) == 0 {
+		// A metric without labels has a single series, which is exposed from the start.
+		c.series.get(nil, func() *float64 { return new(float64) })
+	}
+	r.add(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series with the given label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.checkLabels(labelValues)
+	p := c.series.get(labelValues, func() *float64 { return new(float64) })
+	c.series.mu.Lock()
+	*p += v
+	c.series.mu.Unlock()
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	c.series.each(func(labels []string, v *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(labels), formatFloat(*v))
+	})
+}
+
+// Gauge is a value that can go up and down, such as a number of requests in flight.
+type Gauge struct {
+	desc
+	series series[float64]
+}
+
+// NewGauge creates a gauge with the given label names and adds it to the registry.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{desc: desc{name: name, help: help, kind: "gauge", labels: labels}}
+	if len(labels) == 0 {
+		// A metric without labels has a single series, which is exposed from the start.
+		g.series.get(nil, func() *float64 { return new(float64) })
+	}
+	r.add(g)
+	return g
+}
+
+// Add adds v, which may be negative, to the series with the given label values.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.checkLabels(labelValues)
+	p := g.series.get(labelValues, func() *float64 { return new(float64) })
+	g.series.mu.Lock()
+	*p += v
+	g.series.mu.Unlock()
+}
+
+func (g *Gauge) Inc(labelValues ...string) { g.Add(1, labelValues...) }
+func (g *Gauge) Dec(labelValues ...string) { g.Add(-1, labelValues...) }
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	g.series.each(func(labels []string, v *float64) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelPairs(labels), formatFloat(*v))
+	})
+}
+
+// funcMetric is a metric without labels whose value is read from fn when it is scraped,
+// for values kept elsewhere, like the database connection pool statistics.
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc adds a gauge whose value is fn's result at the time of the scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.add(&funcMetric{desc: desc{name: name, help: help, kind: "gauge"}, fn: fn})
+}
+
+// NewCounterFunc adds a counter whose value is fn's result at the time of the scrape. fn
+// must never return less than it did before.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.add(&funcMetric{desc: desc{name: name, help: help, kind: "counter"}, fn: fn})
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	f.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+}
+
+// Histogram counts observations, such as request durations, in buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+	series  series[histogramValue]
+}
+
+type histogramValue struct {
+	counts []uint64 // One per bucket; an observation is counted in the first that fits.
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds, which must be
+// sorted, and label names, and adds it to the registry.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{desc: desc{name: name, help: help, kind: "histogram", labels: labels}, buckets: buckets}
+	r.add(h)
+	return h
+}
+
+// Observe records v in the series with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.checkLabels(labelValues)
+	p := h.series.get(labelValues, func() *histogramValue {
+		return &histogramValue{counts: make([]uint64, len(h.buckets))}
+	})
+	h.series.mu.Lock()
+	defer h.series.mu.Unlock()
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		p.counts[i]++
+	}
+	p.count++
+	p.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	h.series.each(func(labels []string, v *histogramValue) {
+		// Prometheus buckets are cumulative.
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += v.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(labels, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(labels, "le", "+Inf"), v.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(labels), formatFloat(v.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(labels), v.count)
+	})
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
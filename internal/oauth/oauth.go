@@ -0,0 +1,133 @@
+// Package oauth implements the parts of the OAuth 2.0 authorization code flow needed to
+// sign users in with an external identity provider: building the authorization URL,
+// exchanging the returned code for an access token, and looking up who the user is.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrExchange is returned when the provider refuses to exchange an authorization code,
+// usually because it has expired or was already used.
+var ErrExchange = errors.New("oauth: authorization code exchange failed")
+
+// Identity is what a provider tells us about the user who signed in.
+type Identity struct {
+	// Subject is the provider's stable identifier for the user. Unlike the email address
+	// it never changes, so it is what accounts are linked by.
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an OAuth 2.0 identity provider configured with our client credentials.
+type Provider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	AuthURL      string
+	TokenURL     string
+	Scopes       []string
+	Client       *http.Client
+	// identity looks up the signed-in user with an access token. Each provider has its own
+	// API for this.
+	identity func(ctx context.Context, p *Provider, accessToken string) (*Identity, error)
+}
+
+// AuthCodeURL returns the URL to send the user to in order to sign in. The state is
+// passed back to the redirect URL unchanged, and must be checked there.
+func (p *Provider) AuthCodeURL(state string) string {
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(p.Scopes, " "))
+	params.Set("state", state)
+	return p.AuthURL + "?" + params.Encode()
+}
+
+// Exchange trades an authorization code for an access token.
+func (p *Provider) Exchange(ctx context.Context, code string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub answers with a form-encoded body unless JSON is asked for.
+	req.Header.Set("Accept", "application/json")
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	// Failed exchanges come back as 400 responses from some providers and as 200s with
+	// an error field from others, so the body is decoded either way.
+	status, err := p.do(req, &body)
+	if err != nil {
+		return "", err
+	}
+	if body.Error != "" || body.AccessToken == "" {
+		return "", fmt.Errorf("%w: %d %s %s", ErrExchange, status, body.Error, body.ErrorDescription)
+	}
+	return body.AccessToken, nil
+}
+
+// Identity looks up the user that an access token belongs to.
+func (p *Provider) Identity(ctx context.Context, accessToken string) (*Identity, error) {
+	return p.identity(ctx, p, accessToken)
+}
+
+// get fetches a JSON resource from the provider's API with an access token.
+func (p *Provider) get(ctx context.Context, url, accessToken string, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	status, err := p.do(req, dst)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("oauth: GET %s: unexpected status %d", url, status)
+	}
+	return nil
+}
+
+func (p *Provider) do(req *http.Request, dst interface{}) (int, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(dst)
+	if err != nil {
+		return res.StatusCode, fmt.Errorf("oauth: decoding response from %s: %w", req.URL, err)
+	}
+	return res.StatusCode, nil
+}
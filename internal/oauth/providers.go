@@ -0,0 +1,93 @@
+package oauth
+
+import (
+	"context"
+	"strconv"
+)
+
+// Google returns a provider for signing in with a Google account. The user is looked up
+// with the OpenID Connect userinfo endpoint.
+func Google(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "google",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		Scopes:       []string{"openid", "email", "profile"},
+		identity:     googleIdentity,
+	}
+}
+
+func googleIdentity(ctx context.Context, p *Provider, accessToken string) (*Identity, error) {
+	var info struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	err := p.get(ctx, "https://openidconnect.googleapis.com/v1/userinfo", accessToken, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{
+		Subject:       info.Subject,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		Name:          info.Name,
+	}, nil
+}
+
+// GitHub returns a provider for signing in with a GitHub account.
+func GitHub(clientID, clientSecret, redirectURL string) *Provider {
+	return &Provider{
+		Name:         "github",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		Scopes:       []string{"read:user", "user:email"},
+		identity:     githubIdentity,
+	}
+}
+
+func githubIdentity(ctx context.Context, p *Provider, accessToken string) (*Identity, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	err := p.get(ctx, "https://api.github.com/user", accessToken, &user)
+	if err != nil {
+		return nil, err
+	}
+	identity := &Identity{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Name:    user.Name,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+
+	// The email on the profile is whatever the user chose to make public, and may not be
+	// verified, so the primary address is fetched separately.
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	err = p.get(ctx, "https://api.github.com/user/emails", accessToken, &emails)
+	if err != nil {
+		return nil, err
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+			break
+		}
+	}
+	return identity, nil
+}
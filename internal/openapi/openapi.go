@@ -0,0 +1,422 @@
+// Package openapi builds OpenAPI 3.0 documents in code. Operations are added one at a
+// time with a small builder, and the schemas of request and response bodies are derived
+// from Go values by reflection, following the encoding/json rules, so that they stay in
+// step with the types the handlers actually encode.
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Version is the version of the OpenAPI specification that documents follow.
+const Version = "3.0.3"
+
+// Document is an OpenAPI document. Build one with New().
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Tags       []Tag                 `json:"tags,omitempty"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+
+	// types holds the schemas given to DefineType(), and the references to the struct
+	// types that have been added to the components, by Go type.
+	types map[reflect.Type]*Schema
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations on a path, keyed by lower-case HTTP method.
+type PathItem map[string]*Operation
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	Responses       map[string]*Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// SecurityRequirement maps the names of security schemes to the scopes they need, which
+// are always empty for the schemes used here.
+type SecurityRequirement map[string][]string
+
+type Operation struct {
+	Tags        []string               `json:"tags,omitempty"`
+	Summary     string                 `json:"summary,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	OperationID string                 `json:"operationId,omitempty"`
+	Parameters  []*Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]*Response   `json:"responses"`
+	Security    *[]SecurityRequirement `json:"security,omitempty"`
+	Deprecated  bool                   `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// Response is either a response in full, or a reference to one of the components.
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Headers     map[string]*Header   `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header describes a response header.
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Schema describes a JSON value. An empty Schema allows any value.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Example              interface{}        `json:"example,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// String, Integer, Number and Boolean return schemas for the JSON scalars.
+func String() *Schema  { return &Schema{Type: "string"} }
+func Integer() *Schema { return &Schema{Type: "integer"} }
+func Number() *Schema  { return &Schema{Type: "number"} }
+func Boolean() *Schema { return &Schema{Type: "boolean"} }
+
+// Enum returns a schema for a string that must be one of values.
+func Enum(values ...string) *Schema {
+	return &Schema{Type: "string", Enum: values}
+}
+
+// ArrayOf returns a schema for an array of items.
+func ArrayOf(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// MapOf returns a schema for an object with arbitrary keys and values of one kind.
+func MapOf(values *Schema) *Schema {
+	return &Schema{Type: "object", AdditionalProperties: values}
+}
+
+// Object returns a schema for an object with the given properties.
+func Object(properties map[string]*Schema) *Schema {
+	return &Schema{Type: "object", Properties: properties}
+}
+
+// Describe sets the description of a schema and returns it, for use in expressions.
+func (s *Schema) Describe(description string) *Schema {
+	s.Description = description
+	return s
+}
+
+// New returns an empty document.
+func New(title, version string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			Responses:       make(map[string]*Response),
+			SecuritySchemes: make(map[string]*SecurityScheme),
+		},
+		types: map[reflect.Type]*Schema{
+			reflect.TypeOf(time.Time{}):          {Type: "string", Format: "date-time"},
+			reflect.TypeOf(json.RawMessage{}):    {Description: "Any JSON value."},
+			reflect.TypeOf(time.Duration(0)):     {Type: "integer", Format: "int64", Description: "A duration in nanoseconds."},
+			reflect.TypeOf((*error)(nil)).Elem(): {},
+		},
+	}
+}
+
+// DefineType sets the schema used for the type of v, for types whose JSON encoding isn't
+// what reflection would suggest, such as those with a MarshalJSON() method, or which
+// deserve a description or an enum. If name is set the schema is added to the components
+// and referred to by name.
+func (d *Document) DefineType(v interface{}, name string, s *Schema) {
+	t := reflect.TypeOf(v)
+	if name == "" {
+		d.types[t] = s
+		return
+	}
+	d.Components.Schemas[name] = s
+	d.types[t] = &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// SchemaOf returns the schema of the JSON encoding of v. A *Schema is returned as it is,
+// which lets callers mix Go values and hand-written schemas. Named struct types are
+// added to the components and referred to, so that each is only described once.
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	if s, ok := v.(*Schema); ok {
+		return s
+	}
+	if v == nil {
+		return &Schema{}
+	}
+	return d.schemaOf(reflect.TypeOf(v))
+}
+
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	if s, ok := d.types[t]; ok {
+		copied := *s
+		return &copied
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return Boolean()
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return Number()
+	case reflect.String:
+		return String()
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Pointer:
+		s := d.schemaOf(t.Elem())
+		// Siblings of $ref are ignored, so a nullable reference has to be wrapped.
+		if s.Ref != "" {
+			return &Schema{AllOf: []*Schema{s}, Nullable: true}
+		}
+		s.Nullable = true
+		return s
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return ArrayOf(d.schemaOf(t.Elem()))
+	case reflect.Map:
+		return MapOf(d.schemaOf(t.Elem()))
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		name := componentName(t)
+		ref := &Schema{Ref: "#/components/schemas/" + name}
+		// Register the reference before describing the fields, so that recursive types
+		// (such as a tree node holding its children) refer to themselves.
+		d.types[t] = ref
+		d.Components.Schemas[name] = d.structSchema(t)
+		copied := *ref
+		return &copied
+	}
+	return &Schema{}
+}
+
+// structSchema describes the JSON object that a struct is encoded as, including the
+// fields of embedded structs.
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := Object(make(map[string]*Schema))
+	d.addFields(s, t)
+	return s
+}
+
+func (d *Document) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				d.addFields(s, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		// Fields of the outer struct hide those of embedded ones, as in encoding/json.
+		if _, ok := s.Properties[name]; ok && len(field.Index) > 1 {
+			continue
+		}
+		s.Properties[name] = d.schemaOf(field.Type)
+	}
+}
+
+// componentName turns the name of a Go type into the name of a schema component, which
+// is capitalised even for unexported types.
+func componentName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+// Add adds an operation to the document. The path is given in httprouter syntax, such as
+// /v1/tasks/:id, and its parameters are declared as strings unless op already declares
+// them.
+func (d *Document) Add(method, path string, op *Operation) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		name, ok := strings.CutPrefix(segment, ":")
+		if !ok {
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		if op.param("path", name) == nil {
+			op.Parameters = append(op.Parameters, &Parameter{Name: name, In: "path", Required: true, Schema: String()})
+		}
+	}
+	path = strings.Join(segments, "/")
+
+	item, ok := d.Paths[path]
+	if !ok {
+		item = make(PathItem)
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+// NewOperation returns an operation with a summary and tags, ready to be filled in with
+// its builder methods and added with Document.Add().
+func NewOperation(summary string, tags ...string) *Operation {
+	return &Operation{Summary: summary, Tags: tags, Responses: make(map[string]*Response)}
+}
+
+func (o *Operation) param(in, name string) *Parameter {
+	for _, p := range o.Parameters {
+		if p.In == in && p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Param adds a parameter. in is "path", "query" or "header"; path parameters are always
+// required.
+func (o *Operation) Param(in, name string, schema *Schema, description string) *Operation {
+	o.Parameters = append(o.Parameters, &Parameter{Name: name, In: in, Description: description, Required: in == "path", Schema: schema})
+	return o
+}
+
+// Describe sets the longer description of the operation.
+func (o *Operation) Describe(description string) *Operation {
+	o.Description = description
+	return o
+}
+
+// Body sets the JSON request body.
+func (o *Operation) Body(schema *Schema) *Operation {
+	return o.BodyAs("application/json", schema)
+}
+
+// BodyAs sets a request body of the given media type. It can be called more than once
+// for operations that accept several.
+func (o *Operation) BodyAs(mediaType string, schema *Schema) *Operation {
+	if o.RequestBody == nil {
+		o.RequestBody = &RequestBody{Required: true, Content: make(map[string]MediaType)}
+	}
+	o.RequestBody.Content[mediaType] = MediaType{Schema: schema}
+	return o
+}
+
+// Returns adds a JSON response.
+func (o *Operation) Returns(status int, description string, schema *Schema) *Operation {
+	return o.ReturnsAs(status, description, "application/json", schema)
+}
+
+// ReturnsAs adds a response of the given media type. It can be called more than once for
+// the same status, for operations that can produce several. A nil schema means that the
+// response has no body, such as a redirect.
+func (o *Operation) ReturnsAs(status int, description, mediaType string, schema *Schema) *Operation {
+	key := strconv.Itoa(status)
+	response, ok := o.Responses[key]
+	if !ok || response.Ref != "" {
+		response = &Response{Description: description}
+		o.Responses[key] = response
+	}
+	if schema == nil {
+		return o
+	}
+	if response.Content == nil {
+		response.Content = make(map[string]MediaType)
+	}
+	response.Content[mediaType] = MediaType{Schema: schema}
+	return o
+}
+
+// ReturnsRef adds a response described by one of the document's response components,
+// unless the operation already has its own for that status.
+func (o *Operation) ReturnsRef(status int, name string) *Operation {
+	key := strconv.Itoa(status)
+	if _, ok := o.Responses[key]; !ok {
+		o.Responses[key] = &Response{Ref: "#/components/responses/" + name}
+	}
+	return o
+}
+
+// Secure sets the ways in which the operation can be authenticated, in place of the
+// document's defaults. With no requirements the operation needs no authentication.
+func (o *Operation) Secure(requirements ...SecurityRequirement) *Operation {
+	if requirements == nil {
+		requirements = []SecurityRequirement{}
+	}
+	o.Security = &requirements
+	return o
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Memory keeps the token buckets in memory, so limits only apply within one process.
+type Memory struct {
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewMemory returns an in-memory limiter. It starts a background goroutine which forgets
+// clients that haven't been seen for three minutes.
+func NewMemory() *Memory {
+	m := &Memory{clients: make(map[string]*client)}
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			m.mu.Lock()
+			for key, client := range m.clients {
+				if time.Since(client.lastSeen) > 3*time.Minute {
+					delete(m.clients, key)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}()
+	return m
+}
+
+func (m *Memory) Allow(key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, found := m.clients[key]
+	if !found {
+		c = &client{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)}
+		m.clients[key] = c
+	}
+	now := time.Now()
+	c.lastSeen = now
+
+	allowed := c.limiter.AllowN(now, 1)
+	return newResult(allowed, c.limiter.TokensAt(now), limit), nil
+}
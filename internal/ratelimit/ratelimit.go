@@ -0,0 +1,54 @@
+// Package ratelimit implements token bucket rate limiting with interchangeable backends:
+// an in-memory one for a single API instance, and a Redis one which shares the limits
+// between all the instances that use the same Redis server.
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Limit is a token bucket: requests may be made at Rate per second on average, with
+// bursts of up to Burst requests.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of a rate limit check.
+type Result struct {
+	Allowed bool
+	// Limit is the size of the bucket and Remaining how many requests can be made right
+	// away.
+	Limit     int
+	Remaining int
+	// Reset is how long it takes until the full burst is available again, and
+	// RetryAfter how long to wait for the next request to be allowed.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter checks requests against rate limits. Keys name the client being limited, and
+// the same key must always be used with the same limit.
+type Limiter interface {
+	Allow(key string, limit Limit) (Result, error)
+}
+
+// newResult builds a Result from the number of tokens left in the bucket after the
+// request.
+func newResult(allowed bool, tokens float64, limit Limit) Result {
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Max(tokens, 0)),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Max(s, 0) * float64(time.Second))
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/zarinakolybaeva/DoMake/internal/redis"
+)
+
+// tokenBucketScript refills and takes from a token bucket kept in a Redis hash, in one
+// atomic step. The time comes from the Redis server, so that instances with different
+// clocks agree (calling TIME before writing needs Redis 5 or later). The bucket expires
+// once it would be full again anyway.
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+	tokens = burst
+	ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+// Redis keeps the token buckets in Redis, so that every API instance using the same
+// server shares the limits.
+type Redis struct {
+	client *redis.Client
+	// prefix namespaces the keys, in case the Redis server is shared with other uses.
+	prefix string
+}
+
+// NewRedis returns a limiter which keeps its token buckets on the given Redis server.
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client, prefix: "ratelimit:"}
+}
+
+func (rl *Redis) Allow(key string, limit Limit) (Result, error) {
+	reply, err := rl.client.Do("EVAL", tokenBucketScript, "1", rl.prefix+key,
+		strconv.FormatFloat(limit.Rate, 'f', -1, 64), strconv.Itoa(limit.Burst))
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply from redis: %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	tokens, err := strconv.ParseFloat(fmt.Sprint(values[1]), 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply from redis: %v", reply)
+	}
+	return newResult(allowed == 1, tokens, limit), nil
+}
@@ -0,0 +1,182 @@
+// Package redis is a minimal Redis client. It speaks just enough of the Redis protocol
+// (RESP) to send commands and read their replies, which is all the rate limiter and the
+// cache need.
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Client sends commands to a Redis server, over a small pool of connections.
+type Client struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration
+	// pool holds idle connections. Connections that fail are closed rather than put
+	// back.
+	pool chan *conn
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Error is an error reply from the server.
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// New returns a client for the Redis server at addr, and checks that the server can be
+// reached.
+func New(addr, password string, db int) (*Client, error) {
+	c := &Client{
+		addr:     addr,
+		password: password,
+		db:       db,
+		timeout:  time.Second,
+		pool:     make(chan *conn, 16),
+	}
+	err := c.Ping()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Do sends a command and returns its reply: a string, an int64, nil or a slice of those.
+// Error replies are returned as an Error.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(c.timeout, args...)
+	var redisErr Error
+	if err != nil && !errors.As(err, &redisErr) {
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Ping checks that the server can still be reached.
+func (c *Client) Ping() error {
+	_, err := c.Do("PING")
+	return err
+}
+
+func (c *Client) get() (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+	}
+
+	nc, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc)}
+	if c.password != "" {
+		_, err = cn.do(c.timeout, "AUTH", c.password)
+	}
+	if err == nil && c.db != 0 {
+		_, err = cn.do(c.timeout, "SELECT", strconv.Itoa(c.db))
+	}
+	if err != nil {
+		cn.Close()
+		return nil, err
+	}
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+func (c *conn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	err := c.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	// Commands are sent as an array of bulk strings.
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"+arg+"\r\n"...)
+	}
+	_, err = c.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *conn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, Error(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		_, err = io.ReadFull(c.r, data)
+		if err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			values[i], err = c.readReply()
+			if err != nil {
+				// The rest of the array hasn't been read, so the connection can't be
+				// used again even if this was an error reply.
+				return nil, fmt.Errorf("redis: reading array reply: %s", err)
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+	}
+}
@@ -0,0 +1,334 @@
+// Package rrule implements the subset of the iCalendar recurrence rule syntax
+// (RFC 5545, section 3.3.10) that DoMake needs for repeating tasks, e.g.
+//
+//	FREQ=DAILY
+//	FREQ=WEEKLY;INTERVAL=2;BYDAY=TU
+//	FREQ=MONTHLY;BYDAY=2TU
+//	FREQ=MONTHLY;BYMONTHDAY=1,-1;UNTIL=20301231T000000Z
+//	FREQ=YEARLY;COUNT=5
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Define the supported recurrence frequencies.
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// maxPeriods bounds the search for the next occurrence, so that a rule which can
+// never match (e.g. BYMONTHDAY=31 with FREQ=YEARLY in February) doesn't spin forever.
+const maxPeriods = 1000
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// WeekdayNum is a BYDAY entry: a weekday with an optional ordinal, so that "2TU"
+// means the second Tuesday and "-1FR" the last Friday of the period.
+type WeekdayNum struct {
+	N       int
+	Weekday time.Weekday
+}
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+}
+
+// Parse parses a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU". An optional
+// "RRULE:" prefix is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, ErrInvalidRule
+	}
+
+	rule := &Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		key, value, found := strings.Cut(part, "=")
+		if !found || value == "" {
+			return nil, fmt.Errorf("%w: malformed part %q", ErrInvalidRule, part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			value = strings.ToUpper(value)
+			switch value {
+			case Daily, Weekly, Monthly, Yearly:
+				rule.Freq = value
+			default:
+				return nil, fmt.Errorf("%w: unsupported FREQ %q", ErrInvalidRule, value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("%w: INTERVAL must be a positive integer", ErrInvalidRule)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("%w: COUNT must be a positive integer", ErrInvalidRule)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: UNTIL must be a date or UTC date-time", ErrInvalidRule)
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(value), ",") {
+				wd, err := parseWeekdayNum(day)
+				if err != nil {
+					return nil, err
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("%w: invalid BYMONTHDAY %q", ErrInvalidRule, day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unsupported part %q", ErrInvalidRule, key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, fmt.Errorf("%w: COUNT and UNTIL are mutually exclusive", ErrInvalidRule)
+	}
+	for _, wd := range rule.ByDay {
+		if wd.N != 0 && rule.Freq != Monthly {
+			return nil, fmt.Errorf("%w: BYDAY ordinals are only supported with FREQ=MONTHLY", ErrInvalidRule)
+		}
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq != Monthly {
+		return nil, fmt.Errorf("%w: BYMONTHDAY is only supported with FREQ=MONTHLY", ErrInvalidRule)
+	}
+	return rule, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, ErrInvalidRule
+}
+
+func parseWeekdayNum(s string) (WeekdayNum, error) {
+	if len(s) < 2 {
+		return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, s)
+	}
+	weekday, ok := weekdays[s[len(s)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, s)
+	}
+	wd := WeekdayNum{Weekday: weekday}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayNum{}, fmt.Errorf("%w: invalid BYDAY %q", ErrInvalidRule, s)
+		}
+		wd.N = n
+	}
+	return wd, nil
+}
+
+// String formats the rule back into its canonical RRULE form.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = strings.ToUpper(wd.Weekday.String()[:2])
+			if wd.N != 0 {
+				days[i] = strconv.Itoa(wd.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence strictly after dtstart, where dtstart is the
+// date of the current occurrence. The time of day is taken from dtstart. The
+// boolean result is false when the series has ended (UNTIL passed or COUNT
+// exhausted). Callers that store the rule alongside the new occurrence should
+// store Remaining() rather than the original rule, so that COUNT keeps shrinking.
+func (r *Rule) Next(dtstart time.Time) (time.Time, bool) {
+	if r.Count == 1 {
+		return time.Time{}, false
+	}
+
+	for period := 0; period < maxPeriods; period++ {
+		var best time.Time
+		for _, candidate := range r.candidates(dtstart, period*r.Interval) {
+			if !candidate.After(dtstart) {
+				continue
+			}
+			if best.IsZero() || candidate.Before(best) {
+				best = candidate
+			}
+		}
+		if best.IsZero() {
+			continue
+		}
+		if !r.Until.IsZero() && best.After(r.Until) {
+			return time.Time{}, false
+		}
+		return best, true
+	}
+	return time.Time{}, false
+}
+
+// Remaining returns the rule that applies to the occurrence after this one.
+func (r *Rule) Remaining() *Rule {
+	next := *r
+	if next.Count > 1 {
+		next.Count--
+	}
+	return &next
+}
+
+// candidates returns every occurrence in the period which is offset periods after
+// the one containing dtstart.
+func (r *Rule) candidates(dtstart time.Time, offset int) []time.Time {
+	y, m, d := dtstart.Date()
+	hh, mm, ss := dtstart.Clock()
+	loc := dtstart.Location()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hh, mm, ss, 0, loc)
+	}
+
+	switch r.Freq {
+	case Daily:
+		day := at(y, m, d+offset)
+		if len(r.ByDay) > 0 && !r.matchesWeekday(day.Weekday()) {
+			return nil
+		}
+		return []time.Time{day}
+
+	case Weekly:
+		// Weeks start on Monday, as in the RFC default (WKST=MO).
+		monday := at(y, m, d-(int(dtstart.Weekday())+6)%7+7*offset)
+		if len(r.ByDay) == 0 {
+			return []time.Time{at(y, m, d+7*offset)}
+		}
+		var days []time.Time
+		for _, wd := range r.ByDay {
+			days = append(days, monday.AddDate(0, 0, (int(wd.Weekday)+6)%7))
+		}
+		return days
+
+	case Monthly:
+		first := at(y, m+time.Month(offset), 1)
+		year, month := first.Year(), first.Month()
+		last := daysIn(year, month)
+
+		var days []time.Time
+		for _, md := range r.ByMonthDay {
+			day := md
+			if md < 0 {
+				day = last + md + 1
+			}
+			if day >= 1 && day <= last {
+				days = append(days, at(year, month, day))
+			}
+		}
+		for _, wd := range r.ByDay {
+			days = append(days, weekdaysInMonth(first, last, wd)...)
+		}
+		if len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 && d <= last {
+			days = append(days, at(year, month, d))
+		}
+		return days
+
+	case Yearly:
+		year := y + offset
+		if d > daysIn(year, m) {
+			return nil
+		}
+		return []time.Time{at(year, m, d)}
+	}
+	return nil
+}
+
+func (r *Rule) matchesWeekday(weekday time.Weekday) bool {
+	for _, wd := range r.ByDay {
+		if wd.Weekday == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// weekdaysInMonth returns the days in the month starting at first which match wd.
+// With an ordinal only the n-th (or n-th from last) matching day is returned.
+func weekdaysInMonth(first time.Time, last int, wd WeekdayNum) []time.Time {
+	var matches []time.Time
+	for day := first; day.Day() <= last && day.Month() == first.Month(); day = day.AddDate(0, 0, 1) {
+		if day.Weekday() == wd.Weekday {
+			matches = append(matches, day)
+		}
+	}
+	switch {
+	case wd.N > 0 && wd.N <= len(matches):
+		return matches[wd.N-1 : wd.N]
+	case wd.N < 0 && -wd.N <= len(matches):
+		return matches[len(matches)+wd.N : len(matches)+wd.N+1]
+	case wd.N != 0:
+		return nil
+	}
+	return matches
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,81 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamAVChunkSize is the size of the chunks a file is streamed to clamd in.
+const clamAVChunkSize = 64 << 10
+
+// ClamAV scans files with clamd, the ClamAV daemon, using its INSTREAM command.
+type ClamAV struct {
+	network string
+	addr    string
+	timeout time.Duration
+}
+
+// NewClamAV returns a Scanner for the clamd listening on addr: a host and port such as
+// localhost:3310, or the path of its Unix socket as unix:/run/clamav/clamd.ctl. Each scan
+// is given up to timeout.
+func NewClamAV(addr string, timeout time.Duration) *ClamAV {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return &ClamAV{network: "unix", addr: path, timeout: timeout}
+	}
+	return &ClamAV{network: "tcp", addr: addr, timeout: timeout}
+}
+
+// Scan streams content to clamd and reads its verdict, which is "stream: OK" for a clean
+// file and "stream: <virus> FOUND" for an infected one.
+func (c *ClamAV) Scan(ctx context.Context, content []byte) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.addr)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamav: %w", err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamav: %w", err)
+	}
+
+	// The command is prefixed with z to end it, and the reply, with a null byte. The file
+	// follows in chunks, each preceded by its length, and ends with an empty chunk.
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+	for len(content) > 0 {
+		chunk := content[:min(len(content), clamAVChunkSize)]
+		content = content[len(chunk):]
+		binary.Write(w, binary.BigEndian, uint32(len(chunk)))
+		w.Write(chunk)
+	}
+	binary.Write(w, binary.BigEndian, uint32(0))
+	err = w.Flush()
+	if err != nil {
+		return Result{}, fmt.Errorf("clamav: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamav: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimSuffix(reply, "\x00"))
+	verdict, _ := strings.CutPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return Result{Clean: true}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Reason: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("clamav: %s", reply)
+	}
+}
@@ -0,0 +1,56 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTP scans files with an external service, which is sent each file as the body of a
+// POST request and answers 200 OK with a JSON object such as {"clean": false, "reason":
+// "Eicar-Test-Signature"}. Any other response is an error.
+type HTTP struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTP returns a Scanner for the service at url. Each scan is given up to timeout.
+func NewHTTP(url string, timeout time.Duration) *HTTP {
+	return &HTTP{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *HTTP) Scan(ctx context.Context, content []byte) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(content))
+	if err != nil {
+		return Result{}, fmt.Errorf("scanner: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("scanner: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("scanner: unexpected response %s", res.Status)
+	}
+
+	var verdict struct {
+		Clean  *bool  `json:"clean"`
+		Reason string `json:"reason"`
+	}
+	err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&verdict)
+	if err != nil {
+		return Result{}, fmt.Errorf("scanner: decoding the response: %w", err)
+	}
+	if verdict.Clean == nil {
+		return Result{}, errors.New(`scanner: the response has no "clean" field`)
+	}
+	return Result{Clean: *verdict.Clean, Reason: verdict.Reason}, nil
+}
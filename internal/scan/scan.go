@@ -0,0 +1,70 @@
+// Package scan checks uploaded files before they are let out of quarantine. A Scanner
+// looks at the content of a file and says whether it is clean: Executables does so by
+// the file's type, while ClamAV and HTTP hand the file to a virus scanner.
+package scan
+
+import (
+	"bytes"
+	"context"
+)
+
+// Result is what a scan found.
+type Result struct {
+	Clean bool
+	// Reason says what was found in a file that isn't clean, such as the name of a virus.
+	Reason string
+}
+
+// Scanner checks the content of a file. An error means that the file couldn't be
+// scanned, for example because the virus scanner can't be reached, and says nothing about
+// the file; it should be scanned again later.
+type Scanner interface {
+	Scan(ctx context.Context, content []byte) (Result, error)
+}
+
+// All returns a Scanner which runs each of scanners in turn, until one of them finds
+// something.
+func All(scanners ...Scanner) Scanner {
+	return all(scanners)
+}
+
+type all []Scanner
+
+func (scanners all) Scan(ctx context.Context, content []byte) (Result, error) {
+	for _, scanner := range scanners {
+		result, err := scanner.Scan(ctx, content)
+		if err != nil || !result.Clean {
+			return result, err
+		}
+	}
+	return Result{Clean: true}, nil
+}
+
+// executableTypes are the magic numbers at the start of the programs and scripts that
+// Executables refuses.
+var executableTypes = []struct {
+	magic       string
+	description string
+}{
+	{"MZ", "Windows executable"},
+	{"\x7fELF", "ELF executable"},
+	{"\xfe\xed\xfa\xce", "Mach-O executable"},
+	{"\xfe\xed\xfa\xcf", "Mach-O executable"},
+	{"\xce\xfa\xed\xfe", "Mach-O executable"},
+	{"\xcf\xfa\xed\xfe", "Mach-O executable"},
+	{"\xca\xfe\xba\xbe", "Mach-O universal binary or Java class"},
+	{"#!", "script"},
+}
+
+// Executables is a Scanner which refuses programs and scripts, whatever their file name
+// says, since an attachment is there to be read rather than run.
+type Executables struct{}
+
+func (Executables) Scan(ctx context.Context, content []byte) (Result, error) {
+	for _, t := range executableTypes {
+		if bytes.HasPrefix(content, []byte(t.magic)) {
+			return Result{Reason: t.description}, nil
+		}
+	}
+	return Result{Clean: true}, nil
+}
@@ -0,0 +1,186 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// eicar stands in for an infected file in the fake scanners below.
+var eicar = []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+func TestExecutables(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		clean   bool
+	}{
+		{"text", "hello world", true},
+		{"png", "\x89PNG\r\n\x1a\n", true},
+		{"empty", "", true},
+		{"windows", "MZ\x90\x00", false},
+		{"elf", "\x7fELF\x02\x01\x01", false},
+		{"mach-o", "\xcf\xfa\xed\xfe", false},
+		{"script", "#!/bin/sh\nrm -rf /\n", false},
+		{"magic later on", "text, then MZ", true},
+	}
+	for _, tt := range tests {
+		result, err := Executables{}.Scan(context.Background(), []byte(tt.content))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if result.Clean != tt.clean || (!result.Clean && result.Reason == "") {
+			t.Errorf("%s: got %+v, want clean %t with a reason if not", tt.name, result, tt.clean)
+		}
+	}
+}
+
+// fakeClamd serves the INSTREAM command like clamd, finding eicar, and returns its
+// address.
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				command, err := r.ReadString(0)
+				if err != nil || command != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				var content []byte
+				for {
+					var size uint32
+					err = binary.Read(r, binary.BigEndian, &size)
+					if err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					chunk := make([]byte, size)
+					_, err = io.ReadFull(r, chunk)
+					if err != nil {
+						return
+					}
+					content = append(content, chunk...)
+				}
+				if bytes.Contains(content, []byte("EICAR")) {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					return
+				}
+				conn.Write([]byte("stream: OK\x00"))
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestClamAV(t *testing.T) {
+	scanner := NewClamAV(fakeClamd(t), time.Second)
+
+	// More than one chunk, to check that they are put back together.
+	large := bytes.Repeat([]byte("a"), 3*clamAVChunkSize+1)
+	tests := []struct {
+		name    string
+		content []byte
+		want    Result
+	}{
+		{"clean", []byte("hello world"), Result{Clean: true}},
+		{"large", large, Result{Clean: true}},
+		{"infected", eicar, Result{Reason: "Eicar-Test-Signature"}},
+		{"infected at the end", append(large, eicar...), Result{Reason: "Eicar-Test-Signature"}},
+	}
+	for _, tt := range tests {
+		result, err := scanner.Scan(context.Background(), tt.content)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if result != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, result, tt.want)
+		}
+	}
+
+	// A scanner that can't be reached is an error, not a verdict.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	_, err = NewClamAV(addr, time.Second).Scan(context.Background(), []byte("hello"))
+	if err == nil {
+		t.Error("unreachable: got no error")
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		switch {
+		case bytes.Equal(content, []byte("broken")):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case bytes.Equal(content, []byte("no verdict")):
+			w.Write([]byte(`{}`))
+		case bytes.Contains(content, []byte("EICAR")):
+			w.Write([]byte(`{"clean": false, "reason": "Eicar-Test-Signature"}`))
+		default:
+			w.Write([]byte(`{"clean": true}`))
+		}
+	}))
+	defer server.Close()
+	scanner := NewHTTP(server.URL, time.Second)
+
+	tests := []struct {
+		name    string
+		content string
+		want    Result
+		wantErr bool
+	}{
+		{"clean", "hello world", Result{Clean: true}, false},
+		{"infected", string(eicar), Result{Reason: "Eicar-Test-Signature"}, false},
+		{"error response", "broken", Result{}, true},
+		{"no verdict", "no verdict", Result{}, true},
+	}
+	for _, tt := range tests {
+		result, err := scanner.Scan(context.Background(), []byte(tt.content))
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: got error %v, want one: %t", tt.name, err, tt.wantErr)
+		}
+		if result != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, result, tt.want)
+		}
+	}
+}
+
+func TestAll(t *testing.T) {
+	scanner := All(Executables{}, NewHTTP("http://127.0.0.1:1", time.Second))
+
+	// The executable is refused before the unreachable scanner is tried.
+	result, err := scanner.Scan(context.Background(), []byte("MZ"))
+	if err != nil || result.Clean {
+		t.Errorf("executable: got %+v, %v, want it refused", result, err)
+	}
+	_, err = scanner.Scan(context.Background(), []byte("hello"))
+	if err == nil {
+		t.Error("unreachable: got no error")
+	}
+}
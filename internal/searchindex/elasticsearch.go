@@ -0,0 +1,172 @@
+package searchindex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Elasticsearch keeps the tasks in an Elasticsearch (or OpenSearch) index. It
+// authenticates with an API key if given one; basic auth credentials can be put in the
+// URL instead.
+type Elasticsearch struct {
+	baseURL string
+	apiKey  string
+	index   string
+}
+
+func NewElasticsearch(baseURL, apiKey, index string) *Elasticsearch {
+	return &Elasticsearch{baseURL: strings.TrimSuffix(baseURL, "/"), apiKey: apiKey, index: index}
+}
+
+func (e *Elasticsearch) call(ctx context.Context, method, path, contentType string, body, dst interface{}) error {
+	authorization := ""
+	if e.apiKey != "" {
+		authorization = "ApiKey " + e.apiKey
+	}
+	return call(ctx, "elasticsearch", method, e.baseURL+path, authorization, contentType, body, dst)
+}
+
+func (e *Elasticsearch) Setup(ctx context.Context) error {
+	err := e.call(ctx, http.MethodHead, "/"+url.PathEscape(e.index), "", nil, nil)
+	if !errors.Is(err, errNotFound) {
+		return err
+	}
+	// The workspace ID is only ever filtered on, so it is a keyword rather than a number.
+	mapping := map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"workspace_id": map[string]string{"type": "keyword"},
+				"title":        map[string]string{"type": "text"},
+				"description":  map[string]string{"type": "text"},
+			},
+		},
+	}
+	return e.call(ctx, http.MethodPut, "/"+url.PathEscape(e.index), "application/json", mapping, nil)
+}
+
+func (e *Elasticsearch) Recreate(ctx context.Context) error {
+	err := e.call(ctx, http.MethodDelete, "/"+url.PathEscape(e.index), "", nil, nil)
+	if err != nil && !errors.Is(err, errNotFound) {
+		return err
+	}
+	return e.Setup(ctx)
+}
+
+func (e *Elasticsearch) Upsert(ctx context.Context, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, doc := range docs {
+		enc.Encode(map[string]interface{}{"index": e.target(doc.ID)})
+		enc.Encode(doc)
+	}
+	return e.bulk(ctx, b.Bytes())
+}
+
+func (e *Elasticsearch) Delete(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, id := range ids {
+		enc.Encode(map[string]interface{}{"delete": e.target(id)})
+	}
+	return e.bulk(ctx, b.Bytes())
+}
+
+func (e *Elasticsearch) target(id int64) map[string]string {
+	return map[string]string{"_index": e.index, "_id": strconv.FormatInt(id, 10)}
+}
+
+// bulk sends a request to the bulk API. It answers 200 even when some of the actions
+// failed, so the items have to be checked. Deleting a document that isn't there isn't
+// counted as a failure.
+func (e *Elasticsearch) bulk(ctx context.Context, body []byte) error {
+	var res struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	err := e.call(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body, &res)
+	if err != nil || !res.Errors {
+		return err
+	}
+	for _, item := range res.Items {
+		for action, result := range item {
+			if result.Error != nil {
+				return fmt.Errorf("elasticsearch: %s failed: %s: %s", action, result.Error.Type, result.Error.Reason)
+			}
+		}
+	}
+	return nil
+}
+
+// Search matches each word of q in the title or description, the last word as a prefix
+// so that results show up while it is still being typed. Typos are allowed for, and
+// matches in the title count double.
+func (e *Elasticsearch) Search(ctx context.Context, workspaceID int64, q string, limit int) ([]int64, int, error) {
+	query := map[string]interface{}{
+		"size":             limit,
+		"_source":          false,
+		"track_total_hits": true,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":     q,
+						"type":      "bool_prefix",
+						"fields":    []string{"title^2", "description"},
+						"operator":  "and",
+						"fuzziness": "AUTO",
+					},
+				},
+				"filter": map[string]interface{}{
+					"term": map[string]string{"workspace_id": strconv.FormatInt(workspaceID, 10)},
+				},
+			},
+		},
+	}
+	var res struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err := e.call(ctx, http.MethodPost, "/"+url.PathEscape(e.index)+"/_search", "application/json", query, &res)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]int64, 0, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		id, err := strconv.ParseInt(hit.ID, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("elasticsearch: unexpected document ID %q", hit.ID)
+		}
+		ids = append(ids, id)
+	}
+	return ids, res.Hits.Total.Value, nil
+}
+
+func (e *Elasticsearch) Ping(ctx context.Context) error {
+	return e.call(ctx, http.MethodGet, "/", "", nil, nil)
+}
@@ -0,0 +1,104 @@
+package searchindex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Meilisearch keeps the tasks in a Meilisearch index, authenticating with an API key if
+// given one. Meilisearch applies changes asynchronously, so a task may take a moment to
+// show up in searches after it was written.
+type Meilisearch struct {
+	baseURL string
+	apiKey  string
+	index   string
+}
+
+func NewMeilisearch(baseURL, apiKey, index string) *Meilisearch {
+	return &Meilisearch{baseURL: strings.TrimSuffix(baseURL, "/"), apiKey: apiKey, index: index}
+}
+
+func (m *Meilisearch) call(ctx context.Context, method, path string, body, dst interface{}) error {
+	authorization := ""
+	if m.apiKey != "" {
+		authorization = "Bearer " + m.apiKey
+	}
+	return call(ctx, "meilisearch", method, m.baseURL+path, authorization, "application/json", body, dst)
+}
+
+func (m *Meilisearch) indexPath() string {
+	return "/indexes/" + url.PathEscape(m.index)
+}
+
+// Setup asks for the index to be created, which fails harmlessly in the background if it
+// already exists, and for the workspace ID to be filterable, which Search needs.
+func (m *Meilisearch) Setup(ctx context.Context) error {
+	err := m.call(ctx, http.MethodPost, "/indexes", map[string]string{"uid": m.index, "primaryKey": "id"}, nil)
+	if err != nil {
+		return err
+	}
+	settings := map[string]interface{}{
+		"filterableAttributes": []string{"workspace_id"},
+		"searchableAttributes": []string{"title", "description"},
+	}
+	return m.call(ctx, http.MethodPatch, m.indexPath()+"/settings", settings, nil)
+}
+
+// Recreate relies on Meilisearch carrying out the tasks it is given in order, so that the
+// index is deleted before it is created again.
+func (m *Meilisearch) Recreate(ctx context.Context) error {
+	err := m.call(ctx, http.MethodDelete, m.indexPath(), nil, nil)
+	if err != nil && !errors.Is(err, errNotFound) {
+		return err
+	}
+	return m.Setup(ctx)
+}
+
+func (m *Meilisearch) Upsert(ctx context.Context, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	return m.call(ctx, http.MethodPost, m.indexPath()+"/documents?primaryKey=id", docs, nil)
+}
+
+func (m *Meilisearch) Delete(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return m.call(ctx, http.MethodPost, m.indexPath()+"/documents/delete-batch", ids, nil)
+}
+
+// Search uses Meilisearch's default matching, which allows for typos and treats the last
+// word as a prefix. The total is Meilisearch's estimate.
+func (m *Meilisearch) Search(ctx context.Context, workspaceID int64, q string, limit int) ([]int64, int, error) {
+	query := map[string]interface{}{
+		"q":                    q,
+		"filter":               "workspace_id = " + strconv.FormatInt(workspaceID, 10),
+		"limit":                limit,
+		"attributesToRetrieve": []string{"id"},
+	}
+	var res struct {
+		Hits []struct {
+			ID int64 `json:"id"`
+		} `json:"hits"`
+		EstimatedTotalHits int `json:"estimatedTotalHits"`
+	}
+	err := m.call(ctx, http.MethodPost, m.indexPath()+"/search", query, &res)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]int64, len(res.Hits))
+	for i, hit := range res.Hits {
+		ids[i] = hit.ID
+	}
+	return ids, res.EstimatedTotalHits, nil
+}
+
+func (m *Meilisearch) Ping(ctx context.Context) error {
+	return m.call(ctx, http.MethodGet, "/health", nil, nil)
+}
@@ -0,0 +1,106 @@
+// Package searchindex mirrors tasks into an external search engine, Elasticsearch or
+// Meilisearch, and searches them there. The engines only hold what searching needs; the
+// tasks themselves are still read from the database.
+package searchindex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Document is what an index holds for a task. Archived tasks aren't searched, so they
+// are deleted from the index rather than stored.
+type Document struct {
+	ID          int64  `json:"id"`
+	WorkspaceID int64  `json:"workspace_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// Index is a search engine's index of tasks.
+type Index interface {
+	// Setup creates the index if it doesn't exist yet, with the settings that Search
+	// relies on.
+	Setup(ctx context.Context) error
+	// Recreate deletes the index and everything in it, and sets it up again.
+	Recreate(ctx context.Context) error
+	// Upsert adds documents, or replaces the ones with the same IDs.
+	Upsert(ctx context.Context, docs []Document) error
+	// Delete removes the documents with the given IDs. IDs that aren't in the index are
+	// ignored.
+	Delete(ctx context.Context, ids []int64) error
+	// Search returns the IDs of up to limit of a workspace's tasks matching q, best
+	// matches first, along with how many match in all.
+	Search(ctx context.Context, workspaceID int64, q string, limit int) (ids []int64, total int, err error)
+	// Ping checks that the engine is reachable.
+	Ping(ctx context.Context) error
+}
+
+// client is shared by the indexes. The engines get ten seconds to answer a request, which
+// leaves room for the bulk requests of a reindex.
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// errNotFound is returned by call for 404 responses, which some callers expect.
+var errNotFound = errors.New("not found")
+
+// call sends a request to an engine's API, with body encoded as JSON unless it is
+// already a []byte, and decodes the response into dst if it isn't nil. Any non-2xx
+// response is an error, which includes the start of the response body, where the
+// engines explain what was wrong.
+func call(ctx context.Context, engine, method, apiURL, authorization, contentType string, body, dst interface{}) error {
+	var payload io.Reader
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		payload = bytes.NewReader(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, payload)
+	if err != nil {
+		return fmt.Errorf("%s: %w", engine, err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		// The URL may hold credentials, so only the underlying error is reported.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %w", engine, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", engine, errNotFound)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s: %s", engine, res.Status, strings.TrimSpace(string(body)))
+	}
+	if dst == nil {
+		// Drain (a bounded amount of) the body so that the connection can be reused.
+		io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(dst)
+}
@@ -0,0 +1,73 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the test vectors in RFC 6238 appendix B,
+// "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The codes of RFC 6238 appendix B, cut down from 8 digits to 6.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("%d: %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("%d: got %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+
+	// Secrets are accepted in lower case too, as some apps show them that way.
+	code, err := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", Step(time.Unix(59, 0)))
+	if err != nil || code != "287082" {
+		t.Errorf("lower case: got %q, %v, want 287082", code, err)
+	}
+	_, err = Code("not base32!", 1)
+	if err == nil {
+		t.Error("invalid secret: got no error")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	tests := []struct {
+		name string
+		code string
+		at   time.Time
+		ok   bool
+	}{
+		{"current step", "050471", now, true},
+		{"spaces around", " 050471\n", now, true},
+		{"a step late", "050471", now.Add(period * time.Second), true},
+		{"a step early", "050471", now.Add(-period * time.Second), true},
+		{"two steps late", "050471", now.Add(2 * period * time.Second), false},
+		{"wrong code", "123456", now, false},
+		{"too short", "05047", now, false},
+		{"too long", "0504711", now, false},
+		{"empty", "", now, false},
+	}
+	for _, tt := range tests {
+		step, ok := Verify(rfcSecret, tt.code, tt.at)
+		if ok != tt.ok {
+			t.Errorf("%s: got %t, want %t", tt.name, ok, tt.ok)
+		}
+		if ok && step != Step(now) {
+			t.Errorf("%s: got step %d, want %d", tt.name, step, Step(now))
+		}
+	}
+}
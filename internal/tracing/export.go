@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	queueSize     = 2048
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+)
+
+// exporter sends finished spans to an OTLP/HTTP collector in batches. Spans are dropped,
+// rather than slowing down requests, if the queue fills up because the collector can't
+// keep up or can't be reached.
+type exporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+	queue    chan *Span
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newExporter(endpoint string, headers map[string]string, service string) *exporter {
+	e := &exporter{
+		endpoint: endpoint,
+		headers:  headers,
+		service:  service,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan *Span, queueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *exporter) enqueue(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+	}
+}
+
+func (e *exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) > 0 {
+			// Export errors can't be reported anywhere useful, and the spans are only
+			// diagnostics, so they are dropped.
+			_ = e.export(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case span := <-e.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *exporter) shutdown(ctx context.Context) error {
+	close(e.stop)
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *exporter) export(spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("tracing: collector responded %s", res.Status)
+	}
+	return nil
+}
+
+// The types below are the parts of the OTLP ExportTraceServiceRequest message that we
+// use, in its JSON encoding: IDs are hex strings and 64-bit integers are strings.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              Kind           `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 0 unset, 2 error.
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (e *exporter) request(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		span.mu.Lock()
+		s := otlpSpan{
+			TraceID:           hex.EncodeToString(span.sc.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.sc.SpanID[:]),
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        attributes(span.attributes),
+		}
+		if span.parentID != [8]byte{} {
+			s.ParentSpanID = hex.EncodeToString(span.parentID[:])
+		}
+		if span.failed {
+			s.Status = otlpStatus{Code: 2, Message: span.message}
+		}
+		span.mu.Unlock()
+		out = append(out, s)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attributes(map[string]interface{}{"service.name": e.service})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/zarinakolybaeva/DoMake"}, Spans: out}},
+	}}}
+}
+
+func attributes(m map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(m))
+	for _, key := range keys {
+		var value map[string]interface{}
+		switch v := m[key].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		kvs = append(kvs, otlpKeyValue{Key: key, Value: value})
+	}
+	return kvs
+}
@@ -0,0 +1,255 @@
+// Package tracing records OpenTelemetry-compatible spans and exports them to a
+// collector with OTLP over HTTP (JSON encoding). Trace context is propagated between
+// services in the W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind says what part a span plays in a trace, as in OTLP.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid reports whether the IDs are set; the W3C spec forbids all-zero IDs.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats the span context as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent reads a W3C traceparent header value, returning false if it isn't
+// valid.
+func ParseTraceparent(header string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	// Version 00 has exactly four fields; later versions may add more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	_, err1 := hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	_, err2 := hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	flags, err3 := hex.DecodeString(parts[3])
+	if err1 != nil || err2 != nil || err3 != nil || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+// Tracer starts spans and hands the finished ones to its exporter.
+type Tracer struct {
+	service     string
+	sampleRatio float64
+	exporter    *exporter
+}
+
+// Config configures a Tracer. With no Endpoint, spans still get IDs (so that they can be
+// used to correlate logs and error responses) but aren't exported.
+type Config struct {
+	ServiceName string
+	// Endpoint is the OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces.
+	Endpoint string
+	// Headers are sent with every export, e.g. for the collector's authentication.
+	Headers map[string]string
+	// SampleRatio is the fraction of new traces which are recorded, from 0 to 1. Traces
+	// continued from a traceparent header keep the caller's decision.
+	SampleRatio float64
+}
+
+// New returns a tracer. If an endpoint is configured, it starts a background goroutine
+// which exports spans in batches until Shutdown() is called.
+func New(cfg Config) *Tracer {
+	t := &Tracer{service: cfg.ServiceName, sampleRatio: cfg.SampleRatio}
+	if cfg.Endpoint != "" {
+		t.exporter = newExporter(cfg.Endpoint, cfg.Headers, cfg.ServiceName)
+	}
+	return t
+}
+
+// Shutdown exports the spans still queued and stops the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t.exporter == nil {
+		return nil
+	}
+	return t.exporter.shutdown(ctx)
+}
+
+type spanContextKey struct{}
+type remoteContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span, so that spans started from it
+// become its children.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// ContextWithRemoteParent returns a copy of ctx whose next span continues the trace
+// described by sc, which came from another service.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteContextKey{}, sc)
+}
+
+// SpanFromContext returns the span in ctx, or nil if there isn't one.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// Detach returns a context carrying the same span as ctx but none of its deadline or
+// cancellation, for work which outlives the request that started it.
+func Detach(ctx context.Context) context.Context {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return context.Background()
+	}
+	return ContextWithSpan(context.Background(), span)
+}
+
+// Start starts a span, as a child of the span in ctx if there is one, and returns it
+// along with a copy of ctx carrying it. The span must be ended with End().
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	switch {
+	case SpanFromContext(ctx) != nil:
+		parent := SpanFromContext(ctx).sc
+		span.sc.TraceID, span.sc.Sampled, span.parentID = parent.TraceID, parent.Sampled, parent.SpanID
+	case ctx.Value(remoteContextKey{}) != nil:
+		parent := ctx.Value(remoteContextKey{}).(SpanContext)
+		span.sc.TraceID, span.sc.Sampled, span.parentID = parent.TraceID, parent.Sampled, parent.SpanID
+	default:
+		span.sc.TraceID = randomTraceID()
+		span.sc.Sampled = t.sample(span.sc.TraceID)
+	}
+	span.sc.SpanID = randomSpanID()
+	return ContextWithSpan(ctx, span), span
+}
+
+// sample decides from the trace ID whether to record a new trace, so that the decision
+// is spread evenly.
+func (t *Tracer) sample(id [16]byte) bool {
+	switch {
+	case t.sampleRatio >= 1:
+		return true
+	case t.sampleRatio <= 0:
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(id[8:])>>11)/(1<<53) < t.sampleRatio
+}
+
+// Span is a timed operation within a trace.
+type Span struct {
+	tracer   *Tracer
+	sc       SpanContext
+	parentID [8]byte
+	name     string
+	kind     Kind
+	start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes map[string]interface{}
+	failed     bool
+	message    string
+}
+
+// Tracer returns the tracer which started the span.
+func (s *Span) Tracer() *Tracer {
+	return s.tracer
+}
+
+// SpanContext returns the span's IDs, e.g. to send in a traceparent header.
+func (s *Span) SpanContext() SpanContext {
+	return s.sc
+}
+
+// TraceID returns the ID of the span's trace, as a hex string.
+func (s *Span) TraceID() string {
+	return hex.EncodeToString(s.sc.TraceID[:])
+}
+
+// SetAttribute records a string, bool, int, int64 or float64 value on the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]interface{})
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed with the error's message. A nil error does nothing.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.message = err.Error()
+}
+
+// End records the end time of the span and queues it for export if its trace is
+// sampled. Calling End more than once has no effect.
+func (s *Span) End() {
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.enqueue(s)
+	}
+}
+
+func randomTraceID() [16]byte {
+	var id [16]byte
+	for id == [16]byte{} {
+		if _, err := rand.Read(id[:]); err != nil {
+			panic(fmt.Sprintf("tracing: reading random bytes: %s", err))
+		}
+	}
+	return id
+}
+
+func randomSpanID() [8]byte {
+	var id [8]byte
+	for id == [8]byte{} {
+		if _, err := rand.Read(id[:]); err != nil {
+			panic(fmt.Sprintf("tracing: reading random bytes: %s", err))
+		}
+	}
+	return id
+}
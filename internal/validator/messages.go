@@ -0,0 +1,25 @@
+package validator
+
+// The messages of the rules. They are also the keys of their translations in the i18n
+// catalogs: a message with verbs is matched against the text of an error, so that a
+// hand-written check with the same wording, such as
+//
+//	v.Check(len(name) <= 100, "name", "must not be more than 100 bytes long")
+//
+// is translated just as the MaxLen(100) rule would be.
+const (
+	MsgRequired      = "must be provided"
+	MsgMinLen        = "must be at least %d bytes long"
+	MsgMaxLen        = "must not be more than %d bytes long"
+	MsgOneOf         = "must be one of %s"
+	MsgRange         = "must be between %v and %v"
+	MsgMin           = "must be at least %v"
+	MsgMax           = "must not be more than %v"
+	MsgNotNegative   = "must not be negative"
+	MsgPositive      = "must be greater than zero"
+	MsgMinElements   = "must contain at least %v elements"
+	MsgMaxElements   = "must not contain more than %v elements"
+	MsgEmail         = "must be a valid email address"
+	MsgUnique        = "must not contain duplicate values"
+	MsgInvalidFields = "the request contains invalid fields"
+)
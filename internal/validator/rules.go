@@ -0,0 +1,107 @@
+package validator
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+)
+
+// A Rule checks a value, adding an error for key to the Validator if it isn't valid. Rules
+// are applied with Field(), and composed with Each() and Nested() to check the members of
+// lists and objects.
+type Rule[T any] func(v *Validator, key string, value T)
+
+// Field checks a value against rules, in order. Only the first error for a key is kept,
+// so later rules only matter while the earlier ones pass.
+func Field[T any](v *Validator, key string, value T, rules ...Rule[T]) {
+	for _, rule := range rules {
+		rule(v, key, value)
+	}
+}
+
+// Is returns a rule for a one-off check: ok reports whether a value is valid, and message
+// says what is wrong with it if it isn't.
+func Is[T any](ok func(T) bool, message string) Rule[T] {
+	return func(v *Validator, key string, value T) {
+		v.Check(ok(value), key, message)
+	}
+}
+
+// Required returns a rule that a value must not be the zero value of its type.
+func Required[T comparable]() Rule[T] {
+	return func(v *Validator, key string, value T) {
+		var zero T
+		v.Check(value != zero, key, MsgRequired)
+	}
+}
+
+// MinLen and MaxLen return rules on the length of a string in bytes.
+func MinLen(n int) Rule[string] {
+	return func(v *Validator, key string, value string) {
+		v.Check(len(value) >= n, key, fmt.Sprintf(MsgMinLen, n))
+	}
+}
+
+func MaxLen(n int) Rule[string] {
+	return func(v *Validator, key string, value string) {
+		v.Check(len(value) <= n, key, fmt.Sprintf(MsgMaxLen, n))
+	}
+}
+
+// OneOf returns a rule that a string, or a string type such as an enum, must be one of
+// values. It is the rule form of In().
+func OneOf[T ~string](values ...string) Rule[T] {
+	message := fmt.Sprintf(MsgOneOf, strings.Join(values, ", "))
+	return func(v *Validator, key string, value T) {
+		v.Check(In(string(value), values...), key, message)
+	}
+}
+
+// Range returns a rule that a value must be between min and max, inclusive.
+func Range[T cmp.Ordered](min, max T) Rule[T] {
+	return func(v *Validator, key string, value T) {
+		v.Check(value >= min && value <= max, key, fmt.Sprintf(MsgRange, min, max))
+	}
+}
+
+// Each returns a rule that applies rules to every element of a slice, reporting errors
+// under the element's key, such as "tags[2]".
+func Each[T any](rules ...Rule[T]) Rule[[]T] {
+	return func(v *Validator, key string, values []T) {
+		for i, value := range values {
+			Field(v, Index(key, i), value, rules...)
+		}
+	}
+}
+
+// Nested returns a rule that checks an object with a function written for it on its own,
+// such as one of the data package's Validate functions, reporting the errors under the
+// object's key: an error for "title" becomes one for "subtasks[2].title".
+func Nested[T any](validate func(*Validator, T)) Rule[T] {
+	return func(v *Validator, key string, value T) {
+		inner := New()
+		validate(inner, value)
+		v.Merge(key, inner)
+	}
+}
+
+// Merge adds the errors of another Validator under prefix, joined to their keys with a
+// dot. With an empty prefix the keys are kept as they are.
+func (v *Validator) Merge(prefix string, other *Validator) {
+	for key, message := range other.Errors {
+		v.AddError(Join(prefix, key), message)
+	}
+}
+
+// Index returns the key of the i'th element of the list at key, such as "tags[2]".
+func Index(key string, i int) string {
+	return fmt.Sprintf("%s[%d]", key, i)
+}
+
+// Join returns the key of a member of the object at prefix, such as "subtasks[2].title".
+func Join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
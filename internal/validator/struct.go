@@ -0,0 +1,180 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Struct checks the fields of a struct, or a pointer to one, against the rules in their
+// validate tags, for types whose validation is no more than a list of such rules:
+//
+//	Title    string   `json:"title" validate:"required,max=500"`
+//	Priority string   `json:"priority" validate:"oneof=low medium high"`
+//	Tags     []string `json:"tags" validate:"max=20"`
+//
+// The rules are:
+//
+//	required  the field must not be the zero value of its type (for a pointer, nil)
+//	min=n     strings must be at least n bytes long, slices and maps must have at least
+//	          n elements, and numbers must be at least n
+//	max=n     the same, as a maximum
+//	oneof=a b the field, a string, must be one of the space-separated values
+//	email     the field, a string, must be an email address
+//
+// Errors are reported under the fields' JSON names. Fields holding structs, or slices of
+// them, are checked too, with keys such as "subtasks[2].title". A field tagged
+// validate:"-" is skipped altogether. Struct panics on a tag it doesn't understand, as
+// that is a mistake in the code rather than in the input.
+func (v *Validator) Struct(s interface{}) {
+	v.structValue("", reflect.ValueOf(s))
+}
+
+func (v *Validator) structValue(prefix string, value reflect.Value) {
+	value = indirect(value)
+	if !value.IsValid() {
+		return
+	}
+	if value.Kind() != reflect.Struct {
+		panic("validator: Struct() called with a " + value.Type().String())
+	}
+
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("validate")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		// The fields of embedded structs are encoded as if they were the outer struct's.
+		if field.Anonymous && tag == "" && indirectType(field.Type).Kind() == reflect.Struct {
+			v.structValue(prefix, value.Field(i))
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		key := Join(prefix, name)
+		if tag != "" {
+			v.checkTag(key, value.Field(i), tag)
+		}
+		v.members(key, value.Field(i))
+	}
+}
+
+// members checks the structs held by a field, directly or in a slice.
+func (v *Validator) members(key string, value reflect.Value) {
+	value = indirect(value)
+	switch value.Kind() {
+	case reflect.Struct:
+		v.structValue(key, value)
+	case reflect.Slice, reflect.Array:
+		if indirectType(value.Type().Elem()).Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < value.Len(); i++ {
+			v.structValue(Index(key, i), value.Index(i))
+		}
+	}
+}
+
+func (v *Validator) checkTag(key string, value reflect.Value, tag string) {
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name == "required" {
+			v.Check(!value.IsZero(), key, MsgRequired)
+			continue
+		}
+
+		// The other rules only apply to values that are there: a nil pointer is an
+		// optional field that wasn't given.
+		value := indirect(value)
+		if !value.IsValid() {
+			continue
+		}
+		switch name {
+		case "min", "max":
+			v.checkBound(key, value, name == "min", arg)
+		case "oneof":
+			v.Check(value.Kind() == reflect.String && In(value.String(), strings.Fields(arg)...), key, fmt.Sprintf(MsgOneOf, strings.Join(strings.Fields(arg), ", ")))
+		case "email":
+			v.Check(value.Kind() == reflect.String && Matches(value.String(), EmailRX), key, MsgEmail)
+		default:
+			panic(fmt.Sprintf("validator: unknown rule %q for %s", rule, key))
+		}
+	}
+}
+
+// checkBound applies a min or max rule, which limits the length of strings, slices and
+// maps, and the value of numbers.
+func (v *Validator) checkBound(key string, value reflect.Value, min bool, arg string) {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validator: %s has a bound of %q rather than a number", key, arg))
+	}
+
+	var n float64
+	var length, elements bool
+	switch value.Kind() {
+	case reflect.String:
+		n, length = float64(value.Len()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, elements = float64(value.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = value.Float()
+	default:
+		panic(fmt.Sprintf("validator: %s is a %s, which can't have a min or max", key, value.Type()))
+	}
+
+	var message string
+	switch {
+	case min && length:
+		message = fmt.Sprintf(MsgMinLen, int(bound))
+	case min && elements:
+		message = fmt.Sprintf(MsgMinElements, arg)
+	case min && bound == 0:
+		message = MsgNotNegative
+	case min:
+		message = fmt.Sprintf(MsgMin, arg)
+	case length:
+		message = fmt.Sprintf(MsgMaxLen, int(bound))
+	case elements:
+		message = fmt.Sprintf(MsgMaxElements, arg)
+	default:
+		message = fmt.Sprintf(MsgMax, arg)
+	}
+	if min {
+		v.Check(n >= bound, key, message)
+	} else {
+		v.Check(n <= bound, key, message)
+	}
+}
+
+// indirect follows pointers and interfaces to the value they hold, returning the zero
+// Value for nil.
+func indirect(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
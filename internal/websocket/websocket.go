@@ -0,0 +1,317 @@
+// Package websocket implements the server side of the WebSocket protocol (RFC 6455),
+// limited to what the API needs: text and binary messages, fragmentation, and the
+// ping/pong/close control frames. Extensions such as compression are not supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Define the frame opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// Define the close status codes that we send.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseMessageTooBig   = 1009
+	closeNoStatus        = 1005
+	handshakeGUID        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	defaultMaxMessage    = 1 << 20
+	defaultWriteDeadline = 10 * time.Second
+)
+
+var (
+	// ErrBadHandshake is returned by Upgrade() when the request isn't a valid WebSocket
+	// handshake. Nothing has been written to the client at that point, so the caller can
+	// still send a normal error response.
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+	// ErrClosed is returned by ReadMessage() once the peer has closed the connection.
+	ErrClosed = errors.New("websocket: connection closed")
+
+	errProtocol   = errors.New("websocket: protocol error")
+	errTooBig     = errors.New("websocket: message too big")
+	errUnexpected = errors.New("websocket: unexpected continuation frame")
+)
+
+// Conn is an upgraded WebSocket connection. ReadMessage() must only be called from one
+// goroutine at a time; the write methods may be called concurrently.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	// MaxMessageSize limits the size of an incoming message, after reassembling
+	// fragments. Larger messages close the connection.
+	MaxMessageSize int64
+	// ReadTimeout, if set, is how long the connection may stay silent. It is extended
+	// every time a frame arrives, so sending pings keeps a healthy connection open.
+	ReadTimeout time.Duration
+
+	wmu       sync.Mutex
+	closeOnce sync.Once
+}
+
+// Upgrade performs the opening handshake and takes over the underlying connection from
+// the HTTP server.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		return nil, fmt.Errorf("%w: method must be GET", ErrBadHandshake)
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, fmt.Errorf("%w: missing upgrade headers", ErrBadHandshake)
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("%w: unsupported version", ErrBadHandshake)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("%w: missing Sec-WebSocket-Key", ErrBadHandshake)
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// The server's read and write timeouts are still set on the connection. They were
+	// meant for a single request, so clear them.
+	err = conn.SetDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	_, err = conn.Write([]byte(response))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, br: brw.Reader, MaxMessageSize: defaultMaxMessage}, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + handshakeGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message. Control frames are dealt with
+// along the way: pings are answered, and a close frame is acknowledged and reported as
+// ErrClosed.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	inMessage := false
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			switch {
+			case errors.Is(err, errTooBig):
+				c.CloseWithStatus(CloseMessageTooBig)
+			case errors.Is(err, errProtocol), errors.Is(err, errUnexpected):
+				c.CloseWithStatus(CloseProtocolError)
+			}
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			err = c.writeFrame(opPong, payload)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			status := closeNoStatus
+			if len(payload) >= 2 {
+				status = int(binary.BigEndian.Uint16(payload))
+			}
+			if status == closeNoStatus {
+				status = CloseNormal
+			}
+			c.CloseWithStatus(status)
+			return nil, ErrClosed
+		case opText, opBinary:
+			if inMessage {
+				return nil, c.fail(errUnexpected)
+			}
+			inMessage = true
+			message = payload
+		case opContinuation:
+			if !inMessage {
+				return nil, c.fail(errUnexpected)
+			}
+			message = append(message, payload...)
+		default:
+			return nil, c.fail(errProtocol)
+		}
+
+		if int64(len(message)) > c.MaxMessageSize {
+			c.CloseWithStatus(CloseMessageTooBig)
+			return nil, errTooBig
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *Conn) fail(err error) error {
+	c.CloseWithStatus(CloseProtocolError)
+	return err
+}
+
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	if c.ReadTimeout > 0 {
+		err = c.conn.SetReadDeadline(time.Now().Add(c.ReadTimeout))
+		if err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	var header [2]byte
+	_, err = io.ReadFull(c.br, header[:])
+	if err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7f)
+
+	// No extensions are negotiated, so the reserved bits must be clear, and clients
+	// must mask every frame they send.
+	if header[0]&0x70 != 0 || !masked {
+		return false, 0, nil, errProtocol
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if err != nil {
+		return false, 0, nil, err
+	}
+
+	if opcode >= opClose && (!fin || length > 125) {
+		return false, 0, nil, errProtocol
+	}
+	if length < 0 || length > c.MaxMessageSize {
+		return false, 0, nil, errTooBig
+	}
+
+	var mask [4]byte
+	_, err = io.ReadFull(c.br, mask[:])
+	if err != nil {
+		return false, 0, nil, err
+	}
+
+	payload = make([]byte, length)
+	_, err = io.ReadFull(c.br, payload)
+	if err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends p as a single text message.
+func (c *Conn) WriteMessage(p []byte) error {
+	return c.writeFrame(opText, p)
+}
+
+// Ping sends a ping frame. The client answers with a pong, which keeps the read
+// deadline from expiring.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	// Server frames are never masked.
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+
+	err := c.conn.SetWriteDeadline(time.Now().Add(defaultWriteDeadline))
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(frame)
+	return err
+}
+
+// CloseWithStatus sends a close frame with the given status code and closes the
+// connection. Only the first call has any effect.
+func (c *Conn) CloseWithStatus(status int) error {
+	err := ErrClosed
+	c.closeOnce.Do(func() {
+		payload := make([]byte, 2)
+		binary.BigEndian.PutUint16(payload, uint16(status))
+		// The peer may already be gone, so a failed close frame isn't worth reporting.
+		c.writeFrame(opClose, payload)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// Close closes the connection normally.
+func (c *Conn) Close() error {
+	return c.CloseWithStatus(CloseNormal)
+}
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS tasks_user_id_idx;
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_user_id_fkey;
@@ -0,0 +1,6 @@
+-- user_id was declared as bigserial, so every task silently got a fresh number
+-- instead of its owner's id. Turn it into a plain reference to users.
+ALTER TABLE tasks ALTER COLUMN user_id DROP DEFAULT;
+DROP SEQUENCE IF EXISTS tasks_user_id_seq;
+ALTER TABLE tasks ADD CONSTRAINT tasks_user_id_fkey FOREIGN KEY (user_id) REFERENCES users ON DELETE CASCADE NOT VALID;
+CREATE INDEX IF NOT EXISTS tasks_user_id_idx ON tasks (user_id);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS subtasks (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    title text NOT NULL,
+    done bool NOT NULL DEFAULT false,
+    position integer NOT NULL DEFAULT 0,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS subtasks_task_id_position_idx ON subtasks (task_id, position);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS tasks_recurrence_pending_idx;
+ALTER TABLE tasks DROP COLUMN IF EXISTS recurrence_materialized;
+ALTER TABLE tasks DROP COLUMN IF EXISTS recurrence;
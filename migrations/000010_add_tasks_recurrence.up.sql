@@ -0,0 +1,5 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS recurrence text NOT NULL DEFAULT '';
+-- Set once the next occurrence of a completed recurring task has been created, so
+-- that the scheduler never materializes the same occurrence twice.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS recurrence_materialized bool NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS tasks_recurrence_pending_idx ON tasks (id) WHERE recurrence <> '' AND NOT recurrence_materialized;
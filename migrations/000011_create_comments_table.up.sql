@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS comments (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    edited_at timestamp(0) with time zone,
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    parent_id bigint REFERENCES comments ON DELETE CASCADE,
+    body text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS comments_task_id_idx ON comments (task_id, created_at);
+
+-- Every edit stores the body as it was before the change.
+CREATE TABLE IF NOT EXISTS comment_edits (
+    id bigserial PRIMARY KEY,
+    comment_id bigint NOT NULL REFERENCES comments ON DELETE CASCADE,
+    body text NOT NULL,
+    edited_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS comment_edits_comment_id_idx ON comment_edits (comment_id);
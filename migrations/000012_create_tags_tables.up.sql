@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS task_tags (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    tag_id bigint NOT NULL REFERENCES tags ON DELETE CASCADE,
+    PRIMARY KEY (task_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS task_tags_tag_id_idx ON task_tags (tag_id);
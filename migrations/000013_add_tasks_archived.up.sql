@@ -0,0 +1,2 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS archived bool NOT NULL DEFAULT false;
+CREATE INDEX IF NOT EXISTS tasks_user_id_active_idx ON tasks (user_id) WHERE NOT archived;
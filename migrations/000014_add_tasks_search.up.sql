@@ -0,0 +1,7 @@
+-- Title matches weigh more than description matches when ranking search results.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', title), 'A') ||
+        setweight(to_tsvector('simple', description), 'B')
+    ) STORED;
+CREATE INDEX IF NOT EXISTS tasks_search_idx ON tasks USING GIN (search);
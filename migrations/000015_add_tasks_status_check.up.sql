@@ -0,0 +1,4 @@
+-- Existing rows are not checked (NOT VALID), so tasks created before the
+-- statuses were fixed keep loading; new and updated rows must use the known values.
+ALTER TABLE tasks ADD CONSTRAINT tasks_status_check CHECK (status IN ('to-do', 'in-progress', 'completed')) NOT VALID;
+ALTER TABLE tasks ADD CONSTRAINT tasks_priority_check CHECK (priority IN ('low', 'medium', 'high')) NOT VALID;
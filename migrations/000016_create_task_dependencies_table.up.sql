@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    blocked_by_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    PRIMARY KEY (task_id, blocked_by_id),
+    CHECK (task_id <> blocked_by_id)
+);
+CREATE INDEX IF NOT EXISTS task_dependencies_blocked_by_id_idx ON task_dependencies (blocked_by_id);
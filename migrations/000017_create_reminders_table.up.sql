@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS user_settings (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    reminder_window_minutes integer NOT NULL DEFAULT 1440
+);
+
+CREATE TABLE IF NOT EXISTS reminders (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    due_date timestamp(0) with time zone NOT NULL,
+    status text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    sent_at timestamp(0) with time zone,
+    UNIQUE (task_id, due_date)
+);
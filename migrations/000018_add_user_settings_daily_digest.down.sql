@@ -0,0 +1,2 @@
+ALTER TABLE user_settings DROP COLUMN IF EXISTS digest_sent_on;
+ALTER TABLE user_settings DROP COLUMN IF EXISTS daily_digest;
@@ -0,0 +1,3 @@
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS daily_digest bool NOT NULL DEFAULT false;
+-- The local date the last digest was sent for, so each user gets at most one a day.
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS digest_sent_on date;
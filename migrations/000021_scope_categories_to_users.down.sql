@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS tasks_category_id_idx;
+ALTER TABLE tasks DROP COLUMN IF EXISTS category_id;
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_user_id_name_key;
+ALTER TABLE categories DROP COLUMN IF EXISTS user_id;
+ALTER TABLE categories DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,24 @@
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS user_id bigint REFERENCES users ON DELETE CASCADE;
+
+-- Categories used to be shared by everyone. Give each user their own copy of every
+-- category their tasks use (keeping the shared description where there was one), then
+-- drop the shared ones.
+INSERT INTO categories (name, description, user_id)
+SELECT DISTINCT ON (tasks.user_id, tasks.category) tasks.category, COALESCE(categories.description, ''), tasks.user_id
+FROM tasks
+LEFT JOIN categories ON categories.name = tasks.category AND categories.user_id IS NULL
+ORDER BY tasks.user_id, tasks.category, categories.id;
+DELETE FROM categories WHERE user_id IS NULL;
+
+ALTER TABLE categories ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE categories ADD CONSTRAINT categories_user_id_name_key UNIQUE (user_id, name);
+
+-- tasks.category keeps a copy of the category's name, which is updated when the
+-- category is renamed; category_id is the actual link.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS category_id bigint REFERENCES categories;
+UPDATE tasks SET category_id = categories.id
+FROM categories
+WHERE categories.user_id = tasks.user_id AND categories.name = tasks.category;
+ALTER TABLE tasks ALTER COLUMN category_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS tasks_category_id_idx ON tasks (category_id);
@@ -0,0 +1,2 @@
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS parent_id bigint REFERENCES categories ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
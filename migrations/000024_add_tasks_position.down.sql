@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS tasks_user_id_status_position_idx;
+ALTER TABLE tasks DROP COLUMN IF EXISTS position;
@@ -0,0 +1,7 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS position bigint NOT NULL DEFAULT 0;
+-- Number the existing tasks of each board column in creation order, leaving gaps so
+-- that tasks can later be moved between two others without renumbering.
+UPDATE tasks SET position = numbered.row_number * 1024
+FROM (SELECT id, row_number() OVER (PARTITION BY user_id, status ORDER BY id) FROM tasks) AS numbered
+WHERE tasks.id = numbered.id;
+CREATE INDEX IF NOT EXISTS tasks_user_id_status_position_idx ON tasks (user_id, status, position);
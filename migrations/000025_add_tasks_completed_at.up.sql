@@ -0,0 +1,4 @@
+-- When a task was completed isn't known for tasks completed before this migration, so
+-- they are left out of the completion statistics.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS completed_at timestamp(0) with time zone;
+CREATE INDEX IF NOT EXISTS tasks_user_id_completed_at_idx ON tasks (user_id, completed_at) WHERE completed_at IS NOT NULL;
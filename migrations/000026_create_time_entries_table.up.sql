@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS time_entries (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    started_at timestamp(0) with time zone NOT NULL,
+    ended_at timestamp(0) with time zone,
+    note text NOT NULL DEFAULT '',
+    CHECK (ended_at IS NULL OR ended_at >= started_at)
+);
+CREATE INDEX IF NOT EXISTS time_entries_task_id_idx ON time_entries (task_id);
+CREATE INDEX IF NOT EXISTS time_entries_user_id_started_at_idx ON time_entries (user_id, started_at);
+-- A user can only have one timer running at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS time_entries_running_idx ON time_entries (user_id) WHERE ended_at IS NULL;
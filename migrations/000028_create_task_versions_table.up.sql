@@ -0,0 +1,20 @@
+-- A copy of the editable fields of every version of a task, so that edits can be undone.
+CREATE TABLE IF NOT EXISTS task_versions (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    version integer NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    description text NOT NULL,
+    due_date timestamp(0) with time zone NOT NULL,
+    priority text NOT NULL,
+    status text NOT NULL,
+    category_id bigint NOT NULL,
+    category text NOT NULL,
+    recurrence text NOT NULL,
+    archived bool NOT NULL,
+    PRIMARY KEY (task_id, version)
+);
+-- Start the history of the existing tasks at their current version.
+INSERT INTO task_versions (task_id, version, title, description, due_date, priority, status, category_id, category, recurrence, archived)
+SELECT id, version, title, description, due_date, priority, status, category_id, category, recurrence, archived
+FROM tasks;
@@ -0,0 +1,21 @@
+-- Tasks and categories go back to the owner of the workspace they are in. Categories of
+-- shared workspaces can clash by name with the owner's own, so those are dropped along
+-- with their tasks.
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS user_id bigint REFERENCES users ON DELETE CASCADE;
+UPDATE categories SET user_id = workspaces.personal_user_id
+FROM workspaces
+WHERE workspaces.id = categories.workspace_id;
+DELETE FROM tasks WHERE category_id IN (SELECT id FROM categories WHERE user_id IS NULL);
+DELETE FROM categories WHERE user_id IS NULL;
+ALTER TABLE categories ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_workspace_id_name_key;
+ALTER TABLE categories ADD CONSTRAINT categories_user_id_name_key UNIQUE (user_id, name);
+ALTER TABLE categories DROP COLUMN IF EXISTS workspace_id;
+
+DROP INDEX IF EXISTS tasks_workspace_id_status_position_idx;
+CREATE INDEX IF NOT EXISTS tasks_user_id_status_position_idx ON tasks (user_id, status, position);
+ALTER TABLE tasks DROP COLUMN IF EXISTS workspace_id;
+
+DROP TABLE IF EXISTS workspace_invitations;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS workspaces (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    -- Every user has one personal workspace, which can't be shared or deleted.
+    personal_user_id bigint UNIQUE REFERENCES users ON DELETE CASCADE,
+    version integer NOT NULL DEFAULT 1
+);
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL CHECK (role IN ('owner', 'member', 'viewer')),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+    hash bytea PRIMARY KEY,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    email citext NOT NULL,
+    role text NOT NULL CHECK (role IN ('owner', 'member', 'viewer')),
+    invited_by bigint REFERENCES users ON DELETE SET NULL,
+    expiry timestamp(0) with time zone NOT NULL
+);
+CREATE INDEX IF NOT EXISTS workspace_invitations_workspace_id_idx ON workspace_invitations (workspace_id);
+
+-- Move everybody's tasks and categories into a personal workspace.
+INSERT INTO workspaces (name, personal_user_id)
+SELECT 'Personal', id FROM users;
+INSERT INTO workspace_members (workspace_id, user_id, role)
+SELECT id, personal_user_id, 'owner' FROM workspaces WHERE personal_user_id IS NOT NULL;
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS workspace_id bigint REFERENCES workspaces ON DELETE CASCADE;
+UPDATE tasks SET workspace_id = workspaces.id
+FROM workspaces
+WHERE workspaces.personal_user_id = tasks.user_id;
+ALTER TABLE tasks ALTER COLUMN workspace_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS tasks_workspace_id_idx ON tasks (workspace_id);
+DROP INDEX IF EXISTS tasks_user_id_status_position_idx;
+CREATE INDEX IF NOT EXISTS tasks_workspace_id_status_position_idx ON tasks (workspace_id, status, position);
+
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS workspace_id bigint REFERENCES workspaces ON DELETE CASCADE;
+UPDATE categories SET workspace_id = workspaces.id
+FROM workspaces
+WHERE workspaces.personal_user_id = categories.user_id;
+ALTER TABLE categories ALTER COLUMN workspace_id SET NOT NULL;
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_user_id_name_key;
+ALTER TABLE categories ADD CONSTRAINT categories_workspace_id_name_key UNIQUE (workspace_id, name);
+ALTER TABLE categories DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS task_shares (
+    hash bytea PRIMARY KEY,
+    task_id bigint NOT NULL UNIQUE REFERENCES tasks ON DELETE CASCADE,
+    created_by bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name)
+VALUES
+    ('admin'),
+    ('manager'),
+    ('user');
+
+-- Admins get every permission, managers can also read the audit feed, and users can
+-- work with their own tasks.
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin'
+OR (roles.name = 'manager' AND permissions.code IN ('tasks:read', 'tasks:write', 'audit:read'))
+OR (roles.name = 'user' AND permissions.code IN ('tasks:read', 'tasks:write'));
+
+-- Move the existing grants over to roles: whoever could read the audit feed becomes an
+-- admin, and everyone else becomes a user.
+INSERT INTO users_roles (user_id, role_id)
+SELECT users.id, roles.id
+FROM users, roles
+WHERE roles.name = CASE
+    WHEN EXISTS (
+        SELECT 1
+        FROM users_permissions
+        INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+        WHERE users_permissions.user_id = users.id AND permissions.code = 'audit:read'
+    ) THEN 'admin'
+    ELSE 'user'
+END;
+
+-- Grants now covered by a role are dropped; anything left over stays as a direct grant.
+DELETE FROM users_permissions
+USING users_roles, roles_permissions
+WHERE users_roles.user_id = users_permissions.user_id
+AND roles_permissions.role_id = users_roles.role_id
+AND roles_permissions.permission_id = users_permissions.permission_id;
@@ -0,0 +1,6 @@
+-- The admin user-management API has its own permission, which comes with the admin role.
+INSERT INTO permissions (code) VALUES ('users:admin');
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'users:admin';
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS email_changes (
+    hash bytea PRIMARY KEY,
+    user_id bigint NOT NULL UNIQUE REFERENCES users ON DELETE CASCADE,
+    email citext NOT NULL,
+    expiry timestamp(0) with time zone NOT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE user_settings DROP COLUMN IF EXISTS require_two_factor;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totp;
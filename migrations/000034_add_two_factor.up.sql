@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    secret text NOT NULL,
+    confirmed boolean NOT NULL DEFAULT false,
+    -- The time step of the last code accepted, so that a code can't be used twice.
+    last_step bigint NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    hash bytea NOT NULL,
+    used_at timestamp(0) with time zone,
+    PRIMARY KEY (user_id, hash)
+);
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS require_two_factor boolean NOT NULL DEFAULT false;
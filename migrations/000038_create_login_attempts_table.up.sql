@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    kind text NOT NULL,
+    key citext NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    last_failed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    blocked_until timestamp(0) with time zone,
+    PRIMARY KEY (kind, key)
+);
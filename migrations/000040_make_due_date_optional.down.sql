@@ -0,0 +1,5 @@
+-- Tasks without a due date are given one a week after they were created.
+UPDATE tasks SET due_date = created_at + INTERVAL '1 week' WHERE due_date IS NULL;
+UPDATE task_versions SET due_date = created_at + INTERVAL '1 week' WHERE due_date IS NULL;
+ALTER TABLE tasks ALTER COLUMN due_date SET NOT NULL;
+ALTER TABLE task_versions ALTER COLUMN due_date SET NOT NULL;
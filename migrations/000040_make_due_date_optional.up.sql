@@ -0,0 +1,3 @@
+-- Tasks without a due date are "someday" tasks.
+ALTER TABLE tasks ALTER COLUMN due_date DROP NOT NULL;
+ALTER TABLE task_versions ALTER COLUMN due_date DROP NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE user_settings DROP COLUMN IF EXISTS digest_hour;
+ALTER TABLE user_settings DROP COLUMN IF EXISTS default_sort;
+ALTER TABLE user_settings DROP COLUMN IF EXISTS default_page_size;
+ALTER TABLE user_settings DROP COLUMN IF EXISTS locale;
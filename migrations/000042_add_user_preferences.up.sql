@@ -0,0 +1,8 @@
+-- The language of the API's messages, such as ru; empty to go by Accept-Language.
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT '';
+-- What GET /v1/tasks uses when the page_size and sort parameters aren't given.
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS default_page_size integer NOT NULL DEFAULT 20;
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS default_sort text NOT NULL DEFAULT 'id';
+-- The hour of the day, in the user's time zone, after which the daily digest is sent.
+-- NULL means the server's configured hour.
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS digest_hour integer;
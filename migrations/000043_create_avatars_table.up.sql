@@ -0,0 +1,8 @@
+-- Each size of a user's avatar, as a PNG image. The sizes are replaced together.
+CREATE TABLE IF NOT EXISTS avatars (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    size integer NOT NULL,
+    image bytea NOT NULL,
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, size)
+);
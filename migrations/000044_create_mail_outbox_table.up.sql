@@ -0,0 +1,16 @@
+-- Emails waiting to be sent, or that have been, so that they survive restarts and can be
+-- retried when the mail service is down.
+CREATE TABLE IF NOT EXISTS mail_outbox (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    recipient text NOT NULL,
+    subject text NOT NULL,
+    plain_body text NOT NULL,
+    html_body text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_error text NOT NULL DEFAULT '',
+    sent_at timestamp(0) with time zone
+);
+CREATE INDEX IF NOT EXISTS mail_outbox_pending_idx ON mail_outbox (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,15 @@
+-- Chat services that users have reminders sent to, at most one of each kind per user.
+CREATE TABLE IF NOT EXISTS integrations (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    kind text NOT NULL,
+    webhook_url text NOT NULL DEFAULT '',
+    bot_token text NOT NULL DEFAULT '',
+    chat_id text NOT NULL DEFAULT '',
+    enabled boolean NOT NULL DEFAULT true,
+    last_error text NOT NULL DEFAULT '',
+    last_failed_at timestamp(0) with time zone,
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (user_id, kind)
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS comments_search_idx;
+ALTER TABLE comments DROP COLUMN IF EXISTS search;
+DROP INDEX IF EXISTS tags_search_idx;
+ALTER TABLE tags DROP COLUMN IF EXISTS search;
+DROP INDEX IF EXISTS categories_search_idx;
+ALTER TABLE categories DROP COLUMN IF EXISTS search;
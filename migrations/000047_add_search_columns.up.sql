@@ -0,0 +1,16 @@
+-- GET /v1/search looks through categories, tags and comments as well as tasks. Like
+-- tasks.search, names weigh more than descriptions when ranking the results.
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS search tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', name), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(description, '')), 'B')
+    ) STORED;
+CREATE INDEX IF NOT EXISTS categories_search_idx ON categories USING GIN (search);
+
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS search tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', name)) STORED;
+CREATE INDEX IF NOT EXISTS tags_search_idx ON tags USING GIN (search);
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS search tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', body)) STORED;
+CREATE INDEX IF NOT EXISTS comments_search_idx ON comments USING GIN (search);
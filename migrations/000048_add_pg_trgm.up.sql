@@ -0,0 +1,3 @@
+-- Searches that find nothing fall back to fuzzy matching of task titles with
+-- word_similarity(), so that typos still find the task.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
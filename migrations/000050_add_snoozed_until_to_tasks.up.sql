@@ -0,0 +1,3 @@
+-- A snoozed task is left out of the default task lists, and isn't reminded about, until
+-- snoozed_until has passed. NULL means it isn't snoozed.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS snoozed_until timestamp(0) with time zone;
@@ -0,0 +1,13 @@
+-- Custom fields are defined by a workspace's owners and filled in on its tasks. The
+-- values are kept on the tasks, keyed by the fields' names.
+CREATE TABLE IF NOT EXISTS custom_fields (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    name text NOT NULL,
+    type text NOT NULL,
+    options jsonb NOT NULL DEFAULT '[]',
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT custom_fields_workspace_id_name_key UNIQUE (workspace_id, name)
+);
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS custom_fields jsonb NOT NULL DEFAULT '{}';
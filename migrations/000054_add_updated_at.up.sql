@@ -0,0 +1,6 @@
+-- When a task or category was last changed, sent as Last-Modified. The models set it on
+-- every update; existing rows start out at their creation time.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+UPDATE tasks SET updated_at = created_at;
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+UPDATE categories SET updated_at = created_at;
@@ -0,0 +1,22 @@
+-- Services that create tasks in a category of a workspace on a user's behalf, with signed
+-- requests.
+CREATE TABLE IF NOT EXISTS inbound_integrations (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    category_id bigint NOT NULL REFERENCES categories ON DELETE CASCADE,
+    provider text NOT NULL,
+    secret text NOT NULL,
+    last_received_at timestamp(0) with time zone
+);
+CREATE INDEX IF NOT EXISTS inbound_integrations_user_id_idx ON inbound_integrations (user_id);
+
+-- The signatures of the requests received recently, so that none of them can be replayed.
+CREATE TABLE IF NOT EXISTS inbound_deliveries (
+    integration_id bigint NOT NULL REFERENCES inbound_integrations ON DELETE CASCADE,
+    signature text NOT NULL,
+    received_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (integration_id, signature)
+);
+CREATE INDEX IF NOT EXISTS inbound_deliveries_received_at_idx ON inbound_deliveries (received_at);
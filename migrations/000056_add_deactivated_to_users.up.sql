@@ -0,0 +1,4 @@
+-- Set by an admin to lock a user out. It is kept apart from activated, which only
+-- records that the user confirmed their email address, so that a deactivated user
+-- can't undo it by activating their account again.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated bool NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+-- The user who started a sign in while already signed in, to link the provider account
+-- to. NULL for sign ins started without an account.
+ALTER TABLE oauth_states ADD COLUMN IF NOT EXISTS user_id bigint REFERENCES users ON DELETE CASCADE;
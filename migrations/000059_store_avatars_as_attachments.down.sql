@@ -0,0 +1,7 @@
+ALTER TABLE avatars ADD COLUMN IF NOT EXISTS image bytea;
+UPDATE avatars SET image = attachments.content
+FROM attachments
+WHERE attachments.id = avatars.attachment_id;
+ALTER TABLE avatars ALTER COLUMN image SET NOT NULL;
+ALTER TABLE avatars DROP COLUMN IF EXISTS attachment_id;
+DELETE FROM attachments WHERE task_id IS NULL AND filename LIKE 'avatar-%.png';
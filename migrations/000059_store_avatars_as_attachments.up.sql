@@ -0,0 +1,13 @@
+-- Avatars are stored as attachments, like the other files users upload, with each size
+-- of a user's avatar named avatar-<size>.png. The images move over from the avatars
+-- table, which keeps pointing at them.
+ALTER TABLE avatars ADD COLUMN IF NOT EXISTS attachment_id bigint REFERENCES attachments ON DELETE CASCADE;
+INSERT INTO attachments (created_at, user_id, filename, content_type, size, content, scan_status)
+SELECT updated_at, user_id, 'avatar-' || size || '.png', 'image/png', length(image), image, 'clean'
+FROM avatars;
+UPDATE avatars SET attachment_id = attachments.id
+FROM attachments
+WHERE attachments.task_id IS NULL AND attachments.user_id = avatars.user_id
+    AND attachments.filename = 'avatar-' || avatars.size || '.png';
+ALTER TABLE avatars ALTER COLUMN attachment_id SET NOT NULL;
+ALTER TABLE avatars DROP COLUMN IF EXISTS image;
@@ -0,0 +1,17 @@
+// Package migrations holds the SQL migrations for the database schema. They are embedded
+// in the binary, so that the API can apply them itself when started with -migrate.
+package migrations
+
+import "embed"
+
+// FS contains the *.up.sql and *.down.sql migration files, in golang-migrate's naming
+// scheme.
+//
+//go:embed *.sql
+var FS embed.FS
+
+// SQLiteFS contains the migrations for the SQLite backend, in the sqlite directory. They
+// are numbered like the ones in FS, so that a schema version means the same in both.
+//
+//go:embed sqlite/*.sql
+var SQLiteFS embed.FS
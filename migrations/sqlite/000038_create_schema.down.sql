@@ -0,0 +1,34 @@
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS oauth_states;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+DROP TABLE IF EXISTS email_changes;
+DROP TABLE IF EXISTS task_shares;
+DROP TABLE IF EXISTS task_versions;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS time_entries;
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS reminders;
+DROP TABLE IF EXISTS user_settings;
+DROP TABLE IF EXISTS task_dependencies;
+DROP TABLE IF EXISTS task_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS comment_edits;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS subtasks;
+DROP TABLE IF EXISTS tasks;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS workspace_invitations;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
+DROP TABLE IF EXISTS users_roles;
+DROP TABLE IF EXISTS roles_permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS users_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS tokens;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,354 @@
+-- The SQLite schema starts out as the PostgreSQL schema was at migration 38, so that both
+-- databases report the same version. Later migrations come in pairs, one per database.
+--
+-- SQLite keeps times as text, in UTC and the format of the defaults below; arrays as
+-- JSON; and citext columns as text compared without regard to case.
+CREATE TABLE IF NOT EXISTS users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    name text NOT NULL,
+    email text COLLATE NOCASE UNIQUE NOT NULL,
+    password_hash blob NOT NULL,
+    activated boolean NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    hash blob NOT NULL UNIQUE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    expiry timestamp NOT NULL,
+    scope text NOT NULL,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    last_used_at timestamp,
+    user_agent text NOT NULL DEFAULT '',
+    ip text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    code text NOT NULL
+);
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+INSERT INTO permissions (code)
+VALUES
+    ('tasks:read'),
+    ('tasks:write'),
+    ('audit:read'),
+    ('users:admin');
+
+CREATE TABLE IF NOT EXISTS roles (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+INSERT INTO roles (name)
+VALUES
+    ('admin'),
+    ('manager'),
+    ('user');
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin'
+OR (roles.name = 'manager' AND permissions.code IN ('tasks:read', 'tasks:write', 'audit:read'))
+OR (roles.name = 'user' AND permissions.code IN ('tasks:read', 'tasks:write'));
+
+CREATE TABLE IF NOT EXISTS workspaces (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    name text NOT NULL,
+    personal_user_id bigint UNIQUE REFERENCES users ON DELETE CASCADE,
+    version integer NOT NULL DEFAULT 1
+);
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL CHECK (role IN ('owner', 'member', 'viewer')),
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    PRIMARY KEY (workspace_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+    hash blob PRIMARY KEY,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    email text COLLATE NOCASE NOT NULL,
+    role text NOT NULL CHECK (role IN ('owner', 'member', 'viewer')),
+    invited_by bigint REFERENCES users ON DELETE SET NULL,
+    expiry timestamp NOT NULL
+);
+CREATE INDEX IF NOT EXISTS workspace_invitations_workspace_id_idx ON workspace_invitations (workspace_id);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL,
+    description text,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    version integer NOT NULL DEFAULT 1,
+    parent_id bigint REFERENCES categories ON DELETE SET NULL,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    UNIQUE (workspace_id, name)
+);
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
+
+-- Full-text search uses the text_search() functions that the API registers, instead of
+-- a search column.
+CREATE TABLE IF NOT EXISTS tasks (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    title text NOT NULL,
+    description text NOT NULL,
+    due_date timestamp NOT NULL,
+    priority text NOT NULL CHECK (priority IN ('low', 'medium', 'high')),
+    status text NOT NULL CHECK (status IN ('to-do', 'in-progress', 'completed')),
+    category text NOT NULL,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    version integer NOT NULL DEFAULT 1,
+    recurrence text NOT NULL DEFAULT '',
+    recurrence_materialized boolean NOT NULL DEFAULT false,
+    archived boolean NOT NULL DEFAULT false,
+    category_id bigint NOT NULL REFERENCES categories,
+    position bigint NOT NULL DEFAULT 0,
+    completed_at timestamp,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    CONSTRAINT tasks_due_date_check CHECK (due_date > created_at)
+);
+CREATE INDEX IF NOT EXISTS tasks_user_id_idx ON tasks (user_id);
+CREATE INDEX IF NOT EXISTS tasks_recurrence_pending_idx ON tasks (id) WHERE recurrence <> '' AND NOT recurrence_materialized;
+CREATE INDEX IF NOT EXISTS tasks_user_id_active_idx ON tasks (user_id) WHERE NOT archived;
+CREATE INDEX IF NOT EXISTS tasks_category_id_idx ON tasks (category_id);
+CREATE INDEX IF NOT EXISTS tasks_user_id_completed_at_idx ON tasks (user_id, completed_at) WHERE completed_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS tasks_workspace_id_idx ON tasks (workspace_id);
+CREATE INDEX IF NOT EXISTS tasks_workspace_id_status_position_idx ON tasks (workspace_id, status, position);
+
+CREATE TABLE IF NOT EXISTS subtasks (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    title text NOT NULL,
+    done boolean NOT NULL DEFAULT false,
+    position integer NOT NULL DEFAULT 0,
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS subtasks_task_id_position_idx ON subtasks (task_id, position);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    edited_at timestamp,
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    parent_id bigint REFERENCES comments ON DELETE CASCADE,
+    body text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS comments_task_id_idx ON comments (task_id, created_at);
+CREATE TABLE IF NOT EXISTS comment_edits (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    comment_id bigint NOT NULL REFERENCES comments ON DELETE CASCADE,
+    body text NOT NULL,
+    edited_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'))
+);
+CREATE INDEX IF NOT EXISTS comment_edits_comment_id_idx ON comment_edits (comment_id);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (user_id, name)
+);
+CREATE TABLE IF NOT EXISTS task_tags (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    tag_id bigint NOT NULL REFERENCES tags ON DELETE CASCADE,
+    PRIMARY KEY (task_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS task_tags_tag_id_idx ON task_tags (tag_id);
+
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    blocked_by_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    PRIMARY KEY (task_id, blocked_by_id),
+    CHECK (task_id <> blocked_by_id)
+);
+CREATE INDEX IF NOT EXISTS task_dependencies_blocked_by_id_idx ON task_dependencies (blocked_by_id);
+
+CREATE TABLE IF NOT EXISTS user_settings (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    reminder_window_minutes integer NOT NULL DEFAULT 1440,
+    daily_digest boolean NOT NULL DEFAULT false,
+    digest_sent_on date,
+    require_two_factor boolean NOT NULL DEFAULT false
+);
+
+CREATE TABLE IF NOT EXISTS reminders (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    due_date timestamp NOT NULL,
+    status text NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    sent_at timestamp,
+    UNIQUE (task_id, due_date)
+);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    url text NOT NULL,
+    secret text NOT NULL,
+    events text NOT NULL,
+    active boolean NOT NULL DEFAULT true,
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS webhooks_user_id_idx ON webhooks (user_id);
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    webhook_id bigint NOT NULL REFERENCES webhooks ON DELETE CASCADE,
+    event text NOT NULL,
+    payload text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    last_status_code integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    delivered_at timestamp
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    key text NOT NULL,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    expires_at timestamp NOT NULL,
+    request_hash blob NOT NULL,
+    status_code integer,
+    header text,
+    body blob,
+    PRIMARY KEY (user_id, key)
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+CREATE TABLE IF NOT EXISTS time_entries (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    started_at timestamp NOT NULL,
+    ended_at timestamp,
+    note text NOT NULL DEFAULT '',
+    CHECK (ended_at IS NULL OR ended_at >= started_at)
+);
+CREATE INDEX IF NOT EXISTS time_entries_task_id_idx ON time_entries (task_id);
+CREATE INDEX IF NOT EXISTS time_entries_user_id_started_at_idx ON time_entries (user_id, started_at);
+CREATE UNIQUE INDEX IF NOT EXISTS time_entries_running_idx ON time_entries (user_id) WHERE ended_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    actor_id bigint REFERENCES users ON DELETE SET NULL,
+    entity_type text NOT NULL,
+    entity_id bigint NOT NULL,
+    action text NOT NULL,
+    changes text NOT NULL DEFAULT '{}'
+);
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_type, entity_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id, id);
+
+CREATE TABLE IF NOT EXISTS task_versions (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    version integer NOT NULL,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    title text NOT NULL,
+    description text NOT NULL,
+    due_date timestamp NOT NULL,
+    priority text NOT NULL,
+    status text NOT NULL,
+    category_id bigint NOT NULL,
+    category text NOT NULL,
+    recurrence text NOT NULL,
+    archived boolean NOT NULL,
+    PRIMARY KEY (task_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS task_shares (
+    hash blob PRIMARY KEY,
+    task_id bigint NOT NULL UNIQUE REFERENCES tasks ON DELETE CASCADE,
+    created_by bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS email_changes (
+    hash blob PRIMARY KEY,
+    user_id bigint NOT NULL UNIQUE REFERENCES users ON DELETE CASCADE,
+    email text COLLATE NOCASE NOT NULL,
+    expiry timestamp NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    secret text NOT NULL,
+    confirmed boolean NOT NULL DEFAULT false,
+    last_step bigint NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    hash blob NOT NULL,
+    used_at timestamp,
+    PRIMARY KEY (user_id, hash)
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider text NOT NULL,
+    subject text NOT NULL,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    email text COLLATE NOCASE NOT NULL,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    PRIMARY KEY (provider, subject)
+);
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
+CREATE TABLE IF NOT EXISTS oauth_states (
+    hash blob PRIMARY KEY,
+    provider text NOT NULL,
+    expiry timestamp NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    hash blob NOT NULL UNIQUE,
+    permissions text NOT NULL,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    last_used_at timestamp
+);
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    kind text NOT NULL,
+    key text COLLATE NOCASE NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    last_failed_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    blocked_until timestamp,
+    PRIMARY KEY (kind, key)
+);
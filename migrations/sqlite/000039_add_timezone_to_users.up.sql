@@ -0,0 +1,3 @@
+-- The IANA name of the user's time zone, such as Europe/Moscow. Empty means the
+-- server's default zone.
+ALTER TABLE users ADD COLUMN timezone text NOT NULL DEFAULT '';
@@ -0,0 +1,66 @@
+-- Tasks don't need a due date. SQLite can't drop a NOT NULL constraint, so the tables are
+-- rebuilt as described in https://www.sqlite.org/lang_altertable.html#otheralter, with
+-- foreign keys off so that dropping the old tasks table doesn't cascade to the tables
+-- referring to it. The migrator doesn't wrap SQLite migrations in a transaction, since
+-- foreign keys can't be turned off inside one.
+PRAGMA foreign_keys = OFF;
+BEGIN;
+
+CREATE TABLE tasks_new (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    title text NOT NULL,
+    description text NOT NULL,
+    due_date timestamp,
+    priority text NOT NULL CHECK (priority IN ('low', 'medium', 'high')),
+    status text NOT NULL CHECK (status IN ('to-do', 'in-progress', 'completed')),
+    category text NOT NULL,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    version integer NOT NULL DEFAULT 1,
+    recurrence text NOT NULL DEFAULT '',
+    recurrence_materialized boolean NOT NULL DEFAULT false,
+    archived boolean NOT NULL DEFAULT false,
+    category_id bigint NOT NULL REFERENCES categories,
+    position bigint NOT NULL DEFAULT 0,
+    completed_at timestamp,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    CONSTRAINT tasks_due_date_check CHECK (due_date > created_at)
+);
+INSERT INTO tasks_new (id, created_at, title, description, due_date, priority, status, category, user_id, version, recurrence, recurrence_materialized, archived, category_id, position, completed_at, workspace_id)
+SELECT id, created_at, title, description, due_date, priority, status, category, user_id, version, recurrence, recurrence_materialized, archived, category_id, position, completed_at, workspace_id
+FROM tasks;
+-- Keep the AUTOINCREMENT counter, so that the IDs of deleted tasks aren't reused.
+UPDATE sqlite_sequence SET seq = (SELECT seq FROM sqlite_sequence WHERE name = 'tasks') WHERE name = 'tasks_new';
+DROP TABLE tasks;
+ALTER TABLE tasks_new RENAME TO tasks;
+CREATE INDEX tasks_user_id_idx ON tasks (user_id);
+CREATE INDEX tasks_recurrence_pending_idx ON tasks (id) WHERE recurrence <> '' AND NOT recurrence_materialized;
+CREATE INDEX tasks_user_id_active_idx ON tasks (user_id) WHERE NOT archived;
+CREATE INDEX tasks_category_id_idx ON tasks (category_id);
+CREATE INDEX tasks_user_id_completed_at_idx ON tasks (user_id, completed_at) WHERE completed_at IS NOT NULL;
+CREATE INDEX tasks_workspace_id_idx ON tasks (workspace_id);
+CREATE INDEX tasks_workspace_id_status_position_idx ON tasks (workspace_id, status, position);
+
+CREATE TABLE task_versions_new (
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    version integer NOT NULL,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    title text NOT NULL,
+    description text NOT NULL,
+    due_date timestamp,
+    priority text NOT NULL,
+    status text NOT NULL,
+    category_id bigint NOT NULL,
+    category text NOT NULL,
+    recurrence text NOT NULL,
+    archived boolean NOT NULL,
+    PRIMARY KEY (task_id, version)
+);
+INSERT INTO task_versions_new (task_id, version, created_at, title, description, due_date, priority, status, category_id, category, recurrence, archived)
+SELECT task_id, version, created_at, title, description, due_date, priority, status, category_id, category, recurrence, archived
+FROM task_versions;
+DROP TABLE task_versions;
+ALTER TABLE task_versions_new RENAME TO task_versions;
+
+COMMIT;
+PRAGMA foreign_keys = ON;
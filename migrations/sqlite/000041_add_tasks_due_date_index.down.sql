@@ -0,0 +1 @@
+DROP INDEX IF EXISTS tasks_workspace_id_due_date_idx;
@@ -0,0 +1,2 @@
+-- For the ?due shortcuts of GET /v1/tasks, which look for tasks due in a range of time.
+CREATE INDEX IF NOT EXISTS tasks_workspace_id_due_date_idx ON tasks (workspace_id, due_date);
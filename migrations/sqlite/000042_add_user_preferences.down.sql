@@ -0,0 +1,4 @@
+ALTER TABLE user_settings DROP COLUMN digest_hour;
+ALTER TABLE user_settings DROP COLUMN default_sort;
+ALTER TABLE user_settings DROP COLUMN default_page_size;
+ALTER TABLE user_settings DROP COLUMN locale;
@@ -0,0 +1,16 @@
+-- Emails waiting to be sent, or that have been, so that they survive restarts and can be
+-- retried when the mail service is down.
+CREATE TABLE IF NOT EXISTS mail_outbox (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    recipient text NOT NULL,
+    subject text NOT NULL,
+    plain_body text NOT NULL,
+    html_body text NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    last_error text NOT NULL DEFAULT '',
+    sent_at timestamp
+);
+CREATE INDEX IF NOT EXISTS mail_outbox_pending_idx ON mail_outbox (next_attempt_at) WHERE status = 'pending';
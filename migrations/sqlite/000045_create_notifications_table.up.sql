@@ -0,0 +1,14 @@
+-- In-app notifications, shown in the clients' notification center.
+CREATE TABLE IF NOT EXISTS notifications (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    kind text NOT NULL,
+    message text NOT NULL,
+    task_id bigint REFERENCES tasks ON DELETE CASCADE,
+    comment_id bigint REFERENCES comments ON DELETE CASCADE,
+    webhook_id bigint REFERENCES webhooks ON DELETE CASCADE,
+    read_at timestamp
+);
+CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON notifications (user_id, created_at);
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
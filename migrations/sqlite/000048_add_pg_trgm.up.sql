@@ -0,0 +1,3 @@
+-- SQLite has no pg_trgm: the API registers its own word_similarity() function. This
+-- migration keeps the version numbers in step with PostgreSQL's.
+SELECT 1;
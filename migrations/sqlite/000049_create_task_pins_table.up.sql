@@ -0,0 +1,9 @@
+-- Tasks that users have pinned, which come first in their task lists. Pins are each
+-- user's own, since a workspace's tasks are shared by its members.
+CREATE TABLE IF NOT EXISTS task_pins (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    task_id bigint NOT NULL REFERENCES tasks ON DELETE CASCADE,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    PRIMARY KEY (user_id, task_id)
+);
+CREATE INDEX IF NOT EXISTS task_pins_task_id_idx ON task_pins (task_id);
@@ -0,0 +1 @@
+ALTER TABLE tasks DROP COLUMN snoozed_until;
@@ -0,0 +1,3 @@
+-- A task with a start date in the future is scheduled: it is left out of the "today" list,
+-- and of ?available=true, until then. NULL means it can be started at any time.
+ALTER TABLE tasks ADD COLUMN start_date timestamp;
@@ -0,0 +1,2 @@
+ALTER TABLE tasks DROP COLUMN remaining_minutes;
+ALTER TABLE tasks DROP COLUMN estimate_minutes;
@@ -0,0 +1,4 @@
+-- How long a task is expected to take in all, and how much of that is left, in minutes.
+-- NULL means it hasn't been estimated.
+ALTER TABLE tasks ADD COLUMN estimate_minutes integer CHECK (estimate_minutes >= 0);
+ALTER TABLE tasks ADD COLUMN remaining_minutes integer CHECK (remaining_minutes >= 0);
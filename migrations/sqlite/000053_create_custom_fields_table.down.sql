@@ -0,0 +1,2 @@
+ALTER TABLE tasks DROP COLUMN custom_fields;
+DROP TABLE IF EXISTS custom_fields;
@@ -0,0 +1,13 @@
+-- Custom fields are defined by a workspace's owners and filled in on its tasks. The
+-- values are kept on the tasks, keyed by the fields' names.
+CREATE TABLE IF NOT EXISTS custom_fields (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    name text NOT NULL,
+    type text NOT NULL,
+    options text NOT NULL DEFAULT '[]',
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (workspace_id, name)
+);
+ALTER TABLE tasks ADD COLUMN custom_fields text NOT NULL DEFAULT '{}';
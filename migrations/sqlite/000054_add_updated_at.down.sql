@@ -0,0 +1,2 @@
+ALTER TABLE categories DROP COLUMN updated_at;
+ALTER TABLE tasks DROP COLUMN updated_at;
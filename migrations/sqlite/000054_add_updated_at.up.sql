@@ -0,0 +1,7 @@
+-- When a task or category was last changed, sent as Last-Modified. The models set it on
+-- every update; existing rows start out at their creation time. SQLite can't add a column
+-- defaulting to the current time, so the models set it on insert too.
+ALTER TABLE tasks ADD COLUMN updated_at timestamp NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+UPDATE tasks SET updated_at = created_at;
+ALTER TABLE categories ADD COLUMN updated_at timestamp NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+UPDATE categories SET updated_at = created_at;
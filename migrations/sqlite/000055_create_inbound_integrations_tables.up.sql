@@ -0,0 +1,22 @@
+-- Services that create tasks in a category of a workspace on a user's behalf, with signed
+-- requests.
+CREATE TABLE IF NOT EXISTS inbound_integrations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    workspace_id bigint NOT NULL REFERENCES workspaces ON DELETE CASCADE,
+    category_id bigint NOT NULL REFERENCES categories ON DELETE CASCADE,
+    provider text NOT NULL,
+    secret text NOT NULL,
+    last_received_at timestamp
+);
+CREATE INDEX IF NOT EXISTS inbound_integrations_user_id_idx ON inbound_integrations (user_id);
+
+-- The signatures of the requests received recently, so that none of them can be replayed.
+CREATE TABLE IF NOT EXISTS inbound_deliveries (
+    integration_id bigint NOT NULL REFERENCES inbound_integrations ON DELETE CASCADE,
+    signature text NOT NULL,
+    received_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    PRIMARY KEY (integration_id, signature)
+);
+CREATE INDEX IF NOT EXISTS inbound_deliveries_received_at_idx ON inbound_deliveries (received_at);
@@ -0,0 +1,18 @@
+-- Files uploaded by users, with their content. task_id is NULL for files that aren't
+-- attached to a task. Attachments are quarantined, with scan_status pending, until the
+-- scanners have passed them.
+CREATE TABLE IF NOT EXISTS attachments (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    task_id bigint REFERENCES tasks ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    filename text NOT NULL,
+    content_type text NOT NULL,
+    size bigint NOT NULL,
+    content blob NOT NULL,
+    scan_status text NOT NULL DEFAULT 'pending',
+    scan_reason text NOT NULL DEFAULT '',
+    scanned_at timestamp
+);
+CREATE INDEX IF NOT EXISTS attachments_task_id_idx ON attachments (task_id);
+CREATE INDEX IF NOT EXISTS attachments_pending_idx ON attachments (created_at) WHERE scan_status = 'pending';
@@ -0,0 +1,18 @@
+BEGIN;
+
+CREATE TABLE avatars_old (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    size integer NOT NULL,
+    image blob NOT NULL,
+    updated_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    PRIMARY KEY (user_id, size)
+);
+INSERT INTO avatars_old (user_id, size, image, updated_at)
+SELECT avatars.user_id, avatars.size, attachments.content, avatars.updated_at
+FROM avatars
+INNER JOIN attachments ON attachments.id = avatars.attachment_id;
+DROP TABLE avatars;
+ALTER TABLE avatars_old RENAME TO avatars;
+DELETE FROM attachments WHERE task_id IS NULL AND filename LIKE 'avatar-%.png';
+
+COMMIT;
@@ -0,0 +1,27 @@
+-- Avatars are stored as attachments, like the other files users upload, with each size
+-- of a user's avatar named avatar-<size>.png. The images move over from the avatars
+-- table, which keeps pointing at them. SQLite can't add a NOT NULL column without a
+-- default, so the table is rebuilt. The migrator doesn't wrap SQLite migrations in a
+-- transaction, so this one does.
+BEGIN;
+
+INSERT INTO attachments (created_at, user_id, filename, content_type, size, content, scan_status)
+SELECT updated_at, user_id, 'avatar-' || size || '.png', 'image/png', length(image), image, 'clean'
+FROM avatars;
+
+CREATE TABLE avatars_new (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    size integer NOT NULL,
+    attachment_id bigint NOT NULL REFERENCES attachments ON DELETE CASCADE,
+    updated_at timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%S+00:00', 'now')),
+    PRIMARY KEY (user_id, size)
+);
+INSERT INTO avatars_new (user_id, size, attachment_id, updated_at)
+SELECT avatars.user_id, avatars.size, attachments.id, avatars.updated_at
+FROM avatars
+INNER JOIN attachments ON attachments.task_id IS NULL AND attachments.user_id = avatars.user_id
+    AND attachments.filename = 'avatar-' || avatars.size || '.png';
+DROP TABLE avatars;
+ALTER TABLE avatars_new RENAME TO avatars;
+
+COMMIT;